@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/LouisBrunner/mem-viz/pkg/cli"
+	"github.com/LouisBrunner/mem-viz/pkg/contracts"
+	"github.com/LouisBrunner/mem-viz/pkg/kaitai-viz"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/pflag"
+)
+
+type args struct {
+	file     string
+	specFile string
+}
+
+func main() {
+	cli.Main("kaitai-viz", args{}, cli.Worker[args]{
+		AddFlags: func(params *args) {
+			pflag.StringVar(&params.file, "file", "", "file to load")
+			pflag.StringVar(&params.specFile, "ksy", "", "Kaitai Struct specification of the format of the file, e.g. `./png.ksy`")
+		},
+		CheckExtraFrom: func(params args) ([]bool, []string) {
+			return []bool{
+					params.file != "",
+				}, []string{
+					"file",
+				}
+		},
+		GetMemory: func(logger *logrus.Logger, params args) (*contracts.MemoryBlock, error) {
+			if params.file == "" {
+				return nil, fmt.Errorf("no source specified")
+			}
+			if params.specFile == "" {
+				return nil, fmt.Errorf("must specify --ksy with --file")
+			}
+			return kaitai.Parse(logger, params.file, params.specFile)
+		},
+	})
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/LouisBrunner/mem-viz/pkg/cli"
+	"github.com/LouisBrunner/mem-viz/pkg/contracts"
+	"github.com/LouisBrunner/mem-viz/pkg/proc-viz"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/pflag"
+)
+
+type args struct {
+	fromPid  int
+	fromSelf bool
+}
+
+func main() {
+	cli.Main("proc-viz", args{}, cli.Worker[args]{
+		AddFlags: func(params *args) {
+			pflag.IntVar(&params.fromPid, "from-pid", 0, "process to load")
+			pflag.BoolVar(&params.fromSelf, "from-self", false, "load the memory from the current process")
+		},
+		CheckExtraFrom: func(params args) ([]bool, []string) {
+			return []bool{
+					params.fromPid != 0,
+					params.fromSelf,
+				}, []string{
+					"from-pid",
+					"from-self",
+				}
+		},
+		GetMemory: func(logger *logrus.Logger, params args) (*contracts.MemoryBlock, error) {
+			if params.fromPid != 0 {
+				return proc.Parse(logger, params.fromPid)
+			} else if params.fromSelf {
+				return proc.Parse(logger, os.Getpid())
+			}
+			return nil, fmt.Errorf("no source specified")
+		},
+	})
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/LouisBrunner/mem-viz/pkg/cli"
+	"github.com/LouisBrunner/mem-viz/pkg/contracts"
+	"github.com/LouisBrunner/mem-viz/pkg/template-viz"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/pflag"
+)
+
+type args struct {
+	file         string
+	templateFile string
+}
+
+func main() {
+	cli.Main("template-viz", args{}, cli.Worker[args]{
+		AddFlags: func(params *args) {
+			pflag.StringVar(&params.file, "file", "", "file to load")
+			pflag.StringVar(&params.templateFile, "template", "", "template describing the format of the file, e.g. `./format.yaml`")
+		},
+		CheckExtraFrom: func(params args) ([]bool, []string) {
+			return []bool{
+					params.file != "",
+				}, []string{
+					"file",
+				}
+		},
+		GetMemory: func(logger *logrus.Logger, params args) (*contracts.MemoryBlock, error) {
+			if params.file == "" {
+				return nil, fmt.Errorf("no source specified")
+			}
+			if params.templateFile == "" {
+				return nil, fmt.Errorf("must specify --template with --file")
+			}
+			return template.Parse(logger, params.file, params.templateFile)
+		},
+	})
+}
@@ -0,0 +1,152 @@
+package ar
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/binary"
+	"fmt"
+	"os"
+
+	"github.com/LouisBrunner/mem-viz/pkg/arutils"
+	"github.com/LouisBrunner/mem-viz/pkg/contracts"
+	elf "github.com/LouisBrunner/mem-viz/pkg/elf-viz"
+	macho "github.com/LouisBrunner/mem-viz/pkg/macho-viz"
+	"github.com/LouisBrunner/mem-viz/pkg/machoutils"
+	"github.com/LouisBrunner/mem-viz/pkg/parsingutils"
+	"github.com/blacktop/go-macho/types"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/exp/slices"
+)
+
+type parser struct {
+	logger *logrus.Logger
+}
+
+func Parse(logger *logrus.Logger, file string) (*contracts.MemoryBlock, error) {
+	p := &parser{
+		logger: logger,
+	}
+	return p.parse(file)
+}
+
+func (me *parser) parse(file string) (*contracts.MemoryBlock, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	root := &contracts.MemoryBlock{
+		Name: file,
+		Size: uint64(len(data)),
+	}
+	switch {
+	case bytes.HasPrefix(data, arutils.Magic) || bytes.HasPrefix(data, arutils.ThinMagic):
+		err = me.addArchive(root, data)
+	case isFat(data):
+		err = me.addFat(root, data)
+	default:
+		err = fmt.Errorf("not a static archive or a universal binary")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return root, nil
+}
+
+// Every container is parsed as if it started at 0 and then moved where it is, like the architectures of universal
+// binaries in macho-viz
+func (me *parser) addContent(parent *contracts.MemoryBlock, child *contracts.MemoryBlock, offset uint64) {
+	parsingutils.Rebase(child, uint64(parent.Address)+offset)
+	child.ParentOffset = offset
+	parent.Content = append(parent.Content, child)
+}
+
+// Members are laid out one after the other with their object (if any) parsed by its own frontend, the archive has to
+// start at 0 (it is rebased with its container otherwise)
+func (me *parser) addArchive(root *contracts.MemoryBlock, data []byte) error {
+	archive, warnings, err := arutils.Parse(data)
+	if err != nil {
+		return err
+	}
+	for _, warning := range warnings {
+		me.logger.Warnf("%v", warning)
+	}
+	me.logger.Debugf("found %d members and %d symbols", len(archive.Members), len(archive.Symbols))
+
+	root.Content = append(root.Content, archive.Header)
+	for _, member := range archive.Members {
+		block := member.Block
+		if !member.Special {
+			object, err := me.parseObject(member.Data)
+			if err != nil {
+				me.logger.WithError(err).Warnf("failed to parse %s", member.Name)
+			} else if object != nil {
+				me.addContent(block, object, member.DataOffset-member.Offset)
+			}
+		}
+		block.ParentOffset = uint64(block.Address)
+		root.Content = append(root.Content, block)
+	}
+	return nil
+}
+
+func (me *parser) parseObject(data []byte) (*contracts.MemoryBlock, error) {
+	if len(data) < 4 {
+		return nil, nil
+	}
+	if bytes.HasPrefix(data, []byte("\x7fELF")) {
+		return elf.ParseData(me.logger, "ELF Object", data)
+	}
+	for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		magic := types.Magic(order.Uint32(data))
+		if magic == types.Magic32 || magic == types.Magic64 {
+			return macho.ParseData(me.logger, "Mach-O Object", data)
+		}
+	}
+	// e.g. LLVM bitcode or resources
+	return nil, nil
+}
+
+func isFat(data []byte) bool {
+	_, ok := machoutils.FatHeaderSize(data)
+	return ok
+}
+
+// Universal binaries (e.g. of static archives) only have a header listing their architectures, which are either
+// archives or Mach-O images
+func (me *parser) addFat(root *contracts.MemoryBlock, data []byte) error {
+	header, arches, err := machoutils.ParseFat(data)
+	if err != nil {
+		return err
+	}
+	root.Content = append(root.Content, header)
+	for _, arch := range arches {
+		root.Content = append(root.Content, arch.Block)
+	}
+
+	// The architectures don't have to be in the same order as their headers
+	slices.SortFunc(arches, func(a, b machoutils.FatArch) int {
+		return cmp.Compare(a.Offset, b.Offset)
+	})
+	for _, arch := range arches {
+		name := arch.CPU.String()
+		start, end := arch.Offset, arch.Offset+arch.Size
+		if end > uint64(len(data)) {
+			return fmt.Errorf("arch %s is out of bounds: %#x > %#x", name, end, len(data))
+		}
+		block, err := me.parseArch(fmt.Sprintf("Arch %s", name), data[start:end])
+		if err != nil {
+			return fmt.Errorf("failed to parse arch %s: %w", name, err)
+		}
+		me.addContent(root, block, start)
+	}
+	return nil
+}
+
+func (me *parser) parseArch(name string, data []byte) (*contracts.MemoryBlock, error) {
+	if bytes.HasPrefix(data, arutils.Magic) {
+		block := &contracts.MemoryBlock{Name: name, Size: uint64(len(data))}
+		return block, me.addArchive(block, data)
+	}
+	return macho.ParseData(me.logger, name, data)
+}
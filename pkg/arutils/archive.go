@@ -0,0 +1,247 @@
+package arutils
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/LouisBrunner/mem-viz/pkg/contracts"
+	"github.com/LouisBrunner/mem-viz/pkg/parsingutils"
+)
+
+// Static archives (ar) are a global header followed by members, each one starting with a textual header. Blocks are
+// given at their file offset (i.e. the archive is expected to start at 0), the contents of the members are left to the
+// caller (e.g. to parse them as objects)
+
+var Magic = []byte("!<arch>\n")
+
+// Thin archives only reference their members by path
+var ThinMagic = []byte("!<thin>\n")
+
+const (
+	headerSize = 60
+	headerEnd  = "`\n"
+	// BSD names which are too long (or have spaces) are stored right after the header, their length follows the prefix
+	bsdLongNamePrefix = "#1/"
+)
+
+// Names of the members which describe the archive instead of being part of it
+const (
+	gnuSymbolsName     = "/"
+	gnuSymbols64Name   = "/SYM64/"
+	gnuLongNamesName   = "//"
+	bsdSymbolsName     = "__.SYMDEF"
+	bsdSymbols64Name   = "__.SYMDEF_64"
+	bsdSortedSuffix    = " SORTED"
+	gnuLongNamesEnding = "/\n"
+)
+
+type Member struct {
+	// Name of the member, long names are resolved and the GNU terminator is removed
+	Name string
+	// File offset of its header and of its contents (after the name for BSD long names)
+	Offset, DataOffset uint64
+	Data               []byte
+	// Covers the header and the contents (but not the padding to the next member)
+	Block *contracts.MemoryBlock
+	// Symbol tables and long names aren't part of the archive, they describe it
+	Special bool
+}
+
+type Symbol struct {
+	Name string
+	// Member which defines it
+	Member *Member
+}
+
+type Archive struct {
+	// Only has the magic
+	Header  *contracts.MemoryBlock
+	Members []*Member
+	// From the symbol table, in its order
+	Symbols []Symbol
+}
+
+// Fields of the header, which are space-padded text
+var headerFields = []struct {
+	name string
+	size uint64
+}{
+	{"Name", 16}, {"Date", 12}, {"UID", 6}, {"GID", 6}, {"Mode", 8}, {"Size", 10}, {"End", 2},
+}
+
+// Parses the members of an archive and decodes its symbol table and long names. Problems with those tables are returned
+// as warnings as the members can still be shown without them
+func Parse(data []byte) (*Archive, []error, error) {
+	if bytes.HasPrefix(data, ThinMagic) {
+		return nil, nil, fmt.Errorf("thin archives aren't supported, their members are separate files")
+	}
+	if !bytes.HasPrefix(data, Magic) {
+		return nil, nil, fmt.Errorf("not an archive (invalid magic %q)", data[:min(len(data), len(Magic))])
+	}
+
+	archive := &Archive{
+		Header: &contracts.MemoryBlock{Name: "Archive Header", Size: uint64(len(Magic))},
+	}
+	addString(archive.Header, "Magic", string(Magic), 0, uint64(len(Magic)))
+	warnings := []error{}
+	var longNames *Member
+	for offset := uint64(len(Magic)); offset < uint64(len(data)); {
+		member, err := parseMember(data, offset, longNames)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to parse member at %#x: %w", offset, err)
+		}
+		if member.Name == gnuLongNamesName {
+			longNames = member
+			addLongNames(member)
+		}
+		archive.Members = append(archive.Members, member)
+		// Members are aligned on 2 bytes
+		offset = member.DataOffset + uint64(len(member.Data))
+		offset += offset % 2
+	}
+
+	for _, member := range archive.Members {
+		var err error
+		switch member.Name {
+		case gnuSymbolsName:
+			err = archive.decodeGNUSymbols(member, 4)
+		case gnuSymbols64Name:
+			err = archive.decodeGNUSymbols(member, 8)
+		case bsdSymbolsName, bsdSymbolsName + bsdSortedSuffix:
+			err = archive.decodeBSDSymbols(member, 4)
+		case bsdSymbols64Name, bsdSymbols64Name + bsdSortedSuffix:
+			err = archive.decodeBSDSymbols(member, 8)
+		}
+		if err != nil {
+			warnings = append(warnings, fmt.Errorf("failed to decode the symbol table %s: %w", member.Name, err))
+		}
+	}
+	return archive, warnings, nil
+}
+
+func parseMember(data []byte, offset uint64, longNames *Member) (*Member, error) {
+	if headerSize > uint64(len(data))-offset {
+		return nil, fmt.Errorf("header out of bounds: %#x+%#x > %#x", offset, headerSize, len(data))
+	}
+	header := map[string]string{}
+	for i, start := 0, offset; i < len(headerFields); i += 1 {
+		header[headerFields[i].name] = string(data[start : start+headerFields[i].size])
+		start += headerFields[i].size
+	}
+	if header["End"] != headerEnd {
+		return nil, fmt.Errorf("invalid header terminator %q", header["End"])
+	}
+	size, err := strconv.ParseUint(strings.TrimSpace(header["Size"]), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid size %q", header["Size"])
+	}
+	dataOffset := offset + headerSize
+	if size > uint64(len(data))-dataOffset {
+		return nil, fmt.Errorf("contents out of bounds: %#x+%#x > %#x", dataOffset, size, len(data))
+	}
+
+	rawName := strings.TrimRight(header["Name"], " ")
+	member := &Member{Name: rawName, Offset: offset}
+	block := &contracts.MemoryBlock{Address: uintptr(offset), Size: headerSize + size}
+	headerBlock := addChild(block, "Header", 0, headerSize)
+	nameLink := uint64(0)
+	switch {
+	case strings.HasPrefix(rawName, bsdLongNamePrefix):
+		length, err := strconv.ParseUint(rawName[len(bsdLongNamePrefix):], 10, 64)
+		if err != nil || length > size {
+			return nil, fmt.Errorf("invalid BSD long name %q", rawName)
+		}
+		member.Name = strings.TrimRight(string(data[dataOffset:dataOffset+length]), "\x00")
+		headerBlock.Size += length
+		nameLink = dataOffset
+		dataOffset += length
+		size -= length
+	case rawName == gnuSymbolsName || rawName == gnuSymbols64Name || rawName == gnuLongNamesName:
+	case strings.HasPrefix(rawName, "/"):
+		index, err := strconv.ParseUint(rawName[1:], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid GNU name %q", rawName)
+		}
+		if longNames == nil || index >= uint64(len(longNames.Data)) {
+			return nil, fmt.Errorf("GNU long name %q is out of the long names table", rawName)
+		}
+		name := longNames.Data[index:]
+		if end := bytes.IndexByte(name, '\n'); end >= 0 {
+			name = name[:end]
+		}
+		member.Name = strings.TrimSuffix(string(name), "/")
+		nameLink = longNames.DataOffset + index
+	default:
+		member.Name = strings.TrimSuffix(rawName, "/")
+	}
+	member.DataOffset = dataOffset
+	member.Data = data[dataOffset : dataOffset+size]
+	member.Special = isSpecial(member.Name)
+	block.Name = member.Name
+
+	for i, start := 0, uint64(0); i < len(headerFields); i += 1 {
+		field := headerFields[i]
+		// The fields are padded with spaces
+		value := strings.TrimRight(header[field.name], " ")
+		if field.name == "Date" {
+			addDate(headerBlock, value, start, field.size)
+		} else {
+			addString(headerBlock, field.name, value, start, field.size)
+		}
+		start += field.size
+	}
+	if nameLink != 0 {
+		err = parsingutils.AddLinkWithAddr(headerBlock, "Name", "points to", uintptr(nameLink))
+		if err != nil {
+			return nil, err
+		}
+	}
+	if headerBlock.Size > headerSize {
+		addString(headerBlock, "Long Name", member.Name, headerSize, headerBlock.Size-headerSize)
+	}
+	member.Block = block
+	return member, nil
+}
+
+func isSpecial(name string) bool {
+	switch name {
+	case gnuSymbolsName, gnuSymbols64Name, gnuLongNamesName, bsdSymbolsName, bsdSymbolsName + bsdSortedSuffix, bsdSymbols64Name, bsdSymbols64Name + bsdSortedSuffix:
+		return true
+	}
+	return false
+}
+
+// Dates are seconds since the epoch, deterministic archives use 0
+func addDate(block *contracts.MemoryBlock, raw string, offset, size uint64) {
+	seconds, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil || seconds == 0 {
+		addString(block, "Date", raw, offset, size)
+		return
+	}
+	parsingutils.AddValue(block, "Date", seconds, offset, uint8(size), func(name string, value interface{}) string {
+		return time.Unix(seconds, 0).UTC().Format(time.RFC3339)
+	})
+}
+
+// The GNU long names table is a list of names, each one ending with "/\n"
+func addLongNames(member *Member) {
+	names := addChild(member.Block, "", member.DataOffset-member.Offset, uint64(len(member.Data)))
+	count := 0
+	for start := 0; start < len(member.Data); {
+		end := bytes.Index(member.Data[start:], []byte(gnuLongNamesEnding))
+		size := end + len(gnuLongNamesEnding)
+		if end < 0 {
+			size = len(member.Data) - start
+		}
+		// The table can be padded with newlines
+		if name := strings.TrimRight(string(member.Data[start:start+size]), "/\n"); name != "" {
+			addString(names, fmt.Sprintf("[%d]", count), name, uint64(start), uint64(size))
+			count += 1
+		}
+		start += size
+	}
+	names.Name = fmt.Sprintf("Long Names (%d)", count)
+}
@@ -0,0 +1,103 @@
+package arutils_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/LouisBrunner/mem-viz/pkg/arutils"
+	"github.com/LouisBrunner/mem-viz/pkg/contracts/contractstest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Builds an archive from pairs of raw names and contents, padding members like ar does
+func archive(members ...string) []byte {
+	data := append([]byte{}, arutils.Magic...)
+	for i := 0; i < len(members); i += 2 {
+		data = append(data, fmt.Sprintf("%-16s%-12s%-6s%-6s%-8s%-10d`\n", members[i], "1700000000", "0", "0", "644", len(members[i+1]))...)
+		data = append(data, members[i+1]...)
+		if len(data)%2 != 0 {
+			data = append(data, '\n')
+		}
+	}
+	return data
+}
+
+func Test_Parse(t *testing.T) {
+	longName := "a_very_long_object_name.o"
+	data := archive(
+		"//", longName+"/\n",
+		"short.o/", "abc",
+		"/0", "defg",
+	)
+	ar, warnings, err := arutils.Parse(data)
+	require.NoError(t, err)
+	assert.Empty(t, warnings)
+	assert.Equal(t, `"!<arch>\n"`, contractstest.FindValue(t, ar.Header, "Magic").Value)
+	require.Len(t, ar.Members, 3)
+
+	names := ar.Members[0]
+	assert.True(t, names.Special)
+	require.Len(t, names.Block.Content, 2)
+	table := names.Block.Content[1]
+	assert.Equal(t, "Long Names (1)", table.Name)
+	assert.Equal(t, uintptr(0x44), table.Address)
+	assert.Equal(t, `"a_very_long_object_name.o"`, contractstest.FindValue(t, table, "[0]").Value)
+
+	short := ar.Members[1]
+	assert.False(t, short.Special)
+	assert.Equal(t, "short.o", short.Name)
+	assert.Equal(t, uint64(0x60), short.Offset)
+	assert.Equal(t, uint64(0x9c), short.DataOffset)
+	assert.Equal(t, []byte("abc"), short.Data)
+	assert.Equal(t, uint64(63), short.Block.Size)
+	header := short.Block.Content[0]
+	assert.Equal(t, "Header", header.Name)
+	assert.Equal(t, `"short.o/"`, contractstest.FindValue(t, header, "Name").Value)
+	assert.Equal(t, "2023-11-14T22:13:20Z", contractstest.FindValue(t, header, "Date").Value)
+	assert.Equal(t, `"644"`, contractstest.FindValue(t, header, "Mode").Value)
+	assert.Equal(t, `"3"`, contractstest.FindValue(t, header, "Size").Value)
+
+	// Follows the padding of the previous member
+	long := ar.Members[2]
+	assert.Equal(t, longName, long.Name)
+	assert.Equal(t, uint64(0xa0), long.Offset)
+	assert.Equal(t, []byte("defg"), long.Data)
+	name := contractstest.FindValue(t, long.Block.Content[0], "Name")
+	require.Len(t, name.Links, 1)
+	assert.Equal(t, uint64(0x44), name.Links[0].TargetAddress)
+}
+
+func Test_Parse_BSDLongName(t *testing.T) {
+	longName := "a_very_long_object_name.o"
+	ar, _, err := arutils.Parse(archive("#1/28", longName+"\x00\x00\x00contents"))
+	require.NoError(t, err)
+	require.Len(t, ar.Members, 1)
+
+	member := ar.Members[0]
+	assert.Equal(t, longName, member.Name)
+	assert.Equal(t, uint64(0x8+0x3c+28), member.DataOffset)
+	assert.Equal(t, []byte("contents"), member.Data)
+	header := member.Block.Content[0]
+	assert.Equal(t, uint64(0x3c+28), header.Size)
+	assert.Equal(t, `"a_very_long_object_name.o"`, contractstest.FindValue(t, header, "Long Name").Value)
+	assert.Equal(t, uint64(0x44), contractstest.FindValue(t, header, "Name").Links[0].TargetAddress)
+}
+
+func Test_Parse_Invalid(t *testing.T) {
+	cases := map[string][]byte{
+		"magic":      []byte("\x7fELF"),
+		"thin":       arutils.ThinMagic,
+		"truncated":  archive("a.o/", "abc")[:0x20],
+		"terminator": append(archive("a.o/", "abc")[:0x42], "xx"...),
+		"size":       archive("a.o/", "abc")[:0x45],
+		"long name":  archive("/0", "abc"),
+		"bsd name":   archive("#1/10", "abc"),
+	}
+	for name, data := range cases {
+		t.Run(name, func(t *testing.T) {
+			_, _, err := arutils.Parse(data)
+			assert.Error(t, err)
+		})
+	}
+}
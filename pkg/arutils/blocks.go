@@ -0,0 +1,41 @@
+package arutils
+
+import (
+	"fmt"
+
+	"github.com/LouisBrunner/mem-viz/pkg/contracts"
+	"github.com/LouisBrunner/mem-viz/pkg/parsingutils"
+)
+
+func addChild(parent *contracts.MemoryBlock, name string, offset, size uint64) *contracts.MemoryBlock {
+	child := &contracts.MemoryBlock{
+		Name:         name,
+		Address:      parent.Address + uintptr(offset),
+		Size:         size,
+		ParentOffset: offset,
+	}
+	parent.Content = append(parent.Content, child)
+	return child
+}
+
+// Values can't be bigger than 255 bytes, longer strings (e.g. names) are cut short
+func valueSize(size uint64) uint8 {
+	return uint8(min(size, 0xff))
+}
+
+func addString(block *contracts.MemoryBlock, name, value string, offset, size uint64) {
+	parsingutils.AddValue(block, name, value, offset, valueSize(size), func(name string, value interface{}) string {
+		return fmt.Sprintf("%q", value)
+	})
+}
+
+func addInteger(block *contracts.MemoryBlock, name string, value uint64, offset, size uint64) {
+	parsingutils.AddValue(block, name, value, offset, valueSize(size), parsingutils.FormatValue)
+}
+
+// Integers which refer to something else (e.g. a member) show what it is
+func addReference(block *contracts.MemoryBlock, name string, value uint64, target string, offset, size uint64) {
+	parsingutils.AddValue(block, name, value, offset, valueSize(size), func(name string, value interface{}) string {
+		return fmt.Sprintf("%#x (%s)", value, target)
+	})
+}
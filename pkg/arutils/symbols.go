@@ -0,0 +1,141 @@
+package arutils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/LouisBrunner/mem-viz/pkg/contracts"
+	"github.com/LouisBrunner/mem-viz/pkg/parsingutils"
+)
+
+// Symbol tables point to the header of the member defining each symbol, so the linker only extracts the members it
+// needs. GNU tables are always big-endian while BSD ones (ranlib) use the byte order of the objects
+
+func (me *Archive) memberAt(offset uint64) (*Member, error) {
+	for _, member := range me.Members {
+		if member.Offset == offset {
+			return member, nil
+		}
+	}
+	return nil, fmt.Errorf("no member at %#x", offset)
+}
+
+func readWord(order binary.ByteOrder, data []byte, offset, size uint64) uint64 {
+	if size == 8 {
+		return order.Uint64(data[offset:])
+	}
+	return uint64(order.Uint32(data[offset:]))
+}
+
+func (me *Archive) addSymbol(table *contracts.MemoryBlock, name, value string, memberOffset uint64, offset, size uint64) error {
+	member, err := me.memberAt(memberOffset)
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	addReference(table, value, memberOffset, member.Name, offset, size)
+	me.Symbols = append(me.Symbols, Symbol{Name: name, Member: member})
+	return parsingutils.AddLinkWithBlock(table, value, member.Block, "points to")
+}
+
+// Names are NUL-terminated strings, the table can be padded with more NULs
+func addNames(block *contracts.MemoryBlock, data []byte) []uint64 {
+	starts := []uint64{}
+	for start := uint64(0); start < uint64(len(data)); {
+		end := bytes.IndexByte(data[start:], 0)
+		size := uint64(end) + 1
+		if end < 0 {
+			size = uint64(len(data)) - start
+		}
+		if end != 0 {
+			addString(block, fmt.Sprintf("[%d]", len(starts)), string(data[start:start+size-1]), start, size)
+			starts = append(starts, start)
+		}
+		start += size
+	}
+	return starts
+}
+
+// The GNU table ("/" or "/SYM64/" with 64-bit offsets) is a count, an offset per symbol and then their names in the
+// same order
+func (me *Archive) decodeGNUSymbols(member *Member, word uint64) error {
+	data := member.Data
+	if uint64(len(data)) < word {
+		return fmt.Errorf("too small for its count")
+	}
+	count := readWord(binary.BigEndian, data, 0, word)
+	namesOffset := word * (count + 1)
+	if count >= uint64(len(data))/word || namesOffset > uint64(len(data)) {
+		return fmt.Errorf("%d symbols don't fit in %#x bytes", count, len(data))
+	}
+	table := addChild(member.Block, fmt.Sprintf("Symbol Table (%d)", count), member.DataOffset-member.Offset, uint64(len(data)))
+	addInteger(table, "Count", count, 0, word)
+	names := addChild(table, "Names", namesOffset, uint64(len(data))-namesOffset)
+	starts := addNames(names, data[namesOffset:])
+	if uint64(len(starts)) < count {
+		return fmt.Errorf("only %d names for %d symbols", len(starts), count)
+	}
+	for i := uint64(0); i < count; i += 1 {
+		name, _, _ := bytes.Cut(data[namesOffset+starts[i]:], []byte{0})
+		err := me.addSymbol(table, string(name), fmt.Sprintf("[%d] %s", i, name), readWord(binary.BigEndian, data, word*(i+1), word), word*(i+1), word)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// The BSD table ("__.SYMDEF" or "__.SYMDEF_64", sorted by name or not) is the size of the ranlib entries, the entries
+// (an offset into the strings and one to the member), the size of the strings and the strings
+func (me *Archive) decodeBSDSymbols(member *Member, word uint64) error {
+	data := member.Data
+	order, err := bsdByteOrder(data, word)
+	if err != nil {
+		return err
+	}
+	entriesSize := readWord(order, data, 0, word)
+	stringsSizeOffset := word + entriesSize
+	stringsOffset := stringsSizeOffset + word
+	rawStringsSize := readWord(order, data, stringsSizeOffset, word)
+	stringsSize := min(rawStringsSize, uint64(len(data))-stringsOffset)
+	count := entriesSize / (2 * word)
+
+	table := addChild(member.Block, fmt.Sprintf("Symbol Table (%d)", count), member.DataOffset-member.Offset, uint64(len(data)))
+	addInteger(table, "Size", entriesSize, 0, word)
+	strings := data[stringsOffset : stringsOffset+stringsSize]
+	for i := uint64(0); i < count; i += 1 {
+		offset := word + i*2*word
+		strx := readWord(order, data, offset, word)
+		if strx >= stringsSize {
+			return fmt.Errorf("name of symbol %d is out of bounds: %#x >= %#x", i, strx, stringsSize)
+		}
+		name, _, _ := bytes.Cut(strings[strx:], []byte{0})
+		strxName := fmt.Sprintf("[%d].ran_strx", i)
+		addReference(table, strxName, strx, string(name), offset, word)
+		err := parsingutils.AddLinkWithAddr(table, strxName, "points to", table.Address+uintptr(stringsOffset+strx))
+		if err != nil {
+			return err
+		}
+		err = me.addSymbol(table, string(name), fmt.Sprintf("[%d].ran_off", i), readWord(order, data, offset+word, word), offset+word, word)
+		if err != nil {
+			return err
+		}
+	}
+	addInteger(table, "Strings Size", rawStringsSize, stringsSizeOffset, word)
+	addNames(addChild(table, "Strings", stringsOffset, stringsSize), strings)
+	return nil
+}
+
+// Whether the sizes make sense in either byte order
+func bsdByteOrder(data []byte, word uint64) (binary.ByteOrder, error) {
+	for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		if uint64(len(data)) < 2*word {
+			break
+		}
+		entriesSize := readWord(order, data, 0, word)
+		if entriesSize%(2*word) == 0 && entriesSize <= uint64(len(data))-2*word {
+			return order, nil
+		}
+	}
+	return nil, fmt.Errorf("invalid ranlib size")
+}
@@ -0,0 +1,83 @@
+package arutils_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/LouisBrunner/mem-viz/pkg/arutils"
+	"github.com/LouisBrunner/mem-viz/pkg/contracts/contractstest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func pack(t *testing.T, order binary.ByteOrder, values ...any) string {
+	buf := &bytes.Buffer{}
+	for _, value := range values {
+		require.NoError(t, binary.Write(buf, order, value))
+	}
+	return buf.String()
+}
+
+func Test_Parse_GNUSymbols(t *testing.T) {
+	// The symbol table is 0x3c+0x14 bytes, so the members are at 0x58 and 0x98
+	symbols := pack(t, binary.BigEndian, uint32(2), uint32(0x58), uint32(0x98)) + "foo\x00bar\x00"
+	ar, warnings, err := arutils.Parse(archive("/", symbols, "foo.o/", "foo", "bar.o/", "bar"))
+	require.NoError(t, err)
+	assert.Empty(t, warnings)
+	require.Len(t, ar.Members, 3)
+	require.Equal(t, []arutils.Symbol{{Name: "foo", Member: ar.Members[1]}, {Name: "bar", Member: ar.Members[2]}}, ar.Symbols)
+
+	table := ar.Members[0].Block.Content[1]
+	assert.Equal(t, "Symbol Table (2)", table.Name)
+	assert.Equal(t, "0x2", contractstest.FindValue(t, table, "Count").Value)
+	bar := contractstest.FindValue(t, table, "[1] bar")
+	assert.Equal(t, "0x98 (bar.o)", bar.Value)
+	assert.Equal(t, uint64(0x8), bar.Offset)
+	require.Len(t, bar.Links, 1)
+	assert.Equal(t, uint64(0x98), bar.Links[0].TargetAddress)
+	names := table.Content[0]
+	assert.Equal(t, uintptr(0x44+0xc), names.Address)
+	assert.Equal(t, `"bar"`, contractstest.FindValue(t, names, "[1]").Value)
+}
+
+func Test_Parse_BSDSymbols(t *testing.T) {
+	for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		t.Run(order.String(), func(t *testing.T) {
+			// The symbol table is 0x3c+0x14+0x20 bytes, so the member is at 0x78
+			symbols := pack(t, order, uint32(16), uint32(0), uint32(0x78), uint32(5), uint32(0x78), uint32(8)) + "_foo\x00_b\x00"
+			ar, warnings, err := arutils.Parse(archive("#1/20", "__.SYMDEF SORTED\x00\x00\x00\x00"+symbols, "foo.o/", "foo"))
+			require.NoError(t, err)
+			assert.Empty(t, warnings)
+			require.Len(t, ar.Members, 2)
+			assert.True(t, ar.Members[0].Special)
+			assert.Equal(t, []arutils.Symbol{{Name: "_foo", Member: ar.Members[1]}, {Name: "_b", Member: ar.Members[1]}}, ar.Symbols)
+
+			table := ar.Members[0].Block.Content[1]
+			assert.Equal(t, "Symbol Table (2)", table.Name)
+			assert.Equal(t, uintptr(0x58), table.Address)
+			strx := contractstest.FindValue(t, table, "[1].ran_strx")
+			assert.Equal(t, "0x5 (_b)", strx.Value)
+			assert.Equal(t, uint64(0x58+0x18+5), strx.Links[0].TargetAddress)
+			off := contractstest.FindValue(t, table, "[1].ran_off")
+			assert.Equal(t, "0x78 (foo.o)", off.Value)
+			assert.Equal(t, uint64(0x78), off.Links[0].TargetAddress)
+			assert.Equal(t, "0x8", contractstest.FindValue(t, table, "Strings Size").Value)
+		})
+	}
+}
+
+func Test_Parse_InvalidSymbols(t *testing.T) {
+	cases := map[string]string{
+		"/":         pack(t, binary.BigEndian, uint32(1), uint32(0x44)) + "foo\x00",
+		"__.SYMDEF": pack(t, binary.LittleEndian, uint32(12), uint32(0), uint32(0)),
+	}
+	for name, symbols := range cases {
+		t.Run(name, func(t *testing.T) {
+			ar, warnings, err := arutils.Parse(archive(name, symbols))
+			require.NoError(t, err)
+			assert.Len(t, ar.Members, 1)
+			assert.Len(t, warnings, 1)
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package commons
 
 import (
+	"encoding/binary"
 	"io"
 
 	"github.com/lunixbochs/struc"
@@ -9,3 +10,11 @@ import (
 func Unpack(r io.Reader, v interface{}) error {
 	return struc.Unpack(r, v)
 }
+
+// Same as Unpack but overrides the byte order of every field (nil keeps the struct tags)
+func UnpackWithOrder(r io.Reader, v interface{}, order binary.ByteOrder) error {
+	if order == nil {
+		return Unpack(r, v)
+	}
+	return struc.UnpackWithOptions(r, v, &struc.Options{Order: order})
+}
@@ -0,0 +1,30 @@
+package commons_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/LouisBrunner/mem-viz/pkg/commons"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type orderedHeader struct {
+	Magic uint32 `struc:"little"`
+	Count uint16 `struc:"little"`
+}
+
+func Test_UnpackWithOrder(t *testing.T) {
+	raw := []byte{0xfe, 0xed, 0xfa, 0xce, 0x00, 0x02}
+
+	little := orderedHeader{}
+	err := commons.UnpackWithOrder(bytes.NewReader(raw), &little, nil)
+	require.NoError(t, err)
+	assert.Equal(t, orderedHeader{Magic: 0xcefaedfe, Count: 0x200}, little)
+
+	big := orderedHeader{}
+	err = commons.UnpackWithOrder(bytes.NewReader(raw), &big, binary.BigEndian)
+	require.NoError(t, err)
+	assert.Equal(t, orderedHeader{Magic: 0xfeedface, Count: 0x2}, big)
+}
@@ -0,0 +1,32 @@
+package contractstest
+
+import (
+	"testing"
+
+	"github.com/LouisBrunner/mem-viz/pkg/contracts"
+	"github.com/stretchr/testify/require"
+)
+
+// Helpers shared by the tests of the decoders, they fail the test when nothing matches
+
+func FindValue(t testing.TB, block *contracts.MemoryBlock, name string) *contracts.MemoryValue {
+	t.Helper()
+	for _, value := range block.Values {
+		if value.Name == name {
+			return value
+		}
+	}
+	require.Failf(t, "value not found", "%s has no value %s", block.Name, name)
+	return nil
+}
+
+func FindBlock(t testing.TB, blocks []*contracts.MemoryBlock, name string) *contracts.MemoryBlock {
+	t.Helper()
+	for _, block := range blocks {
+		if block.Name == name {
+			return block
+		}
+	}
+	require.Failf(t, "block not found", "no block named %s", name)
+	return nil
+}
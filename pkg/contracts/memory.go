@@ -1,5 +1,11 @@
 package contracts
 
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+)
+
 // Expected guarantiees:
 // - MemoryBlock.Content is ordered by Address (ASC)
 // - MemoryBlock.Values is ordered by Offset (ASC)
@@ -36,7 +42,32 @@ type MemoryValue struct {
 	Offset uint64
 	Size   uint8
 	Value  string
-	Links  []*MemoryLink
+	// Number behind Value when it was rendered semantically (e.g. "14.2.1" or "macOS"), uint64 or int64
+	Raw   interface{} `json:",omitempty"`
+	Links []*MemoryLink
+}
+
+// JSON numbers are float64 by default, which would lose 64-bit values, Raw is read back as uint64 (int64 if negative)
+func (me *MemoryValue) UnmarshalJSON(data []byte) error {
+	type plain MemoryValue
+	value := struct {
+		*plain
+		Raw json.Number `json:",omitempty"`
+	}{plain: (*plain)(me)}
+	err := json.Unmarshal(data, &value)
+	if err != nil {
+		return err
+	}
+	me.Raw = nil
+	if value.Raw == "" {
+		return nil
+	}
+	if strings.HasPrefix(string(value.Raw), "-") {
+		me.Raw, err = strconv.ParseInt(string(value.Raw), 10, 64)
+	} else {
+		me.Raw, err = strconv.ParseUint(string(value.Raw), 10, 64)
+	}
+	return err
 }
 
 type MemoryLink struct {
@@ -672,3 +672,82 @@ type DYLDCachePatchableLocationV3 struct {
 func (me DYLDCachePatchableLocationV3) GetAddend() int64 {
 	return (int64(me.BitField.Addend()) << 52) >> 52
 }
+
+// From Apple's dyld/common/OptimizerSwift.h
+
+type SwiftOptimizationHeader struct {
+	Version                                    uint32            `struc:"little"`
+	Padding                                    uint32            `struc:"little"`
+	TypeConformanceHashTableCacheOffset        RelativeAddress64 `struc:"little"` // offset from the cache header to the type conformance hash table
+	MetadataConformanceHashTableCacheOffset    RelativeAddress64 `struc:"little"` // offset from the cache header to the metadata conformance hash table
+	ForeignTypeConformanceHashTableCacheOffset RelativeAddress64 `struc:"little"` // offset from the cache header to the foreign type conformance hash table
+}
+
+type SwiftOptimizationHeaderV2 struct {
+	SwiftOptimizationHeader
+	PrespecializationDataCacheOffset RelativeAddress64 `struc:"little"` // added in version 2
+}
+
+type SwiftOptimizationHeaderV3 struct {
+	SwiftOptimizationHeaderV2
+	PrespecializedMetadataHashTableCacheOffsets [8]uint64 `struc:"little"` // added in version 3, used for debugging only
+}
+
+// From Apple's dyld/common/SwiftHashTable.h (same layout as objc's perfect hash tables)
+
+type SwiftHashTable struct {
+	Capacity       uint32 `struc:"little"`
+	Occupied       uint32 `struc:"little"`
+	Shift          uint32 `struc:"little"`
+	Mask           uint32 `struc:"little"`
+	SentinelTarget uint32 `struc:"little"`
+	RoundedTabSize uint32 `struc:"little"`
+	Salt           uint64 `struc:"little"`
+	// uint32_t scramble[256];
+	// uint8_t tab[mask+1];           /* always power-of-2, rounded up to roundedTabSize */
+	// uint8_t checkbytes[capacity];  /* check byte for each key */
+	// int32_t offsets[capacity];     /* offsets from &capacity to the targets */
+}
+
+const SWIFT_HASH_TABLE_SCRAMBLE_COUNT = 256
+
+type SwiftHashTableOffset struct {
+	Offset int32 `struc:"little"` // offset from &capacity to the target
+}
+
+type SwiftProtocolConformanceLocation uint64
+
+func (me SwiftProtocolConformanceLocation) NextIsDuplicate() bool {
+	return me&0x1 == 1
+}
+
+func (me SwiftProtocolConformanceLocation) ProtocolConformanceCacheOffset() uint64 {
+	return uint64(me>>1) & 0x7FFFFFFFFFFF
+}
+
+func (me SwiftProtocolConformanceLocation) DylibObjCIndex() uint16 {
+	return uint16(me >> 48)
+}
+
+func (me SwiftProtocolConformanceLocation) String() string {
+	return fmt.Sprintf("{NextIsDuplicate: %t, ProtocolConformanceCacheOffset: %#x, DylibObjCIndex: %d}", me.NextIsDuplicate(), me.ProtocolConformanceCacheOffset(), me.DylibObjCIndex())
+}
+
+type SwiftTypeProtocolConformanceLocation struct {
+	TypeDescriptorCacheOffset uint64                           `struc:"little"`
+	ProtocolCacheOffset       uint64                           `struc:"little"`
+	Location                  SwiftProtocolConformanceLocation `struc:"little"`
+}
+
+type SwiftMetadataProtocolConformanceLocation struct {
+	MetadataCacheOffset uint64                           `struc:"little"`
+	ProtocolCacheOffset uint64                           `struc:"little"`
+	Location            SwiftProtocolConformanceLocation `struc:"little"`
+}
+
+type SwiftForeignTypeProtocolConformanceLocation struct {
+	ForeignDescriptorNameCacheOffset uint64                           `struc:"little"`
+	ForeignDescriptorNameLength      uint64                           `struc:"little"`
+	ProtocolCacheOffset              uint64                           `struc:"little"`
+	Location                         SwiftProtocolConformanceLocation `struc:"little"`
+}
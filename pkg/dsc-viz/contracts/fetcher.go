@@ -10,6 +10,8 @@ type Cache interface {
 	Header() DYLDCacheHeaderV3
 	ReaderAbsolute(abs uint64) io.Reader
 	ReaderAtOffset(off int64) io.Reader
+	// Returns nil if the cache is not backed by a file (e.g. unmapped data like the code signature is not accessible from memory)
+	ReaderAtFileOffset(off int64) io.Reader
 	io.Closer
 	fmt.Stringer
 }
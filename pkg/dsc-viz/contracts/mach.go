@@ -688,45 +688,13 @@ type DylinkerCommand struct {
 // This is the same as a LC_THREAD, except that a stack is automatically
 // created (based on the shell's limit for the stack size).  Command arguments
 // and environment variables are copied onto that stack.
-type ThreadCommandCommon struct {
+type ThreadCommand struct {
 	Cmd     uint32 `struc:"little"` // LC_THREAD or  LC_UNIXTHREAD
 	CmdSize uint32 `struc:"little"` // total size of this command
-}
-
-type ThreadCommandARM64 struct {
-	ThreadCommandCommon
-	X    [29]uint64 `struc:"little"`
-	FP   uint64     `struc:"little"`
-	LR   uint64     `struc:"little"`
-	SP   uint64     `struc:"little"`
-	PC   uint64     `struc:"little"`
-	CPSR uint32     `struc:"little"`
-	PAD  uint32     `struc:"little"`
-}
-
-type ThreadCommandX8664 struct {
-	ThreadCommandCommon
-	RAX    uint64 `struc:"little"`
-	RBX    uint64 `struc:"little"`
-	RCX    uint64 `struc:"little"`
-	RDX    uint64 `struc:"little"`
-	RDI    uint64 `struc:"little"`
-	RSI    uint64 `struc:"little"`
-	RBP    uint64 `struc:"little"`
-	RSP    uint64 `struc:"little"`
-	R8     uint64 `struc:"little"`
-	R9     uint64 `struc:"little"`
-	R10    uint64 `struc:"little"`
-	R11    uint64 `struc:"little"`
-	R12    uint64 `struc:"little"`
-	R13    uint64 `struc:"little"`
-	R14    uint64 `struc:"little"`
-	R15    uint64 `struc:"little"`
-	RIP    uint64 `struc:"little"`
-	RFlags uint64 `struc:"little"`
-	CS     uint64 `struc:"little"`
-	FS     uint64 `struc:"little"`
-	GS     uint64 `struc:"little"`
+	// uint32 flavor                  flavor of thread state
+	// uint32 count                   count of uint32's in thread state
+	// struct XXX_thread_state state  thread state for this flavor
+	// ...
 }
 
 // The routines command contains the address of the dynamic shared library
@@ -775,19 +743,19 @@ type SymtabCommand struct {
 }
 
 type NList struct {
-	NStrx  uint32 `struct:"little"`
-	NType  uint8  `struct:"little"`
-	NSect  uint8  `struct:"little"`
-	NDesc  int16  `struct:"little"`
-	NValue uint32 `struct:"little"`
+	NStrx  uint32 `struc:"little"`
+	NType  uint8  `struc:"little"`
+	NSect  uint8  `struc:"little"`
+	NDesc  int16  `struc:"little"`
+	NValue uint32 `struc:"little"`
 }
 
 type NList64 struct {
-	NStrx  uint32 `struct:"little"`
-	NType  uint8  `struct:"little"`
-	NSect  uint8  `struct:"little"`
-	NDesc  uint16 `struct:"little"`
-	NValue uint64 `struct:"little"`
+	NStrx  uint32 `struc:"little"`
+	NType  uint8  `struc:"little"`
+	NSect  uint8  `struc:"little"`
+	NDesc  uint16 `struc:"little"`
+	NValue uint64 `struc:"little"`
 }
 
 // This is the second set of the symbolic information which is used to support
@@ -1163,17 +1131,21 @@ type BuildToolVersion struct {
 
 // Known values for the platform field above.
 const (
-	PLATFORM_MACOS            = 1
-	PLATFORM_IOS              = 2
-	PLATFORM_TVOS             = 3
-	PLATFORM_WATCHOS          = 4
-	PLATFORM_BRIDGEOS         = 5
-	PLATFORM_MACCATALYST      = 6
-	PLATFORM_IOSSIMULATOR     = 7
-	PLATFORM_TVOSSIMULATOR    = 8
-	PLATFORM_WATCHOSSIMULATOR = 9
-	PLATFORM_DRIVERKIT        = 10
-	PLATFORM_MAX              = PLATFORM_DRIVERKIT
+	PLATFORM_MACOS             = 1
+	PLATFORM_IOS               = 2
+	PLATFORM_TVOS              = 3
+	PLATFORM_WATCHOS           = 4
+	PLATFORM_BRIDGEOS          = 5
+	PLATFORM_MACCATALYST       = 6
+	PLATFORM_IOSSIMULATOR      = 7
+	PLATFORM_TVOSSIMULATOR     = 8
+	PLATFORM_WATCHOSSIMULATOR  = 9
+	PLATFORM_DRIVERKIT         = 10
+	PLATFORM_VISIONOS          = 11
+	PLATFORM_VISIONOSSIMULATOR = 12
+	PLATFORM_FIRMWARE          = 13
+	PLATFORM_SEPOS             = 14
+	PLATFORM_MAX               = PLATFORM_SEPOS
 	// Addition of simulated platform also needs to update proc_is_simulated()
 )
 
@@ -1182,6 +1154,7 @@ const (
 	TOOL_CLANG = 1
 	TOOL_SWIFT = 2
 	TOOL_LD    = 3
+	TOOL_LLD   = 4
 )
 
 // The dyld_info_command contains the file offsets and sizes of
@@ -0,0 +1,199 @@
+package contracts
+
+import "fmt"
+
+// From Apple's `dyld-*/dyld/PrebuiltLoader.h` and `dyld-*/dyld/Loader.h`
+// The layout changes between dyld versions and the version hash isn't documented, so the parser checks that the data
+// following these structures starts where we expect it (i.e. right after them) before trusting their fields
+
+const (
+	PREBUILT_LOADER_SET_MAGIC = 0x73703464 // 'sp4d'
+	LOADER_MAGIC              = 0x6c347964 // 'l4yd'
+)
+
+type PrebuiltLoaderSet struct {
+	Magic                                  uint32 `struc:"little"`
+	VersionHash                            uint32 `struc:"little"`
+	Length                                 uint32 `struc:"little"`
+	LoadersArrayCount                      uint32 `struc:"little"`
+	LoadersArrayOffset                     uint32 `struc:"little"`
+	CachePatchCount                        uint32 `struc:"little"`
+	CachePatchOffset                       uint32 `struc:"little"`
+	DyldCacheUUIDOffset                    uint32 `struc:"little"`
+	MustBeMissingPathsCount                uint32 `struc:"little"`
+	MustBeMissingPathsOffset               uint32 `struc:"little"`
+	ObjcSelectorHashTableOffset            uint32 `struc:"little"`
+	ObjcClassHashTableOffset               uint32 `struc:"little"`
+	ObjcProtocolHashTableOffset            uint32 `struc:"little"`
+	Reserved                               uint32 `struc:"little"`
+	ObjcProtocolClassCacheOffset           uint64 `struc:"little"`
+	SwiftTypeConformanceTableOffset        uint32 `struc:"little"`
+	SwiftMetadataConformanceTableOffset    uint32 `struc:"little"`
+	SwiftForeignTypeConformanceTableOffset uint32 `struc:"little"`
+}
+
+type PrebuiltLoaderOffset struct {
+	Offset uint32 `struc:"little"` // offset of the PrebuiltLoader from the start of the set
+}
+
+type PrebuiltLoaderSetCachePatch struct {
+	CacheDylibIndex    uint32 `struc:"little"`
+	CacheDylibVMOffset uint32 `struc:"little"`
+	PatchTo            uint64 `struc:"little"`
+}
+
+type LoaderBitField uint16
+
+var loaderFlags = []string{
+	"isPrebuilt",
+	"dylibInDyldCache",
+	"hasObjC",
+	"mayHavePlusLoad",
+	"hasReadOnlyData",
+	"neverUnload",
+	"leaveMapped",
+	"hasReadOnlyObjC",
+	"pre2022Binary",
+	"isPremapped",
+	"hasUUIDLoadCommand",
+	"hasWeakDefs",
+	"hasTLVs",
+	"belowLibSystem",
+	"hasFuncVarFixups",
+}
+
+func (me LoaderBitField) String() string {
+	str := "{"
+	for i, name := range loaderFlags {
+		if i > 0 {
+			str += ", "
+		}
+		str += fmt.Sprintf("%s: %t", name, me>>i&0x1 == 1)
+	}
+	return str + "}"
+}
+
+type LoaderRef uint16
+
+func (me LoaderRef) Index() uint16 {
+	return uint16(me & 0x7FFF)
+}
+
+func (me LoaderRef) App() bool {
+	return me>>15&0x1 == 1
+}
+
+func (me LoaderRef) String() string {
+	return fmt.Sprintf("{Index: %d, App: %t}", me.Index(), me.App())
+}
+
+type PrebuiltLoaderDependent struct {
+	Ref LoaderRef `struc:"little"`
+}
+
+type LoaderDependentKind uint8
+
+const (
+	LOADER_DEPENDENT_NORMAL    = 0
+	LOADER_DEPENDENT_WEAK_LINK = 1
+	LOADER_DEPENDENT_REEXPORT  = 2
+	LOADER_DEPENDENT_UPWARD    = 3
+)
+
+func (me LoaderDependentKind) String() string {
+	switch me {
+	case LOADER_DEPENDENT_NORMAL:
+		return "normal"
+	case LOADER_DEPENDENT_WEAK_LINK:
+		return "weak-link"
+	case LOADER_DEPENDENT_REEXPORT:
+		return "reexport"
+	case LOADER_DEPENDENT_UPWARD:
+		return "upward"
+	}
+	return fmt.Sprintf("unknown (%d)", uint8(me))
+}
+
+type PrebuiltLoaderBitField uint16
+
+func (me PrebuiltLoaderBitField) HasInitializers() bool {
+	return me&0x1 == 1
+}
+
+func (me PrebuiltLoaderBitField) IsOverridable() bool {
+	return me>>1&0x1 == 1
+}
+
+func (me PrebuiltLoaderBitField) SupportsCatalyst() bool {
+	return me>>2&0x1 == 1
+}
+
+func (me PrebuiltLoaderBitField) IsCatalystOverride() bool {
+	return me>>3&0x1 == 1
+}
+
+func (me PrebuiltLoaderBitField) RegionsCount() uint16 {
+	return uint16(me >> 4)
+}
+
+func (me PrebuiltLoaderBitField) String() string {
+	return fmt.Sprintf("{HasInitializers: %t, IsOverridable: %t, SupportsCatalyst: %t, IsCatalystOverride: %t, RegionsCount: %d}", me.HasInitializers(), me.IsOverridable(), me.SupportsCatalyst(), me.IsCatalystOverride(), me.RegionsCount())
+}
+
+type PrebuiltLoader struct {
+	// Loader
+	Magic uint32         `struc:"little"`
+	Flags LoaderBitField `struc:"little"`
+	Ref   LoaderRef      `struc:"little"`
+	// PrebuiltLoader
+	PathOffset                     uint16                 `struc:"little"`
+	DependentLoaderRefsArrayOffset uint16                 `struc:"little"`
+	DependentKindArrayOffset       uint16                 `struc:"little"` // zero if all deps normal
+	FixupsLoadCommandOffset        uint16                 `struc:"little"`
+	AltPathOffset                  uint16                 `struc:"little"` // if install_name does not match real path
+	FileValidationOffset           uint16                 `struc:"little"` // zero or offset to FileValidationInfo
+	PrebuiltFlags                  PrebuiltLoaderBitField `struc:"little"`
+	RegionsOffset                  uint16                 `struc:"little"` // offset to Region array
+	DepCount                       uint16                 `struc:"little"`
+	BindTargetRefsOffset           uint16                 `struc:"little"`
+	BindTargetRefsCount            uint32                 `struc:"little"` // bind targets can be large, so it is last
+	ObjcBinaryInfoOffset           uint32                 `struc:"little"` // zero or offset to ObjCBinaryInfo
+	IndexOfTwin                    uint16                 `struc:"little"` // if in dyld cache and part of unzippered twin, then index of the other twin
+	Reserved1                      uint16                 `struc:"little"`
+	ExportsTrieLoaderOffset        uint64                 `struc:"little"`
+	ExportsTrieLoaderSize          uint32                 `struc:"little"`
+	VMSize                         uint32                 `struc:"little"`
+	CodeSignatureFileOffset        uint32                 `struc:"little"`
+	CodeSignatureSize              uint32                 `struc:"little"`
+	PatchTableOffset               uint32                 `struc:"little"`
+	OverrideBindTargetRefsOffset   uint32                 `struc:"little"`
+	OverrideBindTargetRefsCount    uint32                 `struc:"little"`
+}
+
+type PrebuiltLoaderRegionBitField uint64
+
+func (me PrebuiltLoaderRegionBitField) VMOffset() uint64 {
+	return uint64(me) & 0x7FFFFFFFFFFFFFF
+}
+
+func (me PrebuiltLoaderRegionBitField) Perms() int {
+	return int(me>>59) & 0x7
+}
+
+func (me PrebuiltLoaderRegionBitField) IsZeroFill() bool {
+	return me>>62&0x1 == 1
+}
+
+func (me PrebuiltLoaderRegionBitField) ReadOnlyData() bool {
+	return me>>63&0x1 == 1
+}
+
+func (me PrebuiltLoaderRegionBitField) String() string {
+	return fmt.Sprintf("{VMOffset: %#x, Perms: %d, IsZeroFill: %t, ReadOnlyData: %t}", me.VMOffset(), me.Perms(), me.IsZeroFill(), me.ReadOnlyData())
+}
+
+type PrebuiltLoaderRegion struct {
+	Info       PrebuiltLoaderRegionBitField `struc:"little"`
+	FileOffset uint32                       `struc:"little"`
+	FileSize   uint32                       `struc:"little"`
+}
@@ -121,6 +121,10 @@ func (me *fetcher[T, F]) ReaderAtOffset(offset int64) io.Reader {
 	return me.main.ReaderAtOffset(offset)
 }
 
+func (me *fetcher[T, F]) ReaderAtFileOffset(offset int64) io.Reader {
+	return me.main.ReaderAtFileOffset(offset)
+}
+
 func (me *fetcher[T, F]) BaseAddress() uintptr {
 	return me.main.BaseAddress()
 }
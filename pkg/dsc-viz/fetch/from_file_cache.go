@@ -26,6 +26,10 @@ func (me *fromFileCache) ReaderAtOffset(off int64) io.Reader {
 	return io.NewSectionReader(me.file, off, math.MaxInt64)
 }
 
+func (me *fromFileCache) ReaderAtFileOffset(off int64) io.Reader {
+	return me.ReaderAtOffset(off)
+}
+
 func (me *fromFileCache) ReaderAbsolute(abs uint64) io.Reader {
 	return me.ReaderAtOffset(int64(abs))
 }
@@ -30,6 +30,10 @@ func (me *fromMemoryCache) ReaderAtOffset(off int64) io.Reader {
 	return &fromMemoryReader{pointer: me.pointer + uintptr(off)}
 }
 
+func (me *fromMemoryCache) ReaderAtFileOffset(off int64) io.Reader {
+	return nil
+}
+
 func (me *fromMemoryCache) ReaderAbsolute(abs uint64) io.Reader {
 	return &fromMemoryReader{pointer: uintptr(abs)}
 }
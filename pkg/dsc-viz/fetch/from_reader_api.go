@@ -0,0 +1,19 @@
+package fetch
+
+import (
+	"io"
+
+	"github.com/LouisBrunner/mem-viz/pkg/dsc-viz/contracts"
+	"github.com/sirupsen/logrus"
+)
+
+// Loads a cache mapped at the given address of another address space (e.g. the memory saved in a core file),
+// mem must be readable at any address of that space
+func FromReader(logger *logrus.Logger, mem io.ReaderAt, address uintptr) (contracts.Fetcher, error) {
+	cache, err := cacheFromReader(logger, mem, address)
+	if err != nil {
+		return nil, err
+	}
+
+	return newFetcher(logger, cache, &fromReaderProcessor{})
+}
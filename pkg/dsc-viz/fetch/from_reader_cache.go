@@ -0,0 +1,77 @@
+package fetch
+
+import (
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/LouisBrunner/mem-viz/pkg/commons"
+	"github.com/LouisBrunner/mem-viz/pkg/dsc-viz/contracts"
+	"github.com/sirupsen/logrus"
+)
+
+type fromReaderCache struct {
+	mem     io.ReaderAt
+	pointer uintptr
+	header  contracts.DYLDCacheHeaderV3
+}
+
+func (me *fromReaderCache) Close() error {
+	return nil
+}
+
+func (me *fromReaderCache) Header() contracts.DYLDCacheHeaderV3 {
+	return me.header
+}
+
+func (me *fromReaderCache) BaseAddress() uintptr {
+	return me.pointer
+}
+
+func (me *fromReaderCache) ReaderAtOffset(off int64) io.Reader {
+	return me.ReaderAbsolute(uint64(me.pointer) + uint64(off))
+}
+
+func (me *fromReaderCache) ReaderAtFileOffset(off int64) io.Reader {
+	return nil
+}
+
+func (me *fromReaderCache) ReaderAbsolute(abs uint64) io.Reader {
+	return io.NewSectionReader(me.mem, int64(abs), math.MaxInt64-int64(abs))
+}
+
+func (me *fromReaderCache) String() string {
+	return fmt.Sprintf("Reader{pointer: %#x, header: %+v}", me.pointer, me.header)
+}
+
+func cacheFromReader(logger *logrus.Logger, mem io.ReaderAt, pointer uintptr) (_ *fromReaderCache, ferr error) {
+	logger.Debugf("reader-cache: loading cache from %#x", pointer)
+	defer func() {
+		if ferr != nil {
+			logger.Errorf("reader-cache: failed to load cache from %#x: %v", pointer, ferr)
+		} else {
+			logger.Debugf("reader-cache: loaded cache from %#x", pointer)
+		}
+	}()
+
+	cache := &fromReaderCache{mem: mem, pointer: pointer}
+	err := commons.Unpack(cache.ReaderAtOffset(0), &cache.header)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unpack header: %w", err)
+	}
+	err = checkMagic(cache.header)
+	if err != nil {
+		return nil, err
+	}
+	return cache, nil
+}
+
+type fromReaderProcessor struct{}
+
+func (me fromReaderProcessor) CacheFromEntryV2(logger *logrus.Logger, main *fromReaderCache, _i int64, entry contracts.DYLDSubcacheEntryV2) (contracts.Cache, error) {
+	return cacheFromReader(logger, main.mem, main.pointer+uintptr(entry.CacheVmOffset))
+}
+
+func (me fromReaderProcessor) CacheFromEntryV1(logger *logrus.Logger, main *fromReaderCache, _i int64, entry contracts.DYLDSubcacheEntryV1) (contracts.Cache, error) {
+	return cacheFromReader(logger, main.mem, main.pointer+uintptr(entry.CacheVmOffset))
+}
@@ -44,7 +44,7 @@ func (me *parser) createStructBlock(parent *contracts.MemoryBlock, data any, lab
 		if fieldType.Kind() == reflect.Struct && field.Anonymous {
 			continue
 		}
-		addValue(block, field.Name, val.FieldByIndex(field.Index).Interface(), uint64(field.Offset), uint8(fieldType.Size()))
+		addStructValue(block, typ, field, val.FieldByIndex(field.Index).Interface(), uint64(field.Offset), uint8(fieldType.Size()))
 	}
 
 	return block, nil
@@ -0,0 +1,44 @@
+package parse
+
+import (
+	"fmt"
+
+	subcontracts "github.com/LouisBrunner/mem-viz/pkg/dsc-viz/contracts"
+	"github.com/LouisBrunner/mem-viz/pkg/machoutils"
+	"github.com/LouisBrunner/mem-viz/pkg/parsingutils"
+)
+
+func cacheTypeName(cacheType uint64) string {
+	switch cacheType {
+	case subcontracts.DYLD_SHARED_CACHE_TYPE_DEVELOPMENT:
+		return "development"
+	case subcontracts.DYLD_SHARED_CACHE_TYPE_PRODUCTION:
+		return "production"
+	case subcontracts.DYLD_SHARED_CACHE_TYPE_UNIVERSAL:
+		return "universal"
+	}
+	return fmt.Sprintf("Unknown %d", cacheType)
+}
+
+func init() {
+	cacheTypeFormat := parsingutils.IntegerFormat(cacheTypeName)
+	for _, header := range []interface{}{subcontracts.DYLDCacheHeaderV1{}, subcontracts.DYLDCacheHeaderV2{}} {
+		parsingutils.RegisterFieldFormat(header, "CacheType", cacheTypeFormat)
+		parsingutils.RegisterFieldFormat(header, "Platform", machoutils.PlatformFormat)
+	}
+	parsingutils.RegisterFieldFormat(subcontracts.DYLDCacheHeaderV2{}, "OsVersion", machoutils.VersionFormat)
+	parsingutils.RegisterFieldFormat(subcontracts.DYLDCacheHeaderV2{}, "AltPlatform", machoutils.PlatformFormat)
+	parsingutils.RegisterFieldFormat(subcontracts.DYLDCacheHeaderV2{}, "AltOsVersion", machoutils.VersionFormat)
+	parsingutils.RegisterFieldFormat(subcontracts.DYLDCacheHeaderV3{}, "CacheSubType", cacheTypeFormat)
+
+	parsingutils.RegisterFieldFormat(subcontracts.DYLIB{}, "CurrentVersion", machoutils.VersionFormat)
+	parsingutils.RegisterFieldFormat(subcontracts.DYLIB{}, "CompatibilityVersion", machoutils.VersionFormat)
+	parsingutils.RegisterFieldFormat(subcontracts.VersionMinCommand{}, "Version", machoutils.VersionFormat)
+	parsingutils.RegisterFieldFormat(subcontracts.VersionMinCommand{}, "SDK", machoutils.VersionFormat)
+	parsingutils.RegisterFieldFormat(subcontracts.BuildVersionCommand{}, "Platform", machoutils.PlatformFormat)
+	parsingutils.RegisterFieldFormat(subcontracts.BuildVersionCommand{}, "MinOS", machoutils.VersionFormat)
+	parsingutils.RegisterFieldFormat(subcontracts.BuildVersionCommand{}, "SDK", machoutils.VersionFormat)
+	parsingutils.RegisterFieldFormat(subcontracts.BuildToolVersion{}, "Tool", machoutils.ToolFormat)
+	parsingutils.RegisterFieldFormat(subcontracts.BuildToolVersion{}, "Version", machoutils.VersionFormat)
+	parsingutils.RegisterFieldFormat(subcontracts.SourceVersionCommand{}, "Version", machoutils.SourceVersionFormat)
+}
@@ -47,25 +47,10 @@ func (me *parser) addCache(parent *contracts.MemoryBlock, cache subcontracts.Cac
 			return nil, nil, err
 		}
 	}
-	// TODO: somehow conflicts with LINKEDIT?
-	// sigBlock, err := me.createBlobBlock(frame, "CodeSignatureOffset", header.CodeSignatureOffset, "CodeSignatureSize", header.CodeSignatureSize, "Code Signature")
-	// if err != nil {
-	// 	return nil, nil, err
-	// }
-	// // // FIXME: might be worth refactoring this in something nicer
-	// if sigBlock != nil {
-	// 	const sigMagic = 0xfade0cc0
-	// 	abc := struct {
-	// 		Magic uint32
-	// 	}{}
-	// 	err := commons.Unpack(header.CodeSignatureOffset.AddBase(uintptr(frame.offsetFromStart+frame.parentStruct.ParentOffset)).GetReader(frame.cache, 0, me.slide), &abc)
-	// 	if err != nil {
-	// 		return nil, nil, err
-	// 	}
-	// 	if abc.Magic == sigMagic {
-	// 		return nil, nil, fmt.Errorf("code signature is invalid (magic %#x vs %#x)", abc.Magic, sigMagic)
-	// 	}
-	// }
+	err = me.parseCodeSignature(frame, mappings, header)
+	if err != nil {
+		return nil, nil, err
+	}
 	if okV1 {
 		// FIXME: should use DYLDCacheSlideInfo1,2,3 but don't have a V1 cache
 		// https://github.com/apple-oss-distributions/dyld/blob/c8a445f88f9fc1713db34674e79b00e30723e79d/dyld/SharedCacheRuntime.cpp#L654
@@ -138,7 +123,7 @@ func (me *parser) addCache(parent *contracts.MemoryBlock, cache subcontracts.Cac
 	if err != nil {
 		return nil, nil, err
 	}
-	_, err = me.createBlobBlock(frame, "DylibsTrieAddr", header.DylibsTrieAddr, "DylibsTrieSize", header.DylibsTrieSize, "Dylibs ImageArrays (Trie)")
+	dylibsTrie, err := me.parseTrie(frame, "DylibsTrieAddr", header.DylibsTrieAddr, "DylibsTrieSize", header.DylibsTrieSize, "Dylibs (Trie)")
 	if err != nil {
 		return nil, nil, err
 	}
@@ -146,7 +131,8 @@ func (me *parser) addCache(parent *contracts.MemoryBlock, cache subcontracts.Cac
 	if err != nil {
 		return nil, nil, err
 	}
-	_, err = me.createBlobBlock(frame, "OtherTrieAddr", header.OtherTrieAddr, "OtherTrieSize", header.OtherTrieSize, "Other ImageArrays (Trie)")
+	// FIXME: those point inside the Other ImageArrays which we don't parse
+	_, err = me.parseTrie(frame, "OtherTrieAddr", header.OtherTrieAddr, "OtherTrieSize", header.OtherTrieSize, "Other ImageArrays (Trie)")
 	if err != nil {
 		return nil, nil, err
 	}
@@ -161,19 +147,11 @@ func (me *parser) addCache(parent *contracts.MemoryBlock, cache subcontracts.Cac
 	if err != nil {
 		return nil, nil, err
 	}
-	err = me.addLinkWithOffset(frame, "DylibsPblSetAddr", header.DylibsPblSetAddr, "points to")
-	if err != nil {
-		return nil, nil, err
-	}
-	_, err = me.createBlobBlock(frame, "ProgramsPblSetPoolAddr", header.ProgramsPblSetPoolAddr, "ProgramsPblSetPoolSize", header.ProgramsPblSetPoolSize, "PrebuiltLoaderSet for each program")
-	if err != nil {
-		return nil, nil, err
-	}
-	_, err = me.createBlobBlock(frame, "ProgramTrieAddr", header.ProgramTrieAddr, "ProgramTrieSize", uint64(header.ProgramTrieSize), "PrebuiltLoaderSet for each program (Trie)")
+	err = me.parsePrebuiltLoaders(frame, header, dylibsTrie)
 	if err != nil {
 		return nil, nil, err
 	}
-	_, err = me.createBlobBlock(frame, "SwiftOptsOffset", header.SwiftOptsOffset, "SwiftOptsSize", header.SwiftOptsSize, "Swift Optimizations Header")
+	err = me.parseSwiftOpts(frame, header)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -0,0 +1,68 @@
+package parse
+
+import (
+	"fmt"
+	"io"
+
+	subcontracts "github.com/LouisBrunner/mem-viz/pkg/dsc-viz/contracts"
+	"github.com/LouisBrunner/mem-viz/pkg/machoutils"
+)
+
+func (me *parser) parseCodeSignature(frame *blockFrame, mappings []arrayElement, header subcontracts.DYLDCacheHeaderV3) error {
+	if header.CodeSignatureOffset.Invalid() || header.CodeSignatureSize == 0 {
+		return nil
+	}
+
+	// The code signature is a file offset and is never mapped, using it as a VM offset makes it overlap with __LINKEDIT,
+	// instead we place it where it would be if the mapping containing (or preceding) it was extended
+	address, err := fileOffsetToAddress(mappings, uint64(header.CodeSignatureOffset))
+	if err != nil {
+		return err
+	}
+	block, err := me.createBlobBlock(frame, "CodeSignatureOffset", address, "CodeSignatureSize", header.CodeSignatureSize, "Code Signature")
+	if err != nil {
+		return err
+	}
+	if block == nil {
+		return nil
+	}
+
+	reader := frame.cache.ReaderAtFileOffset(int64(header.CodeSignatureOffset))
+	if reader == nil {
+		me.logger.Debugf("code signature is only available from a file, skipping its content")
+		return nil
+	}
+	data := make([]byte, header.CodeSignatureSize)
+	_, err = io.ReadFull(reader, data)
+	if err != nil {
+		return fmt.Errorf("failed to read code signature: %w", err)
+	}
+	signature, err := machoutils.ParseCodeSignature(data, block.Address, machoutils.CodeSignatureOptions{
+		TooBig: me.thresholdsArrayTooBig,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to parse code signature: %w", err)
+	}
+	me.addChildFast(signature)
+	return nil
+}
+
+func fileOffsetToAddress(mappings []arrayElement, offset uint64) (subcontracts.UnslidAddress, error) {
+	var closest *subcontracts.DYLDCacheMappingInfo
+	for _, mapping := range mappings {
+		mappingData, cast := mapping.Data.(subcontracts.DYLDCacheMappingInfo)
+		if !cast {
+			return 0, fmt.Errorf("invalid mapping info type: %T", mapping.Data)
+		}
+		if uint64(mappingData.FileOffset) > offset {
+			continue
+		}
+		if closest == nil || mappingData.FileOffset > closest.FileOffset {
+			closest = &mappingData
+		}
+	}
+	if closest == nil {
+		return 0, fmt.Errorf("no mapping found for file offset %#x", offset)
+	}
+	return closest.Address + subcontracts.UnslidAddress(offset-uint64(closest.FileOffset)), nil
+}
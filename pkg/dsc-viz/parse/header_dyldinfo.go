@@ -0,0 +1,36 @@
+package parse
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/LouisBrunner/mem-viz/pkg/contracts"
+	subcontracts "github.com/LouisBrunner/mem-viz/pkg/dsc-viz/contracts"
+	"github.com/LouisBrunner/mem-viz/pkg/machoutils"
+)
+
+func (me *parser) parseDYLDInfoOpcodes(frame *blockFrame, block *contracts.MemoryBlock, stream machoutils.DYLDInfoStream, linkEdit *linkEditData) error {
+	data := make([]byte, block.Size)
+	address := subcontracts.UnslidAddress(uint64(block.Address) - me.slide)
+	_, err := io.ReadFull(address.GetReader(frame.cache, 0, me.slide), data)
+	if err != nil {
+		return fmt.Errorf("failed to read %s opcodes: %w", stream, err)
+	}
+	pointerSize := uint64(4)
+	if linkEdit.is64 {
+		pointerSize = 8
+	}
+	opcodes, err := machoutils.ParseDYLDInfoOpcodes(stream, data, block.Address, machoutils.DYLDInfoOptions{
+		Segments:    linkEdit.segments,
+		PointerSize: pointerSize,
+		Resolve: func(vmAddr uint64) (uintptr, bool) {
+			return subcontracts.UnslidAddress(vmAddr).Calculate(me.slide), true
+		},
+		TooBig: me.thresholdsArrayTooBig,
+	})
+	if err != nil {
+		return err
+	}
+	me.addChildFast(opcodes)
+	return nil
+}
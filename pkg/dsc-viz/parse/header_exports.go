@@ -0,0 +1,31 @@
+package parse
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/LouisBrunner/mem-viz/pkg/contracts"
+	subcontracts "github.com/LouisBrunner/mem-viz/pkg/dsc-viz/contracts"
+	"github.com/LouisBrunner/mem-viz/pkg/machoutils"
+)
+
+func (me *parser) parseExportTrie(frame *blockFrame, block *contracts.MemoryBlock, header subcontracts.UnslidAddress) error {
+	data := make([]byte, block.Size)
+	address := subcontracts.UnslidAddress(uint64(block.Address) - me.slide)
+	_, err := io.ReadFull(address.GetReader(frame.cache, 0, me.slide), data)
+	if err != nil {
+		return fmt.Errorf("failed to read export trie: %w", err)
+	}
+	trie, err := machoutils.ParseExportTrie(data, block.Address, machoutils.ExportTrieOptions{
+		// Exported addresses are relative to the mach header of the image
+		Resolve: func(offset uint64) (uintptr, bool) {
+			return (header + subcontracts.UnslidAddress(offset)).Calculate(me.slide), true
+		},
+		TooBig: me.thresholdsArrayTooBig,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to parse export trie of %#x: %w", header, err)
+	}
+	me.addChildFast(trie)
+	return nil
+}
@@ -0,0 +1,26 @@
+package parse
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/LouisBrunner/mem-viz/pkg/contracts"
+	subcontracts "github.com/LouisBrunner/mem-viz/pkg/dsc-viz/contracts"
+	"github.com/LouisBrunner/mem-viz/pkg/machoutils"
+)
+
+func (me *parser) parseChainedFixups(frame *blockFrame, block *contracts.MemoryBlock) error {
+	data := make([]byte, block.Size)
+	address := subcontracts.UnslidAddress(uint64(block.Address) - me.slide)
+	_, err := io.ReadFull(address.GetReader(frame.cache, 0, me.slide), data)
+	if err != nil {
+		return fmt.Errorf("failed to read chained fixups: %w", err)
+	}
+	// Fixups have already been applied by the cache builder, so there is no chain to walk
+	fixups, _, err := machoutils.ParseChainedFixups(data, block.Address, machoutils.ChainedFixupsOptions{})
+	if err != nil {
+		return err
+	}
+	me.addChildFast(fixups)
+	return nil
+}
@@ -0,0 +1,58 @@
+package parse
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/LouisBrunner/mem-viz/pkg/contracts"
+	subcontracts "github.com/LouisBrunner/mem-viz/pkg/dsc-viz/contracts"
+	"github.com/LouisBrunner/mem-viz/pkg/machoutils"
+)
+
+func (me *parser) readLESection(frame *blockFrame, block *contracts.MemoryBlock) ([]byte, error) {
+	data := make([]byte, block.Size)
+	address := subcontracts.UnslidAddress(uint64(block.Address) - me.slide)
+	_, err := io.ReadFull(address.GetReader(frame.cache, 0, me.slide), data)
+	return data, err
+}
+
+func (me *parser) parseFunctionStarts(frame *blockFrame, block *contracts.MemoryBlock, header subcontracts.UnslidAddress) error {
+	data, err := me.readLESection(frame, block)
+	if err != nil {
+		return fmt.Errorf("failed to read function starts: %w", err)
+	}
+	// Symbols of cached images are in the shared local symbols, so entries are only named by address
+	starts, _, err := machoutils.ParseFunctionStarts(data, block.Address, machoutils.FunctionStartsOptions{
+		// __TEXT starts with the mach header
+		Base: uint64(header),
+		Resolve: func(vmAddr uint64) (uintptr, bool) {
+			return subcontracts.UnslidAddress(vmAddr).Calculate(me.slide), true
+		},
+		TooBig: me.thresholdsArrayTooBig,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to parse function starts of %#x: %w", header, err)
+	}
+	me.addChildFast(starts)
+	return nil
+}
+
+func (me *parser) parseDataInCode(frame *blockFrame, block *contracts.MemoryBlock, header subcontracts.UnslidAddress) error {
+	data, err := me.readLESection(frame, block)
+	if err != nil {
+		return fmt.Errorf("failed to read data in code: %w", err)
+	}
+	entries, _, err := machoutils.ParseDataInCode(data, block.Address, machoutils.DataInCodeOptions{
+		ByteOrder: me.order,
+		// Offsets are relative to the mach header of the image
+		Resolve: func(offset uint64) (uintptr, bool) {
+			return (header + subcontracts.UnslidAddress(offset)).Calculate(me.slide), true
+		},
+		TooBig: me.thresholdsArrayTooBig,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to parse data in code of %#x: %w", header, err)
+	}
+	me.addChildFast(entries)
+	return nil
+}
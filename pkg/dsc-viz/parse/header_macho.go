@@ -1,32 +1,68 @@
 package parse
 
 import (
+	"encoding/binary"
 	"fmt"
-	"unsafe"
 
 	"github.com/LouisBrunner/mem-viz/pkg/commons"
 	"github.com/LouisBrunner/mem-viz/pkg/contracts"
 	subcontracts "github.com/LouisBrunner/mem-viz/pkg/dsc-viz/contracts"
+	"github.com/LouisBrunner/mem-viz/pkg/machoutils"
 	"github.com/LouisBrunner/mem-viz/pkg/parsingutils"
 )
 
 type linkEditData struct {
 	block   *contracts.MemoryBlock
-	command *subcontracts.SegmentCommand64 // TODO: support 32 bits
+	command *subcontracts.SegmentCommand64 // 32-bit segments are widened
+	is64    bool
+	cpuType uint32
+	// Offsets in some LinkEdit structures (e.g. exports) are relative to the mach header
+	header subcontracts.UnslidAddress
+	// Segments in load command order, as referenced by the DYLD info opcodes
+	segments []machoutils.DYLDInfoSegment
 }
 
 func (me *parser) parseMachO(frame *blockFrame, parent *contracts.MemoryBlock, path string) (*contracts.MemoryBlock, error) {
-	header := subcontracts.MachHeader64{} // TODO: support 32 bits
 	baseAddress := subcontracts.UnslidAddress(parent.Address - uintptr(me.slide))
-	headerBlock, err := me.parseAndAdd(baseAddress.GetReader(frame.cache, 0, me.slide), parent, subcontracts.ManualAddress(0), &header, "Mach-O Header")
+
+	// Both headers share the same prefix, only the 64-bit one has an extra reserved field
+	header := subcontracts.MachHeader{}
+	err := commons.Unpack(baseAddress.GetReader(frame.cache, 0, me.slide), &header)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("failed to unpack Mach-O header: %w", err)
+	}
+	var fullHeader interface{}
+	is64 := false
+	switch header.Magic {
+	case subcontracts.MH_MAGIC:
+		fullHeader = &subcontracts.MachHeader{}
+	case subcontracts.MH_MAGIC_64:
+		fullHeader = &subcontracts.MachHeader64{}
+		is64 = true
+	case subcontracts.MH_CIGAM, subcontracts.MH_CIGAM_64:
+		// Big-endian image (e.g. PowerPC), every structure in it has to be read as such
+		previousOrder := me.order
+		me.order = binary.BigEndian
+		defer func() { me.order = previousOrder }()
+		err = commons.UnpackWithOrder(baseAddress.GetReader(frame.cache, 0, me.slide), &header, me.order)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unpack Mach-O header: %w", err)
+		}
+		fullHeader = &subcontracts.MachHeader{}
+		if header.Magic == subcontracts.MH_MAGIC_64 {
+			fullHeader = &subcontracts.MachHeader64{}
+			is64 = true
+		}
+	default:
+		return nil, fmt.Errorf("invalid magic number %#x (expected %#x, %#x, %#x or %#x)", header.Magic, subcontracts.MH_MAGIC, subcontracts.MH_MAGIC_64, subcontracts.MH_CIGAM, subcontracts.MH_CIGAM_64)
 	}
-	cmdsOffset := uint64(unsafe.Sizeof(header))
 
-	if header.Magic != subcontracts.MH_MAGIC_64 { // TODO: support 32 bits
-		return nil, fmt.Errorf("invalid magic number %#x (expected %#x)", header.Magic, subcontracts.MH_MAGIC_64)
+	headerBlock, err := me.parseAndAdd(baseAddress.GetReader(frame.cache, 0, me.slide), parent, subcontracts.ManualAddress(0), fullHeader, "Mach-O Header")
+	if err != nil {
+		return nil, err
 	}
+	me.images.addImage(path, headerBlock)
+	cmdsOffset := uint64(parsingutils.GetDataValue(fullHeader).Type().Size())
 
 	subFrame := frame.pushFrame(parent, headerBlock)
 	commandsBlock, err := me.createBlobBlock(subFrame, "", baseAddress+subcontracts.UnslidAddress(cmdsOffset), "SizeOfCmds", uint64(header.SizeOfCmds), fmt.Sprintf("Commands (%d)", header.NCmds))
@@ -34,8 +70,8 @@ func (me *parser) parseMachO(frame *blockFrame, parent *contracts.MemoryBlock, p
 		return nil, err
 	}
 
-	var linkEdit linkEditData
-	err = me.forEachMachOLoadCommand(subFrame, header, cmdsOffset, baseAddress, func(i int, address subcontracts.UnslidAddress, baseCommand subcontracts.LoadCommand) error {
+	linkEdit := linkEditData{header: baseAddress, is64: is64, cpuType: uint32(header.CPUType)}
+	err = me.forEachMachOLoadCommand(subFrame, header.NCmds, cmdsOffset, baseAddress, func(i int, address subcontracts.UnslidAddress, baseCommand subcontracts.LoadCommand) error {
 		loadStruct, postParsing, err := me.getMachOLoadCommandParser(subFrame, baseCommand)
 		if err != nil {
 			return err
@@ -73,13 +109,13 @@ func (me *parser) parseMachO(frame *blockFrame, parent *contracts.MemoryBlock, p
 	return headerBlock, nil
 }
 
-func (me *parser) forEachMachOLoadCommand(frame *blockFrame, header subcontracts.MachHeader64, cmdsOffset uint64, baseAddress subcontracts.UnslidAddress, callback func(i int, address subcontracts.UnslidAddress, baseCommand subcontracts.LoadCommand) error) error {
+func (me *parser) forEachMachOLoadCommand(frame *blockFrame, nCmds uint32, cmdsOffset uint64, baseAddress subcontracts.UnslidAddress, callback func(i int, address subcontracts.UnslidAddress, baseCommand subcontracts.LoadCommand) error) error {
 	offset := uint64(0)
-	for i := 0; i < int(header.NCmds); i += 1 {
+	for i := 0; i < int(nCmds); i += 1 {
 		address := baseAddress + subcontracts.UnslidAddress(cmdsOffset+offset)
 
 		baseCommand := subcontracts.LoadCommand{}
-		err := commons.Unpack(address.GetReader(frame.cache, 0, me.slide), &baseCommand)
+		err := commons.UnpackWithOrder(address.GetReader(frame.cache, 0, me.slide), &baseCommand, me.order)
 		if err != nil {
 			return fmt.Errorf("failed to unpack load command %d for %+v: %w", i, frame, err)
 		}
@@ -144,9 +180,10 @@ func (me *parser) getMachOLoadCommandParser(frame *blockFrame, baseCommand subco
 		return block, nil
 	}
 
-	addSegment := func(segment *subcontracts.SegmentCommand64) machOLoadCommandParser {
-		addSegmentHelper := func(frame *blockFrame, _base, after subcontracts.Address, linkEdit *linkEditData, prefix string) (*contracts.MemoryBlock, error) {
-			blob, err := me.createBlobBlock(frame, "VMAddr", segment.VMAddr, "VMSize", segment.VMSize, fmt.Sprintf("%sSegment %s", prefix, commons.FromCString(segment.SegName[:])))
+	addSegment := func(segment *subcontracts.SegmentCommand64, sectionData interface{}) machOLoadCommandParser {
+		addSegmentHelper := func(frame *blockFrame, path string, _base, after subcontracts.Address, linkEdit *linkEditData, prefix string) (*contracts.MemoryBlock, error) {
+			segName := commons.FromCString(segment.SegName[:])
+			blob, err := me.createBlobBlock(frame, "VMAddr", segment.VMAddr, "VMSize", segment.VMSize, fmt.Sprintf("%sSegment %s", prefix, segName))
 			if err != nil {
 				return nil, err
 			}
@@ -161,18 +198,49 @@ func (me *parser) getMachOLoadCommandParser(frame *blockFrame, baseCommand subco
 			// 		return nil, err
 			// 	}
 			// }
-			// TODO: should add the sections too
+			_, sections, err := me.parseAndAddArray(frame, "", after, "NSects", uint64(segment.NSects), sectionData, fmt.Sprintf("%sSections", prefix))
+			if err != nil {
+				return nil, err
+			}
+			for _, section := range sections {
+				var sectName string
+				var sectAddr subcontracts.UnslidAddress
+				var sectSize uint64
+				switch sect := section.Data.(type) {
+				case subcontracts.Section64:
+					sectName = commons.FromCString(sect.SectName[:])
+					sectAddr = subcontracts.UnslidAddress(sect.Addr)
+					sectSize = sect.Size
+				case subcontracts.Section:
+					sectName = commons.FromCString(sect.SectName[:])
+					sectAddr = subcontracts.UnslidAddress(sect.Addr)
+					sectSize = uint64(sect.Size)
+				default:
+					return nil, fmt.Errorf("invalid section type: %T", section.Data)
+				}
+				sectBlock, err := me.createBlobBlock(frame.siblingFrame(section.Block), "Addr", sectAddr, "Size", sectSize, fmt.Sprintf("%sSection %s,%s", prefix, segName, sectName))
+				if err != nil {
+					return nil, err
+				}
+				if sectBlock != nil {
+					me.images.addSection(path, segName, sectName, sectBlock)
+				}
+			}
 			return blob, nil
 		}
 
 		return func(frame *blockFrame, path string, base, after subcontracts.Address, linkEdit *linkEditData) (*contracts.MemoryBlock, error) {
+			linkEdit.segments = append(linkEdit.segments, machoutils.DYLDInfoSegment{
+				Name:    commons.FromCString(segment.SegName[:]),
+				Address: uint64(segment.VMAddr),
+			})
 			if commons.FromCString(segment.SegName[:]) == "__LINKEDIT" {
 				absAddr := segment.VMAddr.AddBase(frame.parent.Address).Calculate(me.slide)
 
 				block, err := me.findOrCreateUniqueBlock(categoryLinkEdit, func(_i int, block *contracts.MemoryBlock) bool {
 					return block.Address == absAddr
 				}, func() (*contracts.MemoryBlock, error) {
-					return addSegmentHelper(frame, base, after, linkEdit, "")
+					return addSegmentHelper(frame, path, base, after, linkEdit, "")
 				})
 				if err != nil {
 					return nil, err
@@ -182,7 +250,7 @@ func (me *parser) getMachOLoadCommandParser(frame *blockFrame, baseCommand subco
 				return block, nil
 			}
 
-			return addSegmentHelper(frame, base, after, linkEdit, fmt.Sprintf("%s > ", path))
+			return addSegmentHelper(frame, path, base, after, linkEdit, fmt.Sprintf("%s > ", path))
 		}
 	}
 
@@ -239,14 +307,38 @@ func (me *parser) getMachOLoadCommandParser(frame *blockFrame, baseCommand subco
 		}, extra)
 	}
 
-	addDYLDInfo := func(di *subcontracts.DYLDInfoCommand, extra func(block *contracts.MemoryBlock) error) machOLoadCommandParser {
-		return addLEOffsetFields(subcontracts.LC2String(di.Cmd), map[string]fieldLookup{
-			"Rebase":   {"RebaseOff", di.RebaseOff, "RebaseSize", di.RebaseSize, nil},
-			"Bind":     {"BindOff", di.BindOff, "BindSize", di.BindSize, nil},
-			"WeakBind": {"WeakBindOff", di.WeakBindOff, "WeakBindSize", di.WeakBindSize, nil},
-			"LazyBind": {"LazyBindOff", di.LazyBindOff, "LazyBindSize", di.LazyBindSize, nil},
-			"Export":   {"ExportOff", di.ExportOff, "ExportSize", di.ExportSize, nil},
-		}, extra)
+	parseExports := func(frame *blockFrame, linkEdit *linkEditData) func(block *contracts.MemoryBlock) error {
+		return func(block *contracts.MemoryBlock) error {
+			return me.parseExportTrie(frame, block, linkEdit.header)
+		}
+	}
+
+	addDYLDInfo := func(di *subcontracts.DYLDInfoCommand) machOLoadCommandParser {
+		return func(frame *blockFrame, path string, base, after subcontracts.Address, linkEdit *linkEditData) (*contracts.MemoryBlock, error) {
+			streams := []struct {
+				label  string
+				field  fieldLookup
+				stream machoutils.DYLDInfoStream
+			}{
+				{"Rebase", fieldLookup{"RebaseOff", di.RebaseOff, "RebaseSize", di.RebaseSize, nil}, machoutils.RebaseStream},
+				{"Bind", fieldLookup{"BindOff", di.BindOff, "BindSize", di.BindSize, nil}, machoutils.BindStream},
+				{"WeakBind", fieldLookup{"WeakBindOff", di.WeakBindOff, "WeakBindSize", di.WeakBindSize, nil}, machoutils.WeakBindStream},
+				{"LazyBind", fieldLookup{"LazyBindOff", di.LazyBindOff, "LazyBindSize", di.LazyBindSize, nil}, machoutils.LazyBindStream},
+			}
+			for _, stream := range streams {
+				_, err := addLEOffsetFields(subcontracts.LC2String(di.Cmd), map[string]fieldLookup{
+					stream.label: stream.field,
+				}, func(block *contracts.MemoryBlock) error {
+					return me.parseDYLDInfoOpcodes(frame, block, stream.stream, linkEdit)
+				})(frame, path, base, after, linkEdit)
+				if err != nil {
+					return nil, err
+				}
+			}
+			return addLEOffsetFields(subcontracts.LC2String(di.Cmd), map[string]fieldLookup{
+				"Export": {"ExportOff", di.ExportOff, "ExportSize", di.ExportSize, nil},
+			}, parseExports(frame, linkEdit))(frame, path, base, after, linkEdit)
+		}
 	}
 
 	// FIXME: untestable
@@ -286,14 +378,18 @@ func (me *parser) getMachOLoadCommandParser(frame *blockFrame, baseCommand subco
 				InitProt: realCommand.InitProt,
 				NSects:   realCommand.NSects,
 				Flags:    realCommand.Flags,
-			})(frame, path, base, after, linkEdit)
+			}, &subcontracts.Section{})(frame, path, base, after, linkEdit)
 		}
 	case subcontracts.LC_SYMTAB:
 		realCommand := subcontracts.SymtabCommand{}
 		subCommand = &realCommand
 		postParsing = func(frame *blockFrame, path string, base, after subcontracts.Address, linkEdit *linkEditData) (*contracts.MemoryBlock, error) {
+			var nlist interface{} = &subcontracts.NList{}
+			if linkEdit.is64 {
+				nlist = &subcontracts.NList64{}
+			}
 			block, err := addLEOffsetFields("SYMTAB", map[string]fieldLookup{
-				"Symbols": {"SymOff", realCommand.SymOff, "NSyms", realCommand.NSyms, &subcontracts.NList64{}}, // TODO: wrong size on 32bit
+				"Symbols": {"SymOff", realCommand.SymOff, "NSyms", realCommand.NSyms, nlist},
 			}, nil)(frame, path, base, after, linkEdit)
 			if err != nil {
 				return nil, err
@@ -316,19 +412,10 @@ func (me *parser) getMachOLoadCommandParser(frame *blockFrame, baseCommand subco
 	case subcontracts.LC_THREAD:
 		fallthrough
 	case subcontracts.LC_UNIXTHREAD:
-		header := frame.cache.Header()
-		magic := commons.FromCString(header.Magic[:])
-		switch magic {
-		case subcontracts.MAGIC_arm64e:
-			fallthrough
-		case subcontracts.MAGIC_arm64:
-			subCommand = &subcontracts.ThreadCommandARM64{}
-		case subcontracts.MAGIC_x86_64:
-			fallthrough
-		case subcontracts.MAGIC_x86_64_HASWELL:
-			subCommand = &subcontracts.ThreadCommandX8664{}
-		default:
-			return nil, nil, fmt.Errorf("unsupported architecture: %s", magic) // TODO: support more
+		realCommand := subcontracts.ThreadCommand{}
+		subCommand = &realCommand
+		postParsing = func(frame *blockFrame, path string, base, after subcontracts.Address, linkEdit *linkEditData) (*contracts.MemoryBlock, error) {
+			return nil, me.parseThreadStates(frame, after, uint64(realCommand.CmdSize)-uint64(frame.parentStruct.Size), linkEdit)
 		}
 	case subcontracts.LC_LOADFVMLIB:
 		fallthrough
@@ -419,7 +506,7 @@ func (me *parser) getMachOLoadCommandParser(frame *blockFrame, baseCommand subco
 	case subcontracts.LC_SEGMENT_64:
 		realCommand := subcontracts.SegmentCommand64{}
 		subCommand = &realCommand
-		postParsing = addSegment(&realCommand)
+		postParsing = addSegment(&realCommand, &subcontracts.Section64{})
 	case subcontracts.LC_ROUTINES_64:
 		realCommand := subcontracts.RoutinesCommand64{}
 		subCommand = &realCommand
@@ -435,8 +522,6 @@ func (me *parser) getMachOLoadCommandParser(frame *blockFrame, baseCommand subco
 		fallthrough
 	case subcontracts.LC_SEGMENT_SPLIT_INFO:
 		fallthrough
-	case subcontracts.LC_DYLD_CHAINED_FIXUPS:
-		fallthrough
 	case subcontracts.LC_LINKER_OPTIMIZATION_HINT:
 		fallthrough
 	case subcontracts.LC_DYLIB_CODE_SIGN_DRS:
@@ -450,11 +535,11 @@ func (me *parser) getMachOLoadCommandParser(frame *blockFrame, baseCommand subco
 	case subcontracts.LC_DYLD_INFO:
 		realCommand := subcontracts.DYLDInfoCommand{}
 		subCommand = &realCommand
-		postParsing = addDYLDInfo(&realCommand, nil) // TODO: would be nice to have deeper parsing of the content
+		postParsing = addDYLDInfo(&realCommand)
 	case subcontracts.LC_DYLD_INFO_ONLY:
 		realCommand := subcontracts.DYLDInfoCommand{}
 		subCommand = &realCommand
-		postParsing = addDYLDInfo(&realCommand, nil) // TODO: would be nice to have deeper parsing of the content
+		postParsing = addDYLDInfo(&realCommand)
 	case subcontracts.LC_VERSION_MIN_MACOSX:
 		fallthrough
 	case subcontracts.LC_VERSION_MIN_IPHONEOS:
@@ -467,15 +552,27 @@ func (me *parser) getMachOLoadCommandParser(frame *blockFrame, baseCommand subco
 	case subcontracts.LC_FUNCTION_STARTS:
 		realCommand := subcontracts.LinkEditDataCommand{}
 		subCommand = &realCommand
-		postParsing = addLESection(&realCommand, nil) // TODO: would be nice to have deeper parsing of the content
+		postParsing = func(frame *blockFrame, path string, base, after subcontracts.Address, linkEdit *linkEditData) (*contracts.MemoryBlock, error) {
+			return addLESection(&realCommand, func(block *contracts.MemoryBlock) error {
+				return me.parseFunctionStarts(frame, block, linkEdit.header)
+			})(frame, path, base, after, linkEdit)
+		}
 	case subcontracts.LC_MAIN:
 		realCommand := subcontracts.EntryPointCommand{}
 		subCommand = &realCommand
-		postParsing = handleUnused
+		postParsing = func(frame *blockFrame, path string, base, after subcontracts.Address, linkEdit *linkEditData) (*contracts.MemoryBlock, error) {
+			// __TEXT starts with the mach header, so its file offset is relative to it
+			entry := linkEdit.header + subcontracts.UnslidAddress(realCommand.EntryOff)
+			return nil, parsingutils.AddLinkWithAddr(frame.parentStruct, "EntryOff", "starts at", entry.Calculate(me.slide))
+		}
 	case subcontracts.LC_DATA_IN_CODE:
 		realCommand := subcontracts.LinkEditDataCommand{}
 		subCommand = &realCommand
-		postParsing = addLESection(&realCommand, nil) // FIXME: always empty, but would be nice to have deeper parsing of the content
+		postParsing = func(frame *blockFrame, path string, base, after subcontracts.Address, linkEdit *linkEditData) (*contracts.MemoryBlock, error) {
+			return addLESection(&realCommand, func(block *contracts.MemoryBlock) error {
+				return me.parseDataInCode(frame, block, linkEdit.header)
+			})(frame, path, base, after, linkEdit)
+		}
 	case subcontracts.LC_SOURCE_VERSION:
 		realCommand := subcontracts.SourceVersionCommand{}
 		subCommand = &realCommand
@@ -498,10 +595,20 @@ func (me *parser) getMachOLoadCommandParser(frame *blockFrame, baseCommand subco
 			_, _, err := me.parseAndAddArray(frame, "", after, "NTools", uint64(realCommand.NTools), &subcontracts.BuildToolVersion{}, "Tools")
 			return nil, err
 		}
+	case subcontracts.LC_DYLD_CHAINED_FIXUPS:
+		realCommand := subcontracts.LinkEditDataCommand{}
+		subCommand = &realCommand
+		postParsing = func(frame *blockFrame, path string, base, after subcontracts.Address, linkEdit *linkEditData) (*contracts.MemoryBlock, error) {
+			return addLESection(&realCommand, func(block *contracts.MemoryBlock) error {
+				return me.parseChainedFixups(frame, block)
+			})(frame, path, base, after, linkEdit)
+		}
 	case subcontracts.LC_DYLD_EXPORTS_TRIE:
 		realCommand := subcontracts.LinkEditDataCommand{}
 		subCommand = &realCommand
-		postParsing = addLESection(&realCommand, nil) // TODO: would be nice to have deeper parsing of the content
+		postParsing = func(frame *blockFrame, path string, base, after subcontracts.Address, linkEdit *linkEditData) (*contracts.MemoryBlock, error) {
+			return addLESection(&realCommand, parseExports(frame, linkEdit))(frame, path, base, after, linkEdit)
+		}
 	case subcontracts.LC_FILESET_ENTRY:
 		realCommand := subcontracts.FilesetEntryCommand{}
 		subCommand = &realCommand
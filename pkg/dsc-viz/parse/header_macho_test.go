@@ -0,0 +1,69 @@
+package parse
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/LouisBrunner/mem-viz/pkg/contracts"
+	"github.com/LouisBrunner/mem-viz/pkg/contracts/contractstest"
+	subcontracts "github.com/LouisBrunner/mem-viz/pkg/dsc-viz/contracts"
+	"github.com/LouisBrunner/mem-viz/pkg/machoutils/machotest"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// A cache made of a single image mapped at its base address
+type imageCache struct {
+	base uintptr
+	data []byte
+}
+
+func (me *imageCache) BaseAddress() uintptr { return me.base }
+func (me *imageCache) Header() subcontracts.DYLDCacheHeaderV3 {
+	return subcontracts.DYLDCacheHeaderV3{}
+}
+func (me *imageCache) ReaderAtOffset(off int64) io.Reader     { return bytes.NewReader(me.data[off:]) }
+func (me *imageCache) ReaderAtFileOffset(off int64) io.Reader { return me.ReaderAtOffset(off) }
+func (me *imageCache) Close() error                           { return nil }
+func (me *imageCache) String() string                         { return "image" }
+func (me *imageCache) ReaderAbsolute(abs uint64) io.Reader {
+	return me.ReaderAtOffset(int64(abs - uint64(me.base)))
+}
+
+func Test_parseMachO_bigEndian(t *testing.T) {
+	cache := &imageCache{base: 0x1000, data: machotest.PPC()}
+	root := &contracts.MemoryBlock{Name: "root", Address: cache.base, Size: uint64(len(cache.data))}
+	me := &parser{
+		logger:       logrus.New(),
+		uniqueBlocks: make(map[category][]*contracts.MemoryBlock),
+		allBlocks:    make(map[uintptr]*[]*contracts.MemoryBlock),
+		root:         root,
+		images:       newImageIndex(),
+	}
+
+	header, err := me.parseMachO(topFrame(cache, root, nil), root, "ppc")
+	require.NoError(t, err)
+	assert.Nil(t, me.order)
+	assert.Equal(t, "Mach-O Header", header.Name)
+	assert.Equal(t, "0x12", contractstest.FindValue(t, header, "CPUType").Value)
+	assert.Equal(t, "0x3", contractstest.FindValue(t, header, "NCmds").Value)
+	assert.Equal(t, "0xcc", contractstest.FindValue(t, header, "SizeOfCmds").Value)
+
+	// The other blocks are only placed by the rebalancing, which needs the whole cache
+	blocks := map[string]*contracts.MemoryBlock{}
+	for _, sameAddress := range me.allBlocks {
+		for _, block := range *sameAddress {
+			blocks[block.Name] = block
+		}
+	}
+	require.Contains(t, blocks, "Load Command 3 (SYMTAB)")
+	assert.Equal(t, "0x1", contractstest.FindValue(t, blocks["Load Command 3 (SYMTAB)"], "NSyms").Value)
+	require.Contains(t, blocks, "ppc > Section __TEXT,__text")
+	section := blocks["ppc > Section __TEXT,__text"]
+	assert.Equal(t, uintptr(0x1200), section.Address)
+	assert.Equal(t, uint64(0xe00), section.Size)
+	require.Contains(t, blocks, "ppc > Symbols > Symbols")
+	assert.Equal(t, uintptr(0x2000), blocks["ppc > Symbols > Symbols"].Address)
+}
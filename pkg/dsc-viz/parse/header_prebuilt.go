@@ -0,0 +1,334 @@
+package parse
+
+import (
+	"fmt"
+	"sort"
+	"unsafe"
+
+	"github.com/LouisBrunner/mem-viz/pkg/commons"
+	"github.com/LouisBrunner/mem-viz/pkg/contracts"
+	subcontracts "github.com/LouisBrunner/mem-viz/pkg/dsc-viz/contracts"
+	"github.com/LouisBrunner/mem-viz/pkg/parsingutils"
+)
+
+type prebuiltLoaderSet struct {
+	block *contracts.MemoryBlock
+	// nil entries are loaders we didn't parse
+	loaders []*contracts.MemoryBlock
+}
+
+func (me *prebuiltLoaderSet) loader(index uint64) *contracts.MemoryBlock {
+	if me == nil || index >= uint64(len(me.loaders)) {
+		return nil
+	}
+	return me.loaders[index]
+}
+
+type pendingDependent struct {
+	block *contracts.MemoryBlock
+	ref   subcontracts.LoaderRef
+}
+
+// All offsets inside a PrebuiltLoaderSet are relative to something else in the set, 0 means absent
+func prebuiltOffset(base subcontracts.UnslidAddress, offset uint64) subcontracts.UnslidAddress {
+	if offset == 0 {
+		return 0
+	}
+	return subcontracts.UnslidAddress(uint64(base) + offset)
+}
+
+func (me *parser) parsePrebuiltLoaders(frame *blockFrame, header subcontracts.DYLDCacheHeaderV3, dylibsTrie []trieEntry) error {
+	dylibs, err := me.parsePrebuiltLoaderSet(frame, "DylibsPblSetAddr", header.DylibsPblSetAddr, "PrebuiltLoaderSet (Dylibs)", nil)
+	if err != nil {
+		return err
+	}
+	// The dylibs trie gives the index of each cached dylib, which is also the index of its loader
+	err = me.linkTrieEntries(dylibsTrie, "loader", func(entry trieEntry) *contracts.MemoryBlock {
+		return dylibs.loader(entry.value)
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = me.createBlobBlock(frame, "ProgramsPblSetPoolAddr", header.ProgramsPblSetPoolAddr, "ProgramsPblSetPoolSize", header.ProgramsPblSetPoolSize, "PrebuiltLoaderSet for each program")
+	if err != nil {
+		return err
+	}
+	programs, err := me.parseTrie(frame, "ProgramTrieAddr", header.ProgramTrieAddr, "ProgramTrieSize", uint64(header.ProgramTrieSize), "PrebuiltLoaderSet for each program (Trie)")
+	if err != nil {
+		return err
+	}
+	if header.ProgramsPblSetPoolAddr.Invalid() {
+		return nil
+	}
+	// The program trie gives the offset of each program's PrebuiltLoaderSet inside the pool
+	sets := map[uint64]*prebuiltLoaderSet{}
+	for _, entry := range programs {
+		if _, found := sets[entry.value]; found {
+			continue
+		}
+		if entry.value >= header.ProgramsPblSetPoolSize {
+			return fmt.Errorf("PrebuiltLoaderSet for %s is outside of the pool (%#x)", entry.path, entry.value)
+		}
+		set, err := me.parsePrebuiltLoaderSet(frame, "", subcontracts.UnslidAddress(uint64(header.ProgramsPblSetPoolAddr)+entry.value), fmt.Sprintf("PrebuiltLoaderSet (%s)", entry.path), dylibs)
+		if err != nil {
+			return err
+		}
+		sets[entry.value] = set
+	}
+	return me.linkTrieEntries(programs, "loader set", func(entry trieEntry) *contracts.MemoryBlock {
+		return sets[entry.value].block
+	})
+}
+
+func (me *parser) parsePrebuiltLoaderSet(frame *blockFrame, fieldName string, offset subcontracts.UnslidAddress, label string, dylibs *prebuiltLoaderSet) (*prebuiltLoaderSet, error) {
+	if offset.Invalid() {
+		return nil, nil
+	}
+
+	set := subcontracts.PrebuiltLoaderSet{}
+	err := commons.Unpack(offset.GetReader(frame.cache, 0, me.slide), &set)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", label, err)
+	}
+	if set.Magic != subcontracts.PREBUILT_LOADER_SET_MAGIC {
+		return nil, fmt.Errorf("invalid %s magic: %#x", label, set.Magic)
+	}
+
+	// The loaders array always comes right after the header
+	if uint64(set.LoadersArrayOffset) != uint64(unsafe.Sizeof(set)) {
+		me.logger.Warnf("unknown %s layout (loaders at %#x), showing it as a blob", label, set.LoadersArrayOffset)
+		blob, err := me.createBlobBlock(frame, fieldName, offset, "", uint64(set.Length), label)
+		if err != nil {
+			return nil, err
+		}
+		return &prebuiltLoaderSet{block: blob}, nil
+	}
+
+	blob, headerBlock, err := me.parseAndAddBlob(frame, fieldName, offset, "", uint64(set.Length), &set, label)
+	if err != nil {
+		return nil, err
+	}
+	result := &prebuiltLoaderSet{block: blob}
+	if headerBlock == nil {
+		return result, nil
+	}
+	// Dylibs refer to each other through the dylibs set, so it is its own reference
+	if dylibs == nil {
+		dylibs = result
+	}
+
+	setFrame := frame.siblingFrame(headerBlock)
+	_, offsetItems, err := me.parseAndAddArray(setFrame, "LoadersArrayOffset", prebuiltOffset(offset, uint64(set.LoadersArrayOffset)), "LoadersArrayCount", uint64(set.LoadersArrayCount), &subcontracts.PrebuiltLoaderOffset{}, "Loader Offsets")
+	if err != nil {
+		return nil, err
+	}
+	if offsetItems == nil {
+		me.logger.Debugf("skipping %s loaders, too many of them (%d)", label, set.LoadersArrayCount)
+	}
+
+	// Loaders don't record their own size, so we stop them at whatever comes next in the set
+	boundaries := []uint64{uint64(set.LoadersArrayOffset), uint64(set.CachePatchOffset), uint64(set.DyldCacheUUIDOffset), uint64(set.MustBeMissingPathsOffset), uint64(set.ObjcSelectorHashTableOffset), uint64(set.ObjcClassHashTableOffset), uint64(set.ObjcProtocolHashTableOffset), set.ObjcProtocolClassCacheOffset, uint64(set.SwiftTypeConformanceTableOffset), uint64(set.SwiftMetadataConformanceTableOffset), uint64(set.SwiftForeignTypeConformanceTableOffset), uint64(set.Length)}
+	for _, item := range offsetItems {
+		boundaries = append(boundaries, uint64(item.Data.(subcontracts.PrebuiltLoaderOffset).Offset))
+	}
+	sort.Slice(boundaries, func(i, j int) bool {
+		return boundaries[i] < boundaries[j]
+	})
+
+	result.loaders = make([]*contracts.MemoryBlock, len(offsetItems))
+	dependents := []pendingDependent{}
+	for i, item := range offsetItems {
+		loaderOffset := uint64(item.Data.(subcontracts.PrebuiltLoaderOffset).Offset)
+		next := sort.Search(len(boundaries), func(j int) bool {
+			return boundaries[j] > loaderOffset
+		})
+		if next == len(boundaries) {
+			return nil, fmt.Errorf("%s loader %d is outside of the set (%#x)", label, i, loaderOffset)
+		}
+		loader, deps, err := me.parsePrebuiltLoader(setFrame, prebuiltOffset(offset, loaderOffset), boundaries[next]-loaderOffset)
+		if err != nil {
+			return nil, err
+		}
+		result.loaders[i] = loader
+		dependents = append(dependents, deps...)
+		err = parsingutils.AddLinkWithBlock(item.Block, "Offset", loader, "points to")
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, dep := range dependents {
+		target := dylibs.loader(uint64(dep.ref.Index()))
+		if dep.ref.App() {
+			target = result.loader(uint64(dep.ref.Index()))
+		}
+		if target == nil {
+			continue
+		}
+		err = parsingutils.AddLinkWithBlock(dep.block, "Ref", target, "depends on")
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	_, patches, err := me.parseAndAddArray(setFrame, "CachePatchOffset", prebuiltOffset(offset, uint64(set.CachePatchOffset)), "CachePatchCount", uint64(set.CachePatchCount), &subcontracts.PrebuiltLoaderSetCachePatch{}, "Cache Patches")
+	if err != nil {
+		return nil, err
+	}
+	for _, patch := range patches {
+		target := dylibs.loader(uint64(patch.Data.(subcontracts.PrebuiltLoaderSetCachePatch).CacheDylibIndex))
+		if target == nil {
+			continue
+		}
+		err = parsingutils.AddLinkWithBlock(patch.Block, "CacheDylibIndex", target, "patches")
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	_, err = me.createBlobBlock(setFrame, "DyldCacheUUIDOffset", prebuiltOffset(offset, uint64(set.DyldCacheUUIDOffset)), "", 16, "Dyld Cache UUID")
+	if err != nil {
+		return nil, err
+	}
+	err = me.parseMustBeMissingPaths(setFrame, offset, set)
+	if err != nil {
+		return nil, err
+	}
+
+	// FIXME: those are ObjC/Swift hash tables similar to the ones in the cache, we don't parse them yet
+	links := []struct {
+		name   string
+		offset uint64
+	}{
+		{"ObjcSelectorHashTableOffset", uint64(set.ObjcSelectorHashTableOffset)},
+		{"ObjcClassHashTableOffset", uint64(set.ObjcClassHashTableOffset)},
+		{"ObjcProtocolHashTableOffset", uint64(set.ObjcProtocolHashTableOffset)},
+		{"ObjcProtocolClassCacheOffset", set.ObjcProtocolClassCacheOffset},
+		{"SwiftTypeConformanceTableOffset", uint64(set.SwiftTypeConformanceTableOffset)},
+		{"SwiftMetadataConformanceTableOffset", uint64(set.SwiftMetadataConformanceTableOffset)},
+		{"SwiftForeignTypeConformanceTableOffset", uint64(set.SwiftForeignTypeConformanceTableOffset)},
+	}
+	for _, link := range links {
+		err = me.addLinkWithOffset(setFrame, link.name, prebuiltOffset(offset, link.offset), "points to")
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+func (me *parser) parseMustBeMissingPaths(frame *blockFrame, offset subcontracts.UnslidAddress, set subcontracts.PrebuiltLoaderSet) error {
+	pathsOffset := prebuiltOffset(offset, uint64(set.MustBeMissingPathsOffset))
+	if pathsOffset.Invalid() || set.MustBeMissingPathsCount == 0 {
+		return nil
+	}
+
+	paths := make([]string, 0, set.MustBeMissingPathsCount)
+	size := uint64(0)
+	for i := uint32(0); i < set.MustBeMissingPathsCount; i += 1 {
+		path := parsingutils.ReadCString(pathsOffset.GetReader(frame.cache, size, me.slide))
+		paths = append(paths, path)
+		size += uint64(len(path)) + 1
+	}
+
+	pathsBlock, err := me.createBlobBlock(frame, "MustBeMissingPathsOffset", pathsOffset, "MustBeMissingPathsCount", size, fmt.Sprintf("Must Be Missing Paths (%d)", len(paths)))
+	if err != nil {
+		return err
+	}
+	current := uint64(0)
+	for _, path := range paths {
+		_, err = me.createCommonBlock(pathsBlock, path, subcontracts.ManualAddress(current), uint64(len(path))+1)
+		if err != nil {
+			return err
+		}
+		current += uint64(len(path)) + 1
+	}
+	return nil
+}
+
+func (me *parser) parsePrebuiltLoader(frame *blockFrame, offset subcontracts.UnslidAddress, size uint64) (*contracts.MemoryBlock, []pendingDependent, error) {
+	loader := subcontracts.PrebuiltLoader{}
+	err := commons.Unpack(offset.GetReader(frame.cache, 0, me.slide), &loader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse PrebuiltLoader at %#x: %w", offset, err)
+	}
+	if loader.Magic != subcontracts.LOADER_MAGIC {
+		return nil, nil, fmt.Errorf("invalid PrebuiltLoader magic at %#x: %#x", offset, loader.Magic)
+	}
+
+	// The path always comes right after the loader
+	if uint64(loader.PathOffset) != uint64(unsafe.Sizeof(loader)) {
+		me.logger.Warnf("unknown PrebuiltLoader layout at %#x (path at %#x), showing it as a blob", offset, loader.PathOffset)
+		blob, err := me.createBlobBlock(frame, "", offset, "", size, "PrebuiltLoader")
+		return blob, nil, err
+	}
+
+	pathOffset := prebuiltOffset(offset, uint64(loader.PathOffset))
+	path := parsingutils.ReadCString(pathOffset.GetReader(frame.cache, 0, me.slide))
+	blob, headerBlock, err := me.parseAndAddBlob(frame, "", offset, "", size, &loader, fmt.Sprintf("PrebuiltLoader (%s)", path))
+	if err != nil {
+		return nil, nil, err
+	}
+	if headerBlock == nil {
+		return blob, nil, nil
+	}
+
+	loaderFrame := frame.siblingFrame(headerBlock)
+	_, err = me.createBlobBlock(loaderFrame, "PathOffset", pathOffset, "", uint64(len(path))+1, fmt.Sprintf("Path: %s", path))
+	if err != nil {
+		return nil, nil, err
+	}
+	altPathOffset := prebuiltOffset(offset, uint64(loader.AltPathOffset))
+	if !altPathOffset.Invalid() {
+		altPath := parsingutils.ReadCString(altPathOffset.GetReader(frame.cache, 0, me.slide))
+		_, err = me.createBlobBlock(loaderFrame, "AltPathOffset", altPathOffset, "", uint64(len(altPath))+1, fmt.Sprintf("Alt Path: %s", altPath))
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	_, refs, err := me.parseAndAddArray(loaderFrame, "DependentLoaderRefsArrayOffset", prebuiltOffset(offset, uint64(loader.DependentLoaderRefsArrayOffset)), "DepCount", uint64(loader.DepCount), &subcontracts.PrebuiltLoaderDependent{}, "Dependents")
+	if err != nil {
+		return nil, nil, err
+	}
+	dependents := make([]pendingDependent, 0, len(refs))
+	for _, ref := range refs {
+		dependents = append(dependents, pendingDependent{block: ref.Block, ref: ref.Data.(subcontracts.PrebuiltLoaderDependent).Ref})
+	}
+	_, _, err = me.parseAndAddArray(loaderFrame, "DependentKindArrayOffset", prebuiltOffset(offset, uint64(loader.DependentKindArrayOffset)), "DepCount", uint64(loader.DepCount), new(subcontracts.LoaderDependentKind), "Dependent Kinds")
+	if err != nil {
+		return nil, nil, err
+	}
+	_, _, err = me.parseAndAddArray(loaderFrame, "RegionsOffset", prebuiltOffset(offset, uint64(loader.RegionsOffset)), "PrebuiltFlags", uint64(loader.PrebuiltFlags.RegionsCount()), &subcontracts.PrebuiltLoaderRegion{}, "Regions")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Bind targets are resolved through the cache, they are just a list of absolute values
+	bindTargetSize := uint64(unsafe.Sizeof(uint64(0)))
+	_, err = me.createBlobBlock(loaderFrame, "BindTargetRefsOffset", prebuiltOffset(offset, uint64(loader.BindTargetRefsOffset)), "BindTargetRefsCount", uint64(loader.BindTargetRefsCount)*bindTargetSize, fmt.Sprintf("Bind Targets (%d)", loader.BindTargetRefsCount))
+	if err != nil {
+		return nil, nil, err
+	}
+	_, err = me.createBlobBlock(loaderFrame, "OverrideBindTargetRefsOffset", prebuiltOffset(offset, uint64(loader.OverrideBindTargetRefsOffset)), "OverrideBindTargetRefsCount", uint64(loader.OverrideBindTargetRefsCount)*bindTargetSize, fmt.Sprintf("Override Bind Targets (%d)", loader.OverrideBindTargetRefsCount))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// FIXME: we don't parse FileValidationInfo, ObjCBinaryInfo or the patch table yet
+	err = me.addLinkWithOffset(loaderFrame, "FileValidationOffset", prebuiltOffset(offset, uint64(loader.FileValidationOffset)), "points to")
+	if err != nil {
+		return nil, nil, err
+	}
+	err = me.addLinkWithOffset(loaderFrame, "ObjcBinaryInfoOffset", prebuiltOffset(offset, uint64(loader.ObjcBinaryInfoOffset)), "points to")
+	if err != nil {
+		return nil, nil, err
+	}
+	err = me.addLinkWithOffset(loaderFrame, "PatchTableOffset", prebuiltOffset(offset, uint64(loader.PatchTableOffset)), "points to")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return blob, dependents, nil
+}
@@ -0,0 +1,180 @@
+package parse
+
+import (
+	"testing"
+	"unsafe"
+
+	"github.com/LouisBrunner/mem-viz/pkg/contracts"
+	"github.com/LouisBrunner/mem-viz/pkg/contracts/contractstest"
+	subcontracts "github.com/LouisBrunner/mem-viz/pkg/dsc-viz/contracts"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	prebuiltBase        = 0x10000
+	prebuiltDylibs      = 0x100
+	prebuiltDylibsTrie  = 0x800
+	prebuiltProgramTrie = 0x900
+	prebuiltPool        = 0xa00
+)
+
+var (
+	setSize    = uint32(unsafe.Sizeof(subcontracts.PrebuiltLoaderSet{}))
+	loaderSize = uint16(unsafe.Sizeof(subcontracts.PrebuiltLoader{}))
+)
+
+// Each loader is followed by its path, then its dependents
+func putLoader(t *testing.T, data []byte, offset uint64, path string, deps []subcontracts.LoaderRef, kinds []subcontracts.LoaderDependentKind, regions uint16) uint64 {
+	loader := subcontracts.PrebuiltLoader{
+		Magic:         subcontracts.LOADER_MAGIC,
+		PathOffset:    loaderSize,
+		DepCount:      uint16(len(deps)),
+		PrebuiltFlags: subcontracts.PrebuiltLoaderBitField(regions << 4),
+	}
+	copy(data[offset+uint64(loaderSize):], path)
+	end := uint64(loaderSize) + uint64(len(path)) + 1
+	if len(deps) > 0 {
+		loader.DependentLoaderRefsArrayOffset = uint16(end)
+		putStruct(t, data, offset+end, deps)
+		end += uint64(len(deps)) * 2
+	}
+	if len(kinds) > 0 {
+		loader.DependentKindArrayOffset = uint16(end)
+		putStruct(t, data, offset+end, kinds)
+		end += uint64(len(kinds))
+	}
+	if regions > 0 {
+		loader.RegionsOffset = uint16(end)
+		end += uint64(regions) * uint64(unsafe.Sizeof(subcontracts.PrebuiltLoaderRegion{}))
+	}
+	putStruct(t, data, offset, loader)
+	return end
+}
+
+func putLoaderSet(t *testing.T, data []byte, offset uint64, loaders []uint32, length uint32) {
+	putStruct(t, data, offset, subcontracts.PrebuiltLoaderSet{
+		Magic:              subcontracts.PREBUILT_LOADER_SET_MAGIC,
+		Length:             length,
+		LoadersArrayCount:  uint32(len(loaders)),
+		LoadersArrayOffset: setSize,
+	})
+	putStruct(t, data, offset+uint64(setSize), loaders)
+}
+
+// A cache with two dylibs (libB depending on libA) and a program depending on libB and itself
+func prebuiltCache(t *testing.T) (*imageCache, subcontracts.DYLDCacheHeaderV3) {
+	data := make([]byte, 0x1000)
+	putLoaderSet(t, data, prebuiltDylibs, []uint32{0x60, 0x100}, 0x200)
+	putLoader(t, data, prebuiltDylibs+0x60, "/usr/lib/libA.dylib", nil, nil, 0)
+	putLoader(t, data, prebuiltDylibs+0x100, "/usr/lib/libB.dylib", []subcontracts.LoaderRef{0}, []subcontracts.LoaderDependentKind{subcontracts.LOADER_DEPENDENT_WEAK_LINK}, 1)
+	// "/usr/lib/lib" -> "A.dylib" (0) and "B.dylib" (1)
+	copy(data[prebuiltDylibsTrie:], "\x00\x01/usr/lib/lib\x00\x10"+
+		"\x00\x02A.dylib\x00\x24B.dylib\x00\x27"+
+		"\x01\x00\x00"+
+		"\x01\x01\x00")
+	putLoaderSet(t, data, prebuiltPool, []uint32{0x60}, 0x100)
+	putLoader(t, data, prebuiltPool+0x60, "/bin/app", []subcontracts.LoaderRef{1, 0x8000}, nil, 0)
+	// "/bin/app" -> offset 0 in the pool
+	copy(data[prebuiltProgramTrie:], "\x00\x01/bin/app\x00\x0c"+
+		"\x01\x00\x00")
+
+	header := subcontracts.DYLDCacheHeaderV3{}
+	header.DylibsTrieAddr = prebuiltBase + prebuiltDylibsTrie
+	header.DylibsTrieSize = 0x2a
+	header.DylibsPblSetAddr = prebuiltBase + prebuiltDylibs
+	header.ProgramsPblSetPoolAddr = prebuiltBase + prebuiltPool
+	header.ProgramsPblSetPoolSize = 0x100
+	header.ProgramTrieAddr = prebuiltBase + prebuiltProgramTrie
+	header.ProgramTrieSize = 0xf
+	return &imageCache{base: prebuiltBase, data: data}, header
+}
+
+func parsePrebuilt(t *testing.T, cache *imageCache, header subcontracts.DYLDCacheHeaderV3) *parser {
+	me, frame := swiftParser(t, cache, header)
+	dylibsTrie, err := me.parseTrie(frame, "DylibsTrieAddr", header.DylibsTrieAddr, "DylibsTrieSize", header.DylibsTrieSize, "Dylibs (Trie)")
+	require.NoError(t, err)
+	require.Len(t, dylibsTrie, 2)
+	require.NoError(t, me.parsePrebuiltLoaders(frame, header, dylibsTrie))
+	return me
+}
+
+func Test_parsePrebuiltLoaders(t *testing.T) {
+	cache, header := prebuiltCache(t)
+	me := parsePrebuilt(t, cache, header)
+
+	libA := findBlock(t, me, "PrebuiltLoader (/usr/lib/libA.dylib)")
+	assert.Equal(t, uintptr(prebuiltBase+prebuiltDylibs+0x60), libA.Address)
+	assert.Equal(t, uint64(0xa0), libA.Size)
+	libB := findBlock(t, me, "PrebuiltLoader (/usr/lib/libB.dylib)")
+	assert.Equal(t, uintptr(prebuiltBase+prebuiltDylibs+0x100), libB.Address)
+	assert.Equal(t, uint64(0x100), libB.Size)
+	app := findBlock(t, me, "PrebuiltLoader (/bin/app)")
+	appSet := findBlock(t, me, "PrebuiltLoaderSet (/bin/app)")
+	assert.Equal(t, uintptr(prebuiltBase+prebuiltPool), appSet.Address)
+
+	// The loader details
+	libBHeader := findBlock(t, me, "PrebuiltLoader (/usr/lib/libB.dylib) Header")
+	assert.Equal(t, "0x1", contractstest.FindValue(t, libBHeader, "DepCount").Value)
+	path := findBlock(t, me, "Path: /usr/lib/libB.dylib")
+	assert.Equal(t, libB.Address+uintptr(loaderSize), path.Address)
+	assert.Equal(t, []*contracts.MemoryLink{{Name: "points to", TargetAddress: uint64(path.Address)}}, contractstest.FindValue(t, libBHeader, "PathOffset").Links)
+	kinds := findBlock(t, me, "Dependent Kinds 1/1")
+	assert.Equal(t, "weak-link", contractstest.FindValue(t, kinds, "Value").Value)
+	region := findBlock(t, me, "Regions 1/1")
+	assert.Equal(t, uint64(unsafe.Sizeof(subcontracts.PrebuiltLoaderRegion{})), region.Size)
+
+	// Dependents are resolved through the dylibs set, or the program's own set for apps
+	dependents := map[uintptr]*contracts.MemoryValue{}
+	for _, sameAddress := range me.allBlocks {
+		for _, block := range *sameAddress {
+			if block.Name == "Dependents 1/1" || block.Name == "Dependents 1/2" || block.Name == "Dependents 2/2" {
+				dependents[block.Address] = contractstest.FindValue(t, block, "Ref")
+			}
+		}
+	}
+	require.Len(t, dependents, 3)
+	libBDeps := libB.Address + uintptr(loaderSize) + uintptr(len("/usr/lib/libB.dylib")+1)
+	assert.Equal(t, []*contracts.MemoryLink{{Name: "depends on", TargetAddress: uint64(libA.Address)}}, dependents[libBDeps].Links)
+	appDeps := app.Address + uintptr(loaderSize) + uintptr(len("/bin/app")+1)
+	assert.Equal(t, []*contracts.MemoryLink{{Name: "depends on", TargetAddress: uint64(libB.Address)}}, dependents[appDeps].Links)
+	assert.Equal(t, []*contracts.MemoryLink{{Name: "depends on", TargetAddress: uint64(app.Address)}}, dependents[appDeps+2].Links)
+
+	// The tries link to what they index
+	for name, target := range map[string]*contracts.MemoryBlock{
+		`Trie Entry "/usr/lib/libA.dylib"`: libA,
+		`Trie Entry "/usr/lib/libB.dylib"`: libB,
+	} {
+		entry := findBlock(t, me, name)
+		assert.Equal(t, []*contracts.MemoryLink{{Name: "loader", TargetAddress: uint64(target.Address)}}, contractstest.FindValue(t, entry, "Value").Links, name)
+	}
+	entry := findBlock(t, me, `Trie Entry "/bin/app"`)
+	assert.Equal(t, []*contracts.MemoryLink{{Name: "loader set", TargetAddress: uint64(appSet.Address)}}, contractstest.FindValue(t, entry, "Value").Links)
+}
+
+func Test_parsePrebuiltLoaders_unknownLayout(t *testing.T) {
+	cache, header := prebuiltCache(t)
+	// A newer dylibs set with a larger header and a program loader with an extra field
+	putStruct(t, cache.data, prebuiltDylibs+16, setSize+8)
+	putStruct(t, cache.data, prebuiltPool+0x60+8, loaderSize+8)
+	me := parsePrebuilt(t, cache, header)
+
+	dylibs := findBlock(t, me, "PrebuiltLoaderSet (Dylibs)")
+	assert.Equal(t, uintptr(prebuiltBase+prebuiltDylibs), dylibs.Address)
+	assert.Equal(t, uint64(0x200), dylibs.Size)
+	assert.Empty(t, dylibs.Values)
+	for _, name := range []string{`Trie Entry "/usr/lib/libA.dylib"`, `Trie Entry "/usr/lib/libB.dylib"`} {
+		assert.Empty(t, contractstest.FindValue(t, findBlock(t, me, name), "Value").Links, name)
+	}
+
+	app := findBlock(t, me, "PrebuiltLoader")
+	assert.Equal(t, uintptr(prebuiltBase+prebuiltPool+0x60), app.Address)
+	assert.Equal(t, uint64(0xa0), app.Size)
+	for _, sameAddress := range me.allBlocks {
+		for _, block := range *sameAddress {
+			assert.NotContains(t, block.Name, "Dependents")
+		}
+	}
+	offsets := findBlock(t, me, "Loader Offsets 1/1")
+	assert.Equal(t, []*contracts.MemoryLink{{Name: "points to", TargetAddress: uint64(app.Address)}}, contractstest.FindValue(t, offsets, "Offset").Links)
+}
@@ -0,0 +1,233 @@
+package parse
+
+import (
+	"fmt"
+	"unsafe"
+
+	"github.com/LouisBrunner/mem-viz/pkg/commons"
+	"github.com/LouisBrunner/mem-viz/pkg/contracts"
+	subcontracts "github.com/LouisBrunner/mem-viz/pkg/dsc-viz/contracts"
+	"github.com/LouisBrunner/mem-viz/pkg/parsingutils"
+)
+
+type swiftConformanceOwner struct {
+	block       *contracts.MemoryBlock
+	conformance uintptr
+}
+
+func (me *parser) parseSwiftOpts(frame *blockFrame, header subcontracts.DYLDCacheHeaderV3) error {
+	if header.SwiftOptsOffset.Invalid() || header.SwiftOptsSize == 0 {
+		return nil
+	}
+
+	swiftHeader := subcontracts.SwiftOptimizationHeader{}
+	err := commons.Unpack(header.SwiftOptsOffset.GetReader(frame.cache, 0, me.slide), &swiftHeader)
+	if err != nil {
+		return fmt.Errorf("failed to parse Swift optimizations header: %w", err)
+	}
+
+	var data any
+	switch swiftHeader.Version {
+	case 1:
+		data = &subcontracts.SwiftOptimizationHeader{}
+	case 2:
+		data = &subcontracts.SwiftOptimizationHeaderV2{}
+	case 3:
+		data = &subcontracts.SwiftOptimizationHeaderV3{}
+	default:
+		// Newer caches can still be shown, only without the details
+		me.logger.Warnf("unknown Swift optimizations version %d, showing it as a blob", swiftHeader.Version)
+		_, err = me.createBlobBlock(frame, "SwiftOptsOffset", header.SwiftOptsOffset, "SwiftOptsSize", header.SwiftOptsSize, fmt.Sprintf("Swift Optimizations (V%d)", swiftHeader.Version))
+		return err
+	}
+
+	_, headerBlock, err := me.parseAndAddBlob(frame, "SwiftOptsOffset", header.SwiftOptsOffset, "SwiftOptsSize", header.SwiftOptsSize, data, fmt.Sprintf("Swift Optimizations (V%d)", swiftHeader.Version))
+	if err != nil {
+		return err
+	}
+	if headerBlock == nil {
+		return nil
+	}
+
+	// All offsets are relative to the cache header, so we stay at the cache level
+	swiftFrame := frame.siblingFrame(headerBlock)
+	err = me.parseSwiftHashTable(swiftFrame, "TypeConformanceHashTableCacheOffset", swiftHeader.TypeConformanceHashTableCacheOffset, &subcontracts.SwiftTypeProtocolConformanceLocation{}, "Swift Type Conformances")
+	if err != nil {
+		return err
+	}
+	err = me.parseSwiftHashTable(swiftFrame, "MetadataConformanceHashTableCacheOffset", swiftHeader.MetadataConformanceHashTableCacheOffset, &subcontracts.SwiftMetadataProtocolConformanceLocation{}, "Swift Metadata Conformances")
+	if err != nil {
+		return err
+	}
+	err = me.parseSwiftHashTable(swiftFrame, "ForeignTypeConformanceHashTableCacheOffset", swiftHeader.ForeignTypeConformanceHashTableCacheOffset, &subcontracts.SwiftForeignTypeProtocolConformanceLocation{}, "Swift Foreign Type Conformances")
+	if err != nil {
+		return err
+	}
+
+	switch v := data.(type) {
+	case *subcontracts.SwiftOptimizationHeaderV2:
+		err = me.addLinkWithOffset(swiftFrame, "PrespecializationDataCacheOffset", v.PrespecializationDataCacheOffset, "points to")
+	case *subcontracts.SwiftOptimizationHeaderV3:
+		err = me.addLinkWithOffset(swiftFrame, "PrespecializationDataCacheOffset", v.PrespecializationDataCacheOffset, "points to")
+		if err != nil {
+			return err
+		}
+		// FIXME: those are also hash tables but they are only used for debugging so we don't parse them
+		for i, offset := range v.PrespecializedMetadataHashTableCacheOffsets {
+			err = me.addLinkWithOffset(swiftFrame, "PrespecializedMetadataHashTableCacheOffsets", subcontracts.RelativeAddress64(offset), fmt.Sprintf("points to (%d)", i))
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return err
+}
+
+func (me *parser) parseSwiftHashTable(frame *blockFrame, fieldName string, offset subcontracts.RelativeAddress64, data any, label string) error {
+	if offset.Invalid() {
+		return nil
+	}
+
+	table := subcontracts.SwiftHashTable{}
+	err := commons.Unpack(offset.GetReader(frame.cache, 0, me.slide), &table)
+	if err != nil {
+		return fmt.Errorf("failed to parse %s: %w", label, err)
+	}
+
+	headerSize := uint64(unsafe.Sizeof(table))
+	scrambleOffset := uint64(offset) + headerSize
+	tabOffset := scrambleOffset + subcontracts.SWIFT_HASH_TABLE_SCRAMBLE_COUNT*4
+	checkBytesOffset := tabOffset + uint64(table.RoundedTabSize)
+	offsetsOffset := checkBytesOffset + uint64(table.Capacity)
+	tableSize := offsetsOffset + uint64(table.Capacity)*4 - uint64(offset)
+
+	_, tableBlock, err := me.parseAndAddBlob(frame, fieldName, offset, "", tableSize, &table, label)
+	if err != nil {
+		return err
+	}
+	if tableBlock == nil {
+		return nil
+	}
+
+	tableFrame := frame.siblingFrame(tableBlock)
+	_, err = me.createBlobBlock(tableFrame, "", subcontracts.RelativeAddress64(scrambleOffset), "", subcontracts.SWIFT_HASH_TABLE_SCRAMBLE_COUNT*4, "Scramble")
+	if err != nil {
+		return err
+	}
+	_, err = me.createBlobBlock(tableFrame, "Mask", subcontracts.RelativeAddress64(tabOffset), "RoundedTabSize", uint64(table.RoundedTabSize), "Tab")
+	if err != nil {
+		return err
+	}
+	_, err = me.createBlobBlock(tableFrame, "", subcontracts.RelativeAddress64(checkBytesOffset), "Capacity", uint64(table.Capacity), "Check Bytes")
+	if err != nil {
+		return err
+	}
+	_, offsetItems, err := me.parseAndAddArray(tableFrame, "", subcontracts.RelativeAddress64(offsetsOffset), "Capacity", uint64(table.Capacity), &subcontracts.SwiftHashTableOffset{}, "Offsets")
+	if err != nil {
+		return err
+	}
+	if offsetItems == nil {
+		me.logger.Debugf("skipping %s entries, too many of them (%d)", label, table.Capacity)
+		return nil
+	}
+
+	entrySize := uint64(parsingutils.GetDataValue(data).Type().Size())
+	seen := map[uint64]struct{}{}
+	for _, item := range offsetItems {
+		targetOffset := item.Data.(subcontracts.SwiftHashTableOffset).Offset
+		if targetOffset == int32(table.SentinelTarget) {
+			continue
+		}
+
+		// Duplicates are stored right after each other and flagged by the previous entry
+		target := uint64(int64(offset) + int64(targetOffset))
+		err = parsingutils.AddLinkWithAddr(item.Block, "Offset", "points to", subcontracts.RelativeAddress64(target).AddBase(frame.parent.Address).Calculate(me.slide))
+		if err != nil {
+			return err
+		}
+		for {
+			if _, found := seen[target]; found {
+				break
+			}
+			seen[target] = struct{}{}
+
+			nextIsDuplicate, err := me.parseSwiftConformance(frame, subcontracts.RelativeAddress64(target), data, fmt.Sprintf("%s %d", label, len(seen)))
+			if err != nil {
+				return err
+			}
+			if !nextIsDuplicate {
+				break
+			}
+			target += entrySize
+		}
+	}
+	return nil
+}
+
+func (me *parser) parseSwiftConformance(frame *blockFrame, offset subcontracts.RelativeAddress64, data any, label string) (bool, error) {
+	block, err := me.parseAndAdd(offset.GetReader(frame.cache, 0, me.slide), frame.parent, offset, data, label)
+	if err != nil {
+		return false, err
+	}
+
+	entryFrame := frame.siblingFrame(block)
+	var descriptorName string
+	var descriptor, protocol uint64
+	var location subcontracts.SwiftProtocolConformanceLocation
+	switch v := copyDataValue(data).(type) {
+	case subcontracts.SwiftTypeProtocolConformanceLocation:
+		descriptorName, descriptor, protocol, location = "TypeDescriptorCacheOffset", v.TypeDescriptorCacheOffset, v.ProtocolCacheOffset, v.Location
+	case subcontracts.SwiftMetadataProtocolConformanceLocation:
+		descriptorName, descriptor, protocol, location = "MetadataCacheOffset", v.MetadataCacheOffset, v.ProtocolCacheOffset, v.Location
+	case subcontracts.SwiftForeignTypeProtocolConformanceLocation:
+		descriptorName, descriptor, protocol, location = "ForeignDescriptorNameCacheOffset", v.ForeignDescriptorNameCacheOffset, v.ProtocolCacheOffset, v.Location
+	default:
+		return false, fmt.Errorf("invalid Swift conformance type: %T", data)
+	}
+
+	err = me.addLinkWithOffset(entryFrame, descriptorName, subcontracts.RelativeAddress64(descriptor), "points to")
+	if err != nil {
+		return false, err
+	}
+	err = me.addLinkWithOffset(entryFrame, "ProtocolCacheOffset", subcontracts.RelativeAddress64(protocol), "points to")
+	if err != nil {
+		return false, err
+	}
+	conformance := subcontracts.RelativeAddress64(location.ProtocolConformanceCacheOffset())
+	err = me.addLinkWithOffset(entryFrame, "Location", conformance, "conformance")
+	if err != nil {
+		return false, err
+	}
+
+	// The images are parsed later on, so their sections can only be found once everything is parsed
+	me.swiftConformances = append(me.swiftConformances, swiftConformanceOwner{block: block, conformance: conformance.AddBase(frame.parent.Address).Calculate(me.slide)})
+	return location.NextIsDuplicate(), nil
+}
+
+func (me *parser) addSwiftConformanceOwners() error {
+	for _, owner := range me.swiftConformances {
+		err := me.addSwiftConformanceOwner(owner.block, owner.conformance)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (me *parser) addSwiftConformanceOwner(block *contracts.MemoryBlock, conformance uintptr) error {
+	section := me.images.findSection(conformance)
+	if section == nil {
+		return nil
+	}
+
+	// FIXME: abusing the 0/0 again, but it's the only way to show which image owns the conformance
+	addValue(block, "Image", section.path, 0, 0)
+	if image := me.images.findImage(section.path); image != nil {
+		err := parsingutils.AddLinkWithBlock(block, "Image", image, "defined in")
+		if err != nil {
+			return err
+		}
+	}
+	addValue(block, "Section", fmt.Sprintf("%s,%s", section.segment, section.section), 0, 0)
+	return parsingutils.AddLinkWithBlock(block, "Section", section.block, "defined in")
+}
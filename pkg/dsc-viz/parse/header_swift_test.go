@@ -0,0 +1,113 @@
+package parse
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/LouisBrunner/mem-viz/pkg/contracts"
+	"github.com/LouisBrunner/mem-viz/pkg/contracts/contractstest"
+	subcontracts "github.com/LouisBrunner/mem-viz/pkg/dsc-viz/contracts"
+	"github.com/LouisBrunner/mem-viz/pkg/machoutils/machotest"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func putStruct(t *testing.T, data []byte, offset uint64, v any) {
+	buf := bytes.Buffer{}
+	require.NoError(t, binary.Write(&buf, binary.LittleEndian, v))
+	copy(data[offset:], buf.Bytes())
+}
+
+const (
+	swiftOptsOffset    = 0x1100
+	swiftTableOffset   = swiftOptsOffset + 0x20
+	swiftEntryOffset   = swiftTableOffset + 0x430
+	swiftConformanceAt = 0x300 // inside __TEXT,__text of the image
+)
+
+// A cache with the PowerPC image at its start followed by Swift optimizations with a single type conformance
+func swiftCache(t *testing.T, version uint32) (*imageCache, subcontracts.DYLDCacheHeaderV3) {
+	data := make([]byte, 0x2000)
+	copy(data, machotest.PPC())
+	putStruct(t, data, swiftOptsOffset, subcontracts.SwiftOptimizationHeader{
+		Version:                             version,
+		TypeConformanceHashTableCacheOffset: swiftTableOffset,
+	})
+	putStruct(t, data, swiftTableOffset, subcontracts.SwiftHashTable{
+		Capacity:       1,
+		Occupied:       1,
+		SentinelTarget: 0x7fffffff,
+		RoundedTabSize: 4,
+	})
+	// The offsets are after the scramble, tab and check bytes
+	putStruct(t, data, swiftTableOffset+0x425, int32(swiftEntryOffset-swiftTableOffset))
+	putStruct(t, data, swiftEntryOffset, subcontracts.SwiftTypeProtocolConformanceLocation{
+		TypeDescriptorCacheOffset: 0x210,
+		ProtocolCacheOffset:       0x220,
+		Location:                  subcontracts.SwiftProtocolConformanceLocation(swiftConformanceAt << 1),
+	})
+	header := subcontracts.DYLDCacheHeaderV3{}
+	header.SwiftOptsOffset = swiftOptsOffset
+	header.SwiftOptsSize = 0x20
+	return &imageCache{base: 0x1000, data: data}, header
+}
+
+func swiftParser(t *testing.T, cache *imageCache, header subcontracts.DYLDCacheHeaderV3) (*parser, *blockFrame) {
+	root := &contracts.MemoryBlock{Name: "root", Address: cache.base}
+	area := &contracts.MemoryBlock{Name: "Main Header Area", Address: cache.base, Size: uint64(len(cache.data))}
+	me := &parser{
+		logger:       logrus.New(),
+		uniqueBlocks: make(map[category][]*contracts.MemoryBlock),
+		allBlocks:    make(map[uintptr]*[]*contracts.MemoryBlock),
+		root:         root,
+		images:       newImageIndex(),
+	}
+	headerBlock, err := me.createStructBlock(area, header, "Main Header (V3)", subcontracts.ManualAddress(0))
+	require.NoError(t, err)
+	return me, topFrame(cache, area, headerBlock)
+}
+
+func findBlock(t *testing.T, me *parser, name string) *contracts.MemoryBlock {
+	for _, sameAddress := range me.allBlocks {
+		for _, block := range *sameAddress {
+			if block.Name == name {
+				return block
+			}
+		}
+	}
+	require.Failf(t, "block not found", "%q", name)
+	return nil
+}
+
+func Test_parseSwiftOpts_owners(t *testing.T) {
+	cache, header := swiftCache(t, 1)
+	me, frame := swiftParser(t, cache, header)
+
+	// Like in a real cache, the Swift optimizations are parsed before the images
+	require.NoError(t, me.parseSwiftOpts(frame, header))
+	imageHeader, err := me.parseMachO(frame, frame.parent, "ppc")
+	require.NoError(t, err)
+	require.NoError(t, me.addSwiftConformanceOwners())
+
+	entry := findBlock(t, me, "Swift Type Conformances 1")
+	assert.Equal(t, uintptr(0x1000+swiftEntryOffset), entry.Address)
+	image := contractstest.FindValue(t, entry, "Image")
+	assert.Equal(t, `"ppc"`, image.Value)
+	assert.Equal(t, []*contracts.MemoryLink{{Name: "defined in", TargetAddress: uint64(imageHeader.Address)}}, image.Links)
+	section := contractstest.FindValue(t, entry, "Section")
+	assert.Equal(t, `"__TEXT,__text"`, section.Value)
+	assert.Equal(t, []*contracts.MemoryLink{{Name: "defined in", TargetAddress: 0x1200}}, section.Links)
+}
+
+func Test_parseSwiftOpts_unknownVersion(t *testing.T) {
+	cache, header := swiftCache(t, 42)
+	me, frame := swiftParser(t, cache, header)
+
+	require.NoError(t, me.parseSwiftOpts(frame, header))
+	blob := findBlock(t, me, "Swift Optimizations (V42)")
+	assert.Equal(t, uintptr(0x1000+swiftOptsOffset), blob.Address)
+	assert.Empty(t, blob.Content)
+	assert.Empty(t, me.swiftConformances)
+}
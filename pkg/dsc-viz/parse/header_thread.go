@@ -0,0 +1,29 @@
+package parse
+
+import (
+	"fmt"
+	"io"
+
+	subcontracts "github.com/LouisBrunner/mem-viz/pkg/dsc-viz/contracts"
+	"github.com/LouisBrunner/mem-viz/pkg/machoutils"
+)
+
+func (me *parser) parseThreadStates(frame *blockFrame, after subcontracts.Address, size uint64, linkEdit *linkEditData) error {
+	data := make([]byte, size)
+	_, err := io.ReadFull(after.GetReader(frame.cache, 0, me.slide), data)
+	if err != nil {
+		return fmt.Errorf("failed to read thread states: %w", err)
+	}
+	states, err := machoutils.ParseThreadState(data, after.AddBase(frame.parent.Address).Calculate(me.slide), machoutils.ThreadStateOptions{
+		CPU:       linkEdit.cpuType,
+		ByteOrder: me.order,
+		Resolve: func(vmAddr uint64) (uintptr, bool) {
+			return subcontracts.UnslidAddress(vmAddr).Calculate(me.slide), true
+		},
+	})
+	if err != nil {
+		return err
+	}
+	me.addChildFast(states)
+	return nil
+}
@@ -0,0 +1,103 @@
+package parse
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/LouisBrunner/mem-viz/pkg/contracts"
+	subcontracts "github.com/LouisBrunner/mem-viz/pkg/dsc-viz/contracts"
+	"github.com/LouisBrunner/mem-viz/pkg/machoutils"
+	"github.com/LouisBrunner/mem-viz/pkg/parsingutils"
+)
+
+type trieEntry struct {
+	// nil if the trie was too big to be detailed
+	block *contracts.MemoryBlock
+	path  string
+	value uint64
+}
+
+// Parses a path trie whose terminal payload is a single ULEB128 (e.g. an index or an offset), the caller is responsible for linking the entries
+func (me *parser) parseTrie(frame *blockFrame, fieldName string, offset subcontracts.UnslidAddress, fieldSizeName string, size uint64, label string) ([]trieEntry, error) {
+	blob, err := me.createBlobBlock(frame, fieldName, offset, fieldSizeName, size, label)
+	if err != nil {
+		return nil, err
+	}
+	if blob == nil {
+		return nil, nil
+	}
+
+	data := make([]byte, size)
+	_, err = io.ReadFull(offset.GetReader(frame.cache, 0, me.slide), data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", label, err)
+	}
+	nodes, err := machoutils.ParseTrie(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", label, err)
+	}
+	tooBig := me.thresholdsArrayTooBig != 0 && uint64(len(nodes)) > me.thresholdsArrayTooBig
+	if tooBig {
+		me.logger.Debugf("skipping %s nodes, too many of them (%d)", label, len(nodes))
+	}
+
+	entries := []trieEntry{}
+	for _, node := range nodes {
+		var value uint64
+		var valueSize uint64
+		if node.Terminal() {
+			value, valueSize, err = machoutils.ReadULEB128(data, node.TerminalOffset)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse %s entry %q: %w", label, node.Prefix, err)
+			}
+		}
+		if tooBig {
+			if node.Terminal() {
+				entries = append(entries, trieEntry{path: node.Prefix, value: value})
+			}
+			continue
+		}
+
+		name := fmt.Sprintf("Trie Node %q", node.Prefix)
+		if node.Terminal() {
+			name = fmt.Sprintf("Trie Entry %q", node.Prefix)
+		}
+		block, err := me.createCommonBlock(frame.parent, name, subcontracts.UnslidAddress(uint64(offset)+node.Offset), node.Size)
+		if err != nil {
+			return nil, err
+		}
+		terminalOffset := node.TerminalOffset - node.Offset
+		addValue(block, "TerminalSize", node.TerminalSize, 0, uint8(terminalOffset))
+		if node.Terminal() {
+			addValue(block, "Value", value, terminalOffset, uint8(valueSize))
+			entries = append(entries, trieEntry{block: block, path: node.Prefix, value: value})
+		}
+		addValue(block, "ChildCount", len(node.Edges), terminalOffset+node.TerminalSize, 1)
+		for _, edge := range node.Edges {
+			edgeName := fmt.Sprintf("Edge %q", edge.Label)
+			addValue(block, edgeName, edge.Child, edge.Offset, uint8(min(edge.Size, 0xFF)))
+			err = parsingutils.AddLinkWithAddr(block, edgeName, "child", subcontracts.UnslidAddress(uint64(offset)+edge.Child).Calculate(me.slide))
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return entries, nil
+}
+
+func (me *parser) linkTrieEntries(entries []trieEntry, linkName string, resolve func(entry trieEntry) *contracts.MemoryBlock) error {
+	for _, entry := range entries {
+		if entry.block == nil {
+			continue
+		}
+		target := resolve(entry)
+		if target == nil {
+			continue
+		}
+		err := parsingutils.AddLinkWithBlock(entry.block, "Value", target, linkName)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
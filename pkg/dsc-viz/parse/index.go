@@ -0,0 +1,66 @@
+package parse
+
+import (
+	"sort"
+
+	"github.com/LouisBrunner/mem-viz/pkg/contracts"
+)
+
+type indexedSection struct {
+	path    string
+	segment string
+	section string
+	block   *contracts.MemoryBlock
+}
+
+// Keeps track of the images and sections we parsed so that other structures (e.g. Swift conformances) can refer to them
+type imageIndex struct {
+	headers  map[string]*contracts.MemoryBlock
+	sections []indexedSection
+	sorted   bool
+}
+
+func newImageIndex() *imageIndex {
+	return &imageIndex{
+		headers: make(map[string]*contracts.MemoryBlock),
+	}
+}
+
+func (me *imageIndex) addImage(path string, header *contracts.MemoryBlock) {
+	me.headers[path] = header
+}
+
+func (me *imageIndex) addSection(path, segment, section string, block *contracts.MemoryBlock) {
+	me.sections = append(me.sections, indexedSection{
+		path:    path,
+		segment: segment,
+		section: section,
+		block:   block,
+	})
+	me.sorted = false
+}
+
+func (me *imageIndex) findSection(address uintptr) *indexedSection {
+	if !me.sorted {
+		sort.Slice(me.sections, func(i, j int) bool {
+			return me.sections[i].block.Address < me.sections[j].block.Address
+		})
+		me.sorted = true
+	}
+
+	i := sort.Search(len(me.sections), func(i int) bool {
+		return me.sections[i].block.Address > address
+	})
+	if i == 0 {
+		return nil
+	}
+	section := &me.sections[i-1]
+	if address >= section.block.Address+uintptr(section.block.GetSize()) {
+		return nil
+	}
+	return section
+}
+
+func (me *imageIndex) findImage(path string) *contracts.MemoryBlock {
+	return me.headers[path]
+}
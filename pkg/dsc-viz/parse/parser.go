@@ -1,6 +1,7 @@
 package parse
 
 import (
+	"encoding/binary"
 	"fmt"
 	"unsafe"
 
@@ -23,6 +24,10 @@ type parser struct {
 	uniqueBlocks          map[category][]*contracts.MemoryBlock
 	allBlocks             map[uintptr]*[]*contracts.MemoryBlock
 	root                  *contracts.MemoryBlock
+	images                *imageIndex
+	swiftConformances     []swiftConformanceOwner
+	// Byte order of the Mach-O image being parsed, nil means the struct tags are used
+	order binary.ByteOrder
 }
 
 func Parse(logger *logrus.Logger, fetcher subcontracts.Fetcher) (*contracts.MemoryBlock, error) {
@@ -42,6 +47,7 @@ func Parse(logger *logrus.Logger, fetcher subcontracts.Fetcher) (*contracts.Memo
 		thresholdsArrayTooBig: 3000,
 		uniqueBlocks:          make(map[category][]*contracts.MemoryBlock),
 		allBlocks:             make(map[uintptr]*[]*contracts.MemoryBlock),
+		images:                newImageIndex(),
 	}
 	return parser.parse(fetcher)
 }
@@ -111,6 +117,11 @@ func (me *parser) parse(fetcher subcontracts.Fetcher) (*contracts.MemoryBlock, e
 		}
 	}
 
+	err = me.addSwiftConformanceOwners()
+	if err != nil {
+		return nil, err
+	}
+
 	me.logger.Debugf("Rebalancing\n")
 	me.flushCategories()
 	me.rebalance(root, anchors)
@@ -11,7 +11,7 @@ import (
 
 // FIXME: we should move GetReader calls here
 func (me *parser) parseAndAdd(r io.Reader, parent *contracts.MemoryBlock, offset subcontracts.Address, data any, label string) (*contracts.MemoryBlock, error) {
-	err := commons.Unpack(r, data)
+	err := commons.UnpackWithOrder(r, data, me.order)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse %s: %w", label, err)
 	}
@@ -10,15 +10,21 @@ import (
 
 // FIXME: disgusting reflection but no other way unless Go supports generics on function receivers
 
+func formatValue(name string, value interface{}) string {
+	switch value.(type) {
+	case subcontracts.UnslidAddress, subcontracts.UnslidAddress32, subcontracts.RelativeAddress32, subcontracts.RelativeAddress64, subcontracts.LinkEditOffset, subcontracts.ManualAddress:
+		return parsingutils.FormatInteger(name, value)
+	default:
+		return parsingutils.FormatValue(name, value)
+	}
+}
+
 func addValue(block *contracts.MemoryBlock, name string, value interface{}, offset uint64, size uint8) {
-	parsingutils.AddValue(block, name, value, offset, size, func(name string, value interface{}) string {
-		switch value.(type) {
-		case subcontracts.UnslidAddress, subcontracts.UnslidAddress32, subcontracts.RelativeAddress32, subcontracts.RelativeAddress64, subcontracts.LinkEditOffset, subcontracts.ManualAddress:
-			return parsingutils.FormatInteger(name, value)
-		default:
-			return parsingutils.FormatValue(name, value)
-		}
-	})
+	parsingutils.AddValue(block, name, value, offset, size, formatValue)
+}
+
+func addStructValue(block *contracts.MemoryBlock, structType reflect.Type, field reflect.StructField, value interface{}, offset uint64, size uint8) {
+	parsingutils.AddStructValue(block, structType, field, value, offset, size, formatValue)
 }
 
 func copyDataValue(v interface{}) interface{} {
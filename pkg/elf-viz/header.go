@@ -0,0 +1,170 @@
+package elf
+
+import (
+	"debug/elf"
+	"fmt"
+
+	"github.com/LouisBrunner/mem-viz/pkg/contracts"
+	"github.com/LouisBrunner/mem-viz/pkg/elfutils"
+	"github.com/LouisBrunner/mem-viz/pkg/parsingutils"
+)
+
+func (me *parser) addImage(root *contracts.MemoryBlock, img *image) error {
+	header, tables, err := me.addHeader(root, img)
+	if err != nil {
+		return err
+	}
+	err = me.addProgramHeaders(root, header, img, tables)
+	if err != nil {
+		return err
+	}
+	err = me.addSectionHeaders(root, header, img, tables)
+	if err != nil {
+		return err
+	}
+	err = me.addSections(root, img)
+	if err != nil {
+		return err
+	}
+	me.dropOverlappingSegments(img)
+	return me.addSegmentContents(img)
+}
+
+func (me *parser) addHeader(root *contracts.MemoryBlock, img *image) (*contracts.MemoryBlock, *elfutils.Header, error) {
+	header, tables, err := elfutils.ParseHeader(img.data, 0, elfutils.HeaderOptions{
+		Image:   img.layout,
+		Resolve: img.vmToOffset,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	me.addChild(root, header)
+	return header, &tables, nil
+}
+
+func (me *parser) addProgramHeaders(root, header *contracts.MemoryBlock, img *image, tables *elfutils.Header) error {
+	count := uint64(len(img.file.Progs))
+	img.segments = make([]*contracts.MemoryBlock, count)
+	if count == 0 {
+		return nil
+	}
+	data, err := img.slice(tables.Phoff, count*tables.Phentsize)
+	if err != nil {
+		return fmt.Errorf("program headers are not inside the file: %w", err)
+	}
+	programs, err := elfutils.ParseProgramHeaders(data, uintptr(tables.Phoff), elfutils.ProgramHeadersOptions{
+		Image:     img.layout,
+		EntrySize: tables.Phentsize,
+	})
+	if err != nil {
+		return err
+	}
+	me.addChild(root, programs)
+	img.programHeaders = programs
+	err = parsingutils.AddLinkWithBlock(header, "Phoff", programs, "points to")
+	if err != nil {
+		return err
+	}
+	err = parsingutils.AddLinkWithBlock(header, "Phnum", programs, "gives amount")
+	if err != nil {
+		return err
+	}
+
+	for i, prog := range img.file.Progs {
+		typeName := progTypeName(prog.Type)
+		// Segments only made of bss (or PT_GNU_STACK) have nothing in the file
+		if prog.Filesz == 0 {
+			continue
+		}
+		_, err = img.slice(prog.Off, prog.Filesz)
+		if err != nil {
+			return fmt.Errorf("segment %d (%s) is not inside the file: %w", i, typeName, err)
+		}
+		segment := &contracts.MemoryBlock{
+			Name:         fmt.Sprintf("Segment %d (%s)", i, typeName),
+			Address:      uintptr(prog.Off),
+			ParentOffset: prog.Off - uint64(root.Address),
+			Size:         prog.Filesz,
+		}
+		me.segments[segment] = true
+		me.addChild(root, segment)
+		img.segments[i] = segment
+		err = parsingutils.AddLinkWithBlock(programs.Content[i], "Off", segment, "points to")
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (me *parser) addSectionHeaders(root, header *contracts.MemoryBlock, img *image, tables *elfutils.Header) error {
+	count := uint64(len(img.file.Sections))
+	if count == 0 {
+		return nil
+	}
+	sections := me.addRegion(root, fmt.Sprintf("Section Headers (%d)", count), tables.Shoff, count*tables.Shentsize)
+	err := parsingutils.AddLinkWithBlock(header, "Shoff", sections, "points to")
+	if err != nil {
+		return err
+	}
+	err = parsingutils.AddLinkWithBlock(header, "Shnum", sections, "gives amount")
+	if err != nil {
+		return err
+	}
+
+	nameOffsets := make([]uint32, 0, count)
+	for i, sect := range img.file.Sections {
+		name := fmt.Sprintf("Section Header %d", i)
+		if sect.Name != "" {
+			name = fmt.Sprintf("Section Header %d (%s)", i, sect.Name)
+		}
+		var raw any = &elf.Section32{}
+		if img.layout.Is64() {
+			raw = &elf.Section64{}
+		}
+		entry, err := me.addStruct(sections, img, raw, name, tables.Shoff+uint64(i)*tables.Shentsize)
+		if err != nil {
+			return err
+		}
+		img.sectionHeaders = append(img.sectionHeaders, entry)
+		switch raw := raw.(type) {
+		case *elf.Section32:
+			nameOffsets = append(nameOffsets, raw.Name)
+		case *elf.Section64:
+			nameOffsets = append(nameOffsets, raw.Name)
+		}
+	}
+
+	if target, found := img.sectionHeader(tables.Shstrndx); found {
+		err = parsingutils.AddLinkWithAddr(header, "Shstrndx", "refers to", target.Address)
+		if err != nil {
+			return err
+		}
+	}
+	for i, sect := range img.file.Sections {
+		entry := img.sectionHeaders[i]
+		if int(tables.Shstrndx) < len(img.file.Sections) && sect.Type != elf.SHT_NULL {
+			strings := img.file.Sections[tables.Shstrndx]
+			err = parsingutils.AddLinkWithAddr(entry, "Name", "name", uintptr(strings.Offset+uint64(nameOffsets[i])))
+			if err != nil {
+				return err
+			}
+		}
+		if target, found := img.sectionHeader(uint16(sect.Link)); found && sect.Link != 0 {
+			err = parsingutils.AddLinkWithAddr(entry, "Link", "refers to", target.Address)
+			if err != nil {
+				return err
+			}
+		}
+		// sh_info is only a section index for relocations (and when SHF_INFO_LINK is set)
+		if sect.Type == elf.SHT_REL || sect.Type == elf.SHT_RELA || sect.Flags&elf.SHF_INFO_LINK != 0 {
+			if target, found := img.sectionHeader(uint16(sect.Info)); found && sect.Info != 0 {
+				err = parsingutils.AddLinkWithAddr(entry, "Info", "applies to", target.Address)
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,201 @@
+package elf
+
+import (
+	"debug/elf"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/LouisBrunner/mem-viz/pkg/contracts"
+	"github.com/LouisBrunner/mem-viz/pkg/elfutils"
+	"github.com/LouisBrunner/mem-viz/pkg/parsingutils"
+	"golang.org/x/exp/slices"
+)
+
+type image struct {
+	file   *elf.File
+	data   []byte
+	layout elfutils.Image
+	// Where the section headers and segments are in the tree, by index (segments are nil when they aren't in the file)
+	sectionHeaders []*contracts.MemoryBlock
+	segments       []*contracts.MemoryBlock
+	programHeaders *contracts.MemoryBlock
+	// Contents of the sections which are in the file
+	sections []*contracts.MemoryBlock
+	// Names of the symbols of each symbol table, by section index
+	symbols map[int][]string
+}
+
+func (me *image) slice(offset, size uint64) ([]byte, error) {
+	if offset > uint64(len(me.data)) || size > uint64(len(me.data))-offset {
+		return nil, fmt.Errorf("out of bounds: %#x+%#x > %#x", offset, size, len(me.data))
+	}
+	return me.data[offset : offset+size], nil
+}
+
+// Converts a VM address to its file offset, using the PT_LOAD segment containing it (bss has no file offset)
+func (me *image) vmToOffset(vmAddr uint64) (uintptr, bool) {
+	for _, prog := range me.file.Progs {
+		if prog.Type != elf.PT_LOAD {
+			continue
+		}
+		if prog.Vaddr <= vmAddr && vmAddr < prog.Vaddr+prog.Filesz {
+			return uintptr(prog.Off + vmAddr - prog.Vaddr), true
+		}
+	}
+	return 0, false
+}
+
+// Core dumps skip most file mappings (e.g. code), addresses in those are linked to the program header of their segment
+func (me *image) vmToSegment(vmAddr uint64) (uintptr, bool) {
+	if target, mapped := me.vmToOffset(vmAddr); mapped {
+		return target, true
+	}
+	if me.programHeaders == nil {
+		return 0, false
+	}
+	for i, prog := range me.file.Progs {
+		if prog.Type == elf.PT_LOAD && prog.Vaddr <= vmAddr && vmAddr < prog.Vaddr+prog.Memsz {
+			return me.programHeaders.Content[i].Address, true
+		}
+	}
+	return 0, false
+}
+
+// Symbol values are VM addresses in linked images but offsets in their section in relocatable objects
+func (me *image) resolveSymbol(section uint16, value uint64) (uintptr, bool) {
+	if me.file.Type != elf.ET_REL {
+		return me.vmToOffset(value)
+	}
+	if int(section) >= len(me.file.Sections) {
+		return 0, false
+	}
+	sect := me.file.Sections[section]
+	if sect.Type == elf.SHT_NOBITS || value >= sect.Size {
+		return 0, false
+	}
+	return uintptr(sect.Offset + value), true
+}
+
+func (me *image) sectionHeader(index uint16) (elfutils.Target, bool) {
+	if int(index) >= len(me.sectionHeaders) {
+		return elfutils.Target{}, false
+	}
+	return elfutils.Target{
+		Name:    me.file.Sections[index].Name,
+		Address: me.sectionHeaders[index].Address,
+	}, true
+}
+
+// Finds an entry of the symbol table at the given section index
+func (me *image) symbol(table uint32, index uint32) (elfutils.Target, bool) {
+	if table == 0 || int(table) >= len(me.file.Sections) {
+		return elfutils.Target{}, false
+	}
+	names, found := me.symbols[int(table)]
+	if !found || int(index) >= len(names) {
+		return elfutils.Target{}, false
+	}
+	return elfutils.Target{
+		Name:    names[index],
+		Address: uintptr(me.file.Sections[table].Offset + uint64(index)*me.layout.SymbolSize()),
+	}, true
+}
+
+func progTypeName(typ elf.ProgType) string {
+	return elfutils.EnumName(typ, uint64(typ))
+}
+
+func (me *parser) lessThan(a, b *contracts.MemoryBlock) bool {
+	if a.GetSize() == b.GetSize() && me.segments[a] != me.segments[b] {
+		return me.segments[a]
+	}
+	return parsingutils.LessThan(a, b)
+}
+
+func (me *parser) addChild(_parent, child *contracts.MemoryBlock) *contracts.MemoryBlock {
+	sameAddress, found := me.allBlocks[child.Address]
+	if !found {
+		sameAddress = &[]*contracts.MemoryBlock{}
+		me.allBlocks[child.Address] = sameAddress
+	}
+
+	added := false
+	for i, curr := range *sameAddress {
+		if me.lessThan(child, curr) {
+			*sameAddress = slices.Insert(*sameAddress, i, child)
+			added = true
+			break
+		}
+	}
+	if !added {
+		*sameAddress = append(*sameAddress, child)
+	}
+	return child
+}
+
+// Decoded trees often cover their whole section, in which case they are merged into it
+func (me *parser) addDecoded(section, tree *contracts.MemoryBlock) {
+	if tree.Address != section.Address || tree.GetSize() != section.GetSize() {
+		me.addChild(section, tree)
+		return
+	}
+	section.Name = fmt.Sprintf("%s: %s", section.Name, tree.Name)
+	section.Values = append(section.Values, tree.Values...)
+	for _, child := range tree.Content {
+		me.addChild(section, child)
+	}
+}
+
+func overlaps(a, b *contracts.MemoryBlock) bool {
+	if parsingutils.IsInsideOf(a, b) || parsingutils.IsInsideOf(b, a) {
+		return false
+	}
+	return a.Address < b.Address+uintptr(b.GetSize()) && b.Address < a.Address+uintptr(a.GetSize())
+}
+
+func (me *parser) removeChild(child *contracts.MemoryBlock) {
+	sameAddress := me.allBlocks[child.Address]
+	if i := slices.Index(*sameAddress, child); i >= 0 {
+		*sameAddress = slices.Delete(*sameAddress, i, i+1)
+	}
+}
+
+// Blocks can't partially overlap, which some segments do (e.g. PT_GNU_RELRO is page-aligned and can end in the middle of .got.plt),
+// those are dropped and only their program header remains
+func (me *parser) dropOverlappingSegments(img *image) {
+	kept := slices.Clone(img.sections)
+	for i, segment := range img.segments {
+		if segment == nil {
+			continue
+		}
+		if slices.ContainsFunc(kept, func(other *contracts.MemoryBlock) bool { return overlaps(segment, other) }) {
+			me.logger.Debugf("dropping %s as it overlaps other blocks", segment.Name)
+			me.removeChild(segment)
+			delete(me.segments, segment)
+			img.segments[i] = nil
+			continue
+		}
+		kept = append(kept, segment)
+	}
+}
+
+func (me *parser) addRegion(parent *contracts.MemoryBlock, name string, offset, size uint64) *contracts.MemoryBlock {
+	return me.addChild(parent, &contracts.MemoryBlock{
+		Name:         name,
+		Address:      uintptr(offset),
+		ParentOffset: offset - uint64(parent.Address),
+		Size:         size,
+	})
+}
+
+// Unpacks one of the debug/elf structs (e.g. elf.Prog64) from the file and adds it as a block
+func (me *parser) addStruct(parent *contracts.MemoryBlock, img *image, v any, name string, offset uint64) (*contracts.MemoryBlock, error) {
+	err := elfutils.ReadStruct(img.data, offset, img.layout.ByteOrder, v)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", name, err)
+	}
+	size := uint64(binary.Size(v))
+	block := me.addRegion(parent, name, offset, size)
+	parsingutils.AddStructValues(block, v, size, parsingutils.FormatValue)
+	return block, nil
+}
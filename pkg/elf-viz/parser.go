@@ -0,0 +1,86 @@
+package elf
+
+import (
+	"bytes"
+	"debug/elf"
+	"os"
+
+	"github.com/LouisBrunner/mem-viz/pkg/contracts"
+	"github.com/LouisBrunner/mem-viz/pkg/elfutils"
+	"github.com/LouisBrunner/mem-viz/pkg/parsingutils"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
+)
+
+type parser struct {
+	logger    *logrus.Logger
+	allBlocks map[uintptr]*[]*contracts.MemoryBlock
+	// Segments wrap the sections and tables they share their bounds with (e.g. PT_INTERP and .interp)
+	segments map[*contracts.MemoryBlock]bool
+}
+
+func Parse(logger *logrus.Logger, file string) (*contracts.MemoryBlock, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	return ParseData(logger, file, data)
+}
+
+// Parses an ELF image which is already loaded (e.g. the member of a static archive), name is given to the root block
+func ParseData(logger *logrus.Logger, name string, data []byte) (*contracts.MemoryBlock, error) {
+	p := &parser{
+		logger:    logger,
+		allBlocks: make(map[uintptr]*[]*contracts.MemoryBlock),
+		segments:  make(map[*contracts.MemoryBlock]bool),
+	}
+	return p.parse(name, data)
+}
+
+func (me *parser) parse(file string, data []byte) (*contracts.MemoryBlock, error) {
+	f, err := elf.NewFile(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	root := &contracts.MemoryBlock{
+		Name: file,
+		Size: uint64(len(data)),
+	}
+	img := &image{
+		file: f,
+		data: data,
+		layout: elfutils.Image{
+			Class:     f.Class,
+			ByteOrder: f.ByteOrder,
+			Machine:   f.Machine,
+		},
+		symbols: map[int][]string{},
+	}
+	err = me.addImage(root, img)
+	if err != nil {
+		return nil, err
+	}
+
+	me.rebalance(root)
+
+	return root, nil
+}
+
+func (me *parser) rebalance(root *contracts.MemoryBlock) {
+	addresses := maps.Keys(me.allBlocks)
+	slices.Sort(addresses)
+
+	for _, address := range addresses {
+		sameAddress := me.allBlocks[address]
+		for _, block := range *sameAddress {
+			newParent, sibling := parsingutils.AddChildDeep(root, block)
+			if sibling != nil {
+				me.logger.Warnf("dropping %s as it overlaps %s", block.Name, sibling.Name)
+				continue
+			}
+			block.ParentOffset = uint64(block.Address - newParent.Address)
+		}
+	}
+}
@@ -0,0 +1,255 @@
+package elf
+
+import (
+	"debug/elf"
+	"fmt"
+
+	"github.com/LouisBrunner/mem-viz/pkg/contracts"
+	"github.com/LouisBrunner/mem-viz/pkg/elfutils"
+	"github.com/LouisBrunner/mem-viz/pkg/parsingutils"
+)
+
+func (me *parser) addSections(root *contracts.MemoryBlock, img *image) error {
+	// Symbol tables go first as relocations and hash tables are named after their symbols
+	trees := map[int]*contracts.MemoryBlock{}
+	for i, sect := range img.file.Sections {
+		if sect.Type != elf.SHT_SYMTAB && sect.Type != elf.SHT_DYNSYM {
+			continue
+		}
+		tree, err := me.decodeSymbols(img, i, sect)
+		if err != nil {
+			return fmt.Errorf("failed to parse section %d (%s): %w", i, sect.Name, err)
+		}
+		trees[i] = tree
+	}
+
+	for i, sect := range img.file.Sections {
+		// Size is the uncompressed one for SHF_COMPRESSED sections
+		if sect.Type == elf.SHT_NULL || sect.Type == elf.SHT_NOBITS || sect.FileSize == 0 {
+			continue
+		}
+		data, err := img.slice(sect.Offset, sect.FileSize)
+		if err != nil {
+			return fmt.Errorf("section %d (%s) is not inside the file: %w", i, sect.Name, err)
+		}
+		block := me.addRegion(root, fmt.Sprintf("Section %d (%s)", i, sect.Name), sect.Offset, sect.FileSize)
+		img.sections = append(img.sections, block)
+		err = parsingutils.AddLinkWithBlock(img.sectionHeaders[i], "Off", block, "points to")
+		if err != nil {
+			return err
+		}
+
+		tree, found := trees[i]
+		if !found && sect.Flags&elf.SHF_COMPRESSED == 0 {
+			tree, err = me.decodeSection(img, sect, data, block.Address)
+			if err != nil {
+				return fmt.Errorf("failed to parse section %d (%s): %w", i, sect.Name, err)
+			}
+		}
+		if tree != nil {
+			me.addDecoded(block, tree)
+		}
+	}
+	return nil
+}
+
+// String tables are given by sh_link, nil if they are missing
+func (me *parser) linkedStrings(img *image, sect *elf.Section) ([]byte, uintptr) {
+	if sect.Link == 0 || int(sect.Link) >= len(img.file.Sections) {
+		return nil, 0
+	}
+	strings := img.file.Sections[sect.Link]
+	if strings.Type == elf.SHT_NOBITS {
+		return nil, 0
+	}
+	data, err := img.slice(strings.Offset, strings.FileSize)
+	if err != nil {
+		me.logger.WithError(err).Warnf("invalid string table for %s", sect.Name)
+		return nil, 0
+	}
+	return data, uintptr(strings.Offset)
+}
+
+func (me *parser) decodeSymbols(img *image, index int, sect *elf.Section) (*contracts.MemoryBlock, error) {
+	data, err := img.slice(sect.Offset, sect.FileSize)
+	if err != nil {
+		return nil, err
+	}
+	strings, stringsAddress := me.linkedStrings(img, sect)
+	tree, names, err := elfutils.ParseSymbols(data, uintptr(sect.Offset), elfutils.SymbolsOptions{
+		Image:          img.layout,
+		Strings:        strings,
+		StringsAddress: stringsAddress,
+		Section:        img.sectionHeader,
+		Resolve:        img.resolveSymbol,
+	})
+	if err != nil {
+		return nil, err
+	}
+	img.symbols[index] = names
+	return tree, nil
+}
+
+func (me *parser) decodeSection(img *image, sect *elf.Section, data []byte, address uintptr) (*contracts.MemoryBlock, error) {
+	symbol := func(index uint32) (elfutils.Target, bool) {
+		return img.symbol(sect.Link, index)
+	}
+
+	switch sect.Type {
+	case elf.SHT_STRTAB:
+		return elfutils.ParseStrings(data, address)
+	case elf.SHT_DYNAMIC:
+		strings, stringsAddress := me.linkedStrings(img, sect)
+		return elfutils.ParseDynamic(data, address, elfutils.DynamicOptions{
+			Image:          img.layout,
+			Strings:        strings,
+			StringsAddress: stringsAddress,
+			Resolve:        img.vmToOffset,
+		})
+	case elf.SHT_REL, elf.SHT_RELA:
+		return elfutils.ParseRelocations(data, address, elfutils.RelocationOptions{
+			Image:   img.layout,
+			Addend:  sect.Type == elf.SHT_RELA,
+			Resolve: me.relocationResolver(img, sect),
+			Symbol:  symbol,
+		})
+	case elf.SHT_NOTE:
+		tree, _, err := elfutils.ParseNotes(data, address, elfutils.NotesOptions{
+			Image:   img.layout,
+			Align:   sect.Addralign,
+			Resolve: img.vmToSegment,
+		})
+		return tree, err
+	case elf.SHT_GNU_HASH:
+		return elfutils.ParseGNUHash(data, address, elfutils.HashOptions{
+			Image:  img.layout,
+			Symbol: symbol,
+		})
+	case elf.SHT_HASH:
+		return elfutils.ParseSysVHash(data, address, elfutils.HashOptions{
+			Image:  img.layout,
+			Symbol: symbol,
+		})
+	}
+	return nil, nil
+}
+
+// r_offset is a VM address in linked images but an offset in the section given by sh_info in relocatable objects
+func (me *parser) relocationResolver(img *image, sect *elf.Section) func(offset uint64) (uintptr, bool) {
+	if img.file.Type != elf.ET_REL {
+		return img.vmToOffset
+	}
+	return func(offset uint64) (uintptr, bool) {
+		if sect.Info == 0 || int(sect.Info) >= len(img.file.Sections) {
+			return 0, false
+		}
+		target := img.file.Sections[sect.Info]
+		if target.Type == elf.SHT_NOBITS || offset >= target.Size {
+			return 0, false
+		}
+		return uintptr(target.Offset + offset), true
+	}
+}
+
+// Without section headers (e.g. stripped with sstrip), the dynamic entries and notes can still be found through the segments
+func (me *parser) addSegmentContents(img *image) error {
+	hasSection := func(typ elf.SectionType) bool {
+		for _, sect := range img.file.Sections {
+			if sect.Type == typ {
+				return true
+			}
+		}
+		return false
+	}
+
+	for i, prog := range img.file.Progs {
+		segment := img.segments[i]
+		if segment == nil {
+			continue
+		}
+		data, err := img.slice(prog.Off, prog.Filesz)
+		if err != nil {
+			return err
+		}
+		var tree *contracts.MemoryBlock
+		switch {
+		case prog.Type == elf.PT_DYNAMIC && !hasSection(elf.SHT_DYNAMIC):
+			strings, stringsAddress := me.dynamicStrings(img, data)
+			tree, err = elfutils.ParseDynamic(data, segment.Address, elfutils.DynamicOptions{
+				Image:          img.layout,
+				Strings:        strings,
+				StringsAddress: stringsAddress,
+				Resolve:        img.vmToOffset,
+			})
+		case prog.Type == elf.PT_NOTE && !hasSection(elf.SHT_NOTE):
+			var notes []elfutils.Note
+			tree, notes, err = elfutils.ParseNotes(data, segment.Address, elfutils.NotesOptions{
+				Image:   img.layout,
+				Align:   prog.Align,
+				Resolve: img.vmToSegment,
+			})
+			if err == nil {
+				me.nameCoreSegments(img, notes)
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("failed to parse segment %d (%s): %w", i, progTypeName(prog.Type), err)
+		}
+		if tree != nil {
+			me.addDecoded(segment, tree)
+		}
+	}
+	return nil
+}
+
+// Finds the dynamic string table using DT_STRTAB and DT_STRSZ, nil if it isn't in the file
+func (me *parser) dynamicStrings(img *image, dynamic []byte) ([]byte, uintptr) {
+	word := img.layout.WordSize()
+	values := map[elf.DynTag]uint64{}
+	for offset := uint64(0); offset+2*word <= uint64(len(dynamic)); offset += 2 * word {
+		tag, value := img.layout.ReadWord(dynamic, offset), img.layout.ReadWord(dynamic, offset+word)
+		if elf.DynTag(tag) == elf.DT_NULL {
+			break
+		}
+		values[elf.DynTag(tag)] = value
+	}
+	address, mapped := img.vmToOffset(values[elf.DT_STRTAB])
+	if !mapped {
+		return nil, 0
+	}
+	data, err := img.slice(uint64(address), values[elf.DT_STRSZ])
+	if err != nil {
+		me.logger.WithError(err).Warn("invalid dynamic string table")
+		return nil, 0
+	}
+	return data, address
+}
+
+// Core dumps list the files backing their PT_LOAD segments in NT_FILE, which are used to name the segments
+func (me *parser) nameCoreSegments(img *image, notes []elfutils.Note) {
+	if img.file.Type != elf.ET_CORE {
+		return
+	}
+	for _, note := range notes {
+		if note.Owner != "CORE" || note.Type != elfutils.NT_FILE {
+			continue
+		}
+		files, err := elfutils.ParseCoreFiles(note.Description, img.layout)
+		if err != nil {
+			me.logger.WithError(err).Warn("invalid NT_FILE note")
+			return
+		}
+		for i, prog := range img.file.Progs {
+			segment := img.segments[i]
+			if segment == nil || prog.Type != elf.PT_LOAD {
+				continue
+			}
+			for _, file := range files {
+				if file.Start <= prog.Vaddr && prog.Vaddr < file.End {
+					segment.Name = fmt.Sprintf("Segment %d (%s %s)", i, progTypeName(prog.Type), file.Path)
+					break
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package elfutils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/LouisBrunner/mem-viz/pkg/contracts"
+	"github.com/LouisBrunner/mem-viz/pkg/parsingutils"
+)
+
+// All decoders in this package work on a raw byte slice and return a self-contained tree of blocks
+// starting at the given address, it's up to the caller to graft it where it belongs
+
+func newBlock(name string, address uintptr, size uint64) *contracts.MemoryBlock {
+	return &contracts.MemoryBlock{
+		Name:    name,
+		Address: address,
+		Size:    size,
+	}
+}
+
+func addChild(parent *contracts.MemoryBlock, name string, offset, size uint64) *contracts.MemoryBlock {
+	child := &contracts.MemoryBlock{
+		Name:         name,
+		Address:      parent.Address + uintptr(offset),
+		Size:         size,
+		ParentOffset: offset,
+	}
+	parent.Content = append(parent.Content, child)
+	return child
+}
+
+func addValue(block *contracts.MemoryBlock, name string, value interface{}, offset uint64, size uint8) {
+	parsingutils.AddValue(block, name, value, offset, size, parsingutils.FormatValue)
+}
+
+func subSlice(data []byte, offset, size uint64) ([]byte, error) {
+	if offset > uint64(len(data)) || size > uint64(len(data))-offset {
+		return nil, fmt.Errorf("out of bounds: %#x+%#x > %#x", offset, size, len(data))
+	}
+	return data[offset : offset+size], nil
+}
+
+// Reads a NUL-terminated string, strings running until the end of the data are accepted (like readelf does)
+func ReadCString(data []byte, offset uint64) (string, error) {
+	if offset >= uint64(len(data)) {
+		return "", fmt.Errorf("out of bounds: %#x >= %#x", offset, len(data))
+	}
+	end := bytes.IndexByte(data[offset:], 0)
+	if end < 0 {
+		return string(data[offset:]), nil
+	}
+	return string(data[offset : offset+uint64(end)]), nil
+}
+
+// Unpacks one of the debug/elf structs (e.g. elf.Sym64) at offset
+func ReadStruct(data []byte, offset uint64, order binary.ByteOrder, v any) error {
+	raw, err := subSlice(data, offset, uint64(binary.Size(v)))
+	if err != nil {
+		return err
+	}
+	return binary.Read(bytes.NewReader(raw), order, v)
+}
+
+// Unpacks the struct at offset and adds it as a child block with one value per field
+func addStruct(parent *contracts.MemoryBlock, data []byte, order binary.ByteOrder, v any, name string, offset uint64) (*contracts.MemoryBlock, error) {
+	err := ReadStruct(data, offset, order, v)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", name, err)
+	}
+	size := uint64(binary.Size(v))
+	block := addChild(parent, name, offset, size)
+	parsingutils.AddStructValues(block, v, size, parsingutils.FormatValue)
+	return block, nil
+}
@@ -0,0 +1,371 @@
+package elfutils
+
+import (
+	"debug/elf"
+	"fmt"
+	"path/filepath"
+
+	"github.com/LouisBrunner/mem-viz/pkg/contracts"
+	"github.com/LouisBrunner/mem-viz/pkg/parsingutils"
+)
+
+// From Linux's include/uapi/linux/elf.h, used by core dumps
+const (
+	NT_PRSTATUS   = 1
+	NT_PRFPREG    = 2
+	NT_PRPSINFO   = 3
+	NT_TASKSTRUCT = 4
+	NT_AUXV       = 6
+	NT_SIGINFO    = 0x53494749
+	NT_FILE       = 0x46494c45
+	NT_PRXFPREG   = 0x46e62b7f
+)
+
+var coreNoteTypes = map[uint32]string{
+	NT_PRSTATUS:   "NT_PRSTATUS",
+	NT_PRFPREG:    "NT_PRFPREG",
+	NT_PRPSINFO:   "NT_PRPSINFO",
+	NT_TASKSTRUCT: "NT_TASKSTRUCT",
+	NT_AUXV:       "NT_AUXV",
+	NT_SIGINFO:    "NT_SIGINFO",
+	NT_FILE:       "NT_FILE",
+}
+
+// Extra register sets, all of them use the LINUX owner
+var linuxNoteTypes = map[uint32]string{
+	NT_PRXFPREG: "NT_PRXFPREG",
+	0x200:       "NT_386_TLS",
+	0x201:       "NT_386_IOPERM",
+	0x202:       "NT_X86_XSTATE",
+	0x204:       "NT_X86_SHSTK",
+	0x205:       "NT_X86_XSAVE_LAYOUT",
+	0x400:       "NT_ARM_VFP",
+	0x401:       "NT_ARM_TLS",
+	0x402:       "NT_ARM_HW_BREAK",
+	0x403:       "NT_ARM_HW_WATCH",
+	0x404:       "NT_ARM_SYSTEM_CALL",
+	0x405:       "NT_ARM_SVE",
+	0x406:       "NT_ARM_PAC_MASK",
+	0x409:       "NT_ARM_TAGGED_ADDR_CTRL",
+	0x900:       "NT_RISCV_CSR",
+}
+
+// Layout of pr_reg in NT_PRSTATUS (user_regs_struct in the kernel)
+type coreRegisters struct {
+	names []string
+	// Registers which are linked to the memory they point to
+	pc string
+	sp string
+}
+
+var coreRegisterSets = map[elf.Machine]coreRegisters{
+	elf.EM_X86_64: {
+		names: []string{
+			"r15", "r14", "r13", "r12", "rbp", "rbx", "r11", "r10", "r9", "r8", "rax", "rcx", "rdx", "rsi", "rdi", "orig_rax",
+			"rip", "cs", "eflags", "rsp", "ss", "fs_base", "gs_base", "ds", "es", "fs", "gs",
+		},
+		pc: "rip",
+		sp: "rsp",
+	},
+	elf.EM_386: {
+		names: []string{"ebx", "ecx", "edx", "esi", "edi", "ebp", "eax", "ds", "es", "fs", "gs", "orig_eax", "eip", "cs", "eflags", "esp", "ss"},
+		pc:    "eip",
+		sp:    "esp",
+	},
+	elf.EM_AARCH64: {
+		names: []string{
+			"x0", "x1", "x2", "x3", "x4", "x5", "x6", "x7", "x8", "x9", "x10", "x11", "x12", "x13", "x14", "x15",
+			"x16", "x17", "x18", "x19", "x20", "x21", "x22", "x23", "x24", "x25", "x26", "x27", "x28", "x29", "x30",
+			"sp", "pc", "pstate",
+		},
+		pc: "pc",
+		sp: "sp",
+	},
+	elf.EM_ARM: {
+		names: []string{"r0", "r1", "r2", "r3", "r4", "r5", "r6", "r7", "r8", "r9", "r10", "fp", "ip", "sp", "lr", "pc", "cpsr", "orig_r0"},
+		pc:    "pc",
+		sp:    "sp",
+	},
+	elf.EM_RISCV: {
+		names: []string{
+			"pc", "ra", "sp", "gp", "tp", "t0", "t1", "t2", "s0", "s1", "a0", "a1", "a2", "a3", "a4", "a5",
+			"a6", "a7", "s2", "s3", "s4", "s5", "s6", "s7", "s8", "s9", "s10", "s11", "t3", "t4", "t5", "t6",
+		},
+		pc: "pc",
+		sp: "sp",
+	},
+}
+
+// Generic Linux numbering (some architectures like MIPS or Alpha differ)
+var signalNames = []string{
+	1: "SIGHUP", 2: "SIGINT", 3: "SIGQUIT", 4: "SIGILL", 5: "SIGTRAP", 6: "SIGABRT", 7: "SIGBUS", 8: "SIGFPE",
+	9: "SIGKILL", 10: "SIGUSR1", 11: "SIGSEGV", 12: "SIGUSR2", 13: "SIGPIPE", 14: "SIGALRM", 15: "SIGTERM", 16: "SIGSTKFLT",
+	17: "SIGCHLD", 18: "SIGCONT", 19: "SIGSTOP", 20: "SIGTSTP", 21: "SIGTTIN", 22: "SIGTTOU", 23: "SIGURG", 24: "SIGXCPU",
+	25: "SIGXFSZ", 26: "SIGVTALRM", 27: "SIGPROF", 28: "SIGWINCH", 29: "SIGIO", 30: "SIGPWR", 31: "SIGSYS",
+}
+
+func SignalName(signal uint32) string {
+	if int(signal) < len(signalNames) && signalNames[signal] != "" {
+		return signalNames[signal]
+	}
+	return fmt.Sprintf("%d", signal)
+}
+
+// Signals raised by a fault, their siginfo contains the faulting address
+var faultSignals = map[uint32]bool{4: true, 5: true, 7: true, 8: true, 11: true}
+
+// From Linux's include/uapi/linux/auxvec.h
+var auxvTypes = map[uint64]string{
+	0:  "AT_NULL",
+	1:  "AT_IGNORE",
+	2:  "AT_EXECFD",
+	3:  "AT_PHDR",
+	4:  "AT_PHENT",
+	5:  "AT_PHNUM",
+	6:  "AT_PAGESZ",
+	7:  "AT_BASE",
+	8:  "AT_FLAGS",
+	9:  "AT_ENTRY",
+	10: "AT_NOTELF",
+	11: "AT_UID",
+	12: "AT_EUID",
+	13: "AT_GID",
+	14: "AT_EGID",
+	15: "AT_PLATFORM",
+	16: "AT_HWCAP",
+	17: "AT_CLKTCK",
+	23: "AT_SECURE",
+	24: "AT_BASE_PLATFORM",
+	25: "AT_RANDOM",
+	26: "AT_HWCAP2",
+	27: "AT_RSEQ_FEATURE_SIZE",
+	28: "AT_RSEQ_ALIGN",
+	29: "AT_HWCAP3",
+	30: "AT_HWCAP4",
+	31: "AT_EXECFN",
+	32: "AT_SYSINFO",
+	33: "AT_SYSINFO_EHDR",
+	51: "AT_MINSIGSTKSZ",
+}
+
+// Auxiliary vector entries whose value is an address in the process
+var auxvPointers = map[uint64]bool{
+	3:  true,
+	7:  true,
+	9:  true,
+	15: true,
+	24: true,
+	25: true,
+	31: true,
+	32: true,
+	33: true,
+}
+
+func AuxvTypeName(typ uint64) string {
+	if name, found := auxvTypes[typ]; found {
+		return name
+	}
+	return fmt.Sprintf("%#x", typ)
+}
+
+// An entry of NT_FILE, the range [Start, End) of the process maps Path from Offset
+type CoreFile struct {
+	Start  uint64
+	End    uint64
+	Offset uint64
+	Path   string
+}
+
+// Decodes the description of a NT_FILE note: count, page size, the ranges (in pages for the offset) and then the paths
+func ParseCoreFiles(desc []byte, image Image) ([]CoreFile, error) {
+	word := image.WordSize()
+	if uint64(len(desc)) < 2*word {
+		return nil, fmt.Errorf("NT_FILE too small: %#x", len(desc))
+	}
+	count := image.ReadWord(desc, 0)
+	pageSize := image.ReadWord(desc, word)
+	paths := 2*word + count*3*word
+	if count > uint64(len(desc))/(3*word) || paths > uint64(len(desc)) {
+		return nil, fmt.Errorf("NT_FILE too small for %d entries", count)
+	}
+	files := make([]CoreFile, 0, count)
+	for i, offset := uint64(0), paths; i < count; i += 1 {
+		entry := 2*word + i*3*word
+		path, err := ReadCString(desc, offset)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read path of NT_FILE entry %d: %w", i, err)
+		}
+		offset += uint64(len(path)) + 1
+		files = append(files, CoreFile{
+			Start:  image.ReadWord(desc, entry),
+			End:    image.ReadWord(desc, entry+word),
+			Offset: image.ReadWord(desc, entry+2*word) * pageSize,
+			Path:   path,
+		})
+	}
+	return files, nil
+}
+
+// The decoded description is added to the note like the GNU ones, bigger structures go in child blocks
+func addCoreDescription(block *contracts.MemoryBlock, offset uint64, note Note, options NotesOptions) error {
+	switch note.Type {
+	case NT_PRSTATUS:
+		return addPRStatus(block, offset, note.Description, options)
+	case NT_SIGINFO:
+		return addSigInfo(block, offset, note.Description, options)
+	case NT_AUXV:
+		return addAuxv(block, offset, note.Description, options)
+	case NT_FILE:
+		return addCoreFiles(block, offset, note.Description, options)
+	}
+	return nil
+}
+
+func addSignal(block *contracts.MemoryBlock, name string, signal uint32, offset uint64, size uint8) {
+	parsingutils.AddFormattedValue(block, name, signal, offset, size, func(value interface{}) (string, bool) {
+		return SignalName(signal), true
+	})
+}
+
+func addPointer(block *contracts.MemoryBlock, name string, value uint64, options NotesOptions) error {
+	if options.Resolve == nil || value == 0 {
+		return nil
+	}
+	target, mapped := options.Resolve(value)
+	if !mapped {
+		return nil
+	}
+	return parsingutils.AddLinkWithAddr(block, name, "points to", target)
+}
+
+// struct elf_prstatus: elf_siginfo (signo, code, errno), cursig, sigpend, sighold, pid, ppid, pgrp, sid, 4 timevals and pr_reg
+func addPRStatus(block *contracts.MemoryBlock, offset uint64, desc []byte, options NotesOptions) error {
+	word := options.WordSize()
+	regsOffset := uint64(72)
+	if options.Is64() {
+		regsOffset = 112
+	}
+	if uint64(len(desc)) < regsOffset {
+		return nil
+	}
+	order := options.order()
+	pid := order.Uint32(desc[16+2*word:])
+	addSignal(block, "Signal", order.Uint32(desc), offset, 4)
+	addValue(block, "Code", int32(order.Uint32(desc[4:])), offset+4, 4)
+	addValue(block, "Errno", int32(order.Uint32(desc[8:])), offset+8, 4)
+	addSignal(block, "Cursig", uint32(order.Uint16(desc[12:])), offset+12, 2)
+	addValue(block, "Sigpend", options.ReadWord(desc, 16), offset+16, uint8(word))
+	addValue(block, "Sighold", options.ReadWord(desc, 16+word), offset+16+word, uint8(word))
+	addValue(block, "Pid", pid, offset+16+2*word, 4)
+	addValue(block, "Ppid", order.Uint32(desc[20+2*word:]), offset+20+2*word, 4)
+	addValue(block, "Pgrp", order.Uint32(desc[24+2*word:]), offset+24+2*word, 4)
+	addValue(block, "Sid", order.Uint32(desc[28+2*word:]), offset+28+2*word, 4)
+
+	set, found := coreRegisterSets[options.Machine]
+	size := uint64(len(set.names)) * word
+	if !found || regsOffset+size > uint64(len(desc)) {
+		return nil
+	}
+	registers := addChild(block, fmt.Sprintf("Registers (thread %d)", pid), offset+regsOffset, size)
+	for i, name := range set.names {
+		addValue(registers, name, options.ReadWord(desc, regsOffset+uint64(i)*word), uint64(i)*word, uint8(word))
+	}
+	for i, name := range set.names {
+		if name != set.pc && name != set.sp {
+			continue
+		}
+		err := addPointer(registers, name, options.ReadWord(desc, regsOffset+uint64(i)*word), options)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// siginfo_t: signo, errno, code and then a union which starts with the faulting address for SIGSEGV and friends
+func addSigInfo(block *contracts.MemoryBlock, offset uint64, desc []byte, options NotesOptions) error {
+	word := options.WordSize()
+	// The union is aligned on a word
+	unionOffset := alignUp(12, word)
+	if uint64(len(desc)) < unionOffset+word {
+		return nil
+	}
+	order := options.order()
+	signal := order.Uint32(desc)
+	code := int32(order.Uint32(desc[8:]))
+	addSignal(block, "Signal", signal, offset, 4)
+	addValue(block, "Errno", int32(order.Uint32(desc[4:])), offset+4, 4)
+	addValue(block, "Code", code, offset+8, 4)
+	switch {
+	case faultSignals[signal] && code > 0:
+		addValue(block, "Addr", options.ReadWord(desc, unionOffset), offset+unionOffset, uint8(word))
+		return addPointer(block, "Addr", options.ReadWord(desc, unionOffset), options)
+	case code <= 0:
+		// Sent by a process (SI_USER, SI_TKILL, etc)
+		addValue(block, "Pid", order.Uint32(desc[unionOffset:]), offset+unionOffset, 4)
+		addValue(block, "Uid", order.Uint32(desc[unionOffset+4:]), offset+unionOffset+4, 4)
+	}
+	return nil
+}
+
+func addAuxv(block *contracts.MemoryBlock, offset uint64, desc []byte, options NotesOptions) error {
+	word := options.WordSize()
+	count := uint64(len(desc)) / (2 * word)
+	if count == 0 {
+		return nil
+	}
+	auxv := addChild(block, fmt.Sprintf("Auxiliary Vector (%d entries)", count), offset, count*2*word)
+	for i := uint64(0); i < count; i += 1 {
+		typ, value := options.ReadWord(desc, i*2*word), options.ReadWord(desc, i*2*word+word)
+		typeName := AuxvTypeName(typ)
+		entry := addChild(auxv, typeName, i*2*word, 2*word)
+		addValue(entry, "Type", typeName, 0, uint8(word))
+		addValue(entry, "Value", value, word, uint8(word))
+		if !auxvPointers[typ] {
+			continue
+		}
+		err := addPointer(entry, "Value", value, options)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func addCoreFiles(block *contracts.MemoryBlock, offset uint64, desc []byte, options NotesOptions) error {
+	files, err := ParseCoreFiles(desc, options.Image)
+	if err != nil {
+		return err
+	}
+	word := options.WordSize()
+	addValue(block, "Count", options.ReadWord(desc, 0), offset, uint8(word))
+	addValue(block, "Page Size", options.ReadWord(desc, word), offset+word, uint8(word))
+	for i, file := range files {
+		entry := addChild(block, fmt.Sprintf("File %d (%s)", i, filepath.Base(file.Path)), offset+2*word+uint64(i)*3*word, 3*word)
+		addValue(entry, "Start", file.Start, 0, uint8(word))
+		addValue(entry, "End", file.End, word, uint8(word))
+		addValue(entry, "Page Offset", options.ReadWord(desc, 2*word+uint64(i)*3*word+2*word), 2*word, uint8(word))
+		err = addPointer(entry, "Start", file.Start, options)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Only the paths are kept, the description can be padded
+	paths, end := 2*word+uint64(len(files))*3*word, uint64(len(desc))
+	if len(files) > 0 {
+		end = paths
+		for _, file := range files {
+			end += uint64(len(file.Path)) + 1
+		}
+		end = min(end, uint64(len(desc)))
+	}
+	tree, err := ParseStrings(desc[paths:end], block.Address+uintptr(offset+paths))
+	if err != nil {
+		return err
+	}
+	tree.ParentOffset = offset + paths
+	tree.Name = fmt.Sprintf("Paths (%d)", len(tree.Content))
+	block.Content = append(block.Content, tree)
+	return nil
+}
@@ -0,0 +1,125 @@
+package elfutils_test
+
+import (
+	"debug/elf"
+	"encoding/binary"
+	"testing"
+
+	"github.com/LouisBrunner/mem-viz/pkg/contracts/contractstest"
+	"github.com/LouisBrunner/mem-viz/pkg/elfutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var coreOwner = [8]byte{'C', 'O', 'R', 'E'}
+
+// The text is mapped at 0x1000 in the file, the rest isn't
+func resolveCore(vmAddr uint64) (uintptr, bool) {
+	if vmAddr < 0x400000 || vmAddr >= 0x402000 {
+		return 0, false
+	}
+	return uintptr(vmAddr - 0x400000 + 0x1000), true
+}
+
+func Test_ParseNotes_core(t *testing.T) {
+	prstatus := [336]byte{}
+	binary.LittleEndian.PutUint32(prstatus[0:], 11)
+	binary.LittleEndian.PutUint16(prstatus[12:], 11)
+	binary.LittleEndian.PutUint32(prstatus[32:], 1234)
+	binary.LittleEndian.PutUint64(prstatus[112+16*8:], 0x401000)
+	binary.LittleEndian.PutUint64(prstatus[112+19*8:], 0x7ffc0000)
+	siginfo := [128]byte{}
+	binary.LittleEndian.PutUint32(siginfo[0:], 11)
+	binary.LittleEndian.PutUint32(siginfo[8:], 1)
+	binary.LittleEndian.PutUint64(siginfo[16:], 0x401000)
+
+	data := pack(t, binary.LittleEndian,
+		uint32(5), uint32(len(prstatus)), uint32(elfutils.NT_PRSTATUS), coreOwner, prstatus,
+		uint32(5), uint32(len(siginfo)), uint32(elfutils.NT_SIGINFO), coreOwner, siginfo,
+		uint32(5), uint32(48), uint32(elfutils.NT_AUXV), coreOwner, uint64(9), uint64(0x401000), uint64(6), uint64(0x1000), uint64(0), uint64(0),
+		uint32(5), uint32(52), uint32(elfutils.NT_FILE), coreOwner, uint64(1), uint64(0x1000), uint64(0x400000), uint64(0x402000), uint64(0), [12]byte{'/', 'b', 'i', 'n', '/', 't', 'r', 'u', 'e'},
+	)
+	tree, notes, err := elfutils.ParseNotes(data, 0x100, elfutils.NotesOptions{
+		Image:   elfutils.Image{Class: elf.ELFCLASS64, Machine: elf.EM_X86_64},
+		Resolve: resolveCore,
+	})
+	require.NoError(t, err)
+	require.Len(t, notes, 4)
+	require.Len(t, tree.Content, 4)
+
+	status := tree.Content[0]
+	assert.Equal(t, "Note CORE (NT_PRSTATUS)", status.Name)
+	assert.Equal(t, "SIGSEGV", contractstest.FindValue(t, status, "Signal").Value)
+	assert.Equal(t, uint64(11), contractstest.FindValue(t, status, "Signal").Raw)
+	assert.Equal(t, "SIGSEGV", contractstest.FindValue(t, status, "Cursig").Value)
+	require.Len(t, status.Content, 1)
+	registers := status.Content[0]
+	assert.Equal(t, "Registers (thread 1234)", registers.Name)
+	assert.Equal(t, uintptr(0x100+20+112), registers.Address)
+	assert.Len(t, registers.Values, 27)
+	assert.Equal(t, "0x401000", contractstest.FindValue(t, registers, "rip").Value)
+	require.Len(t, contractstest.FindValue(t, registers, "rip").Links, 1)
+	assert.Equal(t, uint64(0x2000), contractstest.FindValue(t, registers, "rip").Links[0].TargetAddress)
+	assert.Len(t, contractstest.FindValue(t, registers, "rsp").Links, 0)
+	assert.Len(t, contractstest.FindValue(t, registers, "rax").Links, 0)
+
+	signal := tree.Content[1]
+	assert.Equal(t, "Note CORE (NT_SIGINFO)", signal.Name)
+	assert.Equal(t, "0x1", contractstest.FindValue(t, signal, "Code").Value)
+	assert.Equal(t, uint64(0x2000), contractstest.FindValue(t, signal, "Addr").Links[0].TargetAddress)
+
+	auxv := tree.Content[2]
+	require.Len(t, auxv.Content, 1)
+	assert.Equal(t, "Auxiliary Vector (3 entries)", auxv.Content[0].Name)
+	require.Len(t, auxv.Content[0].Content, 3)
+	entry := auxv.Content[0].Content[0]
+	assert.Equal(t, "AT_ENTRY", entry.Name)
+	assert.Equal(t, uint64(0x2000), contractstest.FindValue(t, entry, "Value").Links[0].TargetAddress)
+	assert.Len(t, contractstest.FindValue(t, auxv.Content[0].Content[1], "Value").Links, 0)
+
+	files := tree.Content[3]
+	assert.Equal(t, "0x1", contractstest.FindValue(t, files, "Count").Value)
+	require.Len(t, files.Content, 2)
+	assert.Equal(t, "File 0 (true)", files.Content[0].Name)
+	assert.Equal(t, uint64(0x1000), contractstest.FindValue(t, files.Content[0], "Start").Links[0].TargetAddress)
+	assert.Equal(t, "Paths (1)", files.Content[1].Name)
+	assert.Equal(t, files.Content[0].Address+24, files.Content[1].Address)
+}
+
+func Test_ParseNotes_core32(t *testing.T) {
+	prstatus := [144]byte{}
+	binary.BigEndian.PutUint32(prstatus[0:], 6)
+	binary.BigEndian.PutUint32(prstatus[24:], 42)
+	binary.BigEndian.PutUint32(prstatus[72+12*4:], 0x401000)
+	data := pack(t, binary.BigEndian, uint32(5), uint32(len(prstatus)), uint32(elfutils.NT_PRSTATUS), coreOwner, prstatus)
+	tree, _, err := elfutils.ParseNotes(data, 0, elfutils.NotesOptions{
+		Image:   elfutils.Image{Class: elf.ELFCLASS32, ByteOrder: binary.BigEndian, Machine: elf.EM_386},
+		Resolve: resolveCore,
+	})
+	require.NoError(t, err)
+	status := tree.Content[0]
+	assert.Equal(t, "SIGABRT", contractstest.FindValue(t, status, "Signal").Value)
+	assert.Equal(t, "0x2a", contractstest.FindValue(t, status, "Pid").Value)
+	registers := status.Content[0]
+	assert.Equal(t, "Registers (thread 42)", registers.Name)
+	assert.Len(t, registers.Values, 17)
+	assert.Equal(t, uint64(0x2000), contractstest.FindValue(t, registers, "eip").Links[0].TargetAddress)
+}
+
+func Test_ParseCoreFiles(t *testing.T) {
+	desc := pack(t, binary.LittleEndian,
+		uint32(2), uint32(0x1000),
+		uint32(0x8048000), uint32(0x8049000), uint32(0),
+		uint32(0xf7d00000), uint32(0xf7d20000), uint32(3),
+		[]byte("/bin/true\x00/lib/libc.so.6\x00"),
+	)
+	files, err := elfutils.ParseCoreFiles(desc, elfutils.Image{Class: elf.ELFCLASS32})
+	require.NoError(t, err)
+	assert.Equal(t, []elfutils.CoreFile{
+		{Start: 0x8048000, End: 0x8049000, Offset: 0, Path: "/bin/true"},
+		{Start: 0xf7d00000, End: 0xf7d20000, Offset: 0x3000, Path: "/lib/libc.so.6"},
+	}, files)
+
+	_, err = elfutils.ParseCoreFiles(desc[:20], elfutils.Image{Class: elf.ELFCLASS32})
+	assert.Error(t, err)
+}
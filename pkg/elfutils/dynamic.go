@@ -0,0 +1,110 @@
+package elfutils
+
+import (
+	"debug/elf"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/LouisBrunner/mem-viz/pkg/contracts"
+	"github.com/LouisBrunner/mem-viz/pkg/parsingutils"
+)
+
+type DynamicOptions struct {
+	Image
+	// Dynamic string table (DT_STRTAB, usually .dynstr)
+	Strings []byte
+	// Where the string table is in the final tree, 0 if it isn't
+	StringsAddress uintptr
+	Resolve        parsingutils.Resolver
+}
+
+// Tags whose value is a VM address
+var dynamicPointers = map[elf.DynTag]bool{
+	elf.DT_PLTGOT:        true,
+	elf.DT_HASH:          true,
+	elf.DT_STRTAB:        true,
+	elf.DT_SYMTAB:        true,
+	elf.DT_RELA:          true,
+	elf.DT_INIT:          true,
+	elf.DT_FINI:          true,
+	elf.DT_REL:           true,
+	elf.DT_JMPREL:        true,
+	elf.DT_INIT_ARRAY:    true,
+	elf.DT_FINI_ARRAY:    true,
+	elf.DT_PREINIT_ARRAY: true,
+	elf.DT_SYMTAB_SHNDX:  true,
+	elf.DT_GNU_HASH:      true,
+	elf.DT_VERSYM:        true,
+	elf.DT_VERDEF:        true,
+	elf.DT_VERNEED:       true,
+}
+
+// Tags whose value is an offset in the dynamic string table
+var dynamicStrings = map[elf.DynTag]bool{
+	elf.DT_NEEDED:    true,
+	elf.DT_SONAME:    true,
+	elf.DT_RPATH:     true,
+	elf.DT_RUNPATH:   true,
+	elf.DT_AUXILIARY: true,
+	elf.DT_FILTER:    true,
+}
+
+// Parses the entries of a dynamic section (or PT_DYNAMIC), data must contain exactly the entries.
+// Entries after the first DT_NULL are padding but they are shown anyway
+func ParseDynamic(data []byte, address uintptr, options DynamicOptions) (*contracts.MemoryBlock, error) {
+	entrySize := uint64(binary.Size(elf.Dyn32{}))
+	if options.Is64() {
+		entrySize = uint64(binary.Size(elf.Dyn64{}))
+	}
+	if uint64(len(data))%entrySize != 0 {
+		return nil, fmt.Errorf("dynamic size %#x is not a multiple of %d", len(data), entrySize)
+	}
+	count := uint64(len(data)) / entrySize
+	root := newBlock(fmt.Sprintf("Dynamic (%d entries)", count), address, uint64(len(data)))
+
+	for i := uint64(0); i < count; i += 1 {
+		var dyn any = &elf.Dyn32{}
+		if options.Is64() {
+			dyn = &elf.Dyn64{}
+		}
+		err := ReadStruct(data, i*entrySize, options.order(), dyn)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read dynamic entry %d: %w", i, err)
+		}
+		var tag elf.DynTag
+		var value uint64
+		switch dyn := dyn.(type) {
+		case *elf.Dyn32:
+			tag, value = elf.DynTag(dyn.Tag), uint64(dyn.Val)
+		case *elf.Dyn64:
+			tag, value = elf.DynTag(dyn.Tag), dyn.Val
+		}
+
+		label := EnumName(tag, uint64(tag))
+		str := ""
+		if dynamicStrings[tag] && options.Strings != nil {
+			str, err = ReadCString(options.Strings, value)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read string of dynamic entry %d: %w", i, err)
+			}
+		}
+		if str != "" {
+			label = fmt.Sprintf("%s %s", label, str)
+		}
+		block := addChild(root, label, i*entrySize, entrySize)
+		parsingutils.AddStructValues(block, dyn, entrySize, parsingutils.FormatValue)
+
+		switch {
+		case dynamicStrings[tag] && options.StringsAddress != 0:
+			err = parsingutils.AddLinkWithAddr(block, "Val", "name", options.StringsAddress+uintptr(value))
+		case dynamicPointers[tag] && options.Resolve != nil:
+			if target, mapped := options.Resolve(value); mapped {
+				err = parsingutils.AddLinkWithAddr(block, "Val", "points to", target)
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to link dynamic entry %d: %w", i, err)
+		}
+	}
+	return root, nil
+}
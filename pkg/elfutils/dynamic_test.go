@@ -0,0 +1,57 @@
+package elfutils_test
+
+import (
+	"debug/elf"
+	"encoding/binary"
+	"testing"
+
+	"github.com/LouisBrunner/mem-viz/pkg/elfutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_ParseDynamic(t *testing.T) {
+	data := pack(t, binary.LittleEndian,
+		elf.Dyn64{Tag: int64(elf.DT_NEEDED), Val: 1},
+		elf.Dyn64{Tag: int64(elf.DT_GNU_HASH), Val: 0x3a0},
+		elf.Dyn64{Tag: int64(elf.DT_PLTRELSZ), Val: 0x18},
+		elf.Dyn64{Tag: int64(elf.DT_NULL)},
+	)
+	tree, err := elfutils.ParseDynamic(data, 0x2de0, elfutils.DynamicOptions{
+		Image:          elfutils.Image{Class: elf.ELFCLASS64},
+		Strings:        []byte("\x00libc.so.6\x00"),
+		StringsAddress: 0x470,
+		Resolve: func(vmAddr uint64) (uintptr, bool) {
+			return uintptr(vmAddr), true
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "Dynamic (4 entries)", tree.Name)
+	require.Len(t, tree.Content, 4)
+
+	needed := tree.Content[0]
+	assert.Equal(t, "DT_NEEDED libc.so.6", needed.Name)
+	assert.Equal(t, "DT_NEEDED", needed.Values[0].Value)
+	assert.Equal(t, uint64(0x471), needed.Values[1].Links[0].TargetAddress)
+
+	hash := tree.Content[1]
+	assert.Equal(t, "DT_GNU_HASH", hash.Name)
+	assert.Equal(t, uintptr(0x2df0), hash.Address)
+	assert.Equal(t, uint64(0x3a0), hash.Values[1].Links[0].TargetAddress)
+
+	assert.Len(t, tree.Content[2].Values[1].Links, 0)
+	assert.Equal(t, "DT_NULL", tree.Content[3].Name)
+}
+
+func Test_ParseDynamic_32Bit(t *testing.T) {
+	data := pack(t, binary.BigEndian, elf.Dyn32{Tag: int32(elf.DT_SONAME), Val: 1}, elf.Dyn32{Tag: 0x12345})
+	tree, err := elfutils.ParseDynamic(data, 0, elfutils.DynamicOptions{
+		Image:   elfutils.Image{Class: elf.ELFCLASS32, ByteOrder: binary.BigEndian},
+		Strings: []byte("\x00libfoo.so\x00"),
+	})
+	require.NoError(t, err)
+	require.Len(t, tree.Content, 2)
+	assert.Equal(t, "DT_SONAME libfoo.so", tree.Content[0].Name)
+	assert.Equal(t, uint64(8), tree.Content[0].Size)
+	assert.Equal(t, "0x12345", tree.Content[1].Name)
+}
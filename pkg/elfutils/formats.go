@@ -0,0 +1,94 @@
+package elfutils
+
+import (
+	"debug/elf"
+	"fmt"
+	"strings"
+
+	"github.com/LouisBrunner/mem-viz/pkg/parsingutils"
+)
+
+// debug/elf names unknown values after the closest known one (e.g. "SHN_UNDEF+5"), this shows them as numbers instead
+func EnumName(name fmt.Stringer, raw uint64) string {
+	str := name.String()
+	if strings.ContainsRune(str, '+') {
+		return fmt.Sprintf("%#x", raw)
+	}
+	return str
+}
+
+func FormatSectionIndex(index uint16) string {
+	if index != uint16(elf.SHN_UNDEF) && index < uint16(elf.SHN_LORESERVE) {
+		return fmt.Sprintf("%d", index)
+	}
+	return EnumName(elf.SectionIndex(index), uint64(index))
+}
+
+func FormatSymbolInfo(info uint8) string {
+	return fmt.Sprintf("%s, %s", EnumName(elf.ST_BIND(info), uint64(info>>4)), EnumName(elf.ST_TYPE(info), uint64(info&0xf)))
+}
+
+func FormatIdent(ident [elf.EI_NIDENT]byte) string {
+	if string(ident[:4]) != elf.ELFMAG {
+		return fmt.Sprintf("%q", ident[:4])
+	}
+	return fmt.Sprintf("%s, %s, %s, %s (ABI %d)", elf.Class(ident[elf.EI_CLASS]), elf.Data(ident[elf.EI_DATA]), elf.Version(ident[elf.EI_VERSION]), elf.OSABI(ident[elf.EI_OSABI]), ident[elf.EI_ABIVERSION])
+}
+
+func enumFormat[T interface {
+	~int | ~uint8 | ~uint16 | ~uint32 | ~uint64
+	fmt.Stringer
+}]() parsingutils.FieldFormat {
+	return parsingutils.IntegerFormat(func(value uint64) string {
+		return EnumName(T(value), value)
+	})
+}
+
+func flagsFormat[T interface {
+	~uint32 | ~uint64
+	fmt.Stringer
+}]() parsingutils.FieldFormat {
+	return parsingutils.IntegerFormat(func(value uint64) string {
+		if value == 0 {
+			return "0x0"
+		}
+		return T(value).String()
+	})
+}
+
+var (
+	identFormat = func(value interface{}) (string, bool) {
+		ident, ok := value.([elf.EI_NIDENT]byte)
+		if !ok {
+			return "", false
+		}
+		return FormatIdent(ident), true
+	}
+	sectionIndexFormat = parsingutils.IntegerFormat(func(value uint64) string { return FormatSectionIndex(uint16(value)) })
+	symbolInfoFormat   = parsingutils.IntegerFormat(func(value uint64) string { return FormatSymbolInfo(uint8(value)) })
+	symbolOtherFormat  = parsingutils.IntegerFormat(func(value uint64) string { return elf.ST_VISIBILITY(uint8(value)).String() })
+)
+
+func init() {
+	for _, header := range []any{elf.Header32{}, elf.Header64{}} {
+		parsingutils.RegisterFieldFormat(header, "Ident", identFormat)
+		parsingutils.RegisterFieldFormat(header, "Type", enumFormat[elf.Type]())
+		parsingutils.RegisterFieldFormat(header, "Machine", enumFormat[elf.Machine]())
+		parsingutils.RegisterFieldFormat(header, "Shstrndx", sectionIndexFormat)
+	}
+	for _, prog := range []any{elf.Prog32{}, elf.Prog64{}} {
+		parsingutils.RegisterFieldFormat(prog, "Type", enumFormat[elf.ProgType]())
+		parsingutils.RegisterFieldFormat(prog, "Flags", flagsFormat[elf.ProgFlag]())
+	}
+	for _, section := range []any{elf.Section32{}, elf.Section64{}} {
+		parsingutils.RegisterFieldFormat(section, "Type", enumFormat[elf.SectionType]())
+		parsingutils.RegisterFieldFormat(section, "Flags", flagsFormat[elf.SectionFlag]())
+	}
+	for _, sym := range []any{elf.Sym32{}, elf.Sym64{}} {
+		parsingutils.RegisterFieldFormat(sym, "Info", symbolInfoFormat)
+		parsingutils.RegisterFieldFormat(sym, "Other", symbolOtherFormat)
+		parsingutils.RegisterFieldFormat(sym, "Shndx", sectionIndexFormat)
+	}
+	parsingutils.RegisterFieldFormat(elf.Dyn32{}, "Tag", enumFormat[elf.DynTag]())
+	parsingutils.RegisterFieldFormat(elf.Dyn64{}, "Tag", enumFormat[elf.DynTag]())
+}
@@ -0,0 +1,155 @@
+package elfutils
+
+import (
+	"fmt"
+
+	"github.com/LouisBrunner/mem-viz/pkg/contracts"
+	"github.com/LouisBrunner/mem-viz/pkg/parsingutils"
+)
+
+type HashOptions struct {
+	Image
+	// Finds the dynamic symbol table entry for an index, false if it doesn't exist
+	Symbol func(index uint32) (Target, bool)
+}
+
+// Index 0 (STN_UNDEF) marks empty buckets and chains
+func symbolLabel(index uint32, options HashOptions) (string, *Target) {
+	if index == 0 || options.Symbol == nil {
+		return fmt.Sprintf("%d", index), nil
+	}
+	target, found := options.Symbol(index)
+	if !found {
+		return fmt.Sprintf("%d", index), nil
+	}
+	if target.Name == "" {
+		return fmt.Sprintf("%d", index), &target
+	}
+	return fmt.Sprintf("%d (%s)", index, target.Name), &target
+}
+
+// Adds one 32-bit value per symbol index, linked to the symbol it designates
+func addIndexes(block *contracts.MemoryBlock, data []byte, name string, count uint64, options HashOptions) error {
+	order := options.order()
+	for i := uint64(0); i < count; i += 1 {
+		index := order.Uint32(data[block.ParentOffset+i*4:])
+		valueName := fmt.Sprintf("%s %d", name, i)
+		label, target := symbolLabel(index, options)
+		addValue(block, valueName, label, i*4, 4)
+		if target == nil {
+			continue
+		}
+		err := parsingutils.AddLinkWithAddr(block, valueName, "points to", target.Address)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Parses a SHT_GNU_HASH section (DT_GNU_HASH)
+func ParseGNUHash(data []byte, address uintptr, options HashOptions) (*contracts.MemoryBlock, error) {
+	if len(data) < 16 {
+		return nil, fmt.Errorf("GNU hash header is truncated (%#x bytes)", len(data))
+	}
+	order := options.order()
+	nbuckets := uint64(order.Uint32(data))
+	symOffset := uint64(order.Uint32(data[4:]))
+	bloomSize := uint64(order.Uint32(data[8:]))
+	bloomOffset := uint64(16)
+	bucketsOffset := bloomOffset + bloomSize*options.WordSize()
+	chainsOffset := bucketsOffset + nbuckets*4
+	if chainsOffset > uint64(len(data)) {
+		return nil, fmt.Errorf("GNU hash tables are out of bounds: %#x > %#x", chainsOffset, len(data))
+	}
+
+	// The chains are not sized, they go up to the end of the chain of the last bucket
+	last := uint64(0)
+	for i := uint64(0); i < nbuckets; i += 1 {
+		last = max(last, uint64(order.Uint32(data[bucketsOffset+i*4:])))
+	}
+	nchains := uint64(0)
+	if last >= symOffset {
+		for index := last; ; index += 1 {
+			offset := chainsOffset + (index-symOffset)*4
+			if offset+4 > uint64(len(data)) {
+				return nil, fmt.Errorf("GNU hash chain of symbol %d is out of bounds", index)
+			}
+			if order.Uint32(data[offset:])&1 != 0 {
+				nchains = index - symOffset + 1
+				break
+			}
+		}
+	}
+
+	root := newBlock(fmt.Sprintf("GNU Hash (%d buckets)", nbuckets), address, uint64(len(data)))
+	header := addChild(root, "Header", 0, 16)
+	addValue(header, "Nbuckets", uint32(nbuckets), 0, 4)
+	addValue(header, "Symoffset", uint32(symOffset), 4, 4)
+	addValue(header, "BloomSize", uint32(bloomSize), 8, 4)
+	addValue(header, "BloomShift", order.Uint32(data[12:]), 12, 4)
+	if bloomSize > 0 {
+		bloom := addChild(root, fmt.Sprintf("Bloom Filter (%d words)", bloomSize), bloomOffset, bucketsOffset-bloomOffset)
+		err := parsingutils.AddLinkWithBlock(header, "BloomSize", bloom, "gives size")
+		if err != nil {
+			return nil, err
+		}
+	}
+	if nbuckets > 0 {
+		buckets := addChild(root, fmt.Sprintf("Buckets (%d)", nbuckets), bucketsOffset, nbuckets*4)
+		err := addIndexes(buckets, data, "Bucket", nbuckets, options)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if nchains > 0 {
+		chains := addChild(root, fmt.Sprintf("Chains (%d)", nchains), chainsOffset, nchains*4)
+		for i := uint64(0); i < nchains; i += 1 {
+			index := uint32(symOffset + i)
+			label, target := symbolLabel(index, options)
+			valueName := fmt.Sprintf("Hash %s", label)
+			addValue(chains, valueName, order.Uint32(data[chainsOffset+i*4:]), i*4, 4)
+			if target == nil {
+				continue
+			}
+			err := parsingutils.AddLinkWithAddr(chains, valueName, "hashes", target.Address)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return root, nil
+}
+
+// Parses a SHT_HASH section (DT_HASH), the entries are always 32-bit
+func ParseSysVHash(data []byte, address uintptr, options HashOptions) (*contracts.MemoryBlock, error) {
+	if len(data) < 8 {
+		return nil, fmt.Errorf("hash header is truncated (%#x bytes)", len(data))
+	}
+	order := options.order()
+	nbucket := uint64(order.Uint32(data))
+	nchain := uint64(order.Uint32(data[4:]))
+	if 8+(nbucket+nchain)*4 > uint64(len(data)) {
+		return nil, fmt.Errorf("hash tables are out of bounds: %#x > %#x", 8+(nbucket+nchain)*4, len(data))
+	}
+
+	root := newBlock(fmt.Sprintf("Hash (%d buckets)", nbucket), address, uint64(len(data)))
+	header := addChild(root, "Header", 0, 8)
+	addValue(header, "Nbucket", uint32(nbucket), 0, 4)
+	addValue(header, "Nchain", uint32(nchain), 4, 4)
+	if nbucket > 0 {
+		buckets := addChild(root, fmt.Sprintf("Buckets (%d)", nbucket), 8, nbucket*4)
+		err := addIndexes(buckets, data, "Bucket", nbucket, options)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if nchain > 0 {
+		chains := addChild(root, fmt.Sprintf("Chains (%d)", nchain), 8+nbucket*4, nchain*4)
+		err := addIndexes(chains, data, "Chain", nchain, options)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return root, nil
+}
@@ -0,0 +1,73 @@
+package elfutils_test
+
+import (
+	"debug/elf"
+	"encoding/binary"
+	"fmt"
+	"testing"
+
+	"github.com/LouisBrunner/mem-viz/pkg/elfutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func hashSymbol(index uint32) (elfutils.Target, bool) {
+	return elfutils.Target{Name: fmt.Sprintf("sym%d", index), Address: 0x1000 + uintptr(index)*24}, true
+}
+
+func Test_ParseGNUHash(t *testing.T) {
+	data := pack(t, binary.LittleEndian,
+		// 2 buckets, symbols start at 1, 1 bloom word, shift 6
+		uint32(2), uint32(1), uint32(1), uint32(6),
+		uint64(0xffff),
+		uint32(1), uint32(3),
+		// symbols 1, 2 and 3, the last one of each chain has its lowest bit set
+		uint32(0x10), uint32(0x21), uint32(0x31),
+	)
+	tree, err := elfutils.ParseGNUHash(data, 0x3a0, elfutils.HashOptions{
+		Image:  elfutils.Image{Class: elf.ELFCLASS64},
+		Symbol: hashSymbol,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "GNU Hash (2 buckets)", tree.Name)
+	require.Len(t, tree.Content, 4)
+	assert.Equal(t, "Header", tree.Content[0].Name)
+	assert.Equal(t, "Bloom Filter (1 words)", tree.Content[1].Name)
+	assert.Equal(t, uint64(8), tree.Content[1].Size)
+
+	buckets := tree.Content[2]
+	assert.Equal(t, "Buckets (2)", buckets.Name)
+	assert.Equal(t, uintptr(0x3b8), buckets.Address)
+	require.Len(t, buckets.Values, 2)
+	assert.Equal(t, `"3 (sym3)"`, buckets.Values[1].Value)
+	assert.Equal(t, uint64(0x1048), buckets.Values[1].Links[0].TargetAddress)
+
+	chains := tree.Content[3]
+	assert.Equal(t, "Chains (3)", chains.Name)
+	require.Len(t, chains.Values, 3)
+	assert.Equal(t, "Hash 1 (sym1)", chains.Values[0].Name)
+	assert.Equal(t, "0x21", chains.Values[1].Value)
+}
+
+func Test_ParseGNUHash_truncatedChain(t *testing.T) {
+	data := pack(t, binary.LittleEndian, uint32(1), uint32(1), uint32(0), uint32(6), uint32(1), uint32(0x10))
+	_, err := elfutils.ParseGNUHash(data, 0, elfutils.HashOptions{Image: elfutils.Image{Class: elf.ELFCLASS64}})
+	assert.Error(t, err)
+}
+
+func Test_ParseSysVHash(t *testing.T) {
+	data := pack(t, binary.BigEndian, uint32(1), uint32(3), uint32(2), uint32(0), uint32(0), uint32(1))
+	tree, err := elfutils.ParseSysVHash(data, 0, elfutils.HashOptions{
+		Image:  elfutils.Image{Class: elf.ELFCLASS32, ByteOrder: binary.BigEndian},
+		Symbol: hashSymbol,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "Hash (1 buckets)", tree.Name)
+	require.Len(t, tree.Content, 3)
+	assert.Equal(t, `"2 (sym2)"`, tree.Content[1].Values[0].Value)
+	chains := tree.Content[2]
+	assert.Equal(t, "Chains (3)", chains.Name)
+	assert.Equal(t, `"0"`, chains.Values[0].Value)
+	assert.Len(t, chains.Values[0].Links, 0)
+	assert.Equal(t, uint64(0x1018), chains.Values[2].Links[0].TargetAddress)
+}
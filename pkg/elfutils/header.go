@@ -0,0 +1,120 @@
+package elfutils
+
+import (
+	"debug/elf"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/LouisBrunner/mem-viz/pkg/contracts"
+	"github.com/LouisBrunner/mem-viz/pkg/parsingutils"
+)
+
+// Fields of the ELF header which locate the other tables (debug/elf doesn't keep them around)
+type Header struct {
+	Entry     uint64
+	Phoff     uint64
+	Phentsize uint64
+	Phnum     uint64
+	Shoff     uint64
+	Shentsize uint64
+	Shnum     uint64
+	Shstrndx  uint16
+}
+
+type HeaderOptions struct {
+	Image
+	Resolve parsingutils.Resolver
+}
+
+// Parses the ELF header at the start of data
+func ParseHeader(data []byte, address uintptr, options HeaderOptions) (*contracts.MemoryBlock, Header, error) {
+	var raw any = &elf.Header32{}
+	if options.Is64() {
+		raw = &elf.Header64{}
+	}
+	err := ReadStruct(data, 0, options.order(), raw)
+	if err != nil {
+		return nil, Header{}, fmt.Errorf("failed to parse ELF Header: %w", err)
+	}
+	size := uint64(binary.Size(raw))
+	block := newBlock("ELF Header", address, size)
+	parsingutils.AddStructValues(block, raw, size, parsingutils.FormatValue)
+
+	header := Header{}
+	switch raw := raw.(type) {
+	case *elf.Header32:
+		header.Entry = uint64(raw.Entry)
+		header.Phoff, header.Phentsize, header.Phnum = uint64(raw.Phoff), uint64(raw.Phentsize), uint64(raw.Phnum)
+		header.Shoff, header.Shentsize, header.Shnum = uint64(raw.Shoff), uint64(raw.Shentsize), uint64(raw.Shnum)
+		header.Shstrndx = raw.Shstrndx
+	case *elf.Header64:
+		header.Entry = raw.Entry
+		header.Phoff, header.Phentsize, header.Phnum = raw.Phoff, uint64(raw.Phentsize), uint64(raw.Phnum)
+		header.Shoff, header.Shentsize, header.Shnum = raw.Shoff, uint64(raw.Shentsize), uint64(raw.Shnum)
+		header.Shstrndx = raw.Shstrndx
+	}
+
+	if options.Resolve != nil && header.Entry != 0 {
+		if target, mapped := options.Resolve(header.Entry); mapped {
+			err = parsingutils.AddLinkWithAddr(block, "Entry", "starts at", target)
+			if err != nil {
+				return nil, Header{}, err
+			}
+		}
+	}
+	return block, header, nil
+}
+
+type ProgramHeadersOptions struct {
+	Image
+	// Stride of the table (e_phentsize), which can be larger than the struct
+	EntrySize uint64
+	// nil to skip those links
+	Resolve parsingutils.Resolver
+}
+
+// Parses the program header table, data must contain exactly the entries
+func ParseProgramHeaders(data []byte, address uintptr, options ProgramHeadersOptions) (*contracts.MemoryBlock, error) {
+	if options.EntrySize == 0 {
+		return nil, fmt.Errorf("invalid program header size 0")
+	}
+	if uint64(len(data))%options.EntrySize != 0 {
+		return nil, fmt.Errorf("program headers size %#x is not a multiple of %d", len(data), options.EntrySize)
+	}
+	count := uint64(len(data)) / options.EntrySize
+	root := newBlock(fmt.Sprintf("Program Headers (%d)", count), address, uint64(len(data)))
+
+	for i := uint64(0); i < count; i += 1 {
+		var raw any = &elf.Prog32{}
+		if options.Is64() {
+			raw = &elf.Prog64{}
+		}
+		err := ReadStruct(data, i*options.EntrySize, options.order(), raw)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read program header %d: %w", i, err)
+		}
+		var typ elf.ProgType
+		var vaddr, memsz uint64
+		switch raw := raw.(type) {
+		case *elf.Prog32:
+			typ, vaddr, memsz = elf.ProgType(raw.Type), uint64(raw.Vaddr), uint64(raw.Memsz)
+		case *elf.Prog64:
+			typ, vaddr, memsz = elf.ProgType(raw.Type), raw.Vaddr, raw.Memsz
+		}
+		entry, err := addStruct(root, data, options.order(), raw, fmt.Sprintf("Program Header %d (%s)", i, EnumName(typ, uint64(typ))), i*options.EntrySize)
+		if err != nil {
+			return nil, err
+		}
+
+		if options.Resolve == nil || memsz == 0 {
+			continue
+		}
+		if target, mapped := options.Resolve(vaddr); mapped {
+			err = parsingutils.AddLinkWithAddr(entry, "Vaddr", "points to", target)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return root, nil
+}
@@ -0,0 +1,83 @@
+package elfutils_test
+
+import (
+	"debug/elf"
+	"encoding/binary"
+	"testing"
+
+	"github.com/LouisBrunner/mem-viz/pkg/elfutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_ParseHeader(t *testing.T) {
+	data := pack(t, binary.LittleEndian, elf.Header64{
+		Type:      uint16(elf.ET_DYN),
+		Machine:   uint16(elf.EM_X86_64),
+		Entry:     0x1040,
+		Phoff:     0x40,
+		Shoff:     0x3a00,
+		Phentsize: 0x38,
+		Phnum:     13,
+		Shentsize: 0x40,
+		Shnum:     30,
+		Shstrndx:  29,
+	})
+	block, header, err := elfutils.ParseHeader(data, 0x1000, elfutils.HeaderOptions{
+		Image: elfutils.Image{Class: elf.ELFCLASS64},
+		Resolve: func(vmAddr uint64) (uintptr, bool) {
+			return uintptr(vmAddr) + 0x1000, true
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "ELF Header", block.Name)
+	assert.Equal(t, uint64(64), block.Size)
+	assert.Equal(t, elfutils.Header{
+		Entry:     0x1040,
+		Phoff:     0x40,
+		Phentsize: 0x38,
+		Phnum:     13,
+		Shoff:     0x3a00,
+		Shentsize: 0x40,
+		Shnum:     30,
+		Shstrndx:  29,
+	}, header)
+
+	for _, value := range block.Values {
+		if value.Name == "Entry" {
+			require.Len(t, value.Links, 1)
+			assert.Equal(t, uint64(0x2040), value.Links[0].TargetAddress)
+		}
+	}
+}
+
+func Test_ParseProgramHeaders(t *testing.T) {
+	data := pack(t, binary.BigEndian,
+		elf.Prog32{Type: uint32(elf.PT_LOAD), Vaddr: 0x10000, Filesz: 0x800, Memsz: 0x800},
+		elf.Prog32{Type: uint32(elf.PT_GNU_STACK)},
+	)
+	tree, err := elfutils.ParseProgramHeaders(data, 0x34, elfutils.ProgramHeadersOptions{
+		Image:     elfutils.Image{Class: elf.ELFCLASS32, ByteOrder: binary.BigEndian},
+		EntrySize: 0x20,
+		Resolve: func(vmAddr uint64) (uintptr, bool) {
+			return uintptr(vmAddr - 0x10000), true
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "Program Headers (2)", tree.Name)
+	require.Len(t, tree.Content, 2)
+
+	load := tree.Content[0]
+	assert.Equal(t, "Program Header 0 (PT_LOAD)", load.Name)
+	assert.Equal(t, uintptr(0x34), load.Address)
+	assert.Equal(t, "PT_LOAD", load.Values[0].Value)
+	assert.Equal(t, uint64(0), load.Values[2].Links[0].TargetAddress)
+
+	stack := tree.Content[1]
+	assert.Equal(t, "Program Header 1 (PT_GNU_STACK)", stack.Name)
+	assert.Equal(t, uint64(0x20), stack.ParentOffset)
+	assert.Len(t, stack.Values[2].Links, 0)
+
+	_, err = elfutils.ParseProgramHeaders(data[:0x30], 0, elfutils.ProgramHeadersOptions{EntrySize: 0x20})
+	assert.Error(t, err)
+}
@@ -0,0 +1,52 @@
+package elfutils
+
+import (
+	"debug/elf"
+	"encoding/binary"
+
+	"github.com/LouisBrunner/mem-viz/pkg/parsingutils"
+)
+
+// Layout of the image being decoded, it decides which debug/elf structs are used
+type Image struct {
+	Class     elf.Class
+	ByteOrder parsingutils.ByteOrder
+	// Used to name relocation types
+	Machine elf.Machine
+}
+
+func (me Image) Is64() bool {
+	return me.Class == elf.ELFCLASS64
+}
+
+func (me Image) order() binary.ByteOrder {
+	return parsingutils.OrLittleEndian(me.ByteOrder)
+}
+
+// Reads a word of the image (Elf32_Addr/Elf64_Addr and friends)
+func (me Image) ReadWord(data []byte, offset uint64) uint64 {
+	if me.Is64() {
+		return me.order().Uint64(data[offset:])
+	}
+	return uint64(me.order().Uint32(data[offset:]))
+}
+
+func (me Image) WordSize() uint64 {
+	if me.Is64() {
+		return 8
+	}
+	return 4
+}
+
+func (me Image) SymbolSize() uint64 {
+	if me.Is64() {
+		return elf.Sym64Size
+	}
+	return elf.Sym32Size
+}
+
+// Something decoded and where it is in the final tree (e.g. a symbol table entry)
+type Target struct {
+	Name    string
+	Address uintptr
+}
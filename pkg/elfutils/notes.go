@@ -0,0 +1,207 @@
+package elfutils
+
+import (
+	"debug/elf"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/LouisBrunner/mem-viz/pkg/contracts"
+	"github.com/LouisBrunner/mem-viz/pkg/parsingutils"
+)
+
+// From binutils' include/elf/common.h
+const (
+	NT_GNU_ABI_TAG         = 1
+	NT_GNU_HWCAP           = 2
+	NT_GNU_BUILD_ID        = 3
+	NT_GNU_GOLD_VERSION    = 4
+	NT_GNU_PROPERTY_TYPE_0 = 5
+)
+
+const (
+	GNU_PROPERTY_STACK_SIZE            = 1
+	GNU_PROPERTY_NO_COPY_ON_PROTECTED  = 2
+	GNU_PROPERTY_1_NEEDED              = 0xb0008000
+	GNU_PROPERTY_AARCH64_FEATURE_1_AND = 0xc0000000
+	GNU_PROPERTY_X86_FEATURE_1_AND     = 0xc0000002
+	GNU_PROPERTY_X86_ISA_1_NEEDED      = 0xc0008002
+)
+
+const noteHeaderSize = 12
+
+var gnuNoteTypes = map[uint32]string{
+	NT_GNU_ABI_TAG:         "NT_GNU_ABI_TAG",
+	NT_GNU_HWCAP:           "NT_GNU_HWCAP",
+	NT_GNU_BUILD_ID:        "NT_GNU_BUILD_ID",
+	NT_GNU_GOLD_VERSION:    "NT_GNU_GOLD_VERSION",
+	NT_GNU_PROPERTY_TYPE_0: "NT_GNU_PROPERTY_TYPE_0",
+}
+
+var abiTagOSes = map[uint32]string{
+	0: "Linux",
+	1: "Hurd",
+	2: "Solaris",
+	3: "FreeBSD",
+}
+
+// Processor-specific properties share the same range, so the machine is needed to name them
+func GNUPropertyName(machine elf.Machine, typ uint32) string {
+	switch {
+	case typ == GNU_PROPERTY_STACK_SIZE:
+		return "GNU_PROPERTY_STACK_SIZE"
+	case typ == GNU_PROPERTY_NO_COPY_ON_PROTECTED:
+		return "GNU_PROPERTY_NO_COPY_ON_PROTECTED"
+	case typ == GNU_PROPERTY_1_NEEDED:
+		return "GNU_PROPERTY_1_NEEDED"
+	case typ == GNU_PROPERTY_AARCH64_FEATURE_1_AND && machine == elf.EM_AARCH64:
+		return "GNU_PROPERTY_AARCH64_FEATURE_1_AND"
+	case typ == GNU_PROPERTY_X86_FEATURE_1_AND && (machine == elf.EM_X86_64 || machine == elf.EM_386):
+		return "GNU_PROPERTY_X86_FEATURE_1_AND"
+	case typ == GNU_PROPERTY_X86_ISA_1_NEEDED && (machine == elf.EM_X86_64 || machine == elf.EM_386):
+		return "GNU_PROPERTY_X86_ISA_1_NEEDED"
+	}
+	return fmt.Sprintf("%#x", typ)
+}
+
+// Note types only mean something for a given owner
+func NoteTypeName(owner string, typ uint32) string {
+	names := map[string]map[uint32]string{
+		"GNU":   gnuNoteTypes,
+		"CORE":  coreNoteTypes,
+		"LINUX": linuxNoteTypes,
+	}[owner]
+	if name, found := names[typ]; found {
+		return name
+	}
+	return fmt.Sprintf("%#x", typ)
+}
+
+// A decoded note
+type Note struct {
+	Owner       string
+	Type        uint32
+	Description []byte
+}
+
+type NotesOptions struct {
+	Image
+	// Alignment of the entries, usually 4 but 8 for some 64-bit notes (e.g. .note.gnu.property), 0 means 4
+	Align uint64
+	// Only used by core dumps, for the addresses of the process
+	Resolve parsingutils.Resolver
+}
+
+func alignUp(value, align uint64) uint64 {
+	return (value + align - 1) &^ (align - 1)
+}
+
+// Parses the notes of a SHT_NOTE section or a PT_NOTE segment, data must contain exactly the notes.
+// The decoded notes are also returned so callers can use them (e.g. the build ID)
+func ParseNotes(data []byte, address uintptr, options NotesOptions) (*contracts.MemoryBlock, []Note, error) {
+	align := options.Align
+	if align < 4 {
+		align = 4
+	}
+	order := options.order()
+
+	root := newBlock("Notes", address, uint64(len(data)))
+	notes := []Note{}
+	for offset := uint64(0); offset+noteHeaderSize <= uint64(len(data)); {
+		nameSize := uint64(order.Uint32(data[offset:]))
+		descSize := uint64(order.Uint32(data[offset+4:]))
+		typ := order.Uint32(data[offset+8:])
+		descOffset := alignUp(noteHeaderSize+nameSize, align)
+		size := alignUp(descOffset+descSize, align)
+		if offset+size > uint64(len(data)) {
+			// The last note isn't always padded
+			size = descOffset + descSize
+		}
+		raw, err := subSlice(data, offset, size)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read note %d: %w", len(notes), err)
+		}
+
+		owner := ""
+		if nameSize > 0 {
+			owner, err = ReadCString(raw[:noteHeaderSize+nameSize], noteHeaderSize)
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to read owner of note %d: %w", len(notes), err)
+			}
+		}
+		note := Note{Owner: owner, Type: typ, Description: raw[descOffset : descOffset+descSize]}
+		notes = append(notes, note)
+
+		typeName := NoteTypeName(owner, typ)
+		block := addChild(root, fmt.Sprintf("Note %s (%s)", owner, typeName), offset, size)
+		addValue(block, "Namesz", uint32(nameSize), 0, 4)
+		addValue(block, "Descsz", uint32(descSize), 4, 4)
+		addValue(block, "Type", typeName, 8, 4)
+		if nameSize > 0 && nameSize <= 0xff {
+			addValue(block, "Name", owner, noteHeaderSize, uint8(nameSize))
+		}
+		err = addNoteDescription(block, descOffset, note, options)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to decode note %d (%s): %w", len(notes)-1, typeName, err)
+		}
+		offset += size
+	}
+	root.Name = fmt.Sprintf("Notes (%d)", len(notes))
+	return root, notes, nil
+}
+
+// The decoded description is added to the note itself (at offset) as it's usually a single value
+func addNoteDescription(block *contracts.MemoryBlock, offset uint64, note Note, options NotesOptions) error {
+	if note.Owner == "CORE" {
+		return addCoreDescription(block, offset, note, options)
+	}
+	if note.Owner != "GNU" {
+		return nil
+	}
+	order := options.order()
+	desc := note.Description
+	switch note.Type {
+	case NT_GNU_BUILD_ID:
+		if len(desc) > 0 && len(desc) <= 0xff {
+			addValue(block, "Build ID", hex.EncodeToString(desc), offset, uint8(len(desc)))
+		}
+	case NT_GNU_ABI_TAG:
+		if len(desc) < 16 {
+			return nil
+		}
+		os, found := abiTagOSes[order.Uint32(desc)]
+		if !found {
+			os = fmt.Sprintf("Unknown %d", order.Uint32(desc))
+		}
+		addValue(block, "OS", os, offset, 4)
+		addValue(block, "ABI", fmt.Sprintf("%d.%d.%d", order.Uint32(desc[4:]), order.Uint32(desc[8:]), order.Uint32(desc[12:])), offset+4, 12)
+	case NT_GNU_GOLD_VERSION:
+		if len(desc) > 0 && len(desc) <= 0xff {
+			version, _ := ReadCString(desc, 0)
+			addValue(block, "Version", version, offset, uint8(len(desc)))
+		}
+	case NT_GNU_PROPERTY_TYPE_0:
+		addGNUProperties(block, offset, desc, options)
+	}
+	return nil
+}
+
+// Each property is a pr_type, pr_datasz and its data padded to the word size
+func addGNUProperties(block *contracts.MemoryBlock, offset uint64, desc []byte, options NotesOptions) {
+	order := options.order()
+	for current := uint64(0); current+8 <= uint64(len(desc)); {
+		typ := order.Uint32(desc[current:])
+		dataSize := uint64(order.Uint32(desc[current+4:]))
+		size := alignUp(8+dataSize, options.WordSize())
+		if current+size > uint64(len(desc)) {
+			return
+		}
+		typeName := GNUPropertyName(options.Machine, typ)
+		property := addChild(block, fmt.Sprintf("Property %s", typeName), offset+current, size)
+		addValue(property, "Type", typeName, 0, 4)
+		addValue(property, "Datasz", uint32(dataSize), 4, 4)
+		if dataSize == 4 {
+			addValue(property, "Data", order.Uint32(desc[current+8:]), 8, 4)
+		}
+		current += size
+	}
+}
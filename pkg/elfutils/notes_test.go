@@ -0,0 +1,65 @@
+package elfutils_test
+
+import (
+	"debug/elf"
+	"encoding/binary"
+	"testing"
+
+	"github.com/LouisBrunner/mem-viz/pkg/elfutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_ParseNotes(t *testing.T) {
+	data := pack(t, binary.LittleEndian,
+		// NT_GNU_ABI_TAG for Linux 3.2.0
+		uint32(4), uint32(16), uint32(elfutils.NT_GNU_ABI_TAG), [4]byte{'G', 'N', 'U'}, uint32(0), uint32(3), uint32(2), uint32(0),
+		// NT_GNU_BUILD_ID
+		uint32(4), uint32(4), uint32(elfutils.NT_GNU_BUILD_ID), [4]byte{'G', 'N', 'U'}, [4]byte{0xde, 0xad, 0xbe, 0xef},
+		// Unknown owner
+		uint32(5), uint32(1), uint32(42), [8]byte{'O', 'T', 'H', 'E', 'R'}, [4]byte{1},
+	)
+	tree, notes, err := elfutils.ParseNotes(data, 0x37c, elfutils.NotesOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "Notes (3)", tree.Name)
+	require.Len(t, notes, 3)
+	assert.Equal(t, elfutils.Note{Owner: "GNU", Type: elfutils.NT_GNU_BUILD_ID, Description: []byte{0xde, 0xad, 0xbe, 0xef}}, notes[1])
+	require.Len(t, tree.Content, 3)
+
+	abi := tree.Content[0]
+	assert.Equal(t, "Note GNU (NT_GNU_ABI_TAG)", abi.Name)
+	assert.Equal(t, uint64(32), abi.Size)
+	require.Len(t, abi.Values, 6)
+	assert.Equal(t, `"GNU"`, abi.Values[3].Value)
+	assert.Equal(t, `"Linux"`, abi.Values[4].Value)
+	assert.Equal(t, `"3.2.0"`, abi.Values[5].Value)
+	assert.Equal(t, uint64(20), abi.Values[5].Offset)
+
+	buildID := tree.Content[1]
+	assert.Equal(t, uintptr(0x39c), buildID.Address)
+	assert.Equal(t, `"deadbeef"`, buildID.Values[4].Value)
+
+	other := tree.Content[2]
+	assert.Equal(t, "Note OTHER (0x2a)", other.Name)
+	assert.Equal(t, uint64(24), other.Size)
+	assert.Len(t, other.Values, 4)
+}
+
+func Test_ParseNotes_properties(t *testing.T) {
+	data := pack(t, binary.LittleEndian,
+		uint32(4), uint32(16), uint32(elfutils.NT_GNU_PROPERTY_TYPE_0), [4]byte{'G', 'N', 'U'},
+		uint32(elfutils.GNU_PROPERTY_X86_FEATURE_1_AND), uint32(4), uint32(3), uint32(0),
+	)
+	tree, _, err := elfutils.ParseNotes(data, 0, elfutils.NotesOptions{
+		Image: elfutils.Image{Class: elf.ELFCLASS64, Machine: elf.EM_X86_64},
+		Align: 8,
+	})
+	require.NoError(t, err)
+	require.Len(t, tree.Content, 1)
+	require.Len(t, tree.Content[0].Content, 1)
+	property := tree.Content[0].Content[0]
+	assert.Equal(t, "Property GNU_PROPERTY_X86_FEATURE_1_AND", property.Name)
+	assert.Equal(t, uintptr(16), property.Address)
+	assert.Equal(t, uint64(16), property.Size)
+	assert.Equal(t, "0x3", property.Values[2].Value)
+}
@@ -0,0 +1,128 @@
+package elfutils
+
+import (
+	"debug/elf"
+	"fmt"
+
+	"github.com/LouisBrunner/mem-viz/pkg/contracts"
+	"github.com/LouisBrunner/mem-viz/pkg/parsingutils"
+)
+
+type RelocationOptions struct {
+	Image
+	// Whether the entries have an explicit addend (SHT_RELA)
+	Addend bool
+	// Turns r_offset into an address we can link to, false if it isn't mapped
+	// (it is a VM address in linked images but an offset in the patched section in relocatable objects)
+	Resolve func(offset uint64) (uintptr, bool)
+	// Finds the symbol table entry of a relocation, false if it doesn't exist
+	Symbol func(index uint32) (Target, bool)
+}
+
+func RelocationTypeName(machine elf.Machine, typ uint32) string {
+	var name fmt.Stringer
+	switch machine {
+	case elf.EM_X86_64:
+		name = elf.R_X86_64(typ)
+	case elf.EM_386:
+		name = elf.R_386(typ)
+	case elf.EM_AARCH64:
+		name = elf.R_AARCH64(typ)
+	case elf.EM_ARM:
+		name = elf.R_ARM(typ)
+	case elf.EM_PPC:
+		name = elf.R_PPC(typ)
+	case elf.EM_PPC64:
+		name = elf.R_PPC64(typ)
+	case elf.EM_MIPS:
+		name = elf.R_MIPS(typ)
+	case elf.EM_RISCV:
+		name = elf.R_RISCV(typ)
+	case elf.EM_S390:
+		name = elf.R_390(typ)
+	case elf.EM_SPARC, elf.EM_SPARC32PLUS, elf.EM_SPARCV9:
+		name = elf.R_SPARC(typ)
+	case elf.EM_LOONGARCH:
+		name = elf.R_LARCH(typ)
+	default:
+		return fmt.Sprintf("Unknown %d", typ)
+	}
+	return EnumName(name, uint64(typ))
+}
+
+// Parses an array of Elf_Rel or Elf_Rela, data must contain exactly the entries.
+// FIXME: MIPS64 uses a different r_info layout which isn't supported
+func ParseRelocations(data []byte, address uintptr, options RelocationOptions) (*contracts.MemoryBlock, error) {
+	word := options.WordSize()
+	entrySize := 2 * word
+	if options.Addend {
+		entrySize += word
+	}
+	if uint64(len(data))%entrySize != 0 {
+		return nil, fmt.Errorf("relocations size %#x is not a multiple of %d", len(data), entrySize)
+	}
+	count := uint64(len(data)) / entrySize
+	root := newBlock(fmt.Sprintf("Relocations (%d entries)", count), address, uint64(len(data)))
+
+	for i := uint64(0); i < count; i += 1 {
+		offset := i * entrySize
+		err := addRelocation(root, data, offset, entrySize, options)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse relocation %d: %w", i, err)
+		}
+	}
+	return root, nil
+}
+
+func addRelocation(root *contracts.MemoryBlock, data []byte, offset, entrySize uint64, options RelocationOptions) error {
+	word := options.WordSize()
+	patched := options.ReadWord(data, offset)
+	info := options.ReadWord(data, offset+word)
+	var symbol, typ uint32
+	if options.Is64() {
+		symbol, typ = elf.R_SYM64(info), elf.R_TYPE64(info)
+	} else {
+		symbol, typ = elf.R_SYM32(uint32(info)), elf.R_TYPE32(uint32(info))
+	}
+	typeName := RelocationTypeName(options.Machine, typ)
+
+	var target *Target
+	name := fmt.Sprintf("%s (+%#x)", typeName, patched)
+	if symbol != 0 {
+		targetLabel := fmt.Sprintf("Symbol %d", symbol)
+		if options.Symbol != nil {
+			if found, ok := options.Symbol(symbol); ok {
+				target = &found
+				if found.Name != "" {
+					targetLabel = found.Name
+				}
+			}
+		}
+		name = fmt.Sprintf("%s %s (+%#x)", typeName, targetLabel, patched)
+	}
+	block := addChild(root, name, offset, entrySize)
+
+	addValue(block, "Off", patched, 0, uint8(word))
+	addValue(block, "Type", typeName, word, uint8(word))
+	addValue(block, "Symbol", symbol, word, uint8(word))
+	if options.Addend {
+		addend := int64(options.ReadWord(data, offset+2*word))
+		if !options.Is64() {
+			addend = int64(int32(addend))
+		}
+		addValue(block, "Addend", addend, 2*word, uint8(word))
+	}
+
+	if options.Resolve != nil {
+		if address, mapped := options.Resolve(patched); mapped {
+			err := parsingutils.AddLinkWithAddr(block, "Off", "patches", address)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if target != nil {
+		return parsingutils.AddLinkWithAddr(block, "Symbol", "refers to", target.Address)
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package elfutils_test
+
+import (
+	"debug/elf"
+	"encoding/binary"
+	"testing"
+
+	"github.com/LouisBrunner/mem-viz/pkg/elfutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_ParseRelocations(t *testing.T) {
+	data := pack(t, binary.LittleEndian,
+		elf.Rela64{Off: 0x4018, Info: elf.R_INFO(2, uint32(elf.R_X86_64_JMP_SLOT))},
+		elf.Rela64{Off: 0x3dd0, Info: elf.R_INFO(0, uint32(elf.R_X86_64_RELATIVE)), Addend: 0x1130},
+	)
+	tree, err := elfutils.ParseRelocations(data, 0x600, elfutils.RelocationOptions{
+		Image:  elfutils.Image{Class: elf.ELFCLASS64, Machine: elf.EM_X86_64},
+		Addend: true,
+		Resolve: func(offset uint64) (uintptr, bool) {
+			return uintptr(offset - 0x1000), true
+		},
+		Symbol: func(index uint32) (elfutils.Target, bool) {
+			return elfutils.Target{Name: "puts", Address: 0x3c8 + uintptr(index)*24}, true
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "Relocations (2 entries)", tree.Name)
+	require.Len(t, tree.Content, 2)
+
+	slot := tree.Content[0]
+	assert.Equal(t, "R_X86_64_JMP_SLOT puts (+0x4018)", slot.Name)
+	assert.Equal(t, uint64(24), slot.Size)
+	require.Len(t, slot.Values, 4)
+	assert.Equal(t, uint64(0x3018), slot.Values[0].Links[0].TargetAddress)
+	assert.Equal(t, `"R_X86_64_JMP_SLOT"`, slot.Values[1].Value)
+	assert.Equal(t, uint64(0x3f8), slot.Values[2].Links[0].TargetAddress)
+
+	relative := tree.Content[1]
+	assert.Equal(t, "R_X86_64_RELATIVE (+0x3dd0)", relative.Name)
+	assert.Equal(t, "0x1130", relative.Values[3].Value)
+	assert.Len(t, relative.Values[2].Links, 0)
+}
+
+func Test_ParseRelocations_32Bit(t *testing.T) {
+	data := pack(t, binary.BigEndian, elf.Rel32{Off: 0x10, Info: elf.R_INFO32(3, uint32(elf.R_MIPS_32))})
+	tree, err := elfutils.ParseRelocations(data, 0, elfutils.RelocationOptions{
+		Image: elfutils.Image{Class: elf.ELFCLASS32, ByteOrder: binary.BigEndian, Machine: elf.EM_MIPS},
+	})
+	require.NoError(t, err)
+	require.Len(t, tree.Content, 1)
+	assert.Equal(t, "R_MIPS_32 Symbol 3 (+0x10)", tree.Content[0].Name)
+	assert.Equal(t, uint64(8), tree.Content[0].Size)
+	assert.Len(t, tree.Content[0].Values, 3)
+}
+
+func Test_ParseRelocations_invalidSize(t *testing.T) {
+	_, err := elfutils.ParseRelocations(make([]byte, 16), 0, elfutils.RelocationOptions{
+		Image:  elfutils.Image{Class: elf.ELFCLASS64},
+		Addend: true,
+	})
+	assert.Error(t, err)
+}
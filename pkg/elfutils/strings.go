@@ -0,0 +1,26 @@
+package elfutils
+
+import (
+	"fmt"
+
+	"github.com/LouisBrunner/mem-viz/pkg/contracts"
+)
+
+// Parses a string table (SHT_STRTAB), each string gets its own block
+func ParseStrings(data []byte, address uintptr) (*contracts.MemoryBlock, error) {
+	root := newBlock("Strings", address, uint64(len(data)))
+	for offset := uint64(0); offset < uint64(len(data)); {
+		str, err := ReadCString(data, offset)
+		if err != nil {
+			return nil, err
+		}
+		size := uint64(len(str)) + 1
+		if offset+size > uint64(len(data)) {
+			size = uint64(len(data)) - offset
+		}
+		addChild(root, fmt.Sprintf("%q", str), offset, size)
+		offset += size
+	}
+	root.Name = fmt.Sprintf("Strings (%d)", len(root.Content))
+	return root, nil
+}
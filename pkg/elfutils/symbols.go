@@ -0,0 +1,108 @@
+package elfutils
+
+import (
+	"debug/elf"
+	"fmt"
+
+	"github.com/LouisBrunner/mem-viz/pkg/contracts"
+	"github.com/LouisBrunner/mem-viz/pkg/parsingutils"
+)
+
+type SymbolsOptions struct {
+	Image
+	// String table of the symbols (the section named by sh_link)
+	Strings []byte
+	// Where the string table is in the final tree, 0 if it isn't
+	StringsAddress uintptr
+	// Finds the section a symbol is defined in, false if it doesn't exist
+	Section func(index uint16) (Target, bool)
+	// Turns a symbol's value into an address we can link to, false if it isn't mapped
+	Resolve func(section uint16, value uint64) (uintptr, bool)
+}
+
+// Parses a symbol table (SHT_SYMTAB or SHT_DYNSYM), data must contain exactly the entries.
+// The symbol names are also returned (by index) so callers can name relocations and hash entries
+func ParseSymbols(data []byte, address uintptr, options SymbolsOptions) (*contracts.MemoryBlock, []string, error) {
+	entrySize := options.SymbolSize()
+	if uint64(len(data))%entrySize != 0 {
+		return nil, nil, fmt.Errorf("symbols size %#x is not a multiple of %d", len(data), entrySize)
+	}
+	count := uint64(len(data)) / entrySize
+	root := newBlock(fmt.Sprintf("Symbols (%d)", count), address, uint64(len(data)))
+	names := make([]string, 0, count)
+
+	for i := uint64(0); i < count; i += 1 {
+		var sym any = &elf.Sym32{}
+		if options.Is64() {
+			sym = &elf.Sym64{}
+		}
+		err := ReadStruct(data, i*entrySize, options.order(), sym)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read symbol %d: %w", i, err)
+		}
+		var nameOffset uint32
+		var info uint8
+		var section uint16
+		var value uint64
+		switch sym := sym.(type) {
+		case *elf.Sym32:
+			nameOffset, info, section, value = sym.Name, sym.Info, sym.Shndx, uint64(sym.Value)
+		case *elf.Sym64:
+			nameOffset, info, section, value = sym.Name, sym.Info, sym.Shndx, sym.Value
+		}
+
+		name := ""
+		if nameOffset != 0 && options.Strings != nil {
+			name, err = ReadCString(options.Strings, uint64(nameOffset))
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to read name of symbol %d: %w", i, err)
+			}
+		}
+		// Section symbols are unnamed, they are shown with the name of their section (like readelf does)
+		if name == "" && elf.ST_TYPE(info) == elf.STT_SECTION && options.Section != nil {
+			if target, found := options.Section(section); found {
+				name = target.Name
+			}
+		}
+		names = append(names, name)
+
+		label := fmt.Sprintf("Symbol %d", i)
+		if name != "" {
+			label = fmt.Sprintf("Symbol %d (%s)", i, name)
+		}
+		block := addChild(root, label, i*entrySize, entrySize)
+		parsingutils.AddStructValues(block, sym, entrySize, parsingutils.FormatValue)
+
+		err = addSymbolLinks(block, nameOffset, section, value, options)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to link symbol %d: %w", i, err)
+		}
+	}
+	return root, names, nil
+}
+
+func addSymbolLinks(block *contracts.MemoryBlock, nameOffset uint32, section uint16, value uint64, options SymbolsOptions) error {
+	if nameOffset != 0 && options.StringsAddress != 0 {
+		err := parsingutils.AddLinkWithAddr(block, "Name", "name", options.StringsAddress+uintptr(nameOffset))
+		if err != nil {
+			return err
+		}
+	}
+	if section == uint16(elf.SHN_UNDEF) || section >= uint16(elf.SHN_LORESERVE) {
+		return nil
+	}
+	if options.Section != nil {
+		if target, found := options.Section(section); found {
+			err := parsingutils.AddLinkWithAddr(block, "Shndx", "refers to", target.Address)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if options.Resolve != nil {
+		if target, mapped := options.Resolve(section, value); mapped {
+			return parsingutils.AddLinkWithAddr(block, "Value", "points to", target)
+		}
+	}
+	return nil
+}
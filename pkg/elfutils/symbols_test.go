@@ -0,0 +1,89 @@
+package elfutils_test
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"testing"
+
+	"github.com/LouisBrunner/mem-viz/pkg/elfutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func pack(t *testing.T, order binary.ByteOrder, values ...any) []byte {
+	buf := &bytes.Buffer{}
+	for _, value := range values {
+		require.NoError(t, binary.Write(buf, order, value))
+	}
+	return buf.Bytes()
+}
+
+func Test_ParseSymbols(t *testing.T) {
+	strings := []byte("\x00main\x00")
+	data := pack(t, binary.LittleEndian,
+		elf.Sym64{},
+		elf.Sym64{Info: elf.ST_INFO(elf.STB_LOCAL, elf.STT_SECTION), Shndx: 1},
+		elf.Sym64{Name: 1, Info: elf.ST_INFO(elf.STB_GLOBAL, elf.STT_FUNC), Shndx: 1, Value: 0x1130, Size: 0x20},
+	)
+	tree, names, err := elfutils.ParseSymbols(data, 0x3c8, elfutils.SymbolsOptions{
+		Image:          elfutils.Image{Class: elf.ELFCLASS64},
+		Strings:        strings,
+		StringsAddress: 0x470,
+		Section: func(index uint16) (elfutils.Target, bool) {
+			return elfutils.Target{Name: ".text", Address: 0x2000 + uintptr(index)*0x40}, true
+		},
+		Resolve: func(section uint16, value uint64) (uintptr, bool) {
+			return uintptr(value - 0x100), true
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "Symbols (3)", tree.Name)
+	assert.Equal(t, []string{"", ".text", "main"}, names)
+	require.Len(t, tree.Content, 3)
+	assert.Equal(t, "Symbol 0", tree.Content[0].Name)
+	assert.Equal(t, "Symbol 1 (.text)", tree.Content[1].Name)
+
+	main := tree.Content[2]
+	assert.Equal(t, "Symbol 2 (main)", main.Name)
+	assert.Equal(t, uintptr(0x3f8), main.Address)
+	require.Len(t, main.Values, 6)
+	assert.Equal(t, "Name", main.Values[0].Name)
+	assert.Equal(t, uint64(0x471), main.Values[0].Links[0].TargetAddress)
+	assert.Equal(t, "STB_GLOBAL, STT_FUNC", main.Values[1].Value)
+	assert.Equal(t, "1", main.Values[3].Value)
+	assert.Equal(t, uint64(0x2040), main.Values[3].Links[0].TargetAddress)
+	assert.Equal(t, "Value", main.Values[4].Name)
+	assert.Equal(t, uint64(0x8), main.Values[4].Offset)
+	assert.Equal(t, uint64(0x1030), main.Values[4].Links[0].TargetAddress)
+}
+
+func Test_ParseSymbols_32BitBigEndian(t *testing.T) {
+	data := pack(t, binary.BigEndian, elf.Sym32{}, elf.Sym32{Name: 1, Value: 0x10000, Shndx: uint16(elf.SHN_ABS)})
+	tree, names, err := elfutils.ParseSymbols(data, 0, elfutils.SymbolsOptions{
+		Image:   elfutils.Image{Class: elf.ELFCLASS32, ByteOrder: binary.BigEndian},
+		Strings: []byte("\x00abs\x00"),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"", "abs"}, names)
+	abs := tree.Content[1]
+	assert.Equal(t, uint64(16), abs.Size)
+	assert.Equal(t, "0x10000", abs.Values[1].Value)
+	assert.Equal(t, "SHN_ABS", abs.Values[5].Value)
+	assert.Len(t, abs.Values[5].Links, 0)
+}
+
+func Test_ParseSymbols_invalidSize(t *testing.T) {
+	_, _, err := elfutils.ParseSymbols(make([]byte, 20), 0, elfutils.SymbolsOptions{Image: elfutils.Image{Class: elf.ELFCLASS64}})
+	assert.Error(t, err)
+}
+
+func Test_ParseStrings(t *testing.T) {
+	tree, err := elfutils.ParseStrings([]byte("\x00libc.so.6\x00puts\x00"), 0x100)
+	require.NoError(t, err)
+	assert.Equal(t, "Strings (3)", tree.Name)
+	require.Len(t, tree.Content, 3)
+	assert.Equal(t, `"libc.so.6"`, tree.Content[1].Name)
+	assert.Equal(t, uintptr(0x10b), tree.Content[2].Address)
+	assert.Equal(t, uint64(5), tree.Content[2].Size)
+}
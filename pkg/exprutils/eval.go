@@ -0,0 +1,46 @@
+package exprutils
+
+import "fmt"
+
+// Arithmetic and bitwise binary operators on integers, division truncates towards zero like in C
+func IntegerOp(op string, x, y int64) (int64, error) {
+	switch op {
+	case "+":
+		return x + y, nil
+	case "-":
+		return x - y, nil
+	case "*":
+		return x * y, nil
+	case "/", "%":
+		if y == 0 {
+			return 0, fmt.Errorf("division by zero")
+		}
+		if op == "/" {
+			return x / y, nil
+		}
+		return x % y, nil
+	case "&":
+		return x & y, nil
+	case "|":
+		return x | y, nil
+	case "^":
+		return x ^ y, nil
+	case "<<", ">>":
+		if y < 0 {
+			return 0, fmt.Errorf("negative shift")
+		}
+		if op == "<<" {
+			return x << y, nil
+		}
+		return x >> y, nil
+	}
+	return 0, fmt.Errorf("unknown operator %s", op)
+}
+
+// Used for offsets, counts and sizes which can't be negative
+func Unsigned(expr *Expression, n int64) (uint64, error) {
+	if n < 0 {
+		return 0, fmt.Errorf("%q is negative (%d)", expr.Source, n)
+	}
+	return uint64(n), nil
+}
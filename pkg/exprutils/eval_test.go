@@ -0,0 +1,50 @@
+package exprutils_test
+
+import (
+	"testing"
+
+	"github.com/LouisBrunner/mem-viz/pkg/exprutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_IntegerOp(t *testing.T) {
+	for _, test := range []struct {
+		op       string
+		x, y     int64
+		expected int64
+	}{
+		{"+", 2, 3, 5},
+		{"-", 2, 3, -1},
+		{"*", -2, 3, -6},
+		{"/", -7, 2, -3},
+		{"%", -7, 3, -1},
+		{"&", 6, 3, 2},
+		{"|", 6, 3, 7},
+		{"^", 6, 3, 5},
+		{"<<", 1, 4, 16},
+		{">>", -16, 2, -4},
+	} {
+		value, err := exprutils.IntegerOp(test.op, test.x, test.y)
+		require.NoError(t, err, test.op)
+		assert.Equal(t, test.expected, value, test.op)
+	}
+
+	_, err := exprutils.IntegerOp("/", 1, 0)
+	assert.EqualError(t, err, "division by zero")
+	_, err = exprutils.IntegerOp("%", 1, 0)
+	assert.EqualError(t, err, "division by zero")
+	_, err = exprutils.IntegerOp("<<", 1, -1)
+	assert.EqualError(t, err, "negative shift")
+	_, err = exprutils.IntegerOp("==", 1, 1)
+	assert.EqualError(t, err, "unknown operator ==")
+}
+
+func Test_Unsigned(t *testing.T) {
+	expr := &exprutils.Expression{Source: "x - 2"}
+	value, err := exprutils.Unsigned(expr, 3)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(3), value)
+	_, err = exprutils.Unsigned(expr, -1)
+	assert.EqualError(t, err, `"x - 2" is negative (-1)`)
+}
@@ -0,0 +1,167 @@
+package exprutils
+
+import (
+	"fmt"
+	"strings"
+)
+
+// The parts shared by the expression languages of the templates and Kaitai Struct: a tokenizer, a parser for binary
+// and unary operators and the integer arithmetic. Each language adds its own rules (e.g. the ternary operator) and
+// nodes, and evaluates them with its own values
+
+type Node interface{}
+
+// An int64, a float64, a string or whatever the language uses for true and false
+type Literal struct {
+	Value any
+}
+
+type Name struct {
+	Name string
+}
+
+type Unary struct {
+	Op string
+	X  Node
+}
+
+type Binary struct {
+	Op   string
+	X, Y Node
+}
+
+type Expression struct {
+	Source string
+	Root   Node
+}
+
+type Parser struct {
+	tokens []Token
+	pos    int
+}
+
+func NewParser(tokens []Token) *Parser {
+	return &Parser{tokens: tokens}
+}
+
+// Parses the whole source with rule, which is the loosest rule of the language
+func Parse(source string, syntax Syntax, rule func(p *Parser) (Node, error)) (*Expression, error) {
+	tokens, err := Tokenize(source, syntax)
+	if err != nil {
+		return nil, fmt.Errorf("invalid expression %q: %w", source, err)
+	}
+	p := NewParser(tokens)
+	root, err := rule(p)
+	if err == nil && !p.Done() {
+		err = fmt.Errorf("unexpected %q", p.tokens[p.pos].Text)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid expression %q: %w", source, err)
+	}
+	return &Expression{Source: source, Root: root}, nil
+}
+
+func (me *Parser) Done() bool {
+	return me.pos >= len(me.tokens)
+}
+
+func (me *Parser) Pos() int {
+	return me.pos
+}
+
+// Source of the tokens read since pos, separated by spaces
+func (me *Parser) TextSince(pos int) string {
+	texts := []string{}
+	for _, tok := range me.tokens[pos:me.pos] {
+		texts = append(texts, tok.Text)
+	}
+	return strings.Join(texts, " ")
+}
+
+// Next token, false at the end
+func (me *Parser) Next() (Token, bool) {
+	if me.Done() {
+		return Token{}, false
+	}
+	me.pos += 1
+	return me.tokens[me.pos-1], true
+}
+
+// Name of the next token if it is one, which is only read if it is
+func (me *Parser) AcceptName() (string, bool) {
+	if me.Done() || me.tokens[me.pos].Kind != TokenName {
+		return "", false
+	}
+	me.pos += 1
+	return me.tokens[me.pos-1].Text, true
+}
+
+func (me *Parser) PeekOperator() string {
+	if !me.Done() && me.tokens[me.pos].Kind == TokenOperator {
+		return me.tokens[me.pos].Text
+	}
+	return ""
+}
+
+// Operators and keywords (e.g. "and")
+func (me *Parser) Peek() string {
+	if !me.Done() && (me.tokens[me.pos].Kind == TokenOperator || me.tokens[me.pos].Kind == TokenName) {
+		return me.tokens[me.pos].Text
+	}
+	return ""
+}
+
+func (me *Parser) Accept(text string) bool {
+	if me.Peek() == text {
+		me.pos += 1
+		return true
+	}
+	return false
+}
+
+func (me *Parser) Expect(text string) error {
+	if me.Accept(text) {
+		return nil
+	}
+	if !me.Done() {
+		return fmt.Errorf("expected %q instead of %q", text, me.tokens[me.pos].Text)
+	}
+	return fmt.Errorf("expected %q", text)
+}
+
+// Precedence climbing (a higher precedence binds tighter), all binary operators are left associative
+func (me *Parser) ParseBinary(precedences map[string]int, minPrecedence int, operand func() (Node, error)) (Node, error) {
+	x, err := operand()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op := me.PeekOperator()
+		precedence, found := precedences[op]
+		if !found || precedence < minPrecedence {
+			return x, nil
+		}
+		me.pos += 1
+		y, err := me.ParseBinary(precedences, precedence+1, operand)
+		if err != nil {
+			return nil, err
+		}
+		x = &Binary{Op: op, X: x, Y: y}
+	}
+}
+
+// Any number of prefix operators before an operand, "+" is accepted and dropped if it is one of them
+func (me *Parser) ParseUnary(ops []string, operand func() (Node, error)) (Node, error) {
+	for _, op := range ops {
+		if me.PeekOperator() != op {
+			continue
+		}
+		me.pos += 1
+		x, err := me.ParseUnary(ops, operand)
+		if err != nil || op == "+" {
+			return x, err
+		}
+		return &Unary{Op: op, X: x}, nil
+	}
+	return operand()
+}
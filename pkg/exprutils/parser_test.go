@@ -0,0 +1,122 @@
+package exprutils_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/LouisBrunner/mem-viz/pkg/exprutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var syntax = exprutils.Syntax{Operators: []string{"<<", "+", "-", "*", "~", "(", ")", ","}}
+
+func Test_Tokenize(t *testing.T) {
+	tokens, err := exprutils.Tokenize("x1 + 0x10 << \"a\\n\"", syntax)
+	require.NoError(t, err)
+	assert.Equal(t, []exprutils.Token{
+		{Kind: exprutils.TokenName, Text: "x1"},
+		{Kind: exprutils.TokenOperator, Text: "+"},
+		{Kind: exprutils.TokenInt, Text: "0x10", Value: int64(16)},
+		{Kind: exprutils.TokenOperator, Text: "<<"},
+		{Kind: exprutils.TokenString, Text: `"a\n"`, Value: "a\n"},
+	}, tokens)
+
+	// Masks wrap around
+	tokens, err = exprutils.Tokenize("0xffffffffffffffff", syntax)
+	require.NoError(t, err)
+	assert.Equal(t, int64(-1), tokens[0].Value)
+
+	// Floats and single quotes are opt-in
+	tokens, err = exprutils.Tokenize(`1.5 1e3 1.to_s '\n'`, exprutils.Syntax{Operators: []string{"."}, Floats: true, SingleQuotes: true})
+	require.NoError(t, err)
+	assert.Equal(t, []exprutils.Token{
+		{Kind: exprutils.TokenFloat, Text: "1.5", Value: 1.5},
+		{Kind: exprutils.TokenFloat, Text: "1e3", Value: 1000.0},
+		{Kind: exprutils.TokenInt, Text: "1", Value: int64(1)},
+		{Kind: exprutils.TokenOperator, Text: "."},
+		{Kind: exprutils.TokenName, Text: "to_s"},
+		{Kind: exprutils.TokenString, Text: `'\n'`, Value: `\n`},
+	}, tokens)
+	_, err = exprutils.Tokenize("1e3", syntax)
+	assert.ErrorContains(t, err, `invalid number "1e3"`)
+	_, err = exprutils.Tokenize("'a'", syntax)
+	assert.ErrorContains(t, err, `unexpected character '\''`)
+
+	_, err = exprutils.Tokenize(`"abc`, syntax)
+	assert.ErrorContains(t, err, "unterminated string")
+}
+
+// A small language made of names, integers and parentheses
+func parse(source string) (*exprutils.Expression, error) {
+	precedences := map[string]int{"<<": 1, "+": 2, "-": 2, "*": 3}
+	var rule func(p *exprutils.Parser) (exprutils.Node, error)
+	rule = func(p *exprutils.Parser) (exprutils.Node, error) {
+		return p.ParseBinary(precedences, 1, func() (exprutils.Node, error) {
+			return p.ParseUnary([]string{"-", "~", "+"}, func() (exprutils.Node, error) {
+				if p.Accept("(") {
+					x, err := rule(p)
+					if err != nil {
+						return nil, err
+					}
+					return x, p.Expect(")")
+				}
+				if name, ok := p.AcceptName(); ok {
+					return &exprutils.Name{Name: name}, nil
+				}
+				tok, ok := p.Next()
+				if !ok {
+					return nil, fmt.Errorf("unexpected end")
+				}
+				return &exprutils.Literal{Value: tok.Value}, nil
+			})
+		})
+	}
+	return exprutils.Parse(source, syntax, rule)
+}
+
+func Test_Parse(t *testing.T) {
+	expr, err := parse("a - 1 - -b * (2 + +3) << ~c")
+	require.NoError(t, err)
+	assert.Equal(t, "a - 1 - -b * (2 + +3) << ~c", expr.Source)
+	// Left associative and "+" is dropped
+	assert.Equal(t, &exprutils.Binary{
+		Op: "<<",
+		X: &exprutils.Binary{
+			Op: "-",
+			X:  &exprutils.Binary{Op: "-", X: &exprutils.Name{Name: "a"}, Y: &exprutils.Literal{Value: int64(1)}},
+			Y: &exprutils.Binary{
+				Op: "*",
+				X:  &exprutils.Unary{Op: "-", X: &exprutils.Name{Name: "b"}},
+				Y:  &exprutils.Binary{Op: "+", X: &exprutils.Literal{Value: int64(2)}, Y: &exprutils.Literal{Value: int64(3)}},
+			},
+		},
+		Y: &exprutils.Unary{Op: "~", X: &exprutils.Name{Name: "c"}},
+	}, expr.Root)
+
+	for source, message := range map[string]string{
+		"a b":   `invalid expression "a b": unexpected "b"`,
+		"(a":    `invalid expression "(a": expected ")"`,
+		"(a b)": `invalid expression "(a b)": expected ")" instead of "b"`,
+		"a +":   `invalid expression "a +": unexpected end`,
+		"a $":   `invalid expression "a $": unexpected character '$'`,
+	} {
+		_, err := parse(source)
+		assert.EqualError(t, err, message, source)
+	}
+}
+
+func Test_Parser_TextSince(t *testing.T) {
+	tokens, err := exprutils.Tokenize("f(a+1, b)", syntax)
+	require.NoError(t, err)
+	p := exprutils.NewParser(tokens)
+	p.Next()
+	p.Next()
+	start := p.Pos()
+	for p.Peek() != "," {
+		p.Next()
+	}
+	assert.Equal(t, "a + 1", p.TextSince(start))
+	assert.True(t, p.Accept(","))
+	assert.False(t, p.Done())
+}
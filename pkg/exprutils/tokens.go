@@ -0,0 +1,129 @@
+package exprutils
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type TokenKind int
+
+const (
+	TokenInt TokenKind = iota
+	TokenFloat
+	TokenString
+	TokenName
+	TokenOperator
+)
+
+// Value is an int64, a float64 or a string for literals, nil otherwise
+type Token struct {
+	Kind  TokenKind
+	Text  string
+	Value any
+}
+
+// What a language accepts on top of integers, double-quoted strings (with Go escapes) and names
+type Syntax struct {
+	// Longest first so "<<" isn't read as two "<"
+	Operators []string
+	// e.g. "1.5" or "1e3"
+	Floats bool
+	// Single-quoted strings have no escapes
+	SingleQuotes bool
+}
+
+func isNameChar(c byte, first bool) bool {
+	return c == '_' || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || (!first && '0' <= c && c <= '9')
+}
+
+func Tokenize(source string, syntax Syntax) ([]Token, error) {
+	tokens := []Token{}
+	for i := 0; i < len(source); {
+		c := source[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i += 1
+		case '0' <= c && c <= '9':
+			token, end, err := tokenizeNumber(source, i, syntax)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, token)
+			i = end
+		case c == '"' || (c == '\'' && syntax.SingleQuotes):
+			end := i + 1
+			for end < len(source) && source[end] != c {
+				if c == '"' && source[end] == '\\' {
+					end += 1
+				}
+				end += 1
+			}
+			if end >= len(source) {
+				return nil, fmt.Errorf("unterminated string")
+			}
+			text := source[i : end+1]
+			value := text[1 : len(text)-1]
+			if c == '"' {
+				var err error
+				value, err = strconv.Unquote(text)
+				if err != nil {
+					return nil, fmt.Errorf("invalid string %s", text)
+				}
+			}
+			tokens = append(tokens, Token{Kind: TokenString, Text: text, Value: value})
+			i = end + 1
+		case isNameChar(c, true):
+			end := i
+			for end < len(source) && isNameChar(source[end], false) {
+				end += 1
+			}
+			tokens = append(tokens, Token{Kind: TokenName, Text: source[i:end]})
+			i = end
+		default:
+			found := false
+			for _, op := range syntax.Operators {
+				if strings.HasPrefix(source[i:], op) {
+					tokens = append(tokens, Token{Kind: TokenOperator, Text: op})
+					i += len(op)
+					found = true
+					break
+				}
+			}
+			if !found {
+				return nil, fmt.Errorf("unexpected character %q", c)
+			}
+		}
+	}
+	return tokens, nil
+}
+
+func tokenizeNumber(source string, start int, syntax Syntax) (Token, int, error) {
+	end := start
+	for end < len(source) && isNameChar(source[end], false) {
+		end += 1
+	}
+	isFloat := false
+	// "1.5" is a float but "1.to_s" is a method call
+	if syntax.Floats && end+1 < len(source) && source[end] == '.' && '0' <= source[end+1] && source[end+1] <= '9' {
+		isFloat = true
+		end += 1
+		for end < len(source) && (isNameChar(source[end], false) || ((source[end] == '+' || source[end] == '-') && (source[end-1] == 'e' || source[end-1] == 'E'))) {
+			end += 1
+		}
+	}
+	text := source[start:end]
+	if isFloat || (syntax.Floats && !strings.HasPrefix(text, "0x") && strings.ContainsAny(text, "eE")) {
+		value, err := strconv.ParseFloat(strings.ReplaceAll(text, "_", ""), 64)
+		if err != nil {
+			return Token{}, 0, fmt.Errorf("invalid number %q", text)
+		}
+		return Token{Kind: TokenFloat, Text: text, Value: value}, end, nil
+	}
+	// Large unsigned constants (e.g. masks) wrap around like the fields they are compared to
+	value, err := strconv.ParseUint(text, 0, 64)
+	if err != nil {
+		return Token{}, 0, fmt.Errorf("invalid number %q", text)
+	}
+	return Token{Kind: TokenInt, Text: text, Value: int64(value)}, end, nil
+}
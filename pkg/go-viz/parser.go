@@ -0,0 +1,184 @@
+package golang
+
+import (
+	"bytes"
+	"debug/elf"
+	"debug/macho"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/LouisBrunner/mem-viz/pkg/contracts"
+	"github.com/LouisBrunner/mem-viz/pkg/goutils"
+	"github.com/LouisBrunner/mem-viz/pkg/parsingutils"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/exp/slices"
+)
+
+type parser struct {
+	logger *logrus.Logger
+}
+
+func Parse(logger *logrus.Logger, file string) (*contracts.MemoryBlock, error) {
+	p := &parser{
+		logger: logger,
+	}
+	return p.parse(file)
+}
+
+// Symbols used to find the runtime structures, they are only a shortcut as they can be found without them
+type symbols map[string]uint64
+
+func (me *parser) parse(file string) (*contracts.MemoryBlock, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	img, syms, err := me.load(data)
+	if err != nil {
+		return nil, err
+	}
+
+	root := &contracts.MemoryBlock{
+		Name: file,
+		Size: uint64(len(data)),
+	}
+	blocks := []*contracts.MemoryBlock{}
+	for _, sect := range img.Sections {
+		if sect.Size == 0 {
+			continue
+		}
+		blocks = append(blocks, &contracts.MemoryBlock{
+			Name:    sect.Name,
+			Address: uintptr(sect.Offset),
+			Size:    sect.Size,
+		})
+	}
+	found, err := me.addRuntime(img, syms)
+	if err != nil {
+		return nil, err
+	}
+	blocks = append(blocks, found...)
+
+	// Blocks are found in any order (e.g. functions point to their names), so they are nested from the lowest address
+	slices.SortStableFunc(blocks, func(a, b *contracts.MemoryBlock) int {
+		if a.Address != b.Address {
+			return int(a.Address) - int(b.Address)
+		}
+		return int(b.Size) - int(a.Size)
+	})
+	for _, block := range blocks {
+		parent, sibling := parsingutils.AddChildDeep(root, block)
+		if sibling != nil {
+			me.logger.Warnf("dropping %s as it overlaps %s", block.Name, sibling.Name)
+			continue
+		}
+		block.ParentOffset = uint64(block.Address - parent.Address)
+	}
+
+	return root, nil
+}
+
+func (me *parser) load(data []byte) (goutils.Image, symbols, error) {
+	syms := symbols{}
+	if bytes.HasPrefix(data, []byte(elf.ELFMAG)) {
+		f, err := elf.NewFile(bytes.NewReader(data))
+		if err != nil {
+			return goutils.Image{}, nil, err
+		}
+		// Stripped binaries don't have any, which is fine
+		list, _ := f.Symbols()
+		for _, sym := range list {
+			syms[sym.Name] = sym.Value
+		}
+		return goutils.NewELFImage(f, data), syms, nil
+	}
+
+	f, err := macho.NewFile(bytes.NewReader(data))
+	if err != nil {
+		if _, fatErr := macho.NewFatFile(bytes.NewReader(data)); fatErr == nil {
+			return goutils.Image{}, nil, fmt.Errorf("universal binaries aren't supported, extract an architecture first (e.g. with lipo -thin)")
+		}
+		return goutils.Image{}, nil, fmt.Errorf("not an ELF or Mach-O binary: %w", err)
+	}
+	if f.Symtab != nil {
+		for _, sym := range f.Symtab.Syms {
+			syms[strings.TrimPrefix(sym.Name, "_")] = sym.Value
+		}
+	}
+	return goutils.NewMachOImage(f, data), syms, nil
+}
+
+// Finds the structures of the runtime through their symbols, their sections or by looking for them
+func (me *parser) addRuntime(img goutils.Image, syms symbols) ([]*contracts.MemoryBlock, error) {
+	blocks := []*contracts.MemoryBlock{}
+
+	buildInfo, found := img.Section(".go.buildinfo", "__go_buildinfo")
+	addr := buildInfo.Addr
+	if !found {
+		addr, found = goutils.FindBuildInfo(img)
+	}
+	if found {
+		found, err := goutils.ParseBuildInfo(img, addr)
+		if err != nil {
+			me.logger.Warnf("failed to parse the build information: %v", err)
+		}
+		blocks = append(blocks, found...)
+	} else {
+		me.logger.Warnf("no build information found")
+	}
+
+	pclntab, found := syms["runtime.pcheader"]
+	if !found {
+		var sect goutils.Section
+		sect, found = img.Section(".gopclntab", "__gopclntab")
+		pclntab = sect.Addr
+	}
+	if !found {
+		pclntab, found = goutils.FindPclntab(img)
+	}
+	if !found {
+		return nil, fmt.Errorf("no pclntab found, is it a Go binary?")
+	}
+
+	moduledata, found := syms["runtime.firstmoduledata"]
+	if !found {
+		moduledata, found = goutils.FindModuledata(img, pclntab)
+	}
+	md := &goutils.Moduledata{}
+	if found {
+		var mdBlocks []*contracts.MemoryBlock
+		var err error
+		mdBlocks, md, err = goutils.ParseModuledata(img, moduledata, pclntab)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse the moduledata: %w", err)
+		}
+		if md.Layout == "" {
+			me.logger.Warnf("unknown moduledata layout, only the fields shared by every version are shown")
+		} else {
+			me.logger.Debugf("moduledata has the layout of %s", md.Layout)
+		}
+		blocks = append(blocks, mdBlocks...)
+	} else {
+		me.logger.Warnf("no moduledata found, function entries rely on the pclntab")
+	}
+
+	pclnBlocks, tab, err := goutils.ParsePclntab(img, pclntab, md.Field("text"), md.Field("gofunc"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse the pclntab: %w", err)
+	}
+	me.logger.Debugf("found %d functions", len(tab.Functions))
+	blocks = append(blocks, pclnBlocks...)
+
+	if md.Layout == "" {
+		return blocks, nil
+	}
+	typeBlocks, warnings, err := goutils.ParseTypes(img, md)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse the types: %w", err)
+	}
+	for _, warning := range warnings {
+		me.logger.Warnf("%v", warning)
+	}
+	return append(blocks, typeBlocks...), nil
+}
@@ -0,0 +1,183 @@
+package goutils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/LouisBrunner/mem-viz/pkg/contracts"
+	"github.com/LouisBrunner/mem-viz/pkg/parsingutils"
+)
+
+// The runtime tables point to each other through addresses or offsets (e.g. functions point to their name in the
+// funcnametab), so the decoders in this package take the whole image and return every block they found at its file
+// offset, it's up to the caller to nest them where they belong
+
+func newBlock(name string, offset, size uint64) *contracts.MemoryBlock {
+	return &contracts.MemoryBlock{
+		Name:    name,
+		Address: uintptr(offset),
+		Size:    size,
+	}
+}
+
+func addValue(block *contracts.MemoryBlock, name string, value any, offset uint64, size uint64) {
+	parsingutils.AddValue(block, name, value, offset, uint8(min(size, 0xff)), parsingutils.FormatValue)
+}
+
+func addString(block *contracts.MemoryBlock, name string, value string, offset uint64, size uint64) {
+	parsingutils.AddValue(block, name, value, offset, uint8(min(size, 0xff)), func(name string, value any) string {
+		return fmt.Sprintf("%q", value)
+	})
+}
+
+func addBytes(block *contracts.MemoryBlock, name string, value []byte, offset uint64) {
+	parsingutils.AddValue(block, name, value, offset, uint8(min(len(value), 0xff)), func(name string, value any) string {
+		return fmt.Sprintf("% x", value)
+	})
+}
+
+// Unpacks one of the fixed-size structs of this package (e.g. Func120) at offset
+func ReadStruct(data []byte, offset uint64, order binary.ByteOrder, v any) error {
+	size := uint64(binary.Size(v))
+	if offset > uint64(len(data)) || size > uint64(len(data))-offset {
+		return fmt.Errorf("out of bounds: %#x+%#x > %#x", offset, size, len(data))
+	}
+	return binary.Read(bytes.NewReader(data[offset:offset+size]), order, v)
+}
+
+// Reads a NUL-terminated string, strings running until the end of the data are accepted
+func readCString(data []byte, offset uint64) (string, error) {
+	if offset >= uint64(len(data)) {
+		return "", fmt.Errorf("out of bounds: %#x >= %#x", offset, len(data))
+	}
+	end := bytes.IndexByte(data[offset:], 0)
+	if end < 0 {
+		return string(data[offset:]), nil
+	}
+	return string(data[offset : offset+uint64(end)]), nil
+}
+
+// Reads a string prefixed by its length as an unsigned varint, the size includes the length
+func readVarString(data []byte, offset uint64) (string, uint64, error) {
+	if offset >= uint64(len(data)) {
+		return "", 0, fmt.Errorf("out of bounds: %#x >= %#x", offset, len(data))
+	}
+	length, n := binary.Uvarint(data[offset:])
+	if n <= 0 {
+		return "", 0, fmt.Errorf("invalid length at %#x", offset)
+	}
+	start := offset + uint64(n)
+	if length > uint64(len(data))-start {
+		return "", 0, fmt.Errorf("out of bounds: %#x+%#x > %#x", start, length, len(data))
+	}
+	return string(data[start : start+length]), uint64(n) + length, nil
+}
+
+// Collects the blocks found by a decoder, blocks found several times (e.g. types used by many itabs) are only added once
+type decoded struct {
+	blocks []*contracts.MemoryBlock
+	seen   map[uintptr]*contracts.MemoryBlock
+}
+
+func newDecoded() *decoded {
+	return &decoded{seen: map[uintptr]*contracts.MemoryBlock{}}
+}
+
+func (me *decoded) add(block *contracts.MemoryBlock) *contracts.MemoryBlock {
+	if found, ok := me.seen[block.Address]; ok {
+		return found
+	}
+	me.seen[block.Address] = block
+	me.blocks = append(me.blocks, block)
+	return block
+}
+
+// Adds the fields of a runtime struct one by one as their size depends on the pointer size of the image (e.g. the
+// moduledata), the data must already contain the whole struct
+type fields struct {
+	img    Image
+	block  *contracts.MemoryBlock
+	data   []byte
+	offset uint64
+	// First link which couldn't be added, so the fields can be added without checking each of them
+	err error
+}
+
+func newFields(img Image, block *contracts.MemoryBlock, data []byte) *fields {
+	return &fields{img: img, block: block, data: data}
+}
+
+func (me *fields) word(name string) uint64 {
+	value := me.img.word(me.data, me.offset)
+	addValue(me.block, name, me.img.sized(value), me.offset, me.img.PtrSize)
+	me.offset += me.img.PtrSize
+	return value
+}
+
+func (me *fields) uint32(name string) uint32 {
+	value := me.img.ByteOrder.Uint32(me.data[me.offset:])
+	addValue(me.block, name, value, me.offset, 4)
+	me.offset += 4
+	return value
+}
+
+func (me *fields) int32(name string) int32 {
+	value := int32(me.img.ByteOrder.Uint32(me.data[me.offset:]))
+	addValue(me.block, name, value, me.offset, 4)
+	me.offset += 4
+	return value
+}
+
+func (me *fields) uint16(name string) uint16 {
+	value := me.img.ByteOrder.Uint16(me.data[me.offset:])
+	addValue(me.block, name, value, me.offset, 2)
+	me.offset += 2
+	return value
+}
+
+func (me *fields) uint8(name string, format parsingutils.Formatter) uint8 {
+	value := me.data[me.offset]
+	parsingutils.AddValue(me.block, name, value, me.offset, 1, format)
+	me.offset += 1
+	return value
+}
+
+// Slices are shown as their three words, the pointer is named after the field
+func (me *fields) slice(name string) (uint64, uint64) {
+	ptr := me.word(name)
+	length := me.word(name + ".len")
+	me.word(name + ".cap")
+	return ptr, length
+}
+
+func (me *fields) string(name string) (uint64, uint64) {
+	ptr := me.word(name)
+	length := me.word(name + ".len")
+	return ptr, length
+}
+
+func (me *fields) align(size uint64) {
+	me.offset = (me.offset + size - 1) / size * size
+}
+
+// Links a field to an address of the image, addresses which aren't in the file (e.g. the .bss) are skipped
+func (me *fields) link(name string, addr uint64, linkName string) {
+	offset, found := me.img.Offset(addr)
+	if addr == 0 || !found || me.err != nil {
+		return
+	}
+	me.err = parsingutils.AddLinkWithAddr(me.block, name, linkName, uintptr(offset))
+}
+
+// Same as link for a target which is already a file offset (e.g. an entry of one of the pclntab tables)
+func (me *fields) linkOffset(name string, offset uint64, linkName string) {
+	if me.err != nil {
+		return
+	}
+	me.err = parsingutils.AddLinkWithAddr(me.block, name, linkName, uintptr(offset))
+}
+
+func (me *fields) linkBlock(name string, block *contracts.MemoryBlock, linkName string) {
+	me.linkOffset(name, uint64(block.Address), linkName)
+}
@@ -0,0 +1,142 @@
+package goutils
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/LouisBrunner/mem-viz/pkg/contracts"
+	"github.com/LouisBrunner/mem-viz/pkg/parsingutils"
+)
+
+const (
+	BuildInfoMagic = "\xff Go buildinf:"
+	// Size of the header before the version and module strings
+	buildInfoHeaderSize = 32
+	// Set when the strings follow the header instead of being pointed to (Go 1.18 and later)
+	buildInfoInline = 0x2
+)
+
+// The module information is wrapped in these markers by the go command
+var (
+	modInfoStart = []byte("\x30\x77\xaf\x0c\x92\x74\x08\x02\x41\xe1\xc1\x07\xe6\xd6\x18\xe6")
+	modInfoEnd   = []byte("\xf9\x32\x43\x31\x86\x18\x20\x72\x00\x82\x42\x10\x41\x16\xd8\xf2")
+)
+
+// Parses the build information (.go.buildinfo) at an address: the Go version the binary was built with and the
+// modules it contains, with a value per line of the module information (e.g. "dep golang.org/x/exp")
+func ParseBuildInfo(img Image, addr uint64) ([]*contracts.MemoryBlock, error) {
+	data, offset, err := img.readAll(addr)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < buildInfoHeaderSize || !bytes.HasPrefix(data, []byte(BuildInfoMagic)) {
+		return nil, fmt.Errorf("no build information at %#x", addr)
+	}
+	flags := data[len(BuildInfoMagic)+1]
+	if flags&buildInfoInline == 0 {
+		return nil, fmt.Errorf("build information of Go 1.17 and earlier isn't supported")
+	}
+
+	root := newBlock("Go Build Info", offset, 0)
+	addString(root, "Magic", BuildInfoMagic, 0, uint64(len(BuildInfoMagic)))
+	addValue(root, "PtrSize", data[len(BuildInfoMagic)], uint64(len(BuildInfoMagic)), 1)
+	parsingutils.AddValue(root, "Flags", flags, uint64(len(BuildInfoMagic))+1, 1, func(name string, value any) string {
+		return fmt.Sprintf("%#x (inline strings)", value)
+	})
+
+	version, size, err := readVarString(data, buildInfoHeaderSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the Go version: %w", err)
+	}
+	addString(root, "Version", version, buildInfoHeaderSize, size)
+	cursor := buildInfoHeaderSize + size
+
+	modInfo, size, err := readVarString(data, cursor)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the module information: %w", err)
+	}
+	root.Size = cursor + size
+	blocks := []*contracts.MemoryBlock{root}
+	if len(modInfo) == 0 {
+		return blocks, nil
+	}
+	// The length is followed by the string itself
+	start := cursor + size - uint64(len(modInfo))
+	modules := newBlock("Modules", offset+start, uint64(len(modInfo)))
+	addValue(root, "ModInfo", uint64(len(modInfo)), cursor, start-cursor)
+	err = parsingutils.AddLinkWithBlock(root, "ModInfo", modules, "gives size")
+	if err != nil {
+		return nil, err
+	}
+	addModInfo(modules, modInfo)
+	return append(blocks, modules), nil
+}
+
+// Each line is a kind of entry followed by tab-separated fields, e.g. "dep\tpath\tversion\tsum"
+func addModInfo(block *contracts.MemoryBlock, modInfo string) {
+	lineStart := uint64(0)
+	marked := strings.HasPrefix(modInfo, string(modInfoStart)) && strings.HasSuffix(modInfo, string(modInfoEnd))
+	if marked {
+		addBytes(block, "Start", modInfoStart, 0)
+		lineStart = uint64(len(modInfoStart))
+		modInfo = modInfo[:len(modInfo)-len(modInfoEnd)]
+	}
+	for lineStart < uint64(len(modInfo)) {
+		line := modInfo[lineStart:]
+		if end := strings.IndexByte(line, '\n'); end >= 0 {
+			line = line[:end]
+		}
+		if line != "" {
+			name, value := modInfoLine(line)
+			addString(block, name, value, lineStart, uint64(len(line)))
+		}
+		lineStart += uint64(len(line)) + 1
+	}
+	if marked {
+		addBytes(block, "End", modInfoEnd, uint64(len(modInfo)))
+	}
+}
+
+func modInfoLine(line string) (string, string) {
+	parts := strings.Split(line, "\t")
+	kind := parts[0]
+	switch kind {
+	case "mod", "dep", "=>":
+		if len(parts) < 2 {
+			break
+		}
+		name := fmt.Sprintf("%s %s", kind, parts[1])
+		version := ""
+		if len(parts) > 2 {
+			version = parts[2]
+		}
+		if len(parts) > 3 && parts[3] != "" {
+			version = fmt.Sprintf("%s (%s)", version, parts[3])
+		}
+		return name, version
+	case "build":
+		if len(parts) < 2 {
+			break
+		}
+		key, value, _ := strings.Cut(parts[1], "=")
+		return fmt.Sprintf("build %s", key), value
+	}
+	return kind, strings.Join(parts[1:], "\t")
+}
+
+// Finds the build information by its magic for binaries without sections, it is aligned to 16 bytes
+func FindBuildInfo(img Image) (uint64, bool) {
+	for _, sect := range img.Sections {
+		data, _, err := img.readAll(sect.Addr)
+		if err != nil {
+			continue
+		}
+		for offset := (16 - sect.Addr%16) % 16; offset+buildInfoHeaderSize <= uint64(len(data)); offset += 16 {
+			if bytes.HasPrefix(data[offset:], []byte(BuildInfoMagic)) {
+				return sect.Addr + offset, true
+			}
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,65 @@
+package goutils_test
+
+import (
+	"runtime"
+	"testing"
+
+	"github.com/LouisBrunner/mem-viz/pkg/contracts/contractstest"
+	"github.com/LouisBrunner/mem-viz/pkg/goutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_ParseBuildInfo(t *testing.T) {
+	modInfo := "0w\xaf\x0c\x92t\x08\x02A\xe1\xc1\x07\xe6\xd6\x18\xe6" +
+		"path\texample.com/cmd/app\n" +
+		"mod\texample.com\t(devel)\t\n" +
+		"dep\tgolang.org/x/exp\tv0.1.0\th1:abc=\n" +
+		"build\tGOOS=linux\n" +
+		"\xf92C1\x86\x18 r\x00\x82B\x10A\x16\xd8\xf2"
+	section := make([]byte, 0x30)
+	copy(section[0x10:], goutils.BuildInfoMagic)
+	section[0x10+14] = 8
+	section[0x10+15] = 2
+	section = append(section, 8)
+	section = append(section, "go1.99.0"...)
+	section = append(section, byte(len(modInfo)), 1)
+	section = append(section, modInfo...)
+	img := newImage(section)
+
+	addr, found := goutils.FindBuildInfo(img)
+	require.True(t, found)
+	assert.Equal(t, uint64(0x1010), addr)
+
+	blocks, err := goutils.ParseBuildInfo(img, addr)
+	require.NoError(t, err)
+	root := contractstest.FindBlock(t, blocks, "Go Build Info")
+	assert.Equal(t, uintptr(0x110), root.Address)
+	assert.Equal(t, `"go1.99.0"`, contractstest.FindValue(t, root, "Version").Value)
+
+	modules := contractstest.FindBlock(t, blocks, "Modules")
+	assert.Equal(t, uintptr(0x110+0x2b), modules.Address)
+	assert.Equal(t, uint64(len(modInfo)), modules.Size)
+	assert.Equal(t, modules.Address, uintptr(contractstest.FindValue(t, root, "ModInfo").Links[0].TargetAddress))
+	assert.Equal(t, `"example.com/cmd/app"`, contractstest.FindValue(t, modules, "path").Value)
+	assert.Equal(t, `"(devel)"`, contractstest.FindValue(t, modules, "mod example.com").Value)
+	dep := contractstest.FindValue(t, modules, "dep golang.org/x/exp")
+	assert.Equal(t, `"v0.1.0 (h1:abc=)"`, dep.Value)
+	assert.Equal(t, uint64(0x10+25+25), dep.Offset)
+	assert.Equal(t, `"linux"`, contractstest.FindValue(t, modules, "build GOOS").Value)
+	assert.Equal(t, uint64(len(modInfo)-16), contractstest.FindValue(t, modules, "End").Offset)
+}
+
+func Test_ParseBuildInfo_invalid(t *testing.T) {
+	_, err := goutils.ParseBuildInfo(newImage(make([]byte, 0x40)), 0x1000)
+	assert.Error(t, err)
+}
+
+func Test_ParseBuildInfo_self(t *testing.T) {
+	img := selfImage(t)
+	addr, found := goutils.FindBuildInfo(img)
+	require.True(t, found)
+	blocks, err := goutils.ParseBuildInfo(img, addr)
+	require.NoError(t, err)
+	assert.Equal(t, `"`+runtime.Version()+`"`, contractstest.FindValue(t, contractstest.FindBlock(t, blocks, "Go Build Info"), "Version").Value)
+}
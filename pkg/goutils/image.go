@@ -0,0 +1,154 @@
+package goutils
+
+import (
+	"debug/elf"
+	"debug/macho"
+	"encoding/binary"
+	"fmt"
+)
+
+// Where a section is in memory and in the file, used to turn the addresses stored by the linker into file offsets
+type Section struct {
+	Name   string
+	Addr   uint64
+	Offset uint64
+	// Only the part backed by the file (zero-filled sections like .bss have none)
+	Size uint64
+}
+
+// Layout of the binary being decoded, blocks are given at their file offset (i.e. the file is expected to start at 0)
+type Image struct {
+	// Contents of the whole file
+	Data      []byte
+	PtrSize   uint64
+	ByteOrder binary.ByteOrder
+	Sections  []Section
+}
+
+func NewELFImage(f *elf.File, data []byte) Image {
+	img := Image{
+		Data:      data,
+		PtrSize:   4,
+		ByteOrder: f.ByteOrder,
+	}
+	if f.Class == elf.ELFCLASS64 {
+		img.PtrSize = 8
+	}
+	for _, sect := range f.Sections {
+		if sect.Flags&elf.SHF_ALLOC == 0 || sect.Type == elf.SHT_NOBITS {
+			continue
+		}
+		img.Sections = append(img.Sections, Section{
+			Name:   sect.Name,
+			Addr:   sect.Addr,
+			Offset: sect.Offset,
+			Size:   sect.Size,
+		})
+	}
+	return img
+}
+
+// Mach-O section types which are zero-filled by the loader (S_ZEROFILL, S_GB_ZEROFILL and S_THREAD_LOCAL_ZEROFILL)
+var machoZeroFill = map[uint32]bool{0x1: true, 0xc: true, 0x12: true}
+
+func NewMachOImage(f *macho.File, data []byte) Image {
+	img := Image{
+		Data:      data,
+		PtrSize:   4,
+		ByteOrder: f.ByteOrder,
+	}
+	if f.Magic == macho.Magic64 {
+		img.PtrSize = 8
+	}
+	for _, sect := range f.Sections {
+		if machoZeroFill[sect.Flags&0xff] {
+			continue
+		}
+		img.Sections = append(img.Sections, Section{
+			Name:   sect.Name,
+			Addr:   sect.Addr,
+			Offset: uint64(sect.Offset),
+			Size:   sect.Size,
+		})
+	}
+	return img
+}
+
+// Finds a section by name (e.g. ".gopclntab" or "__gopclntab"), false if there is none
+func (me Image) Section(names ...string) (Section, bool) {
+	for _, sect := range me.Sections {
+		for _, name := range names {
+			if sect.Name == name {
+				return sect, true
+			}
+		}
+	}
+	return Section{}, false
+}
+
+// Returns the file offset of an address and how many bytes are left in its section
+func (me Image) locate(addr uint64) (uint64, uint64, bool) {
+	for _, sect := range me.Sections {
+		if sect.Addr > addr || addr-sect.Addr >= sect.Size {
+			continue
+		}
+		offset := sect.Offset + (addr - sect.Addr)
+		end := min(sect.Offset+sect.Size, uint64(len(me.Data)))
+		if offset >= end {
+			return 0, 0, false
+		}
+		return offset, end - offset, true
+	}
+	return 0, 0, false
+}
+
+// Turns an address into a file offset, false if it isn't backed by the file
+func (me Image) Offset(addr uint64) (uint64, bool) {
+	offset, _, found := me.locate(addr)
+	return offset, found
+}
+
+// Returns the data at an address which must be contiguous in the file, and its file offset
+func (me Image) read(addr, size uint64) ([]byte, uint64, error) {
+	offset, left, found := me.locate(addr)
+	if !found {
+		return nil, 0, fmt.Errorf("address %#x is not in the file", addr)
+	}
+	if size > left {
+		return nil, 0, fmt.Errorf("address %#x+%#x is not in the file", addr, size)
+	}
+	return me.Data[offset : offset+size], offset, nil
+}
+
+// Returns the data from an address until the end of its section, and its file offset
+func (me Image) readAll(addr uint64) ([]byte, uint64, error) {
+	offset, left, found := me.locate(addr)
+	if !found {
+		return nil, 0, fmt.Errorf("address %#x is not in the file", addr)
+	}
+	return me.Data[offset : offset+left], offset, nil
+}
+
+// Reads a pointer-sized word (uintptr, int and friends)
+func (me Image) word(data []byte, offset uint64) uint64 {
+	if me.PtrSize == 8 {
+		return me.ByteOrder.Uint64(data[offset:])
+	}
+	return uint64(me.ByteOrder.Uint32(data[offset:]))
+}
+
+// Words keep the size they have in the binary when shown
+func (me Image) sized(value uint64) any {
+	if me.PtrSize == 8 {
+		return value
+	}
+	return uint32(value)
+}
+
+func (me Image) readWord(addr uint64) (uint64, error) {
+	data, _, err := me.read(addr, me.PtrSize)
+	if err != nil {
+		return 0, err
+	}
+	return me.word(data, 0), nil
+}
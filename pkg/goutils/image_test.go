@@ -0,0 +1,55 @@
+package goutils_test
+
+import (
+	"bytes"
+	"debug/elf"
+	"debug/macho"
+	"encoding/binary"
+	"os"
+	"testing"
+
+	"github.com/LouisBrunner/mem-viz/pkg/goutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// A single section is mapped at 0x1000 from the file offset 0x100
+func newImage(section []byte) goutils.Image {
+	return goutils.Image{
+		Data:      append(make([]byte, 0x100), section...),
+		PtrSize:   8,
+		ByteOrder: binary.LittleEndian,
+		Sections: []goutils.Section{
+			{Name: ".data", Addr: 0x1000, Offset: 0x100, Size: uint64(len(section))},
+		},
+	}
+}
+
+// The runtime structures change with every version, so they are tested on the test binary itself which is always built
+// with the current toolchain
+func selfImage(t *testing.T) goutils.Image {
+	path, err := os.Executable()
+	require.NoError(t, err)
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	if bytes.HasPrefix(data, []byte(elf.ELFMAG)) {
+		f, err := elf.NewFile(bytes.NewReader(data))
+		require.NoError(t, err)
+		return goutils.NewELFImage(f, data)
+	}
+	f, err := macho.NewFile(bytes.NewReader(data))
+	require.NoError(t, err)
+	return goutils.NewMachOImage(f, data)
+}
+
+func Test_Image_Offset(t *testing.T) {
+	img := newImage(make([]byte, 0x10))
+
+	offset, found := img.Offset(0x1008)
+	assert.True(t, found)
+	assert.Equal(t, uint64(0x108), offset)
+	_, found = img.Offset(0x1010)
+	assert.False(t, found)
+	_, found = img.Offset(0x800)
+	assert.False(t, found)
+}
@@ -0,0 +1,309 @@
+package goutils
+
+import (
+	"fmt"
+
+	"github.com/LouisBrunner/mem-viz/pkg/contracts"
+	"github.com/LouisBrunner/mem-viz/pkg/parsingutils"
+)
+
+type fieldKind int
+
+const (
+	fieldWord fieldKind = iota
+	fieldSlice
+	fieldString
+	fieldUint8
+)
+
+type moduleField struct {
+	name string
+	kind fieldKind
+}
+
+// The runtime doesn't describe the moduledata anywhere, its layout changes between versions so each candidate is tried
+// (newest first) until one makes sense
+type moduleLayout struct {
+	name   string
+	fields []moduleField
+}
+
+func words(names ...string) []moduleField {
+	fields := make([]moduleField, len(names))
+	for i, name := range names {
+		fields[i] = moduleField{name, fieldWord}
+	}
+	return fields
+}
+
+func concat(parts ...[]moduleField) []moduleField {
+	fields := []moduleField{}
+	for _, part := range parts {
+		fields = append(fields, part...)
+	}
+	return fields
+}
+
+// Fields shared by every supported version
+var modulePrefix = concat(
+	words("pcHeader"),
+	[]moduleField{
+		{"funcnametab", fieldSlice},
+		{"cutab", fieldSlice},
+		{"filetab", fieldSlice},
+		{"pctab", fieldSlice},
+		{"pclntable", fieldSlice},
+		{"ftab", fieldSlice},
+	},
+	words("findfunctab", "minpc", "maxpc", "text", "etext", "noptrdata", "enoptrdata", "data", "edata", "bss", "ebss", "noptrbss", "enoptrbss"),
+)
+
+func typelinksLayout(name string, coverage, inittasks bool) moduleLayout {
+	fields := modulePrefix
+	if coverage {
+		fields = concat(fields, words("covctrs", "ecovctrs"))
+	}
+	fields = concat(
+		fields,
+		words("end", "gcdata", "gcbss", "types", "etypes", "rodata", "gofunc"),
+		[]moduleField{
+			{"textsectmap", fieldSlice},
+			{"typelinks", fieldSlice},
+			{"itablinks", fieldSlice},
+			{"ptab", fieldSlice},
+			{"pluginpath", fieldString},
+			{"pkghashes", fieldSlice},
+		},
+	)
+	if inittasks {
+		fields = append(fields, moduleField{"inittasks", fieldSlice})
+	}
+	fields = append(fields, moduleField{"modulename", fieldString}, moduleField{"modulehashes", fieldSlice}, moduleField{"hasmain", fieldUint8})
+	return moduleLayout{name: name, fields: fields}
+}
+
+var moduleLayouts = []moduleLayout{
+	{
+		// The type descriptors and itabs are laid out one after the other instead of being listed
+		name: "Go 1.27",
+		fields: concat(
+			modulePrefix,
+			words("covctrs", "ecovctrs", "end", "gcdata", "gcbss", "types", "typedesclen", "etypes", "itaboffset", "itabsize", "rodata", "gofunc", "epclntab"),
+			[]moduleField{
+				{"textsectmap", fieldSlice},
+				{"ptab", fieldSlice},
+				{"pluginpath", fieldString},
+				{"pkghashes", fieldSlice},
+				{"inittasks", fieldSlice},
+				{"modulename", fieldString},
+				{"modulehashes", fieldSlice},
+				{"hasmain", fieldUint8},
+			},
+		),
+	},
+	typelinksLayout("Go 1.21", true, true),
+	typelinksLayout("Go 1.20", true, false),
+	typelinksLayout("Go 1.18", false, false),
+}
+
+// Pairs of fields which give the bounds of something
+var moduleBounds = [][2]string{
+	{"minpc", "maxpc"}, {"text", "etext"}, {"noptrdata", "enoptrdata"}, {"data", "edata"}, {"bss", "ebss"},
+	{"noptrbss", "enoptrbss"}, {"covctrs", "ecovctrs"}, {"types", "etypes"}, {"pcHeader", "epclntab"},
+}
+
+type Moduledata struct {
+	// Layout which was recognized, empty if none was and only the fields shared by every version were parsed
+	Layout string
+	// Values of the fields, slices and strings are given by their pointer with their length as "<name>.len"
+	Fields map[string]uint64
+}
+
+// Returns a field, 0 if the layout doesn't have it
+func (me *Moduledata) Field(name string) uint64 {
+	return me.Fields[name]
+}
+
+func (me *Moduledata) has(name string) bool {
+	_, found := me.Fields[name]
+	return found
+}
+
+func (me moduleLayout) size(img Image) uint64 {
+	size := uint64(0)
+	for _, field := range me.fields {
+		switch field.kind {
+		case fieldWord:
+			size += img.PtrSize
+		case fieldSlice:
+			size += 3 * img.PtrSize
+		case fieldString:
+			size += 2 * img.PtrSize
+		case fieldUint8:
+			size += 1
+		}
+	}
+	return size
+}
+
+func (me moduleLayout) read(img Image, data []byte) map[string]uint64 {
+	values := map[string]uint64{}
+	offset := uint64(0)
+	for _, field := range me.fields {
+		switch field.kind {
+		case fieldWord:
+			values[field.name] = img.word(data, offset)
+			offset += img.PtrSize
+		case fieldSlice, fieldString:
+			values[field.name] = img.word(data, offset)
+			values[field.name+".len"] = img.word(data, offset+img.PtrSize)
+			if field.kind == fieldSlice {
+				values[field.name+".cap"] = img.word(data, offset+2*img.PtrSize)
+				offset += img.PtrSize
+			}
+			offset += 2 * img.PtrSize
+		case fieldUint8:
+			values[field.name] = uint64(data[offset])
+			offset += 1
+		}
+	}
+	return values
+}
+
+// Whether the values look like a moduledata of this layout
+func (me moduleLayout) valid(img Image, values map[string]uint64, pclntab uint64) bool {
+	if values["pcHeader"] != pclntab {
+		return false
+	}
+	for _, bounds := range moduleBounds {
+		start, found := values[bounds[0]]
+		end, foundEnd := values[bounds[1]]
+		if found && foundEnd && start > end {
+			return false
+		}
+	}
+	for _, field := range me.fields {
+		switch field.kind {
+		case fieldSlice, fieldString:
+			ptr, length := values[field.name], values[field.name+".len"]
+			if field.kind == fieldSlice && length > values[field.name+".cap"] {
+				return false
+			}
+			// Anything longer than the file can't come from the linker
+			if length > uint64(len(img.Data)) || (length > 0 && ptr == 0) {
+				return false
+			}
+		case fieldUint8:
+			if values[field.name] > 1 {
+				return false
+			}
+		}
+	}
+	if length, found := values["typedesclen"]; found {
+		types := values["etypes"] - values["types"]
+		if length > types || values["itaboffset"]+values["itabsize"] > types {
+			return false
+		}
+	}
+	return values["text"] != 0 && values["ftab.len"] > 0
+}
+
+// Finds the moduledata of the main module by looking for a pointer to its pclntab (the first field of the moduledata),
+// for binaries without symbols (runtime.firstmoduledata)
+func FindModuledata(img Image, pclntab uint64) (uint64, bool) {
+	found := uint64(0)
+	for _, sect := range img.Sections {
+		data, _, err := img.readAll(sect.Addr)
+		if err != nil {
+			continue
+		}
+		for offset := uint64(0); offset+img.PtrSize <= uint64(len(data)); offset += img.PtrSize {
+			if img.word(data, offset) != pclntab {
+				continue
+			}
+			addr := sect.Addr + offset
+			if found == 0 {
+				found = addr
+			}
+			if _, md, err := ParseModuledata(img, addr, pclntab); err == nil && md.Layout != "" {
+				return addr, true
+			}
+		}
+	}
+	return found, found != 0
+}
+
+// Buckets of the findfunctab, each one is a base index into the function table followed by a delta per sub-bucket
+const (
+	findFuncBucketSize    = 4096
+	findFuncSubBucketSize = 256
+)
+
+// Parses the moduledata at an address with the first layout which fits, the pclntab address is used to check it. Only
+// the fields the runtime gets from the linker are shown (the rest is filled at runtime). The findfunctab (used to find
+// the function of a pc) is returned as well
+func ParseModuledata(img Image, addr, pclntab uint64) ([]*contracts.MemoryBlock, *Moduledata, error) {
+	layout := moduleLayout{fields: modulePrefix}
+	for _, candidate := range moduleLayouts {
+		data, _, err := img.read(addr, candidate.size(img))
+		if err != nil {
+			continue
+		}
+		if candidate.valid(img, candidate.read(img, data), pclntab) {
+			layout = candidate
+			break
+		}
+	}
+	data, offset, err := img.read(addr, layout.size(img))
+	if err != nil {
+		return nil, nil, err
+	}
+	md := &Moduledata{Layout: layout.name, Fields: layout.read(img, data)}
+	if md.Field("pcHeader") != pclntab {
+		return nil, nil, fmt.Errorf("no moduledata at %#x", addr)
+	}
+
+	block := newBlock("runtime.firstmoduledata", offset, layout.size(img))
+	if name := md.Field("modulename.len"); name > 0 {
+		if data, _, err := img.read(md.Field("modulename"), name); err == nil {
+			block.Name = fmt.Sprintf("moduledata (%s)", data)
+		}
+	}
+	f := newFields(img, block, data)
+	for _, field := range layout.fields {
+		switch field.kind {
+		case fieldWord:
+			f.word(field.name)
+		case fieldSlice:
+			f.slice(field.name)
+		case fieldString:
+			f.string(field.name)
+		case fieldUint8:
+			f.uint8(field.name, parsingutils.FormatValue)
+		}
+		if field.kind != fieldUint8 && isModulePointer(field.name) {
+			f.link(field.name, md.Field(field.name), "points to")
+		}
+	}
+	blocks := []*contracts.MemoryBlock{block}
+	minpc, maxpc := md.Field("minpc"), md.Field("maxpc")
+	size := 4*((maxpc-minpc+findFuncBucketSize-1)/findFuncBucketSize) + (maxpc-minpc+findFuncSubBucketSize-1)/findFuncSubBucketSize
+	if _, offset, err := img.read(md.Field("findfunctab"), size); err == nil {
+		blocks = append(blocks, newBlock("findfunctab", offset, size))
+	}
+	return blocks, md, f.err
+}
+
+// Sizes aren't addresses and the end of a range often is the start of something else (e.g. the next section)
+func isModulePointer(name string) bool {
+	switch name {
+	case "typedesclen", "itaboffset", "itabsize", "end":
+		return false
+	}
+	for _, bounds := range moduleBounds {
+		if bounds[1] == name {
+			return false
+		}
+	}
+	return true
+}
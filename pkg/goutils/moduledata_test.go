@@ -0,0 +1,36 @@
+package goutils_test
+
+import (
+	"testing"
+
+	"github.com/LouisBrunner/mem-viz/pkg/contracts/contractstest"
+	"github.com/LouisBrunner/mem-viz/pkg/goutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_ParseModuledata_self(t *testing.T) {
+	img := selfImage(t)
+	pclntab, found := goutils.FindPclntab(img)
+	require.True(t, found)
+	addr, found := goutils.FindModuledata(img, pclntab)
+	require.True(t, found)
+
+	blocks, md, err := goutils.ParseModuledata(img, addr, pclntab)
+	require.NoError(t, err)
+	assert.NotEmpty(t, md.Layout)
+	assert.Equal(t, pclntab, md.Field("pcHeader"))
+	assert.Less(t, md.Field("text"), md.Field("etext"))
+	assert.Equal(t, uint64(1), md.Field("hasmain"))
+
+	block := contractstest.FindBlock(t, blocks, "runtime.firstmoduledata")
+	offset, _ := img.Offset(pclntab)
+	assert.Equal(t, offset, contractstest.FindValue(t, block, "pcHeader").Links[0].TargetAddress)
+	assert.Empty(t, contractstest.FindValue(t, block, "etext").Links)
+	contractstest.FindBlock(t, blocks, "findfunctab")
+}
+
+func Test_ParseModuledata_invalid(t *testing.T) {
+	_, _, err := goutils.ParseModuledata(newImage(make([]byte, 0x400)), 0x1000, 0x2000)
+	assert.Error(t, err)
+}
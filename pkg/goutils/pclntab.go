@@ -0,0 +1,298 @@
+package goutils
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/LouisBrunner/mem-viz/pkg/contracts"
+	"github.com/LouisBrunner/mem-viz/pkg/parsingutils"
+)
+
+// Versions of the pclntab, older ones have a different header and function layout which isn't supported
+const (
+	Go118PclntabMagic = 0xfffffff0
+	Go120PclntabMagic = 0xfffffff1
+)
+
+// Funcdata are offsets from moduledata.gofunc, this one means there is none
+const noFuncdata = ^uint32(0)
+
+// _func of Go 1.18 and 1.19, followed by npcdata uint32 offsets into the pctab and nfuncdata uint32 offsets from
+// moduledata.gofunc
+type Func118 struct {
+	EntryOff    uint32
+	NameOff     int32
+	Args        int32
+	Deferreturn uint32
+	Pcsp        uint32
+	Pcfile      uint32
+	Pcln        uint32
+	Npcdata     uint32
+	CuOffset    uint32
+	FuncID      uint8
+	Flag        uint8
+	_           [1]byte
+	Nfuncdata   uint8
+}
+
+// _func of Go 1.20 and later, which added the line of the function
+type Func120 struct {
+	EntryOff    uint32
+	NameOff     int32
+	Args        int32
+	Deferreturn uint32
+	Pcsp        uint32
+	Pcfile      uint32
+	Pcln        uint32
+	Npcdata     uint32
+	CuOffset    uint32
+	StartLine   int32
+	FuncID      uint8
+	Flag        uint8
+	_           [1]byte
+	Nfuncdata   uint8
+}
+
+// A function of the pclntab and where its code is
+type Function struct {
+	Name string
+	// Addresses of the code, the end is where the next function starts (so it includes the padding)
+	Entry, End uint64
+	// Block of its _func
+	Info *contracts.MemoryBlock
+}
+
+type Pclntab struct {
+	Magic     uint32
+	Functions []Function
+}
+
+// Tables the functions point to
+type pclntabTables struct {
+	funcnametab, cutab, pctab *contracts.MemoryBlock
+	names                     []byte
+	// Address of moduledata.gofunc, 0 if unknown
+	gofunc uint64
+}
+
+// Parses the pclntab (runtime.pcheader) at an address: its header, the function table with the _func of every function
+// and the tables they point to (function names, compilation units, files and pc-value tables), as well as a block for
+// the code of each function which is linked from its _func. Function entries are
+// offsets from text (moduledata.text, older headers have it too), funcdata are only linked when gofunc
+// (moduledata.gofunc) is given
+func ParsePclntab(img Image, addr, text, gofunc uint64) ([]*contracts.MemoryBlock, *Pclntab, error) {
+	headerSize := 8 + 8*img.PtrSize
+	data, offset, err := img.read(addr, headerSize)
+	if err != nil {
+		return nil, nil, err
+	}
+	magic := img.ByteOrder.Uint32(data)
+	if magic != Go118PclntabMagic && magic != Go120PclntabMagic {
+		return nil, nil, fmt.Errorf("unsupported pclntab magic %#x (only Go 1.18 and later are supported)", magic)
+	}
+	if uint64(data[7]) != img.PtrSize {
+		return nil, nil, fmt.Errorf("pclntab has %d-byte pointers instead of %d", data[7], img.PtrSize)
+	}
+
+	out := newDecoded()
+	header := out.add(newBlock("pcHeader", offset, headerSize))
+	f := newFields(img, header, data)
+	f.uint32("magic")
+	f.uint8("pad1", parsingutils.FormatValue)
+	f.uint8("pad2", parsingutils.FormatValue)
+	f.uint8("minLC", parsingutils.FormatValue)
+	f.uint8("ptrSize", parsingutils.FormatValue)
+	nfunc := f.word("nfunc")
+	f.word("nfiles")
+	textStart := f.word("textStart")
+	names := []string{"funcnameOffset", "cuOffset", "filetabOffset", "pctabOffset", "pclnOffset"}
+	offsets := make([]uint64, len(names))
+	for i, name := range names {
+		offsets[i] = f.word(name)
+	}
+	if text == 0 {
+		text = textStart
+	}
+	if text == 0 {
+		return nil, nil, fmt.Errorf("pclntab doesn't say where the text starts")
+	}
+
+	// The tables follow each other in this order, the function table and the _func go until the end of the pclntab
+	all, _, _ := img.readAll(addr)
+	// Pairs of entryoff and funcoff, the last entry only has the entryoff
+	ftabSize := nfunc*8 + 4
+	for i := 1; i < len(offsets); i += 1 {
+		if offsets[i] < offsets[i-1] {
+			return nil, nil, fmt.Errorf("pclntab tables are out of order")
+		}
+	}
+	if offsets[4] > uint64(len(all)) || ftabSize > uint64(len(all))-offsets[4] {
+		return nil, nil, fmt.Errorf("function table is out of bounds: %#x+%#x > %#x", offsets[4], ftabSize, len(all))
+	}
+	tableBlocks := make([]*contracts.MemoryBlock, 4)
+	for i, name := range []string{"funcnametab", "cutab", "filetab", "pctab"} {
+		tableBlocks[i] = out.add(newBlock(name, offset+offsets[i], offsets[i+1]-offsets[i]))
+		f.linkBlock(names[i], tableBlocks[i], "points to")
+	}
+	f.linkBlock("nfiles", tableBlocks[1], "gives amount")
+	addFiles(tableBlocks[2], all[offsets[2]:offsets[3]])
+	ftab := out.add(newBlock(fmt.Sprintf("functab (%d)", nfunc+1), offset+offsets[4], ftabSize))
+	f.linkBlock("pclnOffset", ftab, "points to")
+	f.linkBlock("nfunc", ftab, "gives amount")
+	if f.err != nil {
+		return nil, nil, f.err
+	}
+
+	tables := pclntabTables{
+		funcnametab: tableBlocks[0],
+		cutab:       tableBlocks[1],
+		pctab:       tableBlocks[3],
+		names:       all[offsets[0]:offsets[1]],
+		gofunc:      gofunc,
+	}
+	pclntable := all[offsets[4]:]
+	tab := &Pclntab{Magic: magic}
+	entries := newFields(img, ftab, pclntable)
+	end := ftabSize
+	for i := uint64(0); i <= nfunc; i += 1 {
+		entryName := fmt.Sprintf("[%d].entryoff", i)
+		entry := text + uint64(entries.uint32(entryName))
+		entries.link(entryName, entry, "points to")
+		if len(tab.Functions) > 0 {
+			tab.Functions[len(tab.Functions)-1].End = entry
+		}
+		// The last entry only gives the end of the last function
+		if i == nfunc {
+			break
+		}
+		funcName := fmt.Sprintf("[%d].funcoff", i)
+		funcOff := uint64(entries.uint32(funcName))
+		name, block, err := parseFunc(img, magic, pclntable, funcOff, &tables)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to parse function %d: %w", i, err)
+		}
+		block.Address += uintptr(offset + offsets[4])
+		out.add(block)
+		entries.linkBlock(funcName, block, "points to")
+		end = max(end, funcOff+block.Size)
+		tab.Functions = append(tab.Functions, Function{Name: name, Entry: entry, Info: block})
+	}
+	if entries.err != nil {
+		return nil, nil, entries.err
+	}
+	for _, fn := range tab.Functions {
+		textOffset, found := img.Offset(fn.Entry)
+		if !found || fn.End <= fn.Entry {
+			continue
+		}
+		text := out.add(newBlock(fn.Name, textOffset, fn.End-fn.Entry))
+		err = parsingutils.AddLinkWithBlock(fn.Info, "EntryOff", text, "points to")
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// Everything is wrapped in a block so it stays together when the pclntab isn't in its own section (e.g. PIE)
+	root := newBlock("runtime.pclntab", offset, offsets[4]+end)
+	return append([]*contracts.MemoryBlock{root}, out.blocks...), tab, nil
+}
+
+// Files are NUL-terminated strings which are referenced by their offset (through the cutab)
+func addFiles(block *contracts.MemoryBlock, data []byte) {
+	for start, i := uint64(0), 0; start < uint64(len(data)); i += 1 {
+		name, err := readCString(data, start)
+		if err != nil {
+			return
+		}
+		size := min(uint64(len(name))+1, uint64(len(data))-start)
+		addString(block, fmt.Sprintf("[%d]", i), name, start, size)
+		start += size
+	}
+}
+
+// Parses a _func with its pcdata and funcdata, the block is at its offset in the pclntable
+func parseFunc(img Image, magic uint32, pclntable []byte, funcOff uint64, tables *pclntabTables) (string, *contracts.MemoryBlock, error) {
+	// Both versions start the same way, only the end differs
+	fn := Func120{}
+	var v any = &fn
+	if magic == Go118PclntabMagic {
+		v = &Func118{}
+	}
+	err := ReadStruct(pclntable, funcOff, img.ByteOrder, v)
+	if err != nil {
+		return "", nil, err
+	}
+	var nfuncdata uint8
+	switch parsed := v.(type) {
+	case *Func118:
+		fn = Func120{EntryOff: parsed.EntryOff, NameOff: parsed.NameOff, Pcsp: parsed.Pcsp, Pcfile: parsed.Pcfile, Pcln: parsed.Pcln, Npcdata: parsed.Npcdata, CuOffset: parsed.CuOffset}
+		nfuncdata = parsed.Nfuncdata
+	case *Func120:
+		nfuncdata = parsed.Nfuncdata
+	}
+	if fn.NameOff < 0 {
+		return "", nil, fmt.Errorf("invalid name offset %d", fn.NameOff)
+	}
+	name, err := readCString(tables.names, uint64(fn.NameOff))
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to read the name: %w", err)
+	}
+
+	structSize := uint64(binary.Size(v))
+	size := structSize + 4*uint64(fn.Npcdata) + 4*uint64(nfuncdata)
+	if funcOff > uint64(len(pclntable)) || size > uint64(len(pclntable))-funcOff {
+		return "", nil, fmt.Errorf("%s: out of bounds: %#x+%#x > %#x", name, funcOff, size, len(pclntable))
+	}
+	block := newBlock(fmt.Sprintf("_func %s", name), funcOff, size)
+	parsingutils.AddStructValues(block, v, structSize, parsingutils.FormatValue)
+
+	f := newFields(img, block, pclntable[funcOff:funcOff+size])
+	f.linkOffset("NameOff", uint64(tables.funcnametab.Address)+uint64(fn.NameOff), "points to")
+	f.linkOffset("CuOffset", uint64(tables.cutab.Address)+4*uint64(fn.CuOffset), "points to")
+	pctab := uint64(tables.pctab.Address)
+	for field, off := range map[string]uint32{"Pcsp": fn.Pcsp, "Pcfile": fn.Pcfile, "Pcln": fn.Pcln} {
+		if off != 0 {
+			f.linkOffset(field, pctab+uint64(off), "points to")
+		}
+	}
+	f.offset = structSize
+	for i := uint32(0); i < fn.Npcdata; i += 1 {
+		field := fmt.Sprintf("pcdata[%d]", i)
+		if off := f.uint32(field); off != 0 {
+			f.linkOffset(field, pctab+uint64(off), "points to")
+		}
+	}
+	for i := uint8(0); i < nfuncdata; i += 1 {
+		field := fmt.Sprintf("funcdata[%d]", i)
+		if off := f.uint32(field); tables.gofunc != 0 && off != noFuncdata {
+			f.link(field, tables.gofunc+uint64(off), "points to")
+		}
+	}
+	return name, block, f.err
+}
+
+// Finds the pclntab by its header for binaries without symbols or sections (e.g. stripped PIE binaries where it is
+// in .data.rel.ro), only headers which are pointed to by a moduledata are accepted
+func FindPclntab(img Image) (uint64, bool) {
+	for _, sect := range img.Sections {
+		data, _, err := img.readAll(sect.Addr)
+		if err != nil {
+			continue
+		}
+		for offset := uint64(0); offset+8 <= uint64(len(data)); offset += 4 {
+			magic := img.ByteOrder.Uint32(data[offset:])
+			if magic != Go118PclntabMagic && magic != Go120PclntabMagic {
+				continue
+			}
+			header := data[offset : offset+8]
+			if header[4] != 0 || header[5] != 0 || (header[6] != 1 && header[6] != 2 && header[6] != 4) || uint64(header[7]) != img.PtrSize {
+				continue
+			}
+			addr := sect.Addr + offset
+			if _, found := FindModuledata(img, addr); found {
+				return addr, true
+			}
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,63 @@
+package goutils_test
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/LouisBrunner/mem-viz/pkg/contracts/contractstest"
+	"github.com/LouisBrunner/mem-viz/pkg/goutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const selfName = "github.com/LouisBrunner/mem-viz/pkg/goutils_test.Test_ParsePclntab_self"
+
+func Test_ParsePclntab_self(t *testing.T) {
+	img := selfImage(t)
+	pclntab, found := goutils.FindPclntab(img)
+	require.True(t, found)
+	addr, found := goutils.FindModuledata(img, pclntab)
+	require.True(t, found)
+	_, md, err := goutils.ParseModuledata(img, addr, pclntab)
+	require.NoError(t, err)
+
+	blocks, tab, err := goutils.ParsePclntab(img, pclntab, md.Field("text"), md.Field("gofunc"))
+	require.NoError(t, err)
+	assert.Equal(t, md.Field("ftab.len"), uint64(len(tab.Functions)+1))
+	contractstest.FindBlock(t, blocks, "runtime.pclntab")
+	contractstest.FindBlock(t, blocks, "pcHeader")
+	contractstest.FindBlock(t, blocks, "funcnametab")
+
+	var self *goutils.Function
+	for i, fn := range tab.Functions {
+		if fn.Name == selfName {
+			self = &tab.Functions[i]
+		}
+	}
+	require.NotNil(t, self)
+	assert.Greater(t, self.End, self.Entry)
+	info := contractstest.FindBlock(t, blocks, "_func "+selfName)
+	assert.Same(t, self.Info, info)
+	text := contractstest.FindBlock(t, blocks, selfName)
+	assert.Equal(t, self.End-self.Entry, text.Size)
+	assert.Equal(t, uint64(text.Address), contractstest.FindValue(t, info, "EntryOff").Links[0].TargetAddress)
+	name := contractstest.FindValue(t, info, "NameOff").Links[0].TargetAddress
+	assert.Equal(t, selfName, string(img.Data[name:name+uint64(len(selfName))]))
+}
+
+func Test_ParsePclntab_invalid(t *testing.T) {
+	header := make([]byte, 0x48)
+	binary.LittleEndian.PutUint32(header, 0xfffffffa)
+	header[7] = 8
+	_, _, err := goutils.ParsePclntab(newImage(header), 0x1000, 0x400000, 0)
+	assert.ErrorContains(t, err, "only Go 1.18 and later")
+
+	// The function table goes past the end of the section
+	binary.LittleEndian.PutUint32(header, goutils.Go120PclntabMagic)
+	binary.LittleEndian.PutUint64(header[8:], 0x100)
+	for i := 0; i < 5; i += 1 {
+		binary.LittleEndian.PutUint64(header[0x20+8*i:], 0x48)
+	}
+	_, _, err = goutils.ParsePclntab(newImage(header), 0x1000, 0x400000, 0)
+	assert.ErrorContains(t, err, "out of bounds")
+}
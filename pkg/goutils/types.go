@@ -0,0 +1,369 @@
+package goutils
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/LouisBrunner/mem-viz/pkg/contracts"
+	"github.com/LouisBrunner/mem-viz/pkg/parsingutils"
+)
+
+// abi.TFlag
+const (
+	tflagUncommon  = 1 << 0
+	tflagExtraStar = 1 << 1
+)
+
+// Older versions keep flags in the upper bits of the kind
+const kindMask = 0x1f
+
+// abi.Kind
+var kinds = []string{
+	"invalid", "bool", "int", "int8", "int16", "int32", "int64", "uint", "uint8", "uint16", "uint32", "uint64",
+	"uintptr", "float32", "float64", "complex64", "complex128", "array", "chan", "func", "interface", "map", "ptr",
+	"slice", "string", "struct", "unsafe.Pointer",
+}
+
+const (
+	kindArray     = 17
+	kindChan      = 18
+	kindFunc      = 19
+	kindInterface = 20
+	kindMap       = 21
+	kindPtr       = 22
+	kindSlice     = 23
+	kindStruct    = 25
+)
+
+// Size of abi.Type
+func typeSize(img Image) uint64 {
+	return 4*img.PtrSize + 16
+}
+
+// Parses the type descriptors and the itabs of a module, either from the typelinks and itablinks tables or by walking
+// them like the runtime does in versions without these tables. Descriptors which can't be parsed are returned as
+// warnings, the other ones are still shown
+func ParseTypes(img Image, md *Moduledata) ([]*contracts.MemoryBlock, []error, error) {
+	switch {
+	case md.has("typedesclen"):
+		return walkTypes(img, md)
+	case md.has("typelinks"):
+		return listTypes(img, md)
+	}
+	return nil, nil, fmt.Errorf("unknown moduledata layout, types can't be found")
+}
+
+// Since typelinks were removed, the descriptors follow each other (aligned to a pointer) and so do the itabs
+func walkTypes(img Image, md *Moduledata) ([]*contracts.MemoryBlock, []error, error) {
+	out := newDecoded()
+	warnings := []error{}
+	types := md.Field("types")
+
+	start := types + img.PtrSize
+	end := types + md.Field("typedesclen")
+	count := 0
+	for addr := start; addr < end; count += 1 {
+		addr = (addr + img.PtrSize - 1) / img.PtrSize * img.PtrSize
+		block, size, err := parseType(img, types, addr, true)
+		if err != nil {
+			// The next descriptor can't be found without the size of this one
+			warnings = append(warnings, fmt.Errorf("stopped walking the type descriptors: %w", err))
+			break
+		}
+		out.add(block)
+		addr += size
+	}
+	region, err := newRegion(img, fmt.Sprintf("type descriptors (%d)", count), start, end-start)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	blocks := []*contracts.MemoryBlock{region}
+	start = types + md.Field("itaboffset")
+	end = start + md.Field("itabsize")
+	count = 0
+	for addr := start; addr < end; count += 1 {
+		block, targets, err := parseItab(img, types, addr)
+		if err != nil {
+			warnings = append(warnings, fmt.Errorf("stopped walking the itabs: %w", err))
+			break
+		}
+		out.add(block)
+		warnings = append(warnings, addTypes(out, img, types, targets, true)...)
+		addr += block.Size
+	}
+	if end > start {
+		region, err := newRegion(img, fmt.Sprintf("itabs (%d)", count), start, end-start)
+		if err != nil {
+			return nil, nil, err
+		}
+		blocks = append(blocks, region)
+	}
+	return append(blocks, out.blocks...), warnings, nil
+}
+
+// Before, the linker listed the types as offsets from moduledata.types and the itabs as pointers
+func listTypes(img Image, md *Moduledata) ([]*contracts.MemoryBlock, []error, error) {
+	out := newDecoded()
+	warnings := []error{}
+	types := md.Field("types")
+
+	count := md.Field("typelinks.len")
+	if count > 0 {
+		data, offset, err := img.read(md.Field("typelinks"), count*4)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read the typelinks: %w", err)
+		}
+		links := out.add(newBlock(fmt.Sprintf("typelinks (%d)", count), offset, count*4))
+		f := newFields(img, links, data)
+		for i := uint64(0); i < count; i += 1 {
+			name := fmt.Sprintf("[%d]", i)
+			addr := types + uint64(f.int32(name))
+			block, _, err := parseType(img, types, addr, false)
+			if err != nil {
+				warnings = append(warnings, fmt.Errorf("typelinks[%d]: %w", i, err))
+				continue
+			}
+			f.linkBlock(name, out.add(block), "points to")
+		}
+		if f.err != nil {
+			return nil, nil, f.err
+		}
+	}
+
+	count = md.Field("itablinks.len")
+	if count > 0 {
+		data, offset, err := img.read(md.Field("itablinks"), count*img.PtrSize)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read the itablinks: %w", err)
+		}
+		links := out.add(newBlock(fmt.Sprintf("itablinks (%d)", count), offset, count*img.PtrSize))
+		f := newFields(img, links, data)
+		for i := uint64(0); i < count; i += 1 {
+			name := fmt.Sprintf("[%d]", i)
+			block, targets, err := parseItab(img, types, f.word(name))
+			if err != nil {
+				warnings = append(warnings, fmt.Errorf("itablinks[%d]: %w", i, err))
+				continue
+			}
+			f.linkBlock(name, out.add(block), "points to")
+			warnings = append(warnings, addTypes(out, img, types, targets, false)...)
+		}
+		if f.err != nil {
+			return nil, nil, f.err
+		}
+	}
+	return out.blocks, warnings, nil
+}
+
+// Adds the types used by itabs, they aren't always listed with the others (e.g. interfaces which are only converted to)
+func addTypes(out *decoded, img Image, types uint64, targets []uint64, full bool) []error {
+	warnings := []error{}
+	for _, addr := range targets {
+		offset, found := img.Offset(addr)
+		if !found || out.seen[uintptr(offset)] != nil {
+			continue
+		}
+		block, _, err := parseType(img, types, addr, full)
+		if err != nil {
+			warnings = append(warnings, err)
+			continue
+		}
+		out.add(block)
+	}
+	return warnings
+}
+
+func newRegion(img Image, name string, addr, size uint64) (*contracts.MemoryBlock, error) {
+	_, offset, err := img.read(addr, size)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the %s: %w", name, err)
+	}
+	return newBlock(name, offset, size), nil
+}
+
+// Parses the abi.Type at an address, when full is set the block covers the whole descriptor (the kind-specific part,
+// the uncommon type and the methods) and its size is returned, otherwise it only covers the abi.Type as the layout
+// of the rest changed between versions
+func parseType(img Image, types, addr uint64, full bool) (*contracts.MemoryBlock, uint64, error) {
+	size := typeSize(img)
+	data, offset, err := img.read(addr, size)
+	if err != nil {
+		return nil, 0, err
+	}
+	block := newBlock("", offset, size)
+	f := newFields(img, block, data)
+	f.word("Size_")
+	f.word("PtrBytes")
+	f.uint32("Hash")
+	tflag := f.uint8("TFlag", parsingutils.FormatValue)
+	f.uint8("Align_", parsingutils.FormatValue)
+	f.uint8("FieldAlign_", parsingutils.FormatValue)
+	kind := f.uint8("Kind_", func(name string, value any) string {
+		if kind := int(value.(uint8) & kindMask); kind < len(kinds) {
+			return kinds[kind]
+		}
+		return fmt.Sprintf("%#x", value)
+	}) & kindMask
+	f.link("Equal", f.word("Equal"), "points to")
+	// Masks are shared by most types with the same layout, linking them would only be noise
+	f.word("GCData")
+	str := f.int32("Str")
+	ptrToThis := f.int32("PtrToThis")
+	if ptrToThis != 0 {
+		f.link("PtrToThis", types+uint64(ptrToThis), "points to")
+	}
+
+	name, nameAt, err := readTypeName(img, types, str, tflag)
+	if err != nil {
+		return nil, 0, fmt.Errorf("type at %#x: %w", addr, err)
+	}
+	block.Name = fmt.Sprintf("type:%s", name)
+	f.linkOffset("Str", nameAt, "points to")
+	if f.err != nil {
+		return nil, 0, f.err
+	}
+	if !full {
+		return block, size, nil
+	}
+
+	size, err = descriptorSize(img, addr, kind, tflag)
+	if err != nil {
+		return nil, 0, fmt.Errorf("%s: %w", block.Name, err)
+	}
+	_, _, err = img.read(addr, size)
+	if err != nil {
+		return nil, 0, fmt.Errorf("%s: %w", block.Name, err)
+	}
+	block.Size = size
+	return block, size, nil
+}
+
+// Same as abi.Type.DescriptorSize: the kind-specific struct, the uncommon type, the variable part of the kind (e.g. the
+// fields of a struct) and the methods
+func descriptorSize(img Image, addr uint64, kind, tflag uint8) (uint64, error) {
+	ptr, typ := img.PtrSize, typeSize(img)
+	base := typ
+	switch kind {
+	case kindArray:
+		base += 3 * ptr
+	case kindChan:
+		base += 2 * ptr
+	case kindFunc:
+		// InCount and OutCount, padded to a pointer
+		base += ptr
+	case kindInterface, kindStruct:
+		// PkgPath and the methods or fields
+		base += 4 * ptr
+	case kindMap:
+		base += 11 * ptr
+	case kindPtr, kindSlice:
+		base += ptr
+	case 0:
+		return 0, fmt.Errorf("invalid kind")
+	default:
+		if int(kind) >= len(kinds) {
+			return 0, fmt.Errorf("invalid kind %#x", kind)
+		}
+	}
+	data, _, err := img.read(addr, base)
+	if err != nil {
+		return 0, err
+	}
+
+	var add uint64
+	switch kind {
+	case kindFunc:
+		in := uint64(img.ByteOrder.Uint16(data[typ:]))
+		out := uint64(img.ByteOrder.Uint16(data[typ+2:]) & 0x7fff)
+		add = (in + out) * ptr
+	case kindInterface:
+		add = img.word(data, typ+2*ptr) * 8
+	case kindStruct:
+		add = img.word(data, typ+2*ptr) * 3 * ptr
+	}
+	size := base + add
+	if tflag&tflagUncommon != 0 {
+		uncommon, _, err := img.read(addr+base, 16)
+		if err != nil {
+			return 0, err
+		}
+		mcount := uint64(img.ByteOrder.Uint16(uncommon[4:]))
+		size += 16 + mcount*16
+	}
+	return size, nil
+}
+
+// Names are a byte of flags followed by the length (as a varint) and the name itself, returns where it is in the file
+func readTypeName(img Image, types uint64, off int32, tflag uint8) (string, uint64, error) {
+	data, offset, err := img.readAll(types + uint64(off))
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to read the name: %w", err)
+	}
+	name, _, err := readVarString(data, 1)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to read the name: %w", err)
+	}
+	// Pointers share the name of the type they point to
+	if tflag&tflagExtraStar != 0 {
+		name = strings.TrimPrefix(name, "*")
+	}
+	return name, offset, nil
+}
+
+// Name of the type at an address, for the itabs
+func typeName(img Image, types, addr uint64) (string, error) {
+	data, _, err := img.read(addr, typeSize(img))
+	if err != nil {
+		return "", err
+	}
+	tflag := data[2*img.PtrSize+4]
+	str := int32(img.ByteOrder.Uint32(data[4*img.PtrSize+8:]))
+	name, _, err := readTypeName(img, types, str, tflag)
+	return name, err
+}
+
+// Parses an abi.ITab at an address, it has a method per method of its interface unless the type doesn't implement it.
+// The addresses of its interface and type are returned as well
+func parseItab(img Image, types, addr uint64) (*contracts.MemoryBlock, []uint64, error) {
+	ptr := img.PtrSize
+	data, offset, err := img.read(addr, 4*ptr)
+	if err != nil {
+		return nil, nil, err
+	}
+	inter := img.word(data, 0)
+	typ := img.word(data, ptr)
+	interName, err := typeName(img, types, inter)
+	if err != nil {
+		return nil, nil, fmt.Errorf("itab at %#x: interface: %w", addr, err)
+	}
+	typName, err := typeName(img, types, typ)
+	if err != nil {
+		return nil, nil, fmt.Errorf("itab at %#x: type: %w", addr, err)
+	}
+	methods := uint64(1)
+	if img.word(data, 3*ptr) != 0 {
+		methods, err = img.readWord(inter + typeSize(img) + 2*ptr)
+		if err != nil {
+			return nil, nil, fmt.Errorf("itab at %#x: %w", addr, err)
+		}
+		methods = max(methods, 1)
+	}
+	size := 3*ptr + methods*ptr
+	data, _, err = img.read(addr, size)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	block := newBlock(fmt.Sprintf("go:itab.%s,%s", typName, interName), offset, size)
+	f := newFields(img, block, data)
+	f.link("Inter", f.word("Inter"), "points to")
+	f.link("Type", f.word("Type"), "points to")
+	f.uint32("Hash")
+	f.align(ptr)
+	for i := uint64(0); i < methods; i += 1 {
+		name := fmt.Sprintf("Fun[%d]", i)
+		f.link(name, f.word(name), "points to")
+	}
+	return block, []uint64{inter, typ}, f.err
+}
@@ -0,0 +1,46 @@
+package goutils_test
+
+import (
+	"io"
+	"testing"
+
+	"github.com/LouisBrunner/mem-viz/pkg/contracts/contractstest"
+	"github.com/LouisBrunner/mem-viz/pkg/goutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testReader struct {
+	count int
+}
+
+func (me *testReader) Read(p []byte) (int, error) {
+	me.count += len(p)
+	return len(p), nil
+}
+
+// The conversion is static so the linker creates the itab
+var testReaderItab io.Reader = &testReader{}
+
+func Test_ParseTypes_self(t *testing.T) {
+	img := selfImage(t)
+	pclntab, found := goutils.FindPclntab(img)
+	require.True(t, found)
+	addr, found := goutils.FindModuledata(img, pclntab)
+	require.True(t, found)
+	_, md, err := goutils.ParseModuledata(img, addr, pclntab)
+	require.NoError(t, err)
+
+	blocks, warnings, err := goutils.ParseTypes(img, md)
+	require.NoError(t, err)
+	assert.Empty(t, warnings)
+
+	typ := contractstest.FindBlock(t, blocks, "type:*goutils_test.testReader")
+	assert.Equal(t, "ptr", contractstest.FindValue(t, typ, "Kind_").Value)
+	itab := contractstest.FindBlock(t, blocks, "go:itab.*goutils_test.testReader,io.Reader")
+	assert.Equal(t, uint64(typ.Address), contractstest.FindValue(t, itab, "Type").Links[0].TargetAddress)
+	iface := contractstest.FindBlock(t, blocks, "type:io.Reader")
+	assert.Equal(t, uint64(iface.Address), contractstest.FindValue(t, itab, "Inter").Links[0].TargetAddress)
+	assert.Len(t, contractstest.FindValue(t, itab, "Fun[0]").Links, 1)
+	assert.NotNil(t, testReaderItab)
+}
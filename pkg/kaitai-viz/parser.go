@@ -0,0 +1,62 @@
+package kaitai
+
+import (
+	"os"
+
+	"github.com/LouisBrunner/mem-viz/pkg/contracts"
+	"github.com/LouisBrunner/mem-viz/pkg/kaitaiutils"
+	"github.com/LouisBrunner/mem-viz/pkg/parsingutils"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/exp/slices"
+)
+
+type parser struct {
+	logger *logrus.Logger
+}
+
+func Parse(logger *logrus.Logger, file, specFile string) (*contracts.MemoryBlock, error) {
+	p := &parser{
+		logger: logger,
+	}
+	return p.parse(file, specFile)
+}
+
+func (me *parser) parse(file, specFile string) (*contracts.MemoryBlock, error) {
+	spec, err := kaitaiutils.Load(specFile)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	blocks, warnings, err := spec.Apply(data)
+	if err != nil {
+		return nil, err
+	}
+	for _, warning := range warnings {
+		me.logger.Warnf("%v", warning)
+	}
+
+	root := &contracts.MemoryBlock{
+		Name: file,
+		Size: uint64(len(data)),
+	}
+	// Instances can be anywhere (even inside each other), so they are nested from the lowest address
+	slices.SortStableFunc(blocks, func(a, b *contracts.MemoryBlock) int {
+		if a.Address != b.Address {
+			return int(a.Address) - int(b.Address)
+		}
+		return int(b.Size) - int(a.Size)
+	})
+	for _, block := range blocks {
+		parent, sibling := parsingutils.AddChildDeep(root, block)
+		if sibling != nil {
+			me.logger.Warnf("dropping %s as it overlaps %s", block.Name, sibling.Name)
+			continue
+		}
+		block.ParentOffset = uint64(block.Address - parent.Address)
+	}
+
+	return root, nil
+}
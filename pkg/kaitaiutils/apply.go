@@ -0,0 +1,303 @@
+package kaitaiutils
+
+import (
+	"fmt"
+
+	"github.com/LouisBrunner/mem-viz/pkg/contracts"
+	"github.com/LouisBrunner/mem-viz/pkg/parsingutils"
+	"golang.org/x/exp/slices"
+)
+
+// Specifications can be recursive (e.g. directory trees), this stops the ones which never end
+const maxDepth = 64
+
+// Instance of a user type, what expressions see as "_root", "_parent" or any attribute with a user type
+type object struct {
+	interp *interpreter
+	spec   *typeSpec
+	parent *object
+	root   *object
+	io     *stream
+	block  *contracts.MemoryBlock
+	endian string
+	// Params and attributes of the seq which were parsed so far
+	fields map[string]any
+	// Instances are only parsed (or calculated) when needed, the errors are kept so they are only reported once
+	instances  map[string]instanceResult
+	evaluating map[string]bool
+}
+
+type instanceResult struct {
+	value any
+	err   error
+}
+
+type interpreter struct {
+	data  []byte
+	depth int
+	// Every object which was parsed successfully, their instances are all parsed at the end
+	objects []*object
+	// Where each object is (by address and size) and when it was parsed (its index in objects, -1 for instances)
+	regions map[[2]uint64]int
+	// Blocks of the instances, they are only positioned by their address
+	placed   []*contracts.MemoryBlock
+	warnings []error
+}
+
+// Parses the data with the type of the whole specification, blocks are given at their file offset (i.e. the file is
+// expected to start at 0). The first block is the root type, the others are the instances (after their contents), they
+// still need to be nested where they belong in the file. Instances which can't be parsed don't stop the rest of the file
+// from being shown, they are returned as warnings instead
+func (me *Spec) Apply(data []byte) ([]*contracts.MemoryBlock, []error, error) {
+	interp := &interpreter{data: data, regions: map[[2]uint64]int{}}
+	root, err := interp.parseObject(me.root, newStream(data, 0, uint64(len(data))), false, nil, me.root.name, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	// New objects can be created while this runs (i.e. instances with a user type)
+	for i := 0; i < len(interp.objects); i += 1 {
+		obj := interp.objects[i]
+		for _, attr := range obj.spec.instances {
+			if attr.value != nil {
+				continue
+			}
+			_, err := obj.instance(attr)
+			if err != nil && !slices.Contains(interp.warnings, err) {
+				interp.warnings = append(interp.warnings, err)
+			}
+		}
+	}
+	return append([]*contracts.MemoryBlock{root.block}, interp.placed...), interp.warnings, nil
+}
+
+// Objects with a size have their own stream, they use all of it even when their seq doesn't
+func (me *interpreter) parseObject(typ *typeSpec, io *stream, sized bool, parent *object, name string, args []any) (*object, error) {
+	if me.depth >= maxDepth {
+		return nil, fmt.Errorf("types are nested more than %d times", maxDepth)
+	}
+	me.depth += 1
+	defer func() { me.depth -= 1 }()
+
+	start := io.fieldStart()
+	obj := &object{
+		interp:     me,
+		spec:       typ,
+		parent:     parent,
+		io:         io,
+		block:      newBlock(name, start, 0),
+		fields:     map[string]any{},
+		instances:  map[string]instanceResult{},
+		evaluating: map[string]bool{},
+	}
+	obj.root = obj
+	if parent != nil {
+		obj.root = parent.root
+	}
+
+	if len(args) != len(typ.params) {
+		return nil, fmt.Errorf("%s needs %d arguments, got %d", typ.name, len(typ.params), len(args))
+	}
+	for i, param := range typ.params {
+		obj.fields[param.id] = args[i]
+	}
+	err := obj.resolveEndian()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := &context{obj: obj}
+	for _, attr := range typ.seq {
+		err := me.parseAttribute(ctx, attr, io, obj.block, attr.id)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", attr.id, err)
+		}
+	}
+	obj.block.Size = io.pos - start
+	if sized {
+		obj.block.Size = io.end - start
+	}
+	me.register(obj)
+	return obj, nil
+}
+
+func (me *interpreter) register(obj *object) {
+	region := [2]uint64{uint64(obj.block.Address), obj.block.Size}
+	if _, found := me.regions[region]; !found {
+		me.regions[region] = len(me.objects)
+	}
+	me.objects = append(me.objects, obj)
+}
+
+// Calculated endianness is decided before the seq is parsed, so it can only depend on the parents (or the params)
+func (me *object) resolveEndian() error {
+	switch {
+	case me.spec.endian != "":
+		me.endian = me.spec.endian
+	case me.spec.endianOn != nil:
+		ctx := &context{obj: me}
+		on, err := ctx.eval(me.spec.endianOn)
+		if err != nil {
+			return err
+		}
+		for _, c := range me.spec.endianCases {
+			if c.value == nil {
+				me.endian = c.endian
+				continue
+			}
+			value, err := ctx.eval(c.value)
+			if err != nil {
+				return err
+			}
+			if equal, err := equals(on, value); err == nil && equal {
+				me.endian = c.endian
+				return nil
+			}
+		}
+		if me.endian == "" {
+			return fmt.Errorf("unable to decide endianness from %q", me.spec.endianOn.Source)
+		}
+	case me.parent != nil:
+		me.endian = me.parent.endian
+	}
+	return nil
+}
+
+func (me *object) get(name string) (any, error) {
+	switch name {
+	case "_root":
+		return me.root, nil
+	case "_parent":
+		if me.parent == nil {
+			return nil, fmt.Errorf("%s has no parent", me.spec.name)
+		}
+		return me.parent, nil
+	case "_io":
+		return me.io, nil
+	}
+	if value, found := me.fields[name]; found {
+		return value, nil
+	}
+	for _, attr := range me.spec.instances {
+		if attr.id != name {
+			continue
+		}
+		value, err := me.instance(attr)
+		if err == nil && value == nil {
+			err = fmt.Errorf("%s isn't set", name)
+		}
+		return value, err
+	}
+	if slices.ContainsFunc(me.spec.seq, func(attr *attribute) bool { return attr.id == name }) {
+		return nil, fmt.Errorf("%s isn't set", name)
+	}
+	return nil, fmt.Errorf("unknown field %s in %s", name, me.spec.name)
+}
+
+// The value is nil when the instance is skipped (i.e. its condition is false)
+func (me *object) instance(attr *attribute) (any, error) {
+	if result, found := me.instances[attr.id]; found {
+		return result.value, result.err
+	}
+	if me.evaluating[attr.id] {
+		return nil, fmt.Errorf("%s depends on itself", attr.id)
+	}
+	me.evaluating[attr.id] = true
+	value, err := me.parseInstance(attr)
+	delete(me.evaluating, attr.id)
+	if err != nil {
+		err = fmt.Errorf("%s: %s: %w", me.block.Name, attr.id, err)
+	}
+	me.instances[attr.id] = instanceResult{value: value, err: err}
+	return value, err
+}
+
+// Instances are either calculated from other values or parsed somewhere else in the stream (e.g. at an offset given in
+// a header), the latter are shown as their own block
+func (me *object) parseInstance(attr *attribute) (any, error) {
+	ctx := &context{obj: me}
+	if attr.cond != nil {
+		ok, err := ctx.evalBool(attr.cond)
+		if err != nil || !ok {
+			return nil, err
+		}
+	}
+	if attr.value != nil {
+		return ctx.eval(attr.value)
+	}
+
+	io := me.io
+	if attr.io != nil {
+		value, err := ctx.eval(attr.io)
+		if err != nil {
+			return nil, err
+		}
+		var ok bool
+		io, ok = value.(*stream)
+		if !ok {
+			return nil, fmt.Errorf("%q is not a stream", attr.io.Source)
+		}
+	}
+	saved := *io
+	defer func() {
+		*io = saved
+	}()
+	if attr.pos != nil {
+		pos, err := ctx.evalUint(attr.pos)
+		if err != nil {
+			return nil, err
+		}
+		err = io.seek(pos)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Numbers and strings are values, so they need a block of their own
+	parsed := len(me.interp.objects)
+	start := io.fieldStart()
+	holder := newBlock(attr.id, start, 0)
+	err := me.interp.parseAttribute(ctx, attr, io, holder, "Value")
+	if err != nil {
+		return nil, err
+	}
+	holder.Size = io.pos - start
+	block := holder
+	if len(holder.Content) == 1 && len(holder.Values) == 0 {
+		block = holder.Content[0]
+	}
+	// Instances often parse again what the seq already did (e.g. the local headers of a ZIP file from its central
+	// directory), which is already shown
+	region := [2]uint64{uint64(block.Address), block.Size}
+	if index, found := me.interp.regions[region]; !found || index >= parsed {
+		me.interp.placed = append(me.interp.placed, block)
+		me.interp.regions[region] = -1
+	}
+
+	err = me.linkFields(attr.pos, "points to", block)
+	if err != nil {
+		return nil, err
+	}
+	return me.fields[attr.id], nil
+}
+
+// Links a field of the object to the block it describes, fields which aren't shown in the object (e.g. params or
+// instances) are skipped
+func (me *object) link(field, name string, block *contracts.MemoryBlock) error {
+	if !slices.ContainsFunc(me.block.Values, func(value *contracts.MemoryValue) bool { return value.Name == field }) {
+		return nil
+	}
+	return parsingutils.AddLinkWithBlock(me.block, field, block, name)
+}
+
+func newBlock(name string, offset, size uint64) *contracts.MemoryBlock {
+	return &contracts.MemoryBlock{
+		Name:    name,
+		Address: uintptr(offset),
+		Size:    size,
+	}
+}
+
+func addChild(parent, child *contracts.MemoryBlock) {
+	child.ParentOffset = uint64(child.Address - parent.Address)
+	parent.Content = append(parent.Content, child)
+}
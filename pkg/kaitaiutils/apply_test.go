@@ -0,0 +1,488 @@
+package kaitaiutils_test
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/LouisBrunner/mem-viz/pkg/contracts"
+	"github.com/LouisBrunner/mem-viz/pkg/contracts/contractstest"
+	"github.com/LouisBrunner/mem-viz/pkg/kaitaiutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func pack(t *testing.T, order binary.ByteOrder, values ...any) []byte {
+	t.Helper()
+	data := []byte{}
+	for _, value := range values {
+		var err error
+		data, err = binary.Append(data, order, value)
+		require.NoError(t, err)
+	}
+	return data
+}
+
+// Writes the specifications (by their path) in a temporary directory and loads the first one
+func load(t *testing.T, files ...string) (*kaitaiutils.Spec, error) {
+	t.Helper()
+	dir := t.TempDir()
+	for i := 0; i+1 < len(files); i += 2 {
+		path := filepath.Join(dir, files[i])
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte(files[i+1]), 0o644))
+	}
+	return kaitaiutils.Load(filepath.Join(dir, files[0]))
+}
+
+func apply(t *testing.T, data []byte, files ...string) ([]*contracts.MemoryBlock, []error) {
+	t.Helper()
+	spec, err := load(t, files...)
+	require.NoError(t, err)
+	blocks, warnings, err := spec.Apply(data)
+	require.NoError(t, err)
+	return blocks, warnings
+}
+
+const pixSpec = `
+meta:
+  id: pix
+  endian: be
+  imports:
+    - common/index_entry
+seq:
+  - id: magic
+    contents: [0x89, PIX]
+  - id: compressed
+    type: b1
+  - id: version
+    type: b7
+  - id: ofs_index
+    type: u2
+  - id: num_entries
+    type: u1
+  - id: chunks
+    type: chunk
+    repeat: until
+    repeat-until: _.kind == chunk_kind::end
+  - id: trailer
+    type: u1
+    if: version >= 2
+instances:
+  index:
+    pos: ofs_index
+    type: index_entry
+    repeat: expr
+    repeat-expr: num_entries
+  has_text:
+    value: chunks[0].kind == chunk_kind::text
+types:
+  chunk:
+    seq:
+      - id: len_body
+        type: u4
+      - id: kind
+        type: u1
+        enum: chunk_kind
+      - id: body
+        size: len_body
+        type:
+          switch-on: kind
+          cases:
+            chunk_kind::text: text_body
+            chunk_kind::data: data_body(len_body)
+  text_body:
+    seq:
+      - id: text
+        type: str
+        size-eos: true
+        encoding: ASCII
+  data_body:
+    params:
+      - id: len
+        type: u4
+    seq:
+      - id: values
+        type: u2le
+        repeat: expr
+        repeat-expr: len / 2
+enums:
+  chunk_kind:
+    0: end
+    1: text
+    2: data
+`
+
+const indexEntrySpec = `
+meta:
+  id: index_entry
+  endian: le
+seq:
+  - id: name
+    type: strz
+    encoding: ASCII
+  - id: value
+    type: s2
+`
+
+func pixData(t *testing.T) []byte {
+	return pack(t, binary.BigEndian,
+		[]byte{0x89, 'P', 'I', 'X'}, uint8(0x82), uint16(33), uint8(2),
+		uint32(5), uint8(1), []byte("hello"),
+		uint32(4), uint8(2), []byte{1, 0, 2, 0},
+		uint32(0), uint8(0),
+		uint8(0xff),
+		[]byte("a\x00"), []byte{0xff, 0xff}, []byte("bc\x00"), []byte{5, 0},
+	)
+}
+
+func Test_Apply(t *testing.T) {
+	blocks, warnings := apply(t, pixData(t), "pix.ksy", pixSpec, "common/index_entry.ksy", indexEntrySpec)
+	assert.Empty(t, warnings)
+	require.Len(t, blocks, 2)
+
+	root := blocks[0]
+	assert.Equal(t, "pix", root.Name)
+	assert.Equal(t, uint64(33), root.Size)
+	assert.Equal(t, "89 50 49 58", contractstest.FindValue(t, root, "magic").Value)
+	assert.Equal(t, "true", contractstest.FindValue(t, root, "compressed").Value)
+	assert.Equal(t, "0x2", contractstest.FindValue(t, root, "version").Value)
+	assert.Equal(t, uint64(4), contractstest.FindValue(t, root, "version").Offset)
+	assert.Equal(t, "0xff", contractstest.FindValue(t, root, "trailer").Value)
+	ofsIndex := contractstest.FindValue(t, root, "ofs_index")
+	require.Len(t, ofsIndex.Links, 1)
+	assert.Equal(t, "points to", ofsIndex.Links[0].Name)
+	assert.Equal(t, uint64(33), ofsIndex.Links[0].TargetAddress)
+
+	require.Len(t, root.Content, 1)
+	chunks := root.Content[0]
+	assert.Equal(t, "chunks (3)", chunks.Name)
+	assert.Equal(t, uintptr(8), chunks.Address)
+	assert.Equal(t, uint64(24), chunks.Size)
+	require.Len(t, chunks.Content, 3)
+
+	text := chunks.Content[0]
+	assert.Equal(t, "chunks[0]", text.Name)
+	assert.Equal(t, "text", contractstest.FindValue(t, text, "kind").Value)
+	assert.Equal(t, uint64(1), contractstest.FindValue(t, text, "kind").Raw)
+	lenBody := contractstest.FindValue(t, text, "len_body")
+	require.Len(t, lenBody.Links, 1)
+	assert.Equal(t, "gives size", lenBody.Links[0].Name)
+	assert.Equal(t, uint64(13), lenBody.Links[0].TargetAddress)
+	require.Len(t, text.Content, 1)
+	assert.Equal(t, "body", text.Content[0].Name)
+	assert.Equal(t, uint64(5), text.Content[0].Size)
+	assert.Equal(t, `"hello"`, contractstest.FindValue(t, text.Content[0], "text").Value)
+
+	data := chunks.Content[1]
+	require.Len(t, data.Content, 1)
+	require.Len(t, data.Content[0].Content, 1)
+	values := data.Content[0].Content[0]
+	assert.Equal(t, "values (2)", values.Name)
+	assert.Equal(t, "0x1", contractstest.FindValue(t, values, "[0]").Value)
+	assert.Equal(t, "0x2", contractstest.FindValue(t, values, "[1]").Value)
+
+	end := chunks.Content[2]
+	assert.Equal(t, "end", contractstest.FindValue(t, end, "kind").Value)
+	assert.Equal(t, uint64(5), end.Size)
+	assert.Len(t, end.Values, 2)
+
+	index := blocks[1]
+	assert.Equal(t, "index (2)", index.Name)
+	assert.Equal(t, uintptr(33), index.Address)
+	assert.Equal(t, uint64(9), index.Size)
+	require.Len(t, index.Content, 2)
+	assert.Equal(t, "index[1]", index.Content[1].Name)
+	assert.Equal(t, `"bc"`, contractstest.FindValue(t, index.Content[1], "name").Value)
+	assert.Equal(t, uint8(3), contractstest.FindValue(t, index.Content[1], "name").Size)
+	assert.Equal(t, "0x5", contractstest.FindValue(t, index.Content[1], "value").Value)
+	assert.Equal(t, "-0x1", contractstest.FindValue(t, index.Content[0], "value").Value)
+}
+
+func Test_Apply_endian(t *testing.T) {
+	spec := `
+meta:
+  id: tiff_like
+seq:
+  - id: order
+    size: 2
+  - id: body
+    type: body
+types:
+  body:
+    meta:
+      endian:
+        switch-on: _parent.order
+        cases:
+          '[0x49, 0x49]': le
+          '[0x4d, 0x4d]': be
+    seq:
+      - id: magic
+        type: u2
+      - id: nested
+        type: nested
+  nested:
+    seq:
+      - id: value
+        type: u4
+      - id: ratio
+        type: f4
+`
+	for _, test := range []struct {
+		name  string
+		data  []byte
+		magic string
+	}{
+		{name: "le", data: pack(t, binary.LittleEndian, []byte("II"), uint16(42), uint32(7), float32(1.5)), magic: "0x2a"},
+		{name: "be", data: pack(t, binary.BigEndian, []byte("MM"), uint16(42), uint32(7), float32(1.5)), magic: "0x2a"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			blocks, _ := apply(t, test.data, "tiff.ksy", spec)
+			body := blocks[0].Content[0]
+			assert.Equal(t, test.magic, contractstest.FindValue(t, body, "magic").Value)
+			nested := body.Content[0]
+			assert.Equal(t, "0x7", contractstest.FindValue(t, nested, "value").Value)
+			assert.Equal(t, "1.5", contractstest.FindValue(t, nested, "ratio").Value)
+		})
+	}
+
+	loaded, err := load(t, "tiff.ksy", spec)
+	require.NoError(t, err)
+	_, _, err = loaded.Apply([]byte("XX\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00"))
+	assert.ErrorContains(t, err, "unable to decide endianness")
+}
+
+func Test_Apply_strings(t *testing.T) {
+	spec := `
+meta:
+  id: strings
+  encoding: ASCII
+seq:
+  - id: padded
+    type: str
+    size: 6
+    pad-right: 0x20
+  - id: terminated
+    type: strz
+    size: 4
+  - id: line
+    type: str
+    terminator: 0x0a
+  - id: utf16
+    type: str
+    size: 4
+    encoding: UTF-16LE
+  - id: names
+    type: strz
+    repeat: eos
+`
+	data := []byte("ab    x\x00\x00\x00line\nh\x00i\x00one\x00two\x00")
+	blocks, _ := apply(t, data, "strings.ksy", spec)
+	root := blocks[0]
+	assert.Equal(t, `"ab"`, contractstest.FindValue(t, root, "padded").Value)
+	assert.Equal(t, `"x"`, contractstest.FindValue(t, root, "terminated").Value)
+	line := contractstest.FindValue(t, root, "line")
+	assert.Equal(t, `"line"`, line.Value)
+	assert.Equal(t, uint8(5), line.Size)
+	assert.Equal(t, `"hi"`, contractstest.FindValue(t, root, "utf16").Value)
+	names := root.Content[0]
+	assert.Equal(t, "names (2)", names.Name)
+	assert.Equal(t, `"two"`, contractstest.FindValue(t, names, "[1]").Value)
+}
+
+func Test_Apply_bytes(t *testing.T) {
+	spec := `
+meta:
+  id: blobs
+  bit-endian: le
+seq:
+  - id: low
+    type: b4
+  - id: high
+    type: b4
+  - id: len_blob
+    type: u1
+  - id: tag
+    type:
+      switch-on: len_blob
+      cases:
+        1: u1
+  - id: small
+    size: 2
+  - id: blob
+    size: len_blob
+  - id: packed
+    size: 2
+    process: zlib
+`
+	data := append([]byte{0x21, 20, 0xaa, 0xbb}, make([]byte, 22)...)
+	blocks, warnings := apply(t, data, "blobs.ksy", spec)
+	root := blocks[0]
+	assert.Equal(t, "0x1", contractstest.FindValue(t, root, "low").Value)
+	assert.Equal(t, "0x2", contractstest.FindValue(t, root, "high").Value)
+	assert.Equal(t, "aa bb", contractstest.FindValue(t, root, "small").Value)
+	assert.Len(t, root.Values, 5)
+	require.Len(t, root.Content, 1)
+	assert.Equal(t, "blob", root.Content[0].Name)
+	assert.Equal(t, uint64(20), root.Content[0].Size)
+	assert.Equal(t, "00 00", contractstest.FindValue(t, root, "packed").Value)
+	require.Len(t, warnings, 1)
+	assert.ErrorContains(t, warnings[0], "process zlib isn't supported")
+}
+
+func Test_Apply_instances(t *testing.T) {
+	spec := `
+meta:
+  id: archive
+  endian: le
+seq:
+  - id: num_files
+    type: u1
+  - id: files
+    type: file
+    repeat: expr
+    repeat-expr: num_files
+instances:
+  first_file:
+    pos: 1
+    type: file
+types:
+  file:
+    seq:
+      - id: ofs_data
+        type: u1
+      - id: len_data
+        type: u1
+    instances:
+      data:
+        io: _root._io
+        pos: ofs_data
+        size: len_data
+      first_byte:
+        io: _root._io
+        pos: ofs_data
+        type: u1
+        if: len_data > 0
+      is_empty:
+        value: len_data == 0
+`
+	data := []byte{3, 7, 2, 9, 0, 99, 1, 0xab, 0xcd}
+	blocks, warnings := apply(t, data, "archive.ksy", spec)
+	// The last file points after the end of the file
+	require.Len(t, warnings, 2)
+	assert.ErrorContains(t, warnings[0], "files[2]: data")
+	assert.ErrorContains(t, warnings[1], "files[2]: first_byte")
+
+	files := blocks[0].Content[0]
+	assert.Equal(t, "files (3)", files.Name)
+	numFiles := contractstest.FindValue(t, blocks[0], "num_files")
+	require.Len(t, numFiles.Links, 1)
+	assert.Equal(t, "gives amount", numFiles.Links[0].Name)
+
+	// Each file has its data and its first byte (except the empty one), the first file is already shown
+	require.Len(t, blocks, 4)
+	assert.Equal(t, "data", blocks[1].Name)
+	assert.Equal(t, uintptr(7), blocks[1].Address)
+	assert.Equal(t, "ab cd", contractstest.FindValue(t, blocks[1], "Value").Value)
+	assert.Equal(t, "first_byte", blocks[2].Name)
+	assert.Equal(t, "0xab", contractstest.FindValue(t, blocks[2], "Value").Value)
+	assert.Equal(t, "data", blocks[3].Name)
+	assert.Equal(t, uintptr(9), blocks[3].Address)
+	ofsData := contractstest.FindValue(t, files.Content[0], "ofs_data")
+	require.Len(t, ofsData.Links, 2)
+	assert.Equal(t, "points to", ofsData.Links[0].Name)
+	assert.Equal(t, uint64(7), ofsData.Links[0].TargetAddress)
+}
+
+func Test_Apply_invalid(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		spec string
+		data []byte
+		err  string
+	}{
+		{
+			name: "bad contents",
+			spec: "meta: {id: a}\nseq: [{id: magic, contents: [1, 2]}]",
+			data: []byte{1, 3},
+			err:  "magic: expected 01 02, got 01 03",
+		},
+		{
+			name: "missing endianness",
+			spec: "meta: {id: a}\nseq: [{id: x, type: u2}]",
+			data: []byte{1, 2},
+			err:  "u2 needs an endianness",
+		},
+		{
+			name: "too short",
+			spec: "meta: {id: a, endian: le}\nseq: [{id: x, type: u4}]",
+			data: []byte{1, 2},
+			err:  "x: unexpected end of stream",
+		},
+		{
+			name: "recursive",
+			spec: "meta: {id: a}\nseq: [{id: x, type: a}]",
+			data: []byte{},
+			err:  "types are nested more than 64 times",
+		},
+		{
+			name: "unknown type",
+			spec: "meta: {id: a}\nseq: [{id: x, type: nope}]",
+			data: []byte{},
+			err:  "unknown type nope",
+		},
+		{
+			name: "empty elements",
+			spec: "meta: {id: a}\nseq: [{id: x, type: e, repeat: eos}, {id: y, type: u1}]\ntypes: {e: {}}",
+			data: []byte{1},
+			err:  "x[0] is empty, it would repeat forever",
+		},
+		{
+			name: "missing size",
+			spec: "meta: {id: a}\nseq: [{id: x, type: str}]",
+			data: []byte{1},
+			err:  "x: missing size",
+		},
+		{
+			name: "unset field",
+			spec: "meta: {id: a}\nseq: [{id: x, type: u1, if: false}, {id: y, size: x}]",
+			data: []byte{1},
+			err:  "x isn't set",
+		},
+		{
+			name: "cycle",
+			spec: "meta: {id: a}\nseq: [{id: y, size: b}]\ninstances: {b: {value: c}, c: {value: b}}",
+			data: []byte{1},
+			err:  "depends on itself",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			spec, err := load(t, "a.ksy", test.spec)
+			require.NoError(t, err)
+			_, _, err = spec.Apply(test.data)
+			assert.ErrorContains(t, err, test.err)
+		})
+	}
+}
+
+func Test_Load_invalid(t *testing.T) {
+	for _, test := range []struct {
+		name  string
+		files []string
+		err   string
+	}{
+		{name: "no id", files: []string{"a.ksy", "seq: []"}, err: "missing meta/id"},
+		{name: "endian", files: []string{"a.ksy", "meta: {id: a, endian: me}"}, err: `unknown endianness "me"`},
+		{name: "repeat", files: []string{"a.ksy", "meta: {id: a}\nseq: [{id: x, repeat: sometimes}]"}, err: `unknown repeat "sometimes"`},
+		{name: "repeat-expr", files: []string{"a.ksy", "meta: {id: a}\nseq: [{id: x, repeat: expr}]"}, err: "missing repeat-expr"},
+		{name: "expression", files: []string{"a.ksy", "meta: {id: a}\nseq: [{id: x, size: 1 +}]"}, err: "x"},
+		{name: "bits", files: []string{"a.ksy", "meta: {id: a}\nseq: [{id: x, type: b65}]"}, err: "bit fields can't be larger than 64 bits"},
+		{name: "import", files: []string{"a.ksy", "meta: {id: a, imports: [/nowhere]}"}, err: "could not find import /nowhere"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := load(t, test.files...)
+			assert.ErrorContains(t, err, test.err)
+		})
+	}
+}
@@ -0,0 +1,356 @@
+package kaitaiutils
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/LouisBrunner/mem-viz/pkg/contracts"
+	"github.com/LouisBrunner/mem-viz/pkg/parsingutils"
+)
+
+// Byte arrays up to this size are shown as a value, larger ones get a block
+const maxBytesValue = 16
+
+// Parses an attribute into the container (its object or the block of an instance), repeated attributes get a block
+// with a child per element (user types and large byte arrays) or a value per element (everything else)
+func (me *interpreter) parseAttribute(ctx *context, attr *attribute, io *stream, container *contracts.MemoryBlock, valueName string) error {
+	if attr.cond != nil {
+		ok, err := ctx.evalBool(attr.cond)
+		if err != nil || !ok {
+			return err
+		}
+	}
+	if attr.repeat == "" {
+		value, err := me.parseOne(ctx, attr, io, container, attr.id, valueName)
+		if err != nil || value == nil {
+			return err
+		}
+		ctx.obj.fields[attr.id] = value
+		return nil
+	}
+
+	var count uint64
+	if attr.repeat == RepeatExpr {
+		var err error
+		count, err = ctx.evalUint(attr.repeatExpr)
+		if err != nil {
+			return err
+		}
+		// Elements can be empty, so this is the only thing stopping a bogus count
+		if count > uint64(len(me.data)) {
+			return fmt.Errorf("count %d is larger than the file", count)
+		}
+	}
+	start := io.fieldStart()
+	array := newBlock(attr.id, start, 0)
+	items := []any{}
+	for i := 0; ; i += 1 {
+		if (attr.repeat == RepeatExpr && uint64(i) >= count) || (attr.repeat == RepeatEOS && io.eof()) {
+			break
+		}
+		before := io.fieldStart()
+		item := ctx.withIndex(i)
+		value, err := me.parseOne(item, attr, io, array, fmt.Sprintf("%s[%d]", attr.id, i), fmt.Sprintf("[%d]", i))
+		if err != nil {
+			return fmt.Errorf("%s[%d]: %w", attr.id, i, err)
+		}
+		items = append(items, value)
+		if attr.repeat == RepeatEOS && io.fieldStart() == before {
+			return fmt.Errorf("%s[%d] is empty, it would repeat forever", attr.id, i)
+		}
+		if attr.repeat == RepeatUntil {
+			item.current, item.hasCurrent = value, true
+			done, err := item.evalBool(attr.repeatUntil)
+			if err != nil {
+				return fmt.Errorf("%s[%d]: %w", attr.id, i, err)
+			}
+			if done {
+				break
+			}
+		}
+	}
+	ctx.obj.fields[attr.id] = items
+	array.Name = fmt.Sprintf("%s (%d)", attr.id, len(items))
+	array.Size = io.pos - start
+	addChild(container, array)
+	return ctx.obj.linkFields(attr.repeatExpr, "gives amount", array)
+}
+
+func (me *interpreter) parseOne(ctx *context, attr *attribute, io *stream, container *contracts.MemoryBlock, blockName, valueName string) (any, error) {
+	if attr.contents != nil {
+		start := io.fieldStart()
+		data, err := io.read(uint64(len(attr.contents)))
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.Equal(data, attr.contents) {
+			return nil, fmt.Errorf("expected % x, got % x", attr.contents, data)
+		}
+		addBytes(container, valueName, data, start)
+		return data, nil
+	}
+
+	typ := attr.typ
+	if attr.switchOn != nil {
+		var err error
+		typ, err = ctx.switchType(attr)
+		if err != nil {
+			return nil, err
+		}
+		// Without a matching case nor a size, nothing is read (e.g. blocks which are only a tag)
+		if typ == nil && attr.size == nil && !attr.sizeEOS && attr.terminator < 0 {
+			return nil, nil
+		}
+	}
+	if typ != nil {
+		switch typ.kind {
+		case typeUnsigned, typeSigned, typeFloat, typeBits:
+			return me.parseNumber(ctx, attr, typ, io, container, valueName)
+		}
+	}
+
+	start := io.fieldStart()
+	region, err := ctx.region(attr, typ, io)
+	if err != nil {
+		return nil, err
+	}
+	if typ != nil && typ.kind == typeUser && attr.process == "" {
+		target, err := ctx.obj.spec.resolveType(typ.path)
+		if err != nil {
+			return nil, err
+		}
+		args := make([]any, len(typ.args))
+		for i, arg := range typ.args {
+			args[i], err = ctx.eval(arg)
+			if err != nil {
+				return nil, err
+			}
+		}
+		objectIO := region
+		if objectIO == nil {
+			objectIO = io
+		}
+		obj, err := me.parseObject(target, objectIO, region != nil, ctx.obj, blockName, args)
+		if err != nil {
+			return nil, err
+		}
+		addChild(container, obj.block)
+		return obj, ctx.obj.linkFields(attr.size, "gives size", obj.block)
+	}
+
+	data := region.readRest()
+	if attr.size != nil || attr.sizeEOS {
+		if attr.padRight >= 0 {
+			for len(data) > 0 && data[len(data)-1] == byte(attr.padRight) {
+				data = data[:len(data)-1]
+			}
+		}
+		if attr.terminator >= 0 {
+			if end := bytes.IndexByte(data, byte(attr.terminator)); end >= 0 {
+				if attr.include {
+					end += 1
+				}
+				data = data[:end]
+			}
+		}
+	}
+	size := io.pos - start
+
+	if typ != nil && typ.kind == typeString {
+		encoding := attr.encoding
+		if encoding == "" {
+			encoding = ctx.obj.spec.encoding
+		}
+		text := decodeString(data, encoding)
+		parsingutils.AddValue(container, valueName, text, start-uint64(container.Address), uint8(min(size, 0xff)), func(name string, value any) string {
+			return fmt.Sprintf("%q", value)
+		})
+		return text, nil
+	}
+
+	// Compressed or encrypted data can't be parsed, so it is shown as is
+	if attr.process != "" {
+		me.warnings = append(me.warnings, fmt.Errorf("%s: %s: process %s isn't supported, shown as bytes", ctx.obj.block.Name, blockName, attr.process))
+	}
+	if size <= maxBytesValue && (typ == nil || typ.kind != typeUser) {
+		// Empty arrays are common (e.g. optional extra fields) and would only be noise
+		if size > 0 {
+			addBytes(container, valueName, data, start)
+		}
+		return data, nil
+	}
+	block := newBlock(blockName, start, size)
+	addChild(container, block)
+	return data, ctx.obj.linkFields(attr.size, "gives size", block)
+}
+
+// Integers are int64 for expressions but keep their type when shown, like the other frontends do
+func (me *interpreter) parseNumber(ctx *context, attr *attribute, typ *typeRef, io *stream, container *contracts.MemoryBlock, valueName string) (any, error) {
+	start := io.fieldStart()
+	var value, shown any
+	switch typ.kind {
+	case typeBits:
+		endian := typ.endian
+		if endian == "" {
+			endian = ctx.obj.spec.bitEndian
+		}
+		bits, err := io.readBits(typ.size, endian == "le")
+		if err != nil {
+			return nil, err
+		}
+		// Single bits are flags
+		if typ.size == 1 {
+			value, shown = bits == 1, bits == 1
+		} else {
+			value, shown = int64(bits), bits
+		}
+	case typeFloat:
+		bigEndian, err := ctx.obj.bigEndian(typ)
+		if err != nil {
+			return nil, err
+		}
+		f, err := io.readFloat(typ.size, bigEndian)
+		if err != nil {
+			return nil, err
+		}
+		value, shown = f, f
+		if typ.size == 4 {
+			shown = float32(f)
+		}
+	default:
+		bigEndian, err := ctx.obj.bigEndian(typ)
+		if err != nil {
+			return nil, err
+		}
+		raw, err := io.readInt(typ.size, bigEndian, typ.kind == typeSigned)
+		if err != nil {
+			return nil, err
+		}
+		switch v := raw.(type) {
+		case uint64:
+			value, shown = int64(v), sizedUnsigned(v, typ.size)
+		case int64:
+			value, shown = v, sizedSigned(v, typ.size)
+		}
+	}
+
+	if attr.enum != "" {
+		enum, err := ctx.obj.spec.resolveEnum(strings.Split(attr.enum, "::"))
+		if err != nil {
+			return nil, err
+		}
+		n, ok := toInt(value)
+		if !ok {
+			return nil, fmt.Errorf("enum %s needs an integer", attr.enum)
+		}
+		named := enumValue{enum: enum, value: n}
+		parsingutils.AddFormattedValue(container, valueName, shown, start-uint64(container.Address), uint8(io.pos-start), func(value any) (string, bool) {
+			return named.String(), true
+		})
+		return named, nil
+	}
+	parsingutils.AddValue(container, valueName, shown, start-uint64(container.Address), uint8(io.pos-start), parsingutils.FormatValue)
+	return value, nil
+}
+
+func (me *context) switchType(attr *attribute) (*typeRef, error) {
+	on, err := me.eval(attr.switchOn)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range attr.cases {
+		value, err := me.eval(c.value)
+		if err != nil {
+			return nil, err
+		}
+		if equal, err := equals(on, value); err == nil && equal {
+			return c.typ, nil
+		}
+	}
+	// Without a default, the attribute is read as bytes (when it has a size)
+	return attr.fallback, nil
+}
+
+// The part of the stream read by an attribute, nil for user types without a size (their size is whatever they parse)
+func (me *context) region(attr *attribute, typ *typeRef, io *stream) (*stream, error) {
+	switch {
+	case attr.size != nil:
+		size, err := me.evalUint(attr.size)
+		if err != nil {
+			return nil, err
+		}
+		return io.sub(size)
+	case attr.sizeEOS:
+		io.alignToByte()
+		return io.sub(io.end - io.pos)
+	case attr.terminator >= 0:
+		io.alignToByte()
+		start := io.pos
+		data, err := io.readTerminated(byte(attr.terminator), attr.include, attr.consume, attr.eosError)
+		if err != nil {
+			return nil, err
+		}
+		return newStream(io.data, start, start+uint64(len(data))), nil
+	}
+	if typ == nil || typ.kind != typeUser {
+		return nil, fmt.Errorf("missing size")
+	}
+	return nil, nil
+}
+
+func (me *object) bigEndian(typ *typeRef) (bool, error) {
+	if typ.size == 1 {
+		return false, nil
+	}
+	endian := typ.endian
+	if endian == "" {
+		endian = me.endian
+	}
+	if endian == "" {
+		return false, fmt.Errorf("%s needs an endianness (none given in meta/endian)", typ.name)
+	}
+	return endian == "be", nil
+}
+
+// Links the fields used by an expression (e.g. "len_body" in "len_body - 4") to the block they describe
+func (me *object) linkFields(expr *expression, name string, block *contracts.MemoryBlock) error {
+	for _, field := range expr.fields() {
+		err := me.link(field, name, block)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func addBytes(block *contracts.MemoryBlock, name string, data []byte, offset uint64) {
+	parsingutils.AddValue(block, name, data, offset-uint64(block.Address), uint8(min(len(data), 0xff)), func(name string, value any) string {
+		return fmt.Sprintf("% x", value)
+	})
+}
+
+// Keeps the type of the field so the value is shown like the other frontends do
+func sizedUnsigned(value uint64, size int) any {
+	switch size {
+	case 1:
+		return uint8(value)
+	case 2:
+		return uint16(value)
+	case 4:
+		return uint32(value)
+	}
+	return value
+}
+
+func sizedSigned(value int64, size int) any {
+	switch size {
+	case 1:
+		return int8(value)
+	case 2:
+		return int16(value)
+	case 4:
+		return int32(value)
+	}
+	return value
+}
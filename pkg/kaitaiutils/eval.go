@@ -0,0 +1,542 @@
+package kaitaiutils
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+
+	"github.com/LouisBrunner/mem-viz/pkg/exprutils"
+)
+
+// Values of expressions are int64, float64, bool, string, []byte, []any (arrays), *object (user types),
+// *stream (_io) or enumValue
+
+type enumValue struct {
+	enum  *enumSpec
+	value int64
+}
+
+func (me enumValue) String() string {
+	if name, found := me.enum.values[me.value]; found {
+		return name
+	}
+	return fmt.Sprintf("%#x", me.value)
+}
+
+// Where an expression is evaluated
+type context struct {
+	obj *object
+	// Index of the element being parsed in a repeated attribute
+	index    int64
+	hasIndex bool
+	// Element which was just parsed (only for repeat-until, "_")
+	current    any
+	hasCurrent bool
+}
+
+func (me *context) withIndex(index int) *context {
+	copied := *me
+	copied.index, copied.hasIndex = int64(index), true
+	return &copied
+}
+
+func (me *context) eval(expr *expression) (any, error) {
+	value, err := me.evalNode(expr.Root)
+	if err != nil {
+		return nil, fmt.Errorf("failed to evaluate %q: %w", expr.Source, err)
+	}
+	return value, nil
+}
+
+func (me *context) evalInt(expr *expression) (int64, error) {
+	value, err := me.eval(expr)
+	if err != nil {
+		return 0, err
+	}
+	n, ok := toInt(value)
+	if !ok {
+		return 0, fmt.Errorf("%q is not an integer", expr.Source)
+	}
+	return n, nil
+}
+
+// Used for positions, sizes and counts which can't be negative
+func (me *context) evalUint(expr *expression) (uint64, error) {
+	n, err := me.evalInt(expr)
+	if err != nil {
+		return 0, err
+	}
+	return exprutils.Unsigned(&expr.Expression, n)
+}
+
+func (me *context) evalBool(expr *expression) (bool, error) {
+	value, err := me.eval(expr)
+	if err != nil {
+		return false, err
+	}
+	b, ok := toBool(value)
+	if !ok {
+		return false, fmt.Errorf("%q is not a boolean", expr.Source)
+	}
+	return b, nil
+}
+
+func (me *context) lookup(name string) (any, error) {
+	switch name {
+	case "_":
+		if !me.hasCurrent {
+			return nil, fmt.Errorf("_ is only available in repeat-until")
+		}
+		return me.current, nil
+	case "_index":
+		if !me.hasIndex {
+			return nil, fmt.Errorf("_index is only available in repeated attributes")
+		}
+		return me.index, nil
+	}
+	return me.obj.get(name)
+}
+
+func toInt(value any) (int64, bool) {
+	switch v := value.(type) {
+	case int64:
+		return v, true
+	case enumValue:
+		return v.value, true
+	}
+	return 0, false
+}
+
+func toFloat(value any) (float64, bool) {
+	switch v := value.(type) {
+	case int64:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+	return 0, false
+}
+
+// Integers are accepted as booleans as some specifications rely on it (e.g. "if: flags & 1")
+func toBool(value any) (bool, bool) {
+	switch v := value.(type) {
+	case bool:
+		return v, true
+	case int64:
+		return v != 0, true
+	}
+	return false, false
+}
+
+// Byte arrays and array literals (e.g. "[0x50, 0x4b]") are compared to each other
+func toBytes(value any) ([]byte, bool) {
+	switch v := value.(type) {
+	case []byte:
+		return v, true
+	case []any:
+		data := make([]byte, len(v))
+		for i, item := range v {
+			n, ok := toInt(item)
+			if !ok {
+				return nil, false
+			}
+			data[i] = byte(n)
+		}
+		return data, true
+	}
+	return nil, false
+}
+
+func (me *context) evalNode(n exprutils.Node) (any, error) {
+	switch n := n.(type) {
+	case *exprutils.Literal:
+		return n.Value, nil
+	case *arrayLiteral:
+		items := make([]any, len(n.items))
+		for i, item := range n.items {
+			value, err := me.evalNode(item)
+			if err != nil {
+				return nil, err
+			}
+			items[i] = value
+		}
+		return items, nil
+	case *exprutils.Name:
+		return me.lookup(n.Name)
+	case *enumNode:
+		enum, err := me.obj.spec.resolveEnum(n.path)
+		if err != nil {
+			return nil, err
+		}
+		value, found := enum.ids[n.value]
+		if !found {
+			return nil, fmt.Errorf("unknown value %s of enum %s", n.value, enum.name)
+		}
+		return enumValue{enum: enum, value: value}, nil
+	case *exprutils.Unary:
+		return me.evalUnary(n)
+	case *exprutils.Binary:
+		return me.evalBinary(n)
+	case *ternaryNode:
+		cond, err := me.evalNode(n.cond)
+		if err != nil {
+			return nil, err
+		}
+		b, ok := toBool(cond)
+		if !ok {
+			return nil, fmt.Errorf("condition is not a boolean")
+		}
+		if b {
+			return me.evalNode(n.x)
+		}
+		return me.evalNode(n.y)
+	case *attrNode:
+		return me.evalAttr(n)
+	case *indexNode:
+		x, err := me.evalNode(n.x)
+		if err != nil {
+			return nil, err
+		}
+		index, err := me.evalNode(n.index)
+		if err != nil {
+			return nil, err
+		}
+		i, ok := toInt(index)
+		if !ok {
+			return nil, fmt.Errorf("index is not an integer")
+		}
+		switch x := x.(type) {
+		case []any:
+			if i < 0 || i >= int64(len(x)) {
+				return nil, fmt.Errorf("index %d out of range (%d)", i, len(x))
+			}
+			return x[i], nil
+		case []byte:
+			if i < 0 || i >= int64(len(x)) {
+				return nil, fmt.Errorf("index %d out of range (%d)", i, len(x))
+			}
+			return int64(x[i]), nil
+		}
+		return nil, fmt.Errorf("%T can't be indexed", x)
+	}
+	return nil, fmt.Errorf("unknown expression %T", n)
+}
+
+func (me *context) evalUnary(n *exprutils.Unary) (any, error) {
+	x, err := me.evalNode(n.X)
+	if err != nil {
+		return nil, err
+	}
+	switch n.Op {
+	case "not":
+		b, ok := toBool(x)
+		if !ok {
+			return nil, fmt.Errorf("not needs a boolean")
+		}
+		return !b, nil
+	case "-":
+		if f, ok := x.(float64); ok {
+			return -f, nil
+		}
+	}
+	i, ok := toInt(x)
+	if !ok {
+		return nil, fmt.Errorf("%s needs an integer", n.Op)
+	}
+	if n.Op == "-" {
+		return -i, nil
+	}
+	return ^i, nil
+}
+
+func (me *context) evalBinary(n *exprutils.Binary) (any, error) {
+	x, err := me.evalNode(n.X)
+	if err != nil {
+		return nil, err
+	}
+	// Short-circuit, e.g. "has_extra and extra.size > 0"
+	if n.Op == "and" || n.Op == "or" {
+		b, ok := toBool(x)
+		if !ok {
+			return nil, fmt.Errorf("%s needs booleans", n.Op)
+		}
+		if b == (n.Op == "or") {
+			return b, nil
+		}
+		y, err := me.evalNode(n.Y)
+		if err != nil {
+			return nil, err
+		}
+		b, ok = toBool(y)
+		if !ok {
+			return nil, fmt.Errorf("%s needs booleans", n.Op)
+		}
+		return b, nil
+	}
+	y, err := me.evalNode(n.Y)
+	if err != nil {
+		return nil, err
+	}
+
+	switch n.Op {
+	case "==", "!=":
+		equal, err := equals(x, y)
+		if err != nil {
+			return nil, err
+		}
+		return equal == (n.Op == "=="), nil
+	case "<", "<=", ">", ">=":
+		c, err := compare(x, y)
+		if err != nil {
+			return nil, err
+		}
+		switch n.Op {
+		case "<":
+			return c < 0, nil
+		case "<=":
+			return c <= 0, nil
+		case ">":
+			return c > 0, nil
+		}
+		return c >= 0, nil
+	}
+
+	if xs, ok := x.(string); ok && n.Op == "+" {
+		ys, ok := y.(string)
+		if !ok {
+			return nil, fmt.Errorf("can't add %T to a string", y)
+		}
+		return xs + ys, nil
+	}
+	xi, xIsInt := toInt(x)
+	yi, yIsInt := toInt(y)
+	if !xIsInt || !yIsInt {
+		xf, xOk := toFloat(x)
+		yf, yOk := toFloat(y)
+		if !xOk || !yOk {
+			return nil, fmt.Errorf("%s isn't supported between %T and %T", n.Op, x, y)
+		}
+		switch n.Op {
+		case "+":
+			return xf + yf, nil
+		case "-":
+			return xf - yf, nil
+		case "*":
+			return xf * yf, nil
+		case "/":
+			return xf / yf, nil
+		}
+		return nil, fmt.Errorf("%s needs integers", n.Op)
+	}
+	// Rounded towards negative infinity and always positive respectively, like in Python
+	if (n.Op == "/" || n.Op == "%") && yi != 0 {
+		quotient, remainder := xi/yi, xi%yi
+		if remainder != 0 && (remainder < 0) != (yi < 0) {
+			quotient, remainder = quotient-1, remainder+yi
+		}
+		if n.Op == "/" {
+			return quotient, nil
+		}
+		return remainder, nil
+	}
+	value, err := exprutils.IntegerOp(n.Op, xi, yi)
+	if err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+func equals(x, y any) (bool, error) {
+	if xb, ok := x.(bool); ok {
+		yb, ok := y.(bool)
+		if !ok {
+			return false, fmt.Errorf("can't compare a boolean with %T", y)
+		}
+		return xb == yb, nil
+	}
+	if xe, ok := x.(enumValue); ok {
+		if ye, ok := y.(enumValue); ok && xe.enum != ye.enum {
+			return false, nil
+		}
+	}
+	if xb, ok := toBytes(x); ok {
+		yb, ok := toBytes(y)
+		if !ok {
+			return false, fmt.Errorf("can't compare a byte array with %T", y)
+		}
+		return bytes.Equal(xb, yb), nil
+	}
+	c, err := compare(x, y)
+	return c == 0, err
+}
+
+func compare(x, y any) (int, error) {
+	if xs, ok := x.(string); ok {
+		ys, ok := y.(string)
+		if !ok {
+			return 0, fmt.Errorf("can't compare a string with %T", y)
+		}
+		switch {
+		case xs < ys:
+			return -1, nil
+		case xs > ys:
+			return 1, nil
+		}
+		return 0, nil
+	}
+	if xi, ok := toInt(x); ok {
+		if yi, ok := toInt(y); ok {
+			switch {
+			case xi < yi:
+				return -1, nil
+			case xi > yi:
+				return 1, nil
+			}
+			return 0, nil
+		}
+	}
+	xf, xOk := toFloat(x)
+	yf, yOk := toFloat(y)
+	if !xOk || !yOk {
+		return 0, fmt.Errorf("can't compare %T with %T", x, y)
+	}
+	switch {
+	case xf < yf:
+		return -1, nil
+	case xf > yf:
+		return 1, nil
+	}
+	return 0, nil
+}
+
+// Attributes of objects and streams, and the methods of the other values (e.g. "name.length" or "value.to_s")
+func (me *context) evalAttr(n *attrNode) (any, error) {
+	x, err := me.evalNode(n.x)
+	if err != nil {
+		return nil, err
+	}
+	args := make([]any, len(n.args))
+	for i, arg := range n.args {
+		args[i], err = me.evalNode(arg)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	switch x := x.(type) {
+	case *object:
+		if !n.call {
+			return x.get(n.name)
+		}
+	case *stream:
+		switch n.name {
+		case "size":
+			return int64(x.size()), nil
+		case "pos":
+			return int64(x.pos - x.start), nil
+		case "eof":
+			return x.eof(), nil
+		}
+	case int64:
+		switch n.name {
+		case "to_s":
+			return strconv.FormatInt(x, 10), nil
+		case "to_i":
+			return x, nil
+		}
+	case float64:
+		if n.name == "to_i" {
+			return int64(x), nil
+		}
+	case bool:
+		if n.name == "to_i" {
+			if x {
+				return int64(1), nil
+			}
+			return int64(0), nil
+		}
+	case enumValue:
+		if n.name == "to_i" {
+			return x.value, nil
+		}
+	case string:
+		switch n.name {
+		case "length":
+			return int64(len([]rune(x))), nil
+		case "reverse":
+			runes := []rune(x)
+			for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
+				runes[i], runes[j] = runes[j], runes[i]
+			}
+			return string(runes), nil
+		case "to_i":
+			base := int64(10)
+			if len(args) == 1 {
+				base, _ = toInt(args[0])
+			}
+			value, err := strconv.ParseInt(x, int(base), 64)
+			if err != nil {
+				return nil, fmt.Errorf("%q is not an integer", x)
+			}
+			return value, nil
+		case "substring":
+			if len(args) != 2 {
+				return nil, fmt.Errorf("substring needs 2 arguments")
+			}
+			from, _ := toInt(args[0])
+			to, _ := toInt(args[1])
+			runes := []rune(x)
+			if from < 0 || to < from || to > int64(len(runes)) {
+				return nil, fmt.Errorf("substring(%d, %d) out of range (%d)", from, to, len(runes))
+			}
+			return string(runes[from:to]), nil
+		}
+	case []byte:
+		switch n.name {
+		case "length", "size":
+			return int64(len(x)), nil
+		case "to_s":
+			encoding := ""
+			if len(args) == 1 {
+				encoding, _ = args[0].(string)
+			}
+			return decodeString(x, encoding), nil
+		}
+		items := make([]any, len(x))
+		for i, b := range x {
+			items[i] = int64(b)
+		}
+		return arrayMethod(items, n.name)
+	case []any:
+		if n.name == "length" || n.name == "size" {
+			return int64(len(x)), nil
+		}
+		return arrayMethod(x, n.name)
+	}
+	return nil, fmt.Errorf("%T has no %s", x, n.name)
+}
+
+func arrayMethod(items []any, name string) (any, error) {
+	if len(items) == 0 {
+		return nil, fmt.Errorf("%s of an empty array", name)
+	}
+	switch name {
+	case "first":
+		return items[0], nil
+	case "last":
+		return items[len(items)-1], nil
+	case "min", "max":
+		best := items[0]
+		for _, item := range items[1:] {
+			c, err := compare(item, best)
+			if err != nil {
+				return nil, err
+			}
+			if (name == "min" && c < 0) || (name == "max" && c > 0) {
+				best = item
+			}
+		}
+		return best, nil
+	}
+	return nil, fmt.Errorf("arrays have no %s", name)
+}
@@ -0,0 +1,291 @@
+package kaitaiutils
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/LouisBrunner/mem-viz/pkg/exprutils"
+)
+
+// Kaitai's expression language (https://doc.kaitai.io/user_guide.html#_expression_language), e.g.
+// "_root.header.num_entries * 4", "_.type == 'IEND' or _io.eof" or "kind == kinds::directory ? 1 : 0"
+
+// Array literals, ternaries, attributes, indexes and enum values are Kaitai's own nodes, the others come from exprutils
+
+type arrayLiteral struct {
+	items []exprutils.Node
+}
+
+// e.g. "kinds::directory" or "header::kinds::directory"
+type enumNode struct {
+	path  []string
+	value string
+}
+
+type ternaryNode struct {
+	cond, x, y exprutils.Node
+}
+
+// e.g. "header.size", "name.length" or "name.substring(0, 4)" (args is nil without parentheses)
+type attrNode struct {
+	x    exprutils.Node
+	name string
+	args []exprutils.Node
+	call bool
+}
+
+type indexNode struct {
+	x, index exprutils.Node
+}
+
+type expression struct {
+	exprutils.Expression
+}
+
+// Comparisons don't chain, they are only here to be between "not" and the bitwise operators
+var binaryPrecedences = map[string]int{
+	"==": 1, "!=": 1, "<": 1, "<=": 1, ">": 1, ">=": 1,
+	"|":  2,
+	"^":  3,
+	"&":  4,
+	"<<": 5, ">>": 5,
+	"+": 6, "-": 6,
+	"*": 7, "/": 7, "%": 7,
+}
+
+var syntax = exprutils.Syntax{
+	Operators:    []string{"::", "<<", ">>", "<=", ">=", "==", "!=", "+", "-", "*", "/", "%", "&", "|", "^", "~", "<", ">", "?", ":", ".", "[", "]", "(", ")", ","},
+	Floats:       true,
+	SingleQuotes: true,
+}
+
+type exprParser struct {
+	*exprutils.Parser
+}
+
+func parseExpression(source string) (*expression, error) {
+	parsed, err := exprutils.Parse(source, syntax, func(p *exprutils.Parser) (exprutils.Node, error) {
+		return exprParser{p}.parseTernary()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &expression{*parsed}, nil
+}
+
+// Arguments of a user type, e.g. "4, _root.version" in "chunk(4, _root.version)"
+func parseArguments(source string) ([]*expression, error) {
+	tokens, err := exprutils.Tokenize(source, syntax)
+	if err != nil {
+		return nil, err
+	}
+	p := exprParser{exprutils.NewParser(tokens)}
+	args := []*expression{}
+	for !p.Done() {
+		start := p.Pos()
+		arg, err := p.parseTernary()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, &expression{exprutils.Expression{Source: p.TextSince(start), Root: arg}})
+		if !p.Done() && !p.Accept(",") {
+			tok, _ := p.Next()
+			return nil, fmt.Errorf("unexpected %q", tok.Text)
+		}
+	}
+	return args, nil
+}
+
+func (me exprParser) parseTernary() (exprutils.Node, error) {
+	cond, err := me.parseOr()
+	if err != nil || !me.Accept("?") {
+		return cond, err
+	}
+	x, err := me.parseTernary()
+	if err != nil {
+		return nil, err
+	}
+	err = me.Expect(":")
+	if err != nil {
+		return nil, err
+	}
+	y, err := me.parseTernary()
+	if err != nil {
+		return nil, err
+	}
+	return &ternaryNode{cond: cond, x: x, y: y}, nil
+}
+
+func (me exprParser) parseOr() (exprutils.Node, error) {
+	x, err := me.parseAnd()
+	for err == nil && me.Accept("or") {
+		var y exprutils.Node
+		y, err = me.parseAnd()
+		x = &exprutils.Binary{Op: "or", X: x, Y: y}
+	}
+	return x, err
+}
+
+func (me exprParser) parseAnd() (exprutils.Node, error) {
+	x, err := me.parseNot()
+	for err == nil && me.Accept("and") {
+		var y exprutils.Node
+		y, err = me.parseNot()
+		x = &exprutils.Binary{Op: "and", X: x, Y: y}
+	}
+	return x, err
+}
+
+func (me exprParser) parseNot() (exprutils.Node, error) {
+	if me.Accept("not") {
+		x, err := me.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &exprutils.Unary{Op: "not", X: x}, nil
+	}
+	return me.ParseBinary(binaryPrecedences, 1, func() (exprutils.Node, error) {
+		return me.ParseUnary([]string{"-", "~", "+"}, me.parsePostfix)
+	})
+}
+
+func (me exprParser) parsePostfix() (exprutils.Node, error) {
+	x, err := me.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		switch {
+		case me.Accept("."):
+			name, ok := me.AcceptName()
+			if !ok {
+				return nil, fmt.Errorf("expected a name after .")
+			}
+			// Casts (e.g. "body.as<png_chunk>") only matter to statically typed targets
+			if name == "as" && me.Accept("<") {
+				for !me.Done() && me.Peek() != ">" {
+					me.Next()
+				}
+				err = me.Expect(">")
+				if err != nil {
+					return nil, err
+				}
+				continue
+			}
+			attr := &attrNode{x: x, name: name}
+			if me.Accept("(") {
+				attr.call = true
+				attr.args, err = me.parseList(")")
+				if err != nil {
+					return nil, err
+				}
+			}
+			x = attr
+		case me.Accept("["):
+			index, err := me.parseTernary()
+			if err != nil {
+				return nil, err
+			}
+			err = me.Expect("]")
+			if err != nil {
+				return nil, err
+			}
+			x = &indexNode{x: x, index: index}
+		default:
+			return x, nil
+		}
+	}
+}
+
+func (me exprParser) parseList(end string) ([]exprutils.Node, error) {
+	items := []exprutils.Node{}
+	if me.Accept(end) {
+		return items, nil
+	}
+	for {
+		item, err := me.parseTernary()
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+		if me.Accept(end) {
+			return items, nil
+		}
+		err = me.Expect(",")
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (me exprParser) parsePrimary() (exprutils.Node, error) {
+	tok, ok := me.Next()
+	if !ok {
+		return nil, fmt.Errorf("unexpected end")
+	}
+	switch tok.Kind {
+	case exprutils.TokenInt, exprutils.TokenFloat, exprutils.TokenString:
+		return &exprutils.Literal{Value: tok.Value}, nil
+	case exprutils.TokenName:
+		switch tok.Text {
+		case "true", "false":
+			return &exprutils.Literal{Value: tok.Text == "true"}, nil
+		case "sizeof", "bitsizeof":
+			return nil, fmt.Errorf("%s is not supported", tok.Text)
+		}
+		path := []string{tok.Text}
+		for me.Accept("::") {
+			name, ok := me.AcceptName()
+			if !ok {
+				return nil, fmt.Errorf("expected a name after ::")
+			}
+			path = append(path, name)
+		}
+		if len(path) == 1 {
+			return &exprutils.Name{Name: tok.Text}, nil
+		}
+		return &enumNode{path: path[:len(path)-1], value: path[len(path)-1]}, nil
+	}
+	switch tok.Text {
+	case "(":
+		x, err := me.parseTernary()
+		if err != nil {
+			return nil, err
+		}
+		return x, me.Expect(")")
+	case "[":
+		items, err := me.parseList("]")
+		if err != nil {
+			return nil, err
+		}
+		return &arrayLiteral{items: items}, nil
+	}
+	return nil, fmt.Errorf("unexpected %q", tok.Text)
+}
+
+// Fields of the current object used directly by the expression (e.g. "ofs_body" in "ofs_body + 8"), used to add links
+func (me *expression) fields() []string {
+	if me == nil {
+		return nil
+	}
+	names := []string{}
+	var visit func(n exprutils.Node)
+	visit = func(n exprutils.Node) {
+		switch n := n.(type) {
+		case *exprutils.Name:
+			if !strings.HasPrefix(n.Name, "_") {
+				names = append(names, n.Name)
+			}
+		case *exprutils.Unary:
+			visit(n.X)
+		case *exprutils.Binary:
+			visit(n.X)
+			visit(n.Y)
+		case *ternaryNode:
+			visit(n.x)
+			visit(n.y)
+		}
+	}
+	visit(me.Root)
+	return names
+}
@@ -0,0 +1,120 @@
+package kaitaiutils_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Evaluates an expression as the number of elements of an array of empty types, which shows up in its name
+func evaluate(t *testing.T, expr string, data []byte) (string, error) {
+	t.Helper()
+	spec := fmt.Sprintf(`
+meta:
+  id: a
+  endian: le
+seq:
+  - id: x
+    type: u1
+  - id: s
+    type: str
+    size: 2
+    encoding: ASCII
+  - id: list
+    type: u1
+    repeat: expr
+    repeat-expr: 3
+  - id: kind
+    type: u1
+    enum: kinds
+  - id: e
+    type: empty
+    repeat: expr
+    repeat-expr: %q
+instances:
+  double:
+    value: x * 2
+  last:
+    pos: _io.size - 1
+    type: u1
+types:
+  empty: {}
+enums:
+  kinds:
+    1: one
+    2: two
+`, expr)
+	loaded, err := load(t, "a.ksy", spec)
+	require.NoError(t, err)
+	blocks, _, err := loaded.Apply(data)
+	if err != nil {
+		return "", err
+	}
+	return blocks[0].Content[1].Name, nil
+}
+
+func Test_expressions(t *testing.T) {
+	// Counts can't be larger than the file
+	data := append([]byte{6, 'o', 'k', 1, 2, 3, 2}, make([]byte, 8)...)
+	data[len(data)-1] = 9
+	for _, test := range []struct {
+		expr  string
+		count int
+	}{
+		{expr: "x", count: 6},
+		{expr: "1 + 2 * 3", count: 7},
+		{expr: "(1 + 2) * 3", count: 9},
+		{expr: "-7 / 2 + 5", count: 1},
+		{expr: "-7 % 3", count: 2},
+		{expr: "1 << 3 | 1", count: 9},
+		{expr: "0xff & ~0xf0 ^ 1", count: 14},
+		{expr: "double", count: 12},
+		{expr: "last", count: 9},
+		{expr: "x > 5 and s == 'ok' ? 1 : 0", count: 1},
+		{expr: "x < 5 or not (s != \"ok\") ? 1 : 0", count: 1},
+		{expr: "s.length + s.reverse.length", count: 4},
+		{expr: "'3'.to_i + 'a'.to_i(16)", count: 13},
+		{expr: "(x.to_s + s).length", count: 3},
+		{expr: "list.size + list[2] + list.last + list.max - list.min", count: 11},
+		{expr: "kind == kinds::two ? kind.to_i : 0", count: 2},
+		{expr: "_io.size - _io.pos", count: 8},
+		{expr: "_root.x == _root._io.size ? 1 : 0", count: 0},
+		{expr: "(1.5 * 4).to_i", count: 6},
+		{expr: "s.substring(1, 2) == 'k' ? 3 : 0", count: 3},
+		{expr: "[1, 2] == [1, 2] ? 1 : 0", count: 1},
+		{expr: "_io.eof ? 1 : 0", count: 0},
+	} {
+		t.Run(test.expr, func(t *testing.T) {
+			name, err := evaluate(t, test.expr, data)
+			require.NoError(t, err)
+			assert.Equal(t, fmt.Sprintf("e (%d)", test.count), name)
+		})
+	}
+}
+
+func Test_expressions_invalid(t *testing.T) {
+	data := make([]byte, 8)
+	for _, test := range []struct {
+		expr string
+		err  string
+	}{
+		{expr: "1 / x", err: "division by zero"},
+		{expr: "y", err: "unknown field y"},
+		{expr: "s + 1", err: "can't add int64 to a string"},
+		{expr: "s < 1", err: "can't compare a string with int64"},
+		{expr: "x - 1", err: "is negative"},
+		{expr: "list[3]", err: "index 3 out of range (3)"},
+		{expr: "s", err: "is not an integer"},
+		{expr: "kinds::three", err: "unknown value three of enum kinds"},
+		{expr: "x.nope", err: "int64 has no nope"},
+		{expr: "_parent.x", err: "a has no parent"},
+		{expr: "_index", err: "_index is only available in repeated attributes"},
+	} {
+		t.Run(test.expr, func(t *testing.T) {
+			_, err := evaluate(t, test.expr, data)
+			assert.ErrorContains(t, err, test.err)
+		})
+	}
+}
@@ -0,0 +1,605 @@
+package kaitaiutils
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Kaitai Struct specifications (.ksy) are interpreted directly instead of being compiled to a parser, see
+// https://doc.kaitai.io/ksy_reference.html. Only what affects the layout is read (e.g. documentation is ignored)
+
+type rawMeta struct {
+	ID        string    `yaml:"id"`
+	Endian    yaml.Node `yaml:"endian"`
+	BitEndian string    `yaml:"bit-endian"`
+	Encoding  string    `yaml:"encoding"`
+	Imports   []string  `yaml:"imports"`
+}
+
+type rawSpec struct {
+	Meta      rawMeta                        `yaml:"meta"`
+	Params    []*rawAttribute                `yaml:"params"`
+	Seq       []*rawAttribute                `yaml:"seq"`
+	Instances yaml.Node                      `yaml:"instances"`
+	Types     map[string]*rawSpec            `yaml:"types"`
+	Enums     map[string]map[int64]yaml.Node `yaml:"enums"`
+}
+
+type rawAttribute struct {
+	ID          string    `yaml:"id"`
+	Type        yaml.Node `yaml:"type"`
+	Size        string    `yaml:"size"`
+	SizeEOS     bool      `yaml:"size-eos"`
+	Repeat      string    `yaml:"repeat"`
+	RepeatExpr  string    `yaml:"repeat-expr"`
+	RepeatUntil string    `yaml:"repeat-until"`
+	If          string    `yaml:"if"`
+	Contents    yaml.Node `yaml:"contents"`
+	Enum        string    `yaml:"enum"`
+	Encoding    string    `yaml:"encoding"`
+	Terminator  *int      `yaml:"terminator"`
+	Consume     *bool     `yaml:"consume"`
+	Include     bool      `yaml:"include"`
+	EOSError    *bool     `yaml:"eos-error"`
+	PadRight    *int      `yaml:"pad-right"`
+	Process     string    `yaml:"process"`
+	// Only for instances
+	Pos   string `yaml:"pos"`
+	IO    string `yaml:"io"`
+	Value string `yaml:"value"`
+}
+
+// Types referenced by attributes
+type typeKind int
+
+const (
+	// Byte arrays (attributes without a type)
+	typeBytes typeKind = iota
+	typeUnsigned
+	typeSigned
+	typeFloat
+	typeBits
+	typeString
+	typeUser
+)
+
+type typeRef struct {
+	name string
+	kind typeKind
+	// Size in bytes of numbers, in bits of bit fields
+	size int
+	// "le", "be" or "" when it comes from the type (or the bit order for bit fields)
+	endian string
+	// Only for strz
+	zeroTerminated bool
+	// Only for user types
+	path []string
+	args []*expression
+}
+
+type switchCase struct {
+	value *expression
+	typ   *typeRef
+}
+
+type attribute struct {
+	id string
+	// Either a type or a switch on a value (nil for byte arrays)
+	typ         *typeRef
+	switchOn    *expression
+	cases       []switchCase
+	fallback    *typeRef
+	size        *expression
+	sizeEOS     bool
+	repeat      string
+	repeatExpr  *expression
+	repeatUntil *expression
+	cond        *expression
+	contents    []byte
+	enum        string
+	encoding    string
+	terminator  int
+	consume     bool
+	include     bool
+	eosError    bool
+	padRight    int
+	process     string
+	// Only for instances
+	pos   *expression
+	io    *expression
+	value *expression
+}
+
+type enumSpec struct {
+	name   string
+	values map[int64]string
+	ids    map[string]int64
+}
+
+type endianCase struct {
+	value  *expression
+	endian string
+}
+
+type typeSpec struct {
+	name string
+	// Type where this one is declared (for name resolution)
+	parent *typeSpec
+	spec   *Spec
+	// Either fixed or chosen when parsing, inherited from the parent object when neither
+	endian      string
+	endianOn    *expression
+	endianCases []endianCase
+	bitEndian   string
+	encoding    string
+	params      []*attribute
+	seq         []*attribute
+	instances   []*attribute
+	types       map[string]*typeSpec
+	enums       map[string]*enumSpec
+}
+
+type Spec struct {
+	// Type of the whole file
+	root *typeSpec
+	// Types of the imported specifications by their ID
+	imports map[string]*typeSpec
+}
+
+const (
+	RepeatExpr  = "expr"
+	RepeatEOS   = "eos"
+	RepeatUntil = "until"
+)
+
+var (
+	numberTypeName = regexp.MustCompile(`^([us])([1248])(le|be)?$`)
+	floatTypeName  = regexp.MustCompile(`^f([48])(le|be)?$`)
+	bitsTypeName   = regexp.MustCompile(`^b([1-9][0-9]?)(le|be)?$`)
+)
+
+// Reads a specification and the ones it imports, which are looked up relative to it (or to one of its parent
+// directories for absolute imports, e.g. "/common/dos_datetime" in the format gallery)
+func Load(path string) (*Spec, error) {
+	spec := &Spec{imports: map[string]*typeSpec{}}
+	root, err := spec.load(path, filepath.Dir(path), map[string]bool{})
+	if err != nil {
+		return nil, err
+	}
+	spec.root = root
+	return spec, nil
+}
+
+func (me *Spec) load(path, rootDir string, loading map[string]bool) (*typeSpec, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	raw := &rawSpec{}
+	err = yaml.Unmarshal(data, raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid specification %s: %w", path, err)
+	}
+	if raw.Meta.ID == "" {
+		return nil, fmt.Errorf("invalid specification %s: missing meta/id", path)
+	}
+	loading[path] = true
+	for _, imported := range raw.Meta.Imports {
+		importPath, err := resolveImport(imported, filepath.Dir(path), rootDir)
+		if err != nil {
+			return nil, err
+		}
+		if loading[importPath] {
+			continue
+		}
+		typ, err := me.load(importPath, rootDir, loading)
+		if err != nil {
+			return nil, fmt.Errorf("failed to import %s: %w", imported, err)
+		}
+		me.imports[typ.name] = typ
+	}
+
+	typ, err := me.compileType(raw.Meta.ID, raw, nil, raw.Meta.Encoding)
+	if err != nil {
+		return nil, fmt.Errorf("invalid specification %s: %w", path, err)
+	}
+	return typ, nil
+}
+
+func resolveImport(name, dir, rootDir string) (string, error) {
+	relative := filepath.FromSlash(strings.TrimPrefix(name, "/")) + ".ksy"
+	if !strings.HasPrefix(name, "/") {
+		return filepath.Join(dir, relative), nil
+	}
+	for current := rootDir; ; current = filepath.Dir(current) {
+		candidate := filepath.Join(current, relative)
+		if _, err := os.Stat(candidate); err == nil {
+			return candidate, nil
+		}
+		if parent := filepath.Dir(current); parent == current {
+			break
+		}
+	}
+	return "", fmt.Errorf("could not find import %s", name)
+}
+
+func (me *Spec) compileType(name string, raw *rawSpec, parent *typeSpec, encoding string) (*typeSpec, error) {
+	if raw.Meta.Encoding != "" {
+		encoding = raw.Meta.Encoding
+	}
+	bitEndian := raw.Meta.BitEndian
+	if bitEndian == "" && parent != nil {
+		bitEndian = parent.bitEndian
+	}
+	typ := &typeSpec{
+		name:      name,
+		parent:    parent,
+		spec:      me,
+		bitEndian: bitEndian,
+		encoding:  encoding,
+		types:     map[string]*typeSpec{},
+		enums:     map[string]*enumSpec{},
+	}
+	err := typ.compileEndian(&raw.Meta.Endian)
+	if err != nil {
+		return nil, err
+	}
+	// Fixed endianness applies to the nested types, calculated endianness is inherited when parsing
+	if typ.endian == "" && typ.endianOn == nil && parent != nil {
+		typ.endian = parent.endian
+	}
+	switch typ.bitEndian {
+	case "", "le", "be":
+	default:
+		return nil, fmt.Errorf("unknown bit endianness %q", typ.bitEndian)
+	}
+
+	for enumName, values := range raw.Enums {
+		enum := &enumSpec{name: enumName, values: map[int64]string{}, ids: map[string]int64{}}
+		for value, node := range values {
+			id := node.Value
+			if node.Kind == yaml.MappingNode {
+				described := struct {
+					ID string `yaml:"id"`
+				}{}
+				err = node.Decode(&described)
+				if err != nil {
+					return nil, fmt.Errorf("enum %s: %w", enumName, err)
+				}
+				id = described.ID
+			}
+			enum.values[value] = id
+			enum.ids[id] = value
+		}
+		typ.enums[enumName] = enum
+	}
+	for typeName, rawType := range raw.Types {
+		typ.types[typeName], err = me.compileType(typeName, rawType, typ, encoding)
+		if err != nil {
+			return nil, fmt.Errorf("type %s: %w", typeName, err)
+		}
+	}
+
+	for _, rawParam := range raw.Params {
+		param, err := compileAttribute(rawParam)
+		if err != nil {
+			return nil, fmt.Errorf("param %s: %w", rawParam.ID, err)
+		}
+		typ.params = append(typ.params, param)
+	}
+	for i, rawAttr := range raw.Seq {
+		attr, err := compileAttribute(rawAttr)
+		if err != nil {
+			return nil, fmt.Errorf("seq %d (%s): %w", i, rawAttr.ID, err)
+		}
+		if attr.id == "" {
+			attr.id = fmt.Sprintf("_unnamed%d", i)
+		}
+		typ.seq = append(typ.seq, attr)
+	}
+	// Instances are a map but their order is kept to show them in the same order
+	instances := &raw.Instances
+	for i := 0; i+1 < len(instances.Content); i += 2 {
+		id := instances.Content[i].Value
+		rawAttr := &rawAttribute{}
+		err = instances.Content[i+1].Decode(rawAttr)
+		if err != nil {
+			return nil, fmt.Errorf("instance %s: %w", id, err)
+		}
+		rawAttr.ID = id
+		attr, err := compileAttribute(rawAttr)
+		if err != nil {
+			return nil, fmt.Errorf("instance %s: %w", id, err)
+		}
+		typ.instances = append(typ.instances, attr)
+	}
+	return typ, nil
+}
+
+// Endianness is either "le", "be" or a switch on a value (e.g. a byte of the header)
+func (me *typeSpec) compileEndian(node *yaml.Node) error {
+	switch node.Kind {
+	case 0:
+		return nil
+	case yaml.ScalarNode:
+		me.endian = node.Value
+		if me.endian != "le" && me.endian != "be" {
+			return fmt.Errorf("unknown endianness %q", me.endian)
+		}
+		return nil
+	}
+	calculated := struct {
+		SwitchOn string    `yaml:"switch-on"`
+		Cases    yaml.Node `yaml:"cases"`
+	}{}
+	err := node.Decode(&calculated)
+	if err != nil {
+		return fmt.Errorf("invalid endianness: %w", err)
+	}
+	me.endianOn, err = parseExpression(calculated.SwitchOn)
+	if err != nil {
+		return err
+	}
+	for i := 0; i+1 < len(calculated.Cases.Content); i += 2 {
+		key, endian := calculated.Cases.Content[i].Value, calculated.Cases.Content[i+1].Value
+		if endian != "le" && endian != "be" {
+			return fmt.Errorf("unknown endianness %q", endian)
+		}
+		// The default case has no value
+		var value *expression
+		if key != "_" {
+			value, err = parseExpression(key)
+			if err != nil {
+				return err
+			}
+		}
+		me.endianCases = append(me.endianCases, endianCase{value: value, endian: endian})
+	}
+	return nil
+}
+
+func compileAttribute(raw *rawAttribute) (*attribute, error) {
+	attr := &attribute{
+		id:         raw.ID,
+		sizeEOS:    raw.SizeEOS,
+		repeat:     raw.Repeat,
+		enum:       raw.Enum,
+		encoding:   raw.Encoding,
+		terminator: -1,
+		consume:    raw.Consume == nil || *raw.Consume,
+		include:    raw.Include,
+		eosError:   raw.EOSError == nil || *raw.EOSError,
+		padRight:   -1,
+		process:    raw.Process,
+	}
+	if raw.Terminator != nil {
+		attr.terminator = *raw.Terminator
+	}
+	if raw.PadRight != nil {
+		attr.padRight = *raw.PadRight
+	}
+	var err error
+	for _, expr := range []struct {
+		source string
+		dest   **expression
+	}{
+		{raw.Size, &attr.size},
+		{raw.RepeatExpr, &attr.repeatExpr},
+		{raw.RepeatUntil, &attr.repeatUntil},
+		{raw.If, &attr.cond},
+		{raw.Pos, &attr.pos},
+		{raw.IO, &attr.io},
+		{raw.Value, &attr.value},
+	} {
+		if expr.source == "" {
+			continue
+		}
+		*expr.dest, err = parseExpression(expr.source)
+		if err != nil {
+			return nil, err
+		}
+	}
+	switch attr.repeat {
+	case "":
+	case RepeatExpr:
+		if attr.repeatExpr == nil {
+			return nil, fmt.Errorf("missing repeat-expr")
+		}
+	case RepeatUntil:
+		if attr.repeatUntil == nil {
+			return nil, fmt.Errorf("missing repeat-until")
+		}
+	case RepeatEOS:
+	default:
+		return nil, fmt.Errorf("unknown repeat %q", attr.repeat)
+	}
+
+	attr.contents, err = compileContents(&raw.Contents)
+	if err != nil {
+		return nil, err
+	}
+	err = attr.compileType(&raw.Type)
+	if err != nil {
+		return nil, err
+	}
+	if attr.typ != nil && attr.typ.zeroTerminated && attr.terminator < 0 {
+		attr.terminator = 0
+	}
+	return attr, nil
+}
+
+// Magic signatures are either a string or a list of bytes and strings
+func compileContents(node *yaml.Node) ([]byte, error) {
+	switch node.Kind {
+	case 0:
+		return nil, nil
+	case yaml.ScalarNode:
+		return []byte(node.Value), nil
+	case yaml.SequenceNode:
+		contents := []byte{}
+		for _, item := range node.Content {
+			var b byte
+			if item.Tag == "!!int" && item.Decode(&b) == nil {
+				contents = append(contents, b)
+			} else {
+				contents = append(contents, []byte(item.Value)...)
+			}
+		}
+		return contents, nil
+	}
+	return nil, fmt.Errorf("invalid contents")
+}
+
+func (me *attribute) compileType(node *yaml.Node) error {
+	var err error
+	switch node.Kind {
+	case 0:
+		return nil
+	case yaml.ScalarNode:
+		me.typ, err = parseTypeRef(node.Value)
+		return err
+	}
+	switched := struct {
+		SwitchOn string    `yaml:"switch-on"`
+		Cases    yaml.Node `yaml:"cases"`
+	}{}
+	err = node.Decode(&switched)
+	if err != nil {
+		return fmt.Errorf("invalid type: %w", err)
+	}
+	me.switchOn, err = parseExpression(switched.SwitchOn)
+	if err != nil {
+		return err
+	}
+	cases := &switched.Cases
+	for i := 0; i+1 < len(cases.Content); i += 2 {
+		key, name := cases.Content[i].Value, cases.Content[i+1].Value
+		typ, err := parseTypeRef(name)
+		if err != nil {
+			return fmt.Errorf("case %s: %w", key, err)
+		}
+		if key == "_" {
+			me.fallback = typ
+			continue
+		}
+		value, err := parseExpression(key)
+		if err != nil {
+			return fmt.Errorf("case %s: %w", key, err)
+		}
+		me.cases = append(me.cases, switchCase{value: value, typ: typ})
+	}
+	return nil
+}
+
+// e.g. "u4le", "b3", "strz" or "chunk(4, _root.version)"
+func parseTypeRef(name string) (*typeRef, error) {
+	if match := numberTypeName.FindStringSubmatch(name); match != nil {
+		typ := &typeRef{name: name, kind: typeUnsigned, size: int(match[2][0] - '0'), endian: match[3]}
+		if match[1] == "s" {
+			typ.kind = typeSigned
+		}
+		return typ, nil
+	}
+	if match := floatTypeName.FindStringSubmatch(name); match != nil {
+		return &typeRef{name: name, kind: typeFloat, size: int(match[1][0] - '0'), endian: match[2]}, nil
+	}
+	if match := bitsTypeName.FindStringSubmatch(name); match != nil {
+		size := 0
+		fmt.Sscanf(match[1], "%d", &size)
+		if size > 64 {
+			return nil, fmt.Errorf("bit fields can't be larger than 64 bits")
+		}
+		return &typeRef{name: name, kind: typeBits, size: size, endian: match[2]}, nil
+	}
+	switch name {
+	case "str":
+		return &typeRef{name: name, kind: typeString}, nil
+	case "strz":
+		return &typeRef{name: name, kind: typeString, zeroTerminated: true}, nil
+	case "bytes":
+		return &typeRef{name: name, kind: typeBytes}, nil
+	case "":
+		return nil, fmt.Errorf("missing type")
+	}
+
+	typ := &typeRef{name: name, kind: typeUser}
+	path := name
+	if open := strings.IndexByte(name, '('); open >= 0 {
+		if !strings.HasSuffix(name, ")") {
+			return nil, fmt.Errorf("invalid type %q", name)
+		}
+		path = name[:open]
+		args, err := parseArguments(name[open+1 : len(name)-1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid arguments of %q: %w", name, err)
+		}
+		typ.args = args
+	}
+	typ.path = strings.Split(strings.TrimSpace(path), "::")
+	return typ, nil
+}
+
+// Finds a user type from where it is used, going up the types it is declared in and then the imports
+func (me *typeSpec) resolveType(path []string) (*typeSpec, error) {
+	top := me
+	for current := me; current != nil; current = current.parent {
+		if found := current.lookupType(path); found != nil {
+			return found, nil
+		}
+		top = current
+	}
+	// The type of the whole specification is named after its ID (e.g. for recursive formats)
+	if path[0] == top.name {
+		if found := top.lookupType(path[1:]); found != nil {
+			return found, nil
+		}
+	}
+	if imported, found := me.spec.imports[path[0]]; found {
+		if len(path) == 1 {
+			return imported, nil
+		}
+		if found := imported.lookupType(path[1:]); found != nil {
+			return found, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown type %s", strings.Join(path, "::"))
+}
+
+func (me *typeSpec) lookupType(path []string) *typeSpec {
+	current := me
+	for _, name := range path {
+		next, found := current.types[name]
+		if !found {
+			return nil
+		}
+		current = next
+	}
+	return current
+}
+
+// Same as resolveType for enums, the last element of the path is the name of the enum
+func (me *typeSpec) resolveEnum(path []string) (*enumSpec, error) {
+	name := path[len(path)-1]
+	if len(path) == 1 {
+		for current := me; current != nil; current = current.parent {
+			if enum, found := current.enums[name]; found {
+				return enum, nil
+			}
+		}
+		return nil, fmt.Errorf("unknown enum %s", name)
+	}
+	owner, err := me.resolveType(path[:len(path)-1])
+	if err != nil {
+		return nil, err
+	}
+	enum, found := owner.enums[name]
+	if !found {
+		return nil, fmt.Errorf("unknown enum %s", strings.Join(path, "::"))
+	}
+	return enum, nil
+}
@@ -0,0 +1,187 @@
+package kaitaiutils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strings"
+	"unicode/utf16"
+)
+
+// Streams are windows of the file (substreams are created for attributes with a size), positions are file offsets
+// so the blocks can be placed directly. Kaitai expressions see positions relative to the start of the stream
+type stream struct {
+	data       []byte
+	start, end uint64
+	pos        uint64
+	// Byte being read by bit fields and how many of its bits are left
+	bits     uint64
+	bitsLeft int
+}
+
+func newStream(data []byte, start, end uint64) *stream {
+	return &stream{data: data, start: start, end: end, pos: start}
+}
+
+func (me *stream) size() uint64 {
+	return me.end - me.start
+}
+
+func (me *stream) eof() bool {
+	return me.pos >= me.end && me.bitsLeft == 0
+}
+
+func (me *stream) alignToByte() {
+	me.bits, me.bitsLeft = 0, 0
+}
+
+func (me *stream) seek(pos uint64) error {
+	if pos > me.size() {
+		return fmt.Errorf("position %#x is after the end of the stream (%#x)", pos, me.size())
+	}
+	me.alignToByte()
+	me.pos = me.start + pos
+	return nil
+}
+
+func (me *stream) read(size uint64) ([]byte, error) {
+	me.alignToByte()
+	if size > me.end-me.pos {
+		return nil, fmt.Errorf("unexpected end of stream at %#x: %#x bytes needed, %#x left", me.pos, size, me.end-me.pos)
+	}
+	data := me.data[me.pos : me.pos+size]
+	me.pos += size
+	return data, nil
+}
+
+func (me *stream) readRest() []byte {
+	data, _ := me.read(me.end - me.pos)
+	return data
+}
+
+// Reads until the terminator, which is consumed (i.e. skipped) or included as asked,
+// the rest of the stream is read when it isn't found and eosError is false
+func (me *stream) readTerminated(terminator byte, include, consume, eosError bool) ([]byte, error) {
+	me.alignToByte()
+	end := bytes.IndexByte(me.data[me.pos:me.end], terminator)
+	if end < 0 {
+		if eosError {
+			return nil, fmt.Errorf("terminator %#x not found after %#x", terminator, me.pos)
+		}
+		return me.readRest(), nil
+	}
+	data := me.data[me.pos : me.pos+uint64(end)]
+	if include {
+		data = me.data[me.pos : me.pos+uint64(end)+1]
+	}
+	me.pos += uint64(end)
+	if consume {
+		me.pos += 1
+	}
+	return data, nil
+}
+
+func (me *stream) sub(size uint64) (*stream, error) {
+	_, err := me.read(size)
+	if err != nil {
+		return nil, err
+	}
+	return newStream(me.data, me.pos-size, me.pos), nil
+}
+
+func (me *stream) readInt(size int, bigEndian, signed bool) (any, error) {
+	data, err := me.read(uint64(size))
+	if err != nil {
+		return nil, err
+	}
+	var order binary.ByteOrder = binary.LittleEndian
+	if bigEndian {
+		order = binary.BigEndian
+	}
+	var value uint64
+	switch size {
+	case 1:
+		value = uint64(data[0])
+	case 2:
+		value = uint64(order.Uint16(data))
+	case 4:
+		value = uint64(order.Uint32(data))
+	case 8:
+		value = order.Uint64(data)
+	}
+	if !signed {
+		return value, nil
+	}
+	// Sign-extends from the size of the field
+	shift := 64 - 8*size
+	return int64(value<<shift) >> shift, nil
+}
+
+func (me *stream) readFloat(size int, bigEndian bool) (float64, error) {
+	value, err := me.readInt(size, bigEndian, false)
+	if err != nil {
+		return 0, err
+	}
+	if size == 4 {
+		return float64(math.Float32frombits(uint32(value.(uint64)))), nil
+	}
+	return math.Float64frombits(value.(uint64)), nil
+}
+
+// Bit fields are read from the most significant bit of each byte ("be", the default) or from the least one ("le")
+func (me *stream) readBits(count int, littleEndian bool) (uint64, error) {
+	var value uint64
+	shift := 0
+	for count > 0 {
+		if me.bitsLeft == 0 {
+			if me.pos >= me.end {
+				return 0, fmt.Errorf("unexpected end of stream at %#x while reading bits", me.pos)
+			}
+			me.bits, me.bitsLeft = uint64(me.data[me.pos]), 8
+			me.pos += 1
+		}
+		take := min(count, me.bitsLeft)
+		mask := uint64(1)<<take - 1
+		if littleEndian {
+			value |= ((me.bits >> (8 - me.bitsLeft)) & mask) << shift
+			shift += take
+		} else {
+			value = value<<take | (me.bits>>(me.bitsLeft-take))&mask
+		}
+		me.bitsLeft -= take
+		count -= take
+	}
+	return value, nil
+}
+
+// Where the next field starts, including when it is in the middle of a byte (i.e. after a bit field)
+func (me *stream) fieldStart() uint64 {
+	if me.bitsLeft > 0 {
+		return me.pos - 1
+	}
+	return me.pos
+}
+
+// Only the encodings which can be decoded without tables, others are shown as is (i.e. as if they were UTF-8)
+func decodeString(data []byte, encoding string) string {
+	switch strings.ReplaceAll(strings.ReplaceAll(strings.ToLower(encoding), "-", ""), "_", "") {
+	case "utf16le", "utf16be":
+		units := make([]uint16, len(data)/2)
+		for i := range units {
+			if strings.HasSuffix(strings.ToLower(encoding), "le") {
+				units[i] = binary.LittleEndian.Uint16(data[2*i:])
+			} else {
+				units[i] = binary.BigEndian.Uint16(data[2*i:])
+			}
+		}
+		return string(utf16.Decode(units))
+	case "iso88591", "latin1":
+		runes := make([]rune, len(data))
+		for i, b := range data {
+			runes[i] = rune(b)
+		}
+		return string(runes)
+	}
+	return string(data)
+}
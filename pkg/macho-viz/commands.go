@@ -6,25 +6,43 @@ import (
 	"reflect"
 	"unsafe"
 
+	"github.com/LouisBrunner/mem-viz/pkg/commons"
 	"github.com/LouisBrunner/mem-viz/pkg/contracts"
 	subcontracts "github.com/LouisBrunner/mem-viz/pkg/dsc-viz/contracts"
+	"github.com/LouisBrunner/mem-viz/pkg/machoutils"
 	"github.com/LouisBrunner/mem-viz/pkg/parsingutils"
 	"github.com/blacktop/go-macho"
 	"github.com/blacktop/go-macho/types"
 )
 
+// Same limit as dsc-viz, decoded tables with more entries than this are not detailed
+const thresholdsArrayTooBig = 3000
+
 type contextData struct {
-	header              *macho.File
-	text                *contracts.MemoryBlock
-	linkEdit            *contracts.MemoryBlock
-	symbols             *contracts.MemoryBlock
-	symtab              *macho.Symtab
-	stubSections        []*types.Section
-	lazyPointerSections []*types.Section
+	header                 *macho.File
+	core                   *coreLayout
+	text                   *contracts.MemoryBlock
+	symbols                *contracts.MemoryBlock
+	symtab                 *macho.Symtab
+	stubSections           []*types.Section
+	lazyPointerSections    []*types.Section
+	nonLazyPointerSections []*types.Section
+	interposingSections    []*types.Section
+	// ObjC and Swift structures already decoded, by VM address
+	metadata       machoutils.MetadataImage
+	metadataBlocks map[uint64]*machoutils.MetadataStruct
 }
 
 type parseFn func(block, header *contracts.MemoryBlock) error
 
+// Turns a VM address into where it is shown, false if it isn't in the file
+func (me *contextData) resolve(vmAddr uint64) (uintptr, bool) {
+	if me.core != nil {
+		return me.core.resolve(vmAddr)
+	}
+	return vmToOffset(me.header, vmAddr)
+}
+
 func (me *parser) addCommand(root, commands *contracts.MemoryBlock, i int, cmd macho.Load, offset uint64, context *contextData) (*contracts.MemoryBlock, error) { //nolint:gocyclo
 	var data any
 	banned := []string{
@@ -49,22 +67,86 @@ func (me *parser) addCommand(root, commands *contracts.MemoryBlock, i int, cmd m
 		return fmt.Errorf("unused load command (%s), currently unsupported", block.Name)
 	}
 
+	addCStrings := func(sect *types.Section, sectData *contracts.MemoryBlock) {
+		for i := 0; i < int(sect.Size); {
+			addr := sectData.Address + uintptr(i)
+			str := parsingutils.ReadCString(io.NewSectionReader(context.header, int64(addr), int64(sect.Size)-int64(i)))
+			strBlock := me.addChild(sectData, &contracts.MemoryBlock{
+				Name:         fmt.Sprintf("%q", str),
+				Address:      addr,
+				Size:         uint64(len(str) + 1),
+				ParentOffset: uint64(addr) - uint64(sectData.Address),
+			})
+			i += int(strBlock.Size)
+		}
+	}
+
+	// Symbols and sections are found through the load commands directly as LC_SYMTAB usually comes after the segments
+	decodeRelocations := func(block *contracts.MemoryBlock, base uint64) error {
+		raw, err := readAt(context.header, block.Address, block.Size)
+		if err != nil {
+			return fmt.Errorf("failed to read relocations: %w", err)
+		}
+		relocations, err := machoutils.ParseRelocations(raw, block.Address, machoutils.RelocationOptions{
+			CPU:       uint32(context.header.CPU),
+			ByteOrder: context.header.ByteOrder,
+			Base:      base,
+			Resolve: func(vmAddr uint64) (uintptr, bool) {
+				return vmToOffset(context.header, vmAddr)
+			},
+			TooBig: thresholdsArrayTooBig,
+			Symbol: func(index uint32) (machoutils.RelocationTarget, bool) {
+				symtab := context.header.Symtab
+				if symtab == nil || index >= uint32(len(symtab.Syms)) {
+					return machoutils.RelocationTarget{}, false
+				}
+				return machoutils.RelocationTarget{
+					Name:    symtab.Syms[index].Name,
+					Address: uintptr(uint64(symtab.Symoff) + uint64(index)*nlistSize(context.header)),
+				}, true
+			},
+			Section: func(ordinal uint32) (machoutils.RelocationTarget, bool) {
+				if ordinal == 0 || ordinal > uint32(len(context.header.Sections)) {
+					return machoutils.RelocationTarget{}, false
+				}
+				sect := context.header.Sections[ordinal-1]
+				if sect.Offset == 0 {
+					return machoutils.RelocationTarget{}, false
+				}
+				return machoutils.RelocationTarget{
+					Name:    fmt.Sprintf("%s,%s", sect.Seg, sect.Name),
+					Address: uintptr(sect.Offset),
+				}, true
+			},
+		})
+		if err != nil {
+			return err
+		}
+		me.addDecoded(block, relocations)
+		return nil
+	}
+
 	handleSegment := func(realSeg *macho.Segment, headerSize uint64) parseFn {
 		return func(block, header *contracts.MemoryBlock) error {
 			if realSeg.Offset == 0 && realSeg.Filesz == 0 {
 				return nil
 			}
-			segment := me.addChild(root, &contracts.MemoryBlock{
-				Name:         fmt.Sprintf("Segment (%s)", realSeg.Name),
-				Address:      uintptr(realSeg.Offset),
-				Size:         uint64(realSeg.Filesz),
-				ParentOffset: realSeg.Offset - uint64(root.Address),
-			})
-			switch realSeg.Name {
-			case "__TEXT":
+			if context.core != nil {
+				return me.addCoreSegment(root, header, realSeg, context.core)
+			}
+			name := fmt.Sprintf("Segment (%s)", realSeg.Name)
+			// Fileset entries share the __LINKEDIT of the collection, which was added with its load commands
+			segment := me.findBlock(name, uintptr(realSeg.Offset), uint64(realSeg.Filesz))
+			if segment == nil {
+				segment = me.addChild(root, &contracts.MemoryBlock{
+					Name:         name,
+					Address:      uintptr(realSeg.Offset),
+					Size:         uint64(realSeg.Filesz),
+					ParentOffset: realSeg.Offset - uint64(root.Address),
+				})
+			}
+			if realSeg.Name == "__TEXT" {
 				context.text = segment
-			case "__LINKEDIT":
-				context.linkEdit = segment
 			}
 			err := parsingutils.AddLinkWithBlock(header, "Offset", segment, "points to")
 			if err != nil {
@@ -73,18 +155,54 @@ func (me *parser) addCommand(root, commands *contracts.MemoryBlock, i int, cmd m
 			i := uint64(0)
 			// FIXME: SectionHeader has the wrong size (8 bytes too much in 64bit)
 			sizeOfSection := uint64(unsafe.Sizeof(types.SectionHeader{}) - 8)
+			if !is64Bit(context.header) {
+				sizeOfSection = uint64(unsafe.Sizeof(types.Section32{}))
+			}
 			for _, sect := range context.header.Sections {
-				if sect.Seg != realSeg.Name {
+				// Object files have a single unnamed segment containing every section
+				if sect.Seg != realSeg.Name && realSeg.Name != "" {
 					continue
 				}
+				var sectHeaderData any = sect.SectionHeader
+				if !is64Bit(context.header) {
+					sectHeaderData = sectionHeader32{
+						Name:      sect.Name,
+						Seg:       sect.Seg,
+						Addr:      uint32(sect.Addr),
+						Size:      uint32(sect.Size),
+						Offset:    sect.Offset,
+						Align:     sect.Align,
+						Reloff:    sect.Reloff,
+						Nreloc:    sect.Nreloc,
+						Flags:     sect.Flags,
+						Reserved1: sect.Reserved1,
+						Reserved2: sect.Reserved2,
+					}
+				}
 				sectHeader := me.addStructDetailed(
 					block,
-					sect.SectionHeader,
+					sectHeaderData,
 					fmt.Sprintf("Section Header (%s)", sect.Name),
 					uint64(headerSize)+i*sizeOfSection,
 					sizeOfSection,
 					[]string{"Type"},
 				)
+				if sect.Nreloc != 0 {
+					relocs := me.addChild(root, &contracts.MemoryBlock{
+						Name:         fmt.Sprintf("Section Relocations (%s)", sect.Name),
+						Address:      uintptr(sect.Reloff),
+						Size:         uint64(sect.Nreloc) * machoutils.RelocationInfoSize,
+						ParentOffset: uint64(sect.Reloff) - uint64(root.Address),
+					})
+					err := parsingutils.AddLinkWithBlock(sectHeader, "Reloff", relocs, "points to")
+					if err != nil {
+						return err
+					}
+					err = decodeRelocations(relocs, sect.Addr)
+					if err != nil {
+						return err
+					}
+				}
 				if sect.Offset != 0 {
 					sectData := me.addChild(segment, &contracts.MemoryBlock{
 						Name:         fmt.Sprintf("Section (%s)", sect.Name),
@@ -102,21 +220,11 @@ func (me *parser) addCommand(root, commands *contracts.MemoryBlock, i int, cmd m
 					case sect.Flags.IsLazySymbolPointers():
 						context.lazyPointerSections = append(context.lazyPointerSections, sect)
 					case sect.Flags.IsNonLazySymbolPointers():
-						// TODO: 8 byte per entry, don't know how to interpret this
+						context.nonLazyPointerSections = append(context.nonLazyPointerSections, sect)
 					case sect.Flags.IsInterposing():
-						// TODO: 2 pointers per entry, don't know how to interpret this
+						context.interposingSections = append(context.interposingSections, sect)
 					case sect.Flags.IsCstringLiterals():
-						for i := 0; i < int(sect.Size); {
-							addr := sectData.Address + uintptr(i)
-							str := parsingutils.ReadCString(io.NewSectionReader(context.header, int64(addr), int64(sect.Size)-int64(i)))
-							strBlock := me.addChild(sectData, &contracts.MemoryBlock{
-								Name:         fmt.Sprintf("%q", str),
-								Address:      addr,
-								Size:         uint64(len(str) + 1),
-								ParentOffset: uint64(addr) - uint64(sectData.Address),
-							})
-							i += int(strBlock.Size)
-						}
+						addCStrings(sect, sectData)
 					default:
 						switch sect.Name {
 						case "__info_plist":
@@ -127,6 +235,14 @@ func (me *parser) addCommand(root, commands *contracts.MemoryBlock, i int, cmd m
 								Size:         uint64(len(plist)),
 								ParentOffset: 0,
 							})
+						case "__swift5_reflstr":
+							addCStrings(sect, sectData)
+						default:
+							err := me.decodeObjCSection(context, root, sect, sectData)
+							if err != nil {
+								return err
+							}
+							me.decodeSwiftSection(context, root, sect)
 						}
 					}
 				}
@@ -136,23 +252,26 @@ func (me *parser) addCommand(root, commands *contracts.MemoryBlock, i int, cmd m
 		}
 	}
 
-	handleThread := func(threads []types.ThreadState) parseFn {
-		return func(block, header *contracts.MemoryBlock) error {
-			offset := header.Size
-			for i, thread := range threads {
-				block := me.addStruct(block, thread, fmt.Sprintf("Thread State %d", i+1), offset)
-				offset += block.Size
-				// FIXME: would be nice to have a link from PC/RIP
-			}
-			return nil
+	handleThread := func(block, header *contracts.MemoryBlock) error {
+		raw, err := readAt(context.header, header.Address+uintptr(header.Size), block.Size-header.Size)
+		if err != nil {
+			return fmt.Errorf("failed to read thread states: %w", err)
+		}
+		states, err := machoutils.ParseThreadState(raw, header.Address+uintptr(header.Size), machoutils.ThreadStateOptions{
+			CPU:       uint32(context.header.CPU),
+			ByteOrder: context.header.ByteOrder,
+			Resolve:   context.resolve,
+		})
+		if err != nil {
+			return err
 		}
+		me.addChild(block, states)
+		return nil
 	}
 
-	handleLEData := func(data types.LinkEditDataCmd) parseFn {
+	handleLEData := func(data types.LinkEditDataCmd, decode func(segment *contracts.MemoryBlock) error) parseFn {
+		// Object files don't have a __LINKEDIT segment but still use those commands (e.g. LC_DATA_IN_CODE)
 		return func(_block, header *contracts.MemoryBlock) error {
-			if context.linkEdit == nil {
-				return fmt.Errorf("no __LINKEDIT segment found")
-			}
 			segment := me.addChild(root, &contracts.MemoryBlock{
 				Name:         fmt.Sprintf("Segment (%s)", data.LoadCmd),
 				Address:      uintptr(data.Offset),
@@ -163,47 +282,286 @@ func (me *parser) addCommand(root, commands *contracts.MemoryBlock, i int, cmd m
 			if err != nil {
 				return err
 			}
+			if decode != nil && data.Size != 0 {
+				return decode(segment)
+			}
+			return nil
+		}
+	}
+
+	decodeCodeSignature := func(segment *contracts.MemoryBlock) error {
+		raw, err := readAt(context.header, segment.Address, segment.Size)
+		if err != nil {
+			return fmt.Errorf("failed to read code signature: %w", err)
+		}
+		signature, err := machoutils.ParseCodeSignature(raw, segment.Address, machoutils.CodeSignatureOptions{
+			PagesAddress: root.Address,
+			LinkPages:    true,
+			TooBig:       thresholdsArrayTooBig,
+		})
+		if err != nil {
+			return err
+		}
+		me.addDecoded(segment, signature)
+		return nil
+	}
+
+	decodeExportTrie := func(segment *contracts.MemoryBlock) error {
+		raw, err := readAt(context.header, segment.Address, segment.Size)
+		if err != nil {
+			return fmt.Errorf("failed to read export trie: %w", err)
+		}
+		base := imageBase(context.header)
+		trie, err := machoutils.ParseExportTrie(raw, segment.Address, machoutils.ExportTrieOptions{
+			Resolve: func(offset uint64) (uintptr, bool) {
+				return vmToOffset(context.header, base+offset)
+			},
+			TooBig: thresholdsArrayTooBig,
+		})
+		if err != nil {
+			return err
+		}
+		me.addDecoded(segment, trie)
+		return nil
+	}
+
+	decodeFunctionStarts := func(segment *contracts.MemoryBlock) error {
+		raw, err := readAt(context.header, segment.Address, segment.Size)
+		if err != nil {
+			return fmt.Errorf("failed to read function starts: %w", err)
+		}
+		symbols := sectionSymbols(context.header.Symtab)
+		tree, starts, err := machoutils.ParseFunctionStarts(raw, segment.Address, machoutils.FunctionStartsOptions{
+			Base: imageBase(context.header),
+			Resolve: func(vmAddr uint64) (uintptr, bool) {
+				return vmToOffset(context.header, vmAddr)
+			},
+			Symbol: func(vmAddr uint64) (string, bool) {
+				name, found := symbols[vmAddr]
+				return name, found
+			},
+			TooBig: thresholdsArrayTooBig,
+		})
+		if err != nil {
+			return err
+		}
+		me.addDecoded(segment, tree)
+
+		// Each function runs until the next one (or the end of its section), which gives a map of stripped binaries
+		for i, start := range starts {
+			section := context.header.FindSectionForVMAddr(start.Address)
+			offset, mapped := vmToOffset(context.header, start.Address)
+			if section == nil || !mapped {
+				continue
+			}
+			end := section.Addr + section.Size
+			if i+1 < len(starts) && starts[i+1].Address < end {
+				end = starts[i+1].Address
+			}
+			me.addChild(root, &contracts.MemoryBlock{
+				Name:         fmt.Sprintf("Function (%s)", start.Label()),
+				Address:      offset,
+				Size:         end - start.Address,
+				ParentOffset: uint64(offset) - uint64(root.Address),
+			})
+		}
+		return nil
+	}
+
+	decodeDataInCode := func(segment *contracts.MemoryBlock) error {
+		raw, err := readAt(context.header, segment.Address, segment.Size)
+		if err != nil {
+			return fmt.Errorf("failed to read data in code: %w", err)
+		}
+		tree, entries, err := machoutils.ParseDataInCode(raw, segment.Address, machoutils.DataInCodeOptions{
+			ByteOrder: context.header.ByteOrder,
+			Resolve: func(offset uint64) (uintptr, bool) {
+				return uintptr(offset), inSegment(context.header, offset, 0)
+			},
+			TooBig: thresholdsArrayTooBig,
+		})
+		if err != nil {
+			return err
+		}
+		me.addDecoded(segment, tree)
+
+		for _, entry := range entries {
+			if !inSegment(context.header, uint64(entry.Offset), uint64(entry.Length)) {
+				me.logger.Warnf("data in code entry at %#x is outside of the segments, skipping it", entry.Offset)
+				continue
+			}
+			me.addChild(root, &contracts.MemoryBlock{
+				Name:         entry.Label(),
+				Address:      uintptr(entry.Offset),
+				Size:         uint64(entry.Length),
+				ParentOffset: uint64(entry.Offset) - uint64(root.Address),
+			})
+		}
+		return nil
+	}
+
+	decodeChainedFixups := func(segment *contracts.MemoryBlock) error {
+		raw, err := readAt(context.header, segment.Address, segment.Size)
+		if err != nil {
+			return fmt.Errorf("failed to read chained fixups: %w", err)
+		}
+		segments := []machoutils.ChainedFixupsSegment{}
+		for _, seg := range context.header.Segments() {
+			data, err := readAt(context.header, uintptr(seg.Offset), seg.Filesz)
+			if err != nil {
+				return fmt.Errorf("failed to read segment %s: %w", seg.Name, err)
+			}
+			segments = append(segments, machoutils.ChainedFixupsSegment{
+				Name:    seg.Name,
+				Address: uintptr(seg.Offset),
+				Data:    data,
+			})
+		}
+		fixupsData, fixups, err := machoutils.ParseChainedFixups(raw, segment.Address, machoutils.ChainedFixupsOptions{
+			Segments:   segments,
+			WalkChains: true,
+			ImageBase:  imageBase(context.header),
+			Resolve: func(vmAddr uint64) (uintptr, bool) {
+				return vmToOffset(context.header, vmAddr)
+			},
+			TooBig: thresholdsArrayTooBig,
+		})
+		if err != nil {
+			return err
+		}
+		me.addDecoded(segment, fixupsData)
+		for _, fixup := range fixups {
+			me.addChild(root, fixup)
+		}
+		return nil
+	}
+
+	// Finds the symbol a pointer slot refers to, either through its bind or by matching its target address
+	resolvePointerSymbol := func(vmAddr uint64) int {
+		target, bind, err := readPointerAt(context.header, vmAddr)
+		if err != nil {
+			return -1
+		}
+		if bind != "" {
+			return findSymbol(context.symtab, func(sym macho.Symbol) bool {
+				return sym.Name == bind
+			})
+		}
+		return findSymbol(context.symtab, func(sym macho.Symbol) bool {
+			return sym.Value == target && sym.Sect != 0
+		})
+	}
+
+	decodeInterposing := func() error {
+		pointerSize := pointerSize(context.header)
+		entrySize := 2 * pointerSize
+		for _, sect := range context.interposingSections {
+			for i := range sect.Size / entrySize {
+				offset := uintptr(sect.Offset) + uintptr(i*entrySize)
+				vmAddr := sect.Addr + i*entrySize
+				names := [2]string{"unknown", "unknown"}
+				symbols := [2]int{}
+				for j := range symbols {
+					symbols[j] = resolvePointerSymbol(vmAddr + uint64(j)*pointerSize)
+					if symbols[j] != -1 {
+						names[j] = context.symtab.Syms[symbols[j]].Name
+					}
+				}
+				entry := &contracts.MemoryBlock{
+					Name:         fmt.Sprintf("Interpose %s -> %s", names[0], names[1]),
+					Address:      offset,
+					Size:         entrySize,
+					ParentOffset: uint64(offset) - uint64(root.Address),
+				}
+				for j, label := range []string{"Replacement", "Replacee"} {
+					addValue(entry, label, names[j], uint64(j)*pointerSize, uint8(pointerSize))
+					if symbols[j] == -1 {
+						continue
+					}
+					err := parsingutils.AddLinkWithAddr(entry, label, "refers to", context.symbols.Address+uintptr(uint64(symbols[j])*nlistSize(context.header)))
+					if err != nil {
+						return err
+					}
+				}
+				// Values have to be set before insertion, as they are used to order blocks with the same bounds
+				me.addChild(root, entry)
+			}
+		}
+		return nil
+	}
+
+	decodeDYLDInfo := func(stream machoutils.DYLDInfoStream) func(segment *contracts.MemoryBlock) error {
+		return func(segment *contracts.MemoryBlock) error {
+			raw, err := readAt(context.header, segment.Address, segment.Size)
+			if err != nil {
+				return fmt.Errorf("failed to read %s opcodes: %w", stream, err)
+			}
+			segments := []machoutils.DYLDInfoSegment{}
+			for _, seg := range context.header.Segments() {
+				segments = append(segments, machoutils.DYLDInfoSegment{
+					Name:    seg.Name,
+					Address: seg.Addr,
+				})
+			}
+			opcodes, err := machoutils.ParseDYLDInfoOpcodes(stream, raw, segment.Address, machoutils.DYLDInfoOptions{
+				Segments:    segments,
+				PointerSize: pointerSize(context.header),
+				Resolve: func(vmAddr uint64) (uintptr, bool) {
+					return vmToOffset(context.header, vmAddr)
+				},
+				TooBig: thresholdsArrayTooBig,
+			})
+			if err != nil {
+				return err
+			}
+			me.addDecoded(segment, opcodes)
 			return nil
 		}
 	}
 
-	handleDYLDInfo := func(realDIO *macho.DyldInfoOnly) parseFn {
+	handleDYLDInfo := func(realDIO types.DyldInfoCmd) parseFn {
 		return func(_block, header *contracts.MemoryBlock) error {
 			links := []struct {
-				name string
-				prop string
-				off  uint64
-				size uint64
+				name   string
+				prop   string
+				off    uint64
+				size   uint64
+				decode func(segment *contracts.MemoryBlock) error
 			}{
 				{
-					name: "Rebase",
-					prop: "RebaseOff",
-					off:  uint64(realDIO.RebaseOff),
-					size: uint64(realDIO.RebaseSize),
+					name:   "Rebase",
+					prop:   "RebaseOff",
+					off:    uint64(realDIO.RebaseOff),
+					size:   uint64(realDIO.RebaseSize),
+					decode: decodeDYLDInfo(machoutils.RebaseStream),
 				},
 				{
-					name: "Bind",
-					prop: "BindOff",
-					off:  uint64(realDIO.BindOff),
-					size: uint64(realDIO.BindSize),
+					name:   "Bind",
+					prop:   "BindOff",
+					off:    uint64(realDIO.BindOff),
+					size:   uint64(realDIO.BindSize),
+					decode: decodeDYLDInfo(machoutils.BindStream),
 				},
 				{
-					name: "WeakBind",
-					prop: "WeakBindOff",
-					off:  uint64(realDIO.WeakBindOff),
-					size: uint64(realDIO.WeakBindSize),
+					name:   "WeakBind",
+					prop:   "WeakBindOff",
+					off:    uint64(realDIO.WeakBindOff),
+					size:   uint64(realDIO.WeakBindSize),
+					decode: decodeDYLDInfo(machoutils.WeakBindStream),
 				},
 				{
-					name: "LazyBind",
-					prop: "LazyBindOff",
-					off:  uint64(realDIO.LazyBindOff),
-					size: uint64(realDIO.LazyBindSize),
+					name:   "LazyBind",
+					prop:   "LazyBindOff",
+					off:    uint64(realDIO.LazyBindOff),
+					size:   uint64(realDIO.LazyBindSize),
+					decode: decodeDYLDInfo(machoutils.LazyBindStream),
 				},
 				{
-					name: "Export",
-					prop: "ExportOff",
-					off:  uint64(realDIO.ExportOff),
-					size: uint64(realDIO.ExportSize),
+					name:   "Export",
+					prop:   "ExportOff",
+					off:    uint64(realDIO.ExportOff),
+					size:   uint64(realDIO.ExportSize),
+					decode: decodeExportTrie,
 				},
 			}
 			for _, link := range links {
@@ -220,6 +578,12 @@ func (me *parser) addCommand(root, commands *contracts.MemoryBlock, i int, cmd m
 				if err != nil {
 					return err
 				}
+				if link.decode != nil && link.size != 0 {
+					err = link.decode(segment)
+					if err != nil {
+						return err
+					}
+				}
 			}
 			return nil
 		}
@@ -227,11 +591,10 @@ func (me *parser) addCommand(root, commands *contracts.MemoryBlock, i int, cmd m
 
 	handleSymtab := func(realST *macho.Symtab) parseFn {
 		return func(_block, header *contracts.MemoryBlock) error {
-			// FIXME: assume 64bit
 			symbols := me.addChild(root, &contracts.MemoryBlock{
 				Name:         fmt.Sprintf("Symbols (%d)", realST.Nsyms),
 				Address:      uintptr(realST.Symoff),
-				Size:         uint64(realST.Nsyms) * uint64(unsafe.Sizeof(subcontracts.NList64{})),
+				Size:         uint64(realST.Nsyms) * nlistSize(context.header),
 				ParentOffset: uint64(realST.Symoff) - uint64(root.Address),
 			})
 			context.symbols = symbols
@@ -242,14 +605,22 @@ func (me *parser) addCommand(root, commands *contracts.MemoryBlock, i int, cmd m
 			}
 			offset := uint64(0)
 			for i, sym := range realST.Syms {
-				// FIXME: assume 64bit
-				nlist := subcontracts.NList64{
+				var nlist any = subcontracts.NList64{
 					NStrx:  0, // FIXME: unsupported because of the way they parse symbols
 					NType:  uint8(sym.Type),
 					NSect:  sym.Sect,
 					NDesc:  uint16(sym.Desc),
 					NValue: sym.Value,
 				}
+				if !is64Bit(context.header) {
+					nlist = subcontracts.NList{
+						NStrx:  0, // FIXME: unsupported because of the way they parse symbols
+						NType:  uint8(sym.Type),
+						NSect:  sym.Sect,
+						NDesc:  int16(sym.Desc),
+						NValue: uint32(sym.Value),
+					}
+				}
 				symBlock := me.addStruct(symbols, nlist, fmt.Sprintf("Symbol (%d)", i+1), offset)
 				addValue(symBlock, "Name", sym.Name, 0, 0)
 				// FIXME: impossible due to the way they parse symbols
@@ -280,7 +651,7 @@ func (me *parser) addCommand(root, commands *contracts.MemoryBlock, i int, cmd m
 				})
 				i += int(strBlock.Size)
 			}
-			return nil
+			return decodeInterposing()
 		}
 	}
 
@@ -318,8 +689,7 @@ func (me *parser) addCommand(root, commands *contracts.MemoryBlock, i int, cmd m
 				if isym.off == 0 && isym.len == 0 {
 					continue
 				}
-				// FIXME: assume 64bit
-				entrySize := uintptr(unsafe.Sizeof(subcontracts.NList64{}))
+				entrySize := uintptr(nlistSize(context.header))
 				segment := me.addChild(context.symbols, &contracts.MemoryBlock{
 					Name:         fmt.Sprintf("DSYM %s (%d)", isym.name, isym.len),
 					Address:      context.symbols.Address + uintptr(isym.off)*entrySize,
@@ -331,6 +701,10 @@ func (me *parser) addCommand(root, commands *contracts.MemoryBlock, i int, cmd m
 					return err
 				}
 			}
+			moduleSize := uint64(unsafe.Sizeof(types.DylibModule64{}))
+			if !is64Bit(context.header) {
+				moduleSize = uint64(unsafe.Sizeof(types.DylibModule{}))
+			}
 			eentries := []struct {
 				name   string
 				prop   string
@@ -346,15 +720,14 @@ func (me *parser) addCommand(root, commands *contracts.MemoryBlock, i int, cmd m
 					sizeOf: uint64(unsafe.Sizeof(types.DylibTableOfContents{})),
 				},
 				{
-					name: "Module Table",
-					prop: "Modtaboff",
-					off:  uint64(realDST.Modtaboff),
-					len:  uint64(realDST.Nmodtab),
-					// FIXME: assume 64bit
-					sizeOf: uint64(unsafe.Sizeof(types.DylibModule64{})),
+					name:   "Module Table",
+					prop:   "Modtaboff",
+					off:    uint64(realDST.Modtaboff),
+					len:    uint64(realDST.Nmodtab),
+					sizeOf: moduleSize,
 				},
 				{
-					name:   "External Relocations Table",
+					name:   "External References Table",
 					prop:   "Extrefsymoff",
 					off:    uint64(realDST.Extrefsymoff),
 					len:    uint64(realDST.Nextrefsyms),
@@ -368,18 +741,18 @@ func (me *parser) addCommand(root, commands *contracts.MemoryBlock, i int, cmd m
 					sizeOf: uint64(unsafe.Sizeof(types.DylibReference(0))),
 				},
 				{
-					name:   "External Symbols Table",
+					name:   "External Relocations Table",
 					prop:   "Extreloff",
 					off:    uint64(realDST.Extreloff),
 					len:    uint64(realDST.Nextrel),
-					sizeOf: uint64(unsafe.Sizeof(types.Reloc{})),
+					sizeOf: machoutils.RelocationInfoSize,
 				},
 				{
-					name:   "Local Symbols Table",
+					name:   "Local Relocations Table",
 					prop:   "Locreloff",
 					off:    uint64(realDST.Locreloff),
 					len:    uint64(realDST.Nlocrel),
-					sizeOf: uint64(unsafe.Sizeof(types.Reloc{})),
+					sizeOf: machoutils.RelocationInfoSize,
 				},
 			}
 			for _, entries := range eentries {
@@ -407,10 +780,10 @@ func (me *parser) addCommand(root, commands *contracts.MemoryBlock, i int, cmd m
 							ParentOffset: uint64(i) * entries.sizeOf,
 						})
 						addValue(entry, "Index", sym, 0, 0)
-						name := "not found"
+						name := indirectSymbolName(sym)
 						if sym < uint32(len(context.symtab.Syms)) {
 							name = context.symtab.Syms[sym].Name
-							err := parsingutils.AddLinkWithAddr(entry, "Index", "refers to", context.symbols.Address+uintptr(sym)*unsafe.Sizeof(subcontracts.NList64{}))
+							err := parsingutils.AddLinkWithAddr(entry, "Index", "refers to", context.symbols.Address+uintptr(uint64(sym)*nlistSize(context.header)))
 							if err != nil {
 								return err
 							}
@@ -418,6 +791,45 @@ func (me *parser) addCommand(root, commands *contracts.MemoryBlock, i int, cmd m
 						addValue(entry, "Name", name, 0, 0)
 						names[i] = name
 					}
+					// Indexed by symbol, so stubs can find the pointer they jump through (lazy ones take precedence)
+					type pointerSlot struct {
+						block   *contracts.MemoryBlock
+						address uint64
+					}
+					pointers := map[uint32]pointerSlot{}
+					addPointers := func(sections []*types.Section, label string) error {
+						pointerSize := pointerSize(context.header)
+						for _, sect := range sections {
+							indirectIndex := sect.Reserved1
+							numberOfPointers := sect.Size / pointerSize
+							if uint64(indirectIndex)+numberOfPointers > uint64(realDST.Nindirectsyms) {
+								return fmt.Errorf("invalid indirect symbol index in %s (%d vs %d)", sect.Name, uint64(indirectIndex)+numberOfPointers, realDST.Nindirectsyms)
+							}
+							for i := range numberOfPointers {
+								index := indirectIndex + uint32(i)
+								pointer := me.addChild(segment, &contracts.MemoryBlock{
+									Name:         fmt.Sprintf("%s for %s", label, names[index]),
+									Address:      uintptr(sect.Offset) + uintptr(i*pointerSize),
+									Size:         pointerSize,
+									ParentOffset: i * pointerSize,
+								})
+								address := sect.Addr + i*pointerSize
+								addValue(pointer, "Address", address, 0, 0)
+								if sym := realDST.IndirectSyms[index]; sym < uint32(len(context.symtab.Syms)) {
+									pointers[sym] = pointerSlot{block: pointer, address: address}
+								}
+							}
+						}
+						return nil
+					}
+					err := addPointers(context.nonLazyPointerSections, "Non-Lazy Pointer")
+					if err != nil {
+						return err
+					}
+					err = addPointers(context.lazyPointerSections, "Lazy Pointer")
+					if err != nil {
+						return err
+					}
 					for _, sect := range context.stubSections {
 						indirectIndex := sect.Reserved1
 						sizeOfStub := uint64(sect.Reserved2)
@@ -427,31 +839,28 @@ func (me *parser) addCommand(root, commands *contracts.MemoryBlock, i int, cmd m
 						}
 						for i := range numberOfStubs {
 							index := indirectIndex + uint32(i)
-							me.addChild(segment, &contracts.MemoryBlock{
+							stub := me.addChild(segment, &contracts.MemoryBlock{
 								Name:         fmt.Sprintf("Stub of %s", names[index]),
 								Address:      uintptr(sect.Offset) + uintptr(i*sizeOfStub),
 								Size:         sizeOfStub,
 								ParentOffset: i * sizeOfStub,
 							})
-							// TODO: how to add pointer to the lazy pointer section?
+							// Self-modifying stubs (e.g. i386 __jump_table) don't go through a pointer
+							pointer, found := pointers[realDST.IndirectSyms[index]]
+							if !found {
+								continue
+							}
+							addValue(stub, "Pointer", pointer.address, 0, 0)
+							err := parsingutils.AddLinkWithBlock(stub, "Pointer", pointer.block, "jumps through")
+							if err != nil {
+								return err
+							}
 						}
 					}
-					for _, sect := range context.lazyPointerSections {
-						indirectIndex := sect.Reserved1
-						pointerSize := uint64(8) // TODO: assume 64bit
-						numberOfPointers := sect.Size / uint64(pointerSize)
-						if uint64(indirectIndex)+numberOfPointers > uint64(realDST.Nindirectsyms) {
-							return fmt.Errorf("invalid indirect symbol index in %s (%d vs %d)", sect.Name, uint64(indirectIndex)+numberOfPointers, realDST.Nindirectsyms)
-						}
-						for i := range numberOfPointers {
-							index := indirectIndex + uint32(i)
-							me.addChild(segment, &contracts.MemoryBlock{
-								Name:         fmt.Sprintf("Lazy Pointer for %s", names[index]),
-								Address:      uintptr(sect.Offset) + uintptr(i*pointerSize),
-								Size:         uint64(pointerSize),
-								ParentOffset: i * uint64(pointerSize),
-							})
-						}
+				case "Extreloff", "Locreloff":
+					err := decodeRelocations(segment, relocationBase(context.header))
+					if err != nil {
+						return err
 					}
 				default:
 					// TODO: add details for each entry
@@ -461,6 +870,58 @@ func (me *parser) addCommand(root, commands *contracts.MemoryBlock, i int, cmd m
 		}
 	}
 
+	// Segments of fileset entries use offsets in the whole collection, so unlike FAT arches they are not rebased
+	handleFilesetEntry := func(realEntry *macho.FilesetEntry) parseFn {
+		return func(block, header *contracts.MemoryBlock) error {
+			entry, err := context.header.GetFileSetFileByName(realEntry.EntryID)
+			if err != nil {
+				return fmt.Errorf("failed to open fileset entry %s: %w", realEntry.EntryID, err)
+			}
+			entryBlock := &contracts.MemoryBlock{
+				Name:         fmt.Sprintf("Fileset Entry (%s)", realEntry.EntryID),
+				Address:      uintptr(realEntry.FileOffset),
+				Size:         machHeaderSize(entry) + uint64(entry.SizeCommands),
+				ParentOffset: realEntry.FileOffset - uint64(root.Address),
+			}
+			err = me.addHeader(entryBlock, entry, nil)
+			if err != nil {
+				return fmt.Errorf("failed to parse fileset entry %s: %w", realEntry.EntryID, err)
+			}
+			me.addChild(root, entryBlock)
+			return parsingutils.AddLinkWithBlock(header, "FileOffset", entryBlock, "points to")
+		}
+	}
+
+	handleNote := func(note *macho.Note) parseFn {
+		return func(_block, header *contracts.MemoryBlock) error {
+			owner := commons.FromCString(note.DataOwner[:])
+			noteData := me.addChild(root, &contracts.MemoryBlock{
+				Name:         fmt.Sprintf("Note (%s)", owner),
+				Address:      uintptr(note.Offset),
+				Size:         note.Size,
+				ParentOffset: note.Offset - uint64(root.Address),
+			})
+			err := parsingutils.AddLinkWithBlock(header, "Offset", noteData, "points to")
+			if err != nil {
+				return err
+			}
+			tree, images, err := machoutils.ParseNote(owner, note.Data, noteData.Address, machoutils.NoteOptions{
+				ByteOrder: context.header.ByteOrder,
+				Resolve:   context.resolve,
+			})
+			if err != nil {
+				return fmt.Errorf("failed to parse note %q: %w", owner, err)
+			}
+			if tree != nil {
+				me.addDecoded(noteData, tree)
+			}
+			if context.core != nil {
+				context.core.images = append(context.core.images, images...)
+			}
+			return nil
+		}
+	}
+
 	switch cmd.Command() {
 	case types.LC_REQ_DYLD:
 		return nil, fmt.Errorf("binary contains LC_REQ_DYLD which is not supported")
@@ -470,6 +931,20 @@ func (me *parser) addCommand(root, commands *contracts.MemoryBlock, i int, cmd m
 		headerSize = uint64(unsafe.Sizeof(types.Segment32{}))
 		if realSeg.Command() == types.LC_SEGMENT_64 {
 			headerSize = uint64(unsafe.Sizeof(types.Segment64{}))
+		} else {
+			data = segmentHeader32{
+				LoadCmd: realSeg.LoadCmd,
+				Len:     realSeg.Len,
+				Name:    realSeg.Name,
+				Addr:    uint32(realSeg.Addr),
+				Memsz:   uint32(realSeg.Memsz),
+				Offset:  uint32(realSeg.Offset),
+				Filesz:  uint32(realSeg.Filesz),
+				Maxprot: realSeg.Maxprot,
+				Prot:    realSeg.Prot,
+				Nsect:   realSeg.Nsect,
+				Flag:    realSeg.Flag,
+			}
 		}
 		postParsing = handleSegment(realSeg, headerSize)
 		banned = append(banned, "Firstsect") // FIXME: header is badly defined
@@ -484,11 +959,11 @@ func (me *parser) addCommand(root, commands *contracts.MemoryBlock, i int, cmd m
 	case types.LC_THREAD:
 		realSeg := cmd.(*macho.Thread)
 		data = realSeg.ThreadCmd
-		postParsing = handleThread(realSeg.Threads)
+		postParsing = handleThread
 	case types.LC_UNIXTHREAD:
 		realSeg := cmd.(*macho.UnixThread)
 		data = realSeg.ThreadCmd
-		postParsing = handleThread(realSeg.Threads)
+		postParsing = handleThread
 	case types.LC_LOADFVMLIB:
 		realSeg := cmd.(*macho.LoadFvmlib)
 		data = *realSeg // .LoadFvmLibCmd // FIXME: technically should use the sub struct but it's nice to get the Name for free
@@ -583,11 +1058,11 @@ func (me *parser) addCommand(root, commands *contracts.MemoryBlock, i int, cmd m
 	case types.LC_CODE_SIGNATURE:
 		realSeg := cmd.(*macho.CodeSignature)
 		data = realSeg.CodeSignatureCmd
-		postParsing = handleLEData(types.LinkEditDataCmd(realSeg.CodeSignatureCmd))
+		postParsing = handleLEData(types.LinkEditDataCmd(realSeg.CodeSignatureCmd), decodeCodeSignature)
 	case types.LC_SEGMENT_SPLIT_INFO:
 		realSeg := cmd.(*macho.SplitInfo)
 		data = realSeg.SegmentSplitInfoCmd
-		postParsing = handleLEData(types.LinkEditDataCmd(realSeg.SegmentSplitInfoCmd))
+		postParsing = handleLEData(types.LinkEditDataCmd(realSeg.SegmentSplitInfoCmd), nil)
 	case types.LC_REEXPORT_DYLIB:
 		realSeg := cmd.(*macho.ReExportDylib)
 		data = *realSeg // .DylibCmd // FIXME: technically should use the sub struct but it's nice to get the Name for free
@@ -603,22 +1078,32 @@ func (me *parser) addCommand(root, commands *contracts.MemoryBlock, i int, cmd m
 	case types.LC_DYLD_INFO:
 		realSeg := cmd.(*macho.DyldInfo)
 		data = realSeg.DyldInfoCmd
-		postParsing = handleUnused
+		postParsing = handleDYLDInfo(realSeg.DyldInfoCmd)
 	case types.LC_DYLD_INFO_ONLY:
 		realSeg := cmd.(*macho.DyldInfoOnly)
 		data = realSeg.DyldInfoCmd
-		postParsing = handleDYLDInfo(realSeg)
+		postParsing = handleDYLDInfo(realSeg.DyldInfoCmd)
 	case types.LC_LOAD_UPWARD_DYLIB:
 		realSeg := cmd.(*macho.UpwardDylib)
 		data = *realSeg // .DylibCmd // FIXME: technically should use the sub struct but it's nice to get the Name for free
 		headerSize = size
 	case types.LC_VERSION_MIN_MACOSX, types.LC_VERSION_MIN_IPHONEOS, types.LC_VERSION_MIN_TVOS, types.LC_VERSION_MIN_WATCHOS:
-		realSeg := cmd.(*macho.VersionMin)
-		data = realSeg.VersionMinCmd
+		switch realSeg := cmd.(type) {
+		case *macho.VersionMinMacOSX:
+			data = realSeg.VersionMinCmd
+		case *macho.VersionMiniPhoneOS:
+			data = realSeg.VersionMinCmd
+		case *macho.VersionMinTvOS:
+			data = realSeg.VersionMinCmd
+		case *macho.VersionMinWatchOS:
+			data = realSeg.VersionMinCmd
+		default:
+			return nil, fmt.Errorf("unexpected type %T for %s", cmd, cmd.Command())
+		}
 	case types.LC_FUNCTION_STARTS:
 		realSeg := cmd.(*macho.FunctionStarts)
 		data = realSeg.LinkEditDataCmd
-		postParsing = handleLEData(realSeg.LinkEditDataCmd)
+		postParsing = handleLEData(realSeg.LinkEditDataCmd, decodeFunctionStarts)
 	case types.LC_DYLD_ENVIRONMENT:
 		realSeg := cmd.(*macho.DyldEnvironment)
 		data = *realSeg // .DylinkerCmd // FIXME: technically should use the sub struct but it's nice to get the Name for free
@@ -630,19 +1115,19 @@ func (me *parser) addCommand(root, commands *contracts.MemoryBlock, i int, cmd m
 			if context.text == nil {
 				return fmt.Errorf("no __TEXT segment found")
 			}
-			return parsingutils.AddLinkWithAddr(header, "EntryOffset", "points to", context.text.Address+uintptr(realSeg.EntryOffset))
+			return parsingutils.AddLinkWithAddr(header, "EntryOffset", "starts at", context.text.Address+uintptr(realSeg.EntryOffset))
 		}
 	case types.LC_DATA_IN_CODE:
 		realSeg := cmd.(*macho.DataInCode)
 		data = realSeg.DataInCodeCmd
-		postParsing = handleLEData(types.LinkEditDataCmd(realSeg.DataInCodeCmd))
+		postParsing = handleLEData(types.LinkEditDataCmd(realSeg.DataInCodeCmd), decodeDataInCode)
 	case types.LC_SOURCE_VERSION:
 		realSeg := cmd.(*macho.SourceVersion)
 		data = realSeg.SourceVersionCmd
 	case types.LC_DYLIB_CODE_SIGN_DRS:
 		realSeg := cmd.(*macho.DylibCodeSignDrs)
 		data = realSeg.LinkEditDataCmd
-		postParsing = handleLEData(realSeg.LinkEditDataCmd)
+		postParsing = handleLEData(realSeg.LinkEditDataCmd, nil)
 	case types.LC_ENCRYPTION_INFO_64:
 		realSeg := cmd.(*macho.EncryptionInfo64)
 		data = realSeg.EncryptionInfo64Cmd
@@ -655,28 +1140,35 @@ func (me *parser) addCommand(root, commands *contracts.MemoryBlock, i int, cmd m
 	case types.LC_LINKER_OPTIMIZATION_HINT:
 		realSeg := cmd.(*macho.LinkerOptimizationHint)
 		data = realSeg.LinkEditDataCmd
-		postParsing = handleLEData(realSeg.LinkEditDataCmd)
+		postParsing = handleLEData(realSeg.LinkEditDataCmd, nil)
 	case types.LC_NOTE:
 		realSeg := cmd.(*macho.Note)
 		data = realSeg.NoteCmd
-		postParsing = handleUnused
+		postParsing = handleNote(realSeg)
 	case types.LC_BUILD_VERSION:
 		realSeg := cmd.(*macho.BuildVersion)
-		data = *realSeg // .BuildVersionCmd // FIXME: technically should use the sub struct but it's nice to get the Name for free
-		headerSize = size
+		data = realSeg.BuildVersionCmd
+		postParsing = func(block, header *contracts.MemoryBlock) error {
+			offset := header.Size
+			for _, tool := range realSeg.Tools {
+				toolBlock := me.addStruct(block, tool, fmt.Sprintf("Tool (%s)", machoutils.ToolName(uint32(tool.Tool))), offset)
+				offset += toolBlock.Size
+			}
+			return nil
+		}
 	case types.LC_DYLD_EXPORTS_TRIE:
 		realSeg := cmd.(*macho.DyldExportsTrie)
 		data = realSeg.LinkEditDataCmd
-		postParsing = handleLEData(realSeg.LinkEditDataCmd)
+		postParsing = handleLEData(realSeg.LinkEditDataCmd, decodeExportTrie)
 	case types.LC_DYLD_CHAINED_FIXUPS:
 		realSeg := cmd.(*macho.DyldChainedFixups)
 		data = realSeg.LinkEditDataCmd
-		postParsing = handleLEData(realSeg.LinkEditDataCmd)
+		postParsing = handleLEData(realSeg.LinkEditDataCmd, decodeChainedFixups)
 	case types.LC_FILESET_ENTRY:
 		realSeg := cmd.(*macho.FilesetEntry)
 		data = *realSeg // .FilesetEntryCmd // FIXME: technically should use the sub struct but it's nice to get the Name for free
 		headerSize = size
-		postParsing = handleUnused
+		postParsing = handleFilesetEntry(realSeg)
 	default:
 		return nil, fmt.Errorf("unknown command %#x", cmd.Command())
 	}
@@ -0,0 +1,306 @@
+package macho
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"path/filepath"
+	"sort"
+
+	"github.com/LouisBrunner/mem-viz/pkg/contracts"
+	"github.com/LouisBrunner/mem-viz/pkg/dsc-viz/fetch"
+	"github.com/LouisBrunner/mem-viz/pkg/dsc-viz/parse"
+	"github.com/LouisBrunner/mem-viz/pkg/machoutils"
+	"github.com/LouisBrunner/mem-viz/pkg/parsingutils"
+	"github.com/blacktop/go-macho"
+	"github.com/blacktop/go-macho/types"
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
+)
+
+// Core files have no sections and map their segments at absolute VM addresses, so they are laid out by VM address instead
+// (the header, the load commands and the notes aren't mapped and stay at their file offsets)
+type coreLayout struct {
+	// VM address space of the process, backed by the segments saved in the file
+	mem *mappedReader
+	// Blocks of the segments, by VM address
+	blocks []*contracts.MemoryBlock
+	// Binaries described by the notes
+	images []machoutils.CoreImage
+}
+
+// Returns nil if the core can't be laid out by VM address because its segments would overlap its headers
+func (me *parser) newCoreLayout(m *macho.File) *coreLayout {
+	headersEnd := machHeaderSize(m) + uint64(m.SizeCommands)
+	for _, load := range m.Loads {
+		if note, ok := load.(*macho.Note); ok {
+			headersEnd = max(headersEnd, note.Offset+note.Size)
+		}
+	}
+
+	core := &coreLayout{mem: &mappedReader{r: m}}
+	for _, seg := range m.Segments() {
+		if seg.Filesz == 0 {
+			continue
+		}
+		if seg.Addr < headersEnd {
+			me.logger.Warnf("segment at %#x overlaps the headers of the core, laying it out by file offset", seg.Addr)
+			return nil
+		}
+		core.mem.mappings = append(core.mem.mappings, mapping{from: seg.Addr, to: seg.Offset, size: seg.Filesz})
+	}
+	core.mem.sort()
+	return core
+}
+
+// Segments of cores are usually unnamed, so they are named after their bounds instead
+func (me *parser) addCoreSegment(root, header *contracts.MemoryBlock, seg *macho.Segment, core *coreLayout) error {
+	if seg.Filesz == 0 {
+		return nil
+	}
+	name := seg.Name
+	if name == "" {
+		name = fmt.Sprintf("%#x-%#x %s", seg.Addr, seg.Addr+seg.Memsz, seg.Prot)
+	}
+	segment := me.addChild(root, &contracts.MemoryBlock{
+		Name:         fmt.Sprintf("Segment (%s)", name),
+		Address:      uintptr(seg.Addr),
+		Size:         seg.Filesz,
+		ParentOffset: seg.Addr - uint64(root.Address),
+	})
+	core.blocks = append(core.blocks, segment)
+	return parsingutils.AddLinkWithBlock(header, "Addr", segment, "points to")
+}
+
+// Segments are shown where they are mapped, so VM addresses only need to be checked
+func (me *coreLayout) resolve(vmAddr uint64) (uintptr, bool) {
+	_, _, found := me.mem.translate(vmAddr)
+	return uintptr(vmAddr), found
+}
+
+// Binaries and the DSC are found through the notes and at the start of the segments, then parsed like standalone files
+func (me *parser) addCoreContent(root *contracts.MemoryBlock, core *coreLayout) {
+	cacheStart, cacheEnd := me.addCoreCache(root, core)
+
+	names := map[uint64]string{}
+	for _, mapped := range core.mem.mappings {
+		magic := make([]byte, 4)
+		_, err := core.mem.ReadAt(magic, int64(mapped.from))
+		if err == nil && isMachO(magic) {
+			names[mapped.from] = ""
+		}
+	}
+	for _, image := range core.images {
+		if image.LoadAddress != machoutils.NoteUnknownAddress {
+			names[image.LoadAddress] = image.Path
+		}
+	}
+	addresses := maps.Keys(names)
+	slices.Sort(addresses)
+
+	for _, address := range addresses {
+		if cacheStart <= address && address < cacheEnd {
+			continue
+		}
+		err := me.addCoreImage(root, core, address, names[address])
+		if err != nil {
+			me.logger.Warnf("failed to parse image at %#x: %v", address, err)
+		}
+	}
+}
+
+func isMachO(magic []byte) bool {
+	value := types.Magic(binary.LittleEndian.Uint32(magic))
+	return value == types.Magic32 || value == types.Magic64
+}
+
+// The main cache is the first segment starting with its magic (sub caches are found through it),
+// it replaces the segments it covers and returns its bounds (empty if it wasn't found)
+func (me *parser) addCoreCache(root *contracts.MemoryBlock, core *coreLayout) (uint64, uint64) {
+	for _, mapped := range core.mem.mappings {
+		magic := make([]byte, 7)
+		_, err := core.mem.ReadAt(magic, int64(mapped.from))
+		if err != nil || !bytes.Equal(magic, []byte("dyld_v1")) {
+			continue
+		}
+		fetcher, err := fetch.FromReader(me.logger, core.mem, uintptr(mapped.from))
+		if err != nil {
+			me.logger.Warnf("failed to load the DSC at %#x: %v", mapped.from, err)
+			continue
+		}
+		tree, err := parse.Parse(me.logger, fetcher)
+		if closeErr := fetcher.Close(); closeErr != nil {
+			me.logger.Errorf("failed to close DSC fetcher: %v", closeErr)
+		}
+		if err != nil {
+			me.logger.Warnf("failed to parse the DSC at %#x: %v", mapped.from, err)
+			continue
+		}
+
+		start, end := uint64(tree.Address), uint64(tree.Address)+tree.GetSize()
+		for _, block := range core.blocks {
+			if uint64(block.Address) < end && start < uint64(block.Address)+block.Size {
+				me.removeBlock(block)
+			}
+		}
+		me.addChild(root, tree)
+		return start, end
+	}
+	return 0, 0
+}
+
+// Parses the binary mapped at address as if it was a file, its blocks are then moved to where each segment is mapped
+func (me *parser) addCoreImage(root *contracts.MemoryBlock, core *coreLayout, address uint64, path string) error {
+	headers := io.NewSectionReader(core.mem, int64(address), math.MaxInt64-int64(address))
+	layout, err := macho.NewFile(headers, macho.FileConfig{
+		LoadIncluding: []types.LoadCmd{types.LC_SEGMENT, types.LC_SEGMENT_64},
+	})
+	if err != nil {
+		return err
+	}
+	// Their LinkEdit is shared with the rest of the cache, so they can only be parsed as part of it
+	if layout.Flags.DylibInCache() {
+		me.logger.Debugf("skipping image at %#x which is part of a DSC", address)
+		return nil
+	}
+
+	image := &mappedReader{r: core.mem}
+	slide, found := uint64(0), false
+	for _, seg := range layout.Segments() {
+		if seg.Offset == 0 && seg.Filesz != 0 {
+			slide, found = address-seg.Addr, true
+		}
+	}
+	if !found {
+		return fmt.Errorf("no segment contains the header")
+	}
+	for _, seg := range layout.Segments() {
+		// Some segments are not loaded at all (e.g. __DWARF in Go binaries has no VM size)
+		if size := min(seg.Filesz, seg.Memsz); size != 0 {
+			image.mappings = append(image.mappings, mapping{from: seg.Offset, to: seg.Addr + slide, size: size})
+		}
+	}
+	image.sort()
+
+	m, err := macho.NewFile(image)
+	if err != nil {
+		return err
+	}
+	name := filepath.Base(path)
+	if path == "" {
+		name = fmt.Sprintf("%#x", address)
+		if id := m.DylibID(); id != nil {
+			name = filepath.Base(id.Name)
+		}
+	}
+
+	sub := &parser{
+		logger:    me.logger,
+		allBlocks: make(map[uintptr]*[]*contracts.MemoryBlock),
+	}
+	imageBlock := sub.addChild(nil, &contracts.MemoryBlock{
+		Name: fmt.Sprintf("Image (%s)", name),
+		Size: machHeaderSize(m) + uint64(m.SizeCommands),
+	})
+	err = sub.addHeader(imageBlock, m, nil)
+	if err != nil {
+		return err
+	}
+	for _, sameAddress := range sub.allBlocks {
+		for _, block := range *sameAddress {
+			me.addCoreImageBlock(root, core, image, block)
+		}
+	}
+	return nil
+}
+
+// Blocks are moved with their segment, the ones which are not (entirely) saved in the core are dropped
+func (me *parser) addCoreImageBlock(root *contracts.MemoryBlock, core *coreLayout, image *mappedReader, block *contracts.MemoryBlock) {
+	target, left, found := image.translate(uint64(block.Address))
+	if !found || block.GetSize() > left {
+		me.logger.Debugf("dropping %s which is not mapped", block.Name)
+		return
+	}
+	_, left, found = core.mem.translate(target)
+	if !found || block.GetSize() > left {
+		me.logger.Debugf("dropping %s which is not saved in the core", block.Name)
+		return
+	}
+	moveBlock(block, target-uint64(block.Address), image)
+	me.addChild(root, block)
+}
+
+func moveBlock(block *contracts.MemoryBlock, delta uint64, image *mappedReader) {
+	block.Address += uintptr(delta)
+	for _, child := range block.Content {
+		moveBlock(child, delta, image)
+	}
+	for _, value := range block.Values {
+		links := value.Links[:0]
+		for _, link := range value.Links {
+			target, _, found := image.translate(link.TargetAddress)
+			if found {
+				link.TargetAddress = target
+				links = append(links, link)
+			}
+		}
+		value.Links = links
+	}
+}
+
+func (me *parser) removeBlock(block *contracts.MemoryBlock) {
+	sameAddress := me.allBlocks[block.Address]
+	*sameAddress = slices.DeleteFunc(*sameAddress, func(curr *contracts.MemoryBlock) bool {
+		return curr == block
+	})
+}
+
+// A range of a virtual space backed by a reader
+type mapping struct {
+	from uint64
+	to   uint64
+	size uint64
+}
+
+// Reads a virtual space made of ranges of another reader (e.g. the VM addresses of a core file)
+type mappedReader struct {
+	r        io.ReaderAt
+	mappings []mapping
+}
+
+func (me *mappedReader) sort() {
+	sort.Slice(me.mappings, func(i, j int) bool {
+		return me.mappings[i].from < me.mappings[j].from
+	})
+}
+
+// Returns where the address is in the underlying reader and how many bytes are left in its range
+func (me *mappedReader) translate(addr uint64) (uint64, uint64, bool) {
+	i := sort.Search(len(me.mappings), func(i int) bool {
+		return me.mappings[i].from+me.mappings[i].size > addr
+	})
+	if i == len(me.mappings) || me.mappings[i].from > addr {
+		return 0, 0, false
+	}
+	found := me.mappings[i]
+	return found.to + addr - found.from, found.from + found.size - addr, true
+}
+
+func (me *mappedReader) ReadAt(p []byte, off int64) (int, error) {
+	read := 0
+	for read < len(p) {
+		addr := uint64(off) + uint64(read)
+		target, left, found := me.translate(addr)
+		if !found {
+			return read, fmt.Errorf("%#x is not mapped", addr)
+		}
+		n, err := me.r.ReadAt(p[read:read+int(min(left, uint64(len(p)-read)))], int64(target))
+		read += n
+		if err != nil {
+			return read, err
+		}
+	}
+	return read, nil
+}
@@ -0,0 +1,186 @@
+package macho
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"testing"
+
+	"github.com/LouisBrunner/mem-viz/pkg/contracts"
+	"github.com/LouisBrunner/mem-viz/pkg/machoutils/machotest"
+	"github.com/blacktop/go-macho"
+	"github.com/blacktop/go-macho/types"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/exp/maps"
+)
+
+// 0x1000-0x1110 is contiguous but backed by two ranges, 0x2000-0x2080 is after a gap
+func testMappedReader() *mappedReader {
+	data := make([]byte, 0x500)
+	for i := range data {
+		data[i] = byte(i % 251)
+	}
+	reader := &mappedReader{r: bytes.NewReader(data), mappings: []mapping{
+		{from: 0x2000, to: 0x200, size: 0x80},
+		{from: 0x1100, to: 0x400, size: 0x10},
+		{from: 0x1000, to: 0x10, size: 0x100},
+	}}
+	reader.sort()
+	return reader
+}
+
+func Test_mappedReader_translate(t *testing.T) {
+	reader := testMappedReader()
+	cases := map[string]struct {
+		addr         uint64
+		target, left uint64
+		found        bool
+	}{
+		"before":     {addr: 0xfff},
+		"start":      {addr: 0x1000, target: 0x10, left: 0x100, found: true},
+		"middle":     {addr: 0x1080, target: 0x90, left: 0x80, found: true},
+		"last byte":  {addr: 0x10ff, target: 0x10f, left: 1, found: true},
+		"next range": {addr: 0x1100, target: 0x400, left: 0x10, found: true},
+		"gap":        {addr: 0x1110},
+		"after gap":  {addr: 0x2010, target: 0x210, left: 0x70, found: true},
+		"after":      {addr: 0x2080},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			target, left, found := reader.translate(c.addr)
+			assert.Equal(t, c.found, found)
+			assert.Equal(t, c.target, target)
+			assert.Equal(t, c.left, left)
+		})
+	}
+}
+
+func Test_mappedReader_ReadAt(t *testing.T) {
+	reader := testMappedReader()
+	backing := make([]byte, 0x500)
+	_, err := reader.r.ReadAt(backing, 0)
+	require.NoError(t, err)
+
+	cases := map[string]struct {
+		off      int64
+		size     int
+		expected []byte
+		fails    bool
+	}{
+		"inside":      {off: 0x1010, size: 0x10, expected: backing[0x20:0x30]},
+		"across":      {off: 0x10f8, size: 0x10, expected: append(bytes.Clone(backing[0x108:0x110]), backing[0x400:0x408]...)},
+		"into gap":    {off: 0x1108, size: 0x10, expected: backing[0x408:0x410], fails: true},
+		"not mapped":  {off: 0x1800, size: 4, expected: []byte{}, fails: true},
+		"whole range": {off: 0x2000, size: 0x80, expected: backing[0x200:0x280]},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			p := make([]byte, c.size)
+			n, err := reader.ReadAt(p, c.off)
+			if c.fails {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, c.expected, p[:n])
+		})
+	}
+
+	// The underlying reader can be shorter than its mappings
+	reader.mappings = append(reader.mappings, mapping{from: 0x3000, to: 0x4f0, size: 0x100})
+	p := make([]byte, 0x20)
+	n, err := reader.ReadAt(p, 0x3000)
+	assert.ErrorIs(t, err, io.EOF)
+	assert.Equal(t, 0x10, n)
+}
+
+func Test_newCoreLayout(t *testing.T) {
+	le := binary.LittleEndian
+	// The note is at 0x800-0x900, after the load commands
+	note := machotest.Command(le, types.LC_NOTE, 0, 0, 0, 0, 0x800, 0, 0x100, 0)
+	cases := map[string]struct {
+		segments []machotest.Segment
+		mappings []mapping
+	}{
+		"by VM address": {
+			segments: []machotest.Segment{
+				{Name: "", Addr: 0x3000, Size: 0x1000, Offset: 0x1000, FileSz: 0x100},
+				{Name: "", Addr: 0x5000, Size: 0x1000, Offset: 0x900, FileSz: 0},
+				{Name: "", Addr: 0x900, Size: 0x100, Offset: 0x1100, FileSz: 0x100},
+			},
+			mappings: []mapping{{from: 0x900, to: 0x1100, size: 0x100}, {from: 0x3000, to: 0x1000, size: 0x100}},
+		},
+		"overlaps the notes": {
+			segments: []machotest.Segment{
+				{Name: "", Addr: 0x3000, Size: 0x1000, Offset: 0x1000, FileSz: 0x100},
+				{Name: "", Addr: 0x8ff, Size: 0x100, Offset: 0x1100, FileSz: 0x100},
+			},
+		},
+		"overlaps the header": {
+			segments: []machotest.Segment{
+				{Name: "", Addr: 0, Size: 0x1000, Offset: 0x1000, FileSz: 0x100},
+			},
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			m, err := macho.NewFile(bytes.NewReader(machotest.MachO32(le, types.CPUI386, 0x1200, c.segments, note)))
+			require.NoError(t, err)
+			me := &parser{logger: logrus.New()}
+			core := me.newCoreLayout(m)
+			if c.mappings == nil {
+				assert.Nil(t, core)
+				return
+			}
+			require.NotNil(t, core)
+			assert.Equal(t, c.mappings, core.mem.mappings)
+		})
+	}
+}
+
+func Test_addCoreImageBlock(t *testing.T) {
+	// The image has its __TEXT at 0x100000 and its __DATA at 0x200000 (of which only 0x80 bytes are saved)
+	core := &coreLayout{mem: &mappedReader{mappings: []mapping{
+		{from: 0x100000, to: 0x4000, size: 0x1000},
+		{from: 0x200000, to: 0x5000, size: 0x80},
+	}}}
+	image := &mappedReader{r: core.mem, mappings: []mapping{
+		{from: 0, to: 0x100000, size: 0x1000},
+		{from: 0x1000, to: 0x200000, size: 0x100},
+	}}
+
+	newBlock := func(name string, address uintptr, size uint64) *contracts.MemoryBlock {
+		return &contracts.MemoryBlock{Name: name, Address: address, Size: size}
+	}
+	text := newBlock("text", 0x10, 0x20)
+	child := newBlock("child", 0x18, 0x8)
+	text.Content = []*contracts.MemoryBlock{child}
+	text.Values = []*contracts.MemoryValue{
+		{Name: "Data", Links: []*contracts.MemoryLink{{Name: "points to", TargetAddress: 0x1010}}},
+		{Name: "Other", Links: []*contracts.MemoryLink{{Name: "points to", TargetAddress: 0x5000}, {Name: "refers to", TargetAddress: 0x20}}},
+	}
+	child.Values = []*contracts.MemoryValue{
+		{Name: "Self", Links: []*contracts.MemoryLink{{Name: "points to", TargetAddress: 0x18}}},
+	}
+
+	me := &parser{logger: logrus.New(), allBlocks: map[uintptr]*[]*contracts.MemoryBlock{}}
+	root := newBlock("core", 0, 0)
+	for _, block := range []*contracts.MemoryBlock{
+		text,
+		newBlock("across segments", 0xff0, 0x20),
+		newBlock("not saved", 0x1070, 0x20),
+		newBlock("not mapped", 0x3000, 0x10),
+	} {
+		me.addCoreImageBlock(root, core, image, block)
+	}
+
+	assert.Equal(t, []uintptr{0x100010}, maps.Keys(me.allBlocks))
+	assert.Equal(t, []*contracts.MemoryBlock{text}, *me.allBlocks[0x100010])
+	assert.Equal(t, uintptr(0x100018), child.Address)
+	// Links are moved like the blocks, the ones to unmapped addresses are dropped
+	assert.Equal(t, []*contracts.MemoryLink{{Name: "points to", TargetAddress: 0x200010}}, text.Values[0].Links)
+	assert.Equal(t, []*contracts.MemoryLink{{Name: "refers to", TargetAddress: 0x100020}}, text.Values[1].Links)
+	assert.Equal(t, []*contracts.MemoryLink{{Name: "points to", TargetAddress: 0x100018}}, child.Values[0].Links)
+}
@@ -0,0 +1,21 @@
+package macho
+
+import (
+	"github.com/LouisBrunner/mem-viz/pkg/machoutils"
+	"github.com/LouisBrunner/mem-viz/pkg/parsingutils"
+	"github.com/blacktop/go-macho/types"
+)
+
+// go-macho already has String methods for most of those but they drop parts of the versions (e.g. 14.0.1 is shown as 14)
+func init() {
+	parsingutils.RegisterFieldFormat(types.DylibCmd{}, "CurrentVersion", machoutils.VersionFormat)
+	parsingutils.RegisterFieldFormat(types.DylibCmd{}, "CompatVersion", machoutils.VersionFormat)
+	parsingutils.RegisterFieldFormat(types.VersionMinCmd{}, "Version", machoutils.VersionFormat)
+	parsingutils.RegisterFieldFormat(types.VersionMinCmd{}, "Sdk", machoutils.VersionFormat)
+	parsingutils.RegisterFieldFormat(types.BuildVersionCmd{}, "Platform", machoutils.PlatformFormat)
+	parsingutils.RegisterFieldFormat(types.BuildVersionCmd{}, "Minos", machoutils.VersionFormat)
+	parsingutils.RegisterFieldFormat(types.BuildVersionCmd{}, "Sdk", machoutils.VersionFormat)
+	parsingutils.RegisterFieldFormat(types.BuildVersionTool{}, "Tool", machoutils.ToolFormat)
+	parsingutils.RegisterFieldFormat(types.BuildVersionTool{}, "Version", machoutils.VersionFormat)
+	parsingutils.RegisterFieldFormat(types.SourceVersionCmd{}, "Version", machoutils.SourceVersionFormat)
+}
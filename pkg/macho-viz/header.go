@@ -4,12 +4,18 @@ import (
 	"fmt"
 
 	"github.com/LouisBrunner/mem-viz/pkg/contracts"
+	"github.com/LouisBrunner/mem-viz/pkg/machoutils"
 	"github.com/LouisBrunner/mem-viz/pkg/parsingutils"
 	"github.com/blacktop/go-macho"
 )
 
-func (me *parser) addHeader(root *contracts.MemoryBlock, m *macho.File) error {
-	hdr := me.addStruct(root, m.FileHeader, "Header", 0)
+// core is nil unless the file is laid out by VM address
+func (me *parser) addHeader(root *contracts.MemoryBlock, m *macho.File, core *coreLayout) error {
+	banned := []string{}
+	if !is64Bit(m) {
+		banned = append(banned, "Reserved")
+	}
+	hdr := me.addStructDetailed(root, m.FileHeader, "Header", 0, 0, banned)
 	commands := me.addChild(root, &contracts.MemoryBlock{
 		Name:         fmt.Sprintf("Commands (%d)", m.NCommands),
 		Address:      root.Address + uintptr(hdr.Size),
@@ -27,7 +33,10 @@ func (me *parser) addHeader(root *contracts.MemoryBlock, m *macho.File) error {
 
 	offset := uint64(0)
 	data := contextData{
-		header: m,
+		header:         m,
+		core:           core,
+		metadata:       metadataImage(m),
+		metadataBlocks: map[uint64]*machoutils.MetadataStruct{},
 	}
 	for i, cmd := range m.Loads {
 		block, err := me.addCommand(root, commands, i, cmd, offset, &data)
@@ -1,13 +1,17 @@
 package macho
 
 import (
-	"encoding/binary"
 	"fmt"
+	"io"
 	"reflect"
-	"strings"
+	"unsafe"
 
 	"github.com/LouisBrunner/mem-viz/pkg/contracts"
+	subcontracts "github.com/LouisBrunner/mem-viz/pkg/dsc-viz/contracts"
+	"github.com/LouisBrunner/mem-viz/pkg/machoutils"
 	"github.com/LouisBrunner/mem-viz/pkg/parsingutils"
+	"github.com/blacktop/go-macho"
+	"github.com/blacktop/go-macho/types"
 	"golang.org/x/exp/slices"
 )
 
@@ -15,6 +19,112 @@ func isOnEdge(child, parent *contracts.MemoryBlock) bool {
 	return child.Address == parent.Address || child.Address == parent.Address+uintptr(parent.GetSize())
 }
 
+func readAt(r io.ReaderAt, address uintptr, size uint64) ([]byte, error) {
+	data := make([]byte, size)
+	_, err := r.ReadAt(data, int64(address))
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// Offsets in some LinkEdit structures (e.g. exports) are relative to the mach header, which is at the start of __TEXT
+func imageBase(file *macho.File) uint64 {
+	if text := file.Segment("__TEXT"); text != nil {
+		return text.Addr
+	}
+	return 0
+}
+
+// Addresses in external and local relocations are relative to the first segment, or the first writable one on x86_64 (like dyld does)
+func relocationBase(file *macho.File) uint64 {
+	segments := file.Segments()
+	if file.CPU == types.CPUAmd64 {
+		for _, seg := range segments {
+			if seg.Prot.Write() {
+				return seg.Addr
+			}
+		}
+	}
+	if len(segments) > 0 {
+		return segments[0].Addr
+	}
+	return 0
+}
+
+func is64Bit(file *macho.File) bool {
+	return file.Magic == types.Magic64
+}
+
+func machHeaderSize(file *macho.File) uint64 {
+	if is64Bit(file) {
+		return uint64(unsafe.Sizeof(types.FileHeader{}))
+	}
+	return uint64(unsafe.Sizeof(types.FileHeader{}) - unsafe.Sizeof(uint32(0)))
+}
+
+func pointerSize(file *macho.File) uint64 {
+	if is64Bit(file) {
+		return 8
+	}
+	return 4
+}
+
+func nlistSize(file *macho.File) uint64 {
+	if is64Bit(file) {
+		return uint64(unsafe.Sizeof(subcontracts.NList64{}))
+	}
+	return uint64(unsafe.Sizeof(subcontracts.NList{}))
+}
+
+// 32-bit counterparts of the go-macho headers (which are always widened to 64-bit), strings take 16 bytes like the char[16] they replace
+type segmentHeader32 struct {
+	types.LoadCmd
+	Len     uint32
+	Name    string
+	Addr    uint32
+	Memsz   uint32
+	Offset  uint32
+	Filesz  uint32
+	Maxprot types.VmProtection
+	Prot    types.VmProtection
+	Nsect   uint32
+	Flag    types.SegFlag
+}
+
+type sectionHeader32 struct {
+	Name      string
+	Seg       string
+	Addr      uint32
+	Size      uint32
+	Offset    uint32
+	Align     uint32
+	Reloff    uint32
+	Nreloc    uint32
+	Flags     types.SectionFlag
+	Reserved1 uint32
+	Reserved2 uint32
+}
+
+// Converts a VM address to its file offset, using the section containing it (zerofill sections have no file offset)
+func vmToOffset(file *macho.File, vmAddr uint64) (uintptr, bool) {
+	section := file.FindSectionForVMAddr(vmAddr)
+	if section == nil || section.Offset == 0 {
+		return 0, false
+	}
+	return uintptr(uint64(section.Offset) + vmAddr - section.Addr), true
+}
+
+// Whether a range of the file is inside one of its segments
+func inSegment(file *macho.File, offset, size uint64) bool {
+	for _, seg := range file.Segments() {
+		if offset >= seg.Offset && offset < seg.Offset+seg.Filesz && offset+size <= seg.Offset+seg.Filesz {
+			return true
+		}
+	}
+	return false
+}
+
 func (me *parser) addChildDeep(parent, child *contracts.MemoryBlock) *contracts.MemoryBlock {
 	isEmpty := child.GetSize() == 0
 	for i, curr := range parent.Content {
@@ -50,11 +160,40 @@ func (me *parser) addChild(_parent, child *contracts.MemoryBlock) *contracts.Mem
 	return child
 }
 
+// Finds a block which was already added with the same name and bounds
+func (me *parser) findBlock(name string, address uintptr, size uint64) *contracts.MemoryBlock {
+	sameAddress, found := me.allBlocks[address]
+	if !found {
+		return nil
+	}
+	for _, block := range *sameAddress {
+		if block.Name == name && block.Size == size {
+			return block
+		}
+	}
+	return nil
+}
+
+// Decoded LinkEdit trees often cover their whole range, in which case they are merged into it
+// (otherwise both blocks would have the same bounds and nesting would depend on their names)
+func (me *parser) addDecoded(segment, tree *contracts.MemoryBlock) {
+	if tree.Address != segment.Address || tree.GetSize() != segment.GetSize() {
+		me.addChild(segment, tree)
+		return
+	}
+	segment.Name = fmt.Sprintf("%s: %s", segment.Name, tree.Name)
+	segment.Values = append(segment.Values, tree.Values...)
+	for _, child := range tree.Content {
+		me.addChild(segment, child)
+	}
+}
+
 func (me *parser) addStructDetailed(parent *contracts.MemoryBlock, data interface{}, name string, offset, size uint64, banned []string) *contracts.MemoryBlock {
 	val := parsingutils.GetDataValue(data)
 	typ := val.Type()
 
-	if size == 0 {
+	explicitSize := size != 0
+	if !explicitSize {
 		size = uint64(typ.Size())
 	}
 	block := &contracts.MemoryBlock{
@@ -79,11 +218,18 @@ func (me *parser) addStructDetailed(parent *contracts.MemoryBlock, data interfac
 			if fieldType.Kind() == reflect.Slice {
 				size = uint8(int(fieldType.Elem().Size()) * fieldVal.Len())
 			}
-			addValue(block, field.Name, fieldVal.Interface(), fieldOffset, size)
+			// Trailing strings (e.g. LC_RPATH's path) can be shorter than a Go string header
+			if explicitSize && fieldOffset+uint64(size) > block.Size && fieldOffset < block.Size {
+				size = uint8(block.Size - fieldOffset)
+			}
+			parsingutils.AddStructValue(block, typ, field, fieldVal.Interface(), fieldOffset, size, parsingutils.FormatValue)
 			fieldOffset += uint64(size)
 			fieldSize += uint64(size)
 		}
-		block.Size = fieldSize
+		// Variable-length structs (e.g. load commands with a trailing string) are padded, so the given size wins
+		if !explicitSize {
+			block.Size = fieldSize
+		}
 	}
 
 	return me.addChild(parent, block)
@@ -93,57 +239,113 @@ func (me *parser) addStruct(parent *contracts.MemoryBlock, data interface{}, nam
 	return me.addStructDetailed(parent, data, name, offset, 0, nil)
 }
 
-var arm64ThreadEntries = []string{
-	"x0", "x1", "x2", "x3", "x4", "x5", "x6", "x7", "x8", "x9",
-	"x10", "x11", "x12", "x13", "x14", "x15", "x16", "x17", "x18", "x19",
-	"x20", "x21", "x22", "x23", "x24", "x25", "x26", "x27", "x28",
-	"fp", "lr", "sp", "pc", "cpsr",
+func readPointer(file *macho.File, offset uintptr) (uint64, error) {
+	raw, err := readAt(file, offset, pointerSize(file))
+	if err != nil {
+		return 0, err
+	}
+	if is64Bit(file) {
+		return file.ByteOrder.Uint64(raw), nil
+	}
+	return uint64(file.ByteOrder.Uint32(raw)), nil
+}
+
+// Reads the pointer stored at vmAddr, resolving rebases (chained or not), binds are returned by name instead
+func readPointerAt(file *macho.File, vmAddr uint64) (uint64, string, error) {
+	offset, found := vmToOffset(file, vmAddr)
+	if !found {
+		return 0, "", fmt.Errorf("pointer at %#x is not backed by the file", vmAddr)
+	}
+	raw, err := readPointer(file, offset)
+	if err != nil {
+		return 0, "", err
+	}
+	if file.HasDyldChainedFixups() && !is64Bit(file) {
+		return readChainedPointer32(file, uint64(offset), raw)
+	}
+	bindKey := vmAddr
+	if file.HasDyldChainedFixups() {
+		bindKey = raw
+	}
+	if file.HasFixups() {
+		if name, err := file.GetBindName(bindKey); err == nil {
+			return 0, name, nil
+		}
+	}
+	if file.HasDyldChainedFixups() {
+		target, err := file.GetSlidPointerAtAddress(vmAddr)
+		return target, "", err
+	}
+	return raw, "", nil
+}
+
+// go-macho reads 64-bit pointers outside of the chains and only recognizes binds of the format it last looked up, so
+// 32-bit chains (e.g. DYLD_CHAINED_PTR_32 on arm64_32) are decoded using the format covering the pointer
+func readChainedPointer32(file *macho.File, offset, raw uint64) (uint64, string, error) {
+	fixups, err := file.DyldChainedFixups()
+	if err != nil {
+		return 0, "", err
+	}
+	format, err := fixups.PointerFormatForOffset(offset)
+	if err != nil {
+		// Not covered by a chain, so it isn't fixed up
+		return raw, "", nil
+	}
+	fixup, err := machoutils.DecodeChainedPointer(uint16(format), raw, imageBase(file))
+	if err != nil {
+		return 0, "", err
+	}
+	if !fixup.Bind {
+		return fixup.Target, "", nil
+	}
+	if uint64(fixup.Ordinal) < uint64(len(fixups.Imports)) {
+		return 0, fixups.Imports[fixup.Ordinal].Name, nil
+	}
+	return 0, fmt.Sprintf("bind #%d", fixup.Ordinal), nil
+}
+
+// Returns the index of the first matching symbol, -1 if there is none
+func findSymbol(symtab *macho.Symtab, match func(sym macho.Symbol) bool) int {
+	if symtab == nil {
+		return -1
+	}
+	for i, sym := range symtab.Syms {
+		if match(sym) {
+			return i
+		}
+	}
+	return -1
 }
-var amd64ThreadEntries = []string{
-	"rax", "rbx", "rcx", "rdx", "rdi", "rsi", "rbp", "rsp", "r8", "r9",
-	"r10", "r11", "r12", "r13", "r14", "r15", "rip", "rflags", "cs",
-	"fs", "gs",
+
+// Names of the symbols defined in a section, by VM address (the first one wins when there are aliases)
+func sectionSymbols(symtab *macho.Symtab) map[uint64]string {
+	names := map[uint64]string{}
+	if symtab == nil {
+		return names
+	}
+	for _, sym := range symtab.Syms {
+		if sym.Type.IsDebugSym() || sym.Type&types.N_TYPE != types.N_SECT {
+			continue
+		}
+		if _, found := names[sym.Value]; !found {
+			names[sym.Value] = sym.Name
+		}
+	}
+	return names
 }
-var flavouredThreadEntries = [][]string{
-	arm64ThreadEntries,
-	amd64ThreadEntries,
+
+func indirectSymbolName(index uint32) string {
+	switch index {
+	case types.INDIRECT_SYMBOL_LOCAL:
+		return "INDIRECT_SYMBOL_LOCAL"
+	case types.INDIRECT_SYMBOL_ABS:
+		return "INDIRECT_SYMBOL_ABS"
+	case types.INDIRECT_SYMBOL_LOCAL | types.INDIRECT_SYMBOL_ABS:
+		return "INDIRECT_SYMBOL_LOCAL|INDIRECT_SYMBOL_ABS"
+	}
+	return "not found"
 }
 
 func addValue(parent *contracts.MemoryBlock, name string, value interface{}, offset uint64, size uint8) {
-	parsingutils.AddValue(parent, name, value, offset, size, func(name string, value interface{}) string {
-		switch v := value.(type) {
-		case []byte: // FIXME: 64bit Thread Data assumption
-			if len(v)%8 != 0 {
-				return parsingutils.FormatValue(name, value)
-			}
-			first := true
-			b := strings.Builder{}
-			b.WriteString("{")
-			for i := 0; i < len(v)/8; i++ {
-				v := binary.LittleEndian.Uint64(v[i*8 : (i+1)*8])
-				if v == 0 {
-					continue
-				}
-				if !first {
-					b.WriteString("; ")
-				}
-				labels := []string{}
-				for _, flavour := range flavouredThreadEntries {
-					if len(flavour) > i {
-						labels = append(labels, flavour[i])
-					}
-				}
-				label := strings.Join(labels, "/")
-				if label == "" {
-					label = "???"
-				}
-				fmt.Fprintf(&b, "[%02d/%s]=%#012x", i, label, v)
-				first = false
-			}
-			b.WriteString("}")
-			return b.String()
-		default:
-			return parsingutils.FormatValue(name, value)
-		}
-	})
+	parsingutils.AddValue(parent, name, value, offset, size, parsingutils.FormatValue)
 }
@@ -0,0 +1,71 @@
+package macho
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/LouisBrunner/mem-viz/pkg/machoutils/machotest"
+	"github.com/blacktop/go-macho"
+	"github.com/blacktop/go-macho/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_readPointerAt_chained32(t *testing.T) {
+	le := binary.LittleEndian
+	// Chained fixups with a single DYLD_CHAINED_PTR_32 page in __DATA and one import
+	fixups := []byte{}
+	for _, v := range []uint32{0, 0x20, 0x48, 0x4c, 1, 1, 0, 0} {
+		fixups = le.AppendUint32(fixups, v)
+	}
+	for _, v := range []uint32{3, 0, 0x10, 0} {
+		fixups = le.AppendUint32(fixups, v)
+	}
+	fixups = le.AppendUint32(fixups, 24)
+	fixups = le.AppendUint16(fixups, 0x1000)
+	fixups = le.AppendUint16(fixups, 3)
+	fixups = le.AppendUint64(fixups, 0x1000)
+	fixups = le.AppendUint32(fixups, 0)
+	fixups = le.AppendUint16(fixups, 1)
+	fixups = le.AppendUint16(fixups, 0)
+	fixups = le.AppendUint32(fixups, 1<<9|1)
+	fixups = append(fixups, "\x00_puts\x00"...)
+
+	data := machotest.MachO32(le, types.CPUArm6432, 0x2000+len(fixups), []machotest.Segment{
+		{Name: "__TEXT", Addr: 0x4000, Size: 0x1000, Offset: 0, FileSz: 0x1000, Section: "__text", Skip: 0x400},
+		{Name: "__DATA", Addr: 0x5000, Size: 0x1000, Offset: 0x1000, FileSz: 0x1000, Section: "__data"},
+		{Name: "__LINKEDIT", Addr: 0x6000, Size: 0x1000, Offset: 0x2000, FileSz: uint32(len(fixups))},
+	}, machotest.Command(le, types.LC_DYLD_CHAINED_FIXUPS, 0x2000, uint32(len(fixups))))
+	copy(data[0x2000:], fixups)
+	// A rebase to 0x4010 followed by a bind to _puts, then a bind to a missing import
+	le.PutUint32(data[0x1000:], 1<<26|0x4010)
+	le.PutUint32(data[0x1004:], 1<<31|1<<26)
+	le.PutUint32(data[0x1008:], 1<<31|5)
+	// Not covered by any chain
+	le.PutUint32(data[0x800:], 0x4020)
+
+	file, err := macho.NewFile(bytes.NewReader(data))
+	require.NoError(t, err)
+	require.True(t, file.HasDyldChainedFixups())
+
+	cases := []struct {
+		vmAddr uint64
+		target uint64
+		bind   string
+	}{
+		{vmAddr: 0x5000, target: 0x4010},
+		{vmAddr: 0x5004, bind: "_puts"},
+		{vmAddr: 0x5008, bind: "bind #5"},
+		{vmAddr: 0x4800, target: 0x4020},
+	}
+	for _, c := range cases {
+		target, bind, err := readPointerAt(file, c.vmAddr)
+		require.NoError(t, err)
+		assert.Equal(t, c.target, target, "%#x", c.vmAddr)
+		assert.Equal(t, c.bind, bind, "%#x", c.vmAddr)
+	}
+
+	_, _, err = readPointerAt(file, 0x7000)
+	assert.Error(t, err)
+}
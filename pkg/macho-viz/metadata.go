@@ -0,0 +1,35 @@
+package macho
+
+import (
+	"github.com/LouisBrunner/mem-viz/pkg/contracts"
+	"github.com/LouisBrunner/mem-viz/pkg/machoutils"
+	"github.com/blacktop/go-macho"
+)
+
+// The ObjC and Swift structures are read through machoutils, pointers go through the fixups of the image
+func metadataImage(file *macho.File) machoutils.MetadataImage {
+	return machoutils.MetadataImage{
+		Data:      file,
+		ByteOrder: file.ByteOrder,
+		Is64:      is64Bit(file),
+		Resolve: func(vmAddr uint64) (uintptr, bool) {
+			return vmToOffset(file, vmAddr)
+		},
+		ReadPointer: func(vmAddr uint64) (uint64, string, error) {
+			return readPointerAt(file, vmAddr)
+		},
+	}
+}
+
+// Structures which can't be resolved (e.g. in __bss or only reachable through a bind) are skipped, the rest of the
+// metadata can still be shown
+func (me *parser) skipMetadata(err error) {
+	me.logger.WithError(err).Warn("skipping metadata")
+}
+
+// Structures can be reached from several places (e.g. a metaclass or a shared method list), they are only added once
+func (me *parser) addMetadataStruct(context *contextData, root *contracts.MemoryBlock, data *machoutils.MetadataStruct) *contracts.MemoryBlock {
+	data.Block.ParentOffset = uint64(data.Block.Address) - uint64(root.Address)
+	context.metadataBlocks[data.Address] = data
+	return me.addChild(root, data.Block)
+}
@@ -0,0 +1,475 @@
+package macho
+
+import (
+	"fmt"
+
+	"github.com/LouisBrunner/mem-viz/pkg/contracts"
+	"github.com/LouisBrunner/mem-viz/pkg/machoutils"
+	"github.com/blacktop/go-macho/types"
+)
+
+// From Apple's objc4 (objc-runtime-new.h), layouts are the same in 32-bit and 64-bit besides the pointer size
+
+var objcClassFields = []machoutils.MetadataField{
+	{Name: "Isa", Kind: machoutils.MetadataPointer},
+	{Name: "Superclass", Kind: machoutils.MetadataPointer},
+	{Name: "Cache", Kind: machoutils.MetadataPointer},
+	{Name: "VTable", Kind: machoutils.MetadataPointer},
+	{Name: "Data", Kind: machoutils.MetadataPointer},
+}
+
+var objcClassROFields32 = []machoutils.MetadataField{
+	{Name: "Flags", Kind: machoutils.MetadataUint32},
+	{Name: "InstanceStart", Kind: machoutils.MetadataUint32},
+	{Name: "InstanceSize", Kind: machoutils.MetadataUint32},
+	{Name: "IvarLayout", Kind: machoutils.MetadataPointer},
+	{Name: "Name", Kind: machoutils.MetadataPointer},
+	{Name: "BaseMethods", Kind: machoutils.MetadataPointer},
+	{Name: "BaseProtocols", Kind: machoutils.MetadataPointer},
+	{Name: "Ivars", Kind: machoutils.MetadataPointer},
+	{Name: "WeakIvarLayout", Kind: machoutils.MetadataPointer},
+	{Name: "BaseProperties", Kind: machoutils.MetadataPointer},
+}
+
+var objcClassROFields64 = append([]machoutils.MetadataField{
+	{Name: "Flags", Kind: machoutils.MetadataUint32},
+	{Name: "InstanceStart", Kind: machoutils.MetadataUint32},
+	{Name: "InstanceSize", Kind: machoutils.MetadataUint32},
+	{Name: "Reserved", Kind: machoutils.MetadataUint32},
+}, objcClassROFields32[3:]...)
+
+var objcCategoryFields = []machoutils.MetadataField{
+	{Name: "Name", Kind: machoutils.MetadataPointer},
+	{Name: "Class", Kind: machoutils.MetadataPointer},
+	{Name: "InstanceMethods", Kind: machoutils.MetadataPointer},
+	{Name: "ClassMethods", Kind: machoutils.MetadataPointer},
+	{Name: "Protocols", Kind: machoutils.MetadataPointer},
+	{Name: "InstanceProperties", Kind: machoutils.MetadataPointer},
+}
+
+var objcProtocolFields = []machoutils.MetadataField{
+	{Name: "Isa", Kind: machoutils.MetadataPointer},
+	{Name: "Name", Kind: machoutils.MetadataPointer},
+	{Name: "Protocols", Kind: machoutils.MetadataPointer},
+	{Name: "InstanceMethods", Kind: machoutils.MetadataPointer},
+	{Name: "ClassMethods", Kind: machoutils.MetadataPointer},
+	{Name: "OptionalInstanceMethods", Kind: machoutils.MetadataPointer},
+	{Name: "OptionalClassMethods", Kind: machoutils.MetadataPointer},
+	{Name: "InstanceProperties", Kind: machoutils.MetadataPointer},
+	{Name: "Size", Kind: machoutils.MetadataUint32},
+	{Name: "Flags", Kind: machoutils.MetadataUint32},
+}
+
+// Only present if the protocol's Size covers them
+var objcProtocolExtraFields = []machoutils.MetadataField{
+	{Name: "ExtendedMethodTypes", Kind: machoutils.MetadataPointer},
+	{Name: "DemangledName", Kind: machoutils.MetadataPointer},
+	{Name: "ClassProperties", Kind: machoutils.MetadataPointer},
+}
+
+var objcListHeaderFields = []machoutils.MetadataField{
+	{Name: "EntsizeAndFlags", Kind: machoutils.MetadataUint32},
+	{Name: "Count", Kind: machoutils.MetadataUint32},
+}
+
+var objcMethodFields = []machoutils.MetadataField{
+	{Name: "Name", Kind: machoutils.MetadataPointer},
+	{Name: "Types", Kind: machoutils.MetadataPointer},
+	{Name: "Imp", Kind: machoutils.MetadataPointer},
+}
+
+var objcRelativeMethodFields = []machoutils.MetadataField{
+	{Name: "Name", Kind: machoutils.MetadataRelative}, // points to a selector reference
+	{Name: "Types", Kind: machoutils.MetadataRelative},
+	{Name: "Imp", Kind: machoutils.MetadataRelative},
+}
+
+var objcIvarFields = []machoutils.MetadataField{
+	{Name: "Offset", Kind: machoutils.MetadataPointer},
+	{Name: "Name", Kind: machoutils.MetadataPointer},
+	{Name: "Type", Kind: machoutils.MetadataPointer},
+	{Name: "Alignment", Kind: machoutils.MetadataUint32},
+	{Name: "Size", Kind: machoutils.MetadataUint32},
+}
+
+var objcPropertyFields = []machoutils.MetadataField{
+	{Name: "Name", Kind: machoutils.MetadataPointer},
+	{Name: "Attributes", Kind: machoutils.MetadataPointer},
+}
+
+const (
+	objcMethodListRelative    = 0x80000000
+	objcMethodListEntsizeMask = 0x0000fffc
+	objcListEntsizeMask       = 0xfffffffc
+	objcClassIsSwiftMask32    = 0x3
+	objcClassDataMask64       = 0x00007ffffffffff8
+)
+
+func (me *parser) decodeObjCSection(context *contextData, root *contracts.MemoryBlock, sect *types.Section, sectData *contracts.MemoryBlock) error {
+	switch sect.Name {
+	case "__objc_classlist", "__objc_nlclslist":
+		return me.decodeObjCPointerList(context, root, sect, "Class", func(vmAddr uint64) (string, error) {
+			return me.decodeObjCClass(context, root, vmAddr, false)
+		})
+	case "__objc_catlist", "__objc_nlcatlist", "__objc_catlist2":
+		return me.decodeObjCPointerList(context, root, sect, "Category", func(vmAddr uint64) (string, error) {
+			return me.decodeObjCCategory(context, root, vmAddr)
+		})
+	case "__objc_protolist":
+		return me.decodeObjCPointerList(context, root, sect, "Protocol", func(vmAddr uint64) (string, error) {
+			return me.decodeObjCProtocol(context, root, vmAddr)
+		})
+	case "__objc_selrefs":
+		return me.decodeObjCPointerList(context, root, sect, "Selector", func(vmAddr uint64) (string, error) {
+			return machoutils.ReadCStringAt(context.metadata, vmAddr), nil
+		})
+	case "__objc_imageinfo":
+		if sect.Size < 8 {
+			return nil
+		}
+		raw, err := readAt(context.header, sectData.Address, 8)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", sect.Name, err)
+		}
+		addValue(sectData, "Version", context.header.ByteOrder.Uint32(raw), 0, 4)
+		addValue(sectData, "Flags", context.header.ByteOrder.Uint32(raw[4:]), 4, 4)
+	}
+	return nil
+}
+
+// Lists of pointers to structures (e.g. __objc_classlist), decode returns the name of the structure
+func (me *parser) decodeObjCPointerList(context *contextData, root *contracts.MemoryBlock, sect *types.Section, label string, decode func(vmAddr uint64) (string, error)) error {
+	size := pointerSize(context.header)
+	for i := range sect.Size / size {
+		slot, err := machoutils.ReadMetadataStruct(context.metadata, label, sect.Addr+i*size, []machoutils.MetadataField{{Name: label, Kind: machoutils.MetadataPointer}})
+		if err != nil {
+			me.skipMetadata(err)
+			continue
+		}
+		name := slot.Binds[label]
+		if target := slot.Values[label]; target != 0 {
+			name, err = decode(target)
+			if err != nil {
+				me.skipMetadata(fmt.Errorf("failed to decode %s at %#x: %w", label, target, err))
+				name = "unresolved"
+			}
+			err = slot.Link(context.metadata, label, "points to")
+			if err != nil {
+				return err
+			}
+		}
+		slot.Block.Name = fmt.Sprintf("%s Reference (%s)", label, name)
+		me.addMetadataStruct(context, root, slot)
+	}
+	return nil
+}
+
+func (me *parser) decodeObjCClass(context *contextData, root *contracts.MemoryBlock, vmAddr uint64, isMeta bool) (string, error) {
+	label := "Class"
+	if isMeta {
+		label = "Metaclass"
+	}
+	if existing, found := context.metadataBlocks[vmAddr]; found {
+		return existing.Name, nil
+	}
+	class, err := machoutils.ReadMetadataStruct(context.metadata, label, vmAddr, objcClassFields)
+	if err != nil {
+		return "", err
+	}
+	// Registered early as classes can refer to themselves (e.g. the root metaclass)
+	context.metadataBlocks[vmAddr] = class
+
+	dataMask := ^uint64(objcClassIsSwiftMask32)
+	roFields := objcClassROFields32
+	if is64Bit(context.header) {
+		dataMask = objcClassDataMask64
+		roFields = objcClassROFields64
+	}
+	roAddr := class.Values["Data"] & dataMask
+	name, err := me.decodeObjCClassData(context, root, label, roAddr, roFields)
+	if err != nil {
+		// The class itself can still be shown
+		me.skipMetadata(err)
+		name = "unresolved"
+	}
+	class.Name = name
+	class.Block.Name = fmt.Sprintf("%s %s", label, name)
+
+	if !isMeta {
+		if _, found := class.Binds["Isa"]; !found && class.Values["Isa"] != 0 {
+			_, err = me.decodeObjCClass(context, root, class.Values["Isa"], true)
+			if err != nil {
+				me.skipMetadata(err)
+			}
+		}
+	}
+	for _, field := range []string{"Isa", "Superclass"} {
+		err = class.Link(context.metadata, field, "refers to")
+		if err != nil {
+			return "", err
+		}
+	}
+	err = machoutils.LinkToVMAddr(context.metadata, class.Block, "Data", "points to", roAddr)
+	if err != nil {
+		return "", err
+	}
+	me.addMetadataStruct(context, root, class)
+	return name, nil
+}
+
+func (me *parser) decodeObjCClassData(context *contextData, root *contracts.MemoryBlock, label string, vmAddr uint64, fields []machoutils.MetadataField) (string, error) {
+	ro, err := machoutils.ReadMetadataStruct(context.metadata, fmt.Sprintf("%s Data", label), vmAddr, fields)
+	if err != nil {
+		return "", err
+	}
+	name := machoutils.ReadCStringAt(context.metadata, ro.Values["Name"])
+	ro.Block.Name = fmt.Sprintf("%s Data %s", label, name)
+	err = me.linkObjCName(context, ro, "Name")
+	if err != nil {
+		return "", err
+	}
+	me.decodeObjCMethodLists(context, root, ro, fmt.Sprintf("%s %s", label, name), "BaseMethods")
+	me.decodeObjCProtocolList(context, root, ro, name, "BaseProtocols")
+	me.decodeObjCEntryList(context, root, ro, "Ivars", fmt.Sprintf("Ivars of %s", name), "Ivar", objcIvarFields)
+	me.decodeObjCEntryList(context, root, ro, "BaseProperties", fmt.Sprintf("Properties of %s", name), "Property", objcPropertyFields)
+	me.addMetadataStruct(context, root, ro)
+	return name, nil
+}
+
+func (me *parser) decodeObjCCategory(context *contextData, root *contracts.MemoryBlock, vmAddr uint64) (string, error) {
+	if existing, found := context.metadataBlocks[vmAddr]; found {
+		return existing.Name, nil
+	}
+	category, err := machoutils.ReadMetadataStruct(context.metadata, "Category", vmAddr, objcCategoryFields)
+	if err != nil {
+		return "", err
+	}
+	name := machoutils.ReadCStringAt(context.metadata, category.Values["Name"])
+	category.Name = name
+	category.Block.Name = fmt.Sprintf("Category %s", name)
+	err = me.linkObjCName(context, category, "Name")
+	if err != nil {
+		return "", err
+	}
+	err = category.Link(context.metadata, "Class", "extends")
+	if err != nil {
+		return "", err
+	}
+	me.decodeObjCMethodLists(context, root, category, fmt.Sprintf("Category %s", name), "InstanceMethods", "ClassMethods")
+	me.decodeObjCProtocolList(context, root, category, name, "Protocols")
+	me.decodeObjCEntryList(context, root, category, "InstanceProperties", fmt.Sprintf("Properties of %s", name), "Property", objcPropertyFields)
+	me.addMetadataStruct(context, root, category)
+	return name, nil
+}
+
+func (me *parser) decodeObjCProtocol(context *contextData, root *contracts.MemoryBlock, vmAddr uint64) (string, error) {
+	if existing, found := context.metadataBlocks[vmAddr]; found {
+		return existing.Name, nil
+	}
+	protocol, err := machoutils.ReadMetadataStruct(context.metadata, "Protocol", vmAddr, objcProtocolFields)
+	if err != nil {
+		return "", err
+	}
+	extraFields := []machoutils.MetadataField{}
+	baseSize := protocol.Block.Size
+	for _, field := range objcProtocolExtraFields {
+		if baseSize+machoutils.MetadataFieldSize(context.metadata, field) > protocol.Values["Size"] {
+			break
+		}
+		extraFields = append(extraFields, field)
+		baseSize += machoutils.MetadataFieldSize(context.metadata, field)
+	}
+	if len(extraFields) > 0 {
+		protocol, err = machoutils.ReadMetadataStruct(context.metadata, "Protocol", vmAddr, append(objcProtocolFields, extraFields...))
+		if err != nil {
+			return "", err
+		}
+	}
+	name := machoutils.ReadCStringAt(context.metadata, protocol.Values["Name"])
+	protocol.Name = name
+	protocol.Block.Name = fmt.Sprintf("Protocol %s", name)
+	err = me.linkObjCName(context, protocol, "Name")
+	if err != nil {
+		return "", err
+	}
+	me.decodeObjCMethodLists(context, root, protocol, fmt.Sprintf("Protocol %s", name), "InstanceMethods", "ClassMethods", "OptionalInstanceMethods", "OptionalClassMethods")
+	me.decodeObjCProtocolList(context, root, protocol, name, "Protocols")
+	me.decodeObjCEntryList(context, root, protocol, "InstanceProperties", fmt.Sprintf("Properties of %s", name), "Property", objcPropertyFields)
+	me.addMetadataStruct(context, root, protocol)
+	return name, nil
+}
+
+func (me *parser) linkObjCName(context *contextData, data *machoutils.MetadataStruct, field string) error {
+	return data.Link(context.metadata, field, "is named")
+}
+
+// Method lists are either made of pointers or of relative offsets (in which case the name points to a selector reference)
+func (me *parser) decodeObjCMethodLists(context *contextData, root *contracts.MemoryBlock, owner *machoutils.MetadataStruct, ownerName string, fields ...string) {
+	for _, field := range fields {
+		err := me.decodeObjCMethodList(context, root, owner, ownerName, field)
+		if err != nil {
+			me.skipMetadata(err)
+		}
+	}
+}
+
+func (me *parser) decodeObjCMethodList(context *contextData, root *contracts.MemoryBlock, owner *machoutils.MetadataStruct, ownerName, field string) error {
+	vmAddr := owner.Values[field]
+	if vmAddr == 0 {
+		return nil
+	}
+	err := owner.Link(context.metadata, field, "points to")
+	if err != nil {
+		return err
+	}
+	if _, found := context.metadataBlocks[vmAddr]; found {
+		return nil
+	}
+	list, err := machoutils.ReadMetadataStruct(context.metadata, "Method List", vmAddr, objcListHeaderFields)
+	if err != nil {
+		return err
+	}
+	flags := list.Values["EntsizeAndFlags"]
+	count := list.Values["Count"]
+	entrySize := flags & objcMethodListEntsizeMask
+	entryFields := objcMethodFields
+	if flags&objcMethodListRelative != 0 {
+		entryFields = objcRelativeMethodFields
+	}
+	if entrySize < machoutils.MetadataStructSize(context.metadata, entryFields) {
+		return fmt.Errorf("invalid method list entry size %d at %#x", entrySize, vmAddr)
+	}
+	list.Block.Name = fmt.Sprintf("%s of %s (%d)", field, ownerName, count)
+	list.Block.Size += count * entrySize
+	for i := range count {
+		entryAddr := vmAddr + machoutils.MetadataStructSize(context.metadata, objcListHeaderFields) + i*entrySize
+		method, err := machoutils.ReadMetadataStruct(context.metadata, "Method", entryAddr, entryFields)
+		if err != nil {
+			me.skipMetadata(err)
+			continue
+		}
+		selector := method.Values["Name"]
+		if flags&objcMethodListRelative != 0 {
+			// The selector reference can be unresolvable too, in which case the method is left unnamed
+			selector, _, err = readPointerAt(context.header, selector)
+			if err != nil {
+				me.skipMetadata(err)
+			}
+		}
+		method.Block.Name = fmt.Sprintf("Method %s", machoutils.ReadCStringAt(context.metadata, selector))
+		for _, link := range []struct{ field, label string }{
+			{"Name", "is named"},
+			{"Types", "has types"},
+			{"Imp", "implemented by"},
+		} {
+			err = method.Link(context.metadata, link.field, link.label)
+			if err != nil {
+				return err
+			}
+		}
+		me.addMetadataStruct(context, root, method)
+	}
+	me.addMetadataStruct(context, root, list)
+	return nil
+}
+
+// Ivars and properties lists, their entries are named after their Name field
+func (me *parser) decodeObjCEntryList(context *contextData, root *contracts.MemoryBlock, owner *machoutils.MetadataStruct, field, label, entryLabel string, entryFields []machoutils.MetadataField) {
+	err := me.decodeObjCEntries(context, root, owner, field, label, entryLabel, entryFields)
+	if err != nil {
+		me.skipMetadata(err)
+	}
+}
+
+func (me *parser) decodeObjCEntries(context *contextData, root *contracts.MemoryBlock, owner *machoutils.MetadataStruct, field, label, entryLabel string, entryFields []machoutils.MetadataField) error {
+	vmAddr := owner.Values[field]
+	if vmAddr == 0 {
+		return nil
+	}
+	err := owner.Link(context.metadata, field, "points to")
+	if err != nil {
+		return err
+	}
+	if _, found := context.metadataBlocks[vmAddr]; found {
+		return nil
+	}
+	list, err := machoutils.ReadMetadataStruct(context.metadata, label, vmAddr, objcListHeaderFields)
+	if err != nil {
+		return err
+	}
+	count := list.Values["Count"]
+	entrySize := list.Values["EntsizeAndFlags"] & objcListEntsizeMask
+	if entrySize < machoutils.MetadataStructSize(context.metadata, entryFields) {
+		return fmt.Errorf("invalid %s entry size %d at %#x", field, entrySize, vmAddr)
+	}
+	list.Block.Name = fmt.Sprintf("%s (%d)", label, count)
+	list.Block.Size += count * entrySize
+	for i := range count {
+		entryAddr := vmAddr + machoutils.MetadataStructSize(context.metadata, objcListHeaderFields) + i*entrySize
+		entry, err := machoutils.ReadMetadataStruct(context.metadata, entryLabel, entryAddr, entryFields)
+		if err != nil {
+			me.skipMetadata(err)
+			continue
+		}
+		entry.Block.Name = fmt.Sprintf("%s %s", entryLabel, machoutils.ReadCStringAt(context.metadata, entry.Values["Name"]))
+		for _, entryField := range entryFields {
+			if entryField.Kind != machoutils.MetadataPointer {
+				continue
+			}
+			label := "points to"
+			if entryField.Name == "Name" {
+				label = "is named"
+			}
+			err = entry.Link(context.metadata, entryField.Name, label)
+			if err != nil {
+				return err
+			}
+		}
+		me.addMetadataStruct(context, root, entry)
+	}
+	me.addMetadataStruct(context, root, list)
+	return nil
+}
+
+// Protocol lists are a pointer-sized count followed by pointers to protocols (which are decoded from __objc_protolist)
+func (me *parser) decodeObjCProtocolList(context *contextData, root *contracts.MemoryBlock, owner *machoutils.MetadataStruct, ownerName, field string) {
+	err := me.decodeObjCProtocols(context, root, owner, ownerName, field)
+	if err != nil {
+		me.skipMetadata(err)
+	}
+}
+
+func (me *parser) decodeObjCProtocols(context *contextData, root *contracts.MemoryBlock, owner *machoutils.MetadataStruct, ownerName, field string) error {
+	vmAddr := owner.Values[field]
+	if vmAddr == 0 {
+		return nil
+	}
+	err := owner.Link(context.metadata, field, "points to")
+	if err != nil {
+		return err
+	}
+	if _, found := context.metadataBlocks[vmAddr]; found {
+		return nil
+	}
+	list, err := machoutils.ReadMetadataStruct(context.metadata, "Protocol List", vmAddr, []machoutils.MetadataField{{Name: "Count", Kind: machoutils.MetadataPointer}})
+	if err != nil {
+		return err
+	}
+	count := list.Values["Count"]
+	fields := make([]machoutils.MetadataField, count)
+	for i := range fields {
+		fields[i] = machoutils.MetadataField{Name: fmt.Sprintf("Protocol %d", i+1), Kind: machoutils.MetadataPointer}
+	}
+	list, err = machoutils.ReadMetadataStruct(context.metadata, fmt.Sprintf("Protocols of %s (%d)", ownerName, count), vmAddr, append([]machoutils.MetadataField{{Name: "Count", Kind: machoutils.MetadataPointer}}, fields...))
+	if err != nil {
+		return err
+	}
+	for _, field := range fields {
+		err = list.Link(context.metadata, field.Name, "refers to")
+		if err != nil {
+			return err
+		}
+	}
+	me.addMetadataStruct(context, root, list)
+	return nil
+}
@@ -1,13 +1,17 @@
 package macho
 
 import (
+	"bytes"
+	"cmp"
 	"fmt"
+	"io"
 	"os"
-	"unsafe"
 
 	"github.com/LouisBrunner/mem-viz/pkg/contracts"
+	"github.com/LouisBrunner/mem-viz/pkg/machoutils"
 	"github.com/LouisBrunner/mem-viz/pkg/parsingutils"
 	"github.com/blacktop/go-macho"
+	"github.com/blacktop/go-macho/types"
 	"github.com/sirupsen/logrus"
 	"golang.org/x/exp/maps"
 	"golang.org/x/exp/slices"
@@ -26,72 +30,97 @@ func Parse(logger *logrus.Logger, file string) (*contracts.MemoryBlock, error) {
 	return p.parse(file)
 }
 
+// Parses a Mach-O image which is already loaded (e.g. the member of a static archive), name is given to the root block
+func ParseData(logger *logrus.Logger, name string, data []byte) (*contracts.MemoryBlock, error) {
+	p := &parser{
+		logger:    logger,
+		allBlocks: make(map[uintptr]*[]*contracts.MemoryBlock),
+	}
+	m, err := macho.NewFile(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	return p.addArch(name, m, uint64(len(data)))
+}
+
 func (me *parser) parse(file string) (*contracts.MemoryBlock, error) {
-	st, err := os.Stat(file)
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		err := f.Close()
+		if err != nil {
+			me.logger.Errorf("failed to close file: %v", err)
+		}
+	}()
+	st, err := f.Stat()
 	if err != nil {
 		return nil, err
 	}
 
-	var m *macho.File
-	f, err := macho.OpenFat(file)
+	// Only the header of universal binaries is read, the architectures are read as needed (cores can be huge)
+	header := make([]byte, 8)
+	_, err = io.ReadFull(f, header)
 	if err != nil {
-		m, err = macho.Open(file)
+		return nil, err
+	}
+	headerSize, isFat := machoutils.FatHeaderSize(header)
+	if !isFat {
+		m, err := macho.NewFile(f)
 		if err != nil {
 			return nil, err
 		}
-		defer func() {
-			err := m.Close()
-			if err != nil {
-				me.logger.Errorf("failed to close macho file: %v", err)
-			}
-		}()
-
 		return me.addArch(file, m, uint64(st.Size()))
 	}
+	if headerSize > uint64(st.Size()) {
+		return nil, fmt.Errorf("invalid universal binary: header of %d bytes", headerSize)
+	}
+	header = make([]byte, headerSize)
+	_, err = f.ReadAt(header, 0)
+	if err != nil {
+		return nil, err
+	}
+	fatHeader, arches, err := machoutils.ParseFat(header)
+	if err != nil {
+		return nil, err
+	}
 
 	root := &contracts.MemoryBlock{
 		Name: file,
 		Size: uint64(st.Size()),
 	}
-
-	for _, arch := range f.Arches {
+	for _, arch := range arches {
 		name := arch.CPU.String() // FIXME: need support for arm64e
-		archBlock, err := me.addArch(fmt.Sprintf("Arch %s", name), arch.File, uint64(arch.Size))
+		if arch.Offset+arch.Size > uint64(st.Size()) {
+			return nil, fmt.Errorf("arch %s is out of bounds: %#x > %#x", name, arch.Offset+arch.Size, st.Size())
+		}
+		// Slices have their own byte order (e.g. big-endian for PowerPC), which go-macho picks from their magic
+		m, err := macho.NewFile(io.NewSectionReader(f, int64(arch.Offset), int64(arch.Size)))
 		if err != nil {
 			return nil, fmt.Errorf("failed to parse arch %s: %w", name, err)
 		}
-		archBlock.ParentOffset = uint64(arch.Offset)
-		me.rebase(archBlock, uint64(arch.Offset))
+		archBlock, err := me.addArch(fmt.Sprintf("Arch %s", name), m, arch.Size)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse arch %s: %w", name, err)
+		}
+		archBlock.ParentOffset = arch.Offset
+		parsingutils.Rebase(archBlock, arch.Offset)
 		root.Content = append(root.Content, archBlock)
 	}
 
-	me.allBlocks = make(map[uintptr]*[]*contracts.MemoryBlock)
-	fatHeader := me.addStructDetailed(root, f.FatHeader, "FAT Header", 0, 0, []string{"Arches"})
-	for i, arch := range f.Arches {
-		name := arch.CPU.String() // FIXME: need support for arm64e
-		archBlock := me.addStruct(root, arch.FatArchHeader, fmt.Sprintf("FAT Arch %s", name), fatHeader.Size+uint64(i)*uint64(unsafe.Sizeof(macho.FatArchHeader{})))
-		err := parsingutils.AddLinkWithAddr(archBlock, "Offset", "points to", uintptr(arch.Offset))
-		if err != nil {
-			return nil, err
-		}
+	root.Content = append(root.Content, fatHeader)
+	for _, arch := range arches {
+		root.Content = append(root.Content, arch.Block)
 	}
-	me.rebalance(root)
+	// The architectures don't have to be in the same order as their headers
+	slices.SortStableFunc(root.Content, func(a, b *contracts.MemoryBlock) int {
+		return cmp.Compare(a.Address, b.Address)
+	})
 
 	return root, nil
 }
 
-func (me *parser) rebase(root *contracts.MemoryBlock, offset uint64) {
-	root.Address = root.Address + uintptr(offset)
-	for _, child := range root.Content {
-		me.rebase(child, offset)
-	}
-	for _, value := range root.Values {
-		for _, link := range value.Links {
-			link.TargetAddress += offset
-		}
-	}
-}
-
 func (me *parser) addArch(name string, m *macho.File, sz uint64) (*contracts.MemoryBlock, error) {
 	me.allBlocks = make(map[uintptr]*[]*contracts.MemoryBlock)
 
@@ -100,10 +129,22 @@ func (me *parser) addArch(name string, m *macho.File, sz uint64) (*contracts.Mem
 		Size: sz,
 	}
 
-	err := me.addHeader(root, m)
+	var core *coreLayout
+	if m.Type == types.MH_CORE {
+		core = me.newCoreLayout(m)
+		if core != nil {
+			// Ends with the last segment, wherever it is mapped
+			root.Size = 0
+		}
+	}
+
+	err := me.addHeader(root, m, core)
 	if err != nil {
 		return nil, err
 	}
+	if core != nil {
+		me.addCoreContent(root, core)
+	}
 
 	me.rebalance(root)
 
@@ -0,0 +1,300 @@
+package macho
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/LouisBrunner/mem-viz/pkg/checker"
+	"github.com/LouisBrunner/mem-viz/pkg/contracts"
+	"github.com/LouisBrunner/mem-viz/pkg/contracts/contractstest"
+	"github.com/LouisBrunner/mem-viz/pkg/machoutils/machotest"
+	"github.com/blacktop/go-macho/types"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func findDeep(block *contracts.MemoryBlock, name string) *contracts.MemoryBlock {
+	if block.Name == name {
+		return block
+	}
+	for _, child := range block.Content {
+		if found := findDeep(child, name); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+func Test_ParseData_bigEndian(t *testing.T) {
+	logger := logrus.New()
+	root, err := ParseData(logger, "ppc", machotest.PPC())
+	require.NoError(t, err)
+	require.NoError(t, checker.Check(logger, root))
+
+	header := findDeep(root, "Header")
+	require.NotNil(t, header)
+	assert.Equal(t, "PowerPC", contractstest.FindValue(t, header, "CPU").Value)
+	assert.Equal(t, "0x3", contractstest.FindValue(t, header, "NCommands").Value)
+
+	symbol := findDeep(root, "Symbol (1)")
+	require.NotNil(t, symbol)
+	assert.Equal(t, uintptr(0x1000), symbol.Address)
+	assert.Equal(t, `"_main"`, contractstest.FindValue(t, symbol, "Name").Value)
+	assert.Equal(t, "0x1200", contractstest.FindValue(t, symbol, "NValue").Value)
+}
+
+func Test_Parse_fat(t *testing.T) {
+	x86 := machotest.MachO32(binary.LittleEndian, types.CPUI386, 0x1000, []machotest.Segment{
+		{Name: "__TEXT", Addr: 0x1000, Size: 0x1000, Offset: 0, FileSz: 0x1000, Section: "__text", Skip: 0x200},
+	})
+	file := filepath.Join(t.TempDir(), "fat")
+	err := os.WriteFile(file, machotest.Fat(
+		machotest.FatSlice{CPU: types.CPUPpc, Data: machotest.PPC()},
+		machotest.FatSlice{CPU: types.CPUI386, Data: x86},
+	), 0o644)
+	require.NoError(t, err)
+
+	logger := logrus.New()
+	root, err := Parse(logger, file)
+	require.NoError(t, err)
+	require.NoError(t, checker.Check(logger, root))
+
+	names := []string{}
+	for _, child := range root.Content {
+		names = append(names, child.Name)
+	}
+	assert.Equal(t, []string{"FAT Header", "FAT Arch PowerPC", "FAT Arch i386", "Arch PowerPC", "Arch i386"}, names)
+	assert.Equal(t, "0x2", contractstest.FindValue(t, root.Content[0], "Count").Value)
+
+	// Each slice is decoded with its own byte order
+	ppc := root.Content[3]
+	assert.Equal(t, uintptr(0x1000), ppc.Address)
+	symbol := findDeep(ppc, "Symbol (1)")
+	require.NotNil(t, symbol)
+	assert.Equal(t, uintptr(0x2000), symbol.Address)
+	assert.Equal(t, `"_main"`, contractstest.FindValue(t, symbol, "Name").Value)
+	i386 := root.Content[4]
+	assert.Equal(t, uintptr(0x3000), i386.Address)
+	assert.Equal(t, "i386", contractstest.FindValue(t, findDeep(i386, "Header"), "CPU").Value)
+}
+
+func Test_ParseData_unresolvableObjC(t *testing.T) {
+	le := binary.LittleEndian
+	data := machotest.MachO32(le, types.CPUI386, 0x1008, []machotest.Segment{
+		{Name: "__TEXT", Addr: 0x1000, Size: 0x1000, Offset: 0, FileSz: 0x1000, Section: "__text", Skip: 0x200},
+		{Name: "__DATA", Addr: 0x2000, Size: 0x1000, Offset: 0x1000, FileSz: 8, Section: "__objc_classlist"},
+	})
+	// The first class isn't in the file (e.g. in __bss), the second one is but its data isn't
+	le.PutUint32(data[0x1000:], 0x9000)
+	le.PutUint32(data[0x1004:], 0x1300)
+	le.PutUint32(data[0x300+16:], 0x9100)
+
+	logger := logrus.New()
+	root, err := ParseData(logger, "objc", data)
+	require.NoError(t, err)
+	require.NoError(t, checker.Check(logger, root))
+
+	first := findDeep(root, "Class Reference (unresolved)")
+	require.NotNil(t, first)
+	assert.Equal(t, uintptr(0x1000), first.Address)
+	class := findDeep(root, "Class unresolved")
+	require.NotNil(t, class)
+	assert.Equal(t, uintptr(0x300), class.Address)
+	assert.Equal(t, "0x9100", contractstest.FindValue(t, class, "Data").Value)
+}
+
+// An i386 executable whose stubs jump through lazy pointers and which interposes _helper with _my_malloc
+func indirectSymbols() []byte {
+	le := binary.LittleEndian
+	strings := "\x00_helper\x00_main\x00_my_malloc\x00_free\x00_malloc\x00"
+	data := machotest.MachO32(le, types.CPUI386, 0x2100, []machotest.Segment{
+		{Name: "__TEXT", Addr: 0x1000, Size: 0x1000, Offset: 0, FileSz: 0x1000, Sections: []machotest.Section{
+			{Name: "__text", Start: 0x400, Size: 0x100},
+			{Name: "__stubs", Start: 0x500, Size: 12, Flags: uint32(types.SymbolStubs), Reserved1: 3, Reserved2: 6},
+		}},
+		{Name: "__DATA", Addr: 0x2000, Size: 0x1000, Offset: 0x1000, FileSz: 0x100, Sections: []machotest.Section{
+			{Name: "__got", Start: 0, Size: 4, Flags: uint32(types.NonLazySymbolPointers), Reserved1: 0},
+			{Name: "__la_symbol_ptr", Start: 0x10, Size: 8, Flags: uint32(types.LazySymbolPointers), Reserved1: 1},
+			{Name: "__interpose", Start: 0x20, Size: 16, Flags: uint32(types.Interposing)},
+		}},
+		{Name: "__LINKEDIT", Addr: 0x3000, Size: 0x1000, Offset: 0x2000, FileSz: 0x100},
+	},
+		machotest.Command(le, types.LC_SYMTAB, 0x2000, 5, 0x2040, uint32(len(strings))),
+		// 1 local, 2 external and 2 undefined symbols, then the indirect symbols table
+		machotest.Command(le, types.LC_DYSYMTAB, 0, 1, 1, 2, 3, 2, 0, 0, 0, 0, 0, 0, 0x2080, 5, 0, 0, 0, 0),
+	)
+	// nlist: n_strx, n_type, n_sect, n_desc, n_value
+	for i, sym := range []struct {
+		strx  uint32
+		ntype uint8
+		value uint32
+	}{
+		{1, 0x0e, 0x1420},  // _helper
+		{9, 0x0f, 0x1400},  // _main
+		{15, 0x0f, 0x1410}, // _my_malloc
+		{26, 0x01, 0},      // _free
+		{32, 0x01, 0},      // _malloc
+	} {
+		le.PutUint32(data[0x2000+i*12:], sym.strx)
+		data[0x2000+i*12+4] = sym.ntype
+		if sym.value != 0 {
+			data[0x2000+i*12+5] = 1
+		}
+		le.PutUint32(data[0x2000+i*12+8:], sym.value)
+	}
+	copy(data[0x2040:], strings)
+	// __got and __la_symbol_ptr share _malloc, the stubs come last
+	for i, sym := range []uint32{4, 4, 3, 4, 3} {
+		le.PutUint32(data[0x2080+i*4:], sym)
+	}
+	// The second entry replaces something which isn't a symbol
+	for i, ptr := range []uint32{0x1410, 0x1420, 0x1410, 0xdead} {
+		le.PutUint32(data[0x1020+i*4:], ptr)
+	}
+	return data
+}
+
+func Test_ParseData_indirectSymbols(t *testing.T) {
+	logger := logrus.New()
+	root, err := ParseData(logger, "indirect", indirectSymbols())
+	require.NoError(t, err)
+	require.NoError(t, checker.Check(logger, root))
+
+	pointers := map[string]uintptr{
+		"Non-Lazy Pointer for _malloc": 0x1000,
+		"Lazy Pointer for _malloc":     0x1010,
+		"Lazy Pointer for _free":       0x1014,
+	}
+	for name, address := range pointers {
+		pointer := findDeep(root, name)
+		require.NotNil(t, pointer, name)
+		assert.Equal(t, address, pointer.Address, name)
+		assert.Equal(t, fmt.Sprintf("%#x", address+0x1000), contractstest.FindValue(t, pointer, "Address").Value, name)
+	}
+
+	// Stubs go through the lazy pointers rather than __got
+	for name, pointer := range map[string]uintptr{"Stub of _malloc": 0x1010, "Stub of _free": 0x1014} {
+		stub := findDeep(root, name)
+		require.NotNil(t, stub, name)
+		assert.Equal(t, []*contracts.MemoryLink{{Name: "jumps through", TargetAddress: uint64(pointer)}}, contractstest.FindValue(t, stub, "Pointer").Links, name)
+	}
+	assert.Equal(t, uintptr(0x500), findDeep(root, "Stub of _malloc").Address)
+	assert.Equal(t, uintptr(0x506), findDeep(root, "Stub of _free").Address)
+
+	// Interposed pointers link to the symbols they refer to
+	interpose := findDeep(root, "Interpose _my_malloc -> _helper")
+	require.NotNil(t, interpose)
+	assert.Equal(t, uintptr(0x1020), interpose.Address)
+	assert.Equal(t, []*contracts.MemoryLink{{Name: "refers to", TargetAddress: 0x2000 + 2*12}}, contractstest.FindValue(t, interpose, "Replacement").Links)
+	assert.Equal(t, []*contracts.MemoryLink{{Name: "refers to", TargetAddress: 0x2000}}, contractstest.FindValue(t, interpose, "Replacee").Links)
+	unknown := findDeep(root, "Interpose _my_malloc -> unknown")
+	require.NotNil(t, unknown)
+	assert.Equal(t, uintptr(0x1028), unknown.Address)
+	assert.Equal(t, `"unknown"`, contractstest.FindValue(t, unknown, "Replacee").Value)
+	assert.Empty(t, contractstest.FindValue(t, unknown, "Replacee").Links)
+}
+
+// A kernel collection with two kexts, each entry uses the offsets of the whole file and shares its __LINKEDIT
+func fileset() []byte {
+	le := binary.LittleEndian
+	linkedit := machotest.Segment{Name: "__LINKEDIT", Addr: 0x13000, Size: 0x1000, Offset: 0x3000, FileSz: 0x100}
+	data := machotest.MachO64(le, types.CPUArm64, types.MH_FILESET, 0x3100, []machotest.Segment{
+		{Name: "__TEXT", Addr: 0x10000, Size: 0x1000, Offset: 0, FileSz: 0x1000},
+		linkedit,
+	},
+		machotest.FilesetEntry(le, 0x11000, 0x1000, "com.example.a"),
+		machotest.FilesetEntry(le, 0x12000, 0x2000, "com.example.b"),
+	)
+	for i, offset := range []uint32{0x1000, 0x2000} {
+		entry := machotest.MachO64(le, types.CPUArm64, types.MH_KEXT_BUNDLE, 0x1000, []machotest.Segment{
+			{Name: "__TEXT", Addr: 0x11000 + uint32(i)*0x1000, Size: 0x1000, Offset: offset, FileSz: 0x1000, Section: "__text", Skip: 0x200},
+			linkedit,
+		})
+		copy(data[offset:], entry)
+	}
+	return data
+}
+
+func Test_ParseData_fileset(t *testing.T) {
+	logger := logrus.New()
+	root, err := ParseData(logger, "kc", fileset())
+	require.NoError(t, err)
+	require.NoError(t, checker.Check(logger, root))
+
+	// The collection's __LINKEDIT is only added once, every entry links to it
+	linkedit := []*contracts.MemoryBlock{}
+	for _, child := range root.Content {
+		if child.Name == "Segment (__LINKEDIT)" {
+			linkedit = append(linkedit, child)
+		}
+	}
+	require.Len(t, linkedit, 1)
+	assert.Equal(t, uintptr(0x3000), linkedit[0].Address)
+	assert.Empty(t, linkedit[0].Content)
+
+	for i, id := range []string{"com.example.a", "com.example.b"} {
+		offset := uint64(0x1000 * (i + 1))
+		entry := findDeep(root, fmt.Sprintf("Fileset Entry (%s)", id))
+		require.NotNil(t, entry, id)
+		assert.Equal(t, uintptr(offset), entry.Address, id)
+		assert.Equal(t, "KEXT_BUNDLE", contractstest.FindValue(t, findDeep(entry, "Header"), "Type").Value, id)
+
+		// The offsets of the entry's segments are in the collection, unlike FAT arches they aren't relative to the entry
+		text := findDeep(entry, "Command 1: LC_SEGMENT_64")
+		require.NotNil(t, text, id)
+		assert.Equal(t, []*contracts.MemoryLink{{Name: "points to", TargetAddress: offset}}, contractstest.FindValue(t, text.Content[0], "Offset").Links, id)
+		assert.Equal(t, []*contracts.MemoryLink{{Name: "points to", TargetAddress: offset + 0x200}}, contractstest.FindValue(t, text.Content[1], "Offset").Links, id)
+		linkeditCommand := findDeep(entry, "Command 2: LC_SEGMENT_64")
+		require.NotNil(t, linkeditCommand, id)
+		assert.Equal(t, []*contracts.MemoryLink{{Name: "points to", TargetAddress: 0x3000}}, contractstest.FindValue(t, linkeditCommand, "Offset").Links, id)
+	}
+	// Their sections end up in their __TEXT
+	for _, offset := range []uintptr{0x1000, 0x2000} {
+		var section *contracts.MemoryBlock
+		for _, child := range root.Content {
+			if child.Address == offset {
+				section = findDeep(child, "Section (__text)")
+			}
+		}
+		require.NotNil(t, section)
+		assert.Equal(t, offset+0x200, section.Address)
+	}
+}
+
+func Test_ParseData_dataInCodeOutOfRange(t *testing.T) {
+	le := binary.LittleEndian
+	data := machotest.MachO32(le, types.CPUI386, 0x1010, []machotest.Segment{
+		{Name: "__TEXT", Addr: 0x1000, Size: 0x1000, Offset: 0, FileSz: 0x1000, Section: "__text", Skip: 0x200},
+		{Name: "__LINKEDIT", Addr: 0x2000, Size: 0x1000, Offset: 0x1000, FileSz: 0x10},
+	}, machotest.Command(le, types.LC_DATA_IN_CODE, 0x1000, 0x10))
+	// A jump table in __text and a literal pool past the end of the file
+	for i, entry := range []struct {
+		offset       uint32
+		length, kind uint16
+	}{{0x300, 0x10, 4}, {0x9000, 8, 1}} {
+		le.PutUint32(data[0x1000+i*8:], entry.offset)
+		le.PutUint16(data[0x1004+i*8:], entry.length)
+		le.PutUint16(data[0x1006+i*8:], entry.kind)
+	}
+
+	logger := logrus.New()
+	root, err := ParseData(logger, "dice", data)
+	require.NoError(t, err)
+	require.NoError(t, checker.Check(logger, root))
+
+	table := findDeep(root, "Jump Table (JUMP_TABLE32)")
+	require.NotNil(t, table)
+	assert.Equal(t, uintptr(0x300), table.Address)
+	entry := findDeep(root, "Data In Code JUMP_TABLE32 (+0x300)")
+	require.NotNil(t, entry)
+	assert.Equal(t, []*contracts.MemoryLink{{Name: "marks", TargetAddress: 0x300}}, contractstest.FindValue(t, entry, "Offset").Links)
+
+	assert.Nil(t, findDeep(root, "Literal Pool (DATA)"))
+	entry = findDeep(root, "Data In Code DATA (+0x9000)")
+	require.NotNil(t, entry)
+	assert.Empty(t, contractstest.FindValue(t, entry, "Offset").Links)
+}
@@ -0,0 +1,110 @@
+package macho
+
+import (
+	"fmt"
+
+	"github.com/LouisBrunner/mem-viz/pkg/contracts"
+	"github.com/LouisBrunner/mem-viz/pkg/machoutils"
+	"github.com/blacktop/go-macho/types"
+)
+
+// Swift sections only list their structures, whatever can't be decoded is skipped
+func (me *parser) decodeSwiftSection(context *contextData, root *contracts.MemoryBlock, sect *types.Section) {
+	var structs []*machoutils.MetadataStruct
+	var warnings []error
+	switch sect.Name {
+	case "__swift5_types", "__swift5_types2":
+		structs, warnings = machoutils.ParseSwiftRelativeList(context.metadata, sect.Addr, sect.Size, "Type", func(vmAddr uint64) (string, error) {
+			return me.decodeSwiftTypeDescriptor(context, root, vmAddr)
+		})
+	case "__swift5_proto":
+		structs, warnings = machoutils.ParseSwiftRelativeList(context.metadata, sect.Addr, sect.Size, "Protocol Conformance", func(vmAddr uint64) (string, error) {
+			return me.decodeSwiftConformance(context, root, vmAddr)
+		})
+	case "__swift5_fieldmd":
+		structs, warnings = machoutils.ParseSwiftFieldDescriptors(context.metadata, sect.Addr, sect.Size)
+	}
+	for _, warning := range warnings {
+		me.skipMetadata(warning)
+	}
+	for _, data := range structs {
+		me.addMetadataStruct(context, root, data)
+	}
+}
+
+func (me *parser) decodeSwiftTypeDescriptor(context *contextData, root *contracts.MemoryBlock, vmAddr uint64) (string, error) {
+	if existing, found := context.metadataBlocks[vmAddr]; found {
+		return existing.Name, nil
+	}
+	descriptor, err := machoutils.ReadMetadataStruct(context.metadata, "Type Descriptor", vmAddr, machoutils.SwiftContextDescriptorFields)
+	if err != nil {
+		return "", err
+	}
+	kind := descriptor.Values["Flags"] & machoutils.SwiftKindMask
+	name := ""
+	switch kind {
+	case machoutils.SwiftKindClass, machoutils.SwiftKindStruct, machoutils.SwiftKindEnum:
+		descriptor, err = machoutils.ReadMetadataStruct(context.metadata, "Type Descriptor", vmAddr, machoutils.SwiftTypeDescriptorFields)
+		if err != nil {
+			return "", err
+		}
+		name = machoutils.ReadCStringAt(context.metadata, descriptor.Values["Name"])
+		for _, link := range []struct{ field, label string }{
+			{"Name", "is named"},
+			{"AccessFunction", "accessed by"},
+			{"Fields", "described by"},
+		} {
+			err = descriptor.Link(context.metadata, link.field, link.label)
+			if err != nil {
+				return "", err
+			}
+		}
+	}
+	err = machoutils.LinkToVMAddr(context.metadata, descriptor.Block, "Parent", "is nested in", descriptor.Values["Parent"]&^machoutils.SwiftIndirectMask)
+	if err != nil {
+		return "", err
+	}
+	descriptor.Name = name
+	descriptor.Block.Name = fmt.Sprintf("%s Descriptor %s", machoutils.SwiftKindName(kind), name)
+	me.addMetadataStruct(context, root, descriptor)
+	return name, nil
+}
+
+func (me *parser) decodeSwiftConformance(context *contextData, root *contracts.MemoryBlock, vmAddr uint64) (string, error) {
+	if existing, found := context.metadataBlocks[vmAddr]; found {
+		return existing.Name, nil
+	}
+	conformance, err := machoutils.ReadMetadataStruct(context.metadata, "Protocol Conformance", vmAddr, machoutils.SwiftConformanceDescriptorFields)
+	if err != nil {
+		return "", err
+	}
+	err = machoutils.LinkToVMAddr(context.metadata, conformance.Block, "Protocol", "conforms to", conformance.Values["Protocol"]&^machoutils.SwiftIndirectMask)
+	if err != nil {
+		return "", err
+	}
+	err = conformance.Link(context.metadata, "TypeRef", "is implemented by")
+	if err != nil {
+		return "", err
+	}
+	err = conformance.Link(context.metadata, "WitnessTablePattern", "points to")
+	if err != nil {
+		return "", err
+	}
+	// Indirect type references go through a pointer, usually bound to another image
+	name := "indirect"
+	switch (conformance.Values["Flags"] >> machoutils.SwiftConformanceTypeRefShift) & machoutils.SwiftConformanceTypeRefMask {
+	case machoutils.SwiftConformanceDirectTypeDescriptor:
+		name, err = me.decodeSwiftTypeDescriptor(context, root, conformance.Values["TypeRef"])
+		if err != nil {
+			// The conformance itself can still be shown
+			me.skipMetadata(err)
+			name = "unresolved"
+		}
+	case machoutils.SwiftConformanceDirectObjCClassName:
+		name = machoutils.ReadCStringAt(context.metadata, conformance.Values["TypeRef"])
+	}
+	conformance.Name = name
+	conformance.Block.Name = fmt.Sprintf("Protocol Conformance %s", name)
+	me.addMetadataStruct(context, root, conformance)
+	return name, nil
+}
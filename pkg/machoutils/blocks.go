@@ -0,0 +1,97 @@
+package machoutils
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	"github.com/LouisBrunner/mem-viz/pkg/commons"
+	"github.com/LouisBrunner/mem-viz/pkg/contracts"
+	"github.com/LouisBrunner/mem-viz/pkg/parsingutils"
+)
+
+// All decoders in this package work on a raw byte slice and return a self-contained tree of blocks
+// starting at the given address, it's up to the caller to graft it where it belongs
+
+func newBlock(name string, address uintptr, size uint64) *contracts.MemoryBlock {
+	return &contracts.MemoryBlock{
+		Name:    name,
+		Address: address,
+		Size:    size,
+	}
+}
+
+func addChild(parent *contracts.MemoryBlock, name string, offset, size uint64) *contracts.MemoryBlock {
+	child := &contracts.MemoryBlock{
+		Name:         name,
+		Address:      parent.Address + uintptr(offset),
+		Size:         size,
+		ParentOffset: offset,
+	}
+	parent.Content = append(parent.Content, child)
+	return child
+}
+
+// Content is not always discovered in order (e.g. blob indexes can point anywhere)
+func sortContent(block *contracts.MemoryBlock) {
+	sort.SliceStable(block.Content, func(i, j int) bool {
+		a, b := block.Content[i], block.Content[j]
+		if a.Address != b.Address {
+			return a.Address < b.Address
+		}
+		return parsingutils.LessThan(a, b)
+	})
+}
+
+func addValue(block *contracts.MemoryBlock, name string, value interface{}, offset uint64, size uint8) {
+	parsingutils.AddValue(block, name, value, offset, size, parsingutils.FormatValue)
+}
+
+func subSlice(data []byte, offset, size uint64) ([]byte, error) {
+	if offset > uint64(len(data)) || size > uint64(len(data))-offset {
+		return nil, fmt.Errorf("out of bounds: %#x+%#x > %#x", offset, size, len(data))
+	}
+	return data[offset : offset+size], nil
+}
+
+func readCString(data []byte, offset uint64) (string, error) {
+	if offset >= uint64(len(data)) {
+		return "", fmt.Errorf("out of bounds: %#x >= %#x", offset, len(data))
+	}
+	end := bytes.IndexByte(data[offset:], 0)
+	if end < 0 {
+		return "", fmt.Errorf("unterminated string at %#x", offset)
+	}
+	return string(data[offset : offset+uint64(end)]), nil
+}
+
+// Unpacks the struct at offset and adds it as a child block, only the first size bytes are shown (0 means the whole struct)
+func addStruct(parent *contracts.MemoryBlock, data []byte, v any, name string, offset, size uint64) (*contracts.MemoryBlock, error) {
+	if size == 0 {
+		size = uint64(parsingutils.GetDataValue(v).Type().Size())
+	}
+	err := unpackAt(data, offset, size, v)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", name, err)
+	}
+	block := addChild(parent, name, offset, size)
+	structValues(block, v, size)
+	return block, nil
+}
+
+// Versioned structs can be shorter than their Go counterpart, missing fields are left empty
+func unpackAt(data []byte, offset, size uint64, v any) error {
+	raw, err := subSlice(data, offset, size)
+	if err != nil {
+		return err
+	}
+	full := uint64(parsingutils.GetDataValue(v).Type().Size())
+	if size < full {
+		raw = append(bytes.Clone(raw), make([]byte, full-size)...)
+	}
+	return commons.Unpack(bytes.NewReader(raw), v)
+}
+
+func structValues(block *contracts.MemoryBlock, v any, limit uint64) {
+	parsingutils.AddStructValues(block, v, limit, parsingutils.FormatValue)
+}
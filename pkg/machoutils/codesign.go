@@ -0,0 +1,291 @@
+package machoutils
+
+import (
+	"encoding/hex"
+	"fmt"
+
+	"github.com/LouisBrunner/mem-viz/pkg/contracts"
+	"github.com/LouisBrunner/mem-viz/pkg/parsingutils"
+)
+
+type CodeSignatureOptions struct {
+	// Address of the data covered by the code slots, used to link each slot to its page
+	PagesAddress uintptr
+	LinkPages    bool
+	// Code slots are not detailed if there are more than this (0 means no limit)
+	TooBig uint64
+	// How deep we go into the CMS signature (0 means no limit)
+	CMSDepth int
+}
+
+type codeSignatureParser struct {
+	options CodeSignatureOptions
+	slots   map[uint32]*contracts.MemoryBlock
+	hashes  []slotHash
+}
+
+type slotHash struct {
+	block *contracts.MemoryBlock
+	slot  uint32
+}
+
+// Parses a code signature SuperBlob (as pointed by LC_CODE_SIGNATURE or a cache header), data must contain exactly the signature
+func ParseCodeSignature(data []byte, address uintptr, options CodeSignatureOptions) (*contracts.MemoryBlock, error) {
+	p := codeSignatureParser{
+		options: options,
+		slots:   map[uint32]*contracts.MemoryBlock{},
+	}
+	return p.parse(data, address)
+}
+
+func (me *codeSignatureParser) parse(data []byte, address uintptr) (*contracts.MemoryBlock, error) {
+	superBlob := CSSuperBlob{}
+	err := unpackAt(data, 0, 12, &superBlob)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse code signature: %w", err)
+	}
+	if superBlob.Magic != CSMAGIC_EMBEDDED_SIGNATURE && superBlob.Magic != CSMAGIC_DETACHED_SIGNATURE {
+		return nil, fmt.Errorf("invalid code signature magic %#x (expected %#x)", superBlob.Magic, CSMAGIC_EMBEDDED_SIGNATURE)
+	}
+	// The signature is usually padded, but we don't want to show it as part of the SuperBlob
+	if uint64(superBlob.Length) < uint64(len(data)) {
+		data = data[:superBlob.Length]
+	}
+
+	root := newBlock(fmt.Sprintf("SuperBlob (%s)", CSMagicName(superBlob.Magic)), address, uint64(len(data)))
+	header, err := addStruct(root, data, &superBlob, "SuperBlob Header", 0, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	if superBlob.Count > 0 {
+		indexes := addChild(root, fmt.Sprintf("Blob Indexes (%d)", superBlob.Count), 12, uint64(superBlob.Count)*8)
+		err = parsingutils.AddLinkWithBlock(header, "Count", indexes, "gives size")
+		if err != nil {
+			return nil, err
+		}
+		indexesData, err := subSlice(data, 12, indexes.Size)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse blob indexes: %w", err)
+		}
+
+		blobs := map[uint32]*contracts.MemoryBlock{}
+		for i := uint64(0); i < uint64(superBlob.Count); i += 1 {
+			index := CSBlobIndex{}
+			indexBlock, err := addStruct(indexes, indexesData, &index, fmt.Sprintf("Blob Index %d/%d", i+1, superBlob.Count), i*8, 0)
+			if err != nil {
+				return nil, err
+			}
+			addValue(indexBlock, "Slot", CSSlotName(index.Type), 0, 0)
+
+			blob, found := blobs[index.Offset]
+			if !found {
+				blob, err = me.parseBlob(root, data, uint64(index.Offset), index.Type)
+				if err != nil {
+					return nil, fmt.Errorf("failed to parse blob %s: %w", CSSlotName(index.Type), err)
+				}
+				blobs[index.Offset] = blob
+			}
+			me.slots[index.Type] = blob
+			err = parsingutils.AddLinkWithBlock(indexBlock, "Offset", blob, "points to")
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// Special slots contain the hashes of the other blobs, which we only know about once everything is parsed
+	for _, hash := range me.hashes {
+		blob, found := me.slots[hash.slot]
+		if !found {
+			continue
+		}
+		err = parsingutils.AddLinkWithBlock(hash.block, "Hash", blob, "hashes")
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	sortContent(root)
+	return root, nil
+}
+
+func (me *codeSignatureParser) parseBlob(root *contracts.MemoryBlock, data []byte, offset uint64, slot uint32) (*contracts.MemoryBlock, error) {
+	generic := CSGenericBlob{}
+	err := unpackAt(data, offset, 8, &generic)
+	if err != nil {
+		return nil, err
+	}
+	blobData, err := subSlice(data, offset, uint64(generic.Length))
+	if err != nil {
+		return nil, err
+	}
+
+	name := CSMagicName(generic.Magic)
+	if generic.Magic == CSMAGIC_CODEDIRECTORY && slot != CSSLOT_CODEDIRECTORY {
+		name = fmt.Sprintf("%s (%s)", name, CSSlotName(slot))
+	}
+	blob := addChild(root, name, offset, uint64(generic.Length))
+
+	switch generic.Magic {
+	case CSMAGIC_CODEDIRECTORY:
+		err = me.parseCodeDirectory(blob, blobData)
+	case CSMAGIC_REQUIREMENTS:
+		err = me.parseRequirements(blob, blobData)
+	case CSMAGIC_EMBEDDED_ENTITLEMENTS:
+		_, err = addStruct(blob, blobData, &generic, "Entitlements Header", 0, 0)
+		if err == nil {
+			// The plist is too long to be a name, it is kept as a value instead
+			xml := addChild(blob, "Entitlements (XML)", 8, uint64(len(blobData))-8)
+			parsingutils.AddValue(xml, "XML", string(blobData[8:]), 0, 0, func(name string, value interface{}) string {
+				return fmt.Sprintf("%q", value)
+			})
+		}
+	case CSMAGIC_EMBEDDED_DER_ENTITLEMENTS, CSMAGIC_EMBEDDED_LAUNCH_CONSTRAINT:
+		_, err = addStruct(blob, blobData, &generic, fmt.Sprintf("%s Header", name), 0, 0)
+		if err == nil {
+			err = addDER(blob, blobData[8:], 8, 0)
+		}
+	case CSMAGIC_BLOBWRAPPER:
+		_, err = addStruct(blob, blobData, &generic, "CMS Signature Header", 0, 0)
+		if err == nil {
+			err = addDER(blob, blobData[8:], 8, me.options.CMSDepth)
+		}
+	default:
+		_, err = addStruct(blob, blobData, &generic, fmt.Sprintf("%s Header", name), 0, 0)
+	}
+	if err != nil {
+		return nil, err
+	}
+	sortContent(blob)
+	return blob, nil
+}
+
+func (me *codeSignatureParser) parseCodeDirectory(blob *contracts.MemoryBlock, data []byte) error {
+	version := CSCodeDirectory{}
+	err := unpackAt(data, 0, codeDirectoryBaseSize, &version)
+	if err != nil {
+		return err
+	}
+	cd := CSCodeDirectory{}
+	header, err := addStruct(blob, data, &cd, "CodeDirectory Header", 0, version.HeaderSize())
+	if err != nil {
+		return err
+	}
+	addValue(header, "Hash Type", CSHashTypeName(cd.HashType), 0, 0)
+
+	ident, err := readCString(data, uint64(cd.IdentOffset))
+	if err != nil {
+		return fmt.Errorf("failed to read identifier: %w", err)
+	}
+	identBlock := addChild(blob, fmt.Sprintf("Identifier: %s", ident), uint64(cd.IdentOffset), uint64(len(ident)+1))
+	err = parsingutils.AddLinkWithBlock(header, "IdentOffset", identBlock, "points to")
+	if err != nil {
+		return err
+	}
+
+	if cd.Version >= CS_SUPPORTSTEAMID && cd.TeamOffset != 0 {
+		team, err := readCString(data, uint64(cd.TeamOffset))
+		if err != nil {
+			return fmt.Errorf("failed to read team ID: %w", err)
+		}
+		teamBlock := addChild(blob, fmt.Sprintf("Team ID: %s", team), uint64(cd.TeamOffset), uint64(len(team)+1))
+		err = parsingutils.AddLinkWithBlock(header, "TeamOffset", teamBlock, "points to")
+		if err != nil {
+			return err
+		}
+	}
+
+	hashSize := uint64(cd.HashSize)
+	if cd.NSpecialSlots > 0 {
+		size := uint64(cd.NSpecialSlots) * hashSize
+		if size > uint64(cd.HashOffset) {
+			return fmt.Errorf("special slots do not fit before hash offset %#x", cd.HashOffset)
+		}
+		specialSlots := addChild(blob, fmt.Sprintf("Special Slots (%d)", cd.NSpecialSlots), uint64(cd.HashOffset)-size, size)
+		err = parsingutils.AddLinkWithBlock(header, "NSpecialSlots", specialSlots, "gives size")
+		if err != nil {
+			return err
+		}
+		// Special slots are stored in reverse order, right before the code slots
+		for slot := uint32(cd.NSpecialSlots); slot > 0; slot -= 1 {
+			offset := uint64(cd.HashOffset) - uint64(slot)*hashSize
+			slotBlock, err := addHash(specialSlots, data, fmt.Sprintf("Special Slot %d (%s)", slot, CSSlotName(slot)), offset, hashSize)
+			if err != nil {
+				return err
+			}
+			me.hashes = append(me.hashes, slotHash{block: slotBlock, slot: slot})
+		}
+		sortContent(specialSlots)
+	}
+
+	if cd.NCodeSlots > 0 {
+		codeSlots := addChild(blob, fmt.Sprintf("Code Slots (%d)", cd.NCodeSlots), uint64(cd.HashOffset), uint64(cd.NCodeSlots)*hashSize)
+		err = parsingutils.AddLinkWithBlock(header, "HashOffset", codeSlots, "points to")
+		if err != nil {
+			return err
+		}
+		if me.options.TooBig != 0 && uint64(cd.NCodeSlots) > me.options.TooBig {
+			return nil
+		}
+		for i := uint64(0); i < uint64(cd.NCodeSlots); i += 1 {
+			slotBlock, err := addHash(codeSlots, data, fmt.Sprintf("Code Slot %d", i+1), uint64(cd.HashOffset)+i*hashSize, hashSize)
+			if err != nil {
+				return err
+			}
+			if me.options.LinkPages && cd.PageSize != 0 {
+				err = parsingutils.AddLinkWithAddr(slotBlock, "Hash", "hashes", me.options.PagesAddress+uintptr(i<<cd.PageSize))
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func addHash(parent *contracts.MemoryBlock, data []byte, name string, offset, size uint64) (*contracts.MemoryBlock, error) {
+	hash, err := subSlice(data, offset, size)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", name, err)
+	}
+	block := addChild(parent, name, offset-parent.ParentOffset, size)
+	addValue(block, "Hash", hex.EncodeToString(hash), 0, uint8(size))
+	return block, nil
+}
+
+func (me *codeSignatureParser) parseRequirements(blob *contracts.MemoryBlock, data []byte) error {
+	requirements := CSRequirements{}
+	_, err := addStruct(blob, data, &requirements, "Requirements Header", 0, 0)
+	if err != nil {
+		return err
+	}
+
+	for i := uint64(0); i < uint64(requirements.Count); i += 1 {
+		index := CSBlobIndex{}
+		indexBlock, err := addStruct(blob, data, &index, fmt.Sprintf("Requirement Index %d/%d", i+1, requirements.Count), 12+i*8, 0)
+		if err != nil {
+			return err
+		}
+		addValue(indexBlock, "Kind", CSRequirementTypeName(index.Type), 0, 0)
+
+		requirement := CSRequirement{}
+		err = unpackAt(data, uint64(index.Offset), 12, &requirement)
+		if err != nil {
+			return fmt.Errorf("failed to parse requirement %d: %w", i+1, err)
+		}
+		if _, err := subSlice(data, uint64(index.Offset), uint64(requirement.Length)); err != nil {
+			return fmt.Errorf("failed to parse requirement %d: %w", i+1, err)
+		}
+		reqBlock := addChild(blob, fmt.Sprintf("Requirement (%s)", CSRequirementTypeName(index.Type)), uint64(index.Offset), uint64(requirement.Length))
+		structValues(reqBlock, &requirement, 12)
+		if requirement.Length > 12 {
+			addChild(reqBlock, "Expression", 12, uint64(requirement.Length)-12)
+		}
+		err = parsingutils.AddLinkWithBlock(indexBlock, "Offset", reqBlock, "points to")
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
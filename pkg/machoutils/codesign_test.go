@@ -0,0 +1,157 @@
+package machoutils_test
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/LouisBrunner/mem-viz/pkg/contracts"
+	"github.com/LouisBrunner/mem-viz/pkg/contracts/contractstest"
+	"github.com/LouisBrunner/mem-viz/pkg/machoutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Code signatures are big-endian, blobs are given as (slot, contents)
+func superBlob(blobs ...any) []byte {
+	be := binary.BigEndian
+	count := len(blobs) / 2
+	data := be.AppendUint32(nil, machoutils.CSMAGIC_EMBEDDED_SIGNATURE)
+	data = be.AppendUint32(data, 0)
+	data = be.AppendUint32(data, uint32(count))
+	offset := uint32(12 + count*8)
+	for i := 0; i < len(blobs); i += 2 {
+		data = be.AppendUint32(data, blobs[i].(uint32))
+		data = be.AppendUint32(data, offset)
+		offset += uint32(len(blobs[i+1].([]byte)))
+	}
+	for i := 1; i < len(blobs); i += 2 {
+		data = append(data, blobs[i].([]byte)...)
+	}
+	be.PutUint32(data[4:], uint32(len(data)))
+	return data
+}
+
+func genericBlob(magic uint32, contents []byte) []byte {
+	data := binary.BigEndian.AppendUint32(nil, magic)
+	data = binary.BigEndian.AppendUint32(data, uint32(8+len(contents)))
+	return append(data, contents...)
+}
+
+// A version 0x20200 CodeDirectory (52 bytes header) with an identifier, a team, 7 special slots and 2 code slots,
+// hashes are 4 bytes to keep it short
+func codeDirectory() []byte {
+	be := binary.BigEndian
+	data := []byte{}
+	for _, v := range []uint32{machoutils.CSMAGIC_CODEDIRECTORY, 100, machoutils.CS_SUPPORTSTEAMID, 0x2, 92, 52, 7, 2, 0x2000} {
+		data = be.AppendUint32(data, v)
+	}
+	data = append(data, 4, 2, 0, 12)
+	for _, v := range []uint32{0, 0, 59} {
+		data = be.AppendUint32(data, v)
+	}
+	data = append(data, "com.ex\x00TEAM\x00"...)
+	for slot := 7; slot > 0; slot -= 1 {
+		data = append(data, byte(slot), 0, 0, 0)
+	}
+	return append(data, 0xaa, 0xaa, 0xaa, 0xaa, 0xbb, 0xbb, 0xbb, 0xbb)
+}
+
+func names(blocks []*contracts.MemoryBlock) []string {
+	names := []string{}
+	for _, block := range blocks {
+		names = append(names, block.Name)
+	}
+	return names
+}
+
+func Test_ParseCodeSignature(t *testing.T) {
+	xml := "<plist/>"
+	data := superBlob(
+		uint32(machoutils.CSSLOT_CODEDIRECTORY), codeDirectory(),
+		uint32(machoutils.CSSLOT_ENTITLEMENTS), genericBlob(machoutils.CSMAGIC_EMBEDDED_ENTITLEMENTS, []byte(xml)),
+	)
+	// The padding after the SuperBlob isn't part of it
+	root, err := machoutils.ParseCodeSignature(append(data, make([]byte, 0x20)...), 0x1000, machoutils.CodeSignatureOptions{
+		PagesAddress: 0x8000,
+		LinkPages:    true,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "SuperBlob (Embedded Signature)", root.Name)
+	assert.Equal(t, uint64(len(data)), root.Size)
+	assert.Equal(t, []string{"SuperBlob Header", "Blob Indexes (2)", "CodeDirectory", "Entitlements"}, names(root.Content))
+
+	indexes := root.Content[1]
+	assert.Equal(t, uintptr(0x100c), indexes.Address)
+	entitlementsIndex := contractstest.FindBlock(t, indexes.Content, "Blob Index 2/2")
+	assert.Equal(t, `"Entitlements"`, contractstest.FindValue(t, entitlementsIndex, "Slot").Value)
+	offset := contractstest.FindValue(t, entitlementsIndex, "Offset")
+	require.Len(t, offset.Links, 1)
+	assert.Equal(t, uint64(0x1000+0x1c+100), offset.Links[0].TargetAddress)
+
+	entitlements := root.Content[3]
+	xmlBlock := contractstest.FindBlock(t, entitlements.Content, "Entitlements (XML)")
+	assert.Equal(t, uint64(len(xml)), xmlBlock.Size)
+	assert.Equal(t, `"<plist/>"`, contractstest.FindValue(t, xmlBlock, "XML").Value)
+}
+
+func Test_ParseCodeSignature_codeDirectory(t *testing.T) {
+	data := superBlob(
+		uint32(machoutils.CSSLOT_CODEDIRECTORY), codeDirectory(),
+		uint32(machoutils.CSSLOT_ENTITLEMENTS), genericBlob(machoutils.CSMAGIC_EMBEDDED_ENTITLEMENTS, []byte("<plist/>")),
+	)
+	root, err := machoutils.ParseCodeSignature(data, 0x1000, machoutils.CodeSignatureOptions{
+		PagesAddress: 0x8000,
+		LinkPages:    true,
+	})
+	require.NoError(t, err)
+
+	cd := root.Content[2]
+	assert.Equal(t, uintptr(0x101c), cd.Address)
+	assert.Equal(t, []string{"CodeDirectory Header", "Identifier: com.ex", "Team ID: TEAM", "Special Slots (7)", "Code Slots (2)"}, names(cd.Content))
+	header := cd.Content[0]
+	assert.Equal(t, uint64(52), header.Size)
+	assert.Equal(t, "0x2 (ADHOC)", contractstest.FindValue(t, header, "Flags").Value)
+	assert.Equal(t, `"SHA-256"`, contractstest.FindValue(t, header, "Hash Type").Value)
+
+	// Special slots are in reverse order, only the ones with a blob are linked
+	special := cd.Content[3]
+	assert.Equal(t, uintptr(0x101c+64), special.Address)
+	require.Len(t, special.Content, 7)
+	assert.Equal(t, "Special Slot 7 (DER Entitlements)", special.Content[0].Name)
+	entitlements := special.Content[2]
+	assert.Equal(t, "Special Slot 5 (Entitlements)", entitlements.Name)
+	assert.Equal(t, uint64(8), entitlements.ParentOffset)
+	hash := contractstest.FindValue(t, entitlements, "Hash")
+	assert.Equal(t, `"05000000"`, hash.Value)
+	require.Len(t, hash.Links, 1)
+	assert.Equal(t, uint64(root.Content[3].Address), hash.Links[0].TargetAddress)
+	assert.Empty(t, contractstest.FindValue(t, special.Content[0], "Hash").Links)
+
+	// Code slots are linked to the page they hash
+	code := cd.Content[4]
+	assert.Equal(t, uintptr(0x101c+92), code.Address)
+	require.Len(t, code.Content, 2)
+	hash = contractstest.FindValue(t, code.Content[1], "Hash")
+	assert.Equal(t, `"bbbbbbbb"`, hash.Value)
+	require.Len(t, hash.Links, 1)
+	assert.Equal(t, uint64(0x8000+0x1000), hash.Links[0].TargetAddress)
+
+	// Too many code slots to detail
+	root, err = machoutils.ParseCodeSignature(data, 0x1000, machoutils.CodeSignatureOptions{TooBig: 1})
+	require.NoError(t, err)
+	assert.Empty(t, root.Content[2].Content[4].Content)
+}
+
+func Test_ParseCodeSignature_invalid(t *testing.T) {
+	cases := map[string][]byte{
+		"magic":     genericBlob(machoutils.CSMAGIC_CODEDIRECTORY, nil),
+		"truncated": superBlob(uint32(machoutils.CSSLOT_CODEDIRECTORY), codeDirectory())[:0x20],
+		"blob":      superBlob(uint32(machoutils.CSSLOT_CODEDIRECTORY), codeDirectory()[:90]),
+	}
+	for name, data := range cases {
+		t.Run(name, func(t *testing.T) {
+			_, err := machoutils.ParseCodeSignature(data, 0, machoutils.CodeSignatureOptions{})
+			assert.Error(t, err)
+		})
+	}
+}
@@ -0,0 +1,272 @@
+package machoutils
+
+import (
+	"fmt"
+	"strings"
+)
+
+// From Apple's xnu/osfmk/kern/cs_blobs.h, everything is big-endian
+
+const (
+	CSMAGIC_REQUIREMENT                = 0xfade0c00 // single Requirement blob
+	CSMAGIC_REQUIREMENTS               = 0xfade0c01 // Requirements vector (internal requirements)
+	CSMAGIC_CODEDIRECTORY              = 0xfade0c02 // CodeDirectory blob
+	CSMAGIC_EMBEDDED_SIGNATURE         = 0xfade0cc0 // embedded form of signature data
+	CSMAGIC_DETACHED_SIGNATURE         = 0xfade0cc1 // multi-arch collection of embedded signatures
+	CSMAGIC_BLOBWRAPPER                = 0xfade0b01 // CMS Signature, among other things
+	CSMAGIC_EMBEDDED_ENTITLEMENTS      = 0xfade7171 // embedded entitlements (XML)
+	CSMAGIC_EMBEDDED_DER_ENTITLEMENTS  = 0xfade7172 // embedded entitlements (DER)
+	CSMAGIC_EMBEDDED_LAUNCH_CONSTRAINT = 0xfade8181 // launch constraints (DER)
+)
+
+const (
+	CSSLOT_CODEDIRECTORY                 = 0
+	CSSLOT_INFOSLOT                      = 1
+	CSSLOT_REQUIREMENTS                  = 2
+	CSSLOT_RESOURCEDIR                   = 3
+	CSSLOT_APPLICATION                   = 4
+	CSSLOT_ENTITLEMENTS                  = 5
+	CSSLOT_DER_ENTITLEMENTS              = 7
+	CSSLOT_LAUNCH_CONSTRAINT_SELF        = 8
+	CSSLOT_LAUNCH_CONSTRAINT_PARENT      = 9
+	CSSLOT_LAUNCH_CONSTRAINT_RESPONSIBLE = 10
+	CSSLOT_LIBRARY_CONSTRAINT            = 11
+	CSSLOT_ALTERNATE_CODEDIRECTORIES     = 0x1000
+	CSSLOT_ALTERNATE_CODEDIRECTORY_MAX   = 5
+	CSSLOT_SIGNATURESLOT                 = 0x10000
+	CSSLOT_IDENTIFICATIONSLOT            = 0x10001
+	CSSLOT_TICKETSLOT                    = 0x10002
+)
+
+const (
+	CS_SUPPORTSSCATTER     = 0x20100
+	CS_SUPPORTSTEAMID      = 0x20200
+	CS_SUPPORTSCODELIMIT64 = 0x20300
+	CS_SUPPORTSEXECSEG     = 0x20400
+	CS_SUPPORTSRUNTIME     = 0x20500
+	CS_SUPPORTSLINKAGE     = 0x20600
+)
+
+// Sizes of the CodeDirectory header depending on its version
+const (
+	codeDirectoryBaseSize  = 44
+	codeDirectoryScatter   = 48
+	codeDirectoryTeamID    = 52
+	codeDirectoryCodeLimit = 64
+	codeDirectoryExecSeg   = 88
+	codeDirectoryRuntime   = 96
+	codeDirectoryLinkage   = 108
+)
+
+type CSSuperBlob struct {
+	Magic  uint32 `struc:"big"`
+	Length uint32 `struc:"big"` // total length of SuperBlob
+	Count  uint32 `struc:"big"` // number of index entries following
+}
+
+type CSBlobIndex struct {
+	Type   uint32 `struc:"big"` // type of entry
+	Offset uint32 `struc:"big"` // offset of entry
+}
+
+type CSGenericBlob struct {
+	Magic  uint32 `struc:"big"`
+	Length uint32 `struc:"big"`
+}
+
+type CSCodeDirectoryFlags uint32
+
+var codeDirectoryFlags = []struct {
+	flag CSCodeDirectoryFlags
+	name string
+}{
+	{0x1, "VALID"},
+	{0x2, "ADHOC"},
+	{0x4, "GET_TASK_ALLOW"},
+	{0x8, "INSTALLER"},
+	{0x10, "FORCED_LV"},
+	{0x20, "INVALID_ALLOWED"},
+	{0x100, "HARD"},
+	{0x200, "KILL"},
+	{0x400, "CHECK_EXPIRATION"},
+	{0x800, "RESTRICT"},
+	{0x1000, "ENFORCEMENT"},
+	{0x2000, "REQUIRE_LV"},
+	{0x4000, "ENTITLEMENTS_VALIDATED"},
+	{0x8000, "NVRAM_UNRESTRICTED"},
+	{0x10000, "RUNTIME"},
+	{0x20000, "LINKER_SIGNED"},
+}
+
+func (me CSCodeDirectoryFlags) String() string {
+	names := []string{}
+	left := me
+	for _, flag := range codeDirectoryFlags {
+		if me&flag.flag != 0 {
+			names = append(names, flag.name)
+			left &^= flag.flag
+		}
+	}
+	if left != 0 {
+		names = append(names, fmt.Sprintf("%#x", uint32(left)))
+	}
+	return fmt.Sprintf("%#x (%s)", uint32(me), strings.Join(names, "|"))
+}
+
+type CSCodeDirectory struct {
+	Magic         uint32               `struc:"big"` // magic number (CSMAGIC_CODEDIRECTORY)
+	Length        uint32               `struc:"big"` // total length of CodeDirectory blob
+	Version       uint32               `struc:"big"` // compatibility version
+	Flags         CSCodeDirectoryFlags `struc:"big"` // setup and mode flags
+	HashOffset    uint32               `struc:"big"` // offset of hash slot element at index zero
+	IdentOffset   uint32               `struc:"big"` // offset of identifier string
+	NSpecialSlots uint32               `struc:"big"` // number of special hash slots
+	NCodeSlots    uint32               `struc:"big"` // number of ordinary (code) hash slots
+	CodeLimit     uint32               `struc:"big"` // limit to main image signature range
+	HashSize      uint8                `struc:"big"` // size of each hash in bytes
+	HashType      uint8                `struc:"big"` // type of hash (cdHashType* constants)
+	Platform      uint8                `struc:"big"` // platform identifier; zero if not platform binary
+	PageSize      uint8                `struc:"big"` // log2(page size in bytes); 0 => infinite
+	Spare2        uint32               `struc:"big"` // unused (must be zero)
+	// Version 0x20100
+	ScatterOffset uint32 `struc:"big"` // offset of optional scatter vector
+	// Version 0x20200
+	TeamOffset uint32 `struc:"big"` // offset of optional team identifier
+	// Version 0x20300
+	Spare3      uint32 `struc:"big"` // unused (must be zero)
+	CodeLimit64 uint64 `struc:"big"` // limit to main image signature range, 64 bits
+	// Version 0x20400
+	ExecSegBase  uint64 `struc:"big"` // offset of executable segment
+	ExecSegLimit uint64 `struc:"big"` // limit of executable segment
+	ExecSegFlags uint64 `struc:"big"` // executable segment flags
+	// Version 0x20500
+	Runtime          uint32 `struc:"big"`
+	PreEncryptOffset uint32 `struc:"big"` // offset of pre-encrypt hash slots
+	// Version 0x20600
+	LinkageHashType           uint8  `struc:"big"`
+	LinkageApplicationType    uint8  `struc:"big"`
+	LinkageApplicationSubType uint16 `struc:"big"`
+	LinkageOffset             uint32 `struc:"big"`
+	LinkageSize               uint32 `struc:"big"`
+}
+
+func (me CSCodeDirectory) HeaderSize() uint64 {
+	switch {
+	case me.Version >= CS_SUPPORTSLINKAGE:
+		return codeDirectoryLinkage
+	case me.Version >= CS_SUPPORTSRUNTIME:
+		return codeDirectoryRuntime
+	case me.Version >= CS_SUPPORTSEXECSEG:
+		return codeDirectoryExecSeg
+	case me.Version >= CS_SUPPORTSCODELIMIT64:
+		return codeDirectoryCodeLimit
+	case me.Version >= CS_SUPPORTSTEAMID:
+		return codeDirectoryTeamID
+	case me.Version >= CS_SUPPORTSSCATTER:
+		return codeDirectoryScatter
+	}
+	return codeDirectoryBaseSize
+}
+
+type CSRequirements struct {
+	Magic  uint32 `struc:"big"`
+	Length uint32 `struc:"big"`
+	Count  uint32 `struc:"big"`
+}
+
+type CSRequirement struct {
+	Magic  uint32 `struc:"big"`
+	Length uint32 `struc:"big"`
+	Kind   uint32 `struc:"big"` // 1 = expression
+}
+
+func CSMagicName(magic uint32) string {
+	switch magic {
+	case CSMAGIC_REQUIREMENT:
+		return "Requirement"
+	case CSMAGIC_REQUIREMENTS:
+		return "Requirements"
+	case CSMAGIC_CODEDIRECTORY:
+		return "CodeDirectory"
+	case CSMAGIC_EMBEDDED_SIGNATURE:
+		return "Embedded Signature"
+	case CSMAGIC_DETACHED_SIGNATURE:
+		return "Detached Signature"
+	case CSMAGIC_BLOBWRAPPER:
+		return "CMS Signature"
+	case CSMAGIC_EMBEDDED_ENTITLEMENTS:
+		return "Entitlements"
+	case CSMAGIC_EMBEDDED_DER_ENTITLEMENTS:
+		return "DER Entitlements"
+	case CSMAGIC_EMBEDDED_LAUNCH_CONSTRAINT:
+		return "Launch Constraint"
+	}
+	return fmt.Sprintf("Unknown Blob %#x", magic)
+}
+
+func CSSlotName(slot uint32) string {
+	switch slot {
+	case CSSLOT_CODEDIRECTORY:
+		return "CodeDirectory"
+	case CSSLOT_INFOSLOT:
+		return "Info.plist"
+	case CSSLOT_REQUIREMENTS:
+		return "Requirements"
+	case CSSLOT_RESOURCEDIR:
+		return "Resources"
+	case CSSLOT_APPLICATION:
+		return "Application"
+	case CSSLOT_ENTITLEMENTS:
+		return "Entitlements"
+	case CSSLOT_DER_ENTITLEMENTS:
+		return "DER Entitlements"
+	case CSSLOT_LAUNCH_CONSTRAINT_SELF:
+		return "Launch Constraint (Self)"
+	case CSSLOT_LAUNCH_CONSTRAINT_PARENT:
+		return "Launch Constraint (Parent)"
+	case CSSLOT_LAUNCH_CONSTRAINT_RESPONSIBLE:
+		return "Launch Constraint (Responsible)"
+	case CSSLOT_LIBRARY_CONSTRAINT:
+		return "Library Constraint"
+	case CSSLOT_SIGNATURESLOT:
+		return "CMS Signature"
+	case CSSLOT_IDENTIFICATIONSLOT:
+		return "Identification"
+	case CSSLOT_TICKETSLOT:
+		return "Ticket"
+	}
+	if slot >= CSSLOT_ALTERNATE_CODEDIRECTORIES && slot < CSSLOT_ALTERNATE_CODEDIRECTORIES+CSSLOT_ALTERNATE_CODEDIRECTORY_MAX {
+		return fmt.Sprintf("Alternate CodeDirectory %d", slot-CSSLOT_ALTERNATE_CODEDIRECTORIES)
+	}
+	return fmt.Sprintf("Slot %#x", slot)
+}
+
+func CSHashTypeName(hashType uint8) string {
+	switch hashType {
+	case 1:
+		return "SHA-1"
+	case 2:
+		return "SHA-256"
+	case 3:
+		return "SHA-256 (truncated)"
+	case 4:
+		return "SHA-384"
+	}
+	return fmt.Sprintf("Unknown %d", hashType)
+}
+
+func CSRequirementTypeName(reqType uint32) string {
+	switch reqType {
+	case 1:
+		return "Host"
+	case 2:
+		return "Guest"
+	case 3:
+		return "Designated"
+	case 4:
+		return "Library"
+	case 5:
+		return "Plugin"
+	}
+	return fmt.Sprintf("Unknown %d", reqType)
+}
@@ -0,0 +1,102 @@
+package machoutils
+
+import (
+	"fmt"
+
+	"github.com/LouisBrunner/mem-viz/pkg/contracts"
+	"github.com/LouisBrunner/mem-viz/pkg/parsingutils"
+)
+
+// From Apple's mach-o/loader.h
+
+const (
+	DICE_KIND_DATA             = 0x0001
+	DICE_KIND_JUMP_TABLE8      = 0x0002
+	DICE_KIND_JUMP_TABLE16     = 0x0003
+	DICE_KIND_JUMP_TABLE32     = 0x0004
+	DICE_KIND_ABS_JUMP_TABLE32 = 0x0005
+)
+
+const DataInCodeEntrySize = 8
+
+func DataInCodeKindName(kind uint16) string {
+	switch kind {
+	case DICE_KIND_DATA:
+		return "DATA"
+	case DICE_KIND_JUMP_TABLE8:
+		return "JUMP_TABLE8"
+	case DICE_KIND_JUMP_TABLE16:
+		return "JUMP_TABLE16"
+	case DICE_KIND_JUMP_TABLE32:
+		return "JUMP_TABLE32"
+	case DICE_KIND_ABS_JUMP_TABLE32:
+		return "ABS_JUMP_TABLE32"
+	}
+	return fmt.Sprintf("Unknown %d", kind)
+}
+
+// A decoded data_in_code_entry
+type DataInCode struct {
+	Offset uint32 // from the mach header
+	Length uint16
+	Kind   uint16
+}
+
+// Name of the range it marks (e.g. "Jump Table (JUMP_TABLE32)" or "Literal Pool (DATA)")
+func (me DataInCode) Label() string {
+	if me.Kind == DICE_KIND_DATA {
+		return fmt.Sprintf("Literal Pool (%s)", DataInCodeKindName(me.Kind))
+	}
+	return fmt.Sprintf("Jump Table (%s)", DataInCodeKindName(me.Kind))
+}
+
+type DataInCodeOptions struct {
+	ByteOrder parsingutils.ByteOrder
+	// Turns an offset from the image's mach header into an address we can link to, false if it isn't mapped
+	Resolve func(offset uint64) (uintptr, bool)
+	// Entries are not detailed if there are more than this (0 means no limit)
+	TooBig uint64
+}
+
+// Parses the data_in_code_entry array of LC_DATA_IN_CODE, data must contain exactly the entries.
+// The decoded entries are also returned so callers can mark the ranges inside the text
+func ParseDataInCode(data []byte, address uintptr, options DataInCodeOptions) (*contracts.MemoryBlock, []DataInCode, error) {
+	if uint64(len(data))%DataInCodeEntrySize != 0 {
+		return nil, nil, fmt.Errorf("data in code size %#x is not a multiple of %d", len(data), DataInCodeEntrySize)
+	}
+	order := parsingutils.OrLittleEndian(options.ByteOrder)
+	count := uint64(len(data)) / DataInCodeEntrySize
+	entries := make([]DataInCode, 0, count)
+	for i := uint64(0); i < count; i += 1 {
+		raw := data[i*DataInCodeEntrySize:]
+		entries = append(entries, DataInCode{
+			Offset: order.Uint32(raw),
+			Length: order.Uint16(raw[4:]),
+			Kind:   order.Uint16(raw[6:]),
+		})
+	}
+
+	root := newBlock(fmt.Sprintf("Data In Code (%d entries)", count), address, uint64(len(data)))
+	if options.TooBig != 0 && count > options.TooBig {
+		return root, entries, nil
+	}
+
+	for i, entry := range entries {
+		block := addChild(root, fmt.Sprintf("Data In Code %s (+%#x)", DataInCodeKindName(entry.Kind), entry.Offset), uint64(i)*DataInCodeEntrySize, DataInCodeEntrySize)
+		addValue(block, "Offset", entry.Offset, 0, 4)
+		addValue(block, "Length", entry.Length, 4, 2)
+		addValue(block, "Kind", DataInCodeKindName(entry.Kind), 6, 2)
+		if options.Resolve == nil {
+			continue
+		}
+		target, mapped := options.Resolve(uint64(entry.Offset))
+		if !mapped {
+			continue
+		}
+		err := parsingutils.AddLinkWithAddr(block, "Offset", "marks", target)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return root, entries, nil
+}
@@ -0,0 +1,56 @@
+package machoutils_test
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/LouisBrunner/mem-viz/pkg/machoutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_ParseDataInCode(t *testing.T) {
+	data := []byte{
+		0x78, 0x00, 0x00, 0x00, 0x10, 0x00, 0x04, 0x00, // JUMP_TABLE32 at 0x78
+		0xa0, 0x00, 0x00, 0x00, 0x08, 0x00, 0x01, 0x00, // DATA at 0xa0
+	}
+	tree, entries, err := machoutils.ParseDataInCode(data, 0x330, machoutils.DataInCodeOptions{
+		Resolve: func(offset uint64) (uintptr, bool) {
+			return uintptr(0x1000 + offset), true
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "Data In Code (2 entries)", tree.Name)
+	assert.Equal(t, []machoutils.DataInCode{
+		{Offset: 0x78, Length: 0x10, Kind: machoutils.DICE_KIND_JUMP_TABLE32},
+		{Offset: 0xa0, Length: 0x8, Kind: machoutils.DICE_KIND_DATA},
+	}, entries)
+	assert.Equal(t, "Jump Table (JUMP_TABLE32)", entries[0].Label())
+	assert.Equal(t, "Literal Pool (DATA)", entries[1].Label())
+	require.Len(t, tree.Content, 2)
+
+	table := tree.Content[0]
+	assert.Equal(t, "Data In Code JUMP_TABLE32 (+0x78)", table.Name)
+	assert.Equal(t, `"JUMP_TABLE32"`, table.Values[2].Value)
+	require.Len(t, table.Values[0].Links, 1)
+	assert.Equal(t, uint64(0x1078), table.Values[0].Links[0].TargetAddress)
+
+	pool := tree.Content[1]
+	assert.Equal(t, uintptr(0x338), pool.Address)
+	assert.Equal(t, "Data In Code DATA (+0xa0)", pool.Name)
+}
+
+func Test_ParseDataInCode_bigEndian(t *testing.T) {
+	data := make([]byte, 8)
+	binary.BigEndian.PutUint32(data, 0x40)
+	binary.BigEndian.PutUint16(data[4:], 4)
+	binary.BigEndian.PutUint16(data[6:], machoutils.DICE_KIND_JUMP_TABLE8)
+	_, entries, err := machoutils.ParseDataInCode(data, 0, machoutils.DataInCodeOptions{ByteOrder: binary.BigEndian})
+	require.NoError(t, err)
+	assert.Equal(t, []machoutils.DataInCode{{Offset: 0x40, Length: 4, Kind: machoutils.DICE_KIND_JUMP_TABLE8}}, entries)
+}
+
+func Test_ParseDataInCode_invalidSize(t *testing.T) {
+	_, _, err := machoutils.ParseDataInCode(make([]byte, 6), 0, machoutils.DataInCodeOptions{})
+	assert.Error(t, err)
+}
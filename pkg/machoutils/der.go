@@ -0,0 +1,201 @@
+package machoutils
+
+import (
+	"fmt"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/LouisBrunner/mem-viz/pkg/contracts"
+)
+
+// Minimal DER walker, only used to show the structure of DER entitlements, launch constraints and CMS signatures
+
+const derMaxPreview = 64
+
+var derUniversalTags = map[uint64]string{
+	1:  "BOOLEAN",
+	2:  "INTEGER",
+	3:  "BIT STRING",
+	4:  "OCTET STRING",
+	5:  "NULL",
+	6:  "OBJECT IDENTIFIER",
+	10: "ENUMERATED",
+	12: "UTF8String",
+	16: "SEQUENCE",
+	17: "SET",
+	19: "PrintableString",
+	22: "IA5String",
+	23: "UTCTime",
+	24: "GeneralizedTime",
+}
+
+type derHeader struct {
+	class       uint8
+	constructed bool
+	tag         uint64
+	tagSize     uint64
+	headerSize  uint64
+	length      uint64
+}
+
+func readDERHeader(data []byte, offset uint64) (*derHeader, error) {
+	if offset >= uint64(len(data)) {
+		return nil, fmt.Errorf("out of bounds: %#x >= %#x", offset, len(data))
+	}
+	first := data[offset]
+	header := &derHeader{
+		class:       first >> 6,
+		constructed: first&0x20 != 0,
+		tag:         uint64(first & 0x1f),
+	}
+	cursor := offset + 1
+	if header.tag == 0x1f {
+		header.tag = 0
+		for {
+			if cursor >= uint64(len(data)) {
+				return nil, fmt.Errorf("truncated DER tag at %#x", offset)
+			}
+			b := data[cursor]
+			cursor += 1
+			header.tag = header.tag<<7 | uint64(b&0x7f)
+			if b&0x80 == 0 {
+				break
+			}
+		}
+	}
+	header.tagSize = cursor - offset
+
+	if cursor >= uint64(len(data)) {
+		return nil, fmt.Errorf("truncated DER length at %#x", offset)
+	}
+	first = data[cursor]
+	cursor += 1
+	if first&0x80 == 0 {
+		header.length = uint64(first)
+	} else {
+		n := uint64(first & 0x7f)
+		if n == 0 || n > 8 {
+			return nil, fmt.Errorf("unsupported DER length encoding %#x at %#x", first, offset)
+		}
+		if cursor+n > uint64(len(data)) {
+			return nil, fmt.Errorf("truncated DER length at %#x", offset)
+		}
+		for _, b := range data[cursor : cursor+n] {
+			header.length = header.length<<8 | uint64(b)
+		}
+		cursor += n
+	}
+	header.headerSize = cursor - offset
+
+	if header.length > uint64(len(data))-cursor {
+		return nil, fmt.Errorf("DER element at %#x is too long (%#x)", offset, header.length)
+	}
+	return header, nil
+}
+
+func (me derHeader) name() string {
+	switch me.class {
+	case 0:
+		if name, found := derUniversalTags[me.tag]; found {
+			return name
+		}
+		return fmt.Sprintf("[UNIVERSAL %d]", me.tag)
+	case 1:
+		return fmt.Sprintf("[APPLICATION %d]", me.tag)
+	case 2:
+		return fmt.Sprintf("[%d]", me.tag)
+	}
+	return fmt.Sprintf("[PRIVATE %d]", me.tag)
+}
+
+func (me derHeader) preview(content []byte) string {
+	if me.class != 0 || me.constructed {
+		return ""
+	}
+	switch me.tag {
+	case 1:
+		return strconv.FormatBool(len(content) > 0 && content[0] != 0)
+	case 2, 10:
+		if len(content) > 8 {
+			return fmt.Sprintf("(%d bytes)", len(content))
+		}
+		value := int64(0)
+		for i, b := range content {
+			if i == 0 {
+				value = int64(int8(b))
+				continue
+			}
+			value = value<<8 | int64(b)
+		}
+		return strconv.FormatInt(value, 10)
+	case 6:
+		return formatOID(content)
+	case 12, 19, 22, 23, 24:
+		if !utf8.Valid(content) {
+			return ""
+		}
+		str := string(content)
+		if len(str) > derMaxPreview {
+			str = str[:derMaxPreview] + "..."
+		}
+		return strconv.Quote(str)
+	}
+	return ""
+}
+
+func formatOID(content []byte) string {
+	if len(content) == 0 {
+		return ""
+	}
+	str := fmt.Sprintf("%d.%d", content[0]/40, content[0]%40)
+	value := uint64(0)
+	for _, b := range content[1:] {
+		value = value<<7 | uint64(b&0x7f)
+		if b&0x80 == 0 {
+			str += fmt.Sprintf(".%d", value)
+			value = 0
+		}
+	}
+	return str
+}
+
+// Adds each DER element found in data as a child of parent (data starts at base inside parent), recursing up to maxDepth levels (0 means unlimited)
+func addDER(parent *contracts.MemoryBlock, data []byte, base uint64, maxDepth int) error {
+	return addDERLevel(parent, data, base, maxDepth, 1)
+}
+
+func addDERLevel(parent *contracts.MemoryBlock, data []byte, base uint64, maxDepth, depth int) error {
+	offset := uint64(0)
+	for offset < uint64(len(data)) {
+		// Signatures are usually zero-padded
+		if data[offset] == 0 {
+			addChild(parent, "Padding", base+offset, uint64(len(data))-offset)
+			break
+		}
+
+		header, err := readDERHeader(data, offset)
+		if err != nil {
+			return err
+		}
+
+		contentOffset := offset + header.headerSize
+		content := data[contentOffset : contentOffset+header.length]
+		name := header.name()
+		if preview := header.preview(content); preview != "" {
+			name = fmt.Sprintf("%s %s", name, preview)
+		}
+		element := addChild(parent, name, base+offset, header.headerSize+header.length)
+		addValue(element, "Tag", header.tag, 0, uint8(header.tagSize))
+		addValue(element, "Length", header.length, header.tagSize, uint8(header.headerSize-header.tagSize))
+
+		if header.constructed && header.length > 0 && (maxDepth == 0 || depth < maxDepth) {
+			err = addDERLevel(element, content, header.headerSize, maxDepth, depth+1)
+			if err != nil {
+				return err
+			}
+		}
+
+		offset = contentOffset + header.length
+	}
+	return nil
+}
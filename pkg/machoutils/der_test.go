@@ -0,0 +1,79 @@
+package machoutils_test
+
+import (
+	"testing"
+
+	"github.com/LouisBrunner/mem-viz/pkg/contracts/contractstest"
+	"github.com/LouisBrunner/mem-viz/pkg/machoutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_ParseCodeSignature_derEntitlements(t *testing.T) {
+	// [APPLICATION 16] { INTEGER 1, [16] { SEQUENCE { UTF8String "key", BOOLEAN true } } }
+	der := []byte{
+		0x70, 0x0f,
+		0x02, 0x01, 0x01,
+		0xb0, 0x0a,
+		0x30, 0x08,
+		0x0c, 0x03, 'k', 'e', 'y',
+		0x01, 0x01, 0xff,
+	}
+	data := superBlob(uint32(machoutils.CSSLOT_DER_ENTITLEMENTS), genericBlob(machoutils.CSMAGIC_EMBEDDED_DER_ENTITLEMENTS, der))
+	root, err := machoutils.ParseCodeSignature(data, 0, machoutils.CodeSignatureOptions{})
+	require.NoError(t, err)
+
+	blob := root.Content[2]
+	assert.Equal(t, "DER Entitlements", blob.Name)
+	assert.Equal(t, []string{"DER Entitlements Header", "[APPLICATION 16]"}, names(blob.Content))
+	app := blob.Content[1]
+	assert.Equal(t, uint64(8), app.ParentOffset)
+	assert.Equal(t, uint64(len(der)), app.Size)
+	assert.Equal(t, "0x10", contractstest.FindValue(t, app, "Tag").Value)
+	assert.Equal(t, "0xf", contractstest.FindValue(t, app, "Length").Value)
+	assert.Equal(t, []string{"INTEGER 1", "[16]"}, names(app.Content))
+
+	dict := app.Content[1]
+	assert.Equal(t, uint64(5), dict.ParentOffset)
+	require.Len(t, dict.Content, 1)
+	entry := dict.Content[0]
+	assert.Equal(t, "SEQUENCE", entry.Name)
+	assert.Equal(t, []string{`UTF8String "key"`, "BOOLEAN true"}, names(entry.Content))
+	assert.Equal(t, uintptr(root.Address+0x14+8+9), entry.Content[0].Address)
+}
+
+func Test_ParseCodeSignature_cms(t *testing.T) {
+	// A long-form length followed by padding, only the first level is shown
+	cms := []byte{0x30, 0x81, 0x03, 0x02, 0x01, 0x05, 0x00, 0x00}
+	data := superBlob(uint32(machoutils.CSSLOT_SIGNATURESLOT), genericBlob(machoutils.CSMAGIC_BLOBWRAPPER, cms))
+	root, err := machoutils.ParseCodeSignature(data, 0, machoutils.CodeSignatureOptions{CMSDepth: 1})
+	require.NoError(t, err)
+
+	blob := root.Content[2]
+	assert.Equal(t, []string{"CMS Signature Header", "SEQUENCE", "Padding"}, names(blob.Content))
+	sequence := blob.Content[1]
+	assert.Equal(t, uint64(6), sequence.Size)
+	length := contractstest.FindValue(t, sequence, "Length")
+	assert.Equal(t, uint64(1), length.Offset)
+	assert.Equal(t, uint8(2), length.Size)
+	assert.Empty(t, sequence.Content)
+
+	root, err = machoutils.ParseCodeSignature(data, 0, machoutils.CodeSignatureOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"INTEGER 5"}, names(root.Content[2].Content[1].Content))
+}
+
+func Test_ParseCodeSignature_invalidDER(t *testing.T) {
+	cases := map[string][]byte{
+		"length":   {0x30, 0x05, 0x02, 0x01},
+		"encoding": {0x30, 0x80},
+		"tag":      {0x1f, 0x81},
+	}
+	for name, der := range cases {
+		t.Run(name, func(t *testing.T) {
+			data := superBlob(uint32(machoutils.CSSLOT_DER_ENTITLEMENTS), genericBlob(machoutils.CSMAGIC_EMBEDDED_DER_ENTITLEMENTS, der))
+			_, err := machoutils.ParseCodeSignature(data, 0, machoutils.CodeSignatureOptions{})
+			assert.Error(t, err)
+		})
+	}
+}
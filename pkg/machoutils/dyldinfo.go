@@ -0,0 +1,410 @@
+package machoutils
+
+import (
+	"fmt"
+
+	"github.com/LouisBrunner/mem-viz/pkg/contracts"
+	subcontracts "github.com/LouisBrunner/mem-viz/pkg/dsc-viz/contracts"
+	"github.com/LouisBrunner/mem-viz/pkg/parsingutils"
+)
+
+type DYLDInfoStream int
+
+const (
+	RebaseStream DYLDInfoStream = iota
+	BindStream
+	WeakBindStream
+	LazyBindStream
+)
+
+func (me DYLDInfoStream) String() string {
+	switch me {
+	case RebaseStream:
+		return "Rebase"
+	case BindStream:
+		return "Bind"
+	case WeakBindStream:
+		return "Weak Bind"
+	case LazyBindStream:
+		return "Lazy Bind"
+	}
+	return fmt.Sprintf("Unknown %d", me)
+}
+
+type DYLDInfoSegment struct {
+	Name    string
+	Address uint64
+}
+
+type DYLDInfoOptions struct {
+	// Segments in load command order, as referenced by the opcodes
+	Segments []DYLDInfoSegment
+	// Size of the pointers being rebased or bound (0 means 8)
+	PointerSize uint64
+	Resolve     parsingutils.Resolver
+	// Actions are not detailed if there are more than this (0 means no limit)
+	TooBig uint64
+}
+
+var rebaseOpcodeNames = map[byte]string{
+	subcontracts.REBASE_OPCODE_DONE:                               "REBASE_OPCODE_DONE",
+	subcontracts.REBASE_OPCODE_SET_TYPE_IMM:                       "REBASE_OPCODE_SET_TYPE_IMM",
+	subcontracts.REBASE_OPCODE_SET_SEGMENT_AND_OFFSET_ULEB:        "REBASE_OPCODE_SET_SEGMENT_AND_OFFSET_ULEB",
+	subcontracts.REBASE_OPCODE_ADD_ADDR_ULEB:                      "REBASE_OPCODE_ADD_ADDR_ULEB",
+	subcontracts.REBASE_OPCODE_ADD_ADDR_IMM_SCALED:                "REBASE_OPCODE_ADD_ADDR_IMM_SCALED",
+	subcontracts.REBASE_OPCODE_DO_REBASE_IMM_TIMES:                "REBASE_OPCODE_DO_REBASE_IMM_TIMES",
+	subcontracts.REBASE_OPCODE_DO_REBASE_ULEB_TIMES:               "REBASE_OPCODE_DO_REBASE_ULEB_TIMES",
+	subcontracts.REBASE_OPCODE_DO_REBASE_ADD_ADDR_ULEB:            "REBASE_OPCODE_DO_REBASE_ADD_ADDR_ULEB",
+	subcontracts.REBASE_OPCODE_DO_REBASE_ULEB_TIMES_SKIPPING_ULEB: "REBASE_OPCODE_DO_REBASE_ULEB_TIMES_SKIPPING_ULEB",
+}
+
+var bindOpcodeNames = map[byte]string{
+	subcontracts.BIND_OPCODE_DONE:                             "BIND_OPCODE_DONE",
+	subcontracts.BIND_OPCODE_SET_DYLIB_ORDINAL_IMM:            "BIND_OPCODE_SET_DYLIB_ORDINAL_IMM",
+	subcontracts.BIND_OPCODE_SET_DYLIB_ORDINAL_ULEB:           "BIND_OPCODE_SET_DYLIB_ORDINAL_ULEB",
+	subcontracts.BIND_OPCODE_SET_DYLIB_SPECIAL_IMM:            "BIND_OPCODE_SET_DYLIB_SPECIAL_IMM",
+	subcontracts.BIND_OPCODE_SET_SYMBOL_TRAILING_FLAGS_IMM:    "BIND_OPCODE_SET_SYMBOL_TRAILING_FLAGS_IMM",
+	subcontracts.BIND_OPCODE_SET_TYPE_IMM:                     "BIND_OPCODE_SET_TYPE_IMM",
+	subcontracts.BIND_OPCODE_SET_ADDEND_SLEB:                  "BIND_OPCODE_SET_ADDEND_SLEB",
+	subcontracts.BIND_OPCODE_SET_SEGMENT_AND_OFFSET_ULEB:      "BIND_OPCODE_SET_SEGMENT_AND_OFFSET_ULEB",
+	subcontracts.BIND_OPCODE_ADD_ADDR_ULEB:                    "BIND_OPCODE_ADD_ADDR_ULEB",
+	subcontracts.BIND_OPCODE_DO_BIND:                          "BIND_OPCODE_DO_BIND",
+	subcontracts.BIND_OPCODE_DO_BIND_ADD_ADDR_ULEB:            "BIND_OPCODE_DO_BIND_ADD_ADDR_ULEB",
+	subcontracts.BIND_OPCODE_DO_BIND_ADD_ADDR_IMM_SCALED:      "BIND_OPCODE_DO_BIND_ADD_ADDR_IMM_SCALED",
+	subcontracts.BIND_OPCODE_DO_BIND_ULEB_TIMES_SKIPPING_ULEB: "BIND_OPCODE_DO_BIND_ULEB_TIMES_SKIPPING_ULEB",
+	subcontracts.BIND_OPCODE_THREADED:                         "BIND_OPCODE_THREADED",
+}
+
+// Shared by REBASE_TYPE_* and BIND_TYPE_*
+func DYLDInfoTypeName(typ uint8) string {
+	switch typ {
+	case subcontracts.REBASE_TYPE_POINTER:
+		return "POINTER"
+	case subcontracts.REBASE_TYPE_TEXT_ABSOLUTE32:
+		return "TEXT_ABSOLUTE32"
+	case subcontracts.REBASE_TYPE_TEXT_PCREL32:
+		return "TEXT_PCREL32"
+	}
+	return fmt.Sprintf("Unknown %d", typ)
+}
+
+func libOrdinalName(ordinal int64) string {
+	switch ordinal {
+	case subcontracts.BIND_SPECIAL_DYLIB_SELF:
+		return "SELF"
+	case subcontracts.BIND_SPECIAL_DYLIB_MAIN_EXECUTABLE:
+		return "MAIN_EXECUTABLE"
+	case subcontracts.BIND_SPECIAL_DYLIB_FLAT_LOOKUP:
+		return "FLAT_LOOKUP"
+	case subcontracts.BIND_SPECIAL_DYLIB_WEAK_LOOKUP:
+		return "WEAK_LOOKUP"
+	}
+	return fmt.Sprintf("%d", ordinal)
+}
+
+type dyldInfoState struct {
+	typ     uint8
+	segment uint64
+	offset  uint64
+	// Bind only
+	ordinal int64
+	symbol  string
+	flags   uint8
+	addend  int64
+}
+
+type dyldInfoParser struct {
+	stream  DYLDInfoStream
+	options DYLDInfoOptions
+	data    []byte
+	root    *contracts.MemoryBlock
+	state   dyldInfoState
+	actions int
+}
+
+// Parses the rebase or bind opcodes of LC_DYLD_INFO, data must contain exactly the opcodes.
+// Each opcode gets its own block, the actions it performs are added as empty children linking to the pointer they write
+func ParseDYLDInfoOpcodes(stream DYLDInfoStream, data []byte, address uintptr, options DYLDInfoOptions) (*contracts.MemoryBlock, error) {
+	if options.PointerSize == 0 {
+		options.PointerSize = 8
+	}
+	p := dyldInfoParser{
+		stream:  stream,
+		options: options,
+		data:    data,
+		root:    newBlock("", address, uint64(len(data))),
+		state:   dyldInfoState{typ: subcontracts.REBASE_TYPE_POINTER},
+	}
+	var err error
+	if stream == RebaseStream {
+		err = p.parseRebase()
+	} else {
+		err = p.parseBind()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s opcodes: %w", stream, err)
+	}
+	p.root.Name = fmt.Sprintf("%s Opcodes (%d opcodes, %d actions)", stream, len(p.root.Content), p.actions)
+	if options.TooBig != 0 && uint64(p.actions) > options.TooBig {
+		for _, opcode := range p.root.Content {
+			opcode.Content = nil
+		}
+	}
+	return p.root, nil
+}
+
+type opcodeReader struct {
+	data   []byte
+	block  *contracts.MemoryBlock
+	start  uint64
+	cursor uint64
+}
+
+func (me *opcodeReader) uleb(name string) (uint64, error) {
+	value, size, err := ReadULEB128(me.data, me.cursor)
+	if err != nil {
+		return 0, err
+	}
+	addValue(me.block, name, value, me.cursor-me.start, uint8(min(size, 0xFF)))
+	me.cursor += size
+	return value, nil
+}
+
+func (me *opcodeReader) sleb(name string) (int64, error) {
+	value, size, err := ReadSLEB128(me.data, me.cursor)
+	if err != nil {
+		return 0, err
+	}
+	addValue(me.block, name, value, me.cursor-me.start, uint8(min(size, 0xFF)))
+	me.cursor += size
+	return value, nil
+}
+
+func (me *opcodeReader) cstring(name string) (string, error) {
+	value, err := readCString(me.data, me.cursor)
+	if err != nil {
+		return "", err
+	}
+	size := uint64(len(value) + 1)
+	addValue(me.block, name, value, me.cursor-me.start, uint8(min(size, 0xFF)))
+	me.cursor += size
+	return value, nil
+}
+
+func (me *opcodeReader) immediate(name string, value any) {
+	addValue(me.block, name, value, 0, 1)
+}
+
+func (me *dyldInfoParser) nextOpcode(offset uint64, names map[byte]string) (*opcodeReader, byte, byte) {
+	opcode := me.data[offset] & subcontracts.REBASE_OPCODE_MASK
+	immediate := me.data[offset] & subcontracts.REBASE_IMMEDIATE_MASK
+	name, found := names[opcode]
+	if !found {
+		name = fmt.Sprintf("Unknown opcode %#x", opcode)
+	}
+	block := addChild(me.root, name, offset, 1)
+	return &opcodeReader{data: me.data, block: block, start: offset, cursor: offset + 1}, opcode, immediate
+}
+
+func (me *dyldInfoParser) finishOpcode(reader *opcodeReader) {
+	reader.block.Size = reader.cursor - reader.start
+}
+
+func (me *dyldInfoParser) parseRebase() error {
+	ptrSize := me.options.PointerSize
+	for offset := uint64(0); offset < uint64(len(me.data)); {
+		reader, opcode, immediate := me.nextOpcode(offset, rebaseOpcodeNames)
+		var err error
+		done := false
+		switch opcode {
+		case subcontracts.REBASE_OPCODE_DONE:
+			done = true
+		case subcontracts.REBASE_OPCODE_SET_TYPE_IMM:
+			me.state.typ = immediate
+			reader.immediate("Type", DYLDInfoTypeName(immediate))
+		case subcontracts.REBASE_OPCODE_SET_SEGMENT_AND_OFFSET_ULEB:
+			me.state.segment = uint64(immediate)
+			reader.immediate("Segment", immediate)
+			me.state.offset, err = reader.uleb("Offset")
+		case subcontracts.REBASE_OPCODE_ADD_ADDR_ULEB:
+			var add uint64
+			add, err = reader.uleb("Offset")
+			me.state.offset += add
+		case subcontracts.REBASE_OPCODE_ADD_ADDR_IMM_SCALED:
+			reader.immediate("Scale", immediate)
+			me.state.offset += uint64(immediate) * ptrSize
+		case subcontracts.REBASE_OPCODE_DO_REBASE_IMM_TIMES:
+			reader.immediate("Count", immediate)
+			err = me.repeat(reader, uint64(immediate), 0)
+		case subcontracts.REBASE_OPCODE_DO_REBASE_ULEB_TIMES:
+			var count uint64
+			count, err = reader.uleb("Count")
+			if err == nil {
+				err = me.repeat(reader, count, 0)
+			}
+		case subcontracts.REBASE_OPCODE_DO_REBASE_ADD_ADDR_ULEB:
+			var skip uint64
+			skip, err = reader.uleb("Offset")
+			if err == nil {
+				err = me.repeat(reader, 1, skip)
+			}
+		case subcontracts.REBASE_OPCODE_DO_REBASE_ULEB_TIMES_SKIPPING_ULEB:
+			var count, skip uint64
+			count, err = reader.uleb("Count")
+			if err == nil {
+				skip, err = reader.uleb("Skip")
+			}
+			if err == nil {
+				err = me.repeat(reader, count, skip)
+			}
+		default:
+			err = fmt.Errorf("unknown opcode %#x", opcode)
+		}
+		if err != nil {
+			return fmt.Errorf("opcode at %#x: %w", offset, err)
+		}
+		me.finishOpcode(reader)
+		if done {
+			break
+		}
+		offset = reader.cursor
+	}
+	return nil
+}
+
+func (me *dyldInfoParser) parseBind() error {
+	ptrSize := me.options.PointerSize
+	for offset := uint64(0); offset < uint64(len(me.data)); {
+		reader, opcode, immediate := me.nextOpcode(offset, bindOpcodeNames)
+		var err error
+		done := false
+		switch opcode {
+		case subcontracts.BIND_OPCODE_DONE:
+			// Lazy binds are a sequence of independent entries, each ending with DONE
+			done = me.stream != LazyBindStream
+		case subcontracts.BIND_OPCODE_SET_DYLIB_ORDINAL_IMM:
+			me.state.ordinal = int64(immediate)
+			reader.immediate("LibOrdinal", libOrdinalName(me.state.ordinal))
+		case subcontracts.BIND_OPCODE_SET_DYLIB_ORDINAL_ULEB:
+			var ordinal uint64
+			ordinal, err = reader.uleb("LibOrdinal")
+			me.state.ordinal = int64(ordinal)
+		case subcontracts.BIND_OPCODE_SET_DYLIB_SPECIAL_IMM:
+			me.state.ordinal = 0
+			if immediate != 0 {
+				me.state.ordinal = int64(int8(subcontracts.BIND_OPCODE_MASK | immediate))
+			}
+			reader.immediate("LibOrdinal", libOrdinalName(me.state.ordinal))
+		case subcontracts.BIND_OPCODE_SET_SYMBOL_TRAILING_FLAGS_IMM:
+			me.state.flags = immediate
+			reader.immediate("Flags", immediate)
+			me.state.symbol, err = reader.cstring("Symbol")
+		case subcontracts.BIND_OPCODE_SET_TYPE_IMM:
+			me.state.typ = immediate
+			reader.immediate("Type", DYLDInfoTypeName(immediate))
+		case subcontracts.BIND_OPCODE_SET_ADDEND_SLEB:
+			me.state.addend, err = reader.sleb("Addend")
+		case subcontracts.BIND_OPCODE_SET_SEGMENT_AND_OFFSET_ULEB:
+			me.state.segment = uint64(immediate)
+			reader.immediate("Segment", immediate)
+			me.state.offset, err = reader.uleb("Offset")
+		case subcontracts.BIND_OPCODE_ADD_ADDR_ULEB:
+			var add uint64
+			add, err = reader.uleb("Offset")
+			me.state.offset += add
+		case subcontracts.BIND_OPCODE_DO_BIND:
+			err = me.repeat(reader, 1, 0)
+		case subcontracts.BIND_OPCODE_DO_BIND_ADD_ADDR_ULEB:
+			var skip uint64
+			skip, err = reader.uleb("Offset")
+			if err == nil {
+				err = me.repeat(reader, 1, skip)
+			}
+		case subcontracts.BIND_OPCODE_DO_BIND_ADD_ADDR_IMM_SCALED:
+			reader.immediate("Scale", immediate)
+			err = me.repeat(reader, 1, uint64(immediate)*ptrSize)
+		case subcontracts.BIND_OPCODE_DO_BIND_ULEB_TIMES_SKIPPING_ULEB:
+			var count, skip uint64
+			count, err = reader.uleb("Count")
+			if err == nil {
+				skip, err = reader.uleb("Skip")
+			}
+			if err == nil {
+				err = me.repeat(reader, count, skip)
+			}
+		case subcontracts.BIND_OPCODE_THREADED:
+			reader.immediate("SubOpcode", immediate)
+			switch immediate {
+			case subcontracts.BIND_SUBOPCODE_THREADED_SET_BIND_ORDINAL_TABLE_SIZE_ULEB:
+				_, err = reader.uleb("Count")
+			case subcontracts.BIND_SUBOPCODE_THREADED_APPLY:
+				// FIXME: threaded binds are applied by walking chains in the segments, which we don't do here
+			default:
+				err = fmt.Errorf("unknown threaded sub-opcode %#x", immediate)
+			}
+		default:
+			err = fmt.Errorf("unknown opcode %#x", opcode)
+		}
+		if err != nil {
+			return fmt.Errorf("opcode at %#x: %w", offset, err)
+		}
+		me.finishOpcode(reader)
+		if done {
+			break
+		}
+		offset = reader.cursor
+	}
+	return nil
+}
+
+// Performs count actions with the current state, skipping skip bytes after each pointer
+func (me *dyldInfoParser) repeat(reader *opcodeReader, count, skip uint64) error {
+	for i := uint64(0); i < count; i += 1 {
+		err := me.addAction(reader.block)
+		if err != nil {
+			return err
+		}
+		me.state.offset += skip + me.options.PointerSize
+	}
+	return nil
+}
+
+func (me *dyldInfoParser) addAction(opcode *contracts.MemoryBlock) error {
+	me.actions += 1
+	if me.options.TooBig != 0 && uint64(me.actions) > me.options.TooBig {
+		return nil
+	}
+
+	segmentName := fmt.Sprintf("Segment %d", me.state.segment)
+	var vmAddr uint64
+	found := false
+	if me.state.segment < uint64(len(me.options.Segments)) {
+		segment := me.options.Segments[me.state.segment]
+		segmentName = segment.Name
+		vmAddr = segment.Address + me.state.offset
+		found = true
+	}
+	slot := fmt.Sprintf("%s+%#x", segmentName, me.state.offset)
+
+	name := fmt.Sprintf("Rebase %s", slot)
+	if me.stream != RebaseStream {
+		name = fmt.Sprintf("%s %s (%s)", me.stream, me.state.symbol, slot)
+	}
+	action := addChild(opcode, name, 0, 0)
+	addValue(action, "Slot", vmAddr, 0, 0)
+	addValue(action, "Type", DYLDInfoTypeName(me.state.typ), 0, 0)
+	if me.stream != RebaseStream {
+		addValue(action, "Symbol", me.state.symbol, 0, 0)
+		addValue(action, "LibOrdinal", libOrdinalName(me.state.ordinal), 0, 0)
+		addValue(action, "Flags", me.state.flags, 0, 0)
+		addValue(action, "Addend", me.state.addend, 0, 0)
+	}
+	if !found || me.options.Resolve == nil {
+		return nil
+	}
+	target, mapped := me.options.Resolve(vmAddr)
+	if !mapped {
+		return nil
+	}
+	return parsingutils.AddLinkWithAddr(action, "Slot", "writes", target)
+}
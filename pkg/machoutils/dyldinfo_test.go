@@ -0,0 +1,110 @@
+package machoutils_test
+
+import (
+	"testing"
+
+	"github.com/LouisBrunner/mem-viz/pkg/machoutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var dyldInfoSegments = []machoutils.DYLDInfoSegment{
+	{Name: "__PAGEZERO", Address: 0},
+	{Name: "__TEXT", Address: 0x100000000},
+	{Name: "__DATA", Address: 0x100004000},
+}
+
+func Test_ReadSLEB128(t *testing.T) {
+	value, size, err := machoutils.ReadSLEB128([]byte{0xc0, 0xbb, 0x78}, 0)
+	require.NoError(t, err)
+	assert.Equal(t, int64(-123456), value)
+	assert.Equal(t, uint64(3), size)
+
+	value, _, err = machoutils.ReadSLEB128([]byte{0x02}, 0)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), value)
+}
+
+func Test_ParseDYLDInfoOpcodes_rebase(t *testing.T) {
+	data := []byte{
+		0x11,       // REBASE_OPCODE_SET_TYPE_IMM (POINTER)
+		0x22, 0x10, // REBASE_OPCODE_SET_SEGMENT_AND_OFFSET_ULEB (2, 0x10)
+		0x53,             // REBASE_OPCODE_DO_REBASE_IMM_TIMES (3)
+		0x82, 0x02, 0x08, // REBASE_OPCODE_DO_REBASE_ULEB_TIMES_SKIPPING_ULEB (2, 8)
+		0x00,       // REBASE_OPCODE_DONE
+		0x00, 0x00, // padding
+	}
+	opcodes, err := machoutils.ParseDYLDInfoOpcodes(machoutils.RebaseStream, data, 0x100, machoutils.DYLDInfoOptions{
+		Segments: dyldInfoSegments,
+		Resolve: func(vmAddr uint64) (uintptr, bool) {
+			return uintptr(vmAddr - 0x100000000), true
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "Rebase Opcodes (5 opcodes, 5 actions)", opcodes.Name)
+	require.Len(t, opcodes.Content, 5)
+
+	times := opcodes.Content[2]
+	assert.Equal(t, "REBASE_OPCODE_DO_REBASE_IMM_TIMES", times.Name)
+	require.Len(t, times.Content, 3)
+	assert.Equal(t, "Rebase __DATA+0x10", times.Content[0].Name)
+	assert.Equal(t, "Rebase __DATA+0x20", times.Content[2].Name)
+	assert.Equal(t, uint64(0), times.Content[0].Size)
+	require.Len(t, times.Content[0].Values[0].Links, 1)
+	assert.Equal(t, uint64(0x4010), times.Content[0].Values[0].Links[0].TargetAddress)
+
+	skipping := opcodes.Content[3]
+	assert.Equal(t, uint64(3), skipping.Size)
+	require.Len(t, skipping.Content, 2)
+	assert.Equal(t, "Rebase __DATA+0x28", skipping.Content[0].Name)
+	assert.Equal(t, "Rebase __DATA+0x38", skipping.Content[1].Name)
+
+	assert.Equal(t, "REBASE_OPCODE_DONE", opcodes.Content[4].Name)
+}
+
+func Test_ParseDYLDInfoOpcodes_lazyBind(t *testing.T) {
+	data := []byte{
+		0x72, 0x00, // BIND_OPCODE_SET_SEGMENT_AND_OFFSET_ULEB (2, 0)
+		0x11,                           // BIND_OPCODE_SET_DYLIB_ORDINAL_IMM (1)
+		0x40, '_', 'f', 'o', 'o', 0x00, // BIND_OPCODE_SET_SYMBOL_TRAILING_FLAGS_IMM (0, "_foo")
+		0x90,       // BIND_OPCODE_DO_BIND
+		0x00,       // BIND_OPCODE_DONE
+		0x72, 0x08, // BIND_OPCODE_SET_SEGMENT_AND_OFFSET_ULEB (2, 8)
+		0x3e,                           // BIND_OPCODE_SET_DYLIB_SPECIAL_IMM (FLAT_LOOKUP)
+		0x41, '_', 'b', 'a', 'r', 0x00, // BIND_OPCODE_SET_SYMBOL_TRAILING_FLAGS_IMM (WEAK_IMPORT, "_bar")
+		0x90, // BIND_OPCODE_DO_BIND
+		0x00, // BIND_OPCODE_DONE
+	}
+	opcodes, err := machoutils.ParseDYLDInfoOpcodes(machoutils.LazyBindStream, data, 0x100, machoutils.DYLDInfoOptions{
+		Segments: dyldInfoSegments,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "Lazy Bind Opcodes (10 opcodes, 2 actions)", opcodes.Name)
+	require.Len(t, opcodes.Content, 10)
+
+	foo := opcodes.Content[3]
+	require.Len(t, foo.Content, 1)
+	assert.Equal(t, "Lazy Bind _foo (__DATA+0x0)", foo.Content[0].Name)
+
+	bar := opcodes.Content[8]
+	require.Len(t, bar.Content, 1)
+	assert.Equal(t, "Lazy Bind _bar (__DATA+0x8)", bar.Content[0].Name)
+	values := map[string]string{}
+	for _, value := range bar.Content[0].Values {
+		values[value.Name] = value.Value
+	}
+	assert.Equal(t, "0x100004008", values["Slot"])
+	assert.Equal(t, `"FLAT_LOOKUP"`, values["LibOrdinal"])
+	assert.Equal(t, "0x1", values["Flags"])
+}
+
+func Test_ParseDYLDInfoOpcodes_tooBig(t *testing.T) {
+	data := []byte{0x22, 0x00, 0x54, 0x00}
+	opcodes, err := machoutils.ParseDYLDInfoOpcodes(machoutils.RebaseStream, data, 0, machoutils.DYLDInfoOptions{
+		Segments: dyldInfoSegments,
+		TooBig:   3,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "Rebase Opcodes (3 opcodes, 4 actions)", opcodes.Name)
+	assert.Empty(t, opcodes.Content[1].Content)
+}
@@ -0,0 +1,182 @@
+package machoutils
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/LouisBrunner/mem-viz/pkg/contracts"
+	subcontracts "github.com/LouisBrunner/mem-viz/pkg/dsc-viz/contracts"
+	"github.com/LouisBrunner/mem-viz/pkg/parsingutils"
+)
+
+type ExportFlags uint64
+
+func (me ExportFlags) Kind() uint64 {
+	return uint64(me) & subcontracts.EXPORT_SYMBOL_FLAGS_KIND_MASK
+}
+
+func (me ExportFlags) IsReexport() bool {
+	return me&subcontracts.EXPORT_SYMBOL_FLAGS_REEXPORT != 0
+}
+
+func (me ExportFlags) IsStubAndResolver() bool {
+	return me&subcontracts.EXPORT_SYMBOL_FLAGS_STUB_AND_RESOLVER != 0
+}
+
+func (me ExportFlags) IsWeak() bool {
+	return me&subcontracts.EXPORT_SYMBOL_FLAGS_WEAK_DEFINITION != 0
+}
+
+func (me ExportFlags) String() string {
+	names := []string{}
+	switch me.Kind() {
+	case subcontracts.EXPORT_SYMBOL_FLAGS_KIND_REGULAR:
+		names = append(names, "REGULAR")
+	case subcontracts.EXPORT_SYMBOL_FLAGS_KIND_THREAD_LOCAL:
+		names = append(names, "THREAD_LOCAL")
+	case subcontracts.EXPORT_SYMBOL_FLAGS_KIND_ABSOLUTE:
+		names = append(names, "ABSOLUTE")
+	default:
+		names = append(names, fmt.Sprintf("KIND_%d", me.Kind()))
+	}
+	if me.IsWeak() {
+		names = append(names, "WEAK_DEFINITION")
+	}
+	if me.IsReexport() {
+		names = append(names, "REEXPORT")
+	}
+	if me.IsStubAndResolver() {
+		names = append(names, "STUB_AND_RESOLVER")
+	}
+	left := me &^ (subcontracts.EXPORT_SYMBOL_FLAGS_KIND_MASK | subcontracts.EXPORT_SYMBOL_FLAGS_WEAK_DEFINITION | subcontracts.EXPORT_SYMBOL_FLAGS_REEXPORT | subcontracts.EXPORT_SYMBOL_FLAGS_STUB_AND_RESOLVER)
+	if left != 0 {
+		names = append(names, fmt.Sprintf("%#x", uint64(left)))
+	}
+	return fmt.Sprintf("%#x (%s)", uint64(me), strings.Join(names, "|"))
+}
+
+type ExportTrieOptions struct {
+	// Turns an offset from the image's mach header (as found in the trie) into an address we can link to, false if it isn't mapped
+	Resolve func(offset uint64) (uintptr, bool)
+	// Nodes are not detailed if there are more than this (0 means no limit)
+	TooBig uint64
+}
+
+// Parses an export trie (as pointed by LC_DYLD_EXPORTS_TRIE or LC_DYLD_INFO), data must contain exactly the trie
+func ParseExportTrie(data []byte, address uintptr, options ExportTrieOptions) (*contracts.MemoryBlock, error) {
+	nodes, err := ParseTrie(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse export trie: %w", err)
+	}
+
+	exports := 0
+	for _, node := range nodes {
+		if node.Terminal() {
+			exports += 1
+		}
+	}
+	root := newBlock(fmt.Sprintf("Export Trie (%d exports)", exports), address, uint64(len(data)))
+	if options.TooBig != 0 && uint64(len(nodes)) > options.TooBig {
+		return root, nil
+	}
+
+	for _, node := range nodes {
+		name := fmt.Sprintf("Trie Node %q", node.Prefix)
+		if node.Terminal() {
+			name = fmt.Sprintf("Export %s", node.Prefix)
+		}
+		block := addChild(root, name, node.Offset, node.Size)
+		terminalOffset := node.TerminalOffset - node.Offset
+		addValue(block, "TerminalSize", node.TerminalSize, 0, uint8(terminalOffset))
+		if node.Terminal() {
+			err = addExportInfo(block, data, node, options)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse export %s: %w", node.Prefix, err)
+			}
+		}
+		addValue(block, "ChildCount", len(node.Edges), terminalOffset+node.TerminalSize, 1)
+		for _, edge := range node.Edges {
+			edgeName := fmt.Sprintf("Edge %q", edge.Label)
+			addValue(block, edgeName, edge.Child, edge.Offset, uint8(min(edge.Size, 0xFF)))
+			err = parsingutils.AddLinkWithAddr(block, edgeName, "child", address+uintptr(edge.Child))
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return root, nil
+}
+
+func addExportInfo(block *contracts.MemoryBlock, data []byte, node TrieNode, options ExportTrieOptions) error {
+	payload, err := subSlice(data, node.TerminalOffset, node.TerminalSize)
+	if err != nil {
+		return err
+	}
+	base := node.TerminalOffset - node.Offset
+
+	cursor := uint64(0)
+	readULEB := func(name string) (uint64, error) {
+		value, size, err := ReadULEB128(payload, cursor)
+		if err != nil {
+			return 0, err
+		}
+		addValue(block, name, value, base+cursor, uint8(size))
+		cursor += size
+		return value, nil
+	}
+	linkOffset := func(name string, offset uint64) error {
+		if options.Resolve == nil {
+			return nil
+		}
+		target, found := options.Resolve(offset)
+		if !found {
+			return nil
+		}
+		return parsingutils.AddLinkWithAddr(block, name, "points to", target)
+	}
+
+	rawFlags, size, err := ReadULEB128(payload, 0)
+	if err != nil {
+		return err
+	}
+	flags := ExportFlags(rawFlags)
+	addValue(block, "Flags", flags, base, uint8(size))
+	cursor += size
+
+	switch {
+	case flags.IsReexport():
+		_, err = readULEB("Ordinal")
+		if err != nil {
+			return err
+		}
+		name, err := readCString(payload, cursor)
+		if err != nil {
+			return err
+		}
+		addValue(block, "ImportName", name, base+cursor, uint8(min(len(name)+1, 0xFF)))
+	case flags.IsStubAndResolver():
+		stub, err := readULEB("Stub")
+		if err != nil {
+			return err
+		}
+		resolver, err := readULEB("Resolver")
+		if err != nil {
+			return err
+		}
+		err = linkOffset("Stub", stub)
+		if err != nil {
+			return err
+		}
+		return linkOffset("Resolver", resolver)
+	default:
+		address, err := readULEB("Address")
+		if err != nil {
+			return err
+		}
+		// Absolute symbols are just values
+		if flags.Kind() != subcontracts.EXPORT_SYMBOL_FLAGS_KIND_ABSOLUTE {
+			return linkOffset("Address", address)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package machoutils_test
+
+import (
+	"testing"
+
+	"github.com/LouisBrunner/mem-viz/pkg/machoutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_ParseExportTrie(t *testing.T) {
+	// root -> "_" -> {"main" = regular 0x1000, "old" = re-export of "_new" from ordinal 1, "dyn" = stub 0x10 and resolver 0x20}
+	data := []byte{
+		// 0x00: root
+		0x00, 0x01, '_', 0x00, 0x05,
+		// 0x05: "_"
+		0x00, 0x03, 'm', 'a', 'i', 'n', 0x00, 0x19, 'o', 'l', 'd', 0x00, 0x1f, 'd', 'y', 'n', 0x00, 0x28,
+		// 0x17: padding
+		0x00, 0x00,
+		// 0x19: "_main"
+		0x03, 0x00, 0x80, 0x20, 0x00,
+		// 0x1e: padding
+		0x00,
+		// 0x1f: "_old"
+		0x07, 0x08, 0x01, '_', 'n', 'e', 'w', 0x00, 0x00,
+		// 0x28: "_dyn"
+		0x03, 0x10, 0x10, 0x20, 0x00,
+	}
+	trie, err := machoutils.ParseExportTrie(data, 0x100, machoutils.ExportTrieOptions{
+		Resolve: func(offset uint64) (uintptr, bool) {
+			return uintptr(0x4000 + offset), offset != 0x20
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "Export Trie (3 exports)", trie.Name)
+	require.Len(t, trie.Content, 5)
+
+	main := trie.Content[2]
+	assert.Equal(t, "Export _main", main.Name)
+	assert.Equal(t, uintptr(0x119), main.Address)
+	values := map[string]string{}
+	for _, value := range main.Values {
+		values[value.Name] = value.Value
+	}
+	assert.Equal(t, "0x0 (REGULAR)", values["Flags"])
+	require.Len(t, main.Values[2].Links, 1)
+	assert.Equal(t, uint64(0x5000), main.Values[2].Links[0].TargetAddress)
+
+	old := trie.Content[3]
+	assert.Equal(t, "Export _old", old.Name)
+	assert.Equal(t, "ImportName", old.Values[3].Name)
+	assert.Equal(t, `"_new"`, old.Values[3].Value)
+
+	dyn := trie.Content[4]
+	assert.Equal(t, "Export _dyn", dyn.Name)
+	assert.Equal(t, "Stub", dyn.Values[2].Name)
+	assert.Len(t, dyn.Values[2].Links, 1)
+	assert.Equal(t, "Resolver", dyn.Values[3].Name)
+	assert.Len(t, dyn.Values[3].Links, 0)
+}
+
+func Test_ParseExportTrie_tooBig(t *testing.T) {
+	trie, err := machoutils.ParseExportTrie([]byte{0x00, 0x00}, 0, machoutils.ExportTrieOptions{TooBig: 0})
+	require.NoError(t, err)
+	assert.Len(t, trie.Content, 1)
+
+	trie, err = machoutils.ParseExportTrie([]byte{0x00, 0x01, 'a', 0x00, 0x05, 0x00, 0x00}, 0, machoutils.ExportTrieOptions{TooBig: 1})
+	require.NoError(t, err)
+	assert.Empty(t, trie.Content)
+}
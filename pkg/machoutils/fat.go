@@ -0,0 +1,117 @@
+package machoutils
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/LouisBrunner/mem-viz/pkg/contracts"
+	"github.com/LouisBrunner/mem-viz/pkg/parsingutils"
+	"github.com/blacktop/go-macho/types"
+)
+
+// From Apple's mach-o/fat.h, universal binaries start with a header listing their architectures, everything is
+// big-endian whatever the byte order of the images they contain (e.g. PowerPC and Intel slices)
+
+const (
+	FAT_MAGIC    = 0xcafebabe
+	FAT_MAGIC_64 = 0xcafebabf // offsets and sizes are 64-bit
+)
+
+type FatHeader struct {
+	Magic types.Magic `struc:"big"`
+	Count uint32      `struc:"big"` // number of structs that follow
+}
+
+type FatArchHeader struct {
+	CPU    types.CPU        `struc:"big"`
+	SubCPU types.CPUSubtype `struc:"big"`
+	Offset uint32           `struc:"big"` // file offset to this object file
+	Size   uint32           `struc:"big"` // size of this object file
+	Align  uint32           `struc:"big"` // alignment as a power of 2
+}
+
+type FatArchHeader64 struct {
+	CPU      types.CPU        `struc:"big"`
+	SubCPU   types.CPUSubtype `struc:"big"`
+	Offset   uint64           `struc:"big"`
+	Size     uint64           `struc:"big"`
+	Align    uint32           `struc:"big"`
+	Reserved uint32           `struc:"big"`
+}
+
+type FatArch struct {
+	CPU          types.CPU
+	SubCPU       types.CPUSubtype
+	Offset, Size uint64
+	// Its fat_arch, which links to the image
+	Block *contracts.MemoryBlock
+}
+
+const fatHeaderSize = 8
+
+// Size of the FAT header and its fat_arch (what ParseFat needs), false if data doesn't start with a FAT header
+func FatHeaderSize(data []byte) (uint64, bool) {
+	if len(data) < fatHeaderSize {
+		return 0, false
+	}
+	var archSize uint64
+	switch binary.BigEndian.Uint32(data) {
+	case FAT_MAGIC:
+		archSize = uint64(binary.Size(FatArchHeader{}))
+	case FAT_MAGIC_64:
+		archSize = uint64(binary.Size(FatArchHeader64{}))
+	default:
+		return 0, false
+	}
+	return fatHeaderSize + uint64(binary.BigEndian.Uint32(data[4:]))*archSize, true
+}
+
+// Parses the header of a universal binary, data must contain at least the FAT header and its fat_arch. Blocks are given
+// at their file offset, the images are left to the caller
+func ParseFat(data []byte) (*contracts.MemoryBlock, []FatArch, error) {
+	size, ok := FatHeaderSize(data)
+	if !ok {
+		return nil, nil, fmt.Errorf("not a universal binary")
+	}
+	header := FatHeader{}
+	err := unpackAt(data, 0, fatHeaderSize, &header)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse FAT header: %w", err)
+	}
+	// Java classes have the same magic, followed by their version instead
+	if header.Count == 0 || size > uint64(len(data)) {
+		return nil, nil, fmt.Errorf("invalid universal binary with %d architectures", header.Count)
+	}
+	headerBlock := newBlock("FAT Header", 0, fatHeaderSize)
+	structValues(headerBlock, &header, fatHeaderSize)
+
+	arches := make([]FatArch, 0, header.Count)
+	archSize := (size - fatHeaderSize) / uint64(header.Count)
+	for i := uint64(0); i < uint64(header.Count); i += 1 {
+		offset := fatHeaderSize + i*archSize
+		var archHeader any = &FatArchHeader{}
+		if header.Magic == FAT_MAGIC_64 {
+			archHeader = &FatArchHeader64{}
+		}
+		err = unpackAt(data, offset, archSize, archHeader)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to parse FAT arch %d: %w", i, err)
+		}
+		arch := FatArch{}
+		switch v := archHeader.(type) {
+		case *FatArchHeader:
+			arch = FatArch{CPU: v.CPU, SubCPU: v.SubCPU, Offset: uint64(v.Offset), Size: uint64(v.Size)}
+		case *FatArchHeader64:
+			arch = FatArch{CPU: v.CPU, SubCPU: v.SubCPU, Offset: v.Offset, Size: v.Size}
+		}
+		arch.Block = newBlock(fmt.Sprintf("FAT Arch %s", arch.CPU), uintptr(offset), archSize)
+		arch.Block.ParentOffset = offset
+		structValues(arch.Block, archHeader, archSize)
+		err = parsingutils.AddLinkWithAddr(arch.Block, "Offset", "points to", uintptr(arch.Offset))
+		if err != nil {
+			return nil, nil, err
+		}
+		arches = append(arches, arch)
+	}
+	return headerBlock, arches, nil
+}
@@ -0,0 +1,86 @@
+package machoutils_test
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/LouisBrunner/mem-viz/pkg/contracts/contractstest"
+	"github.com/LouisBrunner/mem-viz/pkg/machoutils"
+	"github.com/LouisBrunner/mem-viz/pkg/machoutils/machotest"
+	"github.com/blacktop/go-macho/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_ParseFat(t *testing.T) {
+	data := machotest.Fat(
+		machotest.FatSlice{CPU: types.CPUPpc, Data: machotest.PPC()},
+		machotest.FatSlice{CPU: types.CPUI386, Data: make([]byte, 0x100)},
+	)
+	size, ok := machoutils.FatHeaderSize(data)
+	require.True(t, ok)
+	assert.Equal(t, uint64(8+2*20), size)
+
+	header, arches, err := machoutils.ParseFat(data[:size])
+	require.NoError(t, err)
+	assert.Equal(t, "FAT Header", header.Name)
+	assert.Equal(t, uint64(8), header.Size)
+	assert.Equal(t, "0x2", contractstest.FindValue(t, header, "Count").Value)
+
+	require.Len(t, arches, 2)
+	ppc := arches[0]
+	assert.Equal(t, types.CPUPpc, ppc.CPU)
+	assert.Equal(t, uint64(0x1000), ppc.Offset)
+	assert.Equal(t, uint64(len(machotest.PPC())), ppc.Size)
+	assert.Equal(t, "FAT Arch PowerPC", ppc.Block.Name)
+	assert.Equal(t, uintptr(8), ppc.Block.Address)
+	assert.Equal(t, uint64(20), ppc.Block.Size)
+	offset := contractstest.FindValue(t, ppc.Block, "Offset")
+	require.Len(t, offset.Links, 1)
+	assert.Equal(t, uint64(0x1000), offset.Links[0].TargetAddress)
+
+	i386 := arches[1]
+	assert.Equal(t, uintptr(28), i386.Block.Address)
+	assert.Equal(t, uint64(0x3000), i386.Offset)
+	assert.Equal(t, uint64(0x100), i386.Size)
+}
+
+func Test_ParseFat_64(t *testing.T) {
+	be := binary.BigEndian
+	data := be.AppendUint32(nil, machoutils.FAT_MAGIC_64)
+	data = be.AppendUint32(data, 1)
+	data = be.AppendUint32(data, uint32(types.CPUArm64))
+	data = be.AppendUint32(data, 0)
+	data = be.AppendUint64(data, 0x1_0000_0000)
+	data = be.AppendUint64(data, 0x4000)
+	data = be.AppendUint32(data, 14)
+	data = be.AppendUint32(data, 0)
+
+	size, ok := machoutils.FatHeaderSize(data)
+	require.True(t, ok)
+	assert.Equal(t, uint64(len(data)), size)
+	_, arches, err := machoutils.ParseFat(data)
+	require.NoError(t, err)
+	require.Len(t, arches, 1)
+	assert.Equal(t, types.CPUArm64, arches[0].CPU)
+	assert.Equal(t, uint64(0x1_0000_0000), arches[0].Offset)
+	assert.Equal(t, uint64(0x4000), arches[0].Size)
+	assert.Equal(t, uint64(32), arches[0].Block.Size)
+}
+
+func Test_ParseFat_invalid(t *testing.T) {
+	be := binary.BigEndian
+	cases := map[string][]byte{
+		// Java classes have the same magic, followed by their version
+		"java":      be.AppendUint32(be.AppendUint32(nil, machoutils.FAT_MAGIC), 0x34),
+		"empty":     be.AppendUint32(be.AppendUint32(nil, machoutils.FAT_MAGIC), 0),
+		"truncated": machotest.Fat(machotest.FatSlice{CPU: types.CPUPpc, Data: machotest.PPC()})[:20],
+		"thin":      machotest.PPC(),
+	}
+	for name, data := range cases {
+		t.Run(name, func(t *testing.T) {
+			_, _, err := machoutils.ParseFat(data)
+			assert.Error(t, err)
+		})
+	}
+}
@@ -0,0 +1,365 @@
+package machoutils
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/LouisBrunner/mem-viz/pkg/contracts"
+	"github.com/LouisBrunner/mem-viz/pkg/parsingutils"
+)
+
+type ChainedFixupsSegment struct {
+	Name string
+	// Where the segment content is in the final tree
+	Address uintptr
+	// Content of the segment as found in the file, only needed to walk the chains
+	Data []byte
+}
+
+type ChainedFixupsOptions struct {
+	// Segments in load command order, as referenced by the starts in image
+	Segments []ChainedFixupsSegment
+	// Walk each chain and emit a block for every fixup
+	WalkChains bool
+	// VM address of the mach header, offsets-based pointer formats are relative to it
+	ImageBase uint64
+	Resolve   parsingutils.Resolver
+	// Chains of a segment are not detailed if there are more fixups than this (0 means no limit)
+	TooBig uint64
+}
+
+type chainedFixupsParser struct {
+	options ChainedFixupsOptions
+	root    *contracts.MemoryBlock
+	data    []byte
+	imports []chainedImport
+	fixups  []*contracts.MemoryBlock
+}
+
+type chainedImport struct {
+	block *contracts.MemoryBlock
+	name  string
+}
+
+// Parses the payload of LC_DYLD_CHAINED_FIXUPS, data must contain exactly the payload.
+// It returns the tree of the payload itself as well as the fixups found by walking the chains (which live in their segments)
+func ParseChainedFixups(data []byte, address uintptr, options ChainedFixupsOptions) (*contracts.MemoryBlock, []*contracts.MemoryBlock, error) {
+	p := chainedFixupsParser{
+		options: options,
+		data:    data,
+		root:    newBlock("Chained Fixups", address, uint64(len(data))),
+	}
+	err := p.parse()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse chained fixups: %w", err)
+	}
+	return p.root, p.fixups, nil
+}
+
+func (me *chainedFixupsParser) parse() error {
+	header := DYLDChainedFixupsHeader{}
+	headerBlock, err := addStruct(me.root, me.data, &header, "Chained Fixups Header", 0, 0)
+	if err != nil {
+		return err
+	}
+	if header.FixupsVersion != 0 {
+		return fmt.Errorf("unsupported fixups version %d", header.FixupsVersion)
+	}
+
+	err = me.parseImports(headerBlock, header)
+	if err != nil {
+		return err
+	}
+	err = me.parseStarts(headerBlock, header)
+	if err != nil {
+		return err
+	}
+	sortContent(me.root)
+	return nil
+}
+
+func (me *chainedFixupsParser) parseImports(headerBlock *contracts.MemoryBlock, header DYLDChainedFixupsHeader) error {
+	if header.ImportsCount == 0 {
+		return nil
+	}
+
+	var entrySize uint64
+	switch header.ImportsFormat {
+	case DYLD_CHAINED_IMPORT:
+		entrySize = 4
+	case DYLD_CHAINED_IMPORT_ADDEND:
+		entrySize = 8
+	case DYLD_CHAINED_IMPORT_ADDEND64:
+		entrySize = 16
+	default:
+		return fmt.Errorf("unsupported imports format %d", header.ImportsFormat)
+	}
+
+	importsBlock := addChild(me.root, fmt.Sprintf("Imports (%d)", header.ImportsCount), uint64(header.ImportsOffset), uint64(header.ImportsCount)*entrySize)
+	err := parsingutils.AddLinkWithBlock(headerBlock, "ImportsOffset", importsBlock, "points to")
+	if err != nil {
+		return err
+	}
+	importsData, err := subSlice(me.data, uint64(header.ImportsOffset), importsBlock.Size)
+	if err != nil {
+		return fmt.Errorf("failed to parse imports: %w", err)
+	}
+
+	var symbolsBlock *contracts.MemoryBlock
+	if header.SymbolsOffset != 0 && uint64(header.SymbolsOffset) < uint64(len(me.data)) {
+		symbolsBlock = addChild(me.root, "Symbols", uint64(header.SymbolsOffset), uint64(len(me.data))-uint64(header.SymbolsOffset))
+		err = parsingutils.AddLinkWithBlock(headerBlock, "SymbolsOffset", symbolsBlock, "points to")
+		if err != nil {
+			return err
+		}
+	}
+	symbols := map[uint32]*contracts.MemoryBlock{}
+
+	me.imports = make([]chainedImport, 0, header.ImportsCount)
+	for i := uint64(0); i < uint64(header.ImportsCount); i += 1 {
+		var nameOffset uint32
+		var v any
+		switch header.ImportsFormat {
+		case DYLD_CHAINED_IMPORT:
+			v = &DYLDChainedImportEntry{}
+		case DYLD_CHAINED_IMPORT_ADDEND:
+			v = &DYLDChainedImportAddend{}
+		case DYLD_CHAINED_IMPORT_ADDEND64:
+			v = &DYLDChainedImportAddend64{}
+		}
+		importBlock, err := addStruct(importsBlock, importsData, v, "", i*entrySize, 0)
+		if err != nil {
+			return err
+		}
+		switch v := v.(type) {
+		case *DYLDChainedImportEntry:
+			nameOffset = v.Import.NameOffset()
+		case *DYLDChainedImportAddend:
+			nameOffset = v.Import.NameOffset()
+		case *DYLDChainedImportAddend64:
+			nameOffset = v.Import.NameOffset()
+		}
+
+		name := "?"
+		if symbolsBlock != nil && header.SymbolsFormat == DYLD_CHAINED_SYMBOL_UNCOMPRESSED {
+			name, err = readCString(me.data, uint64(header.SymbolsOffset)+uint64(nameOffset))
+			if err != nil {
+				return fmt.Errorf("failed to read import %d name: %w", i, err)
+			}
+			symbol, found := symbols[nameOffset]
+			if !found {
+				symbol = addChild(symbolsBlock, fmt.Sprintf("%q", name), uint64(nameOffset), uint64(len(name)+1))
+				symbols[nameOffset] = symbol
+			}
+			err = parsingutils.AddLinkWithBlock(importBlock, "Import", symbol, "name")
+			if err != nil {
+				return err
+			}
+		}
+		importBlock.Name = fmt.Sprintf("Import %d (%s)", i, name)
+		me.imports = append(me.imports, chainedImport{block: importBlock, name: name})
+	}
+	if symbolsBlock != nil {
+		sortContent(symbolsBlock)
+	}
+	return nil
+}
+
+func (me *chainedFixupsParser) parseStarts(headerBlock *contracts.MemoryBlock, header DYLDChainedFixupsHeader) error {
+	if header.StartsOffset == 0 {
+		return nil
+	}
+
+	startsOffset := uint64(header.StartsOffset)
+	starts := DYLDChainedStartsInImage{}
+	err := unpackAt(me.data, startsOffset, 4, &starts)
+	if err != nil {
+		return fmt.Errorf("failed to parse starts in image: %w", err)
+	}
+	startsBlock := addChild(me.root, "Starts In Image", startsOffset, 4+uint64(starts.SegCount)*4)
+	err = parsingutils.AddLinkWithBlock(headerBlock, "StartsOffset", startsBlock, "points to")
+	if err != nil {
+		return err
+	}
+	addValue(startsBlock, "SegCount", starts.SegCount, 0, 4)
+
+	for i := uint64(0); i < uint64(starts.SegCount); i += 1 {
+		raw, err := subSlice(me.data, startsOffset+4+i*4, 4)
+		if err != nil {
+			return fmt.Errorf("failed to parse segment %d info offset: %w", i, err)
+		}
+		segInfoOffset := uint64(binary.LittleEndian.Uint32(raw))
+		valueName := fmt.Sprintf("SegInfoOffset %d", i)
+		addValue(startsBlock, valueName, segInfoOffset, 4+i*4, 4)
+		if segInfoOffset == 0 {
+			continue
+		}
+
+		segmentBlock, err := me.parseStartsInSegment(startsOffset+segInfoOffset, int(i))
+		if err != nil {
+			return fmt.Errorf("failed to parse starts of segment %d: %w", i, err)
+		}
+		err = parsingutils.AddLinkWithBlock(startsBlock, valueName, segmentBlock, "points to")
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (me *chainedFixupsParser) parseStartsInSegment(offset uint64, index int) (*contracts.MemoryBlock, error) {
+	name := fmt.Sprintf("Segment %d", index)
+	var segment *ChainedFixupsSegment
+	if index < len(me.options.Segments) {
+		segment = &me.options.Segments[index]
+		name = segment.Name
+	}
+
+	starts := DYLDChainedStartsInSegment{}
+	err := unpackAt(me.data, offset, chainedStartsInSegmentSize, &starts)
+	if err != nil {
+		return nil, err
+	}
+	if uint64(starts.Size) < chainedStartsInSegmentSize+uint64(starts.PageCount)*2 {
+		return nil, fmt.Errorf("invalid size %#x for %d pages", starts.Size, starts.PageCount)
+	}
+	block := addChild(me.root, fmt.Sprintf("Starts In Segment (%s, %s)", name, ChainedPointerFormatName(starts.PointerFormat)), offset, uint64(starts.Size))
+	blockData, err := subSlice(me.data, offset, uint64(starts.Size))
+	if err != nil {
+		return nil, err
+	}
+	structValues(block, &starts, chainedStartsInSegmentSize)
+
+	pageStarts := make([]uint16, starts.PageCount)
+	for i := range pageStarts {
+		pageOffset := chainedStartsInSegmentSize + uint64(i)*2
+		pageStarts[i] = binary.LittleEndian.Uint16(blockData[pageOffset:])
+		addValue(block, fmt.Sprintf("Page %d", i), pageStarts[i], pageOffset, 2)
+	}
+
+	if !me.options.WalkChains || segment == nil {
+		return block, nil
+	}
+	chains, err := me.walkChains(segment, starts, pageStarts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to walk chains of %s: %w", name, err)
+	}
+	for _, chain := range chains {
+		err = parsingutils.AddLinkWithBlock(block, fmt.Sprintf("Page %d", chain.page), chain.fixups[0], "first fixup")
+		if err != nil {
+			return nil, err
+		}
+		for i, fixup := range chain.fixups[1:] {
+			err = parsingutils.AddLinkWithBlock(chain.fixups[i], "Value", fixup, "next")
+			if err != nil {
+				return nil, err
+			}
+		}
+		me.fixups = append(me.fixups, chain.fixups...)
+	}
+	return block, nil
+}
+
+type fixupChain struct {
+	page   int
+	fixups []*contracts.MemoryBlock
+}
+
+// Decodes the chain of each page, none are returned if there are more fixups than TooBig (so nothing links to them)
+func (me *chainedFixupsParser) walkChains(segment *ChainedFixupsSegment, starts DYLDChainedStartsInSegment, pageStarts []uint16) ([]fixupChain, error) {
+	stride, supported := chainedPointerStride(starts.PointerFormat)
+	if !supported {
+		// FIXME: kernel and firmware formats are not supported
+		return nil, nil
+	}
+
+	chains := []fixupChain{}
+	count := uint64(0)
+	for page, start := range pageStarts {
+		if start == DYLD_CHAINED_PTR_START_NONE {
+			continue
+		}
+		if start&DYLD_CHAINED_PTR_START_MULTI != 0 {
+			// FIXME: only used by 32-bit formats, which have multiple chains per page
+			continue
+		}
+
+		chain := fixupChain{page: page}
+		offset := uint64(page)*uint64(starts.PageSize) + uint64(start)
+		for {
+			fixup, err := me.decodeFixup(segment, starts.PointerFormat, offset)
+			if err != nil {
+				return nil, err
+			}
+			chain.fixups = append(chain.fixups, fixup.block)
+			count += 1
+			if me.options.TooBig != 0 && count > me.options.TooBig {
+				return nil, nil
+			}
+			if fixup.decoded.Next == 0 {
+				break
+			}
+			offset += fixup.decoded.Next * stride
+		}
+		chains = append(chains, chain)
+	}
+	return chains, nil
+}
+
+type decodedFixup struct {
+	block   *contracts.MemoryBlock
+	decoded ChainedFixup
+}
+
+func (me *chainedFixupsParser) decodeFixup(segment *ChainedFixupsSegment, format uint16, offset uint64) (*decodedFixup, error) {
+	size := uint64(8)
+	if format == DYLD_CHAINED_PTR_32 {
+		size = 4
+	}
+	raw, err := subSlice(segment.Data, offset, size)
+	if err != nil {
+		return nil, fmt.Errorf("fixup at %#x: %w", offset, err)
+	}
+	value := uint64(0)
+	if size == 8 {
+		value = binary.LittleEndian.Uint64(raw)
+	} else {
+		value = uint64(binary.LittleEndian.Uint32(raw))
+	}
+	fixup, err := DecodeChainedPointer(format, value, me.options.ImageBase)
+	if err != nil {
+		return nil, err
+	}
+
+	kind := "Rebase"
+	if fixup.Bind {
+		kind = "Bind"
+	}
+	if fixup.Auth {
+		kind = fmt.Sprintf("Auth %s", kind)
+	}
+	name := fmt.Sprintf("%s %#x", kind, fixup.Target)
+	var target *chainedImport
+	if fixup.Bind {
+		name = fmt.Sprintf("%s #%d", kind, fixup.Ordinal)
+		if uint64(fixup.Ordinal) < uint64(len(me.imports)) {
+			target = &me.imports[fixup.Ordinal]
+			name = fmt.Sprintf("%s %s", kind, target.name)
+		}
+	}
+
+	block := newBlock(name, segment.Address+uintptr(offset), size)
+	addValue(block, "Value", fixup, 0, uint8(size))
+	switch {
+	case target != nil:
+		err = parsingutils.AddLinkWithBlock(block, "Value", target.block, "binds to")
+	case !fixup.Bind && me.options.Resolve != nil:
+		if address, found := me.options.Resolve(fixup.Target); found {
+			err = parsingutils.AddLinkWithAddr(block, "Value", "points to", address)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &decodedFixup{block: block, decoded: fixup}, nil
+}
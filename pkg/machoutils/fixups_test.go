@@ -0,0 +1,110 @@
+package machoutils_test
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/LouisBrunner/mem-viz/pkg/machoutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_DecodeChainedPointer(t *testing.T) {
+	fixup, err := machoutils.DecodeChainedPointer(machoutils.DYLD_CHAINED_PTR_64_OFFSET, 2<<51|0x3f80, 0x100000000)
+	require.NoError(t, err)
+	assert.Equal(t, machoutils.ChainedFixup{Target: 0x100003f80, Next: 2, PointerSize: 8}, fixup)
+
+	fixup, err = machoutils.DecodeChainedPointer(machoutils.DYLD_CHAINED_PTR_ARM64E, 1<<63|1<<62|2<<49|0x1234<<32|7, 0)
+	require.NoError(t, err)
+	assert.Equal(t, machoutils.ChainedFixup{Bind: true, Auth: true, Ordinal: 7, Diversity: 0x1234, Key: 2, PointerSize: 8}, fixup)
+
+	fixup, err = machoutils.DecodeChainedPointer(machoutils.DYLD_CHAINED_PTR_ARM64E, 1<<62|0x7ffff<<32|1, 0)
+	require.NoError(t, err)
+	assert.Equal(t, int64(-1), fixup.Addend)
+
+	_, err = machoutils.DecodeChainedPointer(machoutils.DYLD_CHAINED_PTR_ARM64E_KERNEL, 0, 0)
+	assert.Error(t, err)
+}
+
+// A chain of 2 fixups (a rebase then a bind to _puts) in the first page of __DATA_CONST
+func chainedFixups(tooBig uint64) ([]byte, machoutils.ChainedFixupsOptions) {
+	le := binary.LittleEndian
+	data := []byte{}
+	// header
+	for _, v := range []uint32{0, 0x20, 0x44, 0x48, 1, machoutils.DYLD_CHAINED_IMPORT, machoutils.DYLD_CHAINED_SYMBOL_UNCOMPRESSED, 0} {
+		data = le.AppendUint32(data, v)
+	}
+	// 0x20: starts in image, segment 0 has no fixups
+	data = le.AppendUint32(data, 2)
+	data = le.AppendUint32(data, 0)
+	data = le.AppendUint32(data, 0x0c)
+	// 0x2c: starts in segment, 1 page
+	data = le.AppendUint32(data, 24)
+	data = le.AppendUint16(data, 0x4000)
+	data = le.AppendUint16(data, machoutils.DYLD_CHAINED_PTR_64_OFFSET)
+	data = le.AppendUint64(data, 0x4000)
+	data = le.AppendUint32(data, 0)
+	data = le.AppendUint16(data, 1)
+	data = le.AppendUint16(data, 0x10)
+	// 0x44: imports
+	data = le.AppendUint32(data, 1<<9|1)
+	// 0x48: symbols
+	data = append(data, 0x00, '_', 'p', 'u', 't', 's', 0x00)
+
+	segment := make([]byte, 0x20)
+	le.PutUint64(segment[0x10:], 2<<51|0x3f80)
+	le.PutUint64(segment[0x18:], 1<<63|0)
+
+	return data, machoutils.ChainedFixupsOptions{
+		Segments: []machoutils.ChainedFixupsSegment{
+			{Name: "__TEXT", Address: 0},
+			{Name: "__DATA_CONST", Address: 0x4000, Data: segment},
+		},
+		WalkChains: true,
+		ImageBase:  0x100000000,
+		Resolve: func(vmAddr uint64) (uintptr, bool) {
+			return uintptr(vmAddr - 0x100000000), true
+		},
+		TooBig: tooBig,
+	}
+}
+
+func Test_ParseChainedFixups(t *testing.T) {
+	data, options := chainedFixups(0)
+	root, fixups, err := machoutils.ParseChainedFixups(data, 0x1000, options)
+	require.NoError(t, err)
+	names := []string{}
+	for _, child := range root.Content {
+		names = append(names, child.Name)
+	}
+	assert.Equal(t, []string{"Chained Fixups Header", "Starts In Image", "Starts In Segment (__DATA_CONST, 64_OFFSET)", "Imports (1)", "Symbols"}, names)
+	assert.Equal(t, "Import 0 (_puts)", root.Content[3].Content[0].Name)
+
+	require.Len(t, fixups, 2)
+	assert.Equal(t, "Rebase 0x100003f80", fixups[0].Name)
+	assert.Equal(t, uintptr(0x4010), fixups[0].Address)
+	require.Len(t, fixups[0].Values[0].Links, 2)
+	assert.Equal(t, uint64(0x3f80), fixups[0].Values[0].Links[0].TargetAddress)
+	assert.Equal(t, uint64(0x4018), fixups[0].Values[0].Links[1].TargetAddress)
+	assert.Equal(t, "Bind _puts", fixups[1].Name)
+	assert.Equal(t, uint64(0x1044), fixups[1].Values[0].Links[0].TargetAddress)
+}
+
+func Test_ParseChainedFixups_tooBig(t *testing.T) {
+	for tooBig, expected := range map[uint64]int{1: 0, 2: 2} {
+		data, options := chainedFixups(tooBig)
+		root, fixups, err := machoutils.ParseChainedFixups(data, 0x1000, options)
+		require.NoError(t, err)
+		assert.Len(t, fixups, expected)
+		// The page only links to its chain if it is detailed
+		starts := root.Content[2]
+		page := starts.Values[len(starts.Values)-1]
+		require.Equal(t, "Page 0", page.Name)
+		if expected == 0 {
+			assert.Empty(t, page.Links)
+		} else {
+			require.Len(t, page.Links, 1)
+			assert.Equal(t, uint64(fixups[0].Address), page.Links[0].TargetAddress)
+		}
+	}
+}
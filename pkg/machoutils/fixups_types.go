@@ -0,0 +1,276 @@
+package machoutils
+
+import (
+	"fmt"
+	"strings"
+)
+
+// From Apple's mach-o/fixup-chains.h, everything is little-endian
+
+const (
+	DYLD_CHAINED_IMPORT          = 1
+	DYLD_CHAINED_IMPORT_ADDEND   = 2
+	DYLD_CHAINED_IMPORT_ADDEND64 = 3
+)
+
+const (
+	DYLD_CHAINED_SYMBOL_UNCOMPRESSED = 0
+	DYLD_CHAINED_SYMBOL_ZLIB         = 1
+)
+
+const (
+	DYLD_CHAINED_PTR_ARM64E              = 1 // stride 8, unauth target is vmaddr
+	DYLD_CHAINED_PTR_64                  = 2 // target is vmaddr
+	DYLD_CHAINED_PTR_32                  = 3
+	DYLD_CHAINED_PTR_32_CACHE            = 4
+	DYLD_CHAINED_PTR_32_FIRMWARE         = 5
+	DYLD_CHAINED_PTR_64_OFFSET           = 6 // target is vm offset
+	DYLD_CHAINED_PTR_ARM64E_KERNEL       = 7 // stride 4, unauth target is vm offset
+	DYLD_CHAINED_PTR_64_KERNEL_CACHE     = 8
+	DYLD_CHAINED_PTR_ARM64E_USERLAND     = 9 // stride 8, unauth target is vm offset
+	DYLD_CHAINED_PTR_ARM64E_FIRMWARE     = 10
+	DYLD_CHAINED_PTR_X86_64_KERNEL_CACHE = 11
+	DYLD_CHAINED_PTR_ARM64E_USERLAND24   = 12 // stride 8, unauth target is vm offset, 24-bit bind
+	DYLD_CHAINED_PTR_ARM64E_SHARED_CACHE = 13
+	DYLD_CHAINED_PTR_ARM64E_SEGMENTED    = 14
+)
+
+const (
+	DYLD_CHAINED_PTR_START_NONE  = 0xFFFF // used in page_start[] to denote a page with no fixups
+	DYLD_CHAINED_PTR_START_MULTI = 0x8000 // used in page_start[] to denote a page which has multiple starts
+	DYLD_CHAINED_PTR_START_LAST  = 0x8000 // used in chain_starts[] to denote last start in list for page
+)
+
+// Header of the LC_DYLD_CHAINED_FIXUPS payload
+type DYLDChainedFixupsHeader struct {
+	FixupsVersion uint32 `struc:"little"` // 0
+	StartsOffset  uint32 `struc:"little"` // offset of dyld_chained_starts_in_image in chain_data
+	ImportsOffset uint32 `struc:"little"` // offset of imports table in chain_data
+	SymbolsOffset uint32 `struc:"little"` // offset of symbol strings in chain_data
+	ImportsCount  uint32 `struc:"little"` // number of imported symbol names
+	ImportsFormat uint32 `struc:"little"` // DYLD_CHAINED_IMPORT*
+	SymbolsFormat uint32 `struc:"little"` // 0 => uncompressed, 1 => zlib compressed
+}
+
+// This struct is embedded in LC_DYLD_CHAINED_FIXUPS payload
+type DYLDChainedStartsInImage struct {
+	SegCount uint32 `struc:"little"`
+	// followed by seg_info_offset[seg_count], each entry is offset into this struct for that segment, 0 means no fixups
+}
+
+// This struct is embedded in dyld_chain_starts_in_image and passed down to the kernel for page-in linking
+type DYLDChainedStartsInSegment struct {
+	Size            uint32 `struc:"little"` // size of this (amount kernel needs to copy)
+	PageSize        uint16 `struc:"little"` // 0x1000 or 0x4000
+	PointerFormat   uint16 `struc:"little"` // DYLD_CHAINED_PTR_*
+	SegmentOffset   uint64 `struc:"little"` // offset in memory to start of segment
+	MaxValidPointer uint32 `struc:"little"` // for 32-bit OS, any value beyond this is not a pointer
+	PageCount       uint16 `struc:"little"` // how many pages are in array
+	// followed by page_start[page_count], offset in page of first fixup (or DYLD_CHAINED_PTR_START_*)
+}
+
+const chainedStartsInSegmentSize = 22
+
+type DYLDChainedImport uint32
+
+func (me DYLDChainedImport) LibOrdinal() int8 {
+	return int8(me & 0xFF)
+}
+
+func (me DYLDChainedImport) WeakImport() bool {
+	return me>>8&0x1 == 1
+}
+
+func (me DYLDChainedImport) NameOffset() uint32 {
+	return uint32(me >> 9)
+}
+
+func (me DYLDChainedImport) String() string {
+	return fmt.Sprintf("{LibOrdinal: %d, WeakImport: %t, NameOffset: %#x}", me.LibOrdinal(), me.WeakImport(), me.NameOffset())
+}
+
+type DYLDChainedImportEntry struct {
+	Import DYLDChainedImport `struc:"little"`
+}
+
+type DYLDChainedImportAddend struct {
+	Import DYLDChainedImport `struc:"little"`
+	Addend int32             `struc:"little"`
+}
+
+type DYLDChainedImport64 uint64
+
+func (me DYLDChainedImport64) LibOrdinal() int16 {
+	return int16(me & 0xFFFF)
+}
+
+func (me DYLDChainedImport64) WeakImport() bool {
+	return me>>16&0x1 == 1
+}
+
+func (me DYLDChainedImport64) NameOffset() uint32 {
+	return uint32(me >> 32)
+}
+
+func (me DYLDChainedImport64) String() string {
+	return fmt.Sprintf("{LibOrdinal: %d, WeakImport: %t, NameOffset: %#x}", me.LibOrdinal(), me.WeakImport(), me.NameOffset())
+}
+
+type DYLDChainedImportAddend64 struct {
+	Import DYLDChainedImport64 `struc:"little"`
+	Addend uint64              `struc:"little"`
+}
+
+func ChainedPointerFormatName(format uint16) string {
+	switch format {
+	case DYLD_CHAINED_PTR_ARM64E:
+		return "ARM64E"
+	case DYLD_CHAINED_PTR_64:
+		return "64"
+	case DYLD_CHAINED_PTR_32:
+		return "32"
+	case DYLD_CHAINED_PTR_32_CACHE:
+		return "32_CACHE"
+	case DYLD_CHAINED_PTR_32_FIRMWARE:
+		return "32_FIRMWARE"
+	case DYLD_CHAINED_PTR_64_OFFSET:
+		return "64_OFFSET"
+	case DYLD_CHAINED_PTR_ARM64E_KERNEL:
+		return "ARM64E_KERNEL"
+	case DYLD_CHAINED_PTR_64_KERNEL_CACHE:
+		return "64_KERNEL_CACHE"
+	case DYLD_CHAINED_PTR_ARM64E_USERLAND:
+		return "ARM64E_USERLAND"
+	case DYLD_CHAINED_PTR_ARM64E_FIRMWARE:
+		return "ARM64E_FIRMWARE"
+	case DYLD_CHAINED_PTR_X86_64_KERNEL_CACHE:
+		return "X86_64_KERNEL_CACHE"
+	case DYLD_CHAINED_PTR_ARM64E_USERLAND24:
+		return "ARM64E_USERLAND24"
+	case DYLD_CHAINED_PTR_ARM64E_SHARED_CACHE:
+		return "ARM64E_SHARED_CACHE"
+	case DYLD_CHAINED_PTR_ARM64E_SEGMENTED:
+		return "ARM64E_SEGMENTED"
+	}
+	return fmt.Sprintf("Unknown %d", format)
+}
+
+// A decoded chained pointer, only the fields relevant to its kind are set
+type ChainedFixup struct {
+	Bind bool
+	Auth bool
+	// Rebase only, always an absolute (unslid) VM address
+	Target uint64
+	High8  uint8
+	// Bind only
+	Ordinal uint32
+	Addend  int64
+	// Auth only
+	Diversity   uint16
+	AddrDiv     bool
+	Key         uint8
+	Next        uint64 // in stride units, 0 means end of chain
+	PointerSize uint64
+}
+
+var ptrauthKeys = []string{"IA", "IB", "DA", "DB"}
+
+func (me ChainedFixup) String() string {
+	parts := []string{}
+	if me.Bind {
+		parts = append(parts, fmt.Sprintf("Ordinal: %d", me.Ordinal))
+		if me.Addend != 0 {
+			parts = append(parts, fmt.Sprintf("Addend: %d", me.Addend))
+		}
+	} else {
+		parts = append(parts, fmt.Sprintf("Target: %#x", me.Target))
+		if me.High8 != 0 {
+			parts = append(parts, fmt.Sprintf("High8: %#x", me.High8))
+		}
+	}
+	if me.Auth {
+		parts = append(parts, fmt.Sprintf("Key: %s", ptrauthKeys[me.Key&0x3]), fmt.Sprintf("Diversity: %#x", me.Diversity), fmt.Sprintf("AddrDiv: %t", me.AddrDiv))
+	}
+	parts = append(parts, fmt.Sprintf("Next: %d", me.Next))
+	return fmt.Sprintf("{%s}", strings.Join(parts, ", "))
+}
+
+func chainedPointerStride(format uint16) (uint64, bool) {
+	switch format {
+	case DYLD_CHAINED_PTR_ARM64E, DYLD_CHAINED_PTR_ARM64E_USERLAND, DYLD_CHAINED_PTR_ARM64E_USERLAND24:
+		return 8, true
+	case DYLD_CHAINED_PTR_64, DYLD_CHAINED_PTR_64_OFFSET, DYLD_CHAINED_PTR_32:
+		return 4, true
+	}
+	return 0, false
+}
+
+func bits(value uint64, shift, width uint) uint64 {
+	return value >> shift & (1<<width - 1)
+}
+
+func signExtend(value uint64, width uint) int64 {
+	return int64(value<<(64-width)) >> (64 - width)
+}
+
+// Decodes a chained pointer, imageBase is used for formats where the target is a VM offset
+func DecodeChainedPointer(format uint16, raw, imageBase uint64) (ChainedFixup, error) {
+	fixup := ChainedFixup{PointerSize: 8}
+	switch format {
+	case DYLD_CHAINED_PTR_ARM64E, DYLD_CHAINED_PTR_ARM64E_USERLAND, DYLD_CHAINED_PTR_ARM64E_USERLAND24:
+		fixup.Auth = bits(raw, 63, 1) == 1
+		fixup.Bind = bits(raw, 62, 1) == 1
+		fixup.Next = bits(raw, 51, 11)
+		ordinalWidth := uint(16)
+		if format == DYLD_CHAINED_PTR_ARM64E_USERLAND24 {
+			ordinalWidth = 24
+		}
+		switch {
+		case fixup.Auth && fixup.Bind:
+			fixup.Ordinal = uint32(bits(raw, 0, ordinalWidth))
+		case fixup.Auth:
+			// Authenticated targets are always offsets from the image
+			fixup.Target = imageBase + bits(raw, 0, 32)
+		case fixup.Bind:
+			fixup.Ordinal = uint32(bits(raw, 0, ordinalWidth))
+			fixup.Addend = signExtend(bits(raw, 32, 19), 19)
+		default:
+			fixup.Target = bits(raw, 0, 43)
+			fixup.High8 = uint8(bits(raw, 43, 8))
+			if format != DYLD_CHAINED_PTR_ARM64E {
+				fixup.Target += imageBase
+			}
+		}
+		if fixup.Auth {
+			fixup.Diversity = uint16(bits(raw, 32, 16))
+			fixup.AddrDiv = bits(raw, 48, 1) == 1
+			fixup.Key = uint8(bits(raw, 49, 2))
+		}
+	case DYLD_CHAINED_PTR_64, DYLD_CHAINED_PTR_64_OFFSET:
+		fixup.Bind = bits(raw, 63, 1) == 1
+		fixup.Next = bits(raw, 51, 12)
+		if fixup.Bind {
+			fixup.Ordinal = uint32(bits(raw, 0, 24))
+			fixup.Addend = int64(bits(raw, 24, 8))
+		} else {
+			fixup.Target = bits(raw, 0, 36)
+			fixup.High8 = uint8(bits(raw, 36, 8))
+			if format == DYLD_CHAINED_PTR_64_OFFSET {
+				fixup.Target += imageBase
+			}
+		}
+	case DYLD_CHAINED_PTR_32:
+		fixup.PointerSize = 4
+		fixup.Bind = bits(raw, 31, 1) == 1
+		fixup.Next = bits(raw, 26, 5)
+		if fixup.Bind {
+			fixup.Ordinal = uint32(bits(raw, 0, 20))
+			fixup.Addend = int64(bits(raw, 20, 6))
+		} else {
+			fixup.Target = bits(raw, 0, 26)
+		}
+	default:
+		return fixup, fmt.Errorf("unsupported chained pointer format %s", ChainedPointerFormatName(format))
+	}
+	return fixup, nil
+}
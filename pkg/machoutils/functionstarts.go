@@ -0,0 +1,91 @@
+package machoutils
+
+import (
+	"fmt"
+
+	"github.com/LouisBrunner/mem-viz/pkg/contracts"
+	"github.com/LouisBrunner/mem-viz/pkg/parsingutils"
+)
+
+type FunctionStart struct {
+	// VM address of the function
+	Address uint64
+	// Name from the symbol table, empty if it isn't known (e.g. stripped binaries)
+	Name string
+}
+
+func (me FunctionStart) Label() string {
+	if me.Name != "" {
+		return me.Name
+	}
+	return fmt.Sprintf("%#x", me.Address)
+}
+
+type FunctionStartsOptions struct {
+	// VM address the first delta is relative to (the start of __TEXT)
+	Base    uint64
+	Resolve parsingutils.Resolver
+	// Finds the symbol defined at a VM address, false if there is none
+	Symbol func(vmAddr uint64) (string, bool)
+	// Entries are not detailed if there are more than this (0 means no limit)
+	TooBig uint64
+}
+
+// Parses the ULEB128 deltas of LC_FUNCTION_STARTS, data must contain exactly the stream (including its padding).
+// The decoded starts are also returned so callers can build a map of the functions
+func ParseFunctionStarts(data []byte, address uintptr, options FunctionStartsOptions) (*contracts.MemoryBlock, []FunctionStart, error) {
+	type entry struct {
+		offset, size uint64
+		delta        uint64
+		start        FunctionStart
+	}
+
+	entries := []entry{}
+	current := options.Base
+	for offset := uint64(0); offset < uint64(len(data)); {
+		delta, size, err := ReadULEB128(data, offset)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read function start %d: %w", len(entries), err)
+		}
+		// The stream ends with a zero delta, anything after it is padding
+		if delta == 0 {
+			break
+		}
+		current += delta
+		start := FunctionStart{Address: current}
+		if options.Symbol != nil {
+			if name, ok := options.Symbol(current); ok {
+				start.Name = name
+			}
+		}
+		entries = append(entries, entry{offset: offset, size: size, delta: delta, start: start})
+		offset += size
+	}
+
+	starts := make([]FunctionStart, 0, len(entries))
+	for _, entry := range entries {
+		starts = append(starts, entry.start)
+	}
+	root := newBlock(fmt.Sprintf("Function Starts (%d functions)", len(entries)), address, uint64(len(data)))
+	if options.TooBig != 0 && uint64(len(entries)) > options.TooBig {
+		return root, starts, nil
+	}
+
+	for _, entry := range entries {
+		block := addChild(root, fmt.Sprintf("Function Start %s", entry.start.Label()), entry.offset, entry.size)
+		addValue(block, "Delta", entry.delta, 0, uint8(entry.size))
+		addValue(block, "Address", entry.start.Address, 0, uint8(entry.size))
+		if options.Resolve == nil {
+			continue
+		}
+		target, mapped := options.Resolve(entry.start.Address)
+		if !mapped {
+			continue
+		}
+		err := parsingutils.AddLinkWithAddr(block, "Address", "starts at", target)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return root, starts, nil
+}
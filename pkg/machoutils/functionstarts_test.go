@@ -0,0 +1,60 @@
+package machoutils_test
+
+import (
+	"testing"
+
+	"github.com/LouisBrunner/mem-viz/pkg/machoutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_ParseFunctionStarts(t *testing.T) {
+	// 0x100000f00 (_main), 0x100000f40 (stripped), 0x100001080 (unmapped), then the terminator and padding
+	data := []byte{0x80, 0x1e, 0x40, 0xc0, 0x02, 0x00, 0x00, 0x00}
+	tree, starts, err := machoutils.ParseFunctionStarts(data, 0x2000, machoutils.FunctionStartsOptions{
+		Base: 0x100000000,
+		Resolve: func(vmAddr uint64) (uintptr, bool) {
+			return uintptr(vmAddr - 0x100000000), vmAddr < 0x100001000
+		},
+		Symbol: func(vmAddr uint64) (string, bool) {
+			return "_main", vmAddr == 0x100000f00
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "Function Starts (3 functions)", tree.Name)
+	assert.Equal(t, uint64(8), tree.Size)
+	assert.Equal(t, []machoutils.FunctionStart{
+		{Address: 0x100000f00, Name: "_main"},
+		{Address: 0x100000f40},
+		{Address: 0x100001080},
+	}, starts)
+	require.Len(t, tree.Content, 3)
+
+	main := tree.Content[0]
+	assert.Equal(t, "Function Start _main", main.Name)
+	assert.Equal(t, uint64(2), main.Size)
+	require.Len(t, main.Values[1].Links, 1)
+	assert.Equal(t, uint64(0xf00), main.Values[1].Links[0].TargetAddress)
+
+	stripped := tree.Content[1]
+	assert.Equal(t, "Function Start 0x100000f40", stripped.Name)
+	assert.Equal(t, uintptr(0x2002), stripped.Address)
+	assert.Equal(t, "0x40", stripped.Values[0].Value)
+	require.Len(t, stripped.Values[1].Links, 1)
+
+	unmapped := tree.Content[2]
+	assert.Equal(t, uint64(2), unmapped.Size)
+	assert.Len(t, unmapped.Values[1].Links, 0)
+}
+
+func Test_ParseFunctionStarts_tooBig(t *testing.T) {
+	tree, starts, err := machoutils.ParseFunctionStarts([]byte{0x10, 0x10, 0x10, 0x00}, 0, machoutils.FunctionStartsOptions{TooBig: 2})
+	require.NoError(t, err)
+	assert.Len(t, starts, 3)
+	assert.Len(t, tree.Content, 0)
+}
+
+func Test_ParseFunctionStarts_truncated(t *testing.T) {
+	_, _, err := machoutils.ParseFunctionStarts([]byte{0x10, 0x80}, 0, machoutils.FunctionStartsOptions{})
+	assert.Error(t, err)
+}
@@ -0,0 +1,53 @@
+package machoutils
+
+import "fmt"
+
+// Reads the ULEB128 at offset, returning its value and how many bytes it used
+func ReadULEB128(data []byte, offset uint64) (uint64, uint64, error) {
+	value := uint64(0)
+	shift := uint(0)
+	cursor := offset
+	for {
+		if cursor >= uint64(len(data)) {
+			return 0, 0, fmt.Errorf("truncated ULEB128 at %#x", offset)
+		}
+		b := data[cursor]
+		cursor += 1
+		if shift >= 64 && b&0x7f != 0 {
+			return 0, 0, fmt.Errorf("ULEB128 at %#x is too big", offset)
+		}
+		if shift < 64 {
+			value |= uint64(b&0x7f) << shift
+		}
+		shift += 7
+		if b&0x80 == 0 {
+			break
+		}
+	}
+	return value, cursor - offset, nil
+}
+
+// Reads the SLEB128 at offset, returning its value and how many bytes it used
+func ReadSLEB128(data []byte, offset uint64) (int64, uint64, error) {
+	value := int64(0)
+	shift := uint(0)
+	cursor := offset
+	for {
+		if cursor >= uint64(len(data)) {
+			return 0, 0, fmt.Errorf("truncated SLEB128 at %#x", offset)
+		}
+		b := data[cursor]
+		cursor += 1
+		if shift < 64 {
+			value |= int64(b&0x7f) << shift
+		}
+		shift += 7
+		if b&0x80 == 0 {
+			if shift < 64 && b&0x40 != 0 {
+				value |= -1 << shift
+			}
+			break
+		}
+	}
+	return value, cursor - offset, nil
+}
@@ -0,0 +1,173 @@
+package machotest
+
+import (
+	"encoding/binary"
+
+	"github.com/blacktop/go-macho/types"
+)
+
+// Builders of small Mach-O images shared by the tests of the parsers, only what they need is filled
+
+type Segment struct {
+	Name           string
+	Addr, Size     uint32
+	Offset, FileSz uint32
+	// Segments get a single section (none if empty), starting after Skip bytes (e.g. the headers in __TEXT)
+	Section string
+	Skip    uint32
+	// More sections, after the one above
+	Sections []Section
+}
+
+type Section struct {
+	Name string
+	// Start is relative to the segment
+	Start, Size          uint32
+	Flags                uint32
+	Reserved1, Reserved2 uint32
+}
+
+func fixedString(name string) []byte {
+	return append([]byte(name), make([]byte, 16-len(name))...)
+}
+
+// Builds a load command from the fields following its cmd and cmdsize
+func Command(order binary.AppendByteOrder, cmd types.LoadCmd, fields ...uint32) []byte {
+	data := order.AppendUint32(nil, uint32(cmd))
+	data = order.AppendUint32(data, uint32(8+4*len(fields)))
+	for _, field := range fields {
+		data = order.AppendUint32(data, field)
+	}
+	return data
+}
+
+// Builds a 32-bit Mach-O of the given size with the segments and extra load commands, the caller fills the contents
+func MachO32(order binary.AppendByteOrder, cpu types.CPU, size int, segments []Segment, commands ...[]byte) []byte {
+	cmds := []byte{}
+	for _, seg := range segments {
+		sections := seg.Sections
+		if seg.Section != "" {
+			sections = append([]Section{{Name: seg.Section, Start: seg.Skip, Size: seg.FileSz - seg.Skip}}, sections...)
+		}
+		cmds = order.AppendUint32(cmds, uint32(types.LC_SEGMENT))
+		cmds = order.AppendUint32(cmds, uint32(56+68*len(sections)))
+		cmds = append(cmds, fixedString(seg.Name)...)
+		for _, v := range []uint32{seg.Addr, seg.Size, seg.Offset, seg.FileSz, 7, 7, uint32(len(sections)), 0} {
+			cmds = order.AppendUint32(cmds, v)
+		}
+		for _, sect := range sections {
+			cmds = append(cmds, fixedString(sect.Name)...)
+			cmds = append(cmds, fixedString(seg.Name)...)
+			for _, v := range []uint32{seg.Addr + sect.Start, sect.Size, seg.Offset + sect.Start, 2, 0, 0, sect.Flags, sect.Reserved1, sect.Reserved2} {
+				cmds = order.AppendUint32(cmds, v)
+			}
+		}
+	}
+	for _, cmd := range commands {
+		cmds = append(cmds, cmd...)
+	}
+
+	data := make([]byte, size)
+	header := []byte{}
+	for _, v := range []uint32{uint32(types.Magic32), uint32(cpu), 0, uint32(types.MH_EXECUTE), uint32(len(segments) + len(commands)), uint32(len(cmds)), 0} {
+		header = order.AppendUint32(header, v)
+	}
+	copy(data, append(header, cmds...))
+	return data
+}
+
+// Builds a 64-bit Mach-O of the given file type, otherwise like MachO32
+func MachO64(order binary.AppendByteOrder, cpu types.CPU, fileType types.HeaderFileType, size int, segments []Segment, commands ...[]byte) []byte {
+	cmds := []byte{}
+	for _, seg := range segments {
+		sections := seg.Sections
+		if seg.Section != "" {
+			sections = append([]Section{{Name: seg.Section, Start: seg.Skip, Size: seg.FileSz - seg.Skip}}, sections...)
+		}
+		cmds = order.AppendUint32(cmds, uint32(types.LC_SEGMENT_64))
+		cmds = order.AppendUint32(cmds, uint32(72+80*len(sections)))
+		cmds = append(cmds, fixedString(seg.Name)...)
+		for _, v := range []uint32{seg.Addr, seg.Size, seg.Offset, seg.FileSz} {
+			cmds = order.AppendUint64(cmds, uint64(v))
+		}
+		for _, v := range []uint32{7, 7, uint32(len(sections)), 0} {
+			cmds = order.AppendUint32(cmds, v)
+		}
+		for _, sect := range sections {
+			cmds = append(cmds, fixedString(sect.Name)...)
+			cmds = append(cmds, fixedString(seg.Name)...)
+			cmds = order.AppendUint64(cmds, uint64(seg.Addr+sect.Start))
+			cmds = order.AppendUint64(cmds, uint64(sect.Size))
+			for _, v := range []uint32{seg.Offset + sect.Start, 2, 0, 0, sect.Flags, sect.Reserved1, sect.Reserved2, 0} {
+				cmds = order.AppendUint32(cmds, v)
+			}
+		}
+	}
+	for _, cmd := range commands {
+		cmds = append(cmds, cmd...)
+	}
+
+	data := make([]byte, size)
+	header := []byte{}
+	for _, v := range []uint32{uint32(types.Magic64), uint32(cpu), 0, uint32(fileType), uint32(len(segments) + len(commands)), uint32(len(cmds)), 0, 0} {
+		header = order.AppendUint32(header, v)
+	}
+	copy(data, append(header, cmds...))
+	return data
+}
+
+// Builds a LC_FILESET_ENTRY for the entry at the given offset of the collection
+func FilesetEntry(order binary.AppendByteOrder, addr, offset uint64, id string) []byte {
+	name := append([]byte(id), make([]byte, 8-len(id)%8)...)
+	data := order.AppendUint32(nil, uint32(types.LC_FILESET_ENTRY))
+	data = order.AppendUint32(data, uint32(32+len(name)))
+	data = order.AppendUint64(data, addr)
+	data = order.AppendUint64(data, offset)
+	data = order.AppendUint32(data, 32)
+	data = order.AppendUint32(data, 0)
+	return append(data, name...)
+}
+
+// A minimal PowerPC executable (so big-endian) whose symbol table defines _main at the start of __text (0x1200)
+func PPC() []byte {
+	be := binary.BigEndian
+	strings := "\x00_main\x00\x00"
+	data := MachO32(be, types.CPUPpc, 0x1000+12+len(strings), []Segment{
+		{Name: "__TEXT", Addr: 0x1000, Size: 0x1000, Offset: 0, FileSz: 0x1000, Section: "__text", Skip: 0x200},
+		{Name: "__LINKEDIT", Addr: 0x2000, Size: 0x1000, Offset: 0x1000, FileSz: uint32(12 + len(strings))},
+	}, Command(be, types.LC_SYMTAB, 0x1000, 1, 0x1000+12, uint32(len(strings))))
+	// nlist: n_strx, n_type (N_SECT|N_EXT), n_sect, n_desc, n_value
+	be.PutUint32(data[0x1000:], 1)
+	data[0x1004] = 0x0f
+	data[0x1005] = 1
+	be.PutUint32(data[0x1008:], 0x1200)
+	copy(data[0x1000+12:], strings)
+	// A few instructions so __text isn't empty
+	be.PutUint32(data[0x200:], 0x38600000) // li r3, 0
+	be.PutUint32(data[0x204:], 0x4e800020) // blr
+	return data
+}
+
+type FatSlice struct {
+	CPU  types.CPU
+	Data []byte
+}
+
+// Builds a universal binary (FAT_MAGIC) with the slices aligned on 0x1000 bytes, in order
+func Fat(slices ...FatSlice) []byte {
+	be := binary.BigEndian
+	data := be.AppendUint32(nil, uint32(types.MagicFat))
+	data = be.AppendUint32(data, uint32(len(slices)))
+	offset := uint32(0x1000)
+	for _, slice := range slices {
+		for _, v := range []uint32{uint32(slice.CPU), 0, offset, uint32(len(slice.Data)), 12} {
+			data = be.AppendUint32(data, v)
+		}
+		offset += (uint32(len(slice.Data)) + 0xfff) &^ 0xfff
+	}
+	for _, slice := range slices {
+		data = append(data, make([]byte, (len(data)+0xfff)&^0xfff-len(data))...)
+		data = append(data, slice.Data...)
+	}
+	return data
+}
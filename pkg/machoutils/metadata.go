@@ -0,0 +1,158 @@
+package machoutils
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/LouisBrunner/mem-viz/pkg/contracts"
+	"github.com/LouisBrunner/mem-viz/pkg/parsingutils"
+)
+
+// Generic reader for the ObjC and Swift metadata structures, which are mostly made of pointers and relative offsets.
+// Unlike the other decoders, they are scattered across sections so they are read from the whole image
+
+type MetadataImage struct {
+	Data      io.ReaderAt
+	ByteOrder parsingutils.ByteOrder
+	Is64      bool
+	// Turns a VM address into the offset of its data, false if it isn't backed by the file (e.g. __bss)
+	Resolve parsingutils.Resolver
+	// Reads the pointer at a VM address, returning either its target or the name of its bind
+	ReadPointer func(vmAddr uint64) (uint64, string, error)
+}
+
+type MetadataFieldKind int
+
+const (
+	MetadataPointer MetadataFieldKind = iota
+	MetadataUint16
+	MetadataUint32
+	MetadataRelative // int32 offset from the field itself
+)
+
+type MetadataField struct {
+	Name string
+	Kind MetadataFieldKind
+}
+
+type MetadataStruct struct {
+	// Given at the file offset of the structure, not yet added so links and values can be set beforehand
+	Block   *contracts.MemoryBlock
+	Address uint64
+	// What the structure describes (e.g. a class name), used when it is referenced again
+	Name string
+	// Pointers are resolved to VM addresses, relative offsets to their target
+	Values map[string]uint64
+	Binds  map[string]string
+}
+
+func MetadataFieldSize(image MetadataImage, field MetadataField) uint64 {
+	switch field.Kind {
+	case MetadataPointer:
+		if image.Is64 {
+			return 8
+		}
+		return 4
+	case MetadataUint16:
+		return 2
+	}
+	return 4
+}
+
+func MetadataStructSize(image MetadataImage, fields []MetadataField) uint64 {
+	size := uint64(0)
+	for _, field := range fields {
+		size += MetadataFieldSize(image, field)
+	}
+	return size
+}
+
+// Reads a structure at vmAddr, fails if any part of it (including its pointers) can't be resolved
+func ReadMetadataStruct(image MetadataImage, name string, vmAddr uint64, fields []MetadataField) (*MetadataStruct, error) {
+	offset, found := image.Resolve(vmAddr)
+	if !found {
+		return nil, fmt.Errorf("%s at %#x is not backed by the file", name, vmAddr)
+	}
+	raw := make([]byte, MetadataStructSize(image, fields))
+	_, err := image.Data.ReadAt(raw, int64(offset))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s at %#x: %w", name, vmAddr, err)
+	}
+	result := &MetadataStruct{
+		Block:   newBlock(name, offset, uint64(len(raw))),
+		Address: vmAddr,
+		Values:  map[string]uint64{},
+		Binds:   map[string]string{},
+	}
+	err = result.readFields(image, raw, fields)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s at %#x: %w", name, vmAddr, err)
+	}
+	return result, nil
+}
+
+func (me *MetadataStruct) readFields(image MetadataImage, raw []byte, fields []MetadataField) error {
+	order := parsingutils.OrLittleEndian(image.ByteOrder)
+	fieldOffset := uint64(0)
+	for _, field := range fields {
+		size := MetadataFieldSize(image, field)
+		data := raw[fieldOffset : fieldOffset+size]
+		switch field.Kind {
+		case MetadataPointer:
+			target, bind, err := image.ReadPointer(me.Address + fieldOffset)
+			if err != nil {
+				return fmt.Errorf("field %s: %w", field.Name, err)
+			}
+			if bind != "" {
+				me.Binds[field.Name] = bind
+				addValue(me.Block, field.Name, bind, fieldOffset, uint8(size))
+			} else {
+				me.Values[field.Name] = target
+				addValue(me.Block, field.Name, target, fieldOffset, uint8(size))
+			}
+		case MetadataUint16:
+			value := order.Uint16(data)
+			me.Values[field.Name] = uint64(value)
+			addValue(me.Block, field.Name, value, fieldOffset, uint8(size))
+		case MetadataUint32:
+			value := order.Uint32(data)
+			me.Values[field.Name] = uint64(value)
+			addValue(me.Block, field.Name, value, fieldOffset, uint8(size))
+		case MetadataRelative:
+			relative := int32(order.Uint32(data))
+			// A null relative pointer is 0, not the field itself
+			if relative != 0 {
+				me.Values[field.Name] = uint64(int64(me.Address+fieldOffset) + int64(relative))
+			}
+			addValue(me.Block, field.Name, relative, fieldOffset, uint8(size))
+		}
+		fieldOffset += size
+	}
+	return nil
+}
+
+// Links a field to whatever its value points to, if it is in the file
+func (me *MetadataStruct) Link(image MetadataImage, field, label string) error {
+	target, found := me.Values[field]
+	if !found || target == 0 {
+		return nil
+	}
+	return LinkToVMAddr(image, me.Block, field, label, target)
+}
+
+func LinkToVMAddr(image MetadataImage, block *contracts.MemoryBlock, field, label string, vmAddr uint64) error {
+	offset, found := image.Resolve(vmAddr)
+	if !found {
+		return nil
+	}
+	return parsingutils.AddLinkWithAddr(block, field, label, offset)
+}
+
+// Empty if the string isn't in the file
+func ReadCStringAt(image MetadataImage, vmAddr uint64) string {
+	offset, found := image.Resolve(vmAddr)
+	if !found {
+		return ""
+	}
+	return parsingutils.ReadCString(io.NewSectionReader(image.Data, int64(offset), 1<<16))
+}
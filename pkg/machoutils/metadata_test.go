@@ -0,0 +1,127 @@
+package machoutils_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"testing"
+
+	"github.com/LouisBrunner/mem-viz/pkg/contracts/contractstest"
+	"github.com/LouisBrunner/mem-viz/pkg/machoutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const metadataBase = 0x1000
+
+// A 32-bit little-endian image mapped at metadataBase, pointers are plain values unless they are binds
+func metadataImage(data []byte, binds map[uint64]string) machoutils.MetadataImage {
+	resolve := func(vmAddr uint64) (uintptr, bool) {
+		if vmAddr < metadataBase || vmAddr >= metadataBase+uint64(len(data)) {
+			return 0, false
+		}
+		return uintptr(vmAddr - metadataBase), true
+	}
+	return machoutils.MetadataImage{
+		Data:    bytes.NewReader(data),
+		Resolve: resolve,
+		ReadPointer: func(vmAddr uint64) (uint64, string, error) {
+			if name, found := binds[vmAddr]; found {
+				return 0, name, nil
+			}
+			offset, found := resolve(vmAddr)
+			if !found {
+				return 0, "", fmt.Errorf("pointer at %#x is not backed by the file", vmAddr)
+			}
+			return uint64(binary.LittleEndian.Uint32(data[offset:])), "", nil
+		},
+	}
+}
+
+var testFields = []machoutils.MetadataField{
+	{Name: "Pointer", Kind: machoutils.MetadataPointer},
+	{Name: "Bind", Kind: machoutils.MetadataPointer},
+	{Name: "Kind", Kind: machoutils.MetadataUint16},
+	{Name: "Flags", Kind: machoutils.MetadataUint32},
+	{Name: "Relative", Kind: machoutils.MetadataRelative},
+	{Name: "Null", Kind: machoutils.MetadataRelative},
+}
+
+func Test_ReadMetadataStruct(t *testing.T) {
+	le := binary.LittleEndian
+	data := make([]byte, 0x40)
+	le.PutUint32(data[0x10:], 0x1030)
+	le.PutUint16(data[0x18:], 7)
+	le.PutUint32(data[0x1a:], 0xdeadbeef)
+	le.PutUint32(data[0x1e:], uint32(0xfffffff0)) // -0x10
+	copy(data[0x30:], "name\x00")
+	image := metadataImage(data, map[uint64]string{0x1014: "_OBJC_CLASS_$_NSObject"})
+
+	assert.Equal(t, uint64(22), machoutils.MetadataStructSize(image, testFields))
+	image.Is64 = true
+	assert.Equal(t, uint64(30), machoutils.MetadataStructSize(image, testFields))
+	image.Is64 = false
+
+	s, err := machoutils.ReadMetadataStruct(image, "Test", 0x1010, testFields)
+	require.NoError(t, err)
+	assert.Equal(t, uintptr(0x10), s.Block.Address)
+	assert.Equal(t, uint64(22), s.Block.Size)
+	assert.Equal(t, uint64(0x1010), s.Address)
+	assert.Equal(t, map[string]uint64{
+		"Pointer":  0x1030,
+		"Kind":     7,
+		"Flags":    0xdeadbeef,
+		"Relative": 0x101e - 0x10,
+	}, s.Values)
+	assert.Equal(t, map[string]string{"Bind": "_OBJC_CLASS_$_NSObject"}, s.Binds)
+	assert.Equal(t, `"_OBJC_CLASS_$_NSObject"`, contractstest.FindValue(t, s.Block, "Bind").Value)
+	flags := contractstest.FindValue(t, s.Block, "Flags")
+	assert.Equal(t, uint64(0xa), flags.Offset)
+	assert.Equal(t, uint8(4), flags.Size)
+	assert.Equal(t, "-0x10", contractstest.FindValue(t, s.Block, "Relative").Value)
+	assert.Equal(t, "name", machoutils.ReadCStringAt(image, s.Values["Pointer"]))
+
+	// Only targets in the file are linked
+	require.NoError(t, s.Link(image, "Pointer", "points to"))
+	require.NoError(t, s.Link(image, "Null", "points to"))
+	require.NoError(t, machoutils.LinkToVMAddr(image, s.Block, "Flags", "points to", 0xdeadbeef))
+	pointer := contractstest.FindValue(t, s.Block, "Pointer")
+	require.Len(t, pointer.Links, 1)
+	assert.Equal(t, uint64(0x30), pointer.Links[0].TargetAddress)
+	assert.Empty(t, contractstest.FindValue(t, s.Block, "Null").Links)
+	assert.Empty(t, flags.Links)
+}
+
+func Test_ReadMetadataStruct_bigEndian(t *testing.T) {
+	data := []byte{0x00, 0x01, 0x00, 0x00, 0x00, 0x02}
+	image := metadataImage(data, nil)
+	image.ByteOrder = binary.BigEndian
+	s, err := machoutils.ReadMetadataStruct(image, "Test", 0x1000, []machoutils.MetadataField{
+		{Name: "Kind", Kind: machoutils.MetadataUint16},
+		{Name: "Flags", Kind: machoutils.MetadataUint32},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]uint64{"Kind": 1, "Flags": 2}, s.Values)
+}
+
+func Test_ReadMetadataStruct_unresolvable(t *testing.T) {
+	image := metadataImage(make([]byte, 0x10), nil)
+	image.ReadPointer = func(vmAddr uint64) (uint64, string, error) {
+		return 0, "", fmt.Errorf("unknown pointer format")
+	}
+	cases := map[string]struct {
+		vmAddr uint64
+		fields []machoutils.MetadataField
+	}{
+		"unmapped":  {vmAddr: 0x2000, fields: testFields[2:]},
+		"truncated": {vmAddr: 0x100c, fields: testFields[2:]},
+		"pointer":   {vmAddr: 0x1000, fields: testFields[:1]},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			_, err := machoutils.ReadMetadataStruct(image, "Test", c.vmAddr, c.fields)
+			assert.Error(t, err)
+		})
+	}
+	assert.Equal(t, "", machoutils.ReadCStringAt(image, 0x2000))
+}
@@ -0,0 +1,331 @@
+package machoutils
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"path/filepath"
+
+	"github.com/LouisBrunner/mem-viz/pkg/contracts"
+	"github.com/LouisBrunner/mem-viz/pkg/parsingutils"
+)
+
+// Owners of the LC_NOTEs written in core files by xnu and lldb (see lldb's ObjectFileMachO.cpp)
+
+const (
+	NOTE_ADDRABLE_BITS   = "addrable bits"
+	NOTE_LOAD_BINARY     = "load binary"
+	NOTE_ALL_IMAGE_INFOS = "all image infos"
+)
+
+// Used by the notes when an address (or an offset) is not known
+const NoteUnknownAddress = math.MaxUint64
+
+const (
+	allImageInfosHeaderSize = 24
+	allImageInfosEntrySize  = 48
+	allImageInfosSegSize    = 32
+)
+
+// A binary loaded in the process, as described by the notes of a core file
+type CoreImage struct {
+	// Empty if unknown
+	Path string
+	UUID [16]byte
+	// NoteUnknownAddress if unknown
+	LoadAddress uint64
+	// VM addresses of its segments, by name (only given by all image infos)
+	Segments map[string]uint64
+}
+
+type NoteOptions struct {
+	ByteOrder parsingutils.ByteOrder
+	Resolve   parsingutils.Resolver
+}
+
+type noteParser struct {
+	options NoteOptions
+	order   binary.ByteOrder
+	data    []byte
+	address uintptr
+}
+
+// Parses the payload of an LC_NOTE, data must contain exactly the payload and address must be its file offset
+// (all image infos refers to the rest of its payload by file offset).
+// The binaries described by the note are also returned so callers can find them in the core, unknown owners return a nil tree
+func ParseNote(owner string, data []byte, address uintptr, options NoteOptions) (*contracts.MemoryBlock, []CoreImage, error) {
+	p := noteParser{
+		options: options,
+		order:   parsingutils.OrLittleEndian(options.ByteOrder),
+		data:    data,
+		address: address,
+	}
+	switch owner {
+	case NOTE_ADDRABLE_BITS:
+		tree, err := p.parseAddrableBits()
+		return tree, nil, err
+	case NOTE_LOAD_BINARY:
+		return p.parseLoadBinary()
+	case NOTE_ALL_IMAGE_INFOS:
+		return p.parseAllImageInfos()
+	}
+	return nil, nil, nil
+}
+
+func (me *noteParser) u32(offset uint64) (uint32, error) {
+	raw, err := subSlice(me.data, offset, 4)
+	if err != nil {
+		return 0, err
+	}
+	return me.order.Uint32(raw), nil
+}
+
+func (me *noteParser) u64(offset uint64) (uint64, error) {
+	raw, err := subSlice(me.data, offset, 8)
+	if err != nil {
+		return 0, err
+	}
+	return me.order.Uint64(raw), nil
+}
+
+func (me *noteParser) uuid(offset uint64) ([16]byte, error) {
+	uuid := [16]byte{}
+	raw, err := subSlice(me.data, offset, 16)
+	if err != nil {
+		return uuid, err
+	}
+	copy(uuid[:], raw)
+	return uuid, nil
+}
+
+// Converts a file offset found in the note into an offset inside of it
+func (me *noteParser) relative(fileOffset, size uint64) (uint64, error) {
+	if fileOffset < uint64(me.address) {
+		return 0, fmt.Errorf("offset %#x is before the note", fileOffset)
+	}
+	offset := fileOffset - uint64(me.address)
+	_, err := subSlice(me.data, offset, size)
+	if err != nil {
+		return 0, fmt.Errorf("offset %#x is outside of the note: %w", fileOffset, err)
+	}
+	return offset, nil
+}
+
+func (me *noteParser) linkAddress(block *contracts.MemoryBlock, name string, vmAddr uint64) error {
+	if me.options.Resolve == nil || vmAddr == NoteUnknownAddress {
+		return nil
+	}
+	target, mapped := me.options.Resolve(vmAddr)
+	if !mapped {
+		return nil
+	}
+	return parsingutils.AddLinkWithAddr(block, name, "points to", target)
+}
+
+// Adds the NUL-terminated string at offset as a child of the note, returns it along with its block
+func (me *noteParser) addString(root *contracts.MemoryBlock, offset uint64) (string, *contracts.MemoryBlock, error) {
+	str, err := readCString(me.data, offset)
+	if err != nil {
+		return "", nil, err
+	}
+	return str, addChild(root, fmt.Sprintf("%q", str), offset, uint64(len(str)+1)), nil
+}
+
+// Version 3 has a single amount of bits, version 4 distinguishes low and high memory (e.g. for the kernel)
+func (me *noteParser) parseAddrableBits() (*contracts.MemoryBlock, error) {
+	root := newBlock("Addressable Bits", me.address, uint64(len(me.data)))
+	version, err := me.u32(0)
+	if err != nil {
+		return nil, err
+	}
+	addValue(root, "Version", version, 0, 4)
+	fields := []string{"Bits"}
+	if version >= 4 {
+		fields = []string{"LoAddrBits", "HiAddrBits"}
+	}
+	offset := uint64(4)
+	for _, field := range fields {
+		bits, err := me.u32(offset)
+		if err != nil {
+			return nil, err
+		}
+		addValue(root, field, bits, offset, 4)
+		offset += 4
+	}
+	// Version 3 pads with a uint64 and version 4 with a uint32
+	switch uint64(len(me.data)) - offset {
+	case 4:
+		addValue(root, "Reserved", me.order.Uint32(me.data[offset:]), offset, 4)
+	case 8:
+		addValue(root, "Reserved", me.order.Uint64(me.data[offset:]), offset, 8)
+	}
+	return root, nil
+}
+
+// Describes a single binary (usually the kernel or the main executable), the slide only appeared in version 2
+func (me *noteParser) parseLoadBinary() (*contracts.MemoryBlock, []CoreImage, error) {
+	root := newBlock("Load Binary", me.address, uint64(len(me.data)))
+	version, err := me.u32(0)
+	if err != nil {
+		return nil, nil, err
+	}
+	addValue(root, "Version", version, 0, 4)
+	image := CoreImage{}
+	image.UUID, err = me.uuid(4)
+	if err != nil {
+		return nil, nil, err
+	}
+	addValue(root, "UUID", image.UUID, 4, 16)
+	image.LoadAddress, err = me.u64(20)
+	if err != nil {
+		return nil, nil, err
+	}
+	addValue(root, "LoadAddress", image.LoadAddress, 20, 8)
+	err = me.linkAddress(root, "LoadAddress", image.LoadAddress)
+	if err != nil {
+		return nil, nil, err
+	}
+	offset := uint64(28)
+	if version >= 2 {
+		slide, err := me.u64(offset)
+		if err != nil {
+			return nil, nil, err
+		}
+		addValue(root, "Slide", slide, offset, 8)
+		offset += 8
+	}
+	image.Path, _, err = me.addString(root, offset)
+	if err != nil {
+		return nil, nil, err
+	}
+	if image.Path != "" {
+		root.Name = fmt.Sprintf("%s (%s)", root.Name, filepath.Base(image.Path))
+	}
+	return root, []CoreImage{image}, nil
+}
+
+// Describes every binary loaded in the process, with the addresses of their segments (written by lldb's save-core)
+func (me *noteParser) parseAllImageInfos() (*contracts.MemoryBlock, []CoreImage, error) {
+	_, err := subSlice(me.data, 0, allImageInfosHeaderSize)
+	if err != nil {
+		return nil, nil, err
+	}
+	root := newBlock("All Image Infos", me.address, uint64(len(me.data)))
+	header := addChild(root, "Header", 0, allImageInfosHeaderSize)
+	version := me.order.Uint32(me.data)
+	count := me.order.Uint32(me.data[4:])
+	entriesOffset := me.order.Uint64(me.data[8:])
+	entrySize := me.order.Uint32(me.data[16:])
+	addValue(header, "Version", version, 0, 4)
+	addValue(header, "ImgCount", count, 4, 4)
+	addValue(header, "EntriesFileoff", entriesOffset, 8, 8)
+	addValue(header, "EntriesSize", entrySize, 16, 4)
+	root.Name = fmt.Sprintf("%s (%d images)", root.Name, count)
+	if count == 0 {
+		return root, nil, nil
+	}
+	if entrySize < allImageInfosEntrySize {
+		return nil, nil, fmt.Errorf("image entries are too small (%d bytes)", entrySize)
+	}
+
+	entriesStart, err := me.relative(entriesOffset, uint64(count)*uint64(entrySize))
+	if err != nil {
+		return nil, nil, err
+	}
+	entries := addChild(root, fmt.Sprintf("Image Entries (%d)", count), entriesStart, uint64(count)*uint64(entrySize))
+	err = parsingutils.AddLinkWithBlock(header, "EntriesFileoff", entries, "points to")
+	if err != nil {
+		return nil, nil, err
+	}
+	err = parsingutils.AddLinkWithBlock(header, "ImgCount", entries, "gives amount")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	images := make([]CoreImage, 0, count)
+	for i := uint64(0); i < uint64(count); i += 1 {
+		image, err := me.parseImageEntry(root, entries, entriesStart+i*uint64(entrySize), i)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to parse image %d: %w", i, err)
+		}
+		images = append(images, image)
+	}
+	sortContent(root)
+	return root, images, nil
+}
+
+func (me *noteParser) parseImageEntry(root, entries *contracts.MemoryBlock, offset, i uint64) (CoreImage, error) {
+	// The entries were already checked to be inside of the note
+	raw := me.data[offset:]
+	image := CoreImage{
+		LoadAddress: me.order.Uint64(raw[24:]),
+		Segments:    map[string]uint64{},
+	}
+	copy(image.UUID[:], raw[8:])
+	pathOffset := me.order.Uint64(raw)
+	segmentsOffset := me.order.Uint64(raw[32:])
+	segmentCount := me.order.Uint32(raw[40:])
+
+	entry := addChild(entries, fmt.Sprintf("Image %d", i), offset-entries.ParentOffset, allImageInfosEntrySize)
+	addValue(entry, "FilepathOffset", pathOffset, 0, 8)
+	addValue(entry, "UUID", image.UUID, 8, 16)
+	addValue(entry, "LoadAddress", image.LoadAddress, 24, 8)
+	addValue(entry, "SegAddrsOffset", segmentsOffset, 32, 8)
+	addValue(entry, "SegmentCount", segmentCount, 40, 4)
+	addValue(entry, "Unused", me.order.Uint32(raw[44:]), 44, 4)
+	err := me.linkAddress(entry, "LoadAddress", image.LoadAddress)
+	if err != nil {
+		return image, err
+	}
+
+	if pathOffset != NoteUnknownAddress {
+		start, err := me.relative(pathOffset, 1)
+		if err != nil {
+			return image, err
+		}
+		var str *contracts.MemoryBlock
+		image.Path, str, err = me.addString(root, start)
+		if err != nil {
+			return image, err
+		}
+		entry.Name = fmt.Sprintf("%s (%s)", entry.Name, filepath.Base(image.Path))
+		err = parsingutils.AddLinkWithBlock(entry, "FilepathOffset", str, "name")
+		if err != nil {
+			return image, err
+		}
+	}
+
+	if segmentCount == 0 {
+		return image, nil
+	}
+	start, err := me.relative(segmentsOffset, uint64(segmentCount)*allImageInfosSegSize)
+	if err != nil {
+		return image, err
+	}
+	segments := addChild(root, fmt.Sprintf("Segment Addresses (%s)", entry.Name), start, uint64(segmentCount)*allImageInfosSegSize)
+	err = parsingutils.AddLinkWithBlock(entry, "SegAddrsOffset", segments, "points to")
+	if err != nil {
+		return image, err
+	}
+	err = parsingutils.AddLinkWithBlock(entry, "SegmentCount", segments, "gives amount")
+	if err != nil {
+		return image, err
+	}
+	for j := uint64(0); j < uint64(segmentCount); j += 1 {
+		segOffset := start + j*allImageInfosSegSize
+		name := [16]byte{}
+		copy(name[:], me.data[segOffset:])
+		vmAddr := me.order.Uint64(me.data[segOffset+16:])
+		segment := addChild(segments, "", j*allImageInfosSegSize, allImageInfosSegSize)
+		addValue(segment, "Segname", name, 0, 16)
+		addValue(segment, "VMAddr", vmAddr, 16, 8)
+		addValue(segment, "Unused", me.order.Uint64(me.data[segOffset+24:]), 24, 8)
+		segment.Name = fmt.Sprintf("Segment (%s)", segment.Values[0].Value)
+		image.Segments[segment.Values[0].Value] = vmAddr
+		err = me.linkAddress(segment, "VMAddr", vmAddr)
+		if err != nil {
+			return image, err
+		}
+	}
+	return image, nil
+}
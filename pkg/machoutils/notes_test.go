@@ -0,0 +1,118 @@
+package machoutils_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/LouisBrunner/mem-viz/pkg/machoutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func notePayload(t *testing.T, fields ...any) []byte {
+	buf := &bytes.Buffer{}
+	for _, field := range fields {
+		require.NoError(t, binary.Write(buf, binary.LittleEndian, field))
+	}
+	return buf.Bytes()
+}
+
+// Everything between 0x100000000 and 0x100004000 is mapped at 0x8000 in the core
+func resolveNote(vmAddr uint64) (uintptr, bool) {
+	if vmAddr < 0x100000000 || vmAddr >= 0x100004000 {
+		return 0, false
+	}
+	return uintptr(vmAddr - 0x100000000 + 0x8000), true
+}
+
+func Test_ParseNote_addrableBits(t *testing.T) {
+	tree, images, err := machoutils.ParseNote(machoutils.NOTE_ADDRABLE_BITS, notePayload(t, uint32(4), uint32(47), uint32(55), uint32(0)), 0x400, machoutils.NoteOptions{})
+	require.NoError(t, err)
+	assert.Nil(t, images)
+	assert.Equal(t, "Addressable Bits", tree.Name)
+	require.Len(t, tree.Values, 4)
+	assert.Equal(t, "LoAddrBits", tree.Values[1].Name)
+	assert.Equal(t, "0x2f", tree.Values[1].Value)
+	assert.Equal(t, "HiAddrBits", tree.Values[2].Name)
+
+	tree, _, err = machoutils.ParseNote(machoutils.NOTE_ADDRABLE_BITS, notePayload(t, uint32(3), uint32(47), uint64(0)), 0x400, machoutils.NoteOptions{})
+	require.NoError(t, err)
+	require.Len(t, tree.Values, 3)
+	assert.Equal(t, "Bits", tree.Values[1].Name)
+	assert.Equal(t, uint8(8), tree.Values[2].Size)
+}
+
+func Test_ParseNote_loadBinary(t *testing.T) {
+	uuid := [16]byte{0xde, 0xad, 0xbe, 0xef}
+	data := notePayload(t, uint32(2), uuid, uint64(0x100000000), uint64(0), []byte("/usr/bin/true\x00"))
+	tree, images, err := machoutils.ParseNote(machoutils.NOTE_LOAD_BINARY, data, 0x400, machoutils.NoteOptions{Resolve: resolveNote})
+	require.NoError(t, err)
+	assert.Equal(t, []machoutils.CoreImage{{Path: "/usr/bin/true", UUID: uuid, LoadAddress: 0x100000000}}, images)
+	assert.Equal(t, "Load Binary (true)", tree.Name)
+	assert.Equal(t, "deadbeef-0000-0000-0000-000000000000", tree.Values[1].Value)
+	require.Len(t, tree.Values[2].Links, 1)
+	assert.Equal(t, uint64(0x8000), tree.Values[2].Links[0].TargetAddress)
+	assert.Equal(t, "Slide", tree.Values[3].Name)
+	require.Len(t, tree.Content, 1)
+	assert.Equal(t, `"/usr/bin/true"`, tree.Content[0].Name)
+	assert.Equal(t, uintptr(0x400+36), tree.Content[0].Address)
+
+	// Version 1 has no slide
+	data = notePayload(t, uint32(1), uuid, uint64(machoutils.NoteUnknownAddress), []byte("\x00"))
+	tree, images, err = machoutils.ParseNote(machoutils.NOTE_LOAD_BINARY, data, 0x400, machoutils.NoteOptions{Resolve: resolveNote})
+	require.NoError(t, err)
+	assert.Equal(t, "Load Binary", tree.Name)
+	assert.Len(t, tree.Values, 3)
+	assert.Len(t, tree.Values[2].Links, 0)
+	assert.Equal(t, uint64(machoutils.NoteUnknownAddress), images[0].LoadAddress)
+}
+
+func Test_ParseNote_allImageInfos(t *testing.T) {
+	// header, 2 entries, 1 segment and 1 path (the second image has neither)
+	const base = 0x400
+	segments := base + 24 + 2*48
+	path := segments + 32
+	data := notePayload(t,
+		uint32(1), uint32(2), uint64(base+24), uint32(48), uint32(0),
+		uint64(path), [16]byte{1}, uint64(0x100000000), uint64(segments), uint32(1), uint32(0),
+		uint64(machoutils.NoteUnknownAddress), [16]byte{2}, uint64(0x7ff800000000), uint64(0), uint32(0), uint32(0),
+		[16]byte{'_', '_', 'T', 'E', 'X', 'T'}, uint64(0x100000000), uint64(0),
+		[]byte("/bin/ls\x00"),
+	)
+	tree, images, err := machoutils.ParseNote(machoutils.NOTE_ALL_IMAGE_INFOS, data, base, machoutils.NoteOptions{Resolve: resolveNote})
+	require.NoError(t, err)
+	assert.Equal(t, []machoutils.CoreImage{
+		{Path: "/bin/ls", UUID: [16]byte{1}, LoadAddress: 0x100000000, Segments: map[string]uint64{"__TEXT": 0x100000000}},
+		{UUID: [16]byte{2}, LoadAddress: 0x7ff800000000, Segments: map[string]uint64{}},
+	}, images)
+	assert.Equal(t, "All Image Infos (2 images)", tree.Name)
+	require.Len(t, tree.Content, 4)
+	assert.Equal(t, "Header", tree.Content[0].Name)
+	assert.Equal(t, uint64(base+24), tree.Content[0].Values[2].Links[0].TargetAddress)
+
+	entries := tree.Content[1]
+	assert.Equal(t, "Image Entries (2)", entries.Name)
+	require.Len(t, entries.Content, 2)
+	assert.Equal(t, "Image 0 (ls)", entries.Content[0].Name)
+	assert.Equal(t, uint64(path), entries.Content[0].Values[0].Links[0].TargetAddress)
+	assert.Equal(t, uint64(0x8000), entries.Content[0].Values[2].Links[0].TargetAddress)
+	assert.Equal(t, "Image 1", entries.Content[1].Name)
+	assert.Len(t, entries.Content[1].Values[2].Links, 0)
+
+	segmentsBlock := tree.Content[2]
+	assert.Equal(t, "Segment Addresses (Image 0 (ls))", segmentsBlock.Name)
+	require.Len(t, segmentsBlock.Content, 1)
+	assert.Equal(t, "Segment (__TEXT)", segmentsBlock.Content[0].Name)
+	assert.Equal(t, `"/bin/ls"`, tree.Content[3].Name)
+
+	_, _, err = machoutils.ParseNote(machoutils.NOTE_ALL_IMAGE_INFOS, data[:100], base, machoutils.NoteOptions{})
+	assert.Error(t, err)
+}
+
+func Test_ParseNote_unknown(t *testing.T) {
+	tree, images, err := machoutils.ParseNote("main bin spec", []byte{1, 2, 3, 4}, 0, machoutils.NoteOptions{})
+	require.NoError(t, err)
+	assert.Nil(t, tree)
+	assert.Nil(t, images)
+}
@@ -0,0 +1,147 @@
+package machoutils
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/LouisBrunner/mem-viz/pkg/contracts"
+	"github.com/LouisBrunner/mem-viz/pkg/parsingutils"
+)
+
+type RelocationTarget struct {
+	Name string
+	// Where the target is in the final tree
+	Address uintptr
+}
+
+type RelocationOptions struct {
+	// CPU type of the image, used to name the relocation types
+	CPU       uint32
+	ByteOrder parsingutils.ByteOrder
+	// VM address r_address is relative to (the section for section relocations)
+	Base    uint64
+	Resolve parsingutils.Resolver
+	// Finds the symbol table entry for an external relocation, false if it doesn't exist
+	Symbol func(index uint32) (RelocationTarget, bool)
+	// Finds the section (1-based ordinal) for a local relocation, false if it doesn't exist
+	Section func(ordinal uint32) (RelocationTarget, bool)
+	// Entries are not detailed if there are more than this (0 means no limit)
+	TooBig uint64
+}
+
+// PAIR entries only carry the other half of the previous relocation
+func isPairRelocation(cpu uint32, typ uint8) bool {
+	switch cpu {
+	case CPU_TYPE_X86, CPU_TYPE_ARM, CPU_TYPE_POWERPC, CPU_TYPE_POWERPC64:
+		return typ == 1
+	}
+	return false
+}
+
+// ARM64_RELOC_ADDEND stores the addend of the next relocation in r_symbolnum
+func isAddendRelocation(cpu uint32, typ uint8) bool {
+	return (cpu == CPU_TYPE_ARM64 || cpu == CPU_TYPE_ARM64_32) && typ == 10
+}
+
+// Parses an array of relocation_info (and scattered_relocation_info), data must contain exactly the entries
+func ParseRelocations(data []byte, address uintptr, options RelocationOptions) (*contracts.MemoryBlock, error) {
+	if uint64(len(data))%RelocationInfoSize != 0 {
+		return nil, fmt.Errorf("relocations size %#x is not a multiple of %d", len(data), RelocationInfoSize)
+	}
+	order := parsingutils.OrLittleEndian(options.ByteOrder)
+	count := uint64(len(data)) / RelocationInfoSize
+	root := newBlock(fmt.Sprintf("Relocations (%d entries)", count), address, uint64(len(data)))
+	if options.TooBig != 0 && count > options.TooBig {
+		return root, nil
+	}
+
+	for i := uint64(0); i < count; i += 1 {
+		offset := i * RelocationInfoSize
+		reloc := DecodeRelocation(order.Uint32(data[offset:]), order.Uint32(data[offset+4:]), order == binary.BigEndian)
+		err := addRelocation(root, offset, reloc, options)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse relocation %d: %w", i, err)
+		}
+	}
+	return root, nil
+}
+
+func addRelocation(root *contracts.MemoryBlock, offset uint64, reloc Relocation, options RelocationOptions) error {
+	typeName := RelocationTypeName(options.CPU, reloc.Type)
+	pair := isPairRelocation(options.CPU, reloc.Type)
+
+	var target *RelocationTarget
+	targetLabel := ""
+	switch {
+	case pair, reloc.Scattered, isAddendRelocation(options.CPU, reloc.Type):
+	case reloc.Extern:
+		targetLabel = fmt.Sprintf("Symbol %d", reloc.SymbolNum)
+		if options.Symbol != nil {
+			if found, ok := options.Symbol(reloc.SymbolNum); ok {
+				target = &found
+				targetLabel = found.Name
+			}
+		}
+	case reloc.SymbolNum == R_ABS:
+		targetLabel = "ABS"
+	default:
+		targetLabel = fmt.Sprintf("Section %d", reloc.SymbolNum)
+		if options.Section != nil {
+			if found, ok := options.Section(reloc.SymbolNum); ok {
+				target = &found
+				targetLabel = found.Name
+			}
+		}
+	}
+
+	name := fmt.Sprintf("%s (+%#x)", typeName, reloc.Address)
+	if pair {
+		name = typeName
+	} else if targetLabel != "" {
+		name = fmt.Sprintf("%s %s (+%#x)", typeName, targetLabel, reloc.Address)
+	}
+	block := addChild(root, name, offset, RelocationInfoSize)
+
+	if reloc.Scattered {
+		addValue(block, "Address", reloc.Address, 0, 4)
+		addValue(block, "Type", typeName, 0, 4)
+		addValue(block, "Length", reloc.Length, 0, 4)
+		addValue(block, "PCRel", reloc.PCRel, 0, 4)
+		addValue(block, "Scattered", reloc.Scattered, 0, 4)
+		addValue(block, "Value", reloc.Value, 4, 4)
+	} else {
+		addValue(block, "Address", reloc.Address, 0, 4)
+		if isAddendRelocation(options.CPU, reloc.Type) {
+			addValue(block, "Addend", reloc.SymbolNum, 4, 4)
+		} else {
+			addValue(block, "SymbolNum", reloc.SymbolNum, 4, 4)
+		}
+		addValue(block, "PCRel", reloc.PCRel, 4, 4)
+		addValue(block, "Length", reloc.Length, 4, 4)
+		addValue(block, "Extern", reloc.Extern, 4, 4)
+		addValue(block, "Type", typeName, 4, 4)
+	}
+
+	if options.Resolve != nil && !pair {
+		patched, mapped := options.Resolve(options.Base + uint64(reloc.Address))
+		if mapped {
+			err := parsingutils.AddLinkWithAddr(block, "Address", "patches", patched)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if options.Resolve != nil && reloc.Scattered {
+		value, mapped := options.Resolve(uint64(reloc.Value))
+		if mapped {
+			err := parsingutils.AddLinkWithAddr(block, "Value", "refers to", value)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if target != nil {
+		return parsingutils.AddLinkWithAddr(block, "SymbolNum", "refers to", target.Address)
+	}
+	return nil
+}
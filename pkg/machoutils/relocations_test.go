@@ -0,0 +1,122 @@
+package machoutils_test
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/LouisBrunner/mem-viz/pkg/machoutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_DecodeRelocation(t *testing.T) {
+	// X86_64_RELOC_BRANCH, extern, pcrel, length 2, symbol 1
+	reloc := machoutils.DecodeRelocation(0x19, 0x2d000001, false)
+	assert.Equal(t, machoutils.Relocation{
+		Address:   0x19,
+		SymbolNum: 1,
+		PCRel:     true,
+		Length:    2,
+		Extern:    true,
+		Type:      2,
+	}, reloc)
+
+	// Same relocation with the bitfields of a big-endian file
+	reloc = machoutils.DecodeRelocation(0x19, 0x000001d2, true)
+	assert.Equal(t, machoutils.Relocation{
+		Address:   0x19,
+		SymbolNum: 1,
+		PCRel:     true,
+		Length:    2,
+		Extern:    true,
+		Type:      2,
+	}, reloc)
+
+	// GENERIC_RELOC_LOCAL_SECTDIFF, scattered
+	reloc = machoutils.DecodeRelocation(0xa400000e, 0x2d, false)
+	assert.Equal(t, machoutils.Relocation{
+		Scattered: true,
+		Address:   0xe,
+		Length:    2,
+		Type:      4,
+		Value:     0x2d,
+	}, reloc)
+}
+
+func Test_RelocationTypeName(t *testing.T) {
+	assert.Equal(t, "X86_64_RELOC_SIGNED", machoutils.RelocationTypeName(machoutils.CPU_TYPE_X86_64, 1))
+	assert.Equal(t, "GENERIC_RELOC_PAIR", machoutils.RelocationTypeName(machoutils.CPU_TYPE_X86, 1))
+	assert.Equal(t, "ARM64_RELOC_PAGE21", machoutils.RelocationTypeName(machoutils.CPU_TYPE_ARM64, 3))
+	assert.Equal(t, "PPC_RELOC_BR24", machoutils.RelocationTypeName(machoutils.CPU_TYPE_POWERPC, 3))
+	assert.Equal(t, "Unknown 15", machoutils.RelocationTypeName(machoutils.CPU_TYPE_X86_64, 15))
+}
+
+func Test_ParseRelocations(t *testing.T) {
+	data := []byte{
+		0x19, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x2d, // X86_64_RELOC_BRANCH, extern symbol 1
+		0x0b, 0x00, 0x00, 0x00, 0x02, 0x00, 0x00, 0x15, // X86_64_RELOC_SIGNED, section 2
+	}
+	relocs, err := machoutils.ParseRelocations(data, 0x100, machoutils.RelocationOptions{
+		CPU:  machoutils.CPU_TYPE_X86_64,
+		Base: 0x10,
+		Resolve: func(vmAddr uint64) (uintptr, bool) {
+			return uintptr(vmAddr + 0x1000), true
+		},
+		Symbol: func(index uint32) (machoutils.RelocationTarget, bool) {
+			return machoutils.RelocationTarget{Name: "_printf", Address: 0x2000}, index == 1
+		},
+		Section: func(ordinal uint32) (machoutils.RelocationTarget, bool) {
+			return machoutils.RelocationTarget{Name: "__TEXT,__cstring", Address: 0x3000}, ordinal == 2
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "Relocations (2 entries)", relocs.Name)
+	require.Len(t, relocs.Content, 2)
+
+	branch := relocs.Content[0]
+	assert.Equal(t, "X86_64_RELOC_BRANCH _printf (+0x19)", branch.Name)
+	assert.Equal(t, uint64(8), branch.Size)
+	require.Len(t, branch.Values[0].Links, 1)
+	assert.Equal(t, uint64(0x1029), branch.Values[0].Links[0].TargetAddress)
+	require.Len(t, branch.Values[1].Links, 1)
+	assert.Equal(t, uint64(0x2000), branch.Values[1].Links[0].TargetAddress)
+
+	signed := relocs.Content[1]
+	assert.Equal(t, "X86_64_RELOC_SIGNED __TEXT,__cstring (+0xb)", signed.Name)
+	assert.Equal(t, uintptr(0x108), signed.Address)
+	require.Len(t, signed.Values[1].Links, 1)
+	assert.Equal(t, uint64(0x3000), signed.Values[1].Links[0].TargetAddress)
+}
+
+func Test_ParseRelocations_scattered(t *testing.T) {
+	data := make([]byte, 16)
+	binary.BigEndian.PutUint32(data[0:], 0xa400000e) // PPC_RELOC_HI16
+	binary.BigEndian.PutUint32(data[4:], 0x2d)
+	binary.BigEndian.PutUint32(data[8:], 0xa1000000) // PPC_RELOC_PAIR
+	binary.BigEndian.PutUint32(data[12:], 0xb)
+	relocs, err := machoutils.ParseRelocations(data, 0, machoutils.RelocationOptions{
+		CPU:       machoutils.CPU_TYPE_POWERPC,
+		ByteOrder: binary.BigEndian,
+		Resolve: func(vmAddr uint64) (uintptr, bool) {
+			return uintptr(vmAddr), true
+		},
+	})
+	require.NoError(t, err)
+	require.Len(t, relocs.Content, 2)
+
+	hi := relocs.Content[0]
+	assert.Equal(t, "PPC_RELOC_HI16 (+0xe)", hi.Name)
+	require.Len(t, hi.Values[0].Links, 1)
+	assert.Equal(t, uint64(0xe), hi.Values[0].Links[0].TargetAddress)
+	require.Len(t, hi.Values[5].Links, 1)
+	assert.Equal(t, uint64(0x2d), hi.Values[5].Links[0].TargetAddress)
+
+	pair := relocs.Content[1]
+	assert.Equal(t, "PPC_RELOC_PAIR", pair.Name)
+	assert.Len(t, pair.Values[0].Links, 0)
+}
+
+func Test_ParseRelocations_invalidSize(t *testing.T) {
+	_, err := machoutils.ParseRelocations(make([]byte, 12), 0, machoutils.RelocationOptions{})
+	assert.Error(t, err)
+}
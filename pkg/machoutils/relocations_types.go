@@ -0,0 +1,162 @@
+package machoutils
+
+import "fmt"
+
+// From Apple's mach/machine.h and mach-o/reloc.h (plus the per-architecture reloc.h)
+
+const (
+	CPU_ARCH_ABI64    = 0x01000000
+	CPU_ARCH_ABI64_32 = 0x02000000
+
+	CPU_TYPE_X86       = 7
+	CPU_TYPE_X86_64    = CPU_TYPE_X86 | CPU_ARCH_ABI64
+	CPU_TYPE_ARM       = 12
+	CPU_TYPE_ARM64     = CPU_TYPE_ARM | CPU_ARCH_ABI64
+	CPU_TYPE_ARM64_32  = CPU_TYPE_ARM | CPU_ARCH_ABI64_32
+	CPU_TYPE_POWERPC   = 18
+	CPU_TYPE_POWERPC64 = CPU_TYPE_POWERPC | CPU_ARCH_ABI64
+)
+
+const (
+	R_ABS       = 0          // absolute relocation type for Mach-O files
+	R_SCATTERED = 0x80000000 // mask to be applied to the r_address field of a relocation_info structure
+)
+
+const RelocationInfoSize = 8
+
+var genericRelocationNames = []string{
+	"GENERIC_RELOC_VANILLA",
+	"GENERIC_RELOC_PAIR",
+	"GENERIC_RELOC_SECTDIFF",
+	"GENERIC_RELOC_PB_LA_PTR",
+	"GENERIC_RELOC_LOCAL_SECTDIFF",
+	"GENERIC_RELOC_TLV",
+}
+
+var x86_64RelocationNames = []string{
+	"X86_64_RELOC_UNSIGNED",
+	"X86_64_RELOC_SIGNED",
+	"X86_64_RELOC_BRANCH",
+	"X86_64_RELOC_GOT_LOAD",
+	"X86_64_RELOC_GOT",
+	"X86_64_RELOC_SUBTRACTOR",
+	"X86_64_RELOC_SIGNED_1",
+	"X86_64_RELOC_SIGNED_2",
+	"X86_64_RELOC_SIGNED_4",
+	"X86_64_RELOC_TLV",
+}
+
+var armRelocationNames = []string{
+	"ARM_RELOC_VANILLA",
+	"ARM_RELOC_PAIR",
+	"ARM_RELOC_SECTDIFF",
+	"ARM_RELOC_LOCAL_SECTDIFF",
+	"ARM_RELOC_PB_LA_PTR",
+	"ARM_RELOC_BR24",
+	"ARM_THUMB_RELOC_BR22",
+	"ARM_THUMB_32BIT_BRANCH",
+	"ARM_RELOC_HALF",
+	"ARM_RELOC_HALF_SECTDIFF",
+}
+
+var arm64RelocationNames = []string{
+	"ARM64_RELOC_UNSIGNED",
+	"ARM64_RELOC_SUBTRACTOR",
+	"ARM64_RELOC_BRANCH26",
+	"ARM64_RELOC_PAGE21",
+	"ARM64_RELOC_PAGEOFF12",
+	"ARM64_RELOC_GOT_LOAD_PAGE21",
+	"ARM64_RELOC_GOT_LOAD_PAGEOFF12",
+	"ARM64_RELOC_POINTER_TO_GOT",
+	"ARM64_RELOC_TLVP_LOAD_PAGE21",
+	"ARM64_RELOC_TLVP_LOAD_PAGEOFF12",
+	"ARM64_RELOC_ADDEND",
+	"ARM64_RELOC_AUTHENTICATED_POINTER",
+}
+
+var ppcRelocationNames = []string{
+	"PPC_RELOC_VANILLA",
+	"PPC_RELOC_PAIR",
+	"PPC_RELOC_BR14",
+	"PPC_RELOC_BR24",
+	"PPC_RELOC_HI16",
+	"PPC_RELOC_LO16",
+	"PPC_RELOC_HA16",
+	"PPC_RELOC_LO14",
+	"PPC_RELOC_SECTDIFF",
+	"PPC_RELOC_PB_LA_PTR",
+	"PPC_RELOC_HI16_SECTDIFF",
+	"PPC_RELOC_LO16_SECTDIFF",
+	"PPC_RELOC_HA16_SECTDIFF",
+	"PPC_RELOC_JBSR",
+	"PPC_RELOC_LO14_SECTDIFF",
+	"PPC_RELOC_LOCAL_SECTDIFF",
+}
+
+func RelocationTypeName(cpu uint32, typ uint8) string {
+	var names []string
+	switch cpu {
+	case CPU_TYPE_X86:
+		names = genericRelocationNames
+	case CPU_TYPE_X86_64:
+		names = x86_64RelocationNames
+	case CPU_TYPE_ARM:
+		names = armRelocationNames
+	case CPU_TYPE_ARM64, CPU_TYPE_ARM64_32:
+		names = arm64RelocationNames
+	case CPU_TYPE_POWERPC, CPU_TYPE_POWERPC64:
+		names = ppcRelocationNames
+	}
+	if int(typ) < len(names) {
+		return names[typ]
+	}
+	return fmt.Sprintf("Unknown %d", typ)
+}
+
+// A decoded relocation_info or scattered_relocation_info
+type Relocation struct {
+	Scattered bool
+	Address   uint32 // offset in the section (or from the relocation base for dynamic relocations)
+	PCRel     bool
+	Length    uint8 // 0=byte, 1=word, 2=long, 3=quad
+	Type      uint8
+	// Non-scattered only
+	Extern    bool
+	SymbolNum uint32 // symbol index if Extern, section ordinal otherwise (R_ABS if absolute)
+	// Scattered only
+	Value uint32 // address of the relocatable expression
+}
+
+// Decodes a relocation from its two words, already read with the file's byte order
+func DecodeRelocation(address, info uint32, bigEndian bool) Relocation {
+	if address&R_SCATTERED != 0 {
+		// The layout of scattered relocations is defined in terms of the whole word, so it doesn't depend on endianness
+		return Relocation{
+			Scattered: true,
+			PCRel:     (address>>30)&0x1 == 1,
+			Length:    uint8((address >> 28) & 0x3),
+			Type:      uint8((address >> 24) & 0xf),
+			Address:   address & 0x00ffffff,
+			Value:     info,
+		}
+	}
+	// Bitfields are allocated from the other end of the word in big-endian files
+	if bigEndian {
+		return Relocation{
+			Address:   address,
+			SymbolNum: info >> 8,
+			PCRel:     (info>>7)&0x1 == 1,
+			Length:    uint8((info >> 5) & 0x3),
+			Extern:    (info>>4)&0x1 == 1,
+			Type:      uint8(info & 0xf),
+		}
+	}
+	return Relocation{
+		Address:   address,
+		SymbolNum: info & 0x00ffffff,
+		PCRel:     (info>>24)&0x1 == 1,
+		Length:    uint8((info >> 25) & 0x3),
+		Extern:    (info>>27)&0x1 == 1,
+		Type:      uint8(info >> 28),
+	}
+}
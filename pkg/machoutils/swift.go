@@ -0,0 +1,156 @@
+package machoutils
+
+import (
+	"fmt"
+)
+
+// From Swift's ABI (include/swift/ABI/Metadata.h and include/swift/RemoteInspection/Records.h), everything is relative
+
+const (
+	SwiftKindClass  = 16
+	SwiftKindStruct = 17
+	SwiftKindEnum   = 18
+	SwiftKindMask   = 0x1f
+	// Used in relative pointers which can go through a GOT-like slot
+	SwiftIndirectMask = 0x1
+	// Used by __swift5_types entries, the other bits are the kind of reference
+	SwiftTypeReferenceKindMask = 0x3
+	// Kind of TypeRef in conformance descriptors, stored in their flags
+	SwiftConformanceTypeRefShift         = 3
+	SwiftConformanceTypeRefMask          = 0x7
+	SwiftConformanceDirectTypeDescriptor = 0
+	SwiftConformanceDirectObjCClassName  = 2
+)
+
+var SwiftContextDescriptorFields = []MetadataField{
+	{"Flags", MetadataUint32},
+	{"Parent", MetadataRelative},
+}
+
+// Only for classes, structs and enums
+var SwiftTypeDescriptorFields = append(SwiftContextDescriptorFields, []MetadataField{
+	{"Name", MetadataRelative},
+	{"AccessFunction", MetadataRelative},
+	{"Fields", MetadataRelative},
+}...)
+
+var SwiftConformanceDescriptorFields = []MetadataField{
+	{"Protocol", MetadataRelative},
+	{"TypeRef", MetadataRelative},
+	{"WitnessTablePattern", MetadataRelative},
+	{"Flags", MetadataUint32},
+}
+
+var SwiftFieldDescriptorFields = []MetadataField{
+	{"MangledTypeName", MetadataRelative},
+	{"Superclass", MetadataRelative},
+	{"Kind", MetadataUint16},
+	{"FieldRecordSize", MetadataUint16},
+	{"NumFields", MetadataUint32},
+}
+
+var SwiftFieldRecordFields = []MetadataField{
+	{"Flags", MetadataUint32},
+	{"MangledTypeName", MetadataRelative},
+	{"FieldName", MetadataRelative},
+}
+
+func SwiftKindName(kind uint64) string {
+	switch kind {
+	case SwiftKindClass:
+		return "Class"
+	case SwiftKindStruct:
+		return "Struct"
+	case SwiftKindEnum:
+		return "Enum"
+	}
+	return fmt.Sprintf("Context %d", kind)
+}
+
+// Walks a list of relative offsets to structures (e.g. __swift5_types) of size bytes at vmAddr, decode returns the name
+// of the structure a slot points to. Slots whose structure can't be decoded are kept and the failure is returned as a
+// warning, as the rest of the list can still be shown
+func ParseSwiftRelativeList(image MetadataImage, vmAddr, size uint64, label string, decode func(vmAddr uint64) (string, error)) ([]*MetadataStruct, []error) {
+	slots := []*MetadataStruct{}
+	warnings := []error{}
+	for i := range size / 4 {
+		slot, err := ReadMetadataStruct(image, label, vmAddr+i*4, []MetadataField{{label, MetadataRelative}})
+		if err != nil {
+			warnings = append(warnings, err)
+			continue
+		}
+		target := slot.Values[label] &^ SwiftTypeReferenceKindMask
+		name := "indirect"
+		if target != 0 && slot.Values[label]&SwiftTypeReferenceKindMask == 0 {
+			name, err = decode(target)
+			if err != nil {
+				warnings = append(warnings, fmt.Errorf("failed to decode %s at %#x: %w", label, target, err))
+				name = "unresolved"
+			}
+		}
+		err = LinkToVMAddr(image, slot.Block, label, "points to", target)
+		if err != nil {
+			warnings = append(warnings, err)
+		}
+		slot.Block.Name = fmt.Sprintf("%s Reference (%s)", label, name)
+		slots = append(slots, slot)
+	}
+	return slots, warnings
+}
+
+// Walks the field descriptors of __swift5_fieldmd (size bytes at vmAddr), which are laid out back to back, each followed
+// by its records. Records are returned right after their descriptor and the walk stops at the first descriptor which
+// can't be read (as the next one can't be found), everything else is returned as a warning
+func ParseSwiftFieldDescriptors(image MetadataImage, vmAddr, size uint64) ([]*MetadataStruct, []error) {
+	structs := []*MetadataStruct{}
+	warnings := []error{}
+	descriptorSize := MetadataStructSize(image, SwiftFieldDescriptorFields)
+	for offset := uint64(0); offset+descriptorSize <= size; {
+		descriptorAddr := vmAddr + offset
+		descriptor, err := ReadMetadataStruct(image, "Field Descriptor", descriptorAddr, SwiftFieldDescriptorFields)
+		if err != nil {
+			return structs, append(warnings, err)
+		}
+		recordSize := descriptor.Values["FieldRecordSize"]
+		count := descriptor.Values["NumFields"]
+		if recordSize < MetadataStructSize(image, SwiftFieldRecordFields) && count > 0 {
+			return structs, append(warnings, fmt.Errorf("invalid field record size %d at %#x", recordSize, descriptorAddr))
+		}
+		descriptor.Block.Name = fmt.Sprintf("Field Descriptor (%d)", count)
+		descriptor.Block.Size += count * recordSize
+		if offset+descriptor.Block.Size > size {
+			return structs, append(warnings, fmt.Errorf("field descriptor at %#x overflows its section", descriptorAddr))
+		}
+		for _, link := range []struct{ field, label string }{
+			{"MangledTypeName", "describes"},
+			{"Superclass", "inherits from"},
+		} {
+			err = descriptor.Link(image, link.field, link.label)
+			if err != nil {
+				warnings = append(warnings, err)
+			}
+		}
+		structs = append(structs, descriptor)
+
+		for i := range count {
+			record, err := ReadMetadataStruct(image, "Field", descriptorAddr+descriptorSize+i*recordSize, SwiftFieldRecordFields)
+			if err != nil {
+				warnings = append(warnings, err)
+				continue
+			}
+			record.Block.Name = fmt.Sprintf("Field %s", ReadCStringAt(image, record.Values["FieldName"]))
+			for _, link := range []struct{ field, label string }{
+				{"FieldName", "is named"},
+				{"MangledTypeName", "has type"},
+			} {
+				err = record.Link(image, link.field, link.label)
+				if err != nil {
+					warnings = append(warnings, err)
+				}
+			}
+			structs = append(structs, record)
+		}
+		offset += descriptor.Block.Size
+	}
+	return structs, warnings
+}
@@ -0,0 +1,113 @@
+package machoutils_test
+
+import (
+	"encoding/binary"
+	"fmt"
+	"testing"
+
+	"github.com/LouisBrunner/mem-viz/pkg/machoutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Relative offsets are from the field itself
+func putRelative(data []byte, from, to uint64) {
+	binary.LittleEndian.PutUint32(data[from-metadataBase:], uint32(int32(to-from)))
+}
+
+func Test_ParseSwiftRelativeList(t *testing.T) {
+	data := make([]byte, 0x40)
+	putRelative(data, 0x1000, 0x1020)
+	putRelative(data, 0x1004, 0x1021) // indirect
+	putRelative(data, 0x1008, 0x3000) // not in the file
+	image := metadataImage(data, nil)
+
+	decoded := []uint64{}
+	slots, warnings := machoutils.ParseSwiftRelativeList(image, 0x1000, 12, "Type", func(vmAddr uint64) (string, error) {
+		decoded = append(decoded, vmAddr)
+		if vmAddr != 0x1020 {
+			return "", fmt.Errorf("not backed by the file")
+		}
+		return "Foo", nil
+	})
+	assert.Equal(t, []uint64{0x1020, 0x3000}, decoded)
+	require.Len(t, warnings, 1)
+	assert.ErrorContains(t, warnings[0], "failed to decode Type at 0x3000")
+
+	require.Len(t, slots, 3)
+	assert.Equal(t, []string{"Type Reference (Foo)", "Type Reference (indirect)", "Type Reference (unresolved)"}, []string{slots[0].Block.Name, slots[1].Block.Name, slots[2].Block.Name})
+	assert.Equal(t, uintptr(4), slots[1].Block.Address)
+	assert.Equal(t, uint64(4), slots[1].Block.Size)
+	require.Len(t, slots[0].Block.Values, 1)
+	require.Len(t, slots[0].Block.Values[0].Links, 1)
+	assert.Equal(t, uint64(0x20), slots[0].Block.Values[0].Links[0].TargetAddress)
+	assert.Empty(t, slots[2].Block.Values[0].Links)
+
+	// Slots outside of the file are skipped
+	slots, warnings = machoutils.ParseSwiftRelativeList(image, 0x1038, 12, "Type", nil)
+	assert.Len(t, slots, 2)
+	assert.Len(t, warnings, 1)
+}
+
+func fieldDescriptors() []byte {
+	le := binary.LittleEndian
+	data := make([]byte, 0x100)
+	// Foo { x: Int, y: Int }
+	putRelative(data, 0x1040, 0x1080)
+	le.PutUint16(data[0x4a:], 12)
+	le.PutUint32(data[0x4c:], 2)
+	putRelative(data, 0x1054, 0x1085)
+	putRelative(data, 0x1058, 0x1088)
+	putRelative(data, 0x1060, 0x1085)
+	putRelative(data, 0x1064, 0x108a)
+	// An empty one right after
+	putRelative(data, 0x1068, 0x1080)
+	copy(data[0x80:], "3Foo\x00Si\x00x\x00y\x00")
+	return data
+}
+
+func Test_ParseSwiftFieldDescriptors(t *testing.T) {
+	image := metadataImage(fieldDescriptors(), nil)
+	structs, warnings := machoutils.ParseSwiftFieldDescriptors(image, 0x1040, 0x38)
+	assert.Empty(t, warnings)
+
+	names := []string{}
+	for _, s := range structs {
+		names = append(names, s.Block.Name)
+	}
+	assert.Equal(t, []string{"Field Descriptor (2)", "Field x", "Field y", "Field Descriptor (0)"}, names)
+	descriptor := structs[0]
+	assert.Equal(t, uintptr(0x40), descriptor.Block.Address)
+	assert.Equal(t, uint64(16+2*12), descriptor.Block.Size)
+	assert.Equal(t, uint64(0x1080), descriptor.Values["MangledTypeName"])
+	y := structs[2]
+	assert.Equal(t, uintptr(0x5c), y.Block.Address)
+	assert.Equal(t, uint64(0x1085), y.Values["MangledTypeName"])
+	assert.Equal(t, uintptr(0x68), structs[3].Block.Address)
+}
+
+func Test_ParseSwiftFieldDescriptors_invalid(t *testing.T) {
+	le := binary.LittleEndian
+	cases := map[string]struct {
+		data   func() []byte
+		size   uint64
+		parsed int
+	}{
+		"record size": {data: func() []byte {
+			data := fieldDescriptors()
+			le.PutUint16(data[0x4a:], 4)
+			return data
+		}, size: 0x38},
+		"overflow": {data: fieldDescriptors, size: 0x20},
+		"truncated": {data: func() []byte {
+			return fieldDescriptors()[:0x70]
+		}, size: 0x38, parsed: 3},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			structs, warnings := machoutils.ParseSwiftFieldDescriptors(metadataImage(c.data(), nil), 0x1040, c.size)
+			assert.Len(t, structs, c.parsed)
+			assert.Len(t, warnings, 1)
+		})
+	}
+}
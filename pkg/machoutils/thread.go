@@ -0,0 +1,116 @@
+package machoutils
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/LouisBrunner/mem-viz/pkg/contracts"
+	"github.com/LouisBrunner/mem-viz/pkg/parsingutils"
+)
+
+type ThreadStateOptions struct {
+	// CPU type of the image, flavors mean different things on each architecture
+	CPU       uint32
+	ByteOrder parsingutils.ByteOrder
+	Resolve   parsingutils.Resolver
+}
+
+type threadStateParser struct {
+	options ThreadStateOptions
+	order   binary.ByteOrder
+	flavors map[uint32]threadFlavor
+	data    []byte
+}
+
+// Parses the states following a thread_command (LC_THREAD or LC_UNIXTHREAD), data must contain exactly the states.
+// Each flavor gets its own block with its registers as values, the program counter links to where execution starts
+func ParseThreadState(data []byte, address uintptr, options ThreadStateOptions) (*contracts.MemoryBlock, error) {
+	p := threadStateParser{
+		options: options,
+		order:   parsingutils.OrLittleEndian(options.ByteOrder),
+		flavors: threadFlavors(options.CPU),
+		data:    data,
+	}
+	root := newBlock("", address, uint64(len(data)))
+	for offset := uint64(0); offset < uint64(len(data)); {
+		size, err := p.parseState(root, offset)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse thread state at %#x: %w", offset, err)
+		}
+		offset += size
+	}
+	root.Name = fmt.Sprintf("Thread States (%d)", len(root.Content))
+	return root, nil
+}
+
+func (me *threadStateParser) flavor(id uint32) threadFlavor {
+	if found, ok := me.flavors[id]; ok {
+		return found
+	}
+	return threadFlavor{name: fmt.Sprintf("Unknown %d", id)}
+}
+
+// Parses one flavor/count header and its state, returns the size of both
+func (me *threadStateParser) parseState(root *contracts.MemoryBlock, offset uint64) (uint64, error) {
+	header, err := subSlice(me.data, offset, 8)
+	if err != nil {
+		return 0, err
+	}
+	flavorID := me.order.Uint32(header)
+	count := me.order.Uint32(header[4:])
+	size := 8 + uint64(count)*4
+	_, err = subSlice(me.data, offset, size)
+	if err != nil {
+		return 0, err
+	}
+
+	flavor := me.flavor(flavorID)
+	block := addChild(root, fmt.Sprintf("Thread State (%s)", flavor.name), offset, size)
+	addValue(block, "Flavor", flavor.name, 0, 4)
+	addValue(block, "Count", count, 4, 4)
+
+	stateOffset := uint64(8)
+	if flavor.wrapper && count >= 2 {
+		flavor = me.flavor(me.order.Uint32(me.data[offset+8:]))
+		block.Name = fmt.Sprintf("%s: %s", block.Name, flavor.name)
+		addValue(block, "StateFlavor", flavor.name, 8, 4)
+		addValue(block, "StateCount", me.order.Uint32(me.data[offset+12:]), 12, 4)
+		stateOffset += 8
+	}
+	return size, me.addRegisters(block, flavor, offset, stateOffset, size)
+}
+
+func (me *threadStateParser) addRegisters(block *contracts.MemoryBlock, flavor threadFlavor, offset, stateOffset, size uint64) error {
+	for _, reg := range flavor.registers {
+		if stateOffset+uint64(reg.size) > size {
+			break
+		}
+		raw := me.data[offset+stateOffset:]
+		var value uint64
+		switch reg.size {
+		case 2:
+			value = uint64(me.order.Uint16(raw))
+			addValue(block, reg.name, uint16(value), stateOffset, reg.size)
+		case 4:
+			value = uint64(me.order.Uint32(raw))
+			addValue(block, reg.name, uint32(value), stateOffset, reg.size)
+		default:
+			value = me.order.Uint64(raw)
+			addValue(block, reg.name, value, stateOffset, reg.size)
+		}
+		stateOffset += uint64(reg.size)
+
+		if reg.name != flavor.pc || me.options.Resolve == nil {
+			continue
+		}
+		target, mapped := me.options.Resolve(value)
+		if !mapped {
+			continue
+		}
+		err := parsingutils.AddLinkWithAddr(block, reg.name, "starts at", target)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package machoutils_test
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/LouisBrunner/mem-viz/pkg/machoutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func threadState(order binary.ByteOrder, words ...uint32) []byte {
+	data := make([]byte, len(words)*4)
+	for i, word := range words {
+		order.PutUint32(data[i*4:], word)
+	}
+	return data
+}
+
+func Test_ParseThreadState(t *testing.T) {
+	// x86_THREAD_STATE64 with rip = 0x100000f14
+	words := make([]uint32, 2+42)
+	words[0] = 4
+	words[1] = 42
+	words[2+16*2] = 0x00000f14
+	words[2+16*2+1] = 0x1
+	states, err := machoutils.ParseThreadState(threadState(binary.LittleEndian, words...), 0x460, machoutils.ThreadStateOptions{
+		CPU: machoutils.CPU_TYPE_X86_64,
+		Resolve: func(vmAddr uint64) (uintptr, bool) {
+			return uintptr(vmAddr - 0x100000000), true
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "Thread States (1)", states.Name)
+	require.Len(t, states.Content, 1)
+
+	state := states.Content[0]
+	assert.Equal(t, "Thread State (x86_THREAD_STATE64)", state.Name)
+	assert.Equal(t, uintptr(0x460), state.Address)
+	assert.Equal(t, uint64(176), state.Size)
+	require.Len(t, state.Values, 2+21)
+	rip := state.Values[2+16]
+	assert.Equal(t, "rip", rip.Name)
+	assert.Equal(t, "0x100000f14", rip.Value)
+	assert.Equal(t, uint64(8+16*8), rip.Offset)
+	require.Len(t, rip.Links, 1)
+	assert.Equal(t, uint64(0xf14), rip.Links[0].TargetAddress)
+}
+
+func Test_ParseThreadState_wrapped(t *testing.T) {
+	// x86_THREAD_STATE wrapping a x86_THREAD_STATE32 with eip = 0x1f68
+	words := make([]uint32, 4+16)
+	words[0] = 7
+	words[1] = 18
+	words[2] = 1
+	words[3] = 16
+	words[4+10] = 0x1f68
+	states, err := machoutils.ParseThreadState(threadState(binary.LittleEndian, words...), 0, machoutils.ThreadStateOptions{
+		CPU: machoutils.CPU_TYPE_X86,
+	})
+	require.NoError(t, err)
+	require.Len(t, states.Content, 1)
+
+	state := states.Content[0]
+	assert.Equal(t, "Thread State (x86_THREAD_STATE): x86_THREAD_STATE32", state.Name)
+	require.Len(t, state.Values, 4+16)
+	eip := state.Values[4+10]
+	assert.Equal(t, "eip", eip.Name)
+	assert.Equal(t, "0x1f68", eip.Value)
+	assert.Equal(t, uint64(16+10*4), eip.Offset)
+	assert.Len(t, eip.Links, 0)
+}
+
+func Test_ParseThreadState_bigEndian(t *testing.T) {
+	// PPC_THREAD_STATE with srr0 = 0x1f00, followed by an unknown flavor
+	words := make([]uint32, 2+40)
+	words[0] = 1
+	words[1] = 40
+	words[2] = 0x1f00
+	words = append(words, 42, 1, 0)
+	states, err := machoutils.ParseThreadState(threadState(binary.BigEndian, words...), 0, machoutils.ThreadStateOptions{
+		CPU:       machoutils.CPU_TYPE_POWERPC,
+		ByteOrder: binary.BigEndian,
+		Resolve: func(vmAddr uint64) (uintptr, bool) {
+			return uintptr(vmAddr), vmAddr != 0
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "Thread States (2)", states.Name)
+	require.Len(t, states.Content, 2)
+
+	state := states.Content[0]
+	assert.Equal(t, "Thread State (PPC_THREAD_STATE)", state.Name)
+	srr0 := state.Values[2]
+	assert.Equal(t, "srr0", srr0.Name)
+	assert.Equal(t, "0x1f00", srr0.Value)
+	require.Len(t, srr0.Links, 1)
+	assert.Equal(t, uint64(0x1f00), srr0.Links[0].TargetAddress)
+
+	unknown := states.Content[1]
+	assert.Equal(t, "Thread State (Unknown 42)", unknown.Name)
+	assert.Equal(t, uintptr(168), unknown.Address)
+	assert.Equal(t, uint64(12), unknown.Size)
+}
+
+func Test_ParseThreadState_truncated(t *testing.T) {
+	_, err := machoutils.ParseThreadState(threadState(binary.LittleEndian, 4, 42, 0), 0, machoutils.ThreadStateOptions{
+		CPU: machoutils.CPU_TYPE_X86_64,
+	})
+	assert.Error(t, err)
+}
@@ -0,0 +1,176 @@
+package machoutils
+
+import "fmt"
+
+// From Apple's mach/i386/thread_status.h, mach/arm/thread_status.h and mach/ppc/thread_status.h
+
+const (
+	x86_THREAD_STATE32    = 1
+	x86_FLOAT_STATE32     = 2
+	x86_EXCEPTION_STATE32 = 3
+	x86_THREAD_STATE64    = 4
+	x86_FLOAT_STATE64     = 5
+	x86_EXCEPTION_STATE64 = 6
+	x86_THREAD_STATE      = 7
+	x86_FLOAT_STATE       = 8
+	x86_EXCEPTION_STATE   = 9
+	x86_DEBUG_STATE32     = 10
+	x86_DEBUG_STATE64     = 11
+	x86_DEBUG_STATE       = 12
+)
+
+const (
+	ARM_THREAD_STATE         = 1
+	ARM_VFP_STATE            = 2
+	ARM_EXCEPTION_STATE      = 3
+	ARM_DEBUG_STATE          = 4
+	ARM_THREAD_STATE64       = 6
+	ARM_EXCEPTION_STATE64    = 7
+	ARM_THREAD_STATE32       = 9
+	ARM_DEBUG_STATE32        = 14
+	ARM_DEBUG_STATE64        = 15
+	ARM_NEON_STATE           = 16
+	ARM_NEON_STATE64         = 17
+	ARM_UNIFIED_THREAD_STATE = ARM_THREAD_STATE // on arm64, wraps either ARM_THREAD_STATE32 or ARM_THREAD_STATE64
+)
+
+const (
+	PPC_THREAD_STATE      = 1
+	PPC_FLOAT_STATE       = 2
+	PPC_EXCEPTION_STATE   = 3
+	PPC_VECTOR_STATE      = 4
+	PPC_THREAD_STATE64    = 5
+	PPC_EXCEPTION_STATE64 = 6
+)
+
+type threadRegister struct {
+	name string
+	size uint8
+}
+
+type threadFlavor struct {
+	name string
+	// Registers in order, nil means the state is only shown as a whole
+	registers []threadRegister
+	// Register holding the address where execution starts
+	pc string
+	// The state starts with its own flavor and count (e.g. x86_THREAD_STATE)
+	wrapper bool
+}
+
+func registers(size uint8, names ...string) []threadRegister {
+	regs := make([]threadRegister, 0, len(names))
+	for _, name := range names {
+		regs = append(regs, threadRegister{name: name, size: size})
+	}
+	return regs
+}
+
+func numberedRegisters(size uint8, prefix string, count int) []threadRegister {
+	names := make([]string, 0, count)
+	for i := 0; i < count; i += 1 {
+		names = append(names, fmt.Sprintf("%s%d", prefix, i))
+	}
+	return registers(size, names...)
+}
+
+func concatRegisters(groups ...[]threadRegister) []threadRegister {
+	regs := []threadRegister{}
+	for _, group := range groups {
+		regs = append(regs, group...)
+	}
+	return regs
+}
+
+var x86ThreadFlavors = map[uint32]threadFlavor{
+	x86_THREAD_STATE32: {
+		name:      "x86_THREAD_STATE32",
+		registers: registers(4, "eax", "ebx", "ecx", "edx", "edi", "esi", "ebp", "esp", "ss", "eflags", "eip", "cs", "ds", "es", "fs", "gs"),
+		pc:        "eip",
+	},
+	x86_FLOAT_STATE32: {name: "x86_FLOAT_STATE32"},
+	x86_EXCEPTION_STATE32: {
+		name:      "x86_EXCEPTION_STATE32",
+		registers: concatRegisters(registers(2, "trapno", "cpu"), registers(4, "err", "faultvaddr")),
+	},
+	x86_THREAD_STATE64: {
+		name: "x86_THREAD_STATE64",
+		registers: concatRegisters(
+			registers(8, "rax", "rbx", "rcx", "rdx", "rdi", "rsi", "rbp", "rsp"),
+			numberedRegisters(8, "r", 16)[8:],
+			registers(8, "rip", "rflags", "cs", "fs", "gs"),
+		),
+		pc: "rip",
+	},
+	x86_FLOAT_STATE64: {name: "x86_FLOAT_STATE64"},
+	x86_EXCEPTION_STATE64: {
+		name:      "x86_EXCEPTION_STATE64",
+		registers: concatRegisters(registers(2, "trapno", "cpu"), registers(4, "err"), registers(8, "faultvaddr")),
+	},
+	x86_THREAD_STATE:    {name: "x86_THREAD_STATE", wrapper: true},
+	x86_FLOAT_STATE:     {name: "x86_FLOAT_STATE", wrapper: true},
+	x86_EXCEPTION_STATE: {name: "x86_EXCEPTION_STATE", wrapper: true},
+	x86_DEBUG_STATE32:   {name: "x86_DEBUG_STATE32", registers: numberedRegisters(4, "dr", 8)},
+	x86_DEBUG_STATE64:   {name: "x86_DEBUG_STATE64", registers: numberedRegisters(8, "dr", 8)},
+	x86_DEBUG_STATE:     {name: "x86_DEBUG_STATE", wrapper: true},
+}
+
+var armThreadState32 = concatRegisters(numberedRegisters(4, "r", 13), registers(4, "sp", "lr", "pc", "cpsr"))
+
+var armThreadFlavors = map[uint32]threadFlavor{
+	ARM_THREAD_STATE:    {name: "ARM_THREAD_STATE", registers: armThreadState32, pc: "pc"},
+	ARM_VFP_STATE:       {name: "ARM_VFP_STATE"},
+	ARM_EXCEPTION_STATE: {name: "ARM_EXCEPTION_STATE", registers: registers(4, "exception", "fsr", "far")},
+	ARM_DEBUG_STATE:     {name: "ARM_DEBUG_STATE"},
+	ARM_THREAD_STATE32:  {name: "ARM_THREAD_STATE32", registers: armThreadState32, pc: "pc"},
+	ARM_DEBUG_STATE32:   {name: "ARM_DEBUG_STATE32"},
+	ARM_NEON_STATE:      {name: "ARM_NEON_STATE"},
+}
+
+var arm64ThreadFlavors = map[uint32]threadFlavor{
+	ARM_UNIFIED_THREAD_STATE: {name: "ARM_UNIFIED_THREAD_STATE", wrapper: true},
+	ARM_THREAD_STATE64: {
+		name:      "ARM_THREAD_STATE64",
+		registers: concatRegisters(numberedRegisters(8, "x", 29), registers(8, "fp", "lr", "sp", "pc"), registers(4, "cpsr", "pad")),
+		pc:        "pc",
+	},
+	ARM_EXCEPTION_STATE64: {
+		name:      "ARM_EXCEPTION_STATE64",
+		registers: concatRegisters(registers(8, "far"), registers(4, "esr", "exception")),
+	},
+	ARM_THREAD_STATE32: {name: "ARM_THREAD_STATE32", registers: armThreadState32, pc: "pc"},
+	ARM_DEBUG_STATE64:  {name: "ARM_DEBUG_STATE64"},
+	ARM_NEON_STATE64:   {name: "ARM_NEON_STATE64"},
+}
+
+var ppcThreadFlavors = map[uint32]threadFlavor{
+	PPC_THREAD_STATE: {
+		name:      "PPC_THREAD_STATE",
+		registers: concatRegisters(registers(4, "srr0", "srr1"), numberedRegisters(4, "r", 32), registers(4, "cr", "xer", "lr", "ctr", "mq", "vrsave")),
+		pc:        "srr0",
+	},
+	PPC_FLOAT_STATE:     {name: "PPC_FLOAT_STATE"},
+	PPC_EXCEPTION_STATE: {name: "PPC_EXCEPTION_STATE", registers: concatRegisters(registers(4, "dar", "dsisr", "exception"), numberedRegisters(4, "pad", 5))},
+	PPC_VECTOR_STATE:    {name: "PPC_VECTOR_STATE"},
+	// Packed on 4 bytes, so cr misaligns the registers after it
+	PPC_THREAD_STATE64: {
+		name:      "PPC_THREAD_STATE64",
+		registers: concatRegisters(registers(8, "srr0", "srr1"), numberedRegisters(8, "r", 32), registers(4, "cr"), registers(8, "xer", "lr", "ctr"), registers(4, "vrsave")),
+		pc:        "srr0",
+	},
+	PPC_EXCEPTION_STATE64: {name: "PPC_EXCEPTION_STATE64", registers: concatRegisters(registers(8, "dar"), registers(4, "dsisr", "exception"), numberedRegisters(4, "pad", 4))},
+}
+
+func threadFlavors(cpu uint32) map[uint32]threadFlavor {
+	switch cpu {
+	case CPU_TYPE_X86, CPU_TYPE_X86_64:
+		return x86ThreadFlavors
+	case CPU_TYPE_ARM:
+		return armThreadFlavors
+	case CPU_TYPE_ARM64, CPU_TYPE_ARM64_32:
+		return arm64ThreadFlavors
+	case CPU_TYPE_POWERPC, CPU_TYPE_POWERPC64:
+		return ppcThreadFlavors
+	}
+	return nil
+}
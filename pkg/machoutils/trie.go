@@ -0,0 +1,107 @@
+package machoutils
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Tries are used by dyld for exports and by the shared cache to map paths to indexes,
+// each node has an optional terminal payload followed by edges to its children
+
+type TrieEdge struct {
+	Label string
+	// Offset of the edge inside its node
+	Offset uint64
+	Size   uint64
+	// Offset of the child node inside the trie
+	Child uint64
+}
+
+type TrieNode struct {
+	Offset uint64
+	Size   uint64
+	// Concatenation of all the edge labels leading to this node
+	Prefix string
+	// Offset and size of the terminal payload inside the trie, TerminalSize is 0 if the node isn't terminal
+	TerminalOffset uint64
+	TerminalSize   uint64
+	Edges          []TrieEdge
+}
+
+func (me TrieNode) Terminal() bool {
+	return me.TerminalSize > 0
+}
+
+// Walks the whole trie and returns every node sorted by offset
+func ParseTrie(data []byte) ([]TrieNode, error) {
+	nodes := []TrieNode{}
+	seen := map[uint64]struct{}{}
+	type pending struct {
+		offset uint64
+		prefix string
+	}
+	queue := []pending{{offset: 0}}
+	for len(queue) > 0 {
+		current := queue[len(queue)-1]
+		queue = queue[:len(queue)-1]
+		if _, found := seen[current.offset]; found {
+			return nil, fmt.Errorf("loop in trie at %#x", current.offset)
+		}
+		seen[current.offset] = struct{}{}
+
+		node, err := parseTrieNode(data, current.offset, current.prefix)
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, *node)
+		for _, edge := range node.Edges {
+			queue = append(queue, pending{offset: edge.Child, prefix: current.prefix + edge.Label})
+		}
+	}
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].Offset < nodes[j].Offset
+	})
+	return nodes, nil
+}
+
+func parseTrieNode(data []byte, offset uint64, prefix string) (*TrieNode, error) {
+	terminalSize, used, err := ReadULEB128(data, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse trie node at %#x: %w", offset, err)
+	}
+	node := &TrieNode{
+		Offset:         offset,
+		Prefix:         prefix,
+		TerminalOffset: offset + used,
+		TerminalSize:   terminalSize,
+	}
+	cursor := node.TerminalOffset + terminalSize
+	if cursor >= uint64(len(data)) {
+		return nil, fmt.Errorf("trie node at %#x is out of bounds", offset)
+	}
+	childCount := uint64(data[cursor])
+	cursor += 1
+	for i := uint64(0); i < childCount; i += 1 {
+		label, err := readCString(data, cursor)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse trie edge %d at %#x: %w", i, offset, err)
+		}
+		child, used, err := ReadULEB128(data, cursor+uint64(len(label))+1)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse trie edge %d at %#x: %w", i, offset, err)
+		}
+		if child == 0 || child >= uint64(len(data)) {
+			return nil, fmt.Errorf("invalid trie edge %d at %#x: child %#x", i, offset, child)
+		}
+		size := uint64(len(label)) + 1 + used
+		node.Edges = append(node.Edges, TrieEdge{
+			Label:  label,
+			Offset: cursor - offset,
+			Size:   size,
+			Child:  child,
+		})
+		cursor += size
+	}
+	node.Size = cursor - offset
+	return node, nil
+}
@@ -0,0 +1,61 @@
+package machoutils_test
+
+import (
+	"testing"
+
+	"github.com/LouisBrunner/mem-viz/pkg/machoutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_ReadULEB128(t *testing.T) {
+	value, size, err := machoutils.ReadULEB128([]byte{0xff, 0xe5, 0x8e, 0x26, 0xff}, 1)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(624485), value)
+	assert.Equal(t, uint64(3), size)
+
+	_, _, err = machoutils.ReadULEB128([]byte{0x80, 0x80}, 0)
+	assert.Error(t, err)
+}
+
+func Test_ParseTrie(t *testing.T) {
+	// root -> "/usr/lib/" -> {"a" = 1, "b" = 2}
+	data := []byte{
+		// 0x00: root
+		0x00, 0x01, '/', 'u', 's', 'r', '/', 'l', 'i', 'b', '/', 0x00, 0x0e,
+		// 0x0d: padding
+		0x00,
+		// 0x0e: "/usr/lib/"
+		0x00, 0x02, 'a', 0x00, 0x18, 'b', 0x00, 0x1c,
+		// 0x16: padding
+		0x00, 0x00,
+		// 0x18: "/usr/lib/a"
+		0x01, 0x01, 0x00, 0x00,
+		// 0x1c: "/usr/lib/b"
+		0x01, 0x02, 0x00,
+	}
+	nodes, err := machoutils.ParseTrie(data)
+	require.NoError(t, err)
+	require.Len(t, nodes, 4)
+
+	assert.Equal(t, "", nodes[0].Prefix)
+	assert.Equal(t, uint64(13), nodes[0].Size)
+	assert.False(t, nodes[0].Terminal())
+	assert.Equal(t, []machoutils.TrieEdge{{Label: "/usr/lib/", Offset: 2, Size: 11, Child: 0x0e}}, nodes[0].Edges)
+
+	assert.Equal(t, "/usr/lib/", nodes[1].Prefix)
+	assert.Len(t, nodes[1].Edges, 2)
+
+	assert.Equal(t, "/usr/lib/a", nodes[2].Prefix)
+	assert.True(t, nodes[2].Terminal())
+	assert.Equal(t, uint64(0x19), nodes[2].TerminalOffset)
+	assert.Equal(t, uint64(3), nodes[2].Size)
+
+	assert.Equal(t, "/usr/lib/b", nodes[3].Prefix)
+	assert.Equal(t, uint64(0x1d), nodes[3].TerminalOffset)
+}
+
+func Test_ParseTrie_loop(t *testing.T) {
+	_, err := machoutils.ParseTrie([]byte{0x00, 0x01, 'a', 0x00, 0x00})
+	assert.Error(t, err)
+}
@@ -0,0 +1,69 @@
+package machoutils
+
+import (
+	"fmt"
+
+	subcontracts "github.com/LouisBrunner/mem-viz/pkg/dsc-viz/contracts"
+	"github.com/LouisBrunner/mem-viz/pkg/parsingutils"
+)
+
+// Formats a X.Y.Z version encoded in nibbles xxxx.yy.zz (e.g. LC_BUILD_VERSION's minos or a dylib's current version),
+// the patch is only shown if it isn't 0 (as ld and otool do)
+func FormatVersion(version uint32) string {
+	major, minor, patch := version>>16, (version>>8)&0xff, version&0xff
+	if patch == 0 {
+		return fmt.Sprintf("%d.%d", major, minor)
+	}
+	return fmt.Sprintf("%d.%d.%d", major, minor, patch)
+}
+
+// Formats a A.B.C.D.E version packed as a24.b10.c10.d10.e10 (LC_SOURCE_VERSION)
+func FormatSourceVersion(version uint64) string {
+	return fmt.Sprintf("%d.%d.%d.%d.%d", version>>40, (version>>30)&0x3ff, (version>>20)&0x3ff, (version>>10)&0x3ff, version&0x3ff)
+}
+
+var platformNames = map[uint32]string{
+	subcontracts.PLATFORM_MACOS:             "macOS",
+	subcontracts.PLATFORM_IOS:               "iOS",
+	subcontracts.PLATFORM_TVOS:              "tvOS",
+	subcontracts.PLATFORM_WATCHOS:           "watchOS",
+	subcontracts.PLATFORM_BRIDGEOS:          "bridgeOS",
+	subcontracts.PLATFORM_MACCATALYST:       "macCatalyst",
+	subcontracts.PLATFORM_IOSSIMULATOR:      "iOS Simulator",
+	subcontracts.PLATFORM_TVOSSIMULATOR:     "tvOS Simulator",
+	subcontracts.PLATFORM_WATCHOSSIMULATOR:  "watchOS Simulator",
+	subcontracts.PLATFORM_DRIVERKIT:         "DriverKit",
+	subcontracts.PLATFORM_VISIONOS:          "visionOS",
+	subcontracts.PLATFORM_VISIONOSSIMULATOR: "visionOS Simulator",
+	subcontracts.PLATFORM_FIRMWARE:          "firmware",
+	subcontracts.PLATFORM_SEPOS:             "sepOS",
+}
+
+func PlatformName(platform uint32) string {
+	if name, found := platformNames[platform]; found {
+		return name
+	}
+	return fmt.Sprintf("Unknown %d", platform)
+}
+
+var toolNames = map[uint32]string{
+	subcontracts.TOOL_CLANG: "clang",
+	subcontracts.TOOL_SWIFT: "swift",
+	subcontracts.TOOL_LD:    "ld",
+	subcontracts.TOOL_LLD:   "lld",
+}
+
+func ToolName(tool uint32) string {
+	if name, found := toolNames[tool]; found {
+		return name
+	}
+	return fmt.Sprintf("Unknown %d", tool)
+}
+
+// Field formats for parsingutils.RegisterFieldFormat
+var (
+	VersionFormat       = parsingutils.IntegerFormat(func(value uint64) string { return FormatVersion(uint32(value)) })
+	SourceVersionFormat = parsingutils.IntegerFormat(FormatSourceVersion)
+	PlatformFormat      = parsingutils.IntegerFormat(func(value uint64) string { return PlatformName(uint32(value)) })
+	ToolFormat          = parsingutils.IntegerFormat(func(value uint64) string { return ToolName(uint32(value)) })
+)
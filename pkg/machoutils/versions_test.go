@@ -0,0 +1,39 @@
+package machoutils_test
+
+import (
+	"testing"
+
+	"github.com/LouisBrunner/mem-viz/pkg/machoutils"
+	"github.com/blacktop/go-macho/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_FormatVersion(t *testing.T) {
+	assert.Equal(t, "14.2.1", machoutils.FormatVersion(0x000e0201))
+	assert.Equal(t, "13.0", machoutils.FormatVersion(0x000d0000))
+	assert.Equal(t, "1238.60.2", machoutils.FormatVersion(0x04d63c02))
+}
+
+func Test_FormatSourceVersion(t *testing.T) {
+	assert.Equal(t, "0.0.0.0.0", machoutils.FormatSourceVersion(0))
+	assert.Equal(t, "1500.3.2.1.7", machoutils.FormatSourceVersion(1500<<40|3<<30|2<<20|1<<10|7))
+}
+
+func Test_PlatformName(t *testing.T) {
+	assert.Equal(t, "macOS", machoutils.PlatformName(1))
+	assert.Equal(t, "visionOS", machoutils.PlatformName(11))
+	assert.Equal(t, "Unknown 99", machoutils.PlatformName(99))
+}
+
+func Test_Formats_namedTypes(t *testing.T) {
+	formatted, ok := machoutils.ToolFormat(types.Tool(3))
+	assert.True(t, ok)
+	assert.Equal(t, "ld", formatted)
+
+	formatted, ok = machoutils.VersionFormat(types.Version(0x000e0201))
+	assert.True(t, ok)
+	assert.Equal(t, "14.2.1", formatted)
+
+	_, ok = machoutils.VersionFormat("14.2.1")
+	assert.False(t, ok)
+}
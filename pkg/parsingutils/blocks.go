@@ -1,9 +1,11 @@
 package parsingutils
 
 import (
+	"sort"
 	"strings"
 
 	"github.com/LouisBrunner/mem-viz/pkg/contracts"
+	"golang.org/x/exp/slices"
 )
 
 func b2i(b bool) int {
@@ -32,3 +34,53 @@ func LessThan(a, b *contracts.MemoryBlock) bool {
 func IsInsideOf(child, parent *contracts.MemoryBlock) bool {
 	return parent.Address <= child.Address && child.Address+uintptr(child.GetSize()) <= parent.Address+uintptr(parent.GetSize())
 }
+
+// Moves a tree parsed on its own (e.g. an architecture of a universal binary) to where it is in its container, links
+// are moved as well as they target the same tree
+func Rebase(root *contracts.MemoryBlock, offset uint64) {
+	root.Address += uintptr(offset)
+	for _, child := range root.Content {
+		Rebase(child, offset)
+	}
+	for _, value := range root.Values {
+		for _, link := range value.Links {
+			link.TargetAddress += offset
+		}
+	}
+}
+
+func isOnEdge(child, parent *contracts.MemoryBlock) bool {
+	return child.Address == parent.Address || child.Address == end(parent)
+}
+
+func end(block *contracts.MemoryBlock) uintptr {
+	return block.Address + uintptr(block.GetSize())
+}
+
+// Adds the child where it belongs in the tree (the deepest block containing it) and returns its parent. Blocks which
+// partially overlap can't be shown by the tree, in which case the child isn't added and the block it overlaps is
+// returned instead
+func AddChildDeep(parent, child *contracts.MemoryBlock) (*contracts.MemoryBlock, *contracts.MemoryBlock) {
+	isEmpty := child.GetSize() == 0
+	// Tables can have thousands of entries, so skip the siblings ending before the child
+	// (they are sorted and don't overlap, so their ends are sorted too)
+	start := sort.Search(len(parent.Content), func(i int) bool {
+		return end(parent.Content[i]) >= child.Address
+	})
+	for i := start; i < len(parent.Content); i += 1 {
+		curr := parent.Content[i]
+		if IsInsideOf(child, curr) && (!isEmpty || !isOnEdge(child, curr)) {
+			return AddChildDeep(curr, child)
+		} else if curr.Address > child.Address || (isEmpty && curr.Address == child.Address) {
+			if end(child) > curr.Address && !isEmpty {
+				return nil, curr
+			}
+			parent.Content = slices.Insert(parent.Content, i, child)
+			return parent, nil
+		} else if curr.Address < end(child) && child.Address < end(curr) {
+			return nil, curr
+		}
+	}
+	parent.Content = append(parent.Content, child)
+	return parent, nil
+}
@@ -0,0 +1,62 @@
+package parsingutils_test
+
+import (
+	"testing"
+
+	"github.com/LouisBrunner/mem-viz/pkg/contracts"
+	"github.com/LouisBrunner/mem-viz/pkg/parsingutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func block(name string, address uintptr, size uint64) *contracts.MemoryBlock {
+	return &contracts.MemoryBlock{Name: name, Address: address, Size: size}
+}
+
+func Test_AddChildDeep(t *testing.T) {
+	root := block("root", 0, 0x100)
+	a := block("a", 0x10, 0x20)
+	b := block("b", 0x40, 0x10)
+	for _, child := range []*contracts.MemoryBlock{b, a} {
+		parent, sibling := parsingutils.AddChildDeep(root, child)
+		require.Nil(t, sibling)
+		assert.Same(t, root, parent)
+	}
+	assert.Equal(t, []*contracts.MemoryBlock{a, b}, root.Content)
+
+	inner := block("inner", 0x18, 0x8)
+	parent, sibling := parsingutils.AddChildDeep(root, inner)
+	require.Nil(t, sibling)
+	assert.Same(t, a, parent)
+	assert.Equal(t, []*contracts.MemoryBlock{inner}, a.Content)
+
+	// Empty blocks on the edge of another are its siblings instead of its children
+	empty := block("empty", 0x40, 0)
+	parent, sibling = parsingutils.AddChildDeep(root, empty)
+	require.Nil(t, sibling)
+	assert.Same(t, root, parent)
+	assert.Equal(t, []*contracts.MemoryBlock{a, empty, b}, root.Content)
+
+	last := block("last", 0x80, 0x10)
+	parent, _ = parsingutils.AddChildDeep(root, last)
+	assert.Same(t, root, parent)
+	assert.Equal(t, last, root.Content[3])
+}
+
+func Test_AddChildDeep_Overlap(t *testing.T) {
+	cases := map[string]*contracts.MemoryBlock{
+		"start": block("start", 0x8, 0x10),
+		"end":   block("end", 0x28, 0x10),
+	}
+	for name, child := range cases {
+		t.Run(name, func(t *testing.T) {
+			root := block("root", 0, 0x100)
+			a := block("a", 0x10, 0x20)
+			root.Content = []*contracts.MemoryBlock{a}
+			parent, sibling := parsingutils.AddChildDeep(root, child)
+			assert.Nil(t, parent)
+			assert.Same(t, a, sibling)
+			assert.Equal(t, []*contracts.MemoryBlock{a}, root.Content)
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package parsingutils
+
+import (
+	"reflect"
+
+	"github.com/LouisBrunner/mem-viz/pkg/contracts"
+)
+
+// Renders the raw value of a field into something meaningful (e.g. a packed version), false if it can't
+type FieldFormat func(value interface{}) (string, bool)
+
+type fieldFormatKey struct {
+	structType reflect.Type
+	field      string
+}
+
+var fieldFormats = map[fieldFormatKey]FieldFormat{}
+
+// Registers a semantic format for a field of a struct, it takes precedence over the Formatter given to AddStructValue.
+// Formats are keyed by the struct declaring the field, so they also apply when that struct is embedded
+func RegisterFieldFormat(structValue interface{}, field string, format FieldFormat) {
+	fieldFormats[fieldFormatKey{GetDataValue(structValue).Type(), field}] = format
+}
+
+// Same as AddValue for a field of a struct, using its registered format if there is one
+func AddStructValue(block *contracts.MemoryBlock, structType reflect.Type, field reflect.StructField, value interface{}, offset uint64, size uint8, format Formatter) {
+	declaring := structType
+	if len(field.Index) > 1 {
+		declaring = structType.FieldByIndex(field.Index[:len(field.Index)-1]).Type
+	}
+	if fieldFormat, found := fieldFormats[fieldFormatKey{declaring, field.Name}]; found {
+		AddFormattedValue(block, field.Name, value, offset, size, fieldFormat)
+		return
+	}
+	AddValue(block, field.Name, value, offset, size, format)
+}
+
+// Same as AddValue with a semantic format (e.g. a version or an enum), integers keep their number as Raw.
+// Values the format can't render are shown with FormatValue instead
+func AddFormattedValue(block *contracts.MemoryBlock, name string, value interface{}, offset uint64, size uint8, format FieldFormat) {
+	formatted, ok := format(value)
+	if !ok {
+		AddValue(block, name, value, offset, size, FormatValue)
+		return
+	}
+	AddValue(block, name, value, offset, size, func(name string, value interface{}) string {
+		return formatted
+	})
+	if raw, isInteger := rawInteger(value); isInteger {
+		block.Values[len(block.Values)-1].Raw = raw
+	}
+}
+
+// Adds every exported field of a struct as a value at its Go offset (which must match the binary layout),
+// fields ending after limit are skipped (e.g. for versioned structs)
+func AddStructValues(block *contracts.MemoryBlock, v interface{}, limit uint64, format Formatter) {
+	val := GetDataValue(v)
+	typ := val.Type()
+	if typ.Kind() != reflect.Struct {
+		AddValue(block, "Value", val.Interface(), 0, uint8(typ.Size()), format)
+		return
+	}
+	for _, field := range reflect.VisibleFields(typ) {
+		fieldType := field.Type
+		if (fieldType.Kind() == reflect.Struct && field.Anonymous) || !field.IsExported() {
+			continue
+		}
+		offset := structFieldOffset(typ, field)
+		if offset+uint64(fieldType.Size()) > limit {
+			continue
+		}
+		AddStructValue(block, typ, field, val.FieldByIndex(field.Index).Interface(), offset, uint8(fieldType.Size()), format)
+	}
+}
+
+// Offset of a field from the start of the struct, including the offsets of the structs it is promoted from
+func structFieldOffset(typ reflect.Type, field reflect.StructField) uint64 {
+	offset := uint64(0)
+	for i := range field.Index {
+		offset += uint64(typ.FieldByIndex(field.Index[:i+1]).Offset)
+	}
+	return offset
+}
+
+// Adapts a format of integers to any integer type (e.g. uint32 or a named type like types.Version)
+func IntegerFormat(format func(value uint64) string) FieldFormat {
+	return func(value interface{}) (string, bool) {
+		raw, ok := rawInteger(value)
+		if !ok {
+			return "", false
+		}
+		if signed, isSigned := raw.(int64); isSigned {
+			return format(uint64(signed)), true
+		}
+		return format(raw.(uint64)), true
+	}
+}
+
+// Integers (including named integer types) as a plain number, false for anything else
+func rawInteger(value interface{}) (interface{}, bool) {
+	val := reflect.ValueOf(value)
+	switch val.Kind() {
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return val.Uint(), true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return val.Int(), true
+	}
+	return nil, false
+}
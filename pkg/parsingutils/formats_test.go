@@ -0,0 +1,174 @@
+package parsingutils_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/LouisBrunner/mem-viz/pkg/commons"
+	"github.com/LouisBrunner/mem-viz/pkg/contracts"
+	"github.com/LouisBrunner/mem-viz/pkg/contracts/contractstest"
+	"github.com/LouisBrunner/mem-viz/pkg/parsingutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testVersion uint32
+
+type testCommon struct {
+	Version testVersion
+	Flags   uint32
+}
+
+type testHeader struct {
+	testCommon
+	Platform uint32
+	Delta    int32
+	Name     [16]byte
+}
+
+// Not registered, to check formats are keyed by their struct
+type testOther struct {
+	Version uint32
+	Flags   uint32
+}
+
+func init() {
+	parsingutils.RegisterFieldFormat(testCommon{}, "Version", parsingutils.IntegerFormat(func(value uint64) string {
+		return fmt.Sprintf("%d.%d", value>>16, value&0xffff)
+	}))
+	parsingutils.RegisterFieldFormat(testHeader{}, "Platform", func(value interface{}) (string, bool) {
+		if value.(uint32) == 1 {
+			return "macOS", true
+		}
+		return "", false
+	})
+	parsingutils.RegisterFieldFormat(testHeader{}, "Delta", parsingutils.IntegerFormat(func(value uint64) string {
+		return fmt.Sprintf("%d", int64(value))
+	}))
+}
+
+func Test_AddStructValues_formats(t *testing.T) {
+	header := testHeader{
+		testCommon: testCommon{Version: 0xe0002, Flags: 0x10},
+		Platform:   1,
+		Delta:      -3,
+	}
+	copy(header.Name[:], "name")
+	block := &contracts.MemoryBlock{}
+	parsingutils.AddStructValues(block, &header, 36, parsingutils.FormatValue)
+
+	// Promoted from the embedded struct, at its offset
+	version := contractstest.FindValue(t, block, "Version")
+	assert.Equal(t, "14.2", version.Value)
+	assert.Equal(t, uint64(0), version.Offset)
+	assert.Equal(t, uint8(4), version.Size)
+	assert.Equal(t, uint64(0xe0002), version.Raw)
+	platform := contractstest.FindValue(t, block, "Platform")
+	assert.Equal(t, "macOS", platform.Value)
+	assert.Equal(t, uint64(8), platform.Offset)
+	assert.Equal(t, uint64(1), platform.Raw)
+	delta := contractstest.FindValue(t, block, "Delta")
+	assert.Equal(t, "-3", delta.Value)
+	assert.Equal(t, int64(-3), delta.Raw)
+
+	// Unformatted values don't need their number
+	flags := contractstest.FindValue(t, block, "Flags")
+	assert.Equal(t, "0x10", flags.Value)
+	assert.Nil(t, flags.Raw)
+	name := contractstest.FindValue(t, block, "Name")
+	assert.Equal(t, "name", name.Value)
+	assert.Nil(t, name.Raw)
+
+	// Fields past the limit are skipped
+	block = &contracts.MemoryBlock{}
+	parsingutils.AddStructValues(block, &header, 12, parsingutils.FormatValue)
+	assert.Len(t, block.Values, 3)
+}
+
+func Test_AddStructValue_fallback(t *testing.T) {
+	typ := reflect.TypeOf(testHeader{})
+	platform, _ := typ.FieldByName("Platform")
+	block := &contracts.MemoryBlock{}
+	// The format can't render it, the default one is used (not the one given)
+	parsingutils.AddStructValue(block, typ, platform, uint32(0x20), 8, 4, func(name string, value interface{}) string {
+		return "unused"
+	})
+	value := contractstest.FindValue(t, block, "Platform")
+	assert.Equal(t, "0x20", value.Value)
+	assert.Nil(t, value.Raw)
+
+	// Only the struct declaring the field has the format
+	other := reflect.TypeOf(testOther{})
+	version, _ := other.FieldByName("Version")
+	parsingutils.AddStructValue(block, other, version, uint32(0xe0002), 0, 4, parsingutils.FormatValue)
+	value = contractstest.FindValue(t, block, "Version")
+	assert.Equal(t, "0xe0002", value.Value)
+	assert.Nil(t, value.Raw)
+}
+
+// An enum with its own names, not registered
+type testKind uint8
+
+func (me testKind) String() string {
+	return "kind"
+}
+
+func Test_AddValue_raw(t *testing.T) {
+	block := &contracts.MemoryBlock{}
+	parsingutils.AddValue(block, "Hex", uint16(0x10), 0, 2, parsingutils.FormatValue)
+	parsingutils.AddValue(block, "Decimal", uint16(0x10), 2, 2, func(name string, value interface{}) string {
+		return fmt.Sprintf("%d", value)
+	})
+	parsingutils.AddValue(block, "Stringer", testKind(1), 4, 1, parsingutils.FormatValue)
+	assert.Nil(t, contractstest.FindValue(t, block, "Hex").Raw)
+	assert.Nil(t, contractstest.FindValue(t, block, "Decimal").Raw)
+	stringer := contractstest.FindValue(t, block, "Stringer")
+	assert.Equal(t, "kind", stringer.Value)
+	assert.Nil(t, stringer.Raw)
+}
+
+func Test_AddFormattedValue(t *testing.T) {
+	block := &contracts.MemoryBlock{}
+	named := func(value interface{}) (string, bool) {
+		if value == uint16(1) || value == "1" {
+			return "one", true
+		}
+		return "", false
+	}
+	parsingutils.AddFormattedValue(block, "Named", uint16(1), 0, 2, named)
+	parsingutils.AddFormattedValue(block, "Unknown", uint16(2), 2, 2, named)
+	parsingutils.AddFormattedValue(block, "String", "1", 4, 1, named)
+
+	value := contractstest.FindValue(t, block, "Named")
+	assert.Equal(t, "one", value.Value)
+	assert.Equal(t, uint64(1), value.Raw)
+	value = contractstest.FindValue(t, block, "Unknown")
+	assert.Equal(t, "0x2", value.Value)
+	assert.Nil(t, value.Raw)
+	value = contractstest.FindValue(t, block, "String")
+	assert.Equal(t, "one", value.Value)
+	assert.Nil(t, value.Raw)
+}
+
+func Test_Raw_fromJSON(t *testing.T) {
+	header := testHeader{
+		testCommon: testCommon{Version: 0xe0002},
+		Platform:   1,
+		Delta:      -3,
+	}
+	block := &contracts.MemoryBlock{Name: "header", Size: 36}
+	parsingutils.AddStructValues(block, &header, 36, parsingutils.FormatValue)
+	// Too big to go through a float64
+	parsingutils.AddFormattedValue(block, "Big", uint64(0xfedcba9876543210), 36, 8, func(value interface{}) (string, bool) {
+		return "big", true
+	})
+
+	var buf bytes.Buffer
+	require.NoError(t, json.NewEncoder(&buf).Encode(block))
+	decoded, err := commons.FromJSONText(nil, buf.String())
+	require.NoError(t, err)
+	assert.Equal(t, block, decoded)
+}
@@ -29,3 +29,6 @@ func AddLinkWithAddr(parent *contracts.MemoryBlock, parentValueName, linkName st
 func AddLinkWithBlock(parent *contracts.MemoryBlock, parentValueName string, child *contracts.MemoryBlock, linkName string) error {
 	return AddLinkWithAddr(parent, parentValueName, linkName, child.Address)
 }
+
+// Turns a VM address into an address we can link to, false if it isn't mapped
+type Resolver func(vmAddr uint64) (uintptr, bool)
@@ -0,0 +1,15 @@
+package parsingutils
+
+import "encoding/binary"
+
+// Byte order of the image being decoded, nil means little-endian
+type ByteOrder interface {
+	binary.ByteOrder
+}
+
+func OrLittleEndian(order ByteOrder) binary.ByteOrder {
+	if order == nil {
+		return binary.LittleEndian
+	}
+	return order
+}
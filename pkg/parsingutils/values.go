@@ -11,16 +11,16 @@ import (
 type Formatter func(name string, value interface{}) string
 
 func AddValue(block *contracts.MemoryBlock, name string, value interface{}, offset uint64, size uint8, format Formatter) {
-	block.Values = append(block.Values, &contracts.MemoryValue{
+	memValue := &contracts.MemoryValue{
 		Name:   name,
 		Value:  format(name, value),
 		Offset: offset,
 		Size:   size,
-	})
+	}
+	block.Values = append(block.Values, memValue)
 }
 
 func FormatInteger(name string, value interface{}) string {
-	// FIXME: would be nice to have more specialized formats, e.g. for OSVersion or CacheType
 	return fmt.Sprintf("%#x", value)
 }
 
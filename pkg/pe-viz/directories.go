@@ -0,0 +1,77 @@
+package pe
+
+import (
+	"debug/pe"
+	"fmt"
+
+	"github.com/LouisBrunner/mem-viz/pkg/contracts"
+	"github.com/LouisBrunner/mem-viz/pkg/peutils"
+)
+
+type directoryDecoder func(img peutils.Image, dir pe.DataDirectory) ([]*contracts.MemoryBlock, error)
+
+var directoryDecoders = map[int]directoryDecoder{
+	pe.IMAGE_DIRECTORY_ENTRY_EXPORT:       peutils.ParseExports,
+	pe.IMAGE_DIRECTORY_ENTRY_IMPORT:       peutils.ParseImports,
+	pe.IMAGE_DIRECTORY_ENTRY_RESOURCE:     peutils.ParseResources,
+	pe.IMAGE_DIRECTORY_ENTRY_BASERELOC:    peutils.ParseBaseRelocations,
+	pe.IMAGE_DIRECTORY_ENTRY_DEBUG:        peutils.ParseDebug,
+	pe.IMAGE_DIRECTORY_ENTRY_DELAY_IMPORT: peutils.ParseDelayImports,
+}
+
+// Decodes the tables given by the data directories, the others are only shown as a region (e.g. the exception table)
+func (me *parser) addDirectories(root *contracts.MemoryBlock, img *image) error {
+	for i, dir := range img.dataDirectories() {
+		if dir.VirtualAddress == 0 || dir.Size == 0 {
+			continue
+		}
+		name := peutils.DirectoryName(i)
+		if i == pe.IMAGE_DIRECTORY_ENTRY_SECURITY {
+			err := me.addCertificates(root, img, dir)
+			if err != nil {
+				return fmt.Errorf("failed to parse data directory %d (%s): %w", i, name, err)
+			}
+			continue
+		}
+
+		decode, found := directoryDecoders[i]
+		if !found {
+			me.addDirectoryRegion(root, img, name, dir)
+			continue
+		}
+		blocks, err := decode(img.layout, dir)
+		if err != nil {
+			return fmt.Errorf("failed to parse data directory %d (%s): %w", i, name, err)
+		}
+		for _, block := range blocks {
+			me.addChild(root, block)
+		}
+	}
+	return nil
+}
+
+func (me *parser) addDirectoryRegion(root *contracts.MemoryBlock, img *image, name string, dir pe.DataDirectory) {
+	offset, found := img.layout.Offset(dir.VirtualAddress)
+	if !found {
+		return
+	}
+	if _, err := img.slice(uint64(offset), uint64(dir.Size)); err != nil {
+		me.logger.WithError(err).Warnf("%s is not inside the file", name)
+		return
+	}
+	img.directories = append(img.directories, me.addRegion(root, name, uint64(offset), uint64(dir.Size)))
+}
+
+// The certificate table isn't loaded, so it's usually after the last section
+func (me *parser) addCertificates(root *contracts.MemoryBlock, img *image, dir pe.DataDirectory) error {
+	data, err := img.slice(uint64(dir.VirtualAddress), uint64(dir.Size))
+	if err != nil {
+		return err
+	}
+	tree, err := peutils.ParseCertificates(data, uintptr(dir.VirtualAddress))
+	if err != nil {
+		return err
+	}
+	me.addChild(root, tree)
+	return nil
+}
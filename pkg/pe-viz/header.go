@@ -0,0 +1,152 @@
+package pe
+
+import (
+	"debug/pe"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/LouisBrunner/mem-viz/pkg/contracts"
+	"github.com/LouisBrunner/mem-viz/pkg/parsingutils"
+	"github.com/LouisBrunner/mem-viz/pkg/peutils"
+)
+
+func (me *parser) addImage(root *contracts.MemoryBlock, img *image) error {
+	sectionsOffset, err := me.addHeaders(root, img)
+	if err != nil {
+		return err
+	}
+	sectionHeaders, err := me.addSectionHeaders(root, img, sectionsOffset)
+	if err != nil {
+		return err
+	}
+	err = me.addSections(root, img, sectionHeaders)
+	if err != nil {
+		return err
+	}
+	err = me.addSymbolTable(root, img)
+	if err != nil {
+		return err
+	}
+	err = me.addDirectories(root, img)
+	if err != nil {
+		return err
+	}
+	me.dropOverlappingDirectories(img)
+	return nil
+}
+
+// Images start with the MS-DOS header and stub, objects directly with the COFF file header, returns where the section table is
+func (me *parser) addHeaders(root *contracts.MemoryBlock, img *image) (uint64, error) {
+	fileHeaderSize := uint64(binary.Size(pe.FileHeader{}))
+	optionalHeaderSize := uint64(img.file.SizeOfOptionalHeader)
+	if len(img.data) < 2 || binary.LittleEndian.Uint16(img.data) != peutils.DOSMagic {
+		header, err := me.addStruct(root, img, &pe.FileHeader{}, "COFF File Header", 0)
+		if err != nil {
+			return 0, err
+		}
+		img.fileHeader = header
+		return fileHeaderSize + optionalHeaderSize, nil
+	}
+
+	dos, dosHeader, err := peutils.ParseDOSHeader(img.data, 0)
+	if err != nil {
+		return 0, err
+	}
+	me.addChild(root, dos)
+	ntOffset := uint64(dosHeader.Lfanew)
+	if stubOffset := dos.Size; ntOffset > stubOffset {
+		me.addRegion(root, "DOS Stub", stubOffset, ntOffset-stubOffset)
+	}
+
+	nt, err := peutils.ParseNTHeaders(img.layout, ntOffset)
+	if err != nil {
+		return 0, err
+	}
+	me.addChild(root, nt)
+	// The file header always comes first, after the signature
+	img.fileHeader = nt.Content[0]
+	return ntOffset + 4 + fileHeaderSize + optionalHeaderSize, nil
+}
+
+func (me *parser) addSectionHeaders(root *contracts.MemoryBlock, img *image, offset uint64) ([]*contracts.MemoryBlock, error) {
+	count := uint64(len(img.file.Sections))
+	if count == 0 {
+		return nil, nil
+	}
+	entrySize := uint64(binary.Size(pe.SectionHeader32{}))
+	sections := me.addRegion(root, fmt.Sprintf("Section Headers (%d)", count), offset, count*entrySize)
+	err := parsingutils.AddLinkWithBlock(img.fileHeader, "NumberOfSections", sections, "gives amount")
+	if err != nil {
+		return nil, err
+	}
+
+	headers := make([]*contracts.MemoryBlock, 0, count)
+	for i, sect := range img.file.Sections {
+		header, err := me.addStruct(sections, img, &pe.SectionHeader32{}, fmt.Sprintf("Section Header %d (%s)", i, sect.Name), offset+uint64(i)*entrySize)
+		if err != nil {
+			return nil, err
+		}
+		headers = append(headers, header)
+	}
+	return headers, nil
+}
+
+func (me *parser) addSections(root *contracts.MemoryBlock, img *image, headers []*contracts.MemoryBlock) error {
+	for i, sect := range img.file.Sections {
+		// Uninitialized data (e.g. .bss) has nothing in the file
+		if sect.Offset == 0 || sect.Size == 0 {
+			continue
+		}
+		_, err := img.slice(uint64(sect.Offset), uint64(sect.Size))
+		if err != nil {
+			return fmt.Errorf("section %d (%s) is not inside the file: %w", i, sect.Name, err)
+		}
+		block := me.addRegion(root, fmt.Sprintf("Section %d (%s)", i, sect.Name), uint64(sect.Offset), uint64(sect.Size))
+		err = parsingutils.AddLinkWithBlock(headers[i], "PointerToRawData", block, "points to")
+		if err != nil {
+			return err
+		}
+		err = parsingutils.AddLinkWithBlock(headers[i], "SizeOfRawData", block, "gives size")
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// The COFF symbol table is mostly found in objects (and in images built by MinGW), it's directly followed by its string table
+func (me *parser) addSymbolTable(root *contracts.MemoryBlock, img *image) error {
+	offset, count := uint64(img.file.PointerToSymbolTable), uint64(img.file.NumberOfSymbols)
+	if offset == 0 {
+		return nil
+	}
+	size := count * pe.COFFSymbolSize
+	_, err := img.slice(offset, size)
+	if err != nil {
+		return fmt.Errorf("COFF symbol table is not inside the file: %w", err)
+	}
+	symbols := me.addRegion(root, fmt.Sprintf("COFF Symbols (%d)", count), offset, size)
+	err = parsingutils.AddLinkWithBlock(img.fileHeader, "PointerToSymbolTable", symbols, "points to")
+	if err != nil {
+		return err
+	}
+	err = parsingutils.AddLinkWithBlock(img.fileHeader, "NumberOfSymbols", symbols, "gives amount")
+	if err != nil {
+		return err
+	}
+
+	// The size of the string table includes itself
+	stringsOffset := offset + size
+	raw, err := img.slice(stringsOffset, 4)
+	if err != nil {
+		return nil
+	}
+	stringsSize := uint64(binary.LittleEndian.Uint32(raw))
+	if _, err = img.slice(stringsOffset, stringsSize); err != nil || stringsSize < 4 {
+		me.logger.Warnf("invalid COFF string table size %#x", stringsSize)
+		return nil
+	}
+	stringTable := me.addRegion(root, "COFF String Table", stringsOffset, stringsSize)
+	parsingutils.AddValue(stringTable, "Size", uint32(stringsSize), 0, 4, parsingutils.FormatValue)
+	return nil
+}
@@ -0,0 +1,110 @@
+package pe
+
+import (
+	"debug/pe"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/LouisBrunner/mem-viz/pkg/contracts"
+	"github.com/LouisBrunner/mem-viz/pkg/parsingutils"
+	"github.com/LouisBrunner/mem-viz/pkg/peutils"
+	"golang.org/x/exp/slices"
+)
+
+type image struct {
+	file   *pe.File
+	data   []byte
+	layout peutils.Image
+	// Where the NT headers (or the COFF file header of objects) are in the tree
+	fileHeader *contracts.MemoryBlock
+	// Blocks of the data directories which aren't decoded, they are dropped if they overlap the decoded ones
+	directories []*contracts.MemoryBlock
+}
+
+func (me *image) slice(offset, size uint64) ([]byte, error) {
+	if offset > uint64(len(me.data)) || size > uint64(len(me.data))-offset {
+		return nil, fmt.Errorf("out of bounds: %#x+%#x > %#x", offset, size, len(me.data))
+	}
+	return me.data[offset : offset+size], nil
+}
+
+// Data directories of the optional header, objects don't have any
+func (me *image) dataDirectories() []pe.DataDirectory {
+	switch header := me.file.OptionalHeader.(type) {
+	case *pe.OptionalHeader32:
+		return header.DataDirectory[:min(header.NumberOfRvaAndSizes, uint32(len(header.DataDirectory)))]
+	case *pe.OptionalHeader64:
+		return header.DataDirectory[:min(header.NumberOfRvaAndSizes, uint32(len(header.DataDirectory)))]
+	}
+	return nil
+}
+
+func (me *parser) addChild(_parent, child *contracts.MemoryBlock) *contracts.MemoryBlock {
+	sameAddress, found := me.allBlocks[child.Address]
+	if !found {
+		sameAddress = &[]*contracts.MemoryBlock{}
+		me.allBlocks[child.Address] = sameAddress
+	}
+
+	added := false
+	for i, curr := range *sameAddress {
+		if parsingutils.LessThan(child, curr) {
+			*sameAddress = slices.Insert(*sameAddress, i, child)
+			added = true
+			break
+		}
+	}
+	if !added {
+		*sameAddress = append(*sameAddress, child)
+	}
+	return child
+}
+
+func overlaps(a, b *contracts.MemoryBlock) bool {
+	if parsingutils.IsInsideOf(a, b) || parsingutils.IsInsideOf(b, a) {
+		return false
+	}
+	return a.Address < b.Address+uintptr(b.GetSize()) && b.Address < a.Address+uintptr(a.GetSize())
+}
+
+func (me *parser) removeChild(child *contracts.MemoryBlock) {
+	sameAddress := me.allBlocks[child.Address]
+	if i := slices.Index(*sameAddress, child); i >= 0 {
+		*sameAddress = slices.Delete(*sameAddress, i, i+1)
+	}
+}
+
+// Blocks can't partially overlap, which the bounds given by some data directories do (e.g. an import directory
+// whose size covers its lookup tables), those are dropped and only their directory entry remains
+func (me *parser) dropOverlappingDirectories(img *image) {
+	for _, directory := range img.directories {
+		for _, sameAddress := range me.allBlocks {
+			if slices.ContainsFunc(*sameAddress, func(other *contracts.MemoryBlock) bool { return overlaps(directory, other) }) {
+				me.logger.Debugf("dropping %s as it overlaps other blocks", directory.Name)
+				me.removeChild(directory)
+				break
+			}
+		}
+	}
+}
+
+func (me *parser) addRegion(parent *contracts.MemoryBlock, name string, offset, size uint64) *contracts.MemoryBlock {
+	return me.addChild(parent, &contracts.MemoryBlock{
+		Name:         name,
+		Address:      uintptr(offset),
+		ParentOffset: offset - uint64(parent.Address),
+		Size:         size,
+	})
+}
+
+// Unpacks one of the debug/pe structs (e.g. pe.SectionHeader32) from the file and adds it as a block
+func (me *parser) addStruct(parent *contracts.MemoryBlock, img *image, v any, name string, offset uint64) (*contracts.MemoryBlock, error) {
+	err := peutils.ReadStruct(img.data, offset, v)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", name, err)
+	}
+	size := uint64(binary.Size(v))
+	block := me.addRegion(parent, name, offset, size)
+	parsingutils.AddStructValues(block, v, size, parsingutils.FormatValue)
+	return block, nil
+}
@@ -0,0 +1,73 @@
+package pe
+
+import (
+	"bytes"
+	"debug/pe"
+	"os"
+
+	"github.com/LouisBrunner/mem-viz/pkg/contracts"
+	"github.com/LouisBrunner/mem-viz/pkg/parsingutils"
+	"github.com/LouisBrunner/mem-viz/pkg/peutils"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
+)
+
+type parser struct {
+	logger    *logrus.Logger
+	allBlocks map[uintptr]*[]*contracts.MemoryBlock
+}
+
+func Parse(logger *logrus.Logger, file string) (*contracts.MemoryBlock, error) {
+	p := &parser{
+		logger:    logger,
+		allBlocks: make(map[uintptr]*[]*contracts.MemoryBlock),
+	}
+	return p.parse(file)
+}
+
+func (me *parser) parse(file string) (*contracts.MemoryBlock, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	f, err := pe.NewFile(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	root := &contracts.MemoryBlock{
+		Name: file,
+		Size: uint64(len(data)),
+	}
+	img := &image{
+		file:   f,
+		data:   data,
+		layout: peutils.NewImage(f, data),
+	}
+	err = me.addImage(root, img)
+	if err != nil {
+		return nil, err
+	}
+
+	me.rebalance(root)
+
+	return root, nil
+}
+
+func (me *parser) rebalance(root *contracts.MemoryBlock) {
+	addresses := maps.Keys(me.allBlocks)
+	slices.Sort(addresses)
+
+	for _, address := range addresses {
+		sameAddress := me.allBlocks[address]
+		for _, block := range *sameAddress {
+			newParent, sibling := parsingutils.AddChildDeep(root, block)
+			if sibling != nil {
+				me.logger.Warnf("dropping %s as it overlaps %s", block.Name, sibling.Name)
+				continue
+			}
+			block.ParentOffset = uint64(block.Address - newParent.Address)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package peutils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/LouisBrunner/mem-viz/pkg/contracts"
+	"github.com/LouisBrunner/mem-viz/pkg/parsingutils"
+)
+
+// Tables of PE images point to each other through RVAs (e.g. imports point to names anywhere in the image),
+// so most decoders in this package take the whole image and return every block they found at its file offset,
+// it's up to the caller to nest them where they belong
+
+func newBlock(name string, address uintptr, size uint64) *contracts.MemoryBlock {
+	return &contracts.MemoryBlock{
+		Name:    name,
+		Address: address,
+		Size:    size,
+	}
+}
+
+func addChild(parent *contracts.MemoryBlock, name string, offset, size uint64) *contracts.MemoryBlock {
+	child := &contracts.MemoryBlock{
+		Name:         name,
+		Address:      parent.Address + uintptr(offset),
+		Size:         size,
+		ParentOffset: offset,
+	}
+	parent.Content = append(parent.Content, child)
+	return child
+}
+
+func addValue(block *contracts.MemoryBlock, name string, value interface{}, offset uint64, size uint8) {
+	parsingutils.AddValue(block, name, value, offset, size, parsingutils.FormatValue)
+}
+
+func subSlice(data []byte, offset, size uint64) ([]byte, error) {
+	if offset > uint64(len(data)) || size > uint64(len(data))-offset {
+		return nil, fmt.Errorf("out of bounds: %#x+%#x > %#x", offset, size, len(data))
+	}
+	return data[offset : offset+size], nil
+}
+
+// Reads a NUL-terminated string, strings running until the end of the data are accepted
+func ReadCString(data []byte, offset uint64) (string, error) {
+	if offset >= uint64(len(data)) {
+		return "", fmt.Errorf("out of bounds: %#x >= %#x", offset, len(data))
+	}
+	end := bytes.IndexByte(data[offset:], 0)
+	if end < 0 {
+		return string(data[offset:]), nil
+	}
+	return string(data[offset : offset+uint64(end)]), nil
+}
+
+// Unpacks one of the structs of this package or debug/pe (e.g. pe.FileHeader) at offset, PE is always little-endian
+func ReadStruct(data []byte, offset uint64, v any) error {
+	raw, err := subSlice(data, offset, uint64(binary.Size(v)))
+	if err != nil {
+		return err
+	}
+	return binary.Read(bytes.NewReader(raw), binary.LittleEndian, v)
+}
+
+// Unpacks the struct at offset and adds it as a child block with one value per field
+func addStruct(parent *contracts.MemoryBlock, data []byte, v any, name string, offset uint64) (*contracts.MemoryBlock, error) {
+	err := ReadStruct(data, offset, v)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", name, err)
+	}
+	size := uint64(binary.Size(v))
+	block := addChild(parent, name, offset, size)
+	parsingutils.AddStructValues(block, v, size, parsingutils.FormatValue)
+	return block, nil
+}
+
+// Same as addStruct for a block which isn't nested in another one (its address is the file offset)
+func newStruct(data []byte, v any, name string, offset uint64) (*contracts.MemoryBlock, error) {
+	err := ReadStruct(data, offset, v)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", name, err)
+	}
+	size := uint64(binary.Size(v))
+	block := newBlock(name, uintptr(offset), size)
+	parsingutils.AddStructValues(block, v, size, parsingutils.FormatValue)
+	return block, nil
+}
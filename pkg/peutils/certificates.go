@@ -0,0 +1,61 @@
+package peutils
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/LouisBrunner/mem-viz/pkg/contracts"
+	"github.com/LouisBrunner/mem-viz/pkg/parsingutils"
+)
+
+// WIN_CERTIFICATE, followed by the certificate itself
+type WinCertificate struct {
+	Length          uint32
+	Revision        uint16
+	CertificateType uint16
+}
+
+const WIN_CERT_TYPE_PKCS_SIGNED_DATA = 0x0002
+
+var certificateRevisionNames = map[uint64]string{
+	0x0100: "WIN_CERT_REVISION_1_0",
+	0x0200: "WIN_CERT_REVISION_2_0",
+}
+
+var certificateTypeNames = map[uint64]string{
+	0x0001:                         "WIN_CERT_TYPE_X509",
+	WIN_CERT_TYPE_PKCS_SIGNED_DATA: "WIN_CERT_TYPE_PKCS_SIGNED_DATA",
+	0x0003:                         "WIN_CERT_TYPE_RESERVED_1",
+	0x0004:                         "WIN_CERT_TYPE_TS_STACK_SIGNED",
+}
+
+// Parses the certificate table (IMAGE_DIRECTORY_ENTRY_SECURITY), data must contain exactly the table
+// (it isn't loaded, so its directory gives a file offset instead of an RVA)
+func ParseCertificates(data []byte, address uintptr) (*contracts.MemoryBlock, error) {
+	root := newBlock("Certificate Table", address, uint64(len(data)))
+	headerSize := uint64(binary.Size(WinCertificate{}))
+	for offset := uint64(0); offset < uint64(len(data)); {
+		header := WinCertificate{}
+		err := ReadStruct(data, offset, &header)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse certificate at %#x: %w", offset, err)
+		}
+		if uint64(header.Length) < headerSize || uint64(header.Length) > uint64(len(data))-offset {
+			return nil, fmt.Errorf("invalid certificate length %#x at %#x", header.Length, offset)
+		}
+		typeName := enumName(certificateTypeNames, uint64(header.CertificateType))
+		certificate := addChild(root, fmt.Sprintf("Certificate (%s)", typeName), offset, uint64(header.Length))
+		parsingutils.AddStructValues(certificate, &header, headerSize, parsingutils.FormatValue)
+		if uint64(header.Length) > headerSize {
+			contentName := "Certificate Data"
+			if header.CertificateType == WIN_CERT_TYPE_PKCS_SIGNED_DATA {
+				contentName = "PKCS #7 SignedData"
+			}
+			addChild(certificate, contentName, headerSize, uint64(header.Length)-headerSize)
+		}
+		// Entries are aligned on 8 bytes
+		offset += (uint64(header.Length) + 7) &^ 7
+	}
+	root.Name = fmt.Sprintf("Certificate Table (%d)", len(root.Content))
+	return root, nil
+}
@@ -0,0 +1,40 @@
+package peutils_test
+
+import (
+	"testing"
+
+	"github.com/LouisBrunner/mem-viz/pkg/contracts/contractstest"
+	"github.com/LouisBrunner/mem-viz/pkg/peutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_ParseCertificates(t *testing.T) {
+	// The first entry is padded to 8 bytes
+	data := pack(t,
+		peutils.WinCertificate{Length: 8 + 5, Revision: 0x200, CertificateType: peutils.WIN_CERT_TYPE_PKCS_SIGNED_DATA}, [8]byte{},
+		peutils.WinCertificate{Length: 8 + 8, Revision: 0x200, CertificateType: 1}, [8]byte{},
+	)
+	tree, err := peutils.ParseCertificates(data, 0x1000)
+	require.NoError(t, err)
+	assert.Equal(t, "Certificate Table (2)", tree.Name)
+	assert.Equal(t, uintptr(0x1000), tree.Address)
+	require.Len(t, tree.Content, 2)
+
+	first := tree.Content[0]
+	assert.Equal(t, "Certificate (WIN_CERT_TYPE_PKCS_SIGNED_DATA)", first.Name)
+	assert.Equal(t, uint64(13), first.Size)
+	assert.Equal(t, "WIN_CERT_REVISION_2_0", contractstest.FindValue(t, first, "Revision").Value)
+	require.Len(t, first.Content, 1)
+	assert.Equal(t, "PKCS #7 SignedData", first.Content[0].Name)
+	assert.Equal(t, uint64(5), first.Content[0].Size)
+
+	second := tree.Content[1]
+	assert.Equal(t, "Certificate (WIN_CERT_TYPE_X509)", second.Name)
+	assert.Equal(t, uintptr(0x1010), second.Address)
+	require.Len(t, second.Content, 1)
+	assert.Equal(t, "Certificate Data", second.Content[0].Name)
+
+	_, err = peutils.ParseCertificates(data[:20], 0x1000)
+	assert.Error(t, err)
+}
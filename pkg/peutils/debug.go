@@ -0,0 +1,153 @@
+package peutils
+
+import (
+	"debug/pe"
+	"encoding/binary"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/LouisBrunner/mem-viz/pkg/contracts"
+	"github.com/LouisBrunner/mem-viz/pkg/parsingutils"
+)
+
+// IMAGE_DEBUG_DIRECTORY
+type DebugDirectory struct {
+	Characteristics  uint32
+	TimeDateStamp    uint32
+	MajorVersion     uint16
+	MinorVersion     uint16
+	Type             uint32
+	SizeOfData       uint32
+	AddressOfRawData uint32
+	PointerToRawData uint32
+}
+
+// CodeView information of PDB 7.0 files, followed by the path of the PDB
+type CodeViewRSDS struct {
+	Signature uint32
+	GUID      [16]byte
+	Age       uint32
+}
+
+// CodeView information of PDB 2.0 files, followed by the path of the PDB
+type CodeViewNB10 struct {
+	Signature uint32
+	Offset    uint32
+	Timestamp uint32
+	Age       uint32
+}
+
+const (
+	IMAGE_DEBUG_TYPE_CODEVIEW = 2
+
+	codeViewRSDS = 0x53445352
+	codeViewNB10 = 0x3031424e
+)
+
+var debugTypeNames = map[uint64]string{
+	0:                         "IMAGE_DEBUG_TYPE_UNKNOWN",
+	1:                         "IMAGE_DEBUG_TYPE_COFF",
+	IMAGE_DEBUG_TYPE_CODEVIEW: "IMAGE_DEBUG_TYPE_CODEVIEW",
+	3:                         "IMAGE_DEBUG_TYPE_FPO",
+	4:                         "IMAGE_DEBUG_TYPE_MISC",
+	5:                         "IMAGE_DEBUG_TYPE_EXCEPTION",
+	6:                         "IMAGE_DEBUG_TYPE_FIXUP",
+	7:                         "IMAGE_DEBUG_TYPE_OMAP_TO_SRC",
+	8:                         "IMAGE_DEBUG_TYPE_OMAP_FROM_SRC",
+	9:                         "IMAGE_DEBUG_TYPE_BORLAND",
+	10:                        "IMAGE_DEBUG_TYPE_RESERVED10",
+	11:                        "IMAGE_DEBUG_TYPE_CLSID",
+	12:                        "IMAGE_DEBUG_TYPE_VC_FEATURE",
+	13:                        "IMAGE_DEBUG_TYPE_POGO",
+	14:                        "IMAGE_DEBUG_TYPE_ILTCG",
+	15:                        "IMAGE_DEBUG_TYPE_MPX",
+	16:                        "IMAGE_DEBUG_TYPE_REPRO",
+	20:                        "IMAGE_DEBUG_TYPE_EX_DLLCHARACTERISTICS",
+}
+
+func shortDebugTypeName(typ uint32) string {
+	return strings.TrimPrefix(enumName(debugTypeNames, uint64(typ)), "IMAGE_DEBUG_TYPE_")
+}
+
+// Parses the debug directory (IMAGE_DIRECTORY_ENTRY_DEBUG) and the data of its entries, CodeView entries give the path of the PDB
+func ParseDebug(img Image, dir pe.DataDirectory) ([]*contracts.MemoryBlock, error) {
+	data, offset, err := img.read(dir.VirtualAddress, uint64(dir.Size))
+	if err != nil {
+		return nil, err
+	}
+	entrySize := uint64(binary.Size(DebugDirectory{}))
+	count := uint64(len(data)) / entrySize
+	out := newDecoded()
+	root := out.add(newBlock(fmt.Sprintf("Debug Directory (%d entries)", count), uintptr(offset), count*entrySize))
+
+	for i := uint64(0); i < count; i += 1 {
+		directory := DebugDirectory{}
+		entry, err := addStruct(root, data, &directory, fmt.Sprintf("Debug Entry %d", i), i*entrySize)
+		if err != nil {
+			return nil, err
+		}
+		typeName := shortDebugTypeName(directory.Type)
+		entry.Name = fmt.Sprintf("Debug Entry %d (%s)", i, typeName)
+		// Some entries are only mapped (e.g. in a section without raw data) and don't have a file offset
+		if directory.PointerToRawData == 0 || directory.SizeOfData == 0 {
+			continue
+		}
+		raw, err := subSlice(img.Data, uint64(directory.PointerToRawData), uint64(directory.SizeOfData))
+		if err != nil {
+			return nil, fmt.Errorf("data of debug entry %d is not inside the file: %w", i, err)
+		}
+		block, err := addDebugData(raw, uintptr(directory.PointerToRawData), directory.Type)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse debug entry %d (%s): %w", i, typeName, err)
+		}
+		block = out.add(block)
+		err = parsingutils.AddLinkWithBlock(entry, "PointerToRawData", block, "points to")
+		if err != nil {
+			return nil, err
+		}
+		err = parsingutils.AddLinkWithBlock(entry, "SizeOfData", block, "gives size")
+		if err != nil {
+			return nil, err
+		}
+	}
+	return out.blocks, nil
+}
+
+func addDebugData(data []byte, address uintptr, typ uint32) (*contracts.MemoryBlock, error) {
+	block := newBlock(fmt.Sprintf("Debug Data (%s)", shortDebugTypeName(typ)), address, uint64(len(data)))
+	if typ != IMAGE_DEBUG_TYPE_CODEVIEW || len(data) < 4 {
+		return block, nil
+	}
+
+	var raw any
+	switch binary.LittleEndian.Uint32(data) {
+	case codeViewRSDS:
+		raw = &CodeViewRSDS{}
+	case codeViewNB10:
+		raw = &CodeViewNB10{}
+	default:
+		return block, nil
+	}
+	err := ReadStruct(data, 0, raw)
+	if err != nil {
+		return nil, err
+	}
+	size := uint64(binary.Size(raw))
+	parsingutils.AddStructValues(block, raw, size, parsingutils.FormatValue)
+	block.Name = "CodeView"
+	if size == uint64(len(data)) {
+		return block, nil
+	}
+	path, err := ReadCString(data, size)
+	if err != nil {
+		return nil, err
+	}
+	// Reproducible builds (e.g. lld with /Brepro) can leave the path empty
+	if path == "" {
+		return block, nil
+	}
+	addChild(block, fmt.Sprintf("%q", path), size, min(uint64(len(path))+1, uint64(len(data))-size))
+	block.Name = fmt.Sprintf("CodeView (%s)", filepath.Base(strings.ReplaceAll(path, `\`, "/")))
+	return block, nil
+}
@@ -0,0 +1,44 @@
+package peutils_test
+
+import (
+	"debug/pe"
+	"testing"
+
+	"github.com/LouisBrunner/mem-viz/pkg/contracts"
+	"github.com/LouisBrunner/mem-viz/pkg/contracts/contractstest"
+	"github.com/LouisBrunner/mem-viz/pkg/peutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_ParseDebug(t *testing.T) {
+	section := make([]byte, 0x100)
+	copy(section[0x00:], pack(t,
+		peutils.DebugDirectory{Type: peutils.IMAGE_DEBUG_TYPE_CODEVIEW, SizeOfData: 24 + 17, AddressOfRawData: 0x1040, PointerToRawData: 0x240},
+		peutils.DebugDirectory{Type: 16},
+	))
+	copy(section[0x40:], pack(t, uint32(0x53445352), [16]byte{0x78, 0x56, 0x34, 0x12, 0x34, 0x12, 0x34, 0x12, 1, 2, 3, 4, 5, 6, 7, 8}, uint32(1), []byte(`C:\build\app.pdb`+"\x00")))
+	img := newImage(true, section)
+
+	blocks, err := peutils.ParseDebug(img, pe.DataDirectory{VirtualAddress: 0x1000, Size: 0x38})
+	require.NoError(t, err)
+	require.Len(t, blocks, 2)
+
+	root := blocks[0]
+	assert.Equal(t, "Debug Directory (2 entries)", root.Name)
+	require.Len(t, root.Content, 2)
+	assert.Equal(t, "Debug Entry 0 (CODEVIEW)", root.Content[0].Name)
+	assert.Equal(t, "IMAGE_DEBUG_TYPE_CODEVIEW", contractstest.FindValue(t, root.Content[0], "Type").Value)
+	assert.Equal(t, contracts.MemoryLink{Name: "points to", TargetAddress: 0x240}, *contractstest.FindValue(t, root.Content[0], "PointerToRawData").Links[0])
+	assert.Equal(t, "Debug Entry 1 (REPRO)", root.Content[1].Name)
+	assert.Len(t, contractstest.FindValue(t, root.Content[1], "PointerToRawData").Links, 0)
+
+	codeView := blocks[1]
+	assert.Equal(t, "CodeView (app.pdb)", codeView.Name)
+	assert.Equal(t, uintptr(0x240), codeView.Address)
+	assert.Equal(t, `"RSDS"`, contractstest.FindValue(t, codeView, "Signature").Value)
+	assert.Equal(t, "12345678-1234-1234-0102-030405060708", contractstest.FindValue(t, codeView, "GUID").Value)
+	require.Len(t, codeView.Content, 1)
+	assert.Equal(t, `"C:\\build\\app.pdb"`, codeView.Content[0].Name)
+	assert.Equal(t, uint64(17), codeView.Content[0].Size)
+}
@@ -0,0 +1,170 @@
+package peutils
+
+import (
+	"debug/pe"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/LouisBrunner/mem-viz/pkg/contracts"
+	"github.com/LouisBrunner/mem-viz/pkg/parsingutils"
+)
+
+// IMAGE_EXPORT_DIRECTORY
+type ExportDirectory struct {
+	Characteristics       uint32
+	TimeDateStamp         uint32
+	MajorVersion          uint16
+	MinorVersion          uint16
+	Name                  uint32
+	Base                  uint32
+	NumberOfFunctions     uint32
+	NumberOfNames         uint32
+	AddressOfFunctions    uint32
+	AddressOfNames        uint32
+	AddressOfNameOrdinals uint32
+}
+
+// Parses the export directory (IMAGE_DIRECTORY_ENTRY_EXPORT) with its address, name and ordinal tables,
+// the bounds of the directory are needed as exports pointing inside it are forwarded to another DLL
+func ParseExports(img Image, dir pe.DataDirectory) ([]*contracts.MemoryBlock, error) {
+	directory := ExportDirectory{}
+	data, offset, err := img.read(dir.VirtualAddress, uint64(binary.Size(directory)))
+	if err != nil {
+		return nil, err
+	}
+	out := newDecoded()
+	root, err := newStruct(data, &directory, "Export Directory", 0)
+	if err != nil {
+		return nil, err
+	}
+	root.Address = uintptr(offset)
+	out.add(root)
+
+	if directory.Name != 0 {
+		name, nameBlock, err := out.addString(img, directory.Name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the name of the exports: %w", err)
+		}
+		root.Name = fmt.Sprintf("Export Directory (%s)", name)
+		err = parsingutils.AddLinkWithBlock(root, "Name", nameBlock, "name")
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Names go first as the exports are named after them
+	names := make(map[uint32]string, directory.NumberOfNames)
+	if directory.NumberOfNames != 0 {
+		err = addExportNames(out, img, root, directory, names)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if directory.NumberOfFunctions == 0 {
+		return out.blocks, nil
+	}
+
+	functions, functionsOffset, err := img.read(directory.AddressOfFunctions, uint64(directory.NumberOfFunctions)*4)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the export address table: %w", err)
+	}
+	table := out.add(newBlock(fmt.Sprintf("Export Address Table (%d)", directory.NumberOfFunctions), uintptr(functionsOffset), uint64(len(functions))))
+	err = parsingutils.AddLinkWithBlock(root, "AddressOfFunctions", table, "points to")
+	if err != nil {
+		return nil, err
+	}
+	err = parsingutils.AddLinkWithBlock(root, "NumberOfFunctions", table, "gives amount")
+	if err != nil {
+		return nil, err
+	}
+	for i := uint32(0); i < directory.NumberOfFunctions; i += 1 {
+		address := binary.LittleEndian.Uint32(functions[i*4:])
+		label := fmt.Sprintf("Ordinal %d", directory.Base+i)
+		if name, found := names[i]; found {
+			label = name
+		}
+		entry := addChild(table, fmt.Sprintf("Export (%s)", label), uint64(i)*4, 4)
+		addValue(entry, "Address", address, 0, 4)
+		if address == 0 {
+			entry.Name = fmt.Sprintf("Unused (%s)", label)
+			continue
+		}
+
+		if dir.VirtualAddress <= address && address-dir.VirtualAddress < dir.Size {
+			forwarder, forwarderBlock, err := out.addString(img, address)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read the forwarder of export %s: %w", label, err)
+			}
+			entry.Name = fmt.Sprintf("Export (%s -> %s)", label, forwarder)
+			err = parsingutils.AddLinkWithBlock(entry, "Address", forwarderBlock, "refers to")
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if target, found := img.Offset(address); found {
+			err = parsingutils.AddLinkWithAddr(entry, "Address", "points to", target)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return out.blocks, nil
+}
+
+// Adds the name pointer and ordinal tables, names are returned by index in the export address table
+func addExportNames(out *decoded, img Image, root *contracts.MemoryBlock, directory ExportDirectory, names map[uint32]string) error {
+	count := directory.NumberOfNames
+	pointers, pointersOffset, err := img.read(directory.AddressOfNames, uint64(count)*4)
+	if err != nil {
+		return fmt.Errorf("failed to read the export name pointers: %w", err)
+	}
+	ordinals, ordinalsOffset, err := img.read(directory.AddressOfNameOrdinals, uint64(count)*2)
+	if err != nil {
+		return fmt.Errorf("failed to read the export ordinals: %w", err)
+	}
+	pointersTable := out.add(newBlock(fmt.Sprintf("Export Name Pointers (%d)", count), uintptr(pointersOffset), uint64(len(pointers))))
+	ordinalsTable := out.add(newBlock(fmt.Sprintf("Export Ordinals (%d)", count), uintptr(ordinalsOffset), uint64(len(ordinals))))
+	for _, link := range []struct {
+		value  string
+		target *contracts.MemoryBlock
+		name   string
+	}{
+		{"AddressOfNames", pointersTable, "points to"},
+		{"NumberOfNames", pointersTable, "gives amount"},
+		{"AddressOfNameOrdinals", ordinalsTable, "points to"},
+	} {
+		err = parsingutils.AddLinkWithBlock(root, link.value, link.target, link.name)
+		if err != nil {
+			return err
+		}
+	}
+
+	for i := uint32(0); i < count; i += 1 {
+		nameRVA := binary.LittleEndian.Uint32(pointers[i*4:])
+		index := binary.LittleEndian.Uint16(ordinals[i*2:])
+		name, nameBlock, err := out.addString(img, nameRVA)
+		if err != nil {
+			return fmt.Errorf("failed to read the name of export %d: %w", i, err)
+		}
+		names[uint32(index)] = name
+
+		pointer := addChild(pointersTable, fmt.Sprintf("Name (%s)", name), uint64(i)*4, 4)
+		addValue(pointer, "Address", nameRVA, 0, 4)
+		err = parsingutils.AddLinkWithBlock(pointer, "Address", nameBlock, "name")
+		if err != nil {
+			return err
+		}
+		ordinal := addChild(ordinalsTable, fmt.Sprintf("Ordinal (%s)", name), uint64(i)*2, 2)
+		addValue(ordinal, "Index", index, 0, 2)
+		if uint32(index) < directory.NumberOfFunctions {
+			if target, found := img.Offset(directory.AddressOfFunctions + uint32(index)*4); found {
+				err = parsingutils.AddLinkWithAddr(ordinal, "Index", "refers to", target)
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
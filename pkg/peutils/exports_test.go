@@ -0,0 +1,65 @@
+package peutils_test
+
+import (
+	"debug/pe"
+	"testing"
+
+	"github.com/LouisBrunner/mem-viz/pkg/contracts"
+	"github.com/LouisBrunner/mem-viz/pkg/contracts/contractstest"
+	"github.com/LouisBrunner/mem-viz/pkg/peutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_ParseExports(t *testing.T) {
+	section := make([]byte, 0x100)
+	copy(section[0x00:], pack(t, peutils.ExportDirectory{
+		Name:                  0x10a0,
+		Base:                  1,
+		NumberOfFunctions:     3,
+		NumberOfNames:         2,
+		AddressOfFunctions:    0x1040,
+		AddressOfNames:        0x1050,
+		AddressOfNameOrdinals: 0x1058,
+	}))
+	// The last export is forwarded as it points inside the directory
+	copy(section[0x40:], pack(t, uint32(0x10f0), uint32(0), uint32(0x10c0)))
+	copy(section[0x50:], pack(t, uint32(0x10b0), uint32(0x10b8)))
+	copy(section[0x58:], pack(t, uint16(0), uint16(2)))
+	copy(section[0xa0:], "test.dll\x00")
+	copy(section[0xb0:], "first\x00")
+	copy(section[0xb8:], "fwd\x00")
+	copy(section[0xc0:], "other.real\x00")
+	img := newImage(false, section)
+
+	blocks, err := peutils.ParseExports(img, pe.DataDirectory{VirtualAddress: 0x1000, Size: 0xd0})
+	require.NoError(t, err)
+
+	root := contractstest.FindBlock(t, blocks, "Export Directory (test.dll)")
+	assert.Equal(t, uintptr(0x200), root.Address)
+	assert.Equal(t, uint64(0x2a0), contractstest.FindValue(t, root, "Name").Links[0].TargetAddress)
+
+	functions := contractstest.FindBlock(t, blocks, "Export Address Table (3)")
+	assert.Equal(t, uintptr(0x240), functions.Address)
+	require.Len(t, functions.Content, 3)
+	assert.Equal(t, "Export (first)", functions.Content[0].Name)
+	assert.Equal(t, contracts.MemoryLink{Name: "points to", TargetAddress: 0x2f0}, *contractstest.FindValue(t, functions.Content[0], "Address").Links[0])
+	assert.Equal(t, "Unused (Ordinal 2)", functions.Content[1].Name)
+	assert.Equal(t, "Export (fwd -> other.real)", functions.Content[2].Name)
+	assert.Equal(t, contracts.MemoryLink{Name: "refers to", TargetAddress: 0x2c0}, *contractstest.FindValue(t, functions.Content[2], "Address").Links[0])
+
+	pointers := contractstest.FindBlock(t, blocks, "Export Name Pointers (2)")
+	require.Len(t, pointers.Content, 2)
+	assert.Equal(t, "Name (first)", pointers.Content[0].Name)
+	assert.Equal(t, uint64(0x2b0), contractstest.FindValue(t, pointers.Content[0], "Address").Links[0].TargetAddress)
+	ordinals := contractstest.FindBlock(t, blocks, "Export Ordinals (2)")
+	require.Len(t, ordinals.Content, 2)
+	assert.Equal(t, "Ordinal (fwd)", ordinals.Content[1].Name)
+	assert.Equal(t, uint64(0x248), contractstest.FindValue(t, ordinals.Content[1], "Index").Links[0].TargetAddress)
+}
+
+func Test_ParseExports_outOfBounds(t *testing.T) {
+	section := pack(t, peutils.ExportDirectory{NumberOfFunctions: 0x100, AddressOfFunctions: 0x1000})
+	_, err := peutils.ParseExports(newImage(false, section), pe.DataDirectory{VirtualAddress: 0x1000, Size: 0x28})
+	assert.Error(t, err)
+}
@@ -0,0 +1,251 @@
+package peutils
+
+import (
+	"debug/pe"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/LouisBrunner/mem-viz/pkg/commons"
+	"github.com/LouisBrunner/mem-viz/pkg/parsingutils"
+	"golang.org/x/exp/maps"
+)
+
+// debug/pe only has the raw constants, so these tables give them their names back
+
+var machineNames = map[uint64]string{
+	pe.IMAGE_FILE_MACHINE_UNKNOWN:     "IMAGE_FILE_MACHINE_UNKNOWN",
+	pe.IMAGE_FILE_MACHINE_I386:        "IMAGE_FILE_MACHINE_I386",
+	pe.IMAGE_FILE_MACHINE_AMD64:       "IMAGE_FILE_MACHINE_AMD64",
+	pe.IMAGE_FILE_MACHINE_ARM:         "IMAGE_FILE_MACHINE_ARM",
+	pe.IMAGE_FILE_MACHINE_ARMNT:       "IMAGE_FILE_MACHINE_ARMNT",
+	pe.IMAGE_FILE_MACHINE_ARM64:       "IMAGE_FILE_MACHINE_ARM64",
+	0xa641:                            "IMAGE_FILE_MACHINE_ARM64EC",
+	pe.IMAGE_FILE_MACHINE_IA64:        "IMAGE_FILE_MACHINE_IA64",
+	pe.IMAGE_FILE_MACHINE_EBC:         "IMAGE_FILE_MACHINE_EBC",
+	pe.IMAGE_FILE_MACHINE_R4000:       "IMAGE_FILE_MACHINE_R4000",
+	pe.IMAGE_FILE_MACHINE_POWERPC:     "IMAGE_FILE_MACHINE_POWERPC",
+	pe.IMAGE_FILE_MACHINE_RISCV32:     "IMAGE_FILE_MACHINE_RISCV32",
+	pe.IMAGE_FILE_MACHINE_RISCV64:     "IMAGE_FILE_MACHINE_RISCV64",
+	pe.IMAGE_FILE_MACHINE_RISCV128:    "IMAGE_FILE_MACHINE_RISCV128",
+	pe.IMAGE_FILE_MACHINE_LOONGARCH32: "IMAGE_FILE_MACHINE_LOONGARCH32",
+	pe.IMAGE_FILE_MACHINE_LOONGARCH64: "IMAGE_FILE_MACHINE_LOONGARCH64",
+}
+
+var fileCharacteristicNames = map[uint64]string{
+	pe.IMAGE_FILE_RELOCS_STRIPPED:         "IMAGE_FILE_RELOCS_STRIPPED",
+	pe.IMAGE_FILE_EXECUTABLE_IMAGE:        "IMAGE_FILE_EXECUTABLE_IMAGE",
+	pe.IMAGE_FILE_LINE_NUMS_STRIPPED:      "IMAGE_FILE_LINE_NUMS_STRIPPED",
+	pe.IMAGE_FILE_LOCAL_SYMS_STRIPPED:     "IMAGE_FILE_LOCAL_SYMS_STRIPPED",
+	pe.IMAGE_FILE_AGGRESIVE_WS_TRIM:       "IMAGE_FILE_AGGRESIVE_WS_TRIM",
+	pe.IMAGE_FILE_LARGE_ADDRESS_AWARE:     "IMAGE_FILE_LARGE_ADDRESS_AWARE",
+	pe.IMAGE_FILE_BYTES_REVERSED_LO:       "IMAGE_FILE_BYTES_REVERSED_LO",
+	pe.IMAGE_FILE_32BIT_MACHINE:           "IMAGE_FILE_32BIT_MACHINE",
+	pe.IMAGE_FILE_DEBUG_STRIPPED:          "IMAGE_FILE_DEBUG_STRIPPED",
+	pe.IMAGE_FILE_REMOVABLE_RUN_FROM_SWAP: "IMAGE_FILE_REMOVABLE_RUN_FROM_SWAP",
+	pe.IMAGE_FILE_NET_RUN_FROM_SWAP:       "IMAGE_FILE_NET_RUN_FROM_SWAP",
+	pe.IMAGE_FILE_SYSTEM:                  "IMAGE_FILE_SYSTEM",
+	pe.IMAGE_FILE_DLL:                     "IMAGE_FILE_DLL",
+	pe.IMAGE_FILE_UP_SYSTEM_ONLY:          "IMAGE_FILE_UP_SYSTEM_ONLY",
+	pe.IMAGE_FILE_BYTES_REVERSED_HI:       "IMAGE_FILE_BYTES_REVERSED_HI",
+}
+
+var subsystemNames = map[uint64]string{
+	pe.IMAGE_SUBSYSTEM_UNKNOWN:                  "IMAGE_SUBSYSTEM_UNKNOWN",
+	pe.IMAGE_SUBSYSTEM_NATIVE:                   "IMAGE_SUBSYSTEM_NATIVE",
+	pe.IMAGE_SUBSYSTEM_WINDOWS_GUI:              "IMAGE_SUBSYSTEM_WINDOWS_GUI",
+	pe.IMAGE_SUBSYSTEM_WINDOWS_CUI:              "IMAGE_SUBSYSTEM_WINDOWS_CUI",
+	pe.IMAGE_SUBSYSTEM_OS2_CUI:                  "IMAGE_SUBSYSTEM_OS2_CUI",
+	pe.IMAGE_SUBSYSTEM_POSIX_CUI:                "IMAGE_SUBSYSTEM_POSIX_CUI",
+	pe.IMAGE_SUBSYSTEM_NATIVE_WINDOWS:           "IMAGE_SUBSYSTEM_NATIVE_WINDOWS",
+	pe.IMAGE_SUBSYSTEM_WINDOWS_CE_GUI:           "IMAGE_SUBSYSTEM_WINDOWS_CE_GUI",
+	pe.IMAGE_SUBSYSTEM_EFI_APPLICATION:          "IMAGE_SUBSYSTEM_EFI_APPLICATION",
+	pe.IMAGE_SUBSYSTEM_EFI_BOOT_SERVICE_DRIVER:  "IMAGE_SUBSYSTEM_EFI_BOOT_SERVICE_DRIVER",
+	pe.IMAGE_SUBSYSTEM_EFI_RUNTIME_DRIVER:       "IMAGE_SUBSYSTEM_EFI_RUNTIME_DRIVER",
+	pe.IMAGE_SUBSYSTEM_EFI_ROM:                  "IMAGE_SUBSYSTEM_EFI_ROM",
+	pe.IMAGE_SUBSYSTEM_XBOX:                     "IMAGE_SUBSYSTEM_XBOX",
+	pe.IMAGE_SUBSYSTEM_WINDOWS_BOOT_APPLICATION: "IMAGE_SUBSYSTEM_WINDOWS_BOOT_APPLICATION",
+}
+
+var dllCharacteristicNames = map[uint64]string{
+	pe.IMAGE_DLLCHARACTERISTICS_HIGH_ENTROPY_VA:       "IMAGE_DLLCHARACTERISTICS_HIGH_ENTROPY_VA",
+	pe.IMAGE_DLLCHARACTERISTICS_DYNAMIC_BASE:          "IMAGE_DLLCHARACTERISTICS_DYNAMIC_BASE",
+	pe.IMAGE_DLLCHARACTERISTICS_FORCE_INTEGRITY:       "IMAGE_DLLCHARACTERISTICS_FORCE_INTEGRITY",
+	pe.IMAGE_DLLCHARACTERISTICS_NX_COMPAT:             "IMAGE_DLLCHARACTERISTICS_NX_COMPAT",
+	pe.IMAGE_DLLCHARACTERISTICS_NO_ISOLATION:          "IMAGE_DLLCHARACTERISTICS_NO_ISOLATION",
+	pe.IMAGE_DLLCHARACTERISTICS_NO_SEH:                "IMAGE_DLLCHARACTERISTICS_NO_SEH",
+	pe.IMAGE_DLLCHARACTERISTICS_NO_BIND:               "IMAGE_DLLCHARACTERISTICS_NO_BIND",
+	pe.IMAGE_DLLCHARACTERISTICS_APPCONTAINER:          "IMAGE_DLLCHARACTERISTICS_APPCONTAINER",
+	pe.IMAGE_DLLCHARACTERISTICS_WDM_DRIVER:            "IMAGE_DLLCHARACTERISTICS_WDM_DRIVER",
+	pe.IMAGE_DLLCHARACTERISTICS_GUARD_CF:              "IMAGE_DLLCHARACTERISTICS_GUARD_CF",
+	pe.IMAGE_DLLCHARACTERISTICS_TERMINAL_SERVER_AWARE: "IMAGE_DLLCHARACTERISTICS_TERMINAL_SERVER_AWARE",
+}
+
+var sectionCharacteristicNames = map[uint64]string{
+	0x00000008:                          "IMAGE_SCN_TYPE_NO_PAD",
+	pe.IMAGE_SCN_CNT_CODE:               "IMAGE_SCN_CNT_CODE",
+	pe.IMAGE_SCN_CNT_INITIALIZED_DATA:   "IMAGE_SCN_CNT_INITIALIZED_DATA",
+	pe.IMAGE_SCN_CNT_UNINITIALIZED_DATA: "IMAGE_SCN_CNT_UNINITIALIZED_DATA",
+	0x00000100:                          "IMAGE_SCN_LNK_OTHER",
+	0x00000200:                          "IMAGE_SCN_LNK_INFO",
+	0x00000800:                          "IMAGE_SCN_LNK_REMOVE",
+	pe.IMAGE_SCN_LNK_COMDAT:             "IMAGE_SCN_LNK_COMDAT",
+	0x00008000:                          "IMAGE_SCN_GPREL",
+	0x01000000:                          "IMAGE_SCN_LNK_NRELOC_OVFL",
+	pe.IMAGE_SCN_MEM_DISCARDABLE:        "IMAGE_SCN_MEM_DISCARDABLE",
+	0x04000000:                          "IMAGE_SCN_MEM_NOT_CACHED",
+	0x08000000:                          "IMAGE_SCN_MEM_NOT_PAGED",
+	0x10000000:                          "IMAGE_SCN_MEM_SHARED",
+	pe.IMAGE_SCN_MEM_EXECUTE:            "IMAGE_SCN_MEM_EXECUTE",
+	pe.IMAGE_SCN_MEM_READ:               "IMAGE_SCN_MEM_READ",
+	pe.IMAGE_SCN_MEM_WRITE:              "IMAGE_SCN_MEM_WRITE",
+}
+
+// Section alignment is a 4-bit field (IMAGE_SCN_ALIGN_1BYTES to IMAGE_SCN_ALIGN_8192BYTES) amongst the flags
+const sectionAlignMask = 0x00f00000
+
+var directoryNames = []string{
+	pe.IMAGE_DIRECTORY_ENTRY_EXPORT:         "Export Table",
+	pe.IMAGE_DIRECTORY_ENTRY_IMPORT:         "Import Table",
+	pe.IMAGE_DIRECTORY_ENTRY_RESOURCE:       "Resource Table",
+	pe.IMAGE_DIRECTORY_ENTRY_EXCEPTION:      "Exception Table",
+	pe.IMAGE_DIRECTORY_ENTRY_SECURITY:       "Certificate Table",
+	pe.IMAGE_DIRECTORY_ENTRY_BASERELOC:      "Base Relocation Table",
+	pe.IMAGE_DIRECTORY_ENTRY_DEBUG:          "Debug",
+	pe.IMAGE_DIRECTORY_ENTRY_ARCHITECTURE:   "Architecture",
+	pe.IMAGE_DIRECTORY_ENTRY_GLOBALPTR:      "Global Ptr",
+	pe.IMAGE_DIRECTORY_ENTRY_TLS:            "TLS Table",
+	pe.IMAGE_DIRECTORY_ENTRY_LOAD_CONFIG:    "Load Config Table",
+	pe.IMAGE_DIRECTORY_ENTRY_BOUND_IMPORT:   "Bound Import",
+	pe.IMAGE_DIRECTORY_ENTRY_IAT:            "IAT",
+	pe.IMAGE_DIRECTORY_ENTRY_DELAY_IMPORT:   "Delay Import Descriptor",
+	pe.IMAGE_DIRECTORY_ENTRY_COM_DESCRIPTOR: "CLR Runtime Header",
+	15:                                      "Reserved",
+}
+
+func DirectoryName(index int) string {
+	if index < len(directoryNames) {
+		return directoryNames[index]
+	}
+	return fmt.Sprintf("Directory %d", index)
+}
+
+func enumName(names map[uint64]string, value uint64) string {
+	if name, found := names[value]; found {
+		return name
+	}
+	return fmt.Sprintf("%#x", value)
+}
+
+// Same layout as the flags of debug/elf (e.g. "SHF_WRITE+SHF_ALLOC"), unknown bits are shown as a number at the end
+func flagsName(names map[uint64]string, value uint64) string {
+	if value == 0 {
+		return "0x0"
+	}
+	bits := maps.Keys(names)
+	sort.Slice(bits, func(i, j int) bool { return bits[i] < bits[j] })
+	parts := []string{}
+	for _, bit := range bits {
+		if value&bit != 0 {
+			parts = append(parts, names[bit])
+			value &^= bit
+		}
+	}
+	if value != 0 {
+		parts = append(parts, fmt.Sprintf("%#x", value))
+	}
+	return strings.Join(parts, "+")
+}
+
+func FormatMachine(machine uint16) string {
+	return enumName(machineNames, uint64(machine))
+}
+
+func FormatSectionCharacteristics(flags uint32) string {
+	align := (flags & sectionAlignMask) >> 20
+	name := flagsName(sectionCharacteristicNames, uint64(flags&^sectionAlignMask))
+	if align == 0 {
+		return name
+	}
+	alignName := fmt.Sprintf("IMAGE_SCN_ALIGN_%dBYTES", 1<<(align-1))
+	if name == "0x0" {
+		return alignName
+	}
+	return name + "+" + alignName
+}
+
+func formatOptionalMagic(magic uint64) string {
+	switch magic {
+	case 0x10b:
+		return "PE32"
+	case 0x20b:
+		return "PE32+"
+	case 0x107:
+		return "ROM"
+	}
+	return fmt.Sprintf("%#x", magic)
+}
+
+// Signatures like "MZ" or "RSDS" are stored as little-endian integers
+func formatFourCC(value uint64, size int) string {
+	raw := make([]byte, size)
+	for i := range raw {
+		raw[i] = byte(value >> (8 * i))
+	}
+	return fmt.Sprintf("%q", raw)
+}
+
+// GUIDs start with 3 little-endian integers, unlike UUIDs
+func FormatGUID(guid [16]byte) string {
+	return fmt.Sprintf(
+		"%02x%02x%02x%02x-%02x%02x-%02x%02x-%02x%02x-%02x%02x%02x%02x%02x%02x",
+		guid[3], guid[2], guid[1], guid[0], guid[5], guid[4], guid[7], guid[6],
+		guid[8], guid[9], guid[10], guid[11], guid[12], guid[13], guid[14], guid[15],
+	)
+}
+
+func tableFormat(names map[uint64]string) parsingutils.FieldFormat {
+	return parsingutils.IntegerFormat(func(value uint64) string { return enumName(names, value) })
+}
+
+func flagsFormat(names map[uint64]string) parsingutils.FieldFormat {
+	return parsingutils.IntegerFormat(func(value uint64) string { return flagsName(names, value) })
+}
+
+var (
+	sectionNameFormat = func(value interface{}) (string, bool) {
+		name, ok := value.([8]uint8)
+		if !ok {
+			return "", false
+		}
+		return fmt.Sprintf("%q", commons.FromCString(name[:])), true
+	}
+	guidFormat = func(value interface{}) (string, bool) {
+		guid, ok := value.([16]byte)
+		if !ok {
+			return "", false
+		}
+		return FormatGUID(guid), true
+	}
+)
+
+func init() {
+	parsingutils.RegisterFieldFormat(DOSHeader{}, "Magic", parsingutils.IntegerFormat(func(value uint64) string { return formatFourCC(value, 2) }))
+	parsingutils.RegisterFieldFormat(pe.FileHeader{}, "Machine", tableFormat(machineNames))
+	parsingutils.RegisterFieldFormat(pe.FileHeader{}, "Characteristics", flagsFormat(fileCharacteristicNames))
+	for _, header := range []any{OptionalHeader32{}, OptionalHeader64{}} {
+		parsingutils.RegisterFieldFormat(header, "Magic", parsingutils.IntegerFormat(formatOptionalMagic))
+		parsingutils.RegisterFieldFormat(header, "Subsystem", tableFormat(subsystemNames))
+		parsingutils.RegisterFieldFormat(header, "DllCharacteristics", flagsFormat(dllCharacteristicNames))
+	}
+	parsingutils.RegisterFieldFormat(pe.SectionHeader32{}, "Name", sectionNameFormat)
+	parsingutils.RegisterFieldFormat(pe.SectionHeader32{}, "Characteristics", parsingutils.IntegerFormat(func(value uint64) string {
+		return FormatSectionCharacteristics(uint32(value))
+	}))
+	parsingutils.RegisterFieldFormat(DebugDirectory{}, "Type", tableFormat(debugTypeNames))
+	parsingutils.RegisterFieldFormat(CodeViewRSDS{}, "Signature", parsingutils.IntegerFormat(func(value uint64) string { return formatFourCC(value, 4) }))
+	parsingutils.RegisterFieldFormat(CodeViewRSDS{}, "GUID", guidFormat)
+	parsingutils.RegisterFieldFormat(CodeViewNB10{}, "Signature", parsingutils.IntegerFormat(func(value uint64) string { return formatFourCC(value, 4) }))
+	parsingutils.RegisterFieldFormat(WinCertificate{}, "Revision", tableFormat(certificateRevisionNames))
+	parsingutils.RegisterFieldFormat(WinCertificate{}, "CertificateType", tableFormat(certificateTypeNames))
+}
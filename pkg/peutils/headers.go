@@ -0,0 +1,236 @@
+package peutils
+
+import (
+	"debug/pe"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/LouisBrunner/mem-viz/pkg/contracts"
+	"github.com/LouisBrunner/mem-viz/pkg/parsingutils"
+)
+
+// IMAGE_DOS_HEADER
+type DOSHeader struct {
+	Magic    uint16
+	Cblp     uint16
+	Cp       uint16
+	Crlc     uint16
+	Cparhdr  uint16
+	Minalloc uint16
+	Maxalloc uint16
+	Ss       uint16
+	Sp       uint16
+	Csum     uint16
+	Ip       uint16
+	Cs       uint16
+	Lfarlc   uint16
+	Ovno     uint16
+	Res      [4]uint16
+	Oemid    uint16
+	Oeminfo  uint16
+	Res2     [10]uint16
+	Lfanew   uint32
+}
+
+const (
+	DOSMagic = 0x5a4d
+	// "PE\0\0"
+	NTSignature = 0x4550
+)
+
+// Same as pe.OptionalHeader32 without the data directories (their amount varies, so they are decoded separately)
+type OptionalHeader32 struct {
+	Magic                       uint16
+	MajorLinkerVersion          uint8
+	MinorLinkerVersion          uint8
+	SizeOfCode                  uint32
+	SizeOfInitializedData       uint32
+	SizeOfUninitializedData     uint32
+	AddressOfEntryPoint         uint32
+	BaseOfCode                  uint32
+	BaseOfData                  uint32
+	ImageBase                   uint32
+	SectionAlignment            uint32
+	FileAlignment               uint32
+	MajorOperatingSystemVersion uint16
+	MinorOperatingSystemVersion uint16
+	MajorImageVersion           uint16
+	MinorImageVersion           uint16
+	MajorSubsystemVersion       uint16
+	MinorSubsystemVersion       uint16
+	Win32VersionValue           uint32
+	SizeOfImage                 uint32
+	SizeOfHeaders               uint32
+	CheckSum                    uint32
+	Subsystem                   uint16
+	DllCharacteristics          uint16
+	SizeOfStackReserve          uint32
+	SizeOfStackCommit           uint32
+	SizeOfHeapReserve           uint32
+	SizeOfHeapCommit            uint32
+	LoaderFlags                 uint32
+	NumberOfRvaAndSizes         uint32
+}
+
+// Same as pe.OptionalHeader64 without the data directories
+type OptionalHeader64 struct {
+	Magic                       uint16
+	MajorLinkerVersion          uint8
+	MinorLinkerVersion          uint8
+	SizeOfCode                  uint32
+	SizeOfInitializedData       uint32
+	SizeOfUninitializedData     uint32
+	AddressOfEntryPoint         uint32
+	BaseOfCode                  uint32
+	ImageBase                   uint64
+	SectionAlignment            uint32
+	FileAlignment               uint32
+	MajorOperatingSystemVersion uint16
+	MinorOperatingSystemVersion uint16
+	MajorImageVersion           uint16
+	MinorImageVersion           uint16
+	MajorSubsystemVersion       uint16
+	MinorSubsystemVersion       uint16
+	Win32VersionValue           uint32
+	SizeOfImage                 uint32
+	SizeOfHeaders               uint32
+	CheckSum                    uint32
+	Subsystem                   uint16
+	DllCharacteristics          uint16
+	SizeOfStackReserve          uint64
+	SizeOfStackCommit           uint64
+	SizeOfHeapReserve           uint64
+	SizeOfHeapCommit            uint64
+	LoaderFlags                 uint32
+	NumberOfRvaAndSizes         uint32
+}
+
+// Parses the MS-DOS header at the start of data, e_lfanew is linked to the NT headers
+func ParseDOSHeader(data []byte, address uintptr) (*contracts.MemoryBlock, DOSHeader, error) {
+	header := DOSHeader{}
+	block, err := newStruct(data, &header, "DOS Header", 0)
+	if err != nil {
+		return nil, DOSHeader{}, err
+	}
+	if header.Magic != DOSMagic {
+		return nil, DOSHeader{}, fmt.Errorf("invalid DOS magic %#x", header.Magic)
+	}
+	block.Address = address
+	err = parsingutils.AddLinkWithAddr(block, "Lfanew", "points to", address+uintptr(header.Lfanew))
+	if err != nil {
+		return nil, DOSHeader{}, err
+	}
+	return block, header, nil
+}
+
+// Parses the NT headers (signature, file header and optional header with its data directories) at offset in the image,
+// data directories are linked to their table and to the section containing it
+func ParseNTHeaders(img Image, offset uint64) (*contracts.MemoryBlock, error) {
+	if offset > uint64(len(img.Data)) {
+		return nil, fmt.Errorf("NT Headers are out of bounds: %#x > %#x", offset, len(img.Data))
+	}
+	data := img.Data[offset:]
+	signature, err := subSlice(data, 0, 4)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse NT Headers: %w", err)
+	}
+	if binary.LittleEndian.Uint32(signature) != NTSignature {
+		return nil, fmt.Errorf("invalid NT signature %q", signature)
+	}
+
+	fileHeader := pe.FileHeader{}
+	err = ReadStruct(data, 4, &fileHeader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse File Header: %w", err)
+	}
+	fileHeaderSize := uint64(binary.Size(fileHeader))
+	root := newBlock("NT Headers", uintptr(offset), 4+fileHeaderSize+uint64(fileHeader.SizeOfOptionalHeader))
+	parsingutils.AddValue(root, "Signature", binary.LittleEndian.Uint32(signature), 0, 4, func(name string, value interface{}) string {
+		return formatFourCC(uint64(value.(uint32)), 4)
+	})
+	_, err = addStruct(root, data, &fileHeader, "File Header", 4)
+	if err != nil {
+		return nil, err
+	}
+	if fileHeader.SizeOfOptionalHeader == 0 {
+		return root, nil
+	}
+	err = addOptionalHeader(root, img, data, 4+fileHeaderSize, uint64(fileHeader.SizeOfOptionalHeader))
+	if err != nil {
+		return nil, err
+	}
+	return root, nil
+}
+
+func addOptionalHeader(root *contracts.MemoryBlock, img Image, data []byte, offset, size uint64) error {
+	data, err := subSlice(data, offset, size)
+	if err != nil {
+		return fmt.Errorf("failed to parse Optional Header: %w", err)
+	}
+	var raw any = &OptionalHeader32{}
+	if img.Is64 {
+		raw = &OptionalHeader64{}
+	}
+	err = ReadStruct(data, 0, raw)
+	if err != nil {
+		return fmt.Errorf("failed to parse Optional Header: %w", err)
+	}
+	var magic uint16
+	var entry, count uint32
+	switch raw := raw.(type) {
+	case *OptionalHeader32:
+		magic, entry, count = raw.Magic, raw.AddressOfEntryPoint, raw.NumberOfRvaAndSizes
+	case *OptionalHeader64:
+		magic, entry, count = raw.Magic, raw.AddressOfEntryPoint, raw.NumberOfRvaAndSizes
+	}
+	fixedSize := uint64(binary.Size(raw))
+	optional := addChild(root, fmt.Sprintf("Optional Header (%s)", formatOptionalMagic(uint64(magic))), offset, size)
+	parsingutils.AddStructValues(optional, raw, fixedSize, parsingutils.FormatValue)
+	if target, found := img.Offset(entry); found && entry != 0 {
+		err = parsingutils.AddLinkWithAddr(optional, "AddressOfEntryPoint", "starts at", target)
+		if err != nil {
+			return err
+		}
+	}
+
+	entrySize := uint64(binary.Size(pe.DataDirectory{}))
+	count = uint32(min(uint64(count), (size-fixedSize)/entrySize))
+	if count == 0 {
+		return nil
+	}
+	directories := addChild(optional, fmt.Sprintf("Data Directories (%d)", count), fixedSize, uint64(count)*entrySize)
+	for i := uint32(0); i < count; i += 1 {
+		dir := pe.DataDirectory{}
+		entry, err := addStruct(directories, data[fixedSize:], &dir, fmt.Sprintf("Data Directory %d (%s)", i, DirectoryName(int(i))), uint64(i)*entrySize)
+		if err != nil {
+			return err
+		}
+		err = linkDirectory(entry, img, int(i), dir)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func linkDirectory(entry *contracts.MemoryBlock, img Image, index int, dir pe.DataDirectory) error {
+	if dir.VirtualAddress == 0 || dir.Size == 0 {
+		return nil
+	}
+	// The certificate table isn't loaded, so it is given by its file offset
+	if index == pe.IMAGE_DIRECTORY_ENTRY_SECURITY {
+		return parsingutils.AddLinkWithAddr(entry, "VirtualAddress", "points to", uintptr(dir.VirtualAddress))
+	}
+	target, found := img.Offset(dir.VirtualAddress)
+	if !found {
+		return nil
+	}
+	err := parsingutils.AddLinkWithAddr(entry, "VirtualAddress", "points to", target)
+	if err != nil {
+		return err
+	}
+	if sect, found := img.Section(dir.VirtualAddress); found {
+		return parsingutils.AddLinkWithAddr(entry, "VirtualAddress", "is in", uintptr(sect.PointerToRawData))
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package peutils_test
+
+import (
+	"bytes"
+	"debug/pe"
+	"encoding/binary"
+	"testing"
+
+	"github.com/LouisBrunner/mem-viz/pkg/contracts"
+	"github.com/LouisBrunner/mem-viz/pkg/contracts/contractstest"
+	"github.com/LouisBrunner/mem-viz/pkg/peutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func pack(t *testing.T, values ...any) []byte {
+	buf := &bytes.Buffer{}
+	for _, value := range values {
+		require.NoError(t, binary.Write(buf, binary.LittleEndian, value))
+	}
+	return buf.Bytes()
+}
+
+// The headers take the first 0x200 bytes, then a single section is mapped at RVA 0x1000
+func newImage(is64 bool, section []byte) peutils.Image {
+	return peutils.Image{
+		Data:          append(make([]byte, 0x200), section...),
+		Is64:          is64,
+		Machine:       pe.IMAGE_FILE_MACHINE_AMD64,
+		ImageBase:     0x400000,
+		SizeOfHeaders: 0x200,
+		Sections: []peutils.Section{
+			{Name: ".rdata", VirtualAddress: 0x1000, VirtualSize: uint32(len(section)), PointerToRawData: 0x200, SizeOfRawData: uint32(len(section))},
+		},
+	}
+}
+
+func Test_ParseDOSHeader(t *testing.T) {
+	data := pack(t, peutils.DOSHeader{Magic: peutils.DOSMagic, Lfanew: 0x80})
+	block, header, err := peutils.ParseDOSHeader(data, 0)
+	require.NoError(t, err)
+	assert.Equal(t, "DOS Header", block.Name)
+	assert.Equal(t, uint64(64), block.Size)
+	assert.Equal(t, uint32(0x80), header.Lfanew)
+	assert.Equal(t, `"MZ"`, contractstest.FindValue(t, block, "Magic").Value)
+	require.Len(t, contractstest.FindValue(t, block, "Lfanew").Links, 1)
+	assert.Equal(t, uint64(0x80), contractstest.FindValue(t, block, "Lfanew").Links[0].TargetAddress)
+
+	_, _, err = peutils.ParseDOSHeader(make([]byte, 64), 0)
+	assert.Error(t, err)
+	_, _, err = peutils.ParseDOSHeader(data[:10], 0)
+	assert.Error(t, err)
+}
+
+func Test_ParseNTHeaders(t *testing.T) {
+	directories := [16]pe.DataDirectory{}
+	directories[pe.IMAGE_DIRECTORY_ENTRY_IMPORT] = pe.DataDirectory{VirtualAddress: 0x1010, Size: 0x28}
+	directories[pe.IMAGE_DIRECTORY_ENTRY_SECURITY] = pe.DataDirectory{VirtualAddress: 0x400, Size: 0x10}
+	optional := peutils.OptionalHeader64{Magic: 0x20b, AddressOfEntryPoint: 0x1004, NumberOfRvaAndSizes: 16, Subsystem: pe.IMAGE_SUBSYSTEM_WINDOWS_CUI}
+	optionalSize := binary.Size(optional) + binary.Size(directories)
+	img := newImage(true, make([]byte, 0x100))
+	copy(img.Data[0x80:], pack(t,
+		uint32(peutils.NTSignature),
+		pe.FileHeader{Machine: pe.IMAGE_FILE_MACHINE_AMD64, NumberOfSections: 1, SizeOfOptionalHeader: uint16(optionalSize), Characteristics: pe.IMAGE_FILE_EXECUTABLE_IMAGE},
+		optional,
+		directories,
+	))
+
+	tree, err := peutils.ParseNTHeaders(img, 0x80)
+	require.NoError(t, err)
+	assert.Equal(t, "NT Headers", tree.Name)
+	assert.Equal(t, uintptr(0x80), tree.Address)
+	assert.Equal(t, uint64(4+20+optionalSize), tree.Size)
+	assert.Equal(t, `"PE\x00\x00"`, contractstest.FindValue(t, tree, "Signature").Value)
+	require.Len(t, tree.Content, 2)
+
+	fileHeader := tree.Content[0]
+	assert.Equal(t, "File Header", fileHeader.Name)
+	assert.Equal(t, uint64(4), fileHeader.ParentOffset)
+	assert.Equal(t, "IMAGE_FILE_MACHINE_AMD64", contractstest.FindValue(t, fileHeader, "Machine").Value)
+	assert.Equal(t, "IMAGE_FILE_EXECUTABLE_IMAGE", contractstest.FindValue(t, fileHeader, "Characteristics").Value)
+
+	optionalHeader := tree.Content[1]
+	assert.Equal(t, "Optional Header (PE32+)", optionalHeader.Name)
+	assert.Equal(t, "IMAGE_SUBSYSTEM_WINDOWS_CUI", contractstest.FindValue(t, optionalHeader, "Subsystem").Value)
+	require.Len(t, contractstest.FindValue(t, optionalHeader, "AddressOfEntryPoint").Links, 1)
+	assert.Equal(t, contracts.MemoryLink{Name: "starts at", TargetAddress: 0x204}, *contractstest.FindValue(t, optionalHeader, "AddressOfEntryPoint").Links[0])
+	require.Len(t, optionalHeader.Content, 1)
+	dataDirectories := optionalHeader.Content[0]
+	assert.Equal(t, "Data Directories (16)", dataDirectories.Name)
+	require.Len(t, dataDirectories.Content, 16)
+
+	imports := dataDirectories.Content[pe.IMAGE_DIRECTORY_ENTRY_IMPORT]
+	assert.Equal(t, "Data Directory 1 (Import Table)", imports.Name)
+	assert.Equal(t, []*contracts.MemoryLink{
+		{Name: "points to", TargetAddress: 0x210},
+		{Name: "is in", TargetAddress: 0x200},
+	}, contractstest.FindValue(t, imports, "VirtualAddress").Links)
+	certificates := dataDirectories.Content[pe.IMAGE_DIRECTORY_ENTRY_SECURITY]
+	assert.Equal(t, []*contracts.MemoryLink{
+		{Name: "points to", TargetAddress: 0x400},
+	}, contractstest.FindValue(t, certificates, "VirtualAddress").Links)
+	assert.Len(t, contractstest.FindValue(t, dataDirectories.Content[pe.IMAGE_DIRECTORY_ENTRY_EXPORT], "VirtualAddress").Links, 0)
+}
+
+func Test_ParseNTHeaders_invalid(t *testing.T) {
+	img := newImage(false, nil)
+	_, err := peutils.ParseNTHeaders(img, 0x80)
+	assert.Error(t, err)
+	_, err = peutils.ParseNTHeaders(img, 0x1000)
+	assert.Error(t, err)
+}
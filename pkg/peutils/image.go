@@ -0,0 +1,159 @@
+package peutils
+
+import (
+	"debug/pe"
+	"fmt"
+
+	"github.com/LouisBrunner/mem-viz/pkg/contracts"
+)
+
+// Where a section is in memory and in the file, used to turn RVAs into file offsets
+type Section struct {
+	Name             string
+	VirtualAddress   uint32
+	VirtualSize      uint32
+	PointerToRawData uint32
+	SizeOfRawData    uint32
+}
+
+// Layout of the image being decoded, blocks are given at their file offset (i.e. the file is expected to start at 0)
+type Image struct {
+	// Contents of the whole file
+	Data []byte
+	// PE32+ images use 64-bit thunks
+	Is64    bool
+	Machine uint16
+	// Only needed for old delay import descriptors which use VAs instead of RVAs
+	ImageBase uint64
+	// The headers are mapped at RVA 0
+	SizeOfHeaders uint32
+	Sections      []Section
+}
+
+func NewImage(f *pe.File, data []byte) Image {
+	img := Image{
+		Data:    data,
+		Machine: f.Machine,
+	}
+	switch header := f.OptionalHeader.(type) {
+	case *pe.OptionalHeader32:
+		img.ImageBase, img.SizeOfHeaders = uint64(header.ImageBase), header.SizeOfHeaders
+	case *pe.OptionalHeader64:
+		img.Is64 = true
+		img.ImageBase, img.SizeOfHeaders = header.ImageBase, header.SizeOfHeaders
+	}
+	for _, sect := range f.Sections {
+		img.Sections = append(img.Sections, Section{
+			Name:             sect.Name,
+			VirtualAddress:   sect.VirtualAddress,
+			VirtualSize:      sect.VirtualSize,
+			PointerToRawData: sect.Offset,
+			SizeOfRawData:    sect.Size,
+		})
+	}
+	return img
+}
+
+// Size of the part of the section which comes from the file (the rest is zero-filled by the loader)
+func (me Section) mappedSize() uint32 {
+	// Raw data is padded to the file alignment, the padding isn't mapped
+	if me.VirtualSize != 0 && me.VirtualSize < me.SizeOfRawData {
+		return me.VirtualSize
+	}
+	return me.SizeOfRawData
+}
+
+// Finds the section containing an RVA in the file, false if there is none
+func (me Image) Section(rva uint32) (Section, bool) {
+	for _, sect := range me.Sections {
+		if sect.VirtualAddress <= rva && rva-sect.VirtualAddress < sect.mappedSize() {
+			return sect, true
+		}
+	}
+	return Section{}, false
+}
+
+// Returns the file offset of an RVA and how many bytes are left in the file after it before the mapping ends
+func (me Image) locate(rva uint32) (uint64, uint64, bool) {
+	var offset, end uint64
+	if sect, found := me.Section(rva); found {
+		offset = uint64(sect.PointerToRawData) + uint64(rva-sect.VirtualAddress)
+		end = uint64(sect.PointerToRawData) + uint64(sect.mappedSize())
+	} else if rva < me.SizeOfHeaders {
+		offset, end = uint64(rva), uint64(me.SizeOfHeaders)
+	} else {
+		return 0, 0, false
+	}
+	end = min(end, uint64(len(me.Data)))
+	if offset >= end {
+		return 0, 0, false
+	}
+	return offset, end - offset, true
+}
+
+// Turns an RVA into a file offset, false if it isn't backed by the file
+func (me Image) Offset(rva uint32) (uintptr, bool) {
+	offset, _, found := me.locate(rva)
+	return uintptr(offset), found
+}
+
+// Returns the data at an RVA which must be contiguous in the file, and its file offset
+func (me Image) read(rva uint32, size uint64) ([]byte, uint64, error) {
+	offset, left, found := me.locate(rva)
+	if !found {
+		return nil, 0, fmt.Errorf("RVA %#x is not in the file", rva)
+	}
+	if size > left {
+		return nil, 0, fmt.Errorf("RVA %#x+%#x is not in the file", rva, size)
+	}
+	return me.Data[offset : offset+size], offset, nil
+}
+
+// Returns the data from an RVA until the end of its mapping, and its file offset
+func (me Image) readAll(rva uint32) ([]byte, uint64, error) {
+	offset, left, found := me.locate(rva)
+	if !found {
+		return nil, 0, fmt.Errorf("RVA %#x is not in the file", rva)
+	}
+	return me.Data[offset : offset+left], offset, nil
+}
+
+func (me Image) wordSize() uint64 {
+	if me.Is64 {
+		return 8
+	}
+	return 4
+}
+
+// Collects the blocks found by a decoder, blocks shared by several tables (e.g. hint/name entries) are only added once
+type decoded struct {
+	blocks []*contracts.MemoryBlock
+	seen   map[uintptr]*contracts.MemoryBlock
+}
+
+func newDecoded() *decoded {
+	return &decoded{seen: map[uintptr]*contracts.MemoryBlock{}}
+}
+
+func (me *decoded) add(block *contracts.MemoryBlock) *contracts.MemoryBlock {
+	if found, ok := me.seen[block.Address]; ok {
+		return found
+	}
+	me.seen[block.Address] = block
+	me.blocks = append(me.blocks, block)
+	return block
+}
+
+// Adds a quoted string block at an RVA (e.g. a DLL name), the string is returned even if it was already added
+func (me *decoded) addString(img Image, rva uint32) (string, *contracts.MemoryBlock, error) {
+	data, offset, err := img.readAll(rva)
+	if err != nil {
+		return "", nil, err
+	}
+	str, err := ReadCString(data, 0)
+	if err != nil {
+		return "", nil, err
+	}
+	size := min(uint64(len(str))+1, uint64(len(data)))
+	return str, me.add(newBlock(fmt.Sprintf("%q", str), uintptr(offset), size)), nil
+}
@@ -0,0 +1,302 @@
+package peutils
+
+import (
+	"bytes"
+	"debug/pe"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/LouisBrunner/mem-viz/pkg/contracts"
+	"github.com/LouisBrunner/mem-viz/pkg/parsingutils"
+)
+
+// IMAGE_IMPORT_DESCRIPTOR
+type ImportDescriptor struct {
+	OriginalFirstThunk uint32
+	TimeDateStamp      uint32
+	ForwarderChain     uint32
+	Name               uint32
+	FirstThunk         uint32
+}
+
+// IMAGE_DELAYLOAD_DESCRIPTOR
+type DelayImportDescriptor struct {
+	Attributes                 uint32
+	DllNameRVA                 uint32
+	ModuleHandleRVA            uint32
+	ImportAddressTableRVA      uint32
+	ImportNameTableRVA         uint32
+	BoundImportAddressTableRVA uint32
+	UnloadInformationTableRVA  uint32
+	TimeDateStamp              uint32
+}
+
+// Delay import descriptors without it (from before Visual C++ 7) use VAs instead of RVAs
+const delayAttributeRVA = 0x1
+
+// Parses the import directory (IMAGE_DIRECTORY_ENTRY_IMPORT), with the lookup and address tables of each DLL
+func ParseImports(img Image, dir pe.DataDirectory) ([]*contracts.MemoryBlock, error) {
+	descriptorSize := uint64(binary.Size(ImportDescriptor{}))
+	start, descriptors, err := readDescriptors(img, dir.VirtualAddress, descriptorSize)
+	if err != nil {
+		return nil, err
+	}
+	out := newDecoded()
+	// The table ends with an empty descriptor
+	root := out.add(newBlock(fmt.Sprintf("Import Directory (%d DLLs)", len(descriptors)), uintptr(start), uint64(len(descriptors)+1)*descriptorSize))
+
+	for i, offset := range descriptors {
+		descriptor := ImportDescriptor{}
+		entry, err := addStruct(root, img.Data[root.Address:], &descriptor, fmt.Sprintf("Import Descriptor %d", i), offset-uint64(root.Address))
+		if err != nil {
+			return nil, err
+		}
+		name, nameBlock, err := out.addString(img, descriptor.Name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the name of import %d: %w", i, err)
+		}
+		entry.Name = fmt.Sprintf("Import Descriptor (%s)", name)
+		err = parsingutils.AddLinkWithBlock(entry, "Name", nameBlock, "name")
+		if err != nil {
+			return nil, err
+		}
+
+		// Some old linkers only emit the address table
+		lookupRVA := descriptor.OriginalFirstThunk
+		if lookupRVA == 0 {
+			lookupRVA = descriptor.FirstThunk
+		}
+		lookup, names, err := addThunks(out, img, lookupRVA, fmt.Sprintf("Import Lookup Table (%s)", name), nil, thunksOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse the lookup table of %s: %w", name, err)
+		}
+		err = parsingutils.AddLinkWithBlock(entry, "OriginalFirstThunk", lookup, "points to")
+		if err != nil {
+			return nil, err
+		}
+		if descriptor.FirstThunk == lookupRVA {
+			err = parsingutils.AddLinkWithBlock(entry, "FirstThunk", lookup, "points to")
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+		// Bound imports have the resolved addresses in their address table instead of a copy of the lookup table
+		addresses, _, err := addThunks(out, img, descriptor.FirstThunk, fmt.Sprintf("Import Address Table (%s)", name), names, thunksOptions{
+			bound: descriptor.TimeDateStamp != 0,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse the address table of %s: %w", name, err)
+		}
+		err = parsingutils.AddLinkWithBlock(entry, "FirstThunk", addresses, "points to")
+		if err != nil {
+			return nil, err
+		}
+	}
+	return out.blocks, nil
+}
+
+// Parses the delay import directory (IMAGE_DIRECTORY_ENTRY_DELAY_IMPORT), with the name and address tables of each DLL
+func ParseDelayImports(img Image, dir pe.DataDirectory) ([]*contracts.MemoryBlock, error) {
+	descriptorSize := uint64(binary.Size(DelayImportDescriptor{}))
+	start, descriptors, err := readDescriptors(img, dir.VirtualAddress, descriptorSize)
+	if err != nil {
+		return nil, err
+	}
+	out := newDecoded()
+	root := out.add(newBlock(fmt.Sprintf("Delay Import Directory (%d DLLs)", len(descriptors)), uintptr(start), uint64(len(descriptors)+1)*descriptorSize))
+
+	for i, offset := range descriptors {
+		descriptor := DelayImportDescriptor{}
+		entry, err := addStruct(root, img.Data[root.Address:], &descriptor, fmt.Sprintf("Delay Import Descriptor %d", i), offset-uint64(root.Address))
+		if err != nil {
+			return nil, err
+		}
+		toRVA := func(value uint32) uint32 {
+			if descriptor.Attributes&delayAttributeRVA == 0 && value != 0 {
+				return uint32(uint64(value) - img.ImageBase)
+			}
+			return value
+		}
+
+		name, nameBlock, err := out.addString(img, toRVA(descriptor.DllNameRVA))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the name of delay import %d: %w", i, err)
+		}
+		entry.Name = fmt.Sprintf("Delay Import Descriptor (%s)", name)
+		err = parsingutils.AddLinkWithBlock(entry, "DllNameRVA", nameBlock, "name")
+		if err != nil {
+			return nil, err
+		}
+
+		names, imports, err := addThunks(out, img, toRVA(descriptor.ImportNameTableRVA), fmt.Sprintf("Delay Import Name Table (%s)", name), nil, thunksOptions{
+			toRVA: toRVA,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse the name table of %s: %w", name, err)
+		}
+		err = parsingutils.AddLinkWithBlock(entry, "ImportNameTableRVA", names, "points to")
+		if err != nil {
+			return nil, err
+		}
+
+		// The address table points to the stubs loading the DLL until it's loaded, it can also be in an uninitialized section
+		addresses, _, err := addThunks(out, img, toRVA(descriptor.ImportAddressTableRVA), fmt.Sprintf("Delay Import Address Table (%s)", name), imports, thunksOptions{
+			bound: true,
+			toRVA: func(value uint32) uint32 { return uint32(uint64(value) - img.ImageBase) },
+		})
+		if err == nil {
+			err = parsingutils.AddLinkWithBlock(entry, "ImportAddressTableRVA", addresses, "points to")
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		for _, field := range []struct {
+			name  string
+			value uint32
+		}{
+			{"ModuleHandleRVA", descriptor.ModuleHandleRVA},
+			{"BoundImportAddressTableRVA", descriptor.BoundImportAddressTableRVA},
+			{"UnloadInformationTableRVA", descriptor.UnloadInformationTableRVA},
+		} {
+			if field.value == 0 {
+				continue
+			}
+			if target, found := img.Offset(toRVA(field.value)); found {
+				err = parsingutils.AddLinkWithAddr(entry, field.name, "points to", target)
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	return out.blocks, nil
+}
+
+// Returns the file offset of a table of descriptors and the ones of its descriptors, it ends with an empty one (not included)
+func readDescriptors(img Image, rva uint32, size uint64) (uint64, []uint64, error) {
+	data, offset, err := img.readAll(rva)
+	if err != nil {
+		return 0, nil, err
+	}
+	descriptors := []uint64{}
+	for current := uint64(0); ; current += size {
+		descriptor, err := subSlice(data, current, size)
+		if err != nil {
+			return 0, nil, fmt.Errorf("unterminated descriptor table at RVA %#x: %w", rva, err)
+		}
+		if bytes.Count(descriptor, []byte{0}) == len(descriptor) {
+			return offset, descriptors, nil
+		}
+		descriptors = append(descriptors, offset+current)
+	}
+}
+
+type thunksOptions struct {
+	// The entries are addresses resolved by the loader instead of hint/name RVAs or ordinals
+	bound bool
+	// Turns the values of the entries into RVAs (nil if they are already)
+	toRVA func(value uint32) uint32
+}
+
+// Adds a table of thunks (IMAGE_THUNK_DATA) at rva until its empty entry, entries are named after their hint/name entry
+// (or given names for tables which don't point to them), the table and the names of its entries are returned
+func addThunks(out *decoded, img Image, rva uint32, name string, names []string, options thunksOptions) (*contracts.MemoryBlock, []string, error) {
+	data, offset, err := img.readAll(rva)
+	if err != nil {
+		return nil, nil, err
+	}
+	word := img.wordSize()
+	ordinalFlag := uint64(1) << (8*word - 1)
+	count := uint64(0)
+	for ; ; count += 1 {
+		if (count+1)*word > uint64(len(data)) {
+			return nil, nil, fmt.Errorf("unterminated thunk table at RVA %#x", rva)
+		}
+		if readWord(data, count*word, word) == 0 {
+			break
+		}
+	}
+	table := out.add(newBlock(name, uintptr(offset), (count+1)*word))
+
+	found := make([]string, count)
+	for i := uint64(0); i < count; i += 1 {
+		value := readWord(data, i*word, word)
+		importName := ""
+		if i < uint64(len(names)) {
+			importName = names[i]
+		}
+		var target uintptr
+		linked := false
+		switch {
+		case options.bound:
+			if options.toRVA != nil && value > img.ImageBase {
+				target, linked = img.Offset(options.toRVA(uint32(value)))
+			}
+		case value&ordinalFlag != 0:
+			importName = fmt.Sprintf("Ordinal %d", uint16(value))
+		default:
+			hintRVA := uint32(value & 0x7fffffff)
+			if options.toRVA != nil {
+				hintRVA = options.toRVA(hintRVA)
+			}
+			var hintName *contracts.MemoryBlock
+			importName, hintName, err = addHintName(out, img, hintRVA)
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to parse import %d: %w", i, err)
+			}
+			target, linked = hintName.Address, true
+		}
+		found[i] = importName
+
+		entryName := "Import"
+		if importName != "" {
+			entryName = fmt.Sprintf("Import (%s)", importName)
+		}
+		entry := addChild(table, entryName, i*word, word)
+		addValue(entry, "Value", value, 0, uint8(word))
+		if !linked {
+			continue
+		}
+		linkName := "refers to"
+		if options.bound {
+			linkName = "points to"
+		}
+		err = parsingutils.AddLinkWithAddr(entry, "Value", linkName, target)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return table, found, nil
+}
+
+// IMAGE_IMPORT_BY_NAME, they are usually shared by the lookup and address tables
+func addHintName(out *decoded, img Image, rva uint32) (string, *contracts.MemoryBlock, error) {
+	data, offset, err := img.readAll(rva)
+	if err != nil {
+		return "", nil, err
+	}
+	if len(data) < 2 {
+		return "", nil, fmt.Errorf("hint/name at RVA %#x is out of bounds", rva)
+	}
+	name := ""
+	if len(data) > 2 {
+		name, err = ReadCString(data, 2)
+		if err != nil {
+			return "", nil, err
+		}
+	}
+	size := min(2+uint64(len(name))+1, uint64(len(data)))
+	block := newBlock(fmt.Sprintf("Hint/Name (%s)", name), uintptr(offset), size)
+	addValue(block, "Hint", binary.LittleEndian.Uint16(data), 0, 2)
+	addValue(block, "Name", name, 2, uint8(min(size-2, 0xff)))
+	return name, out.add(block), nil
+}
+
+func readWord(data []byte, offset, word uint64) uint64 {
+	if word == 8 {
+		return binary.LittleEndian.Uint64(data[offset:])
+	}
+	return uint64(binary.LittleEndian.Uint32(data[offset:]))
+}
@@ -0,0 +1,118 @@
+package peutils_test
+
+import (
+	"debug/pe"
+	"testing"
+
+	"github.com/LouisBrunner/mem-viz/pkg/contracts"
+	"github.com/LouisBrunner/mem-viz/pkg/contracts/contractstest"
+	"github.com/LouisBrunner/mem-viz/pkg/peutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_ParseImports(t *testing.T) {
+	section := make([]byte, 0x100)
+	copy(section[0x00:], pack(t, peutils.ImportDescriptor{OriginalFirstThunk: 0x1040, Name: 0x1070, FirstThunk: 0x1058}))
+	copy(section[0x40:], pack(t, uint64(0x1080), uint64(1<<63|5), uint64(0)))
+	copy(section[0x58:], pack(t, uint64(0x1080), uint64(1<<63|5), uint64(0)))
+	copy(section[0x70:], "KERNEL32.dll\x00")
+	copy(section[0x80:], pack(t, uint16(7), []byte("ExitProcess\x00")))
+	img := newImage(true, section)
+
+	blocks, err := peutils.ParseImports(img, pe.DataDirectory{VirtualAddress: 0x1000, Size: 0x28})
+	require.NoError(t, err)
+	require.Len(t, blocks, 5)
+
+	root := contractstest.FindBlock(t, blocks, "Import Directory (1 DLLs)")
+	assert.Equal(t, uintptr(0x200), root.Address)
+	assert.Equal(t, uint64(0x28), root.Size)
+	require.Len(t, root.Content, 1)
+	descriptor := root.Content[0]
+	assert.Equal(t, "Import Descriptor (KERNEL32.dll)", descriptor.Name)
+	assert.Equal(t, contracts.MemoryLink{Name: "name", TargetAddress: 0x270}, *contractstest.FindValue(t, descriptor, "Name").Links[0])
+	assert.Equal(t, contracts.MemoryLink{Name: "points to", TargetAddress: 0x240}, *contractstest.FindValue(t, descriptor, "OriginalFirstThunk").Links[0])
+	assert.Equal(t, contracts.MemoryLink{Name: "points to", TargetAddress: 0x258}, *contractstest.FindValue(t, descriptor, "FirstThunk").Links[0])
+
+	assert.Equal(t, uintptr(0x270), contractstest.FindBlock(t, blocks, `"KERNEL32.dll"`).Address)
+	hintName := contractstest.FindBlock(t, blocks, "Hint/Name (ExitProcess)")
+	assert.Equal(t, uintptr(0x280), hintName.Address)
+	assert.Equal(t, uint64(2+12), hintName.Size)
+	assert.Equal(t, "0x7", contractstest.FindValue(t, hintName, "Hint").Value)
+
+	for _, name := range []string{"Import Lookup Table (KERNEL32.dll)", "Import Address Table (KERNEL32.dll)"} {
+		table := contractstest.FindBlock(t, blocks, name)
+		assert.Equal(t, uint64(24), table.Size)
+		require.Len(t, table.Content, 2)
+		assert.Equal(t, "Import (ExitProcess)", table.Content[0].Name)
+		assert.Equal(t, contracts.MemoryLink{Name: "refers to", TargetAddress: 0x280}, *contractstest.FindValue(t, table.Content[0], "Value").Links[0])
+		assert.Equal(t, "Import (Ordinal 5)", table.Content[1].Name)
+		assert.Len(t, contractstest.FindValue(t, table.Content[1], "Value").Links, 0)
+	}
+}
+
+func Test_ParseImports_unterminated(t *testing.T) {
+	section := pack(t, peutils.ImportDescriptor{OriginalFirstThunk: 0x1040, Name: 0x1070, FirstThunk: 0x1058})
+	_, err := peutils.ParseImports(newImage(true, section), pe.DataDirectory{VirtualAddress: 0x1000, Size: 0x28})
+	assert.Error(t, err)
+}
+
+func Test_ParseDelayImports(t *testing.T) {
+	section := make([]byte, 0x100)
+	copy(section[0x00:], pack(t, peutils.DelayImportDescriptor{
+		Attributes:            1,
+		DllNameRVA:            0x1080,
+		ModuleHandleRVA:       0x10c0,
+		ImportAddressTableRVA: 0x1050,
+		ImportNameTableRVA:    0x1060,
+	}))
+	copy(section[0x50:], pack(t, uint32(0x400000+0x10a0), uint32(0)))
+	copy(section[0x60:], pack(t, uint32(0x1090), uint32(0)))
+	copy(section[0x80:], "USER32.dll\x00")
+	copy(section[0x90:], pack(t, uint16(0), []byte("MessageBoxA\x00")))
+	img := newImage(false, section)
+
+	blocks, err := peutils.ParseDelayImports(img, pe.DataDirectory{VirtualAddress: 0x1000, Size: 0x40})
+	require.NoError(t, err)
+
+	root := contractstest.FindBlock(t, blocks, "Delay Import Directory (1 DLLs)")
+	assert.Equal(t, uint64(0x40), root.Size)
+	require.Len(t, root.Content, 1)
+	descriptor := root.Content[0]
+	assert.Equal(t, "Delay Import Descriptor (USER32.dll)", descriptor.Name)
+	assert.Equal(t, uint64(0x280), contractstest.FindValue(t, descriptor, "DllNameRVA").Links[0].TargetAddress)
+	assert.Equal(t, uint64(0x260), contractstest.FindValue(t, descriptor, "ImportNameTableRVA").Links[0].TargetAddress)
+	assert.Equal(t, uint64(0x250), contractstest.FindValue(t, descriptor, "ImportAddressTableRVA").Links[0].TargetAddress)
+	assert.Equal(t, uint64(0x2c0), contractstest.FindValue(t, descriptor, "ModuleHandleRVA").Links[0].TargetAddress)
+
+	names := contractstest.FindBlock(t, blocks, "Delay Import Name Table (USER32.dll)")
+	require.Len(t, names.Content, 1)
+	assert.Equal(t, "Import (MessageBoxA)", names.Content[0].Name)
+	addresses := contractstest.FindBlock(t, blocks, "Delay Import Address Table (USER32.dll)")
+	require.Len(t, addresses.Content, 1)
+	assert.Equal(t, "Import (MessageBoxA)", addresses.Content[0].Name)
+	assert.Equal(t, contracts.MemoryLink{Name: "points to", TargetAddress: 0x2a0}, *contractstest.FindValue(t, addresses.Content[0], "Value").Links[0])
+}
+
+func Test_ParseDelayImports_VA(t *testing.T) {
+	section := make([]byte, 0x100)
+	copy(section[0x00:], pack(t, peutils.DelayImportDescriptor{
+		DllNameRVA:            0x400000 + 0x1080,
+		ImportAddressTableRVA: 0x400000 + 0x1050,
+		ImportNameTableRVA:    0x400000 + 0x1060,
+	}))
+	copy(section[0x50:], pack(t, uint32(0x400000+0x10a0), uint32(0)))
+	copy(section[0x60:], pack(t, uint32(0x400000+0x1090), uint32(0)))
+	copy(section[0x80:], "OLD.dll\x00")
+	copy(section[0x90:], pack(t, uint16(0), []byte("Legacy\x00")))
+	img := newImage(false, section)
+
+	blocks, err := peutils.ParseDelayImports(img, pe.DataDirectory{VirtualAddress: 0x1000, Size: 0x40})
+	require.NoError(t, err)
+	contractstest.FindBlock(t, blocks, `"OLD.dll"`)
+	names := contractstest.FindBlock(t, blocks, "Delay Import Name Table (OLD.dll)")
+	assert.Equal(t, uintptr(0x260), names.Address)
+	require.Len(t, names.Content, 1)
+	assert.Equal(t, "Import (Legacy)", names.Content[0].Name)
+	assert.Equal(t, uintptr(0x290), contractstest.FindBlock(t, blocks, "Hint/Name (Legacy)").Address)
+}
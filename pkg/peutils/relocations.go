@@ -0,0 +1,109 @@
+package peutils
+
+import (
+	"debug/pe"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/LouisBrunner/mem-viz/pkg/contracts"
+	"github.com/LouisBrunner/mem-viz/pkg/parsingutils"
+)
+
+// IMAGE_BASE_RELOCATION, it's followed by 16-bit entries (type in the top 4 bits, offset in the page in the others)
+type BaseRelocationBlock struct {
+	VirtualAddress uint32
+	SizeOfBlock    uint32
+}
+
+const (
+	IMAGE_REL_BASED_ABSOLUTE = 0
+	IMAGE_REL_BASED_HIGH     = 1
+	IMAGE_REL_BASED_LOW      = 2
+	IMAGE_REL_BASED_HIGHLOW  = 3
+	IMAGE_REL_BASED_HIGHADJ  = 4
+	IMAGE_REL_BASED_DIR64    = 10
+)
+
+var baseRelocationNames = map[uint64]string{
+	IMAGE_REL_BASED_ABSOLUTE: "IMAGE_REL_BASED_ABSOLUTE",
+	IMAGE_REL_BASED_HIGH:     "IMAGE_REL_BASED_HIGH",
+	IMAGE_REL_BASED_LOW:      "IMAGE_REL_BASED_LOW",
+	IMAGE_REL_BASED_HIGHLOW:  "IMAGE_REL_BASED_HIGHLOW",
+	IMAGE_REL_BASED_HIGHADJ:  "IMAGE_REL_BASED_HIGHADJ",
+	IMAGE_REL_BASED_DIR64:    "IMAGE_REL_BASED_DIR64",
+}
+
+// Types 5 to 9 depend on the machine
+var machineBaseRelocationNames = map[uint16]map[uint64]string{
+	pe.IMAGE_FILE_MACHINE_ARM:         {5: "IMAGE_REL_BASED_ARM_MOV32", 7: "IMAGE_REL_BASED_THUMB_MOV32"},
+	pe.IMAGE_FILE_MACHINE_ARMNT:       {5: "IMAGE_REL_BASED_ARM_MOV32", 7: "IMAGE_REL_BASED_THUMB_MOV32"},
+	pe.IMAGE_FILE_MACHINE_RISCV32:     {5: "IMAGE_REL_BASED_RISCV_HIGH20", 7: "IMAGE_REL_BASED_RISCV_LOW12I", 8: "IMAGE_REL_BASED_RISCV_LOW12S"},
+	pe.IMAGE_FILE_MACHINE_RISCV64:     {5: "IMAGE_REL_BASED_RISCV_HIGH20", 7: "IMAGE_REL_BASED_RISCV_LOW12I", 8: "IMAGE_REL_BASED_RISCV_LOW12S"},
+	pe.IMAGE_FILE_MACHINE_LOONGARCH32: {8: "IMAGE_REL_BASED_LOONGARCH32_MARK_LA"},
+	pe.IMAGE_FILE_MACHINE_LOONGARCH64: {8: "IMAGE_REL_BASED_LOONGARCH64_MARK_LA"},
+	pe.IMAGE_FILE_MACHINE_R4000:       {5: "IMAGE_REL_BASED_MIPS_JMPADDR", 9: "IMAGE_REL_BASED_MIPS_JMPADDR16"},
+}
+
+func BaseRelocationTypeName(machine uint16, typ uint8) string {
+	if name, found := machineBaseRelocationNames[machine][uint64(typ)]; found {
+		return name
+	}
+	return enumName(baseRelocationNames, uint64(typ))
+}
+
+// Parses the base relocations (IMAGE_DIRECTORY_ENTRY_BASERELOC), one block per page with its entries
+func ParseBaseRelocations(img Image, dir pe.DataDirectory) ([]*contracts.MemoryBlock, error) {
+	data, offset, err := img.read(dir.VirtualAddress, uint64(dir.Size))
+	if err != nil {
+		return nil, err
+	}
+	root := newBlock("Base Relocations", uintptr(offset), uint64(len(data)))
+	headerSize := uint64(binary.Size(BaseRelocationBlock{}))
+	for current := uint64(0); current < uint64(len(data)); {
+		header := BaseRelocationBlock{}
+		err = ReadStruct(data, current, &header)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse base relocation block at %#x: %w", current, err)
+		}
+		if uint64(header.SizeOfBlock) < headerSize || uint64(header.SizeOfBlock) > uint64(len(data))-current {
+			return nil, fmt.Errorf("invalid base relocation block size %#x at %#x", header.SizeOfBlock, current)
+		}
+		err = addBaseRelocationBlock(root, img, data[current:current+uint64(header.SizeOfBlock)], current, header)
+		if err != nil {
+			return nil, err
+		}
+		current += uint64(header.SizeOfBlock)
+	}
+	root.Name = fmt.Sprintf("Base Relocations (%d pages)", len(root.Content))
+	return []*contracts.MemoryBlock{root}, nil
+}
+
+func addBaseRelocationBlock(root *contracts.MemoryBlock, img Image, data []byte, offset uint64, header BaseRelocationBlock) error {
+	headerSize := uint64(binary.Size(header))
+	count := (uint64(len(data)) - headerSize) / 2
+	page := addChild(root, fmt.Sprintf("Page %#x (%d entries)", header.VirtualAddress, count), offset, uint64(len(data)))
+	parsingutils.AddStructValues(page, &header, headerSize, parsingutils.FormatValue)
+
+	for i := uint64(0); i < count; i += 1 {
+		raw := binary.LittleEndian.Uint16(data[headerSize+i*2:])
+		typ, pageOffset := uint8(raw>>12), uint32(raw&0xfff)
+		name := BaseRelocationTypeName(img.Machine, typ)
+		entry := addChild(page, fmt.Sprintf("%s (+%#x)", name, pageOffset), headerSize+i*2, 2)
+		addValue(entry, "Entry", raw, 0, 2)
+		if typ == IMAGE_REL_BASED_ABSOLUTE {
+			continue
+		}
+		if target, found := img.Offset(header.VirtualAddress + pageOffset); found {
+			err := parsingutils.AddLinkWithAddr(entry, "Entry", "patches", target)
+			if err != nil {
+				return err
+			}
+		}
+		// The low half of the adjusted address is stored in the next slot
+		if typ == IMAGE_REL_BASED_HIGHADJ && i+1 < count {
+			i += 1
+			entry.Size += 2
+		}
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package peutils_test
+
+import (
+	"debug/pe"
+	"testing"
+
+	"github.com/LouisBrunner/mem-viz/pkg/contracts"
+	"github.com/LouisBrunner/mem-viz/pkg/contracts/contractstest"
+	"github.com/LouisBrunner/mem-viz/pkg/peutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_ParseBaseRelocations(t *testing.T) {
+	section := make([]byte, 0x40)
+	copy(section, pack(t,
+		peutils.BaseRelocationBlock{VirtualAddress: 0x1000, SizeOfBlock: 8 + 4*2},
+		uint16(peutils.IMAGE_REL_BASED_DIR64<<12|0x20),
+		uint16(peutils.IMAGE_REL_BASED_HIGHADJ<<12|0x28),
+		uint16(0x1234),
+		uint16(peutils.IMAGE_REL_BASED_ABSOLUTE<<12),
+		peutils.BaseRelocationBlock{VirtualAddress: 0x5000, SizeOfBlock: 8 + 2*2},
+		uint16(peutils.IMAGE_REL_BASED_HIGHLOW<<12|0x10),
+		uint16(0),
+	))
+	img := newImage(true, section)
+
+	blocks, err := peutils.ParseBaseRelocations(img, pe.DataDirectory{VirtualAddress: 0x1000, Size: 28})
+	require.NoError(t, err)
+	require.Len(t, blocks, 1)
+	root := blocks[0]
+	assert.Equal(t, "Base Relocations (2 pages)", root.Name)
+	assert.Equal(t, uint64(28), root.Size)
+	require.Len(t, root.Content, 2)
+
+	first := root.Content[0]
+	assert.Equal(t, "Page 0x1000 (4 entries)", first.Name)
+	require.Len(t, first.Content, 3)
+	assert.Equal(t, "IMAGE_REL_BASED_DIR64 (+0x20)", first.Content[0].Name)
+	assert.Equal(t, contracts.MemoryLink{Name: "patches", TargetAddress: 0x220}, *contractstest.FindValue(t, first.Content[0], "Entry").Links[0])
+	assert.Equal(t, "IMAGE_REL_BASED_HIGHADJ (+0x28)", first.Content[1].Name)
+	assert.Equal(t, uint64(4), first.Content[1].Size)
+	assert.Equal(t, "IMAGE_REL_BASED_ABSOLUTE (+0x0)", first.Content[2].Name)
+	assert.Len(t, contractstest.FindValue(t, first.Content[2], "Entry").Links, 0)
+
+	// The page isn't in the file
+	second := root.Content[1]
+	assert.Equal(t, "Page 0x5000 (2 entries)", second.Name)
+	require.Len(t, second.Content, 2)
+	assert.Len(t, contractstest.FindValue(t, second.Content[0], "Entry").Links, 0)
+}
+
+func Test_ParseBaseRelocations_invalid(t *testing.T) {
+	section := pack(t, peutils.BaseRelocationBlock{VirtualAddress: 0x1000, SizeOfBlock: 0x100})
+	_, err := peutils.ParseBaseRelocations(newImage(true, section), pe.DataDirectory{VirtualAddress: 0x1000, Size: 8})
+	assert.Error(t, err)
+}
+
+func Test_BaseRelocationTypeName(t *testing.T) {
+	assert.Equal(t, "IMAGE_REL_BASED_HIGHLOW", peutils.BaseRelocationTypeName(pe.IMAGE_FILE_MACHINE_I386, 3))
+	assert.Equal(t, "IMAGE_REL_BASED_THUMB_MOV32", peutils.BaseRelocationTypeName(pe.IMAGE_FILE_MACHINE_ARMNT, 7))
+	assert.Equal(t, "0x7", peutils.BaseRelocationTypeName(pe.IMAGE_FILE_MACHINE_AMD64, 7))
+}
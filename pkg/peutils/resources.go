@@ -0,0 +1,207 @@
+package peutils
+
+import (
+	"debug/pe"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/LouisBrunner/mem-viz/pkg/contracts"
+	"github.com/LouisBrunner/mem-viz/pkg/parsingutils"
+)
+
+// IMAGE_RESOURCE_DIRECTORY, it's followed by the named entries then the ID ones
+type ResourceDirectory struct {
+	Characteristics      uint32
+	TimeDateStamp        uint32
+	MajorVersion         uint16
+	MinorVersion         uint16
+	NumberOfNamedEntries uint16
+	NumberOfIdEntries    uint16
+}
+
+// IMAGE_RESOURCE_DIRECTORY_ENTRY
+type ResourceDirectoryEntry struct {
+	Name         uint32
+	OffsetToData uint32
+}
+
+// IMAGE_RESOURCE_DATA_ENTRY, unlike the rest of the tree its data is given by RVA
+type ResourceDataEntry struct {
+	OffsetToData uint32
+	Size         uint32
+	CodePage     uint32
+	Reserved     uint32
+}
+
+// Set on names and offsets in directory entries which point to a string or a subdirectory
+const resourceHighBit = 0x80000000
+
+// The tree is usually 3 levels deep (type, name then language), this guards against loops
+const maxResourceDepth = 8
+
+var resourceTypeNames = map[uint64]string{
+	1:  "RT_CURSOR",
+	2:  "RT_BITMAP",
+	3:  "RT_ICON",
+	4:  "RT_MENU",
+	5:  "RT_DIALOG",
+	6:  "RT_STRING",
+	7:  "RT_FONTDIR",
+	8:  "RT_FONT",
+	9:  "RT_ACCELERATOR",
+	10: "RT_RCDATA",
+	11: "RT_MESSAGETABLE",
+	12: "RT_GROUP_CURSOR",
+	14: "RT_GROUP_ICON",
+	16: "RT_VERSION",
+	17: "RT_DLGINCLUDE",
+	19: "RT_PLUGPLAY",
+	20: "RT_VXD",
+	21: "RT_ANICURSOR",
+	22: "RT_ANIICON",
+	23: "RT_HTML",
+	24: "RT_MANIFEST",
+}
+
+type resources struct {
+	img Image
+	out *decoded
+	// Offsets in the tree are relative to its root
+	address uintptr
+	data    []byte
+}
+
+// Parses the resource tree (IMAGE_DIRECTORY_ENTRY_RESOURCE), each directory, data entry, name and resource gets its own block,
+// resources are named after their path in the tree (e.g. "RT_ICON/1/1033")
+func ParseResources(img Image, dir pe.DataDirectory) ([]*contracts.MemoryBlock, error) {
+	data, offset, err := img.readAll(dir.VirtualAddress)
+	if err != nil {
+		return nil, err
+	}
+	tree := &resources{
+		img:     img,
+		out:     newDecoded(),
+		address: uintptr(offset),
+		data:    data,
+	}
+	err = tree.addDirectory(0, nil)
+	if err != nil {
+		return nil, err
+	}
+	return tree.out.blocks, nil
+}
+
+func (me *resources) addDirectory(offset uint32, path []string) error {
+	if len(path) > maxResourceDepth {
+		return fmt.Errorf("resource tree is too deep at %#x", offset)
+	}
+	if _, found := me.out.seen[me.address+uintptr(offset)]; found {
+		return fmt.Errorf("resource directory at %#x is referenced twice", offset)
+	}
+	header := ResourceDirectory{}
+	err := ReadStruct(me.data, uint64(offset), &header)
+	if err != nil {
+		return fmt.Errorf("failed to parse resource directory at %#x: %w", offset, err)
+	}
+	headerSize := uint64(binary.Size(header))
+	entrySize := uint64(binary.Size(ResourceDirectoryEntry{}))
+	count := uint64(header.NumberOfNamedEntries) + uint64(header.NumberOfIdEntries)
+	name := "Resource Directory"
+	if len(path) != 0 {
+		name = fmt.Sprintf("Resource Directory (%s)", strings.Join(path, "/"))
+	}
+	directory := me.out.add(newBlock(name, me.address+uintptr(offset), headerSize+count*entrySize))
+	parsingutils.AddStructValues(directory, &header, headerSize, parsingutils.FormatValue)
+
+	for i := uint64(0); i < count; i += 1 {
+		entryOffset := uint64(offset) + headerSize + i*entrySize
+		entry := ResourceDirectoryEntry{}
+		err = ReadStruct(me.data, entryOffset, &entry)
+		if err != nil {
+			return fmt.Errorf("failed to parse resource directory entry at %#x: %w", entryOffset, err)
+		}
+		entryName, err := me.entryName(entry, len(path))
+		if err != nil {
+			return err
+		}
+		block := addChild(directory, fmt.Sprintf("Entry (%s)", entryName), headerSize+i*entrySize, entrySize)
+		parsingutils.AddStructValues(block, &entry, entrySize, parsingutils.FormatValue)
+		if entry.Name&resourceHighBit != 0 {
+			err = parsingutils.AddLinkWithAddr(block, "Name", "name", me.address+uintptr(entry.Name&^resourceHighBit))
+			if err != nil {
+				return err
+			}
+		}
+
+		target := entry.OffsetToData &^ resourceHighBit
+		err = parsingutils.AddLinkWithAddr(block, "OffsetToData", "points to", me.address+uintptr(target))
+		if err != nil {
+			return err
+		}
+		entryPath := append(append([]string{}, path...), entryName)
+		if entry.OffsetToData&resourceHighBit != 0 {
+			err = me.addDirectory(target, entryPath)
+		} else {
+			err = me.addData(target, entryPath)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Named entries point to a counted UTF-16 string (IMAGE_RESOURCE_DIR_STRING_U), IDs of the first level are the resource types
+func (me *resources) entryName(entry ResourceDirectoryEntry, level int) (string, error) {
+	if entry.Name&resourceHighBit == 0 {
+		if level == 0 {
+			return enumName(resourceTypeNames, uint64(entry.Name)), nil
+		}
+		return fmt.Sprintf("%d", entry.Name), nil
+	}
+	offset := uint64(entry.Name &^ resourceHighBit)
+	raw, err := subSlice(me.data, offset, 2)
+	if err != nil {
+		return "", fmt.Errorf("failed to read resource name at %#x: %w", offset, err)
+	}
+	length := uint64(binary.LittleEndian.Uint16(raw))
+	raw, err = subSlice(me.data, offset+2, length*2)
+	if err != nil {
+		return "", fmt.Errorf("failed to read resource name at %#x: %w", offset, err)
+	}
+	units := make([]uint16, length)
+	for i := range units {
+		units[i] = binary.LittleEndian.Uint16(raw[i*2:])
+	}
+	name := string(utf16.Decode(units))
+	block := me.out.add(newBlock(fmt.Sprintf("%q", name), me.address+uintptr(offset), 2+length*2))
+	if len(block.Values) == 0 {
+		addValue(block, "Length", uint16(length), 0, 2)
+	}
+	return name, nil
+}
+
+func (me *resources) addData(offset uint32, path []string) error {
+	if _, found := me.out.seen[me.address+uintptr(offset)]; found {
+		return nil
+	}
+	entry := ResourceDataEntry{}
+	err := ReadStruct(me.data, uint64(offset), &entry)
+	if err != nil {
+		return fmt.Errorf("failed to parse resource data entry at %#x: %w", offset, err)
+	}
+	size := uint64(binary.Size(entry))
+	pathName := strings.Join(path, "/")
+	block := me.out.add(newBlock(fmt.Sprintf("Resource Data Entry (%s)", pathName), me.address+uintptr(offset), size))
+	parsingutils.AddStructValues(block, &entry, size, parsingutils.FormatValue)
+
+	_, dataOffset, err := me.img.read(entry.OffsetToData, uint64(entry.Size))
+	if err != nil || entry.Size == 0 {
+		// The data isn't required to be in the same section as the tree, or even in the file
+		return nil
+	}
+	data := me.out.add(newBlock(fmt.Sprintf("Resource (%s)", pathName), uintptr(dataOffset), uint64(entry.Size)))
+	return parsingutils.AddLinkWithBlock(block, "OffsetToData", data, "points to")
+}
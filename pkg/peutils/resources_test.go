@@ -0,0 +1,54 @@
+package peutils_test
+
+import (
+	"debug/pe"
+	"testing"
+
+	"github.com/LouisBrunner/mem-viz/pkg/contracts"
+	"github.com/LouisBrunner/mem-viz/pkg/contracts/contractstest"
+	"github.com/LouisBrunner/mem-viz/pkg/peutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_ParseResources(t *testing.T) {
+	section := make([]byte, 0x100)
+	copy(section[0x00:], pack(t, peutils.ResourceDirectory{NumberOfIdEntries: 1}, peutils.ResourceDirectoryEntry{Name: 24, OffsetToData: 0x80000000 | 0x18}))
+	copy(section[0x18:], pack(t, peutils.ResourceDirectory{NumberOfNamedEntries: 1}, peutils.ResourceDirectoryEntry{Name: 0x80000000 | 0x60, OffsetToData: 0x80000000 | 0x30}))
+	copy(section[0x30:], pack(t, peutils.ResourceDirectory{NumberOfIdEntries: 1}, peutils.ResourceDirectoryEntry{Name: 1033, OffsetToData: 0x48}))
+	copy(section[0x48:], pack(t, peutils.ResourceDataEntry{OffsetToData: 0x1080, Size: 4}))
+	copy(section[0x60:], pack(t, uint16(3), []uint16{'A', 'P', 'P'}))
+	copy(section[0x80:], "abcd")
+	img := newImage(false, section)
+
+	blocks, err := peutils.ParseResources(img, pe.DataDirectory{VirtualAddress: 0x1000, Size: 0x84})
+	require.NoError(t, err)
+	require.Len(t, blocks, 6)
+
+	root := contractstest.FindBlock(t, blocks, "Resource Directory")
+	assert.Equal(t, uintptr(0x200), root.Address)
+	assert.Equal(t, uint64(24), root.Size)
+	require.Len(t, root.Content, 1)
+	assert.Equal(t, "Entry (RT_MANIFEST)", root.Content[0].Name)
+	assert.Equal(t, uint64(0x218), contractstest.FindValue(t, root.Content[0], "OffsetToData").Links[0].TargetAddress)
+
+	named := contractstest.FindBlock(t, blocks, "Resource Directory (RT_MANIFEST)")
+	require.Len(t, named.Content, 1)
+	assert.Equal(t, "Entry (APP)", named.Content[0].Name)
+	assert.Equal(t, contracts.MemoryLink{Name: "name", TargetAddress: 0x260}, *contractstest.FindValue(t, named.Content[0], "Name").Links[0])
+	name := contractstest.FindBlock(t, blocks, `"APP"`)
+	assert.Equal(t, uint64(8), name.Size)
+
+	contractstest.FindBlock(t, blocks, "Resource Directory (RT_MANIFEST/APP)")
+	entry := contractstest.FindBlock(t, blocks, "Resource Data Entry (RT_MANIFEST/APP/1033)")
+	assert.Equal(t, uintptr(0x248), entry.Address)
+	assert.Equal(t, uint64(0x280), contractstest.FindValue(t, entry, "OffsetToData").Links[0].TargetAddress)
+	data := contractstest.FindBlock(t, blocks, "Resource (RT_MANIFEST/APP/1033)")
+	assert.Equal(t, uint64(4), data.Size)
+}
+
+func Test_ParseResources_loop(t *testing.T) {
+	section := pack(t, peutils.ResourceDirectory{NumberOfIdEntries: 1}, peutils.ResourceDirectoryEntry{Name: 3, OffsetToData: 0x80000000})
+	_, err := peutils.ParseResources(newImage(false, section), pe.DataDirectory{VirtualAddress: 0x1000, Size: 0x18})
+	assert.Error(t, err)
+}
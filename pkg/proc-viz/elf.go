@@ -0,0 +1,184 @@
+package proc
+
+import (
+	"debug/elf"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/LouisBrunner/mem-viz/pkg/contracts"
+	"github.com/LouisBrunner/mem-viz/pkg/elfutils"
+	"github.com/LouisBrunner/mem-viz/pkg/parsingutils"
+)
+
+// An ELF file mapped in the process (executable, shared object or the loader itself)
+type image struct {
+	progs []*elf.Prog
+	// Mapping containing the ELF header (offset 0)
+	base VMA
+	// Difference between the addresses in the file and in the process (0 for non-PIE executables)
+	bias uint64
+	// End of the last PT_LOAD, the anonymous mappings before it are its bss
+	end uint64
+	// Headers read from the file, programs is nil when they aren't mapped with the ELF header
+	header   *contracts.MemoryBlock
+	programs *contracts.MemoryBlock
+}
+
+// Reads the headers of the file mapped by the given VMAs, nil if it isn't an ELF (e.g. locale-archive or fonts)
+func (me *parser) loadImage(vmas []VMA) *image {
+	path := vmas[0].Path
+	img, err := me.readImage(path, vmas)
+	if err != nil {
+		me.logger.Debugf("not decoding %s: %v", path, err)
+		return nil
+	}
+	return img
+}
+
+func (me *parser) readImage(path string, vmas []VMA) (*image, error) {
+	if strings.HasSuffix(path, " (deleted)") {
+		return nil, fmt.Errorf("file was deleted")
+	}
+	img := &image{}
+	found := false
+	for _, vma := range vmas {
+		if vma.Offset == 0 {
+			img.base, found = vma, true
+			break
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("ELF header is not mapped")
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	file, err := elf.NewFile(f)
+	if err != nil {
+		return nil, err
+	}
+	layout := elfutils.Image{
+		Class:     file.Class,
+		ByteOrder: file.ByteOrder,
+		Machine:   file.Machine,
+	}
+
+	pageSize := uint64(os.Getpagesize())
+	loaded := false
+	for _, prog := range file.Progs {
+		if prog.Type != elf.PT_LOAD {
+			continue
+		}
+		if !loaded {
+			// The loader maps the first PT_LOAD (which contains the ELF header) at the page of its address
+			if prog.Off >= pageSize {
+				return nil, fmt.Errorf("first PT_LOAD doesn't start the file")
+			}
+			img.bias = img.base.Start - prog.Vaddr&^(pageSize-1)
+			loaded = true
+		}
+		img.end = img.bias + prog.Vaddr + prog.Memsz
+	}
+	if !loaded {
+		return nil, fmt.Errorf("no PT_LOAD")
+	}
+	img.progs = file.Progs
+
+	var raw any = &elf.Header32{}
+	if layout.Is64() {
+		raw = &elf.Header64{}
+	}
+	data, err := readAt(f, 0, uint64(binary.Size(raw)))
+	if err != nil {
+		return nil, err
+	}
+	header, tables, err := elfutils.ParseHeader(data, uintptr(img.base.Start), elfutils.HeaderOptions{
+		Image:   layout,
+		Resolve: me.resolver(img.bias),
+	})
+	if err != nil {
+		return nil, err
+	}
+	img.header = header
+
+	size := tables.Phnum * tables.Phentsize
+	if tables.Phoff < header.Size || tables.Phoff+size > img.base.Size() {
+		me.logger.Debugf("program headers of %s are not mapped with its ELF header", path)
+		return img, nil
+	}
+	data, err = readAt(f, tables.Phoff, size)
+	if err != nil {
+		return nil, err
+	}
+	img.programs, err = elfutils.ParseProgramHeaders(data, uintptr(img.base.Start+tables.Phoff), elfutils.ProgramHeadersOptions{
+		Image:     layout,
+		EntrySize: tables.Phentsize,
+		Resolve:   me.resolver(img.bias),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return img, nil
+}
+
+func readAt(f *os.File, offset, size uint64) ([]byte, error) {
+	data := make([]byte, size)
+	_, err := f.ReadAt(data, int64(offset))
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// Turns the VM addresses of the file into addresses in the process, as long as they are mapped
+func (me *parser) resolver(bias uint64) parsingutils.Resolver {
+	return func(vmAddr uint64) (uintptr, bool) {
+		addr := bias + vmAddr
+		if _, found := me.findVMA(addr); !found {
+			return 0, false
+		}
+		return uintptr(addr), true
+	}
+}
+
+// Adds the headers to the VMA containing them and links the VMA to the program headers of its segments
+func (me *parser) addImage(block *contracts.MemoryBlock, vma VMA, img *image) error {
+	if vma.Start == img.base.Start {
+		addChild(block, img.header)
+		if img.programs != nil {
+			addChild(block, img.programs)
+			err := parsingutils.AddLinkWithBlock(img.header, "Phoff", img.programs, "points to")
+			if err != nil {
+				return err
+			}
+			err = parsingutils.AddLinkWithBlock(img.header, "Phnum", img.programs, "gives amount")
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if img.programs == nil {
+		return nil
+	}
+
+	pageSize := uint64(os.Getpagesize())
+	for i, prog := range img.progs {
+		if prog.Type != elf.PT_LOAD {
+			continue
+		}
+		start := (img.bias + prog.Vaddr) &^ (pageSize - 1)
+		if vma.Start < start || vma.Start >= img.bias+prog.Vaddr+prog.Memsz {
+			continue
+		}
+		err := parsingutils.AddLinkWithBlock(block, "Offset", img.programs.Content[i], "refers to")
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
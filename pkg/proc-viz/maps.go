@@ -0,0 +1,124 @@
+package proc
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// One line of /proc/<pid>/maps, along with its statistics when it comes from smaps
+type VMA struct {
+	Start  uint64
+	End    uint64
+	Perms  string
+	Offset uint64
+	Device string
+	Inode  uint64
+	// Backing file or pseudo-path (e.g. [heap]), empty for anonymous mappings
+	Path string
+	// Fields of smaps in kB (e.g. Rss or Swap), nil when parsing maps
+	Stats map[string]uint64
+}
+
+func (me VMA) Size() uint64 {
+	return me.End - me.Start
+}
+
+// Backed by an actual file (as opposed to [heap], [vdso], etc)
+func (me VMA) IsFile() bool {
+	return strings.HasPrefix(me.Path, "/")
+}
+
+// Parses the content of /proc/<pid>/maps or /proc/<pid>/smaps
+func ParseMaps(r io.Reader) ([]VMA, error) {
+	vmas := []VMA{}
+	scanner := bufio.NewScanner(r)
+	for lineNo := 1; scanner.Scan(); lineNo += 1 {
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+		key, rest, found := strings.Cut(line, ":")
+		// smaps fields look like "Rss:   8 kB", which can't be mistaken for a mapping ("start-end perms ...")
+		if found && !strings.Contains(key, " ") {
+			if len(vmas) == 0 {
+				return nil, fmt.Errorf("line %d: field %q before any mapping", lineNo, key)
+			}
+			parseStat(&vmas[len(vmas)-1], key, rest)
+			continue
+		}
+		vma, err := parseMapping(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNo, err)
+		}
+		vmas = append(vmas, vma)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return vmas, nil
+}
+
+// Cuts the next space-separated field, the padding before the path is variable
+func nextField(line string) (string, string) {
+	field, rest, _ := strings.Cut(strings.TrimLeft(line, " "), " ")
+	return field, rest
+}
+
+func parseMapping(line string) (VMA, error) {
+	vma := VMA{}
+	bounds, rest := nextField(line)
+	vma.Perms, rest = nextField(rest)
+	offset, rest := nextField(rest)
+	vma.Device, rest = nextField(rest)
+	inode, rest := nextField(rest)
+	// Paths can contain spaces, so only the padding is removed
+	vma.Path = strings.TrimLeft(rest, " ")
+
+	start, end, found := strings.Cut(bounds, "-")
+	if !found {
+		return vma, fmt.Errorf("invalid bounds %q", bounds)
+	}
+	var err error
+	vma.Start, err = strconv.ParseUint(start, 16, 64)
+	if err != nil {
+		return vma, fmt.Errorf("invalid start: %w", err)
+	}
+	vma.End, err = strconv.ParseUint(end, 16, 64)
+	if err != nil {
+		return vma, fmt.Errorf("invalid end: %w", err)
+	}
+	if vma.End < vma.Start {
+		return vma, fmt.Errorf("invalid bounds %q", bounds)
+	}
+	if len(vma.Perms) != 4 {
+		return vma, fmt.Errorf("invalid permissions %q", vma.Perms)
+	}
+	vma.Offset, err = strconv.ParseUint(offset, 16, 64)
+	if err != nil {
+		return vma, fmt.Errorf("invalid offset: %w", err)
+	}
+	vma.Inode, err = strconv.ParseUint(inode, 10, 64)
+	if err != nil {
+		return vma, fmt.Errorf("invalid inode: %w", err)
+	}
+	return vma, nil
+}
+
+// Only the sizes are kept, other fields (e.g. VmFlags or THPeligible) are ignored
+func parseStat(vma *VMA, key, value string) {
+	amount, unit := nextField(value)
+	if strings.TrimSpace(unit) != "kB" {
+		return
+	}
+	size, err := strconv.ParseUint(amount, 10, 64)
+	if err != nil {
+		return
+	}
+	if vma.Stats == nil {
+		vma.Stats = map[string]uint64{}
+	}
+	vma.Stats[key] = size
+}
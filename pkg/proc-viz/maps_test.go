@@ -0,0 +1,68 @@
+package proc_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/LouisBrunner/mem-viz/pkg/proc-viz"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_ParseMaps(t *testing.T) {
+	vmas, err := proc.ParseMaps(strings.NewReader(`55daa8a97000-55daa8a99000 r--p 00000000 fe:00 681885                     /usr/bin/head
+55daa8a99000-55daa8a9f000 r-xp 00002000 fe:00 681885                     /usr/bin/head
+55dab0b1c000-55dab0b3d000 rw-p 00000000 00:00 0                          [heap]
+7f2a4c000000-7f2a4c021000 rw-p 00000000 00:00 0 
+7f2a4c400000-7f2a4c401000 r--p 00000000 00:1f 12                         /tmp/with space (deleted)
+`))
+	require.NoError(t, err)
+	require.Len(t, vmas, 5)
+
+	assert.Equal(t, proc.VMA{
+		Start:  0x55daa8a99000,
+		End:    0x55daa8a9f000,
+		Perms:  "r-xp",
+		Offset: 0x2000,
+		Device: "fe:00",
+		Inode:  681885,
+		Path:   "/usr/bin/head",
+	}, vmas[1])
+	assert.Equal(t, uint64(0x6000), vmas[1].Size())
+	assert.True(t, vmas[1].IsFile())
+
+	assert.Equal(t, "[heap]", vmas[2].Path)
+	assert.False(t, vmas[2].IsFile())
+	assert.Equal(t, "", vmas[3].Path)
+	assert.Equal(t, "/tmp/with space (deleted)", vmas[4].Path)
+}
+
+func Test_ParseMaps_Smaps(t *testing.T) {
+	vmas, err := proc.ParseMaps(strings.NewReader(`55daa8a97000-55daa8a99000 r--p 00000000 fe:00 681885                     /usr/bin/head
+Size:                  8 kB
+Rss:                   8 kB
+Pss:                   4 kB
+Swap:                  0 kB
+THPeligible:           0
+VmFlags: rd mr mw me 
+7ffd1c5e5000-7ffd1c606000 rw-p 00000000 00:00 0                          [stack]
+Rss:                  12 kB
+`))
+	require.NoError(t, err)
+	require.Len(t, vmas, 2)
+	assert.Equal(t, map[string]uint64{"Size": 8, "Rss": 8, "Pss": 4, "Swap": 0}, vmas[0].Stats)
+	assert.Equal(t, map[string]uint64{"Rss": 12}, vmas[1].Stats)
+}
+
+func Test_ParseMaps_Invalid(t *testing.T) {
+	for _, input := range []string{
+		"Rss: 8 kB\n",
+		"55daa8a97000 r--p 00000000 fe:00 681885 /usr/bin/head\n",
+		"55daa8a99000-55daa8a97000 r--p 00000000 fe:00 681885 /usr/bin/head\n",
+		"55daa8a97000-55daa8a99000 r-- 00000000 fe:00 681885 /usr/bin/head\n",
+		"55daa8a97000-55daa8a99000 r--p 00000000 fe:00 inode /usr/bin/head\n",
+	} {
+		_, err := proc.ParseMaps(strings.NewReader(input))
+		assert.Error(t, err, input)
+	}
+}
@@ -0,0 +1,183 @@
+package proc
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/LouisBrunner/mem-viz/pkg/contracts"
+	"github.com/LouisBrunner/mem-viz/pkg/parsingutils"
+	"github.com/sirupsen/logrus"
+)
+
+// Statistics from smaps shown on each VMA (and summed for each file)
+var statNames = []string{"Rss", "Pss", "Swap"}
+
+type parser struct {
+	logger *logrus.Logger
+	pid    int
+	vmas   []VMA
+}
+
+func Parse(logger *logrus.Logger, pid int) (*contracts.MemoryBlock, error) {
+	vmas, err := readMaps(logger, pid)
+	if err != nil {
+		return nil, err
+	}
+	if len(vmas) == 0 {
+		return nil, fmt.Errorf("process %d has no mappings", pid)
+	}
+	p := &parser{
+		logger: logger,
+		pid:    pid,
+		vmas:   vmas,
+	}
+	return p.parse()
+}
+
+// smaps needs more permissions than maps (and is much slower to generate), so maps is used as a fallback
+func readMaps(logger *logrus.Logger, pid int) ([]VMA, error) {
+	data, err := readProcFile(pid, "smaps")
+	if err != nil {
+		logger.Warnf("failed to read smaps, falling back to maps: %v", err)
+		data, err = readProcFile(pid, "maps")
+		if err != nil {
+			return nil, err
+		}
+	}
+	return ParseMaps(bytes.NewReader(data))
+}
+
+func (me *parser) parse() (*contracts.MemoryBlock, error) {
+	name := fmt.Sprintf("Process %d", me.pid)
+	comm, err := readProcFile(me.pid, "comm")
+	if err != nil {
+		me.logger.Warnf("failed to read process name: %v", err)
+	} else {
+		name = fmt.Sprintf("%s (%s)", name, strings.TrimSpace(string(comm)))
+	}
+
+	root := &contracts.MemoryBlock{
+		Name:    name,
+		Address: uintptr(me.vmas[0].Start),
+	}
+	for i := 0; i < len(me.vmas); {
+		vma := me.vmas[i]
+		if !vma.IsFile() {
+			addChild(root, me.newVMA(vma, vmaLabel(vma)))
+			i += 1
+			continue
+		}
+		end, err := me.addFile(root, i)
+		if err != nil {
+			return nil, err
+		}
+		i = end
+	}
+	return root, nil
+}
+
+// Groups the consecutive VMAs mapping the same file, along with the anonymous ones the loader added for its bss,
+// returns the index of the first VMA after the group
+func (me *parser) addFile(root *contracts.MemoryBlock, start int) (int, error) {
+	path := me.vmas[start].Path
+	end := start + 1
+	for end < len(me.vmas) && me.vmas[end].Path == path {
+		end += 1
+	}
+	img := me.loadImage(me.vmas[start:end])
+	if img != nil {
+		for end < len(me.vmas) && me.vmas[end].Path == "" && me.vmas[end].Start < img.end {
+			end += 1
+		}
+	}
+	vmas := me.vmas[start:end]
+
+	group := &contracts.MemoryBlock{
+		Name:    fmt.Sprintf("%s (%d VMAs)", path, len(vmas)),
+		Address: uintptr(vmas[0].Start),
+		Size:    vmas[len(vmas)-1].End - vmas[0].Start,
+	}
+	addChild(root, group)
+	for _, stat := range statNames {
+		total, found := uint64(0), false
+		for _, vma := range vmas {
+			size, ok := vma.Stats[stat]
+			total += size
+			found = found || ok
+		}
+		if found {
+			parsingutils.AddValue(group, stat, total, 0, 0, formatValue)
+		}
+	}
+
+	for _, vma := range vmas {
+		label := vmaLabel(vma)
+		if vma.IsFile() {
+			label = fmt.Sprintf("%s +%#x", filepath.Base(vma.Path), vma.Offset)
+		}
+		block := me.newVMA(vma, label)
+		addChild(group, block)
+		if img == nil {
+			continue
+		}
+		err := me.addImage(block, vma, img)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return end, nil
+}
+
+func vmaLabel(vma VMA) string {
+	if vma.Path == "" {
+		return "Anonymous"
+	}
+	return vma.Path
+}
+
+func (me *parser) newVMA(vma VMA, label string) *contracts.MemoryBlock {
+	block := &contracts.MemoryBlock{
+		Name:    fmt.Sprintf("%s (%s)", label, vma.Perms),
+		Address: uintptr(vma.Start),
+		Size:    vma.Size(),
+	}
+	parsingutils.AddValue(block, "Perms", vma.Perms, 0, 0, formatValue)
+	parsingutils.AddValue(block, "Offset", vma.Offset, 0, 0, formatValue)
+	parsingutils.AddValue(block, "Device", vma.Device, 0, 0, formatValue)
+	parsingutils.AddValue(block, "Inode", vma.Inode, 0, 0, formatValue)
+	for _, stat := range statNames {
+		if size, found := vma.Stats[stat]; found {
+			parsingutils.AddValue(block, stat, size, 0, 0, formatValue)
+		}
+	}
+	return block
+}
+
+// Finds the VMA containing the given address
+func (me *parser) findVMA(addr uint64) (VMA, bool) {
+	i := sort.Search(len(me.vmas), func(i int) bool {
+		return me.vmas[i].End > addr
+	})
+	if i == len(me.vmas) || me.vmas[i].Start > addr {
+		return VMA{}, false
+	}
+	return me.vmas[i], true
+}
+
+func addChild(parent, child *contracts.MemoryBlock) {
+	child.ParentOffset = uint64(child.Address - parent.Address)
+	parent.Content = append(parent.Content, child)
+}
+
+func formatValue(name string, value interface{}) string {
+	switch name {
+	case "Inode":
+		return fmt.Sprintf("%d", value)
+	case "Rss", "Pss", "Swap":
+		return fmt.Sprintf("%d kB", value)
+	}
+	return parsingutils.FormatValue(name, value)
+}
@@ -0,0 +1,52 @@
+package proc_test
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/LouisBrunner/mem-viz/pkg/checker"
+	"github.com/LouisBrunner/mem-viz/pkg/contracts"
+	"github.com/LouisBrunner/mem-viz/pkg/proc-viz"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func findBlock(block *contracts.MemoryBlock, match func(block *contracts.MemoryBlock) bool) *contracts.MemoryBlock {
+	if match(block) {
+		return block
+	}
+	for _, child := range block.Content {
+		if found := findBlock(child, match); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+func Test_Parse_Self(t *testing.T) {
+	logger := logrus.New()
+	root, err := proc.Parse(logger, os.Getpid())
+	require.NoError(t, err)
+	require.NoError(t, checker.Check(logger, root))
+
+	executable, err := os.Executable()
+	require.NoError(t, err)
+	group := findBlock(root, func(block *contracts.MemoryBlock) bool {
+		return strings.HasPrefix(block.Name, executable+" (")
+	})
+	require.NotNil(t, group, "no group for %s", executable)
+	assert.Equal(t, "Rss", group.Values[0].Name)
+
+	header := findBlock(group, func(block *contracts.MemoryBlock) bool {
+		return block.Name == "ELF Header"
+	})
+	require.NotNil(t, header)
+	code := findBlock(group, func(block *contracts.MemoryBlock) bool {
+		return strings.HasSuffix(block.Name, "(r-xp)")
+	})
+	require.NotNil(t, code)
+	assert.Equal(t, "Offset", code.Values[1].Name)
+	assert.Len(t, code.Values[1].Links, 1)
+}
@@ -0,0 +1,10 @@
+package proc
+
+import (
+	"fmt"
+	"os"
+)
+
+func readProcFile(pid int, name string) ([]byte, error) {
+	return os.ReadFile(fmt.Sprintf("/proc/%d/%s", pid, name))
+}
@@ -0,0 +1,12 @@
+//go:build !linux
+// +build !linux
+
+package proc
+
+import (
+	"fmt"
+)
+
+func readProcFile(pid int, name string) ([]byte, error) {
+	return nil, fmt.Errorf("not available on this platform")
+}
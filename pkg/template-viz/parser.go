@@ -0,0 +1,64 @@
+package template
+
+import (
+	"os"
+
+	"github.com/LouisBrunner/mem-viz/pkg/contracts"
+	"github.com/LouisBrunner/mem-viz/pkg/parsingutils"
+	"github.com/LouisBrunner/mem-viz/pkg/templateutils"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/exp/slices"
+)
+
+type parser struct {
+	logger *logrus.Logger
+}
+
+func Parse(logger *logrus.Logger, file, templateFile string) (*contracts.MemoryBlock, error) {
+	p := &parser{
+		logger: logger,
+	}
+	return p.parse(file, templateFile)
+}
+
+func (me *parser) parse(file, templateFile string) (*contracts.MemoryBlock, error) {
+	f, err := os.Open(templateFile)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	tmpl, err := templateutils.Load(f)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	blocks, err := tmpl.Apply(data)
+	if err != nil {
+		return nil, err
+	}
+
+	root := &contracts.MemoryBlock{
+		Name: file,
+		Size: uint64(len(data)),
+	}
+	// Blocks placed with "at" can be anywhere (even inside each other), so they are nested from the lowest address
+	slices.SortStableFunc(blocks, func(a, b *contracts.MemoryBlock) int {
+		if a.Address != b.Address {
+			return int(a.Address) - int(b.Address)
+		}
+		return int(b.Size) - int(a.Size)
+	})
+	for _, block := range blocks {
+		parent, sibling := parsingutils.AddChildDeep(root, block)
+		if sibling != nil {
+			me.logger.Warnf("dropping %s as it overlaps %s", block.Name, sibling.Name)
+			continue
+		}
+		block.ParentOffset = uint64(block.Address - parent.Address)
+	}
+
+	return root, nil
+}
@@ -0,0 +1,267 @@
+package templateutils
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/LouisBrunner/mem-viz/pkg/contracts"
+	"github.com/LouisBrunner/mem-viz/pkg/parsingutils"
+	"golang.org/x/exp/slices"
+)
+
+// Templates can be recursive (e.g. trees), this stops the ones which never end
+const maxDepth = 64
+
+// Fields of the struct being applied and of the structs containing it, used by expressions and labels
+type scope struct {
+	parent *scope
+	block  *contracts.MemoryBlock
+	// Where the struct starts and where its next field goes (file offsets)
+	offset uint64
+	cursor uint64
+	// Index in its array, -1 when the struct isn't in one
+	index  int64
+	values map[string]any
+	// How each value is shown in labels (e.g. the name of an enum)
+	texts map[string]string
+}
+
+type engine struct {
+	tmpl  *Template
+	data  []byte
+	depth int
+	// Blocks placed with "at", they are only positioned by their address
+	placed []*contracts.MemoryBlock
+}
+
+// Lays out the root struct at the start of the data, blocks are given at their file offset (i.e. the file is expected
+// to start at 0). The first block is the root struct, the others are the fields placed with "at" (after their contents),
+// they still need to be nested where they belong in the file
+func (me *Template) Apply(data []byte) ([]*contracts.MemoryBlock, error) {
+	e := &engine{tmpl: me, data: data}
+	global := &scope{
+		index:  -1,
+		values: map[string]any{"_size": int64(len(data))},
+		texts:  map[string]string{},
+	}
+	name := me.Name
+	if name == "" {
+		name = me.Root
+	}
+	root, err := e.applyStruct(me.Structs[me.Root], name, 0, global, -1)
+	if err != nil {
+		return nil, err
+	}
+	return append([]*contracts.MemoryBlock{root}, e.placed...), nil
+}
+
+func (me *scope) lookup(name string) (any, bool) {
+	switch name {
+	case "_offset":
+		return int64(me.offset), true
+	case "_pos":
+		return int64(me.cursor - me.offset), true
+	case "_index":
+		for s := me; s != nil; s = s.parent {
+			if s.index >= 0 {
+				return s.index, true
+			}
+		}
+		return nil, false
+	}
+	owner := me.owner(name)
+	if owner == nil {
+		return nil, false
+	}
+	return owner.values[name], true
+}
+
+// Closest scope which has the field
+func (me *scope) owner(name string) *scope {
+	for s := me; s != nil; s = s.parent {
+		if _, found := s.values[name]; found {
+			return s
+		}
+	}
+	return nil
+}
+
+var labelField = regexp.MustCompile(`\{(\w+)\}`)
+
+// e.g. "Entry {id}" becomes "Entry 3", unknown fields are kept as is
+func (me *scope) expand(label string) string {
+	return labelField.ReplaceAllStringFunc(label, func(match string) string {
+		name := match[1 : len(match)-1]
+		if owner := me.owner(name); owner != nil {
+			if text, found := owner.texts[name]; found {
+				return text
+			}
+		}
+		if value, found := me.lookup(name); found {
+			return fmt.Sprintf("%v", value)
+		}
+		return match
+	})
+}
+
+func (me *scope) set(name string, value any, text string) {
+	me.values[name] = value
+	me.texts[name] = text
+}
+
+func newBlock(name string, offset, size uint64) *contracts.MemoryBlock {
+	return &contracts.MemoryBlock{
+		Name:    name,
+		Address: uintptr(offset),
+		Size:    size,
+	}
+}
+
+func addChild(parent, child *contracts.MemoryBlock) {
+	child.ParentOffset = uint64(child.Address - parent.Address)
+	parent.Content = append(parent.Content, child)
+}
+
+func (me *engine) slice(offset, size uint64) ([]byte, error) {
+	if offset > uint64(len(me.data)) || size > uint64(len(me.data))-offset {
+		return nil, fmt.Errorf("out of bounds: %#x+%#x > %#x", offset, size, len(me.data))
+	}
+	return me.data[offset : offset+size], nil
+}
+
+func (me *engine) applyStruct(structure *Struct, name string, offset uint64, parent *scope, index int64) (*contracts.MemoryBlock, error) {
+	if me.depth >= maxDepth {
+		return nil, fmt.Errorf("structs are nested more than %d times", maxDepth)
+	}
+	me.depth += 1
+	defer func() { me.depth -= 1 }()
+
+	block := newBlock(name, offset, 0)
+	s := &scope{
+		parent: parent,
+		block:  block,
+		offset: offset,
+		cursor: offset,
+		index:  index,
+		values: map[string]any{},
+		texts:  map[string]string{},
+	}
+	for _, field := range structure.Fields {
+		err := me.applyField(field, s)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", field.Name, err)
+		}
+	}
+
+	block.Size = s.cursor - offset
+	if structure.size != nil {
+		err := me.resize(block, structure.size, s)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if structure.Label != "" {
+		block.Name = s.expand(structure.Label)
+	}
+	return block, nil
+}
+
+// Gives a struct the size from an expression, which can't be smaller than its fields
+func (me *engine) resize(block *contracts.MemoryBlock, size *expression, s *scope) error {
+	fixed, err := size.evalUint(s)
+	if err != nil {
+		return err
+	}
+	if fixed < block.Size {
+		return fmt.Errorf("size %#x is smaller than the fields (%#x)", fixed, block.Size)
+	}
+	_, err = me.slice(uint64(block.Address), fixed)
+	if err != nil {
+		return err
+	}
+	block.Size = fixed
+	return nil
+}
+
+func (me *engine) applyField(field *Field, s *scope) error {
+	if field.cond != nil {
+		ok, err := field.cond.evalBool(s)
+		if err != nil || !ok {
+			return err
+		}
+	}
+	typ := field.typ
+	if field.switchOn != nil {
+		value, err := field.switchOn.evalInt(s)
+		if err != nil {
+			return err
+		}
+		typ = field.cases[value]
+		if typ == nil {
+			typ = field.fallback
+		}
+		if typ == nil {
+			return nil
+		}
+	}
+
+	offset := s.cursor
+	if field.at != nil {
+		target, err := field.at.evalUint(s)
+		if err != nil {
+			return err
+		}
+		if field.Base == BaseStruct {
+			target += s.offset
+		}
+		offset = target
+	}
+
+	inline := field.at == nil
+	var block *contracts.MemoryBlock
+	var size uint64
+	var err error
+	if field.count != nil {
+		block, err = me.applyArray(field, typ, s, offset)
+	} else {
+		block, size, err = me.applySingle(field, typ, s, offset, inline)
+	}
+	if err != nil {
+		return err
+	}
+
+	// Inline numbers and strings are values of their struct instead of blocks
+	if block == nil {
+		s.cursor += size
+		return nil
+	}
+	err = me.link(s, field.count, "gives amount", block)
+	if err != nil {
+		return err
+	}
+	err = me.link(s, field.size, "gives size", block)
+	if err != nil {
+		return err
+	}
+	if inline {
+		addChild(s.block, block)
+		s.cursor += block.Size
+		return nil
+	}
+	me.placed = append(me.placed, block)
+	return me.link(s, field.at, "points to", block)
+}
+
+// Links the field used by an expression (when it is only a field) to the block it describes
+func (me *engine) link(s *scope, expr *expression, name string, block *contracts.MemoryBlock) error {
+	field, ok := expr.field()
+	if !ok {
+		return nil
+	}
+	owner := s.owner(field)
+	// Fields placed with "at" are in their own block
+	if owner == nil || owner.block == nil || !slices.ContainsFunc(owner.block.Values, func(value *contracts.MemoryValue) bool { return value.Name == field }) {
+		return nil
+	}
+	return parsingutils.AddLinkWithBlock(owner.block, field, block, name)
+}
@@ -0,0 +1,250 @@
+package templateutils
+
+import (
+	"fmt"
+
+	"github.com/LouisBrunner/mem-viz/pkg/exprutils"
+)
+
+// Expressions are used for counts, sizes, offsets and conditions (e.g. "count * 4" or "version >= 2 && flags & 1"),
+// they are parsed when the template is loaded and evaluated against the fields which were already read.
+// Values are either integers (int64) or strings, comparisons and logical operators give 0 or 1
+
+type environment interface {
+	lookup(name string) (any, bool)
+}
+
+type expression struct {
+	exprutils.Expression
+}
+
+// Binary operators from the loosest to the tightest, as in C
+var precedences = map[string]int{
+	"||": 1,
+	"&&": 2,
+	"|":  3,
+	"^":  4,
+	"&":  5,
+	"==": 6, "!=": 6,
+	"<": 7, "<=": 7, ">": 7, ">=": 7,
+	"<<": 8, ">>": 8,
+	"+": 9, "-": 9,
+	"*": 10, "/": 10, "%": 10,
+}
+
+var syntax = exprutils.Syntax{
+	Operators: []string{"||", "&&", "==", "!=", "<=", ">=", "<<", ">>", "|", "^", "&", "<", ">", "+", "-", "*", "/", "%", "!", "~", "(", ")"},
+}
+
+func parseExpression(source string) (*expression, error) {
+	parsed, err := exprutils.Parse(source, syntax, parseBinary)
+	if err != nil {
+		return nil, err
+	}
+	return &expression{*parsed}, nil
+}
+
+func parseBinary(p *exprutils.Parser) (exprutils.Node, error) {
+	return p.ParseBinary(precedences, 1, func() (exprutils.Node, error) {
+		return p.ParseUnary([]string{"-", "!", "~"}, func() (exprutils.Node, error) {
+			return parsePrimary(p)
+		})
+	})
+}
+
+func parsePrimary(p *exprutils.Parser) (exprutils.Node, error) {
+	tok, ok := p.Next()
+	if !ok {
+		return nil, fmt.Errorf("unexpected end")
+	}
+	switch tok.Kind {
+	case exprutils.TokenInt, exprutils.TokenString:
+		return &exprutils.Literal{Value: tok.Value}, nil
+	case exprutils.TokenName:
+		switch tok.Text {
+		case "true":
+			return &exprutils.Literal{Value: int64(1)}, nil
+		case "false":
+			return &exprutils.Literal{Value: int64(0)}, nil
+		}
+		return &exprutils.Name{Name: tok.Text}, nil
+	}
+	if tok.Text != "(" {
+		return nil, fmt.Errorf("unexpected %q", tok.Text)
+	}
+	x, err := parseBinary(p)
+	if err != nil {
+		return nil, err
+	}
+	if !p.Accept(")") {
+		return nil, fmt.Errorf("missing )")
+	}
+	return x, nil
+}
+
+func (me *expression) eval(env environment) (any, error) {
+	value, err := evalNode(me.Root, env)
+	if err != nil {
+		return nil, fmt.Errorf("failed to evaluate %q: %w", me.Source, err)
+	}
+	return value, nil
+}
+
+func (me *expression) evalInt(env environment) (int64, error) {
+	value, err := me.eval(env)
+	if err != nil {
+		return 0, err
+	}
+	n, ok := value.(int64)
+	if !ok {
+		return 0, fmt.Errorf("%q is not a number", me.Source)
+	}
+	return n, nil
+}
+
+func (me *expression) evalUint(env environment) (uint64, error) {
+	n, err := me.evalInt(env)
+	if err != nil {
+		return 0, err
+	}
+	return exprutils.Unsigned(&me.Expression, n)
+}
+
+func (me *expression) evalBool(env environment) (bool, error) {
+	value, err := me.eval(env)
+	if err != nil {
+		return false, err
+	}
+	return truthy(value), nil
+}
+
+// Name of the field when the expression is only a reference to it (e.g. "count"), used to add links
+func (me *expression) field() (string, bool) {
+	if me == nil {
+		return "", false
+	}
+	name, ok := me.Root.(*exprutils.Name)
+	if !ok {
+		return "", false
+	}
+	return name.Name, true
+}
+
+func truthy(value any) bool {
+	switch v := value.(type) {
+	case int64:
+		return v != 0
+	case string:
+		return v != ""
+	}
+	return false
+}
+
+func fromBool(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func evalNode(n exprutils.Node, env environment) (any, error) {
+	switch n := n.(type) {
+	case *exprutils.Literal:
+		return n.Value, nil
+	case *exprutils.Name:
+		value, found := env.lookup(n.Name)
+		if !found {
+			return nil, fmt.Errorf("unknown field %q", n.Name)
+		}
+		return value, nil
+	case *exprutils.Unary:
+		return evalUnary(n, env)
+	case *exprutils.Binary:
+		return evalBinary(n, env)
+	}
+	return nil, fmt.Errorf("unknown expression %T", n)
+}
+
+func evalUnary(n *exprutils.Unary, env environment) (any, error) {
+	value, err := evalNode(n.X, env)
+	if err != nil {
+		return nil, err
+	}
+	if n.Op == "!" {
+		return fromBool(!truthy(value)), nil
+	}
+	x, ok := value.(int64)
+	if !ok {
+		return nil, fmt.Errorf("%s needs a number", n.Op)
+	}
+	if n.Op == "-" {
+		return -x, nil
+	}
+	return ^x, nil
+}
+
+func evalBinary(n *exprutils.Binary, env environment) (any, error) {
+	x, err := evalNode(n.X, env)
+	if err != nil {
+		return nil, err
+	}
+	// Short-circuit so conditions can guard fields which might not exist (e.g. "version > 1 && extra")
+	switch n.Op {
+	case "&&":
+		if !truthy(x) {
+			return int64(0), nil
+		}
+	case "||":
+		if truthy(x) {
+			return int64(1), nil
+		}
+	}
+	y, err := evalNode(n.Y, env)
+	if err != nil {
+		return nil, err
+	}
+	switch n.Op {
+	case "&&", "||":
+		return fromBool(truthy(y)), nil
+	}
+
+	if xs, ok := x.(string); ok {
+		ys, ok := y.(string)
+		if !ok {
+			return nil, fmt.Errorf("cannot compare a string with a number")
+		}
+		switch n.Op {
+		case "==":
+			return fromBool(xs == ys), nil
+		case "!=":
+			return fromBool(xs != ys), nil
+		case "+":
+			return xs + ys, nil
+		}
+		return nil, fmt.Errorf("%s is not supported on strings", n.Op)
+	}
+	xn := x.(int64)
+	yn, ok := y.(int64)
+	if !ok {
+		return nil, fmt.Errorf("cannot compare a number with a string")
+	}
+	switch n.Op {
+	case "==":
+		return fromBool(xn == yn), nil
+	case "!=":
+		return fromBool(xn != yn), nil
+	case "<":
+		return fromBool(xn < yn), nil
+	case "<=":
+		return fromBool(xn <= yn), nil
+	case ">":
+		return fromBool(xn > yn), nil
+	case ">=":
+		return fromBool(xn >= yn), nil
+	}
+	value, err := exprutils.IntegerOp(n.Op, xn, yn)
+	if err != nil {
+		return nil, err
+	}
+	return value, nil
+}
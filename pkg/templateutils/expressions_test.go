@@ -0,0 +1,110 @@
+package templateutils_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/LouisBrunner/mem-viz/pkg/templateutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Evaluates an expression as the count of an array of empty structs, which shows up in its name
+func evaluate(t *testing.T, expr string, data []byte) (string, error) {
+	t.Helper()
+	template := fmt.Sprintf(`
+root: a
+structs:
+  a:
+    fields:
+      - {name: x, type: u8}
+      - {name: s, type: "char[2]"}
+      - {name: e, type: empty, count: %q}
+  empty:
+    fields: []
+`, expr)
+	blocks, err := load(t, template).Apply(data)
+	if err != nil {
+		return "", err
+	}
+	return blocks[0].Content[0].Name, nil
+}
+
+func Test_expressions(t *testing.T) {
+	// Counts can't be larger than the file
+	data := append([]byte{6, 'o', 'k'}, make([]byte, 13)...)
+	for _, test := range []struct {
+		expr  string
+		count int
+	}{
+		{"1 + 2 * 3", 7},
+		{"(1 + 2) * 3", 9},
+		{"x / 4 + x % 4", 3},
+		{"10 - 4 - 3", 3},
+		{"0x10 >> 2 << 1", 8},
+		{"x & 3 | 8", 10},
+		{"x ^ 0b11", 5},
+		{"~x & 0xf", 9},
+		{"-x + 8", 2},
+		{"x == 6", 1},
+		{"x != 6", 0},
+		{"x < 6 || x >= 6", 1},
+		{"x > 5 && x <= 6", 1},
+		{"!x", 0},
+		{"!(x - 6)", 1},
+		{`s == "ok"`, 1},
+		{`s != "ok"`, 0},
+		{`s + "!" == "ok!"`, 1},
+		{"true + true", 2},
+		{"_size", 16},
+		{"_pos", 3},
+		{"_offset", 0},
+		// Short-circuit so unknown fields aren't evaluated
+		{"x == 1 && missing", 0},
+		{"x == 6 || missing", 1},
+	} {
+		name, err := evaluate(t, test.expr, data)
+		require.NoError(t, err, test.expr)
+		assert.Equal(t, fmt.Sprintf("e (%d)", test.count), name, test.expr)
+	}
+}
+
+func Test_expressions_invalid(t *testing.T) {
+	data := []byte{6, 'o', 'k'}
+	for _, test := range []struct {
+		expr string
+		err  string
+	}{
+		{"x / 0", "division by zero"},
+		{"x % (x - 6)", "division by zero"},
+		{"x << -1", "negative shift"},
+		{"x - 7", "is negative"},
+		{"s", "is not a number"},
+		{"s < 1", "cannot compare a string with a number"},
+		{`x == "a"`, "cannot compare a number with a string"},
+		{`s * s`, "* is not supported on strings"},
+		{"-s", "- needs a number"},
+		{"missing", `unknown field "missing"`},
+	} {
+		_, err := evaluate(t, test.expr, data)
+		assert.ErrorContains(t, err, test.err, test.expr)
+	}
+
+	for _, test := range []struct {
+		expr string
+		err  string
+	}{
+		{"1 +", "unexpected end"},
+		{"(1", "missing )"},
+		{"1 2", `unexpected "2"`},
+		{"1 $ 2", "unexpected character '$'"},
+		{"0xzz", `invalid number "0xzz"`},
+		{`"abc`, "unterminated string"},
+		{")", `unexpected ")"`},
+	} {
+		template := fmt.Sprintf("root: a\nstructs: {a: {fields: [{name: x, type: u8, if: %q}]}}", test.expr)
+		_, err := templateutils.Load(strings.NewReader(template))
+		assert.ErrorContains(t, err, test.err, test.expr)
+	}
+}
@@ -0,0 +1,258 @@
+package templateutils
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/LouisBrunner/mem-viz/pkg/contracts"
+	"github.com/LouisBrunner/mem-viz/pkg/parsingutils"
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
+)
+
+// Numbers and strings read from the file
+type scalar struct {
+	// What expressions see (int64 or string), nil for floats
+	value any
+	// What is shown (e.g. an uint16 so it is formatted as such)
+	raw    any
+	text   string
+	format parsingutils.Formatter
+	size   uint64
+	// Enums and flags, shown as text but which keep their number
+	named bool
+}
+
+func (me *engine) applySingle(field *Field, typ *fieldType, s *scope, offset uint64, inline bool) (*contracts.MemoryBlock, uint64, error) {
+	switch typ.kind {
+	case kindStruct:
+		block, err := me.applyStruct(typ.structure, field.Name, offset, s, -1)
+		if err != nil || field.size == nil {
+			return block, 0, err
+		}
+		err = me.resize(block, field.size, s)
+		return block, 0, err
+	case kindBytes:
+		size, err := field.size.evalUint(s)
+		if err != nil {
+			return nil, 0, err
+		}
+		_, err = me.slice(offset, size)
+		if err != nil {
+			return nil, 0, err
+		}
+		return newBlock(field.Name, offset, size), 0, nil
+	}
+
+	value, err := me.readScalar(field, typ, s, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	if value.value != nil {
+		s.set(field.Name, value.value, value.text)
+	}
+	if inline {
+		addValue(s.block, field.Name, value, offset)
+		return nil, value.size, nil
+	}
+	block := newBlock(field.Name, offset, value.size)
+	addValue(block, "Value", value, offset)
+	return block, 0, nil
+}
+
+// Arrays of structs have a child per element, arrays of numbers and strings a value per element
+func (me *engine) applyArray(field *Field, typ *fieldType, s *scope, offset uint64) (*contracts.MemoryBlock, error) {
+	count, err := field.count.evalUint(s)
+	if err != nil {
+		return nil, err
+	}
+	// Elements can be empty, so this is the only thing stopping a bogus count
+	if count > uint64(len(me.data)) {
+		return nil, fmt.Errorf("count %d is larger than the file", count)
+	}
+	block := newBlock(fmt.Sprintf("%s (%d)", field.Name, count), offset, 0)
+	cursor := offset
+	for i := uint64(0); i < count; i += 1 {
+		name := fmt.Sprintf("%s[%d]", field.Name, i)
+		if typ.kind == kindStruct {
+			child, err := me.applyStruct(typ.structure, name, cursor, s, int64(i))
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", name, err)
+			}
+			addChild(block, child)
+			cursor += child.Size
+			continue
+		}
+		value, err := me.readScalar(field, typ, s, cursor)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		addValue(block, fmt.Sprintf("[%d]", i), value, cursor)
+		cursor += value.size
+	}
+	block.Size = cursor - offset
+	return block, nil
+}
+
+func (me *engine) readScalar(field *Field, typ *fieldType, s *scope, offset uint64) (scalar, error) {
+	switch typ.kind {
+	case kindString:
+		size := typ.size
+		if size == 0 {
+			var err error
+			size, err = field.size.evalUint(s)
+			if err != nil {
+				return scalar{}, err
+			}
+		}
+		raw, err := me.slice(offset, size)
+		if err != nil {
+			return scalar{}, err
+		}
+		// Fixed-size strings are usually padded with NULs
+		if end := bytes.IndexByte(raw, 0); end >= 0 {
+			raw = raw[:end]
+		}
+		return newString(string(raw), size), nil
+	case kindCString:
+		limit := uint64(len(me.data)) - min(offset, uint64(len(me.data)))
+		if field.size != nil {
+			var err error
+			limit, err = field.size.evalUint(s)
+			if err != nil {
+				return scalar{}, err
+			}
+		}
+		raw, err := me.slice(offset, limit)
+		if err != nil {
+			return scalar{}, err
+		}
+		end := bytes.IndexByte(raw, 0)
+		if end < 0 {
+			return scalar{}, fmt.Errorf("unterminated string at %#x", offset)
+		}
+		return newString(string(raw[:end]), uint64(end)+1), nil
+	}
+
+	raw, err := me.slice(offset, typ.size)
+	if err != nil {
+		return scalar{}, err
+	}
+	var bits uint64
+	switch typ.size {
+	case 1:
+		bits = uint64(raw[0])
+	case 2:
+		bits = uint64(typ.order.Uint16(raw))
+	case 4:
+		bits = uint64(typ.order.Uint32(raw))
+	case 8:
+		bits = typ.order.Uint64(raw)
+	}
+
+	value := scalar{size: typ.size, format: parsingutils.FormatValue}
+	switch typ.kind {
+	case kindFloat:
+		if typ.size == 4 {
+			value.raw = math.Float32frombits(uint32(bits))
+		} else {
+			value.raw = math.Float64frombits(bits)
+		}
+		value.text = fmt.Sprintf("%v", value.raw)
+		return value, nil
+	case kindSigned:
+		// Sign-extends from the size of the field
+		shift := 64 - 8*typ.size
+		signed := int64(bits<<shift) >> shift
+		value.value = signed
+		value.raw = sizedSigned(signed, typ.size)
+	default:
+		value.value = int64(bits)
+		value.raw = sizedUnsigned(bits, typ.size)
+	}
+
+	value.text = fmt.Sprintf("%d", value.value)
+	if field.Enum != "" {
+		names := me.tmpl.Enums[field.Enum]
+		if name, found := names[value.value.(int64)]; found {
+			value.text = name
+			value.named = true
+		}
+	} else if field.Flags != "" {
+		value.text = formatFlags(me.tmpl.Flags[field.Flags], bits)
+		value.named = true
+	}
+	return value, nil
+}
+
+func newString(text string, size uint64) scalar {
+	return scalar{
+		value:  text,
+		raw:    text,
+		text:   text,
+		size:   size,
+		format: func(name string, value any) string { return fmt.Sprintf("%q", value) },
+	}
+}
+
+// Keeps the type of the field so the value is shown like the other frontends do
+func sizedUnsigned(value uint64, size uint64) any {
+	switch size {
+	case 1:
+		return uint8(value)
+	case 2:
+		return uint16(value)
+	case 4:
+		return uint32(value)
+	}
+	return value
+}
+
+func sizedSigned(value int64, size uint64) any {
+	switch size {
+	case 1:
+		return int8(value)
+	case 2:
+		return int16(value)
+	case 4:
+		return int32(value)
+	}
+	return value
+}
+
+// e.g. "0x5 (READ|EXEC)", bits without a name are kept as a number
+func formatFlags(names map[uint64]string, value uint64) string {
+	masks := maps.Keys(names)
+	slices.Sort(masks)
+	parts := []string{}
+	left := value
+	for _, mask := range masks {
+		if mask != 0 && value&mask == mask {
+			parts = append(parts, names[mask])
+			left &^= mask
+		}
+	}
+	if len(parts) == 0 {
+		if name, found := names[0]; found && value == 0 {
+			return fmt.Sprintf("%#x (%s)", value, name)
+		}
+		return fmt.Sprintf("%#x", value)
+	}
+	if left != 0 {
+		parts = append(parts, fmt.Sprintf("%#x", left))
+	}
+	return fmt.Sprintf("%#x (%s)", value, strings.Join(parts, "|"))
+}
+
+// Long values (e.g. strings) are cut to the maximum size of a value
+func addValue(block *contracts.MemoryBlock, name string, value scalar, offset uint64) {
+	if value.named {
+		parsingutils.AddFormattedValue(block, name, value.raw, offset-uint64(block.Address), uint8(min(value.size, 0xff)), func(v any) (string, bool) {
+			return value.text, true
+		})
+		return
+	}
+	parsingutils.AddValue(block, name, value.raw, offset-uint64(block.Address), uint8(min(value.size, 0xff)), value.format)
+}
@@ -0,0 +1,327 @@
+package templateutils
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Templates describe a binary format declaratively (like 010 Editor templates or Kaitai), e.g.
+//
+//	root: header
+//	structs:
+//	  header:
+//	    fields:
+//	      - {name: magic, type: "char[4]"}
+//	      - {name: count, type: u32}
+//	      - {name: offset, type: u32}
+//	      - {name: entries, type: entry, count: count, at: offset}
+//	  entry:
+//	    fields:
+//	      - {name: id, type: u16, enum: ids}
+//
+// Fields follow each other inside their struct unless they are placed elsewhere with "at"
+type Template struct {
+	Name string `yaml:"name"`
+	// "little" (the default) or "big", can be overridden per field with a suffix (e.g. "u32be")
+	Endian string `yaml:"endian"`
+	// Struct laid out at the start of the file
+	Root    string                       `yaml:"root"`
+	Structs map[string]*Struct           `yaml:"structs"`
+	Enums   map[string]map[int64]string  `yaml:"enums"`
+	Flags   map[string]map[uint64]string `yaml:"flags"`
+
+	order binary.ByteOrder
+}
+
+type Struct struct {
+	// Name of the instances, fields can be used between braces (e.g. "Entry {id}")
+	Label string `yaml:"label"`
+	// Size of the struct when it isn't only its fields (e.g. padding or a size field), evaluated after the fields
+	Size   string   `yaml:"size"`
+	Fields []*Field `yaml:"fields"`
+
+	size *expression
+}
+
+type Field struct {
+	Name string `yaml:"name"`
+	// u8-u64, s8-s64, f32, f64, char[N], string (needs a size), cstring, bytes (needs a size) or the name of a struct
+	Type string `yaml:"type"`
+	// The field is an array of Count elements
+	Count string `yaml:"count"`
+	// Size of strings, bytes and structs (e.g. when they have padding), maximum size of cstrings
+	Size string `yaml:"size"`
+	// Offset where the field is instead of following the previous one, relative to Base
+	At string `yaml:"at"`
+	// "file" (the default) or "struct" (the start of the struct containing the field)
+	Base string `yaml:"base"`
+	// The field is skipped when the condition is false
+	If string `yaml:"if"`
+	// Names of the values of integers
+	Enum  string `yaml:"enum"`
+	Flags string `yaml:"flags"`
+	// Chooses the type of the field from a value (e.g. a tag), the field is skipped when no case matches without Default
+	Switch  string           `yaml:"switch"`
+	Cases   map[int64]string `yaml:"cases"`
+	Default string           `yaml:"default"`
+
+	typ      *fieldType
+	cases    map[int64]*fieldType
+	fallback *fieldType
+	count    *expression
+	size     *expression
+	at       *expression
+	cond     *expression
+	switchOn *expression
+}
+
+const (
+	BaseFile   = "file"
+	BaseStruct = "struct"
+)
+
+type kind int
+
+const (
+	kindUnsigned kind = iota
+	kindSigned
+	kindFloat
+	kindString
+	kindCString
+	kindBytes
+	kindStruct
+)
+
+type fieldType struct {
+	name string
+	kind kind
+	// Size of numbers and fixed strings (0 when it comes from the field)
+	size      uint64
+	order     binary.ByteOrder
+	structure *Struct
+}
+
+var (
+	numberType = regexp.MustCompile(`^([usf])(8|16|32|64)(le|be)?$`)
+	charType   = regexp.MustCompile(`^char\[(\d+)\]$`)
+)
+
+// Reads a template and checks it (types, enums and expressions), unknown keys are rejected to catch typos
+func Load(r io.Reader) (*Template, error) {
+	tmpl := &Template{}
+	dec := yaml.NewDecoder(r)
+	dec.KnownFields(true)
+	err := dec.Decode(tmpl)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("invalid template: %w", err)
+	}
+	err = tmpl.compile()
+	if err != nil {
+		return nil, fmt.Errorf("invalid template: %w", err)
+	}
+	return tmpl, nil
+}
+
+func (me *Template) compile() error {
+	switch me.Endian {
+	case "", "little":
+		me.order = binary.LittleEndian
+	case "big":
+		me.order = binary.BigEndian
+	default:
+		return fmt.Errorf("unknown endianness %q", me.Endian)
+	}
+	if me.Root == "" {
+		return fmt.Errorf("missing root struct")
+	}
+	if _, found := me.Structs[me.Root]; !found {
+		return fmt.Errorf("unknown root struct %q", me.Root)
+	}
+	for name, structure := range me.Structs {
+		err := me.compileStruct(structure)
+		if err != nil {
+			return fmt.Errorf("struct %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func (me *Template) compileStruct(structure *Struct) error {
+	var err error
+	structure.size, err = optionalExpression(structure.Size)
+	if err != nil {
+		return err
+	}
+	names := map[string]bool{}
+	for i, field := range structure.Fields {
+		if field.Name == "" {
+			return fmt.Errorf("field %d has no name", i)
+		}
+		// Fields under conditions or switches can be declared more than once (e.g. one per version)
+		if names[field.Name] && field.If == "" && field.Switch == "" {
+			return fmt.Errorf("duplicate field %s", field.Name)
+		}
+		names[field.Name] = true
+		err = me.compileField(field)
+		if err != nil {
+			return fmt.Errorf("field %s: %w", field.Name, err)
+		}
+	}
+	return nil
+}
+
+func (me *Template) compileField(field *Field) error {
+	var err error
+	for _, expr := range []struct {
+		source string
+		dest   **expression
+	}{
+		{field.Count, &field.count},
+		{field.Size, &field.size},
+		{field.At, &field.at},
+		{field.If, &field.cond},
+		{field.Switch, &field.switchOn},
+	} {
+		*expr.dest, err = optionalExpression(expr.source)
+		if err != nil {
+			return err
+		}
+	}
+	switch field.Base {
+	case "", BaseFile, BaseStruct:
+	default:
+		return fmt.Errorf("unknown base %q", field.Base)
+	}
+	if field.Base != "" && field.at == nil {
+		return fmt.Errorf("base without at")
+	}
+
+	if field.switchOn == nil {
+		if len(field.Cases) != 0 || field.Default != "" {
+			return fmt.Errorf("cases without switch")
+		}
+		field.typ, err = me.compileType(field, field.Type)
+		return err
+	}
+	if field.Type != "" {
+		return fmt.Errorf("switch replaces type")
+	}
+	field.cases = map[int64]*fieldType{}
+	for value, name := range field.Cases {
+		field.cases[value], err = me.compileType(field, name)
+		if err != nil {
+			return fmt.Errorf("case %d: %w", value, err)
+		}
+	}
+	if field.Default != "" {
+		field.fallback, err = me.compileType(field, field.Default)
+		if err != nil {
+			return fmt.Errorf("default: %w", err)
+		}
+	}
+	return nil
+}
+
+func (me *Template) compileType(field *Field, name string) (*fieldType, error) {
+	typ, err := me.parseType(name)
+	if err != nil {
+		return nil, err
+	}
+	switch typ.kind {
+	case kindUnsigned, kindSigned:
+		if field.Enum != "" && me.Enums[field.Enum] == nil {
+			return nil, fmt.Errorf("unknown enum %q", field.Enum)
+		}
+		if field.Flags != "" && me.Flags[field.Flags] == nil {
+			return nil, fmt.Errorf("unknown flags %q", field.Flags)
+		}
+		if field.Enum != "" && field.Flags != "" {
+			return nil, fmt.Errorf("enum and flags are exclusive")
+		}
+	default:
+		if field.Enum != "" || field.Flags != "" {
+			return nil, fmt.Errorf("enum and flags need an integer type")
+		}
+	}
+	switch typ.kind {
+	case kindString, kindBytes:
+		if typ.size == 0 && field.size == nil {
+			return nil, fmt.Errorf("%s needs a size", name)
+		}
+		if typ.kind == kindBytes && field.count != nil {
+			return nil, fmt.Errorf("bytes can't be repeated, use a struct instead")
+		}
+	case kindCString:
+	case kindStruct:
+		if field.size != nil && field.count != nil {
+			return nil, fmt.Errorf("size of repeated structs must be given by the struct")
+		}
+	default:
+		if field.size != nil {
+			return nil, fmt.Errorf("size is only for strings and bytes")
+		}
+	}
+	if typ.kind == kindString && typ.size != 0 && field.size != nil {
+		return nil, fmt.Errorf("%s already has a size", name)
+	}
+	return typ, nil
+}
+
+func (me *Template) parseType(name string) (*fieldType, error) {
+	if structure, found := me.Structs[name]; found {
+		return &fieldType{name: name, kind: kindStruct, structure: structure}, nil
+	}
+	if match := numberType.FindStringSubmatch(name); match != nil {
+		bits, _ := strconv.Atoi(match[2])
+		typ := &fieldType{name: name, size: uint64(bits / 8), order: me.order}
+		switch match[1] {
+		case "u":
+			typ.kind = kindUnsigned
+		case "s":
+			typ.kind = kindSigned
+		case "f":
+			if bits != 32 && bits != 64 {
+				return nil, fmt.Errorf("unknown type %q", name)
+			}
+			typ.kind = kindFloat
+		}
+		switch match[3] {
+		case "le":
+			typ.order = binary.LittleEndian
+		case "be":
+			typ.order = binary.BigEndian
+		}
+		return typ, nil
+	}
+	if match := charType.FindStringSubmatch(name); match != nil {
+		size, err := strconv.ParseUint(match[1], 10, 64)
+		if err != nil || size == 0 {
+			return nil, fmt.Errorf("invalid size in %q", name)
+		}
+		return &fieldType{name: name, kind: kindString, size: size}, nil
+	}
+	switch name {
+	case "string":
+		return &fieldType{name: name, kind: kindString}, nil
+	case "cstring":
+		return &fieldType{name: name, kind: kindCString}, nil
+	case "bytes":
+		return &fieldType{name: name, kind: kindBytes}, nil
+	case "":
+		return nil, fmt.Errorf("missing type")
+	}
+	return nil, fmt.Errorf("unknown type %q", name)
+}
+
+func optionalExpression(source string) (*expression, error) {
+	if source == "" {
+		return nil, nil
+	}
+	return parseExpression(source)
+}
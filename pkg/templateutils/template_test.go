@@ -0,0 +1,337 @@
+package templateutils_test
+
+import (
+	"encoding/binary"
+	"strings"
+	"testing"
+
+	"github.com/LouisBrunner/mem-viz/pkg/contracts"
+	"github.com/LouisBrunner/mem-viz/pkg/contracts/contractstest"
+	"github.com/LouisBrunner/mem-viz/pkg/templateutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func pack(t *testing.T, order binary.ByteOrder, values ...any) []byte {
+	t.Helper()
+	data := []byte{}
+	for _, value := range values {
+		var err error
+		data, err = binary.Append(data, order, value)
+		require.NoError(t, err)
+	}
+	return data
+}
+
+func load(t *testing.T, template string) *templateutils.Template {
+	t.Helper()
+	tmpl, err := templateutils.Load(strings.NewReader(template))
+	require.NoError(t, err)
+	return tmpl
+}
+
+func apply(t *testing.T, template string, data []byte) []*contracts.MemoryBlock {
+	t.Helper()
+	blocks, err := load(t, template).Apply(data)
+	require.NoError(t, err)
+	return blocks
+}
+
+const firmwareTemplate = `
+name: Firmware
+root: header
+enums:
+  kinds: {0: BOOT, 1: APP}
+flags:
+  attrs: {1: COMPRESSED, 2: SIGNED}
+structs:
+  header:
+    fields:
+      - {name: magic, type: "char[4]"}
+      - {name: version, type: u16}
+      - {name: count, type: u16}
+      - {name: table, type: u32}
+      - {name: build, type: u32, if: version >= 2}
+      - {name: entries, type: entry, count: count, at: table}
+  entry:
+    label: "Entry {_index} ({kind})"
+    fields:
+      - {name: kind, type: u8, enum: kinds}
+      - {name: attrs, type: u8, flags: attrs}
+      - {name: size, type: u16}
+      - {name: offset, type: u32}
+      - {name: payload, type: bytes, size: size, at: offset}
+`
+
+func Test_Apply(t *testing.T) {
+	data := pack(t, binary.LittleEndian,
+		[]byte("FWIM"), uint16(2), uint16(2), uint32(0x10), uint32(0xcafe),
+		// Entries
+		uint8(0), uint8(3), uint16(4), uint32(0x20),
+		uint8(7), uint8(4), uint16(8), uint32(0x24),
+		// Payloads
+		uint32(0), uint64(0),
+	)
+	blocks := apply(t, firmwareTemplate, data)
+	require.Len(t, blocks, 4)
+
+	header := blocks[0]
+	assert.Equal(t, "Firmware", header.Name)
+	assert.Equal(t, uintptr(0), header.Address)
+	assert.Equal(t, uint64(0x10), header.Size)
+	assert.Equal(t, `"FWIM"`, contractstest.FindValue(t, header, "magic").Value)
+	assert.Equal(t, "0xcafe", contractstest.FindValue(t, header, "build").Value)
+	assert.Equal(t, uint64(12), contractstest.FindValue(t, header, "build").Offset)
+	assert.Empty(t, header.Content)
+
+	// Blocks are placed once their contents are done
+	entries := blocks[3]
+	assert.Equal(t, "entries (2)", entries.Name)
+	assert.Equal(t, uintptr(0x10), entries.Address)
+	assert.Equal(t, uint64(0x10), entries.Size)
+	assert.Equal(t, []*contracts.MemoryLink{{Name: "gives amount", TargetAddress: 0x10}}, contractstest.FindValue(t, header, "count").Links)
+	assert.Equal(t, []*contracts.MemoryLink{{Name: "points to", TargetAddress: 0x10}}, contractstest.FindValue(t, header, "table").Links)
+
+	require.Len(t, entries.Content, 2)
+	first, second := entries.Content[0], entries.Content[1]
+	assert.Equal(t, "Entry 0 (BOOT)", first.Name)
+	assert.Equal(t, uint64(0), first.ParentOffset)
+	assert.Equal(t, "BOOT", contractstest.FindValue(t, first, "kind").Value)
+	assert.Equal(t, uint64(0), contractstest.FindValue(t, first, "kind").Raw)
+	assert.Equal(t, "0x3 (COMPRESSED|SIGNED)", contractstest.FindValue(t, first, "attrs").Value)
+	assert.Equal(t, "Entry 1 (7)", second.Name)
+	assert.Equal(t, uint64(8), second.ParentOffset)
+	assert.Equal(t, "0x7", contractstest.FindValue(t, second, "kind").Value)
+	assert.Equal(t, "0x4", contractstest.FindValue(t, second, "attrs").Value)
+
+	payload := blocks[2]
+	assert.Equal(t, "payload", payload.Name)
+	assert.Equal(t, uintptr(0x24), payload.Address)
+	assert.Equal(t, uint64(8), payload.Size)
+	assert.Equal(t, []*contracts.MemoryLink{{Name: "gives size", TargetAddress: 0x24}}, contractstest.FindValue(t, second, "size").Links)
+	assert.Equal(t, []*contracts.MemoryLink{{Name: "points to", TargetAddress: 0x24}}, contractstest.FindValue(t, second, "offset").Links)
+}
+
+func Test_Apply_conditions(t *testing.T) {
+	data := pack(t, binary.LittleEndian, []byte("FWIM"), uint16(1), uint16(0), uint32(0x10), uint32(0))
+	blocks := apply(t, firmwareTemplate, data)
+	require.Len(t, blocks, 2)
+	assert.Equal(t, uint64(0xc), blocks[0].Size)
+	assert.Len(t, blocks[0].Values, 4)
+	assert.Equal(t, "entries (0)", blocks[1].Name)
+}
+
+func Test_Apply_types(t *testing.T) {
+	template := `
+endian: big
+root: values
+structs:
+  values:
+    fields:
+      - {name: u, type: u16}
+      - {name: s, type: s8}
+      - {name: le, type: s32le}
+      - {name: f, type: f32}
+      - {name: fixed, type: "char[6]"}
+      - {name: c, type: cstring}
+      - {name: sized, type: string, size: u - 0x100}
+      - {name: list, type: u8, count: 3}
+      - {name: names, type: cstring, count: 2}
+`
+	data := pack(t, binary.BigEndian, uint16(0x102), int8(-2))
+	data = append(data, pack(t, binary.LittleEndian, int32(-0x10))...)
+	data = append(data, pack(t, binary.BigEndian, float32(1.5), []byte("abc\x00\x00\x00hello\x00xy"), []byte{1, 2, 3}, []byte("a\x00bc\x00"))...)
+	blocks := apply(t, template, data)
+	require.Len(t, blocks, 1)
+	values := blocks[0]
+	assert.Equal(t, "values", values.Name)
+	assert.Equal(t, uint64(len(data)), values.Size)
+
+	for _, expected := range []struct {
+		name   string
+		value  string
+		offset uint64
+		size   uint8
+	}{
+		{"u", "0x102", 0, 2},
+		{"s", "-0x2", 2, 1},
+		{"le", "-0x10", 3, 4},
+		{"f", "1.5", 7, 4},
+		{"fixed", `"abc"`, 11, 6},
+		{"c", `"hello"`, 17, 6},
+		{"sized", `"xy"`, 23, 2},
+	} {
+		value := contractstest.FindValue(t, values, expected.name)
+		assert.Equal(t, expected.value, value.Value, expected.name)
+		assert.Equal(t, expected.offset, value.Offset, expected.name)
+		assert.Equal(t, expected.size, value.Size, expected.name)
+	}
+
+	require.Len(t, values.Content, 2)
+	list := values.Content[0]
+	assert.Equal(t, "list (3)", list.Name)
+	assert.Equal(t, uint64(25), list.ParentOffset)
+	assert.Equal(t, []string{"0x1", "0x2", "0x3"}, []string{list.Values[0].Value, list.Values[1].Value, list.Values[2].Value})
+	names := values.Content[1]
+	assert.Equal(t, "names (2)", names.Name)
+	assert.Equal(t, uint64(5), names.Size)
+	assert.Equal(t, `"bc"`, contractstest.FindValue(t, names, "[1]").Value)
+	assert.Equal(t, uint64(2), contractstest.FindValue(t, names, "[1]").Offset)
+}
+
+func Test_Apply_switch(t *testing.T) {
+	template := `
+root: records
+structs:
+  records:
+    fields:
+      - {name: records, type: record, count: _size / 8}
+  record:
+    label: "Record {tag}"
+    size: 8
+    fields:
+      - {name: tag, type: u8}
+      - name: body
+        switch: tag
+        cases: {1: point, 2: u32}
+        default: empty
+  point:
+    fields:
+      - {name: x, type: u16}
+      - {name: y, type: u16}
+  empty:
+    fields: []
+`
+	data := pack(t, binary.LittleEndian,
+		uint8(1), uint16(3), uint16(4), []byte{0, 0, 0},
+		uint8(2), uint32(0x10), []byte{0, 0, 0},
+		uint8(9), []byte{0, 0, 0, 0, 0, 0, 0},
+	)
+	blocks := apply(t, template, data)
+	records := blocks[0].Content[0]
+	require.Len(t, records.Content, 3)
+
+	point := records.Content[0]
+	assert.Equal(t, "Record 1", point.Name)
+	assert.Equal(t, uint64(8), point.Size)
+	require.Len(t, point.Content, 1)
+	assert.Equal(t, "body", point.Content[0].Name)
+	assert.Equal(t, uint64(4), point.Content[0].Size)
+	assert.Equal(t, uint64(1), point.Content[0].ParentOffset)
+	assert.Equal(t, "0x4", contractstest.FindValue(t, point.Content[0], "y").Value)
+
+	assert.Equal(t, "0x10", contractstest.FindValue(t, records.Content[1], "body").Value)
+	assert.Empty(t, records.Content[1].Content)
+
+	empty := records.Content[2]
+	require.Len(t, empty.Content, 1)
+	assert.Equal(t, uint64(0), empty.Content[0].Size)
+}
+
+func Test_Apply_relative(t *testing.T) {
+	template := `
+root: file
+structs:
+  file:
+    fields:
+      - {name: chunks, type: chunk, count: 2}
+  chunk:
+    fields:
+      - {name: size, type: u8}
+      - {name: data_offset, type: u8}
+      - {name: data, type: bytes, size: size, at: data_offset, base: struct}
+    size: size + data_offset
+`
+	data := []byte{2, 2, 0xaa, 0xbb, 1, 3, 0, 0xcc}
+	blocks := apply(t, template, data)
+	require.Len(t, blocks, 3)
+	chunks := blocks[0].Content[0]
+	assert.Equal(t, []uint64{4, 4}, []uint64{chunks.Content[0].Size, chunks.Content[1].Size})
+	assert.Equal(t, uintptr(2), blocks[1].Address)
+	assert.Equal(t, uintptr(7), blocks[2].Address)
+	assert.Equal(t, uint64(1), blocks[2].Size)
+}
+
+func Test_Apply_invalid(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		template string
+		data     []byte
+		err      string
+	}{
+		{
+			name:     "out of bounds",
+			template: "root: a\nstructs: {a: {fields: [{name: x, type: u32}]}}",
+			data:     []byte{1, 2},
+			err:      "x: out of bounds",
+		},
+		{
+			name:     "pointer out of bounds",
+			template: "root: a\nstructs: {a: {fields: [{name: x, type: u8}, {name: y, type: u8, at: x}]}}",
+			data:     []byte{4},
+			err:      "y: out of bounds",
+		},
+		{
+			name:     "unterminated string",
+			template: "root: a\nstructs: {a: {fields: [{name: x, type: cstring}]}}",
+			data:     []byte("abc"),
+			err:      "unterminated string",
+		},
+		{
+			name:     "count too large",
+			template: "root: a\nstructs: {a: {fields: [{name: x, type: u8}, {name: y, type: b, count: x}]}, b: {fields: []}}",
+			data:     []byte{0xff},
+			err:      "larger than the file",
+		},
+		{
+			name:     "recursion",
+			template: "root: a\nstructs: {a: {fields: [{name: x, type: a}]}}",
+			data:     []byte{},
+			err:      "nested more than",
+		},
+		{
+			name:     "size too small",
+			template: "root: a\nstructs: {a: {size: 1, fields: [{name: x, type: u16}]}}",
+			data:     []byte{0, 0},
+			err:      "smaller than the fields",
+		},
+		{
+			name:     "unknown field",
+			template: "root: a\nstructs: {a: {fields: [{name: x, type: u8, count: y}]}}",
+			data:     []byte{0},
+			err:      `unknown field "y"`,
+		},
+	} {
+		_, err := load(t, test.template).Apply(test.data)
+		assert.ErrorContains(t, err, test.err, test.name)
+	}
+}
+
+func Test_Load_invalid(t *testing.T) {
+	for _, test := range []struct {
+		template string
+		err      string
+	}{
+		{"structs: {a: {fields: []}}", "missing root struct"},
+		{"root: b\nstructs: {a: {fields: []}}", `unknown root struct "b"`},
+		{"root: a\nendian: middle\nstructs: {a: {fields: []}}", "unknown endianness"},
+		{"root: a\nstructs: {a: {feilds: []}}", "field feilds not found"},
+		{"root: a\nstructs: {a: {fields: [{type: u8}]}}", "field 0 has no name"},
+		{"root: a\nstructs: {a: {fields: [{name: x, type: u8}, {name: x, type: u8}]}}", "duplicate field x"},
+		{"root: a\nstructs: {a: {fields: [{name: x, type: u24}]}}", `unknown type "u24"`},
+		{"root: a\nstructs: {a: {fields: [{name: x, type: f16}]}}", `unknown type "f16"`},
+		{"root: a\nstructs: {a: {fields: [{name: x}]}}", "missing type"},
+		{"root: a\nstructs: {a: {fields: [{name: x, type: bytes}]}}", "bytes needs a size"},
+		{"root: a\nstructs: {a: {fields: [{name: x, type: string}]}}", "string needs a size"},
+		{"root: a\nstructs: {a: {fields: [{name: x, type: u8, size: 2}]}}", "size is only for"},
+		{"root: a\nstructs: {a: {fields: [{name: x, type: u8, enum: e}]}}", `unknown enum "e"`},
+		{"root: a\nflags: {f: {1: A}}\nstructs: {a: {fields: [{name: x, type: cstring, flags: f}]}}", "need an integer type"},
+		{"root: a\nstructs: {a: {fields: [{name: x, type: u8, base: struct}]}}", "base without at"},
+		{"root: a\nstructs: {a: {fields: [{name: x, type: u8, cases: {1: u8}}]}}", "cases without switch"},
+		{"root: a\nstructs: {a: {fields: [{name: x, switch: 1, cases: {1: nope}}]}}", `case 1: unknown type "nope"`},
+		{"root: a\nstructs: {a: {fields: [{name: x, type: u8, count: 1 +}]}}", "invalid expression"},
+	} {
+		_, err := templateutils.Load(strings.NewReader(test.template))
+		assert.ErrorContains(t, err, test.err, test.template)
+	}
+}
@@ -0,0 +1,57 @@
+package wasm
+
+import (
+	"os"
+
+	"github.com/LouisBrunner/mem-viz/pkg/contracts"
+	"github.com/LouisBrunner/mem-viz/pkg/wasmutils"
+	"github.com/sirupsen/logrus"
+)
+
+type parser struct {
+	logger *logrus.Logger
+}
+
+func Parse(logger *logrus.Logger, file string) (*contracts.MemoryBlock, error) {
+	p := &parser{
+		logger: logger,
+	}
+	return p.parse(file)
+}
+
+func (me *parser) parse(file string) (*contracts.MemoryBlock, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	mod, err := wasmutils.NewModule(data)
+	if err != nil {
+		return nil, err
+	}
+
+	root := &contracts.MemoryBlock{
+		Name: file,
+		Size: uint64(len(data)),
+	}
+	me.addChild(root, mod.ParsePreamble())
+	for _, section := range mod.Sections {
+		block, err := mod.DecodeSection(section)
+		if err != nil {
+			// The section is still shown, only its contents are missing (e.g. types from the GC proposal)
+			me.logger.WithError(err).Warnf("failed to decode %s", block.Name)
+		}
+		me.addChild(root, block)
+	}
+	err = mod.ResolveLinks()
+	if err != nil {
+		return nil, err
+	}
+
+	return root, nil
+}
+
+// Sections follow each other, so they are already in order
+func (me *parser) addChild(parent, child *contracts.MemoryBlock) {
+	child.ParentOffset = uint64(child.Address - parent.Address)
+	parent.Content = append(parent.Content, child)
+}
@@ -0,0 +1,94 @@
+package wasmutils
+
+import (
+	"fmt"
+
+	"github.com/LouisBrunner/mem-viz/pkg/contracts"
+	"github.com/LouisBrunner/mem-viz/pkg/parsingutils"
+)
+
+// Bodies are prefixed by their size, their instructions aren't decoded
+func (me *Module) decodeCode(r *reader, parent *contracts.MemoryBlock, index uint32) error {
+	start := r.pos
+	size, err := r.u32()
+	if err != nil {
+		return err
+	}
+	sizeEnd := r.pos
+	_, err = r.bytes(uint64(size))
+	if err != nil {
+		return err
+	}
+	entry := addChild(parent, "", start, r.pos)
+	entry.Name = me.entryName("Function Body", spaceFunction, me.addEntry(spaceFunction, entry))
+	addValue(entry, "Size", size, start, sizeEnd, parsingutils.FormatValue)
+
+	body := newReader(r.data, sizeEnd, r.pos)
+	groups, err := body.u32()
+	if err != nil {
+		return err
+	}
+	groupsEnd := body.pos
+	locals := uint64(0)
+	for i := uint32(0); i < groups; i += 1 {
+		count, err := body.u32()
+		if err != nil {
+			return err
+		}
+		_, err = readValueType(body)
+		if err != nil {
+			return err
+		}
+		locals += uint64(count)
+	}
+	localsBlock := addChild(entry, fmt.Sprintf("Locals (%d)", locals), sizeEnd, body.pos)
+	addValue(localsBlock, "Groups", groups, sizeEnd, groupsEnd, parsingutils.FormatValue)
+	if !body.done() {
+		addChild(entry, "Code", body.pos, body.end)
+	}
+	return nil
+}
+
+// Segments are either active (copied at an offset in a memory when instantiating the module) or passive
+func (me *Module) decodeData(r *reader, parent *contracts.MemoryBlock, index uint32) error {
+	entry := addChild(parent, "", r.pos, r.pos)
+	segmentIndex := me.addEntry(spaceData, entry)
+	flags, err := readIndex(r, entry, "Flags")
+	if err != nil {
+		return err
+	}
+	description := "passive"
+	switch flags {
+	case 0, 2:
+		memory := uint32(0)
+		if flags == 2 {
+			memory, err = me.readReference(r, entry, "Memory", "refers to", spaceMemory)
+			if err != nil {
+				return err
+			}
+		}
+		offset, err := me.readExpr(r, entry, "Offset")
+		if err != nil {
+			return err
+		}
+		description = fmt.Sprintf("memory %d @ %s", memory, formatOffset(offset))
+	case 1:
+	default:
+		return fmt.Errorf("invalid data segment flags %#x", flags)
+	}
+	size, err := readIndex(r, entry, "Size")
+	if err != nil {
+		return err
+	}
+	start := r.pos
+	_, err = r.bytes(uint64(size))
+	if err != nil {
+		return err
+	}
+	if size != 0 {
+		addChild(entry, "Data", start, r.pos)
+	}
+	entry.Name = me.describedName("Data Segment", spaceData, segmentIndex, description)
+	entry.Size = r.pos - uint64(entry.Address)
+	return nil
+}
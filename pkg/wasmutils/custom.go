@@ -0,0 +1,208 @@
+package wasmutils
+
+import (
+	"fmt"
+
+	"github.com/LouisBrunner/mem-viz/pkg/contracts"
+	"github.com/LouisBrunner/mem-viz/pkg/parsingutils"
+)
+
+const nameSubsectionModule = 0
+
+// Subsections of the "name" section, most of them map indices of an index space to names
+var nameSubsections = map[byte]struct {
+	name     string
+	space    space
+	indirect bool
+}{
+	nameSubsectionModule: {name: "Module Name"},
+	1:                    {name: "Function Names", space: spaceFunction},
+	2:                    {name: "Local Names", indirect: true},
+	3:                    {name: "Label Names", indirect: true},
+	4:                    {name: "Type Names", space: spaceType},
+	5:                    {name: "Table Names", space: spaceTable},
+	6:                    {name: "Memory Names", space: spaceMemory},
+	7:                    {name: "Global Names", space: spaceGlobal},
+	8:                    {name: "Element Segment Names", space: spaceElement},
+	9:                    {name: "Data Segment Names", space: spaceData},
+	10:                   {name: "Field Names", indirect: true},
+	11:                   {name: "Tag Names", space: spaceTag},
+}
+
+type nameEntry struct {
+	index    uint32
+	name     string
+	start    uint64
+	indexEnd uint64
+	end      uint64
+}
+
+func (me *Module) decodeCustom(r *reader, block *contracts.MemoryBlock, section Section) error {
+	_, err := readName(r, block, "Name")
+	if err != nil {
+		return err
+	}
+	block.Name = fmt.Sprintf("Custom Section (%s)", section.Name)
+	switch section.Name {
+	case "name":
+		return me.decodeNames(r, block)
+	case "producers":
+		return decodeProducers(r, block)
+	}
+	if !r.done() {
+		addChild(block, "Payload", r.pos, r.end)
+	}
+	return nil
+}
+
+// Calls visit for each subsection of the name section with a reader limited to its contents
+func walkNameSubsections(r *reader, visit func(id byte, start uint64, contents *reader) error) error {
+	for !r.done() {
+		start := r.pos
+		id, err := r.u8()
+		if err != nil {
+			return err
+		}
+		size, err := r.u32()
+		if err != nil {
+			return err
+		}
+		contentsStart := r.pos
+		_, err = r.bytes(uint64(size))
+		if err != nil {
+			return fmt.Errorf("name subsection at %#x is out of bounds: %w", start, err)
+		}
+		err = visit(id, start, newReader(r.data, contentsStart, r.pos))
+		if err != nil {
+			return fmt.Errorf("failed to decode name subsection %d at %#x: %w", id, start, err)
+		}
+	}
+	return nil
+}
+
+// Also returns where the count of entries ends
+func readNameMap(r *reader) ([]nameEntry, uint64, error) {
+	count, err := r.u32()
+	if err != nil {
+		return nil, 0, err
+	}
+	countEnd := r.pos
+	entries := make([]nameEntry, 0, min(count, 0x1000))
+	for i := uint32(0); i < count; i += 1 {
+		entry := nameEntry{start: r.pos}
+		entry.index, err = r.u32()
+		if err != nil {
+			return nil, 0, err
+		}
+		entry.indexEnd = r.pos
+		entry.name, err = r.name()
+		if err != nil {
+			return nil, 0, err
+		}
+		entry.end = r.pos
+		entries = append(entries, entry)
+	}
+	return entries, countEnd, nil
+}
+
+// Only keeps the names, the blocks are created when the section is decoded in order
+func (me *Module) readNames(section Section) error {
+	r := newReader(me.Data, section.ContentOffset, section.End)
+	_, err := r.name()
+	if err != nil {
+		return err
+	}
+	return walkNameSubsections(r, func(id byte, start uint64, contents *reader) error {
+		subsection, found := nameSubsections[id]
+		if !found || subsection.indirect || id == nameSubsectionModule {
+			return nil
+		}
+		entries, _, err := readNameMap(contents)
+		if err != nil {
+			return err
+		}
+		names := me.names[subsection.space]
+		if names == nil {
+			names = map[uint32]string{}
+			me.names[subsection.space] = names
+		}
+		for _, entry := range entries {
+			names[entry.index] = entry.name
+		}
+		return nil
+	})
+}
+
+func (me *Module) decodeNames(r *reader, block *contracts.MemoryBlock) error {
+	return walkNameSubsections(r, func(id byte, start uint64, contents *reader) error {
+		subsection, found := nameSubsections[id]
+		name := subsection.name
+		if !found {
+			name = fmt.Sprintf("Subsection %d", id)
+		}
+		child := addChild(block, name, start, contents.end)
+		addValue(child, "ID", id, start, start+1, parsingutils.FormatValue)
+		addValue(child, "Size", contents.end-contents.pos, start+1, contents.pos, parsingutils.FormatValue)
+		switch {
+		case !found || subsection.indirect:
+			return nil
+		case id == nameSubsectionModule:
+			moduleName, err := readName(contents, child, "Name")
+			if err != nil {
+				return err
+			}
+			child.Name = fmt.Sprintf("%s (%s)", name, moduleName)
+			return nil
+		}
+
+		countStart := contents.pos
+		entries, countEnd, err := readNameMap(contents)
+		if err != nil {
+			return err
+		}
+		addValue(child, "Count", uint32(len(entries)), countStart, countEnd, parsingutils.FormatValue)
+		child.Name = fmt.Sprintf("%s (%d)", name, len(entries))
+		for _, entry := range entries {
+			nameBlock := addChild(child, fmt.Sprintf("Name (%s)", entry.name), entry.start, entry.end)
+			addValue(nameBlock, "Index", entry.index, entry.start, entry.indexEnd, parsingutils.FormatValue)
+			addValue(nameBlock, "Name", entry.name, entry.indexEnd, entry.end, formatString)
+			me.link(nameBlock, "Index", "refers to", subsection.space, entry.index)
+		}
+		return nil
+	})
+}
+
+// Tools which produced the module, e.g. "language: Go go1.22" or "processed-by: wasm-opt 116"
+func decodeProducers(r *reader, block *contracts.MemoryBlock) error {
+	fields, err := readIndex(r, block, "Count")
+	if err != nil {
+		return err
+	}
+	for i := uint32(0); i < fields; i += 1 {
+		field := addChild(block, "", r.pos, r.pos)
+		fieldName, err := readName(r, field, "Name")
+		if err != nil {
+			return err
+		}
+		field.Name = fmt.Sprintf("Field (%s)", fieldName)
+		count, err := readIndex(r, field, "Count")
+		if err != nil {
+			return err
+		}
+		for j := uint32(0); j < count; j += 1 {
+			producer := addChild(field, "", r.pos, r.pos)
+			name, err := readName(r, producer, "Name")
+			if err != nil {
+				return err
+			}
+			version, err := readName(r, producer, "Version")
+			if err != nil {
+				return err
+			}
+			producer.Name = fmt.Sprintf("Producer (%s %s)", name, version)
+			producer.Size = r.pos - uint64(producer.Address)
+		}
+		field.Size = r.pos - uint64(field.Address)
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package wasmutils
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Constant expressions (e.g. the offset of a data segment or the initial value of a global)
+type constExpr struct {
+	text string
+	// Only when the expression is a single integer constant
+	value    int64
+	hasValue bool
+	// Indices used by the expression (e.g. ref.func or global.get)
+	refs []exprRef
+}
+
+type exprRef struct {
+	space space
+	index uint32
+}
+
+const opEnd = 0x0b
+
+// Binary operators of the extended constant expressions proposal
+var constOperators = map[byte]string{
+	0x6a: "i32.add",
+	0x6b: "i32.sub",
+	0x6c: "i32.mul",
+	0x7c: "i64.add",
+	0x7d: "i64.sub",
+	0x7e: "i64.mul",
+}
+
+func readConstExpr(r *reader) (constExpr, error) {
+	expr := constExpr{}
+	instructions := []string{}
+	for {
+		start := r.pos
+		op, err := r.u8()
+		if err != nil {
+			return constExpr{}, err
+		}
+		var text string
+		switch op {
+		case opEnd:
+			expr.text = strings.Join(instructions, " ")
+			expr.hasValue = expr.hasValue && len(instructions) == 1
+			return expr, nil
+		case 0x41, 0x42:
+			value, err := r.s64()
+			if err != nil {
+				return constExpr{}, err
+			}
+			name := "i32.const"
+			if op == 0x42 {
+				name = "i64.const"
+			} else {
+				value = int64(int32(value))
+			}
+			text = fmt.Sprintf("%s %#x", name, value)
+			expr.value, expr.hasValue = value, true
+		case 0x43:
+			raw, err := r.bytes(4)
+			if err != nil {
+				return constExpr{}, err
+			}
+			text = fmt.Sprintf("f32.const %v", math.Float32frombits(binary.LittleEndian.Uint32(raw)))
+		case 0x44:
+			raw, err := r.bytes(8)
+			if err != nil {
+				return constExpr{}, err
+			}
+			text = fmt.Sprintf("f64.const %v", math.Float64frombits(binary.LittleEndian.Uint64(raw)))
+		case 0x23:
+			index, err := r.u32()
+			if err != nil {
+				return constExpr{}, err
+			}
+			text = fmt.Sprintf("global.get %d", index)
+			expr.refs = append(expr.refs, exprRef{space: spaceGlobal, index: index})
+		case 0xd0:
+			heap, err := readHeapType(r)
+			if err != nil {
+				return constExpr{}, err
+			}
+			text = fmt.Sprintf("ref.null %s", heap)
+		case 0xd2:
+			index, err := r.u32()
+			if err != nil {
+				return constExpr{}, err
+			}
+			text = fmt.Sprintf("ref.func %d", index)
+			expr.refs = append(expr.refs, exprRef{space: spaceFunction, index: index})
+		case 0xfd:
+			sub, err := r.u32()
+			if err != nil {
+				return constExpr{}, err
+			}
+			// v128.const
+			if sub != 12 {
+				return constExpr{}, fmt.Errorf("unsupported instruction 0xfd %#x in constant expression at %#x", sub, start)
+			}
+			raw, err := r.bytes(16)
+			if err != nil {
+				return constExpr{}, err
+			}
+			text = fmt.Sprintf("v128.const 0x%x", raw)
+		default:
+			name, found := constOperators[op]
+			if !found {
+				return constExpr{}, fmt.Errorf("unsupported instruction %#x in constant expression at %#x", op, start)
+			}
+			text = name
+		}
+		instructions = append(instructions, text)
+	}
+}
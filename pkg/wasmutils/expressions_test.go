@@ -0,0 +1,76 @@
+package wasmutils_test
+
+import (
+	"testing"
+
+	"github.com/LouisBrunner/mem-viz/pkg/contracts/contractstest"
+	"github.com/LouisBrunner/mem-viz/pkg/wasmutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_DecodeSection_constExprs(t *testing.T) {
+	data := module(
+		section(wasmutils.SectionImport, vec(join(name("env"), name("base"), []byte{wasmutils.KindGlobal, 0x7f, 0x00}))),
+		section(wasmutils.SectionGlobal, vec(
+			[]byte{0x7f, 0x00, 0x41, 0x7f, 0x0b},
+			[]byte{0x7e, 0x00, 0x42, 0xc0, 0xbb, 0x78, 0x0b},
+			[]byte{0x7f, 0x00, 0x23, 0x00, 0x41, 0x10, 0x6a, 0x0b},
+			[]byte{0x70, 0x00, 0xd0, 0x70, 0x0b},
+			[]byte{0x64, 0x70, 0x00, 0xd2, 0x00, 0x0b},
+			[]byte{0x7c, 0x00, 0x44, 0, 0, 0, 0, 0, 0, 0xf8, 0x3f, 0x0b},
+		)),
+		section(wasmutils.SectionFunction, vec([]byte{0})),
+		section(wasmutils.SectionCode, vec(join(uleb(2), []byte{0, 0x0b}))),
+		section(wasmutils.SectionData, vec(join([]byte{0, 0x23, 0x00, 0x0b}, name("x")))),
+	)
+	blocks := decodeAll(t, data)
+	imported := blocks[1].Content[0]
+	globals := blocks[2].Content
+	require.Len(t, globals, 6)
+
+	expected := []struct {
+		name string
+		init string
+	}{
+		{"Global 1 (i32)", "i32.const -0x1"},
+		{"Global 2 (i64)", "i64.const -0x1e240"},
+		{"Global 3 (i32)", "global.get 0 i32.const 0x10 i32.add"},
+		{"Global 4 (funcref)", "ref.null func"},
+		{"Global 5 ((ref func))", "ref.func 0"},
+		{"Global 6 (f64)", "f64.const 1.5"},
+	}
+	for i, global := range globals {
+		assert.Equal(t, expected[i].name, global.Name)
+		assert.Equal(t, expected[i].init, contractstest.FindValue(t, global, "Init").Value)
+	}
+	assert.Equal(t, uint64(imported.Address), contractstest.FindValue(t, globals[2], "Init").Links[0].TargetAddress)
+	assert.Equal(t, uint64(blocks[4].Content[0].Address), contractstest.FindValue(t, globals[4], "Init").Links[0].TargetAddress)
+
+	segment := blocks[5].Content[0]
+	assert.Equal(t, "Data Segment 0 (memory 0 @ global.get 0)", segment.Name)
+	assert.Equal(t, uint64(imported.Address), contractstest.FindValue(t, segment, "Offset").Links[0].TargetAddress)
+}
+
+func Test_DecodeSection_invalid(t *testing.T) {
+	for _, contents := range [][]byte{
+		// Index longer than 32 bits
+		vec([]byte{0x7f, 0x00, 0x23, 0x80, 0x80, 0x80, 0x80, 0x80, 0x00, 0x0b}),
+		// Instruction which isn't constant
+		vec([]byte{0x7f, 0x00, 0x10, 0x00, 0x0b}),
+		// Unterminated expression
+		vec([]byte{0x7f, 0x00, 0x41, 0x01}),
+		// Invalid value type
+		vec([]byte{0x01, 0x00, 0x41, 0x01, 0x0b}),
+	} {
+		mod, err := wasmutils.NewModule(module(section(wasmutils.SectionGlobal, contents)))
+		require.NoError(t, err)
+		_, err = mod.DecodeSection(mod.Sections[0])
+		assert.Error(t, err)
+	}
+
+	mod, err := wasmutils.NewModule(module(section(wasmutils.SectionExport, vec(join([]byte{2, 0xff, 0xfe}, []byte{0, 0})))))
+	require.NoError(t, err)
+	_, err = mod.DecodeSection(mod.Sections[0])
+	assert.Error(t, err)
+}
@@ -0,0 +1,185 @@
+package wasmutils
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	SectionCustom    = 0
+	SectionType      = 1
+	SectionImport    = 2
+	SectionFunction  = 3
+	SectionTable     = 4
+	SectionMemory    = 5
+	SectionGlobal    = 6
+	SectionExport    = 7
+	SectionStart     = 8
+	SectionElement   = 9
+	SectionCode      = 10
+	SectionData      = 11
+	SectionDataCount = 12
+	SectionTag       = 13
+)
+
+// Name of each section and what its entries are called (for the vector ones)
+var sectionNames = map[byte]struct {
+	name    string
+	entries string
+}{
+	SectionCustom:    {"Custom", ""},
+	SectionType:      {"Type", "types"},
+	SectionImport:    {"Import", "imports"},
+	SectionFunction:  {"Function", "functions"},
+	SectionTable:     {"Table", "tables"},
+	SectionMemory:    {"Memory", "memories"},
+	SectionGlobal:    {"Global", "globals"},
+	SectionExport:    {"Export", "exports"},
+	SectionStart:     {"Start", ""},
+	SectionElement:   {"Element", "segments"},
+	SectionCode:      {"Code", "functions"},
+	SectionData:      {"Data", "segments"},
+	SectionDataCount: {"Data Count", ""},
+	SectionTag:       {"Tag", "tags"},
+}
+
+func SectionName(id byte) string {
+	if names, found := sectionNames[id]; found {
+		return names.name
+	}
+	return fmt.Sprintf("%#x", id)
+}
+
+// Kinds of imports and exports, they are also the index spaces they refer to
+const (
+	KindFunction = 0
+	KindTable    = 1
+	KindMemory   = 2
+	KindGlobal   = 3
+	KindTag      = 4
+)
+
+var kindNames = map[byte]string{
+	KindFunction: "func",
+	KindTable:    "table",
+	KindMemory:   "memory",
+	KindGlobal:   "global",
+	KindTag:      "tag",
+}
+
+func KindName(kind byte) string {
+	if name, found := kindNames[kind]; found {
+		return name
+	}
+	return fmt.Sprintf("%#x", kind)
+}
+
+var valueTypeNames = map[byte]string{
+	0x7f: "i32",
+	0x7e: "i64",
+	0x7d: "f32",
+	0x7c: "f64",
+	0x7b: "v128",
+	// Shorthands of the reference types (with the GC proposal)
+	0x74: "nullexnref",
+	0x73: "nullfuncref",
+	0x72: "nullexternref",
+	0x71: "nullref",
+	0x70: "funcref",
+	0x6f: "externref",
+	0x6e: "anyref",
+	0x6d: "eqref",
+	0x6c: "i31ref",
+	0x6b: "structref",
+	0x6a: "arrayref",
+	0x69: "exnref",
+}
+
+var heapTypeNames = map[byte]string{
+	0x74: "noexn",
+	0x73: "nofunc",
+	0x72: "noextern",
+	0x71: "none",
+	0x70: "func",
+	0x6f: "extern",
+	0x6e: "any",
+	0x6d: "eq",
+	0x6c: "i31",
+	0x6b: "struct",
+	0x6a: "array",
+	0x69: "exn",
+}
+
+const (
+	refNullType = 0x63
+	refType     = 0x64
+)
+
+// Value types are a single byte, except references to a heap type (e.g. "(ref null 3)")
+func readValueType(r *reader) (string, error) {
+	start := r.pos
+	b, err := r.u8()
+	if err != nil {
+		return "", err
+	}
+	if name, found := valueTypeNames[b]; found {
+		return name, nil
+	}
+	if b != refNullType && b != refType {
+		return "", fmt.Errorf("invalid value type %#x at %#x", b, start)
+	}
+	heap, err := readHeapType(r)
+	if err != nil {
+		return "", err
+	}
+	if b == refNullType {
+		return fmt.Sprintf("(ref null %s)", heap), nil
+	}
+	return fmt.Sprintf("(ref %s)", heap), nil
+}
+
+// Heap types are either a type index or one of the abstract types (encoded as negative numbers)
+func readHeapType(r *reader) (string, error) {
+	start := r.pos
+	value, err := r.s64()
+	if err != nil {
+		return "", err
+	}
+	if value >= 0 {
+		return fmt.Sprintf("%d", value), nil
+	}
+	if name, found := heapTypeNames[byte(value&0x7f)]; found {
+		return name, nil
+	}
+	return "", fmt.Errorf("invalid heap type %d at %#x", value, start)
+}
+
+func readValueTypes(r *reader) ([]string, error) {
+	count, err := r.u32()
+	if err != nil {
+		return nil, err
+	}
+	types := make([]string, 0, min(count, 0x100))
+	for i := uint32(0); i < count; i += 1 {
+		typ, err := readValueType(r)
+		if err != nil {
+			return nil, err
+		}
+		types = append(types, typ)
+	}
+	return types, nil
+}
+
+func formatValueTypes(types []string) string {
+	return fmt.Sprintf("(%s)", strings.Join(types, ", "))
+}
+
+func formatString(name string, value interface{}) string {
+	return fmt.Sprintf("%q", value)
+}
+
+func formatEnum(text string) func(name string, value interface{}) string {
+	return func(name string, value interface{}) string {
+		return text
+	}
+}
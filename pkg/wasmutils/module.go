@@ -0,0 +1,249 @@
+package wasmutils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/LouisBrunner/mem-viz/pkg/contracts"
+	"github.com/LouisBrunner/mem-viz/pkg/parsingutils"
+)
+
+// Modules are decoded in a single pass, blocks are given at their file offset (i.e. the file is expected to start at 0),
+// indices are only turned into links once the whole module has been decoded (e.g. exports come before the code)
+
+var Magic = []byte("\x00asm")
+
+const preambleSize = 8
+
+type Section struct {
+	ID byte
+	// Only for custom sections
+	Name string
+	// File offsets of the section (starting with its ID), of its contents and of its end
+	Offset        uint64
+	ContentOffset uint64
+	End           uint64
+}
+
+// Index spaces, the first ones match the kinds of imports and exports
+type space byte
+
+const (
+	spaceFunction space = KindFunction
+	spaceTable    space = KindTable
+	spaceMemory   space = KindMemory
+	spaceGlobal   space = KindGlobal
+	spaceTag      space = KindTag
+	spaceType     space = 5
+	spaceElement  space = 6
+	spaceData     space = 7
+)
+
+type pendingLink struct {
+	block *contracts.MemoryBlock
+	value string
+	name  string
+	space space
+	index uint32
+}
+
+type Module struct {
+	Data     []byte
+	Version  uint32
+	Sections []Section
+	// Names given by the "name" custom section
+	names map[space]map[uint32]string
+	// Where each entry of an index space is, imports come first in their space
+	entries map[space][]uintptr
+	links   []pendingLink
+}
+
+// Checks the preamble and finds the sections, the names are read upfront as the name section is usually last
+func NewModule(data []byte) (*Module, error) {
+	if len(data) < preambleSize || !bytes.Equal(data[:4], Magic) {
+		return nil, fmt.Errorf("invalid magic, not a WebAssembly module")
+	}
+	mod := &Module{
+		Data:    data,
+		Version: binary.LittleEndian.Uint32(data[4:]),
+		names:   map[space]map[uint32]string{},
+		entries: map[space][]uintptr{},
+	}
+	// Components use the same magic but their layer (the upper half of the version) isn't 0
+	if mod.Version>>16 != 0 {
+		return nil, fmt.Errorf("WebAssembly components are not supported")
+	}
+	r := newReader(data, preambleSize, uint64(len(data)))
+	for !r.done() {
+		section := Section{Offset: r.pos}
+		id, err := r.u8()
+		if err != nil {
+			return nil, err
+		}
+		size, err := r.u32()
+		if err != nil {
+			return nil, fmt.Errorf("invalid size of section at %#x: %w", section.Offset, err)
+		}
+		section.ID, section.ContentOffset = id, r.pos
+		_, err = r.bytes(uint64(size))
+		if err != nil {
+			return nil, fmt.Errorf("section at %#x is not inside the file: %w", section.Offset, err)
+		}
+		section.End = r.pos
+		if id == SectionCustom {
+			section.Name, err = newReader(data, section.ContentOffset, section.End).name()
+			if err != nil {
+				return nil, fmt.Errorf("invalid name of custom section at %#x: %w", section.Offset, err)
+			}
+		}
+		mod.Sections = append(mod.Sections, section)
+	}
+
+	for _, section := range mod.Sections {
+		if section.ID == SectionCustom && section.Name == "name" {
+			// Invalid names are reported when decoding the section, they are only cosmetic
+			_ = mod.readNames(section)
+		}
+	}
+	return mod, nil
+}
+
+func (me *Module) ParsePreamble() *contracts.MemoryBlock {
+	block := newBlock("Preamble", 0, preambleSize)
+	addValue(block, "Magic", string(me.Data[:4]), 0, 4, formatString)
+	addValue(block, "Version", me.Version, 4, 8, parsingutils.FormatValue)
+	return block
+}
+
+// Decodes the contents of a section, when it fails the section is still returned (without its contents) with the error
+func (me *Module) DecodeSection(section Section) (*contracts.MemoryBlock, error) {
+	block := newBlock(fmt.Sprintf("%s Section", SectionName(section.ID)), uintptr(section.Offset), section.End-section.Offset)
+	addValue(block, "ID", section.ID, section.Offset, section.Offset+1, func(name string, value interface{}) string {
+		return SectionName(section.ID)
+	})
+	addValue(block, "Size", section.End-section.ContentOffset, section.Offset+1, section.ContentOffset, parsingutils.FormatValue)
+
+	r := newReader(me.Data, section.ContentOffset, section.End)
+	var err error
+	switch section.ID {
+	case SectionCustom:
+		err = me.decodeCustom(r, block, section)
+	case SectionStart:
+		err = me.decodeStart(r, block)
+	case SectionDataCount:
+		err = me.decodeDataCount(r, block)
+	default:
+		decode, found := entryDecoders[section.ID]
+		if !found {
+			return block, fmt.Errorf("unknown section %#x", section.ID)
+		}
+		err = me.decodeEntries(r, block, section.ID, decode)
+	}
+	if err != nil {
+		block.Content = nil
+		return block, err
+	}
+	return block, nil
+}
+
+type entryDecoder func(me *Module, r *reader, parent *contracts.MemoryBlock, index uint32) error
+
+var entryDecoders = map[byte]entryDecoder{
+	SectionType:     (*Module).decodeType,
+	SectionImport:   (*Module).decodeImport,
+	SectionFunction: (*Module).decodeFunction,
+	SectionTable:    (*Module).decodeTable,
+	SectionMemory:   (*Module).decodeMemory,
+	SectionGlobal:   (*Module).decodeGlobal,
+	SectionExport:   (*Module).decodeExport,
+	SectionElement:  (*Module).decodeElement,
+	SectionCode:     (*Module).decodeCode,
+	SectionData:     (*Module).decodeData,
+	SectionTag:      (*Module).decodeTag,
+}
+
+// Most sections are a vector of entries
+func (me *Module) decodeEntries(r *reader, block *contracts.MemoryBlock, id byte, decode entryDecoder) error {
+	start := r.pos
+	count, err := r.u32()
+	if err != nil {
+		return err
+	}
+	addValue(block, "Count", count, start, r.pos, parsingutils.FormatValue)
+	block.Name = fmt.Sprintf("%s Section (%d %s)", SectionName(id), count, sectionNames[id].entries)
+	for i := uint32(0); i < count; i += 1 {
+		err = decode(me, r, block, i)
+		if err != nil {
+			return fmt.Errorf("failed to decode entry %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// Adds an entry to an index space and returns its index
+func (me *Module) addEntry(space space, block *contracts.MemoryBlock) uint32 {
+	me.entries[space] = append(me.entries[space], block.Address)
+	return uint32(len(me.entries[space]) - 1)
+}
+
+func (me *Module) count(space space) uint32 {
+	return uint32(len(me.entries[space]))
+}
+
+func (me *Module) name(space space, index uint32) string {
+	return me.names[space][index]
+}
+
+// e.g. "Function 3 (main)" or "Function 3" when the module doesn't have names
+func (me *Module) entryName(kind string, space space, index uint32) string {
+	if name := me.name(space, index); name != "" {
+		return fmt.Sprintf("%s %d (%s)", kind, index, name)
+	}
+	return fmt.Sprintf("%s %d", kind, index)
+}
+
+func (me *Module) link(block *contracts.MemoryBlock, value, name string, space space, index uint32) {
+	me.links = append(me.links, pendingLink{block: block, value: value, name: name, space: space, index: index})
+}
+
+// Turns the indices found while decoding into links, invalid indices are ignored
+func (me *Module) ResolveLinks() error {
+	for _, link := range me.links {
+		entries := me.entries[link.space]
+		if link.index >= uint32(len(entries)) {
+			continue
+		}
+		err := parsingutils.AddLinkWithAddr(link.block, link.value, link.name, entries[link.index])
+		if err != nil {
+			return err
+		}
+	}
+	me.links = nil
+	return nil
+}
+
+func newBlock(name string, address uintptr, size uint64) *contracts.MemoryBlock {
+	return &contracts.MemoryBlock{
+		Name:    name,
+		Address: address,
+		Size:    size,
+	}
+}
+
+// Adds a child spanning from start to end (file offsets)
+func addChild(parent *contracts.MemoryBlock, name string, start, end uint64) *contracts.MemoryBlock {
+	child := &contracts.MemoryBlock{
+		Name:         name,
+		Address:      uintptr(start),
+		Size:         end - start,
+		ParentOffset: start - uint64(parent.Address),
+	}
+	parent.Content = append(parent.Content, child)
+	return child
+}
+
+// Adds a value spanning from start to end (file offsets), long values (e.g. names) are cut to the maximum size of a value
+func addValue(block *contracts.MemoryBlock, name string, value interface{}, start, end uint64, format parsingutils.Formatter) {
+	parsingutils.AddValue(block, name, value, start-uint64(block.Address), uint8(min(end-start, 0xff)), format)
+}
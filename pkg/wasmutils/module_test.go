@@ -0,0 +1,221 @@
+package wasmutils_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/LouisBrunner/mem-viz/pkg/contracts"
+	"github.com/LouisBrunner/mem-viz/pkg/contracts/contractstest"
+	"github.com/LouisBrunner/mem-viz/pkg/wasmutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func uleb(value uint64) []byte {
+	out := []byte{}
+	for {
+		b := byte(value & 0x7f)
+		value >>= 7
+		if value == 0 {
+			return append(out, b)
+		}
+		out = append(out, b|0x80)
+	}
+}
+
+func join(parts ...[]byte) []byte {
+	return bytes.Join(parts, nil)
+}
+
+func name(value string) []byte {
+	return join(uleb(uint64(len(value))), []byte(value))
+}
+
+func vec(entries ...[]byte) []byte {
+	return join(uleb(uint64(len(entries))), join(entries...))
+}
+
+func section(id byte, contents ...[]byte) []byte {
+	content := join(contents...)
+	return join([]byte{id}, uleb(uint64(len(content))), content)
+}
+
+func module(sections ...[]byte) []byte {
+	return join([]byte("\x00asm\x01\x00\x00\x00"), join(sections...))
+}
+
+func decodeAll(t *testing.T, data []byte) []*contracts.MemoryBlock {
+	mod, err := wasmutils.NewModule(data)
+	require.NoError(t, err)
+	blocks := []*contracts.MemoryBlock{mod.ParsePreamble()}
+	for _, section := range mod.Sections {
+		block, err := mod.DecodeSection(section)
+		require.NoError(t, err)
+		blocks = append(blocks, block)
+	}
+	require.NoError(t, mod.ResolveLinks())
+	return blocks
+}
+
+var testModule = module(
+	section(wasmutils.SectionType, vec(
+		[]byte{0x60, 2, 0x7f, 0x7f, 1, 0x7f},
+		[]byte{0x60, 0, 0},
+	)),
+	section(wasmutils.SectionImport, vec(
+		join(name("env"), name("log"), []byte{wasmutils.KindFunction, 1}),
+		join(name("env"), name("mem"), []byte{wasmutils.KindMemory, 0x01, 1, 2}),
+	)),
+	section(wasmutils.SectionFunction, vec([]byte{0}, []byte{1})),
+	section(wasmutils.SectionTable, vec([]byte{0x70, 0x00, 2})),
+	section(wasmutils.SectionGlobal, vec([]byte{0x7f, 0x01, 0x41, 0x80, 0x08, 0x0b})),
+	section(wasmutils.SectionExport, vec(
+		join(name("add"), []byte{wasmutils.KindFunction, 1}),
+		join(name("log"), []byte{wasmutils.KindFunction, 0}),
+		join(name("mem"), []byte{wasmutils.KindMemory, 0}),
+	)),
+	section(wasmutils.SectionStart, []byte{2}),
+	section(wasmutils.SectionElement, vec(join([]byte{0, 0x41, 0x01, 0x0b}, vec([]byte{1}, []byte{2})))),
+	section(wasmutils.SectionDataCount, []byte{2}),
+	section(wasmutils.SectionCode, vec(
+		join(uleb(7), []byte{0, 0x20, 0x00, 0x20, 0x01, 0x6a, 0x0b}),
+		join(uleb(4), []byte{1, 2, 0x7e, 0x0b}),
+	)),
+	section(wasmutils.SectionData, vec(
+		join([]byte{0, 0x41, 0x80, 0x08, 0x0b}, name("hi")),
+		join([]byte{1}, name("")),
+	)),
+	section(wasmutils.SectionCustom, name("name"),
+		section(0, name("test")),
+		section(1, vec(join([]byte{1}, name("add")), join([]byte{2}, name("main")))),
+		section(2, vec()),
+	),
+	section(wasmutils.SectionCustom, name("producers"), vec(
+		join(name("language"), vec(join(name("Go"), name("go1.22")))),
+	)),
+	section(wasmutils.SectionCustom, name("extra"), []byte{1, 2, 3}),
+)
+
+func Test_NewModule(t *testing.T) {
+	mod, err := wasmutils.NewModule(testModule)
+	require.NoError(t, err)
+	assert.Equal(t, uint32(1), mod.Version)
+	require.Len(t, mod.Sections, 14)
+	assert.Equal(t, wasmutils.Section{ID: wasmutils.SectionType, Offset: 8, ContentOffset: 10, End: 20}, mod.Sections[0])
+	assert.Equal(t, "name", mod.Sections[11].Name)
+	assert.Equal(t, "extra", mod.Sections[13].Name)
+
+	_, err = wasmutils.NewModule([]byte("\x7fELF\x01\x00\x00\x00"))
+	assert.Error(t, err)
+	_, err = wasmutils.NewModule(module(section(wasmutils.SectionType, vec()))[:10])
+	assert.Error(t, err)
+}
+
+func Test_DecodeSection(t *testing.T) {
+	blocks := decodeAll(t, testModule)
+	require.Len(t, blocks, 15)
+
+	preamble := blocks[0]
+	assert.Equal(t, "Preamble", preamble.Name)
+	assert.Equal(t, `"\x00asm"`, contractstest.FindValue(t, preamble, "Magic").Value)
+
+	types := blocks[1]
+	assert.Equal(t, "Type Section (2 types)", types.Name)
+	assert.Equal(t, "Type", contractstest.FindValue(t, types, "ID").Value)
+	require.Len(t, types.Content, 2)
+	assert.Equal(t, "Type 0 (i32, i32) -> (i32)", types.Content[0].Name)
+	assert.Equal(t, "Type 1 () -> ()", types.Content[1].Name)
+
+	imports := blocks[2]
+	require.Len(t, imports.Content, 2)
+	log := imports.Content[0]
+	assert.Equal(t, "Import 0 (env.log)", log.Name)
+	assert.Equal(t, "func", contractstest.FindValue(t, log, "Kind").Value)
+	assert.Equal(t, []*contracts.MemoryLink{{Name: "refers to", TargetAddress: uint64(types.Content[1].Address)}}, contractstest.FindValue(t, log, "Type").Links)
+	memory := imports.Content[1]
+	assert.Equal(t, "max", contractstest.FindValue(t, memory, "Flags").Value)
+	assert.Equal(t, "0x2", contractstest.FindValue(t, memory, "Max").Value)
+
+	functions := blocks[3]
+	require.Len(t, functions.Content, 2)
+	assert.Equal(t, "Function 1 (add)", functions.Content[0].Name)
+	assert.Equal(t, "Function 2 (main)", functions.Content[1].Name)
+
+	assert.Equal(t, "Table 0 (funcref)", blocks[4].Content[0].Name)
+	global := blocks[5].Content[0]
+	assert.Equal(t, "Global 0 (mut i32)", global.Name)
+	assert.Equal(t, "i32.const 0x400", contractstest.FindValue(t, global, "Init").Value)
+
+	code := blocks[10]
+	assert.Equal(t, "Code Section (2 functions)", code.Name)
+	require.Len(t, code.Content, 2)
+	add, main := code.Content[0], code.Content[1]
+	assert.Equal(t, "Function Body 1 (add)", add.Name)
+	assert.Equal(t, uint64(8), add.Size)
+	require.Len(t, add.Content, 2)
+	assert.Equal(t, "Locals (0)", add.Content[0].Name)
+	assert.Equal(t, "Code", add.Content[1].Name)
+	assert.Equal(t, uint64(6), add.Content[1].Size)
+	assert.Equal(t, "Function Body 2 (main)", main.Name)
+	assert.Equal(t, "Locals (2)", main.Content[0].Name)
+
+	exports := blocks[6]
+	require.Len(t, exports.Content, 3)
+	assert.Equal(t, "Export (add)", exports.Content[0].Name)
+	assert.Equal(t, []*contracts.MemoryLink{{Name: "points to", TargetAddress: uint64(add.Address)}}, contractstest.FindValue(t, exports.Content[0], "Index").Links)
+	assert.Equal(t, uint64(log.Address), contractstest.FindValue(t, exports.Content[1], "Index").Links[0].TargetAddress)
+	assert.Equal(t, uint64(memory.Address), contractstest.FindValue(t, exports.Content[2], "Index").Links[0].TargetAddress)
+
+	start := blocks[7]
+	assert.Equal(t, "Start Section (main)", start.Name)
+	assert.Equal(t, []*contracts.MemoryLink{{Name: "starts at", TargetAddress: uint64(main.Address)}}, contractstest.FindValue(t, start, "Function").Links)
+
+	elements := blocks[8].Content[0]
+	assert.Equal(t, "Element Segment 0 (table 0 @ 0x1)", elements.Name)
+	require.Len(t, elements.Content, 2)
+	assert.Equal(t, "Element 1 (main)", elements.Content[1].Name)
+	assert.Equal(t, uint64(main.Address), contractstest.FindValue(t, elements.Content[1], "Function").Links[0].TargetAddress)
+
+	assert.Equal(t, "0x2", contractstest.FindValue(t, blocks[9], "Count").Value)
+
+	data := blocks[11]
+	assert.Equal(t, "Data Section (2 segments)", data.Name)
+	require.Len(t, data.Content, 2)
+	assert.Equal(t, "Data Segment 0 (memory 0 @ 0x400)", data.Content[0].Name)
+	require.Len(t, data.Content[0].Content, 1)
+	assert.Equal(t, uint64(2), data.Content[0].Content[0].Size)
+	assert.Equal(t, "Data Segment 1 (passive)", data.Content[1].Name)
+	assert.Len(t, data.Content[1].Content, 0)
+
+	names := blocks[12]
+	assert.Equal(t, "Custom Section (name)", names.Name)
+	require.Len(t, names.Content, 3)
+	assert.Equal(t, "Module Name (test)", names.Content[0].Name)
+	assert.Equal(t, "Function Names (2)", names.Content[1].Name)
+	require.Len(t, names.Content[1].Content, 2)
+	assert.Equal(t, uint64(add.Address), contractstest.FindValue(t, names.Content[1].Content[0], "Index").Links[0].TargetAddress)
+	assert.Equal(t, "Local Names", names.Content[2].Name)
+
+	producers := blocks[13]
+	require.Len(t, producers.Content, 1)
+	assert.Equal(t, "Field (language)", producers.Content[0].Name)
+	require.Len(t, producers.Content[0].Content, 1)
+	assert.Equal(t, "Producer (Go go1.22)", producers.Content[0].Content[0].Name)
+
+	extra := blocks[14]
+	assert.Equal(t, "Custom Section (extra)", extra.Name)
+	require.Len(t, extra.Content, 1)
+	assert.Equal(t, "Payload", extra.Content[0].Name)
+	assert.Equal(t, uint64(3), extra.Content[0].Size)
+}
+
+func Test_DecodeSection_unsupported(t *testing.T) {
+	// A struct type from the GC proposal
+	mod, err := wasmutils.NewModule(module(section(wasmutils.SectionType, vec([]byte{0x5f, 1, 0x7f, 0}))))
+	require.NoError(t, err)
+	block, err := mod.DecodeSection(mod.Sections[0])
+	assert.Error(t, err)
+	assert.Equal(t, "Type Section (1 types)", block.Name)
+	assert.Len(t, block.Content, 0)
+	assert.Len(t, block.Values, 3)
+}
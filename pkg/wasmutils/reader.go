@@ -0,0 +1,92 @@
+package wasmutils
+
+import (
+	"fmt"
+	"unicode/utf8"
+)
+
+// Decodes the primitives of the binary format (LEB128 integers, bytes and names), positions are file offsets
+type reader struct {
+	data []byte
+	pos  uint64
+	end  uint64
+}
+
+func newReader(data []byte, start, end uint64) *reader {
+	return &reader{data: data, pos: start, end: end}
+}
+
+func (me *reader) done() bool {
+	return me.pos >= me.end
+}
+
+func (me *reader) u8() (byte, error) {
+	if me.pos >= me.end {
+		return 0, fmt.Errorf("unexpected end at %#x", me.pos)
+	}
+	value := me.data[me.pos]
+	me.pos += 1
+	return value, nil
+}
+
+func (me *reader) bytes(size uint64) ([]byte, error) {
+	if size > me.end-me.pos {
+		return nil, fmt.Errorf("unexpected end at %#x: %#x bytes needed, %#x left", me.pos, size, me.end-me.pos)
+	}
+	value := me.data[me.pos : me.pos+size]
+	me.pos += size
+	return value, nil
+}
+
+// Integers are encoded on at most ceil(bits / 7) bytes
+func (me *reader) leb(bits uint, signed bool) (uint64, error) {
+	start := me.pos
+	var value uint64
+	for shift := uint(0); ; shift += 7 {
+		if shift >= bits {
+			return 0, fmt.Errorf("LEB128 integer at %#x is longer than %d bits", start, bits)
+		}
+		b, err := me.u8()
+		if err != nil {
+			return 0, err
+		}
+		value |= uint64(b&0x7f) << shift
+		if b&0x80 != 0 {
+			continue
+		}
+		if signed && b&0x40 != 0 && shift+7 < 64 {
+			value |= ^uint64(0) << (shift + 7)
+		}
+		return value, nil
+	}
+}
+
+func (me *reader) u32() (uint32, error) {
+	value, err := me.leb(32, false)
+	return uint32(value), err
+}
+
+func (me *reader) u64() (uint64, error) {
+	return me.leb(64, false)
+}
+
+func (me *reader) s64() (int64, error) {
+	value, err := me.leb(64, true)
+	return int64(value), err
+}
+
+func (me *reader) name() (string, error) {
+	start := me.pos
+	size, err := me.u32()
+	if err != nil {
+		return "", err
+	}
+	raw, err := me.bytes(uint64(size))
+	if err != nil {
+		return "", err
+	}
+	if !utf8.Valid(raw) {
+		return "", fmt.Errorf("name at %#x is not valid UTF-8", start)
+	}
+	return string(raw), nil
+}
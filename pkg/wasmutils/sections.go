@@ -0,0 +1,434 @@
+package wasmutils
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/LouisBrunner/mem-viz/pkg/contracts"
+	"github.com/LouisBrunner/mem-viz/pkg/parsingutils"
+)
+
+const typeFormFunction = 0x60
+
+var limitFlagNames = []string{"max", "shared", "i64", "page-size"}
+
+func formatLimitFlags(flags byte) string {
+	parts := []string{}
+	for bit, name := range limitFlagNames {
+		if flags&(1<<bit) != 0 {
+			parts = append(parts, name)
+		}
+	}
+	if rest := flags &^ (1<<len(limitFlagNames) - 1); rest != 0 || len(parts) == 0 {
+		parts = append(parts, fmt.Sprintf("%#x", rest))
+	}
+	return strings.Join(parts, "+")
+}
+
+func formatText(name string, value interface{}) string {
+	return value.(string)
+}
+
+func readByte(r *reader, entry *contracts.MemoryBlock, name string, format parsingutils.Formatter) (byte, error) {
+	start := r.pos
+	value, err := r.u8()
+	if err != nil {
+		return 0, err
+	}
+	addValue(entry, name, value, start, r.pos, format)
+	return value, nil
+}
+
+func readIndex(r *reader, entry *contracts.MemoryBlock, name string) (uint32, error) {
+	start := r.pos
+	value, err := r.u32()
+	if err != nil {
+		return 0, err
+	}
+	addValue(entry, name, value, start, r.pos, parsingutils.FormatValue)
+	return value, nil
+}
+
+func readName(r *reader, entry *contracts.MemoryBlock, name string) (string, error) {
+	start := r.pos
+	value, err := r.name()
+	if err != nil {
+		return "", err
+	}
+	addValue(entry, name, value, start, r.pos, formatString)
+	return value, nil
+}
+
+func readValueTypeValue(r *reader, entry *contracts.MemoryBlock, name string) (string, error) {
+	start := r.pos
+	value, err := readValueType(r)
+	if err != nil {
+		return "", err
+	}
+	addValue(entry, name, value, start, r.pos, formatText)
+	return value, nil
+}
+
+// Reads an index and links it to the entry of its index space
+func (me *Module) readReference(r *reader, entry *contracts.MemoryBlock, name, linkName string, space space) (uint32, error) {
+	index, err := readIndex(r, entry, name)
+	if err != nil {
+		return 0, err
+	}
+	me.link(entry, name, linkName, space, index)
+	return index, nil
+}
+
+func (me *Module) readExpr(r *reader, entry *contracts.MemoryBlock, name string) (constExpr, error) {
+	start := r.pos
+	expr, err := readConstExpr(r)
+	if err != nil {
+		return constExpr{}, err
+	}
+	addValue(entry, name, expr.text, start, r.pos, formatText)
+	for _, ref := range expr.refs {
+		linkName := "refers to"
+		if ref.space == spaceFunction {
+			linkName = "points to"
+		}
+		me.link(entry, name, linkName, ref.space, ref.index)
+	}
+	return expr, nil
+}
+
+func readLimits(r *reader, entry *contracts.MemoryBlock) error {
+	flags, err := readByte(r, entry, "Flags", func(name string, value interface{}) string {
+		return formatLimitFlags(value.(byte))
+	})
+	if err != nil {
+		return err
+	}
+	read := func(name string) error {
+		start := r.pos
+		var value uint64
+		if flags&0x4 != 0 {
+			value, err = r.u64()
+		} else {
+			var value32 uint32
+			value32, err = r.u32()
+			value = uint64(value32)
+		}
+		if err != nil {
+			return err
+		}
+		addValue(entry, name, value, start, r.pos, parsingutils.FormatValue)
+		return nil
+	}
+	err = read("Min")
+	if err != nil {
+		return err
+	}
+	if flags&0x1 != 0 {
+		err = read("Max")
+		if err != nil {
+			return err
+		}
+	}
+	if flags&0x8 != 0 {
+		start := r.pos
+		log, err := r.u32()
+		if err != nil {
+			return err
+		}
+		addValue(entry, "PageSize", uint64(1)<<min(log, 63), start, r.pos, parsingutils.FormatValue)
+	}
+	return nil
+}
+
+func readGlobalType(r *reader, entry *contracts.MemoryBlock) (string, error) {
+	typ, err := readValueTypeValue(r, entry, "Type")
+	if err != nil {
+		return "", err
+	}
+	mutable, err := readByte(r, entry, "Mutable", parsingutils.FormatValue)
+	if err != nil {
+		return "", err
+	}
+	if mutable != 0 {
+		return "mut " + typ, nil
+	}
+	return typ, nil
+}
+
+// Only function types are supported, not the ones of the GC proposal (structs, arrays and recursive groups)
+func (me *Module) decodeType(r *reader, parent *contracts.MemoryBlock, index uint32) error {
+	entry := addChild(parent, "", r.pos, r.pos)
+	me.addEntry(spaceType, entry)
+	form, err := readByte(r, entry, "Form", func(name string, value interface{}) string {
+		if value.(byte) == typeFormFunction {
+			return "func"
+		}
+		return fmt.Sprintf("%#x", value)
+	})
+	if err != nil {
+		return err
+	}
+	if form != typeFormFunction {
+		return fmt.Errorf("unsupported type form %#x", form)
+	}
+	types := [2][]string{}
+	for i, name := range []string{"Params", "Results"} {
+		start := r.pos
+		types[i], err = readValueTypes(r)
+		if err != nil {
+			return err
+		}
+		addValue(entry, name, formatValueTypes(types[i]), start, r.pos, formatText)
+	}
+	entry.Size = r.pos - uint64(entry.Address)
+	entry.Name = fmt.Sprintf("%s %s -> %s", me.entryName("Type", spaceType, index), formatValueTypes(types[0]), formatValueTypes(types[1]))
+	return nil
+}
+
+func (me *Module) decodeImport(r *reader, parent *contracts.MemoryBlock, index uint32) error {
+	entry := addChild(parent, "", r.pos, r.pos)
+	module, err := readName(r, entry, "Module")
+	if err != nil {
+		return err
+	}
+	name, err := readName(r, entry, "Name")
+	if err != nil {
+		return err
+	}
+	entry.Name = fmt.Sprintf("Import %d (%s.%s)", index, module, name)
+	kind, err := readByte(r, entry, "Kind", func(name string, value interface{}) string {
+		return KindName(value.(byte))
+	})
+	if err != nil {
+		return err
+	}
+	switch kind {
+	case KindFunction:
+		_, err = me.readReference(r, entry, "Type", "refers to", spaceType)
+	case KindTable:
+		_, err = readValueTypeValue(r, entry, "Type")
+		if err == nil {
+			err = readLimits(r, entry)
+		}
+	case KindMemory:
+		err = readLimits(r, entry)
+	case KindGlobal:
+		_, err = readGlobalType(r, entry)
+	case KindTag:
+		_, err = readByte(r, entry, "Attribute", parsingutils.FormatValue)
+		if err == nil {
+			_, err = me.readReference(r, entry, "Type", "refers to", spaceType)
+		}
+	default:
+		return fmt.Errorf("unknown import kind %#x", kind)
+	}
+	if err != nil {
+		return err
+	}
+	me.addEntry(space(kind), entry)
+	entry.Size = r.pos - uint64(entry.Address)
+	return nil
+}
+
+// Declares the type of each function of the code section, they come after the imported functions in the index space
+func (me *Module) decodeFunction(r *reader, parent *contracts.MemoryBlock, index uint32) error {
+	entry := addChild(parent, "", r.pos, r.pos)
+	entry.Name = me.entryName("Function", spaceFunction, me.count(spaceFunction)+index)
+	_, err := me.readReference(r, entry, "Type", "refers to", spaceType)
+	if err != nil {
+		return err
+	}
+	entry.Size = r.pos - uint64(entry.Address)
+	return nil
+}
+
+// Tables with an initial value (from the function references proposal) start with 0x40 0x00
+func (me *Module) decodeTable(r *reader, parent *contracts.MemoryBlock, index uint32) error {
+	entry := addChild(parent, "", r.pos, r.pos)
+	tableIndex := me.addEntry(spaceTable, entry)
+	hasInit := r.pos+1 < r.end && r.data[r.pos] == 0x40 && r.data[r.pos+1] == 0x00
+	if hasInit {
+		start := r.pos
+		r.pos += 2
+		addValue(entry, "Prefix", uint16(0x0040), start, r.pos, parsingutils.FormatValue)
+	}
+	typ, err := readValueTypeValue(r, entry, "Type")
+	if err != nil {
+		return err
+	}
+	err = readLimits(r, entry)
+	if err != nil {
+		return err
+	}
+	if hasInit {
+		_, err = me.readExpr(r, entry, "Init")
+		if err != nil {
+			return err
+		}
+	}
+	entry.Name = me.describedName("Table", spaceTable, tableIndex, typ)
+	entry.Size = r.pos - uint64(entry.Address)
+	return nil
+}
+
+func (me *Module) decodeMemory(r *reader, parent *contracts.MemoryBlock, index uint32) error {
+	entry := addChild(parent, "", r.pos, r.pos)
+	entry.Name = me.entryName("Memory", spaceMemory, me.addEntry(spaceMemory, entry))
+	err := readLimits(r, entry)
+	if err != nil {
+		return err
+	}
+	entry.Size = r.pos - uint64(entry.Address)
+	return nil
+}
+
+func (me *Module) decodeGlobal(r *reader, parent *contracts.MemoryBlock, index uint32) error {
+	entry := addChild(parent, "", r.pos, r.pos)
+	globalIndex := me.addEntry(spaceGlobal, entry)
+	typ, err := readGlobalType(r, entry)
+	if err != nil {
+		return err
+	}
+	_, err = me.readExpr(r, entry, "Init")
+	if err != nil {
+		return err
+	}
+	entry.Name = me.describedName("Global", spaceGlobal, globalIndex, typ)
+	entry.Size = r.pos - uint64(entry.Address)
+	return nil
+}
+
+func (me *Module) decodeExport(r *reader, parent *contracts.MemoryBlock, index uint32) error {
+	entry := addChild(parent, "", r.pos, r.pos)
+	name, err := readName(r, entry, "Name")
+	if err != nil {
+		return err
+	}
+	entry.Name = fmt.Sprintf("Export (%s)", name)
+	kind, err := readByte(r, entry, "Kind", func(name string, value interface{}) string {
+		return KindName(value.(byte))
+	})
+	if err != nil {
+		return err
+	}
+	if _, found := kindNames[kind]; !found {
+		return fmt.Errorf("unknown export kind %#x", kind)
+	}
+	_, err = me.readReference(r, entry, "Index", "points to", space(kind))
+	if err != nil {
+		return err
+	}
+	entry.Size = r.pos - uint64(entry.Address)
+	return nil
+}
+
+func (me *Module) decodeStart(r *reader, block *contracts.MemoryBlock) error {
+	index, err := me.readReference(r, block, "Function", "starts at", spaceFunction)
+	if err != nil {
+		return err
+	}
+	if name := me.name(spaceFunction, index); name != "" {
+		block.Name = fmt.Sprintf("Start Section (%s)", name)
+	}
+	return nil
+}
+
+func (me *Module) decodeDataCount(r *reader, block *contracts.MemoryBlock) error {
+	_, err := readIndex(r, block, "Count")
+	return err
+}
+
+// The flags give the mode of the segment (active, passive or declarative) and how its elements are encoded
+func (me *Module) decodeElement(r *reader, parent *contracts.MemoryBlock, index uint32) error {
+	entry := addChild(parent, "", r.pos, r.pos)
+	segmentIndex := me.addEntry(spaceElement, entry)
+	flags, err := readIndex(r, entry, "Flags")
+	if err != nil {
+		return err
+	}
+	if flags > 7 {
+		return fmt.Errorf("invalid element segment flags %#x", flags)
+	}
+	active, usesExprs := flags&0x1 == 0, flags&0x4 != 0
+	description := "passive"
+	if flags&0x3 == 0x3 {
+		description = "declarative"
+	}
+	if active {
+		table := uint32(0)
+		if flags&0x2 != 0 {
+			table, err = me.readReference(r, entry, "Table", "refers to", spaceTable)
+			if err != nil {
+				return err
+			}
+		}
+		offset, err := me.readExpr(r, entry, "Offset")
+		if err != nil {
+			return err
+		}
+		description = fmt.Sprintf("table %d @ %s", table, formatOffset(offset))
+	}
+	if flags&0x3 != 0 {
+		if usesExprs {
+			_, err = readValueTypeValue(r, entry, "Type")
+		} else {
+			_, err = readByte(r, entry, "Kind", parsingutils.FormatValue)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	count, err := readIndex(r, entry, "Count")
+	if err != nil {
+		return err
+	}
+	for i := uint32(0); i < count; i += 1 {
+		element := addChild(entry, fmt.Sprintf("Element %d", i), r.pos, r.pos)
+		if usesExprs {
+			_, err = me.readExpr(r, element, "Init")
+		} else {
+			var function uint32
+			function, err = me.readReference(r, element, "Function", "points to", spaceFunction)
+			if name := me.name(spaceFunction, function); err == nil && name != "" {
+				element.Name = fmt.Sprintf("Element %d (%s)", i, name)
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("failed to decode element %d: %w", i, err)
+		}
+		element.Size = r.pos - uint64(element.Address)
+	}
+	entry.Name = me.describedName("Element Segment", spaceElement, segmentIndex, description)
+	entry.Size = r.pos - uint64(entry.Address)
+	return nil
+}
+
+func (me *Module) decodeTag(r *reader, parent *contracts.MemoryBlock, index uint32) error {
+	entry := addChild(parent, "", r.pos, r.pos)
+	entry.Name = me.entryName("Tag", spaceTag, me.addEntry(spaceTag, entry))
+	_, err := readByte(r, entry, "Attribute", parsingutils.FormatValue)
+	if err != nil {
+		return err
+	}
+	_, err = me.readReference(r, entry, "Type", "refers to", spaceType)
+	if err != nil {
+		return err
+	}
+	entry.Size = r.pos - uint64(entry.Address)
+	return nil
+}
+
+// e.g. "Global 0 (__stack_pointer, mut i32)" or "Global 0 (mut i32)" when the module doesn't have names
+func (me *Module) describedName(kind string, space space, index uint32, description string) string {
+	if name := me.name(space, index); name != "" {
+		return fmt.Sprintf("%s %d (%s, %s)", kind, index, name, description)
+	}
+	return fmt.Sprintf("%s %d (%s)", kind, index, description)
+}
+
+func formatOffset(offset constExpr) string {
+	if offset.hasValue {
+		return fmt.Sprintf("%#x", offset.value)
+	}
+	return offset.text
+}